@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/spf13/cobra"
+	"github.com/wham/gh-slackdump/internal/users"
+)
+
+var (
+	statsTop    int
+	statsAsJSON bool
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats <slack-link>",
+	Short: "Report who posts when in a channel or thread, instead of dumping it",
+	Long: `Fetches the channel or thread of a Slack link, like a dump, within --from and
+--to, and prints an analytics report of it instead of its messages: the
+messages of the top posters, messages per weekday and hour, thread
+participation, the median time to a thread's first answer, the most-used
+reactions and the busiest days. Weekdays, hours and days are in --tz.
+The report is a table unless --json is given. Users are IDs unless -u
+resolves them to handles.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStatsReport(context.Background(), os.Stdout, args[0])
+	},
+}
+
+func init() {
+	addSessionFlags(statsCmd)
+	statsCmd.Flags().StringVar(&fromTime, "from", "", "Count messages after this time (RFC3339 or YYYY-MM-DD)")
+	statsCmd.Flags().StringVar(&toTime, "to", "", "Count messages before this time (RFC3339 or YYYY-MM-DD)")
+	statsCmd.Flags().StringVar(&tzName, "tz", "", "Time zone of the weekdays, hours and days, e.g. Europe/Prague or Local (default UTC)")
+	statsCmd.Flags().IntVar(&statsTop, "top", 10, "List this many users, reactions and days")
+	statsCmd.Flags().BoolVar(&statsAsJSON, "json", false, "Print the report as one JSON object")
+	rootCmd.AddCommand(statsCmd)
+}
+
+// runStatsReport fetches the conversation of slackLink through the dump's
+// session and writes its report to w.
+func runStatsReport(ctx context.Context, w io.Writer, slackLink string) error {
+	if statsTop < 1 {
+		return errors.New("--top must be at least 1")
+	}
+	loc, err := parseTZ(tzName)
+	if err != nil {
+		return err
+	}
+	oldest, err := parseTime(fromTime)
+	if err != nil {
+		return fmt.Errorf("--from: %w", err)
+	}
+	latest, err := parseTime(toTime)
+	if err != nil {
+		return fmt.Errorf("--to: %w", err)
+	}
+	link, err := parseArchiveLink(slackLink)
+	if err != nil {
+		return err
+	}
+	users.SetCacheDir(cacheDir)
+	// The report goes to stdout; log only errors unless asked for more.
+	if verbose || trace {
+		setupLogging(logLevel(), false)
+	} else {
+		setupLogging(slog.LevelError, false)
+	}
+
+	sess, err := openSession(ctx, slackLink)
+	if err != nil {
+		return err
+	}
+	defer sess.close()
+	conv, err := dumpConversation(ctx, sess.sd, link, oldest, latest, nil)
+	if err != nil {
+		return err
+	}
+	if err := resolveConversationUsers(ctx, sess.provider, sess.workspaceURL, conv); err != nil {
+		return err
+	}
+	r := analyze(conv, loc, statsTop)
+	if statsAsJSON {
+		return json.NewEncoder(w).Encode(r)
+	}
+	return r.write(w)
+}
+
+// statsReport is the analytics report of a conversation.
+type statsReport struct {
+	Channel string `json:"channel"`
+	// TimeZone is the zone of Weekdays, Hours and BusiestDays.
+	TimeZone string `json:"time_zone"`
+	// Messages counts every message, Replies those in threads, and Users
+	// the distinct authors. A reply also sent to the channel counts once, as
+	// it does throughout the report; RawMessages counts every message record,
+	// BroadcastCopies of them the second copies of such replies.
+	Messages        int `json:"messages"`
+	Replies         int `json:"replies"`
+	Users           int `json:"users"`
+	RawMessages     int `json:"raw_messages"`
+	BroadcastCopies int `json:"broadcast_copies"`
+	// TopUsers are the authors of the most messages.
+	TopUsers []userActivity `json:"top_users"`
+	// Weekdays counts messages per weekday, Monday first, and Hours per
+	// hour of the day.
+	Weekdays []weekdayCount `json:"weekdays"`
+	Hours    [24]int        `json:"hours"`
+	Threads  threadActivity `json:"threads"`
+	// Reactions are the most-used reactions, by the users who left them.
+	Reactions   []reactionCount `json:"reactions"`
+	BusiestDays []dayCount      `json:"busiest_days"`
+}
+
+// userActivity is what one user posted: Messages in all, Replies of them
+// in threads, and the Threads they took part in.
+type userActivity struct {
+	User     string `json:"user"`
+	Messages int    `json:"messages"`
+	Replies  int    `json:"replies"`
+	Threads  int    `json:"threads"`
+}
+
+type weekdayCount struct {
+	Weekday  string `json:"weekday"`
+	Messages int    `json:"messages"`
+}
+
+// threadActivity describes the threads: how many there are, their mean
+// replies and participants (the parent's author included), and the median
+// time from a parent to the first reply by someone else, over the threads
+// that have one.
+type threadActivity struct {
+	Count                     int     `json:"count"`
+	MeanReplies               float64 `json:"mean_replies"`
+	MeanParticipants          float64 `json:"mean_participants"`
+	MedianResponseTimeSeconds float64 `json:"median_response_time_seconds"`
+	Answered                  int     `json:"answered"`
+}
+
+type reactionCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type dayCount struct {
+	Day      string `json:"day"`
+	Messages int    `json:"messages"`
+}
+
+// statsMessage is a message of the report with its thread: the ts of the
+// thread's parent, or empty outside threads.
+type statsMessage struct {
+	*types.Message
+	at     time.Time
+	thread string
+}
+
+// analyze reports on conv's messages, with their thread replies, listing
+// the top users, reactions and days.
+func analyze(conv *types.Conversation, loc *time.Location, top int) statsReport {
+	r := statsReport{Channel: cmp.Or(conv.Name, conv.ID), TimeZone: loc.String()}
+	var msgs []statsMessage
+	broadcasts := make(broadcastDedup)
+	var walk func(list []types.Message, thread string)
+	walk = func(list []types.Message, thread string) {
+		for i := range list {
+			m := &list[i]
+			at, err := parseSlackTS(m.Timestamp)
+			if err != nil {
+				continue
+			}
+			r.RawMessages++
+			if broadcasts.isCopy(m, thread != "" || (m.ThreadTimestamp != "" && m.ThreadTimestamp != m.Timestamp)) {
+				r.BroadcastCopies++
+				continue
+			}
+			th := cmp.Or(thread, m.ThreadTimestamp)
+			if th == "" && len(m.ThreadReplies) > 0 {
+				th = m.Timestamp
+			}
+			msgs = append(msgs, statsMessage{Message: m, at: at.In(loc), thread: th})
+			walk(m.ThreadReplies, th)
+		}
+	}
+	walk(conv.Messages, "")
+
+	byUser := map[string]*userActivity{}
+	threads := map[string][]statsMessage{}
+	weekdays := make([]int, 7)
+	days := map[string]int{}
+	reactions := map[string]int{}
+	for _, m := range msgs {
+		r.Messages++
+		reply := m.thread != "" && m.thread != m.Timestamp
+		if reply {
+			r.Replies++
+		}
+		if m.thread != "" {
+			threads[m.thread] = append(threads[m.thread], m)
+		}
+		if author := cmp.Or(m.User, m.BotID); author != "" {
+			u := byUser[author]
+			if u == nil {
+				u = &userActivity{User: author}
+				byUser[author] = u
+			}
+			u.Messages++
+			if reply {
+				u.Replies++
+			}
+		}
+		weekdays[m.at.Weekday()]++
+		r.Hours[m.at.Hour()]++
+		days[m.at.Format(time.DateOnly)]++
+		for _, re := range m.Reactions {
+			reactions[re.Name] += re.Count
+		}
+	}
+	r.Users = len(byUser)
+
+	var participants, replies int
+	var responses []time.Duration
+	for ts, thread := range threads {
+		// A parent alone, whose replies --to cut off, isn't a thread here.
+		var parent *statsMessage
+		for i := range thread {
+			if thread[i].Timestamp == ts {
+				parent = &thread[i]
+			}
+		}
+		if parent != nil && len(thread) == 1 {
+			continue
+		}
+		r.Threads.Count++
+		replies += len(thread)
+		if parent != nil {
+			replies--
+		}
+		seen := map[string]bool{}
+		for _, m := range thread {
+			if author := cmp.Or(m.User, m.BotID); author != "" && !seen[author] {
+				seen[author] = true
+				byUser[author].Threads++
+			}
+		}
+		participants += len(seen)
+		if d, ok := responseTime(parent, thread); ok {
+			responses = append(responses, d)
+		}
+	}
+	if r.Threads.Count > 0 {
+		r.Threads.MeanReplies = float64(replies) / float64(r.Threads.Count)
+		r.Threads.MeanParticipants = float64(participants) / float64(r.Threads.Count)
+	}
+	r.Threads.Answered = len(responses)
+	if len(responses) > 0 {
+		r.Threads.MedianResponseTimeSeconds = median(responses).Round(time.Second).Seconds()
+	}
+
+	for _, u := range byUser {
+		r.TopUsers = append(r.TopUsers, *u)
+	}
+	slices.SortFunc(r.TopUsers, func(a, b userActivity) int {
+		return cmp.Or(cmp.Compare(b.Messages, a.Messages), cmp.Compare(a.User, b.User))
+	})
+	r.TopUsers = r.TopUsers[:min(top, len(r.TopUsers))]
+	for i := range 7 {
+		d := time.Weekday((i + 1) % 7)
+		r.Weekdays = append(r.Weekdays, weekdayCount{Weekday: d.String(), Messages: weekdays[d]})
+	}
+	for name, n := range reactions {
+		r.Reactions = append(r.Reactions, reactionCount{Name: name, Count: n})
+	}
+	slices.SortFunc(r.Reactions, func(a, b reactionCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name))
+	})
+	r.Reactions = r.Reactions[:min(top, len(r.Reactions))]
+	for day, n := range days {
+		r.BusiestDays = append(r.BusiestDays, dayCount{Day: day, Messages: n})
+	}
+	slices.SortFunc(r.BusiestDays, func(a, b dayCount) int {
+		return cmp.Or(cmp.Compare(b.Messages, a.Messages), cmp.Compare(a.Day, b.Day))
+	})
+	r.BusiestDays = r.BusiestDays[:min(top, len(r.BusiestDays))]
+	return r
+}
+
+// responseTime returns the time from parent to the earliest reply in thread
+// by someone other than the parent's author, or false when there is none.
+func responseTime(parent *statsMessage, thread []statsMessage) (time.Duration, bool) {
+	if parent == nil {
+		return 0, false
+	}
+	author := cmp.Or(parent.User, parent.BotID)
+	var first *statsMessage
+	for i := range thread {
+		m := &thread[i]
+		if m.Timestamp == parent.Timestamp || cmp.Or(m.User, m.BotID) == author {
+			continue
+		}
+		if first == nil || m.at.Before(first.at) {
+			first = m
+		}
+	}
+	if first == nil {
+		return 0, false
+	}
+	return first.at.Sub(parent.at), true
+}
+
+// median returns the median of ds, which it sorts.
+func median(ds []time.Duration) time.Duration {
+	slices.Sort(ds)
+	n := len(ds)
+	if n%2 == 1 {
+		return ds[n/2]
+	}
+	return (ds[n/2-1] + ds[n/2]) / 2
+}
+
+// histogramWidth is the length of the longest bar of the report's
+// histograms.
+const histogramWidth = 40
+
+// write writes the report as tables, for people.
+func (r statsReport) write(w io.Writer) error {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s: %d messages, %d of them replies in %d threads, from %d users", r.Channel, r.Messages, r.Replies, r.Threads.Count, r.Users)
+	if r.BroadcastCopies > 0 {
+		fmt.Fprintf(tw, " (broadcast copies left out: %d)", r.BroadcastCopies)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "\nTOP USERS\tMESSAGES\tREPLIES\tTHREADS\n")
+	for _, u := range r.TopUsers {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", u.User, u.Messages, u.Replies, u.Threads)
+	}
+
+	var most int
+	for _, d := range r.Weekdays {
+		most = max(most, d.Messages)
+	}
+	for _, n := range r.Hours {
+		most = max(most, n)
+	}
+	fmt.Fprintf(tw, "\nWEEKDAY (%s)\tMESSAGES\t\n", r.TimeZone)
+	for _, d := range r.Weekdays {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", d.Weekday, d.Messages, bar(d.Messages, most))
+	}
+	fmt.Fprintf(tw, "\nHOUR (%s)\tMESSAGES\t\n", r.TimeZone)
+	for h, n := range r.Hours {
+		fmt.Fprintf(tw, "%02d:00\t%d\t%s\n", h, n, bar(n, most))
+	}
+
+	fmt.Fprintf(tw, "\nTHREADS\n")
+	fmt.Fprintf(tw, "threads\t%d\n", r.Threads.Count)
+	fmt.Fprintf(tw, "replies per thread\t%.1f\n", r.Threads.MeanReplies)
+	fmt.Fprintf(tw, "participants per thread\t%.1f\n", r.Threads.MeanParticipants)
+	response := "-"
+	if r.Threads.Answered > 0 {
+		response = fmt.Sprintf("%s, over %d answered threads", time.Duration(r.Threads.MedianResponseTimeSeconds*float64(time.Second)), r.Threads.Answered)
+	}
+	fmt.Fprintf(tw, "median response time\t%s\n", response)
+
+	fmt.Fprintf(tw, "\nREACTION\tCOUNT\n")
+	for _, re := range r.Reactions {
+		fmt.Fprintf(tw, ":%s:\t%d\n", re.Name, re.Count)
+	}
+	fmt.Fprintf(tw, "\nBUSIEST DAY\tMESSAGES\n")
+	for _, d := range r.BusiestDays {
+		fmt.Fprintf(tw, "%s\t%d\n", d.Day, d.Messages)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	// The padding of the histograms' empty bars.
+	for line := range strings.Lines(buf.String()) {
+		if _, err := io.WriteString(w, strings.TrimRight(line, " \n")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bar returns a histogram bar for n of at most most.
+func bar(n, most int) string {
+	if most == 0 {
+		return ""
+	}
+	return strings.Repeat("#", (n*histogramWidth+most-1)/most)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestAnalyze(t *testing.T) {
+	msg := func(ts, user string, replies ...types.Message) types.Message {
+		m := types.Message{Message: slack.Message{Msg: slack.Msg{Timestamp: ts, User: user}}, ThreadReplies: replies}
+		if len(replies) > 0 {
+			m.ThreadTimestamp = ts
+		}
+		return m
+	}
+	// Monday 2024-01-01 09:00 UTC, and the days after.
+	const day = 86400
+	ts := func(sec int) string { return strconv.Itoa(1704099600+sec) + ".000100" }
+	question := msg(ts(0), "U1",
+		msg(ts(600), "U1"),
+		msg(ts(1200), "U2"),
+		msg(ts(3000), "U3"),
+	)
+	question.Reactions = []slack.ItemReaction{{Name: "eyes", Count: 2}, {Name: "+1", Count: 1}}
+	other := msg(ts(day), "U2", msg(ts(day+60), "U1"))
+	other.Reactions = []slack.ItemReaction{{Name: "+1", Count: 3}}
+	conv := &types.Conversation{ID: "C1", Name: "general", Messages: []types.Message{
+		question,
+		other,
+		msg(ts(day+3600), "U2"),
+		// A thread parent whose replies --to cut off.
+		{Message: slack.Message{Msg: slack.Msg{Timestamp: ts(2 * day), ThreadTimestamp: ts(2 * day), BotID: "B1"}}},
+	}}
+
+	r := analyze(conv, time.UTC, 2)
+	if r.Messages != 8 || r.Replies != 4 || r.Users != 4 {
+		t.Errorf("%d messages, %d replies, %d users; want 8, 4, 4", r.Messages, r.Replies, r.Users)
+	}
+	if want := []userActivity{{"U1", 3, 2, 2}, {"U2", 3, 1, 2}}; !slices.Equal(r.TopUsers, want) {
+		t.Errorf("top users = %+v, want %+v", r.TopUsers, want)
+	}
+	if r.Weekdays[0] != (weekdayCount{"Monday", 4}) || r.Weekdays[1] != (weekdayCount{"Tuesday", 3}) || r.Weekdays[6].Weekday != "Sunday" {
+		t.Errorf("weekdays = %+v", r.Weekdays)
+	}
+	if r.Hours[9] != 7 || r.Hours[10] != 1 {
+		t.Errorf("hours 09 and 10 = %d and %d, want 7 and 1", r.Hours[9], r.Hours[10])
+	}
+	// Response times of 20m (U1's own reply doesn't count) and 1m.
+	want := threadActivity{Count: 2, MeanReplies: 2, MeanParticipants: 2.5, MedianResponseTimeSeconds: 630, Answered: 2}
+	if r.Threads != want {
+		t.Errorf("threads = %+v, want %+v", r.Threads, want)
+	}
+	if want := []reactionCount{{"+1", 4}, {"eyes", 2}}; !slices.Equal(r.Reactions, want) {
+		t.Errorf("reactions = %+v, want %+v", r.Reactions, want)
+	}
+	if want := []dayCount{{"2024-01-01", 4}, {"2024-01-02", 3}}; !slices.Equal(r.BusiestDays, want) {
+		t.Errorf("busiest days = %+v, want %+v", r.BusiestDays, want)
+	}
+
+	prague, _ := time.LoadLocation("Europe/Prague")
+	if r := analyze(conv, prague, 2); r.Hours[10] != 7 {
+		t.Errorf("hour 10 in Europe/Prague = %d, want 7", r.Hours[10])
+	}
+
+	var out bytes.Buffer
+	if err := r.write(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"general: 8 messages", "Monday", "10m30s, over 2 answered threads", ":+1:", "2024-01-02"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("report is missing %q:\n%s", s, out.String())
+		}
+	}
+}
+
+func TestAnalyzeBroadcasts(t *testing.T) {
+	reply := types.Message{Message: slack.Message{Msg: slack.Msg{Timestamp: "1704099700.000100", ThreadTimestamp: "1704099600.000100", User: "U2", SubType: slack.MsgSubTypeThreadBroadcast}}}
+	parent := types.Message{Message: slack.Message{Msg: slack.Msg{Timestamp: "1704099600.000100", ThreadTimestamp: "1704099600.000100", User: "U1"}}, ThreadReplies: []types.Message{reply}}
+	// The channel lists the broadcast after its parent, as Slack does.
+	conv := &types.Conversation{ID: "C1", Messages: []types.Message{parent, reply}}
+
+	r := analyze(conv, time.UTC, 10)
+	if r.RawMessages != 3 || r.BroadcastCopies != 1 || r.Messages != r.RawMessages-r.BroadcastCopies {
+		t.Errorf("%d raw, %d copies, %d messages; want 3, 1 and 2", r.RawMessages, r.BroadcastCopies, r.Messages)
+	}
+	if r.Replies != 1 || r.Threads.MeanReplies != 1 {
+		t.Errorf("%d replies, %.1f per thread; want the broadcast counted once", r.Replies, r.Threads.MeanReplies)
+	}
+	if want := []userActivity{{"U1", 1, 0, 1}, {"U2", 1, 1, 1}}; !slices.Equal(r.TopUsers, want) {
+		t.Errorf("top users = %+v, want %+v", r.TopUsers, want)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/rusq/slackdump/v3/auth"
+	"github.com/wham/gh-slackdump/internal/users"
+)
+
+var (
+	anonymize     bool
+	anonymizeMap  string
+	anonymizeKeep []string
+)
+
+// pseudonyms gives the users of the run their --anonymize pseudonyms. There
+// is one for the run, so every conversation written with it agrees.
+var pseudonyms *users.Pseudonyms
+
+// checkAnonymizeFlags checks --anonymize, --anonymize-map and
+// --anonymize-keep against the rest of the flags, after checkEncryptFlags,
+// as the map is encrypted too.
+func checkAnonymizeFlags() error {
+	if !anonymize {
+		switch {
+		case anonymizeMap != "":
+			return errors.New("--anonymize-map requires --anonymize")
+		case len(anonymizeKeep) > 0:
+			return errors.New("--anonymize-keep requires --anonymize")
+		}
+		return nil
+	}
+	for _, id := range anonymizeKeep {
+		if !users.IsUserID(id) {
+			return fmt.Errorf("--anonymize-keep %q is not a user ID, such as U09036M8VEU", id)
+		}
+	}
+	switch {
+	case sinceLast:
+		return errors.New("--anonymize can't be combined with --since-last-message: the replies already in the -o file were numbered by another run")
+	case outputFormat == "export" || outputFormat == "mattermost" || outputFormat == "zulip":
+		return fmt.Errorf("--anonymize doesn't work with --format %s, which carries the workspace's users", outputFormat)
+	}
+	if path := anonymizeMapPath(); path != "" && !overwrite {
+		if fi, err := os.Stat(path); err == nil && fi.Size() > 0 {
+			return fmt.Errorf("--anonymize-map %s already exists; pass --overwrite to replace it", path)
+		}
+	}
+	return nil
+}
+
+// anonymizeMapPath returns the name the --anonymize-map is written under,
+// "" for none.
+func anonymizeMapPath() string {
+	if !anonymize {
+		return ""
+	}
+	return encryptedPath(anonymizeMap)
+}
+
+// userResolver returns what replaces user IDs in the output: pseudonyms
+// with --anonymize, handles with -u or -f, and nil with neither.
+func userResolver(ctx context.Context, prov auth.Provider, workspaceURL string) (users.Resolver, error) {
+	handles, err := loadHandles(ctx, prov, workspaceURL)
+	if err != nil {
+		return nil, err
+	}
+	if anonymize {
+		if pseudonyms == nil {
+			pseudonyms = users.NewPseudonyms(handles, anonymizeKeep...)
+		}
+		return pseudonyms, nil
+	}
+	if handles == nil {
+		return nil, nil
+	}
+	return handles, nil
+}
+
+// writeAnonymizeMap writes the --anonymize-map: the user ID, and the
+// handle with -u, of each pseudonym, keyed by the pseudonym.
+func writeAnonymizeMap() error {
+	p := pseudonyms
+	if p == nil {
+		p = users.NewPseudonyms(nil, anonymizeKeep...)
+	}
+	m := p.Mapping()
+	err := writeFileAtomic(anonymizeMap, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	})
+	if err != nil {
+		return fmt.Errorf("--anonymize-map: %w", err)
+	}
+	slog.Info("pseudonym map written", "file", anonymizeMapPath(), "users", len(m))
+	return nil
+}
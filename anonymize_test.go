@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/users"
+)
+
+func TestCheckAnonymizeFlags(t *testing.T) {
+	oldAnonymize, oldMap, oldKeep, oldFormat, oldSince := anonymize, anonymizeMap, anonymizeKeep, outputFormat, sinceLast
+	defer func() {
+		anonymize, anonymizeMap, anonymizeKeep, outputFormat, sinceLast = oldAnonymize, oldMap, oldKeep, oldFormat, oldSince
+	}()
+	existing := filepath.Join(t.TempDir(), "pseudonyms.json")
+	if err := os.WriteFile(existing, []byte("{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		anonymize bool
+		mapFile   string
+		keep      []string
+		format    string
+		sinceLast bool
+		wantErr   string
+	}{
+		{format: "json"},
+		{anonymize: true, format: "html"},
+		{anonymize: true, mapFile: filepath.Join(t.TempDir(), "map.json"), format: "ndjson"},
+		{mapFile: "map.json", format: "json", wantErr: "requires --anonymize"},
+		{anonymize: true, format: "export", wantErr: "--format export"},
+		{anonymize: true, format: "mattermost", wantErr: "--format mattermost"},
+		{anonymize: true, format: "json", sinceLast: true, wantErr: "--since-last-message"},
+		{anonymize: true, mapFile: existing, format: "json", wantErr: "already exists"},
+		{anonymize: true, keep: []string{"U0ALERTS", "W012ABC"}, format: "json"},
+		{keep: []string{"U0ALERTS"}, format: "json", wantErr: "requires --anonymize"},
+		{anonymize: true, keep: []string{"alertbot"}, format: "json", wantErr: "not a user ID"},
+	}
+	for _, tt := range tests {
+		anonymize, anonymizeMap, anonymizeKeep, outputFormat, sinceLast = tt.anonymize, tt.mapFile, tt.keep, tt.format, tt.sinceLast
+		err := checkAnonymizeFlags()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%+v: checkAnonymizeFlags() = %v, want error %q", tt, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAnonymizedNDJSONMatchesBatch(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "conversation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := func() *types.Conversation {
+		var conv types.Conversation
+		if err := json.Unmarshal(data, &conv); err != nil {
+			t.Fatal(err)
+		}
+		return &conv
+	}
+
+	batch := load()
+	users.ResolveConversation(batch, users.NewPseudonyms(nil))
+	var want bytes.Buffer
+	bw := newNDJSONWriter(&want, threadsInline, encodeOptions{})
+	if _, err := bw.write(batch.Messages); err != nil {
+		t.Fatal(err)
+	}
+	bw.w.Flush()
+
+	var got bytes.Buffer
+	nw := newNDJSONWriter(&got, threadsInline, encodeOptions{})
+	nw.handles = users.NewPseudonyms(nil)
+	if _, err := nw.processFunc()(load().Messages, "C1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.String() != want.String() {
+		t.Errorf("streaming pseudonyms =\n%s\nbatch pseudonyms =\n%s", got.String(), want.String())
+	}
+	for _, id := range []string{"U09036M8VEU", "U0903ABCDEF"} {
+		if strings.Contains(got.String(), id) {
+			t.Errorf("user ID %s was left in the output:\n%s", id, got.String())
+		}
+	}
+	if !strings.Contains(got.String(), `"user":"user-1"`) {
+		t.Errorf("no message by user-1:\n%s", got.String())
+	}
+}
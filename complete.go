@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/errs"
+)
+
+// errIncomplete is returned when --require-complete finds the written dump
+// incomplete; being an errs.ErrPartial, main exits with exitIncomplete.
+var errIncomplete = errs.New(errs.ErrPartial, "the dump is incomplete")
+
+// completeness is what --require-complete found.
+type completeness struct {
+	// problems describes each failed check.
+	problems []string
+	// checked and unchecked count the threads whose replies were and
+	// couldn't be compared with Slack's reply_count.
+	checked, unchecked int
+}
+
+// checkComplete checks the dump of conv: every thread has as many replies
+// as Slack's reply_count, and no warning or error was logged. oldest and
+// latest are the --from and --to bounds; threads reaching past them can't
+// be checked, as their replies outside the range weren't fetched.
+func checkComplete(conv *types.Conversation, oldest, latest time.Time, warnings int64) completeness {
+	var c completeness
+	check := func(parent *types.Message, fetched int) {
+		if parent.ReplyCount == 0 {
+			return
+		}
+		if !threadInRange(parent, oldest, latest) {
+			c.unchecked++
+			return
+		}
+		c.checked++
+		if fetched < parent.ReplyCount {
+			c.problems = append(c.problems, fmt.Sprintf("thread %s: %d of %d replies fetched", parent.Timestamp, fetched, parent.ReplyCount))
+		}
+	}
+	if conv.ThreadTS != "" {
+		// A thread link's dump lists the parent and its replies together.
+		for i := range conv.Messages {
+			if conv.Messages[i].Timestamp == conv.ThreadTS {
+				check(&conv.Messages[i], len(conv.Messages)-1)
+			}
+		}
+	} else {
+		for i := range conv.Messages {
+			if m := &conv.Messages[i]; m.ThreadTimestamp == m.Timestamp {
+				check(m, len(m.ThreadReplies))
+			}
+		}
+	}
+	if warnings > 0 {
+		c.problems = append(c.problems, fmt.Sprintf("%d warnings or errors were logged", warnings))
+	}
+	return c
+}
+
+// threadInRange reports whether all of parent's replies fall between
+// oldest and latest (zero for unbounded).
+func threadInRange(parent *types.Message, oldest, latest time.Time) bool {
+	if !oldest.IsZero() {
+		ts, err := parseSlackTS(parent.Timestamp)
+		if err != nil || ts.Before(oldest) {
+			return false
+		}
+	}
+	if !latest.IsZero() {
+		last, err := parseSlackTS(parent.LatestReply)
+		if err != nil || last.After(latest) {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyComplete applies --require-complete to the dump just written: it
+// writes a report of the failed checks to w and returns errIncomplete.
+func verifyComplete(w io.Writer, conv *types.Conversation, oldest, latest time.Time) error {
+	c := checkComplete(conv, oldest, latest, loggedWarnings.Load())
+	if len(c.problems) == 0 {
+		slog.Info("dump verified complete", "threads", c.checked, "unchecked", c.unchecked)
+		return nil
+	}
+	fmt.Fprintln(w, "--require-complete: the output was written, but is incomplete:")
+	for _, p := range c.problems {
+		fmt.Fprintln(w, "  -", p)
+	}
+	if c.unchecked > 0 {
+		fmt.Fprintf(w, "  (%d threads reaching past --from or --to were not checked)\n", c.unchecked)
+	}
+	return fmt.Errorf("%w: %d problems found", errIncomplete, len(c.problems))
+}
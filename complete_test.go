@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// parent returns a thread parent with replies, claiming count replies
+// ending at latest.
+func parent(ts string, count int, latest string, replies ...types.Message) types.Message {
+	m := msg(ts, replies...)
+	m.ThreadTimestamp, m.ReplyCount, m.LatestReply = ts, count, latest
+	return m
+}
+
+func TestCheckComplete(t *testing.T) {
+	conv := &types.Conversation{ID: "C1", Messages: []types.Message{
+		parent("1700000000.000100", 2, "1700000020.000100", msg("1700000010.000100"), msg("1700000020.000100")),
+		parent("1700000100.000100", 3, "1700000130.000100", msg("1700000110.000100")),
+		msg("1700000200.000100"),
+	}}
+
+	c := checkComplete(conv, time.Time{}, time.Time{}, 0)
+	if c.checked != 2 || len(c.problems) != 1 || c.problems[0] != "thread 1700000100.000100: 1 of 3 replies fetched" {
+		t.Errorf("checkComplete() = %+v, want the second thread short of 2 replies", c)
+	}
+
+	// With --to before its last reply, the short thread can't be judged.
+	c = checkComplete(conv, time.Time{}, time.Unix(1700000120, 0), 1)
+	if c.checked != 1 || c.unchecked != 1 || len(c.problems) != 1 || !strings.Contains(c.problems[0], "1 warnings") {
+		t.Errorf("checkComplete() with --to = %+v, want one thread unchecked and only the warning reported", c)
+	}
+}
+
+func TestCheckCompleteThreadLink(t *testing.T) {
+	conv := &types.Conversation{ID: "C1", ThreadTS: "1700000000.000100", Messages: []types.Message{
+		parent("1700000000.000100", 2, "1700000020.000100"),
+		msg("1700000010.000100"),
+	}}
+	if c := checkComplete(conv, time.Time{}, time.Time{}, 0); len(c.problems) != 1 {
+		t.Errorf("checkComplete() = %+v, want the thread reported 1 of 2 replies short", c)
+	}
+	conv.Messages = append(conv.Messages, msg("1700000020.000100"))
+	if c := checkComplete(conv, time.Time{}, time.Time{}, 0); c.checked != 1 || len(c.problems) != 0 {
+		t.Errorf("checkComplete() = %+v, want a complete thread", c)
+	}
+}
+
+func TestVerifyComplete(t *testing.T) {
+	conv := &types.Conversation{ID: "C1", Messages: []types.Message{parent("1700000000.000100", 1, "1700000010.000100")}}
+	var report bytes.Buffer
+	err := verifyComplete(&report, conv, time.Time{}, time.Time{})
+	if !errors.Is(err, errIncomplete) {
+		t.Fatalf("verifyComplete() error = %v, want errIncomplete", err)
+	}
+	if !strings.Contains(report.String(), "  - thread 1700000000.000100: 0 of 1 replies fetched") {
+		t.Errorf("report lacks the short thread:\n%s", report.String())
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Output compressions, chosen with --compress or by the -o file's
+// extension.
+const (
+	compressGzip = "gzip"
+	compressZstd = "zstd"
+)
+
+// compressionExts maps the file extensions that select a compression to it.
+var compressionExts = map[string]string{
+	".gz":  compressGzip,
+	".zst": compressZstd,
+}
+
+// outputCompression is the compression of the output, "" for none; run sets
+// it from --compress and -o.
+var outputCompression string
+
+// compressionOf returns the compression path's extension selects, or "".
+func compressionOf(path string) string {
+	for ext, c := range compressionExts {
+		if strings.HasSuffix(path, ext) {
+			return c
+		}
+	}
+	return ""
+}
+
+// compressionExt returns the file extension of compression, "" for none.
+func compressionExt(compression string) string {
+	for ext, c := range compressionExts {
+		if c == compression {
+			return ext
+		}
+	}
+	return ""
+}
+
+// trimCompressionExt returns path without the extension that selects its
+// compression, if any: general.json.gz → general.json.
+func trimCompressionExt(path string) (base, ext string) {
+	for e := range compressionExts {
+		if strings.HasSuffix(path, e) {
+			return strings.TrimSuffix(path, e), e
+		}
+	}
+	return path, ""
+}
+
+// parseCompression returns the output compression for --compress and the
+// -o path: the flag's, or else the one path's extension selects.
+func parseCompression(flag, path string) (string, error) {
+	byExt := compressionOf(path)
+	switch flag {
+	case "":
+		return byExt, nil
+	case compressGzip, compressZstd:
+	default:
+		return "", fmt.Errorf("--compress: unknown compression %q: use gzip or zstd", flag)
+	}
+	if byExt != "" && byExt != flag {
+		return "", fmt.Errorf("--compress %s contradicts -o %s, which names a %s file", flag, path, byExt)
+	}
+	return flag, nil
+}
+
+// outputSize counts the bytes of an output before and after compression.
+type outputSize struct {
+	bytes, compressed int64
+	compression       string
+}
+
+// LogValue logs the size, and the compressed size if the output was
+// compressed.
+func (s outputSize) LogValue() slog.Value {
+	if s.compression == "" {
+		return slog.Int64Value(s.bytes)
+	}
+	return slog.GroupValue(
+		slog.Int64("bytes", s.bytes),
+		slog.Int64("compressed_bytes", s.compressed),
+		slog.String("compression", s.compression),
+	)
+}
+
+// add returns the sizes of s and t together.
+func (s outputSize) add(t outputSize) outputSize {
+	return outputSize{bytes: s.bytes + t.bytes, compressed: s.compressed + t.compressed, compression: s.compression}
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// compressor compresses what is written to it into another writer, as a
+// compression asks ("" for not at all), counting the bytes before and
+// after. Close flushes it; it doesn't close the writer underneath.
+type compressor struct {
+	in, out     *countingWriter
+	enc         io.WriteCloser
+	compression string
+}
+
+func newCompressor(w io.Writer, compression string) (*compressor, error) {
+	c := &compressor{out: &countingWriter{w: w}, compression: compression}
+	switch compression {
+	case "":
+		c.in = c.out
+		return c, nil
+	case compressGzip:
+		c.enc = gzip.NewWriter(c.out)
+	case compressZstd:
+		zw, err := zstd.NewWriter(c.out)
+		if err != nil {
+			return nil, err
+		}
+		c.enc = zw
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+	c.in = &countingWriter{w: c.enc}
+	return c, nil
+}
+
+func (c *compressor) Write(p []byte) (int, error) { return c.in.Write(p) }
+
+func (c *compressor) Close() error {
+	if c.enc == nil {
+		return nil
+	}
+	return c.enc.Close()
+}
+
+// size returns the bytes written so far, before and after compression.
+func (c *compressor) size() outputSize {
+	return outputSize{bytes: c.in.n, compressed: c.out.n, compression: c.compression}
+}
+
+// writeCompressed writes to w with write, compressed as compression asks
+// ("" for not at all), and returns the bytes written.
+func writeCompressed(w io.Writer, compression string, write func(w io.Writer) error) (outputSize, error) {
+	c, err := newCompressor(w, compression)
+	if err != nil {
+		return outputSize{compression: compression}, err
+	}
+	err = write(c)
+	if closeErr := c.Close(); err == nil {
+		err = closeErr
+	}
+	return c.size(), err
+}
+
+// writeOutputTo writes the output with write to path, atomically, or to
+// stdout when path is empty, compressed as --compress or -o asks and then
+// encrypted as --encrypt-to does.
+func writeOutputTo(path string, write func(w io.Writer) error) (outputSize, error) {
+	if path == "" {
+		enc, err := encryptWriter(os.Stdout)
+		if err != nil {
+			return outputSize{compression: outputCompression}, err
+		}
+		if enc == nil {
+			size, err := writeCompressed(os.Stdout, outputCompression, write)
+			recordWrite("", size.compressed)
+			return size, err
+		}
+		size, err := writeCompressed(enc, outputCompression, write)
+		if closeErr := enc.Close(); err == nil {
+			err = closeErr
+		}
+		recordWrite("", size.compressed)
+		return size, err
+	}
+	var size outputSize
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		var err error
+		size, err = writeCompressed(w, outputCompression, write)
+		return err
+	})
+	return size, err
+}
+
+// openOutputFile opens a file written with -o, decompressing it as its
+// extension says.
+func openOutputFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	switch compressionOf(path) {
+	case compressGzip:
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return readCloser{zr, func() error { zr.Close(); return f.Close() }}, nil
+	case compressZstd:
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return readCloser{zr, func() error { zr.Close(); return f.Close() }}, nil
+	}
+	return f, nil
+}
+
+// readCloser is a reader with a close function of its own.
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error { return r.close() }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestParseCompression(t *testing.T) {
+	tests := []struct {
+		flag, path string
+		want       string
+		wantErr    bool
+	}{
+		{path: "general.json", want: ""},
+		{path: "", want: ""},
+		{path: "general.json.gz", want: compressGzip},
+		{path: "general.ndjson.zst", want: compressZstd},
+		{flag: "gzip", want: compressGzip},
+		{flag: "zstd", path: "general.json", want: compressZstd},
+		{flag: "zstd", path: "general.json.zst", want: compressZstd},
+		{flag: "gzip", path: "general.json.zst", wantErr: true},
+		{flag: "xz", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseCompression(tt.flag, tt.path)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseCompression(%q, %q) = %q, %v; want %q, error %v", tt.flag, tt.path, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCompressedOutputRoundTrip(t *testing.T) {
+	conv := &types.Conversation{ID: "C1", ThreadTS: "1700000000.000100", Messages: []types.Message{msg("1700000000.000100")}}
+	var plain bytes.Buffer
+	if err := encodeConversation(&plain, conv); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"thread.json.gz", "thread.json.zst", "thread.json"} {
+		t.Run(name, func(t *testing.T) {
+			old := outputCompression
+			outputCompression = compressionOf(name)
+			defer func() { outputCompression = old }()
+
+			path := filepath.Join(t.TempDir(), name)
+			size, err := writeOutputTo(path, func(w io.Writer) error {
+				return encodeConversation(w, conv)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size.bytes != int64(plain.Len()) || size.compressed != fi.Size() {
+				t.Errorf("size = %+v, want %d bytes, %d compressed", size, plain.Len(), fi.Size())
+			}
+			if raw, _ := os.ReadFile(path); outputCompression != "" && bytes.Equal(raw, plain.Bytes()) {
+				t.Error("the file wasn't compressed")
+			}
+
+			f, err := openOutputFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			got, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain.Bytes()) {
+				t.Errorf("decompressed output = %q, want %q", got, plain.String())
+			}
+			prev, err := loadPreviousDump(path)
+			if err != nil || prev.ThreadTS != conv.ThreadTS {
+				t.Errorf("loadPreviousDump() = %+v, %v", prev, err)
+			}
+		})
+	}
+}
+
+func TestCompressedSplitMerge(t *testing.T) {
+	old := outputCompression
+	outputCompression = compressZstd
+	defer func() { outputCompression = old }()
+
+	doc := buildOutput(channelWithThreads(7), encodeOptions{})
+	var want bytes.Buffer
+	if err := encodeDocument(&want, doc); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "general.json.zst")
+	if err := writeSplit(path, doc, splitSpec{count: 3}); err != nil {
+		t.Fatal(err)
+	}
+	index, err := os.ReadFile(indexPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), `"general.0003.json.zst"`) {
+		t.Errorf("index = %s, want it to list the compressed files", index)
+	}
+	var got bytes.Buffer
+	if err := mergeSplit(&got, indexPath(path)); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("merged dump differs from the unsplit one")
+	}
+}
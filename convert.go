@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cli/go-gh/v2/pkg/term"
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/spf13/cobra"
+	"github.com/wham/gh-slackdump/internal/format"
+	"github.com/wham/gh-slackdump/internal/users"
+)
+
+var convertUsers string
+
+var convertCmd = &cobra.Command{
+	Use:   "convert <dump.json>",
+	Short: "Write an earlier JSON dump in another --format, without Slack",
+	Long: `Reads a JSON dump written earlier (e.g. general.json, or general.json.gz or
+.zst) and writes it again in any --format, through --template, or as JSON
+with different flags, without signing in to Slack or calling its API. Only
+--format html with --files downloads the avatars, to inline them; without
+it they are linked.
+
+--users-file names a users.json to resolve user IDs with, as -u would: a
+Slack export's users.json or gh-slackdump's user cache
+(<cache dir>/<workspace>/users.json). --format export writes it as the
+export's users.json, --format zulip names users from it, and --format html
+takes avatars from it; --format mattermost requires it.
+
+The channel and dump objects of the dump are kept, and give --format export,
+mattermost and zulip the channel's details and --permalinks the workspace.
+A dump written with --no-metadata has neither, so these fall back to the
+channel's ID and name, and --permalinks can't be used.
+
+Files that aren't a JSON dump, such as --format ndjson output or a
+--split-by index (join its files with gh slackdump merge first), are
+refused.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return convertDump(args[0], cmd.Flags().Changed("compact"))
+	},
+}
+
+func init() {
+	addOutputFlags(convertCmd)
+	convertCmd.Flags().StringVar(&convertUsers, "users-file", "", "Resolve user IDs with this users.json: a Slack export's, or gh-slackdump's user cache")
+	convertCmd.Flags().BoolVar(&downloadFiles, "files", false, "With --format html, download the avatars and inline them instead of linking them")
+	rootCmd.AddCommand(convertCmd)
+}
+
+// dumpFile is a dump as convert reads it: the conversation with the channel
+// and dump objects, which dumps written with --no-metadata lack.
+type dumpFile struct {
+	types.Conversation
+	Channel *outChannel `json:"channel,omitempty"`
+	Dump    *outDump    `json:"dump,omitempty"`
+}
+
+// convertDump writes the dump at path in --format to the -o file or
+// stdout.
+func convertDump(path string, compactSet bool) error {
+	if outputFile == "" && !verbose && !trace {
+		setupLogging(slog.LevelError, false)
+	} else {
+		setupLogging(logLevel(), false)
+	}
+	if downloadFiles && outputFormat != "html" {
+		return errors.New("--files inlines the avatars of --format html; convert downloads no attachments")
+	}
+	if outputFormat == "mattermost" && convertUsers == "" {
+		return errors.New("--format mattermost requires --users-file: Mattermost posts name their authors by username")
+	}
+	// Export and Zulip keep user IDs and take the users file as it is; the
+	// rest resolve IDs with it, as -u does for a dump.
+	resolveUsers = convertUsers != "" && outputFormat != "export" && outputFormat != "zulip"
+	if err := checkEncryptFlags(); err != nil {
+		return err
+	}
+	if err := resolveOutputPath(); err != nil {
+		return err
+	}
+	if err := checkOverwrite(overwriteTarget(), overwrite); err != nil {
+		return err
+	}
+	opts, err := parseOutputOptions()
+	if err != nil {
+		return err
+	}
+	outputOptions = opts
+	if outputCompression, err = parseCompression(compressFlag, outputFile); err != nil {
+		return err
+	}
+	outputOptions.compact = compactOutput(compactSet, term.FromEnv().IsTerminalOutput())
+	tmpl, comma, err := checkFormatFlags(splitSpec{})
+	if err != nil {
+		return err
+	}
+
+	dump, err := readDump(path)
+	if err != nil {
+		return err
+	}
+	if !noMetadata {
+		outputOptions.channel, outputOptions.dump = dump.Channel, dump.Dump
+	}
+	if permalinks {
+		if dump.Dump == nil || dump.Dump.Workspace == "" {
+			return fmt.Errorf("--permalinks: %s doesn't name its workspace; it was written with --no-metadata", path)
+		}
+		outputOptions.permalinks, outputOptions.permalinkChannel = dump.Dump.Workspace, dump.ID
+	}
+	var userList []convertUser
+	if convertUsers != "" {
+		if userList, err = readUsersFile(convertUsers); err != nil {
+			return fmt.Errorf("--users-file: %w", err)
+		}
+	}
+	names := make(users.HandleMap, len(userList))
+	for _, u := range userList {
+		names[u.ID] = u.Name
+	}
+	conv := &dump.Conversation
+	outputOptions.grepMatches = grepConversation(conv)
+	if resolveUsers {
+		users.ResolveConversation(conv, names)
+	}
+
+	info := dump.channelInfo()
+	switch {
+	case tmpl != nil:
+		return writeTemplate(outputFile, buildOutput(conv, outputOptions), tmpl)
+	case outputFormat == "html":
+		doc, avatars := buildOutput(conv, outputOptions), userAvatars(userList)
+		var images map[string]string
+		if downloadFiles {
+			images = inlineAvatars(context.Background(), avatarClient, doc, avatars)
+		}
+		return writeHTML(outputFile, doc, htmlPageSize, avatars, images)
+	case outputFormat == "csv":
+		var workspaceURL string
+		if dump.Dump != nil {
+			workspaceURL = dump.Dump.Workspace
+		}
+		return writeCSV(outputFile, buildOutput(conv, outputOptions), workspaceURL, comma)
+	case outputFormat == "text":
+		return writeText(outputFile, buildOutput(conv, outputOptions), format.TextOptions{RawTS: showRawTS})
+	case outputFormat == "ndjson":
+		return writeNDJSON(outputFile, conv)
+	case outputFormat == "export":
+		if convertUsers == "" {
+			slog.Warn("the export's users.json is empty without --users-file")
+		}
+		slackUsers := make([]slack.User, len(userList))
+		for i, u := range userList {
+			slackUsers[i] = u.slackUser()
+		}
+		return writeExport(outputFile, info, slackUsers, conv)
+	case outputFormat == "mattermost":
+		return writeMattermost(outputFile, info, buildOutput(conv, outputOptions), mattermostTeam)
+	case outputFormat == "zulip":
+		var realm string
+		if dump.Dump != nil {
+			realm = dump.Dump.Workspace
+		}
+		loadNames := func() (map[string]string, error) { return names, nil }
+		return writeZulip(outputFile, info, realm, loadNames, buildOutput(conv, outputOptions))
+	case outputFormat == "gh-markdown":
+		var source string
+		if dump.Dump != nil {
+			source = conversationLink(dump.Dump.Workspace, dump.ID, dump.ThreadTS)
+		}
+		return writeGitHubMarkdown(outputFile, source, buildOutput(conv, outputOptions))
+	}
+	return writeOutput(conv)
+}
+
+// readDump reads the JSON dump at path, compressed if its name says so. It
+// refuses what isn't one, naming what it looks like instead where it can.
+func readDump(path string) (*dumpFile, error) {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		return nil, fmt.Errorf("%s is a directory; convert reads a JSON dump file", path)
+	}
+	f, err := openOutputFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := checkDump(data); err != nil {
+		return nil, fmt.Errorf("%s isn't a gh-slackdump JSON dump: %w", path, err)
+	}
+	var dump dumpFile
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return nil, fmt.Errorf("%s isn't a gh-slackdump JSON dump: %w", path, err)
+	}
+	return &dump, nil
+}
+
+// checkDump reports why data isn't a JSON dump: the document a dump writes,
+// one object with channel_id and messages.
+func checkDump(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return errors.New("it is empty")
+	}
+	if data[0] != '{' {
+		return errors.New("it doesn't hold a JSON object")
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var doc map[string]json.RawMessage
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("it holds several JSON objects, like --format ndjson output, which convert doesn't read")
+	}
+	if _, ok := doc["split_by"]; ok {
+		return errors.New("it is a --split-by index; join its files with gh slackdump merge first")
+	}
+	_, hasID := doc["channel_id"]
+	if _, ok := doc["messages"]; !ok || !hasID {
+		return errors.New("it has no channel_id and messages")
+	}
+	return nil
+}
+
+// channelInfo returns the channel as conversations.info described it when
+// the dump was made, or, without the channel object, only its ID and name.
+// A direct message shows in its ID only.
+func (d *dumpFile) channelInfo() *slack.Channel {
+	ch := &slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: d.ID}, Name: d.Name}}
+	ch.IsIM = strings.HasPrefix(d.ID, "D")
+	if c := d.Channel; c != nil {
+		ch.Name = cmp.Or(c.Name, d.Name)
+		ch.IsMpIM = strings.HasPrefix(ch.Name, "mpdm-")
+		ch.Topic.Value = c.Topic
+		ch.Purpose.Value = c.Purpose
+		ch.IsPrivate = c.IsPrivate
+		ch.IsReadOnly = c.IsReadOnly
+		ch.NumMembers = c.NumMembers
+		ch.ContextTeamID = c.Team
+	}
+	return ch
+}
+
+// convertUser is a user of a --users-file: an entry of a Slack export's
+// users.json or of gh-slackdump's user cache, which has the avatar at the
+// top level.
+type convertUser struct {
+	slack.User
+	Avatar string `json:"avatar,omitempty"`
+}
+
+// readUsersFile reads the users of a --users-file.
+func readUsersFile(path string) ([]convertUser, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []convertUser
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s isn't a list of users: %w", path, err)
+	}
+	for _, u := range list {
+		if u.ID == "" {
+			return nil, fmt.Errorf("%s isn't a list of users: an entry has no id", path)
+		}
+	}
+	return list, nil
+}
+
+// slackUser returns u as Slack's users.json lists it.
+func (u convertUser) slackUser() slack.User {
+	su := u.User
+	su.Profile.Image72 = cmp.Or(su.Profile.Image72, u.Avatar)
+	return su
+}
+
+// avatarClient downloads the avatars inlined into --format html pages by
+// convert, which has no Slack session.
+var avatarClient = &http.Client{Timeout: 30 * time.Second}
+
+// userAvatars returns the avatar URLs of users keyed by both user ID and
+// name, as users.Avatars does, or nil when there are none.
+func userAvatars(list []convertUser) map[string]string {
+	var m map[string]string
+	for _, u := range list {
+		if avatar := cmp.Or(u.Avatar, u.Profile.Image72); avatar != "" {
+			if m == nil {
+				m = make(map[string]string)
+			}
+			m[u.ID], m[u.Name] = avatar, avatar
+		}
+	}
+	return m
+}
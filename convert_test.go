@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCheckDump(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"dump", `{"channel_id":"C1","name":"general","messages":[]}`, ""},
+		{"empty", " \n", "empty"},
+		{"array", `[{"channel_id":"C1"}]`, "doesn't hold a JSON object"},
+		{"ndjson", "{\"ts\":\"1.0\"}\n{\"ts\":\"2.0\"}\n", "--format ndjson"},
+		{"split index", `{"split_by":"day","files":[]}`, "gh slackdump merge"},
+		{"other JSON", `{"ok":true}`, "no channel_id and messages"},
+		{"broken", `{"channel_id":`, "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDump([]byte(tt.data))
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("checkDump = %v, want nil", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("checkDump = %v, want an error with %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertDump(t *testing.T) {
+	dir := t.TempDir()
+	dump := filepath.Join(dir, "general.json.gz")
+	usersFile := filepath.Join(dir, "users.json")
+	out := filepath.Join(dir, "general.csv")
+	conv := `{"channel_id":"C1","name":"general","messages":[
+		{"type":"message","user":"U1","text":"hi <@U2>","ts":"1704099600.000100"}]}`
+	if err := writeFileAtomic(dump, func(w io.Writer) error {
+		_, err := writeCompressed(w, compressGzip, func(w io.Writer) error {
+			_, err := io.WriteString(w, conv)
+			return err
+		})
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(usersFile, []byte(`[{"id":"U1","name":"alice"},{"id":"U2","name":"bob","avatar":"https://a/b.png"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		outputFile, outputFormat, convertUsers, resolveUsers = "", "json", "", false
+	})
+	outputFile, outputFormat, convertUsers = out, "csv", usersFile
+
+	if err := convertDump(dump, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "general,,alice,hi @bob") {
+		t.Errorf("CSV doesn't have the message with handles resolved:\n%s", data)
+	}
+}
+
+func TestConvertDumpHTMLAvatars(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("PNG"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	dump := filepath.Join(dir, "general.json")
+	usersFile := filepath.Join(dir, "users.json")
+	out := filepath.Join(dir, "general.html")
+	if err := os.WriteFile(dump, []byte(`{"channel_id":"C1","name":"general","messages":[
+		{"type":"message","user":"U1","text":"hi","ts":"1704099600.000100"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(usersFile, []byte(`[{"id":"U1","name":"alice","avatar":"`+srv.URL+`/a.png"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		outputFile, outputFormat, convertUsers, resolveUsers, downloadFiles, overwrite = "", "json", "", false, false, false
+	})
+	outputFile, outputFormat, convertUsers, overwrite = out, "html", usersFile, true
+
+	// Without --files the avatar is linked, and nothing is downloaded.
+	if err := convertDump(dump, false); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(out)
+	if n := requests.Load(); n != 0 || !strings.Contains(string(data), `src="`+srv.URL+`/a.png"`) {
+		t.Errorf("without --files: %d avatar requests, want the avatar linked and none", n)
+	}
+
+	downloadFiles = true
+	if err := convertDump(dump, false); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(out)
+	if n := requests.Load(); n != 1 || !strings.Contains(string(data), "data:image/png;base64,UE5H") {
+		t.Errorf("with --files: %d avatar requests, want the avatar downloaded once and inlined", n)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"unicode/utf8"
+
+	"github.com/wham/gh-slackdump/internal/format"
+)
+
+// parseCSVDelimiter parses --csv-delimiter: a single character, or "tab"
+// (or a literal \t) for TSV.
+func parseCSVDelimiter(v string) (rune, error) {
+	if v == "tab" || v == `\t` {
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(v)
+	if size == 0 || size != len(v) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+		return 0, fmt.Errorf("want a single character other than a quote or newline, or tab; got %q", v)
+	}
+	return r, nil
+}
+
+// CSV row modes of --csv-rows.
+const (
+	csvRowsMessages  = "messages"
+	csvRowsReactions = "reactions"
+)
+
+// writeCSV writes doc as --format csv to path, or to stdout: a row per
+// message, with thread permalinks on the workspace at workspaceURL, or
+// with --csv-rows reactions a row per reacting user.
+func writeCSV(path string, doc *outConversation, workspaceURL string, comma rune) error {
+	conv := doc.Conversation
+	conv.Messages = plainMessages(doc.Messages)
+	size, err := writeOutputTo(path, func(w io.Writer) error {
+		if csvRows == csvRowsReactions {
+			return format.WriteReactionsCSV(w, conv, comma)
+		}
+		return format.WriteCSV(w, conv, workspaceURL, comma)
+	})
+	if err != nil || path == "" {
+		return err
+	}
+	slog.Info("output written", "file", path, "size", size)
+	return nil
+}
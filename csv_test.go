@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/users"
+)
+
+func TestParseCSVDelimiter(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    rune
+		wantErr bool
+	}{
+		{in: ",", want: ','},
+		{in: ";", want: ';'},
+		{in: "tab", want: '\t'},
+		{in: `\t`, want: '\t'},
+		{in: "|", want: '|'},
+		{in: "", wantErr: true},
+		{in: ",,", wantErr: true},
+		{in: `"`, wantErr: true},
+		{in: "\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseCSVDelimiter(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseCSVDelimiter(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWriteCSVReactionRows(t *testing.T) {
+	oldRows := csvRows
+	defer func() { csvRows = oldRows }()
+	csvRows = csvRowsReactions
+
+	data, err := os.ReadFile(filepath.Join("testdata", "conversation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conv types.Conversation
+	if err := json.Unmarshal(data, &conv); err != nil {
+		t.Fatal(err)
+	}
+	// The fixture lists U0903ABCDEF before U09036M8VEU; resolving them to
+	// handles that sort the other way must keep that order.
+	users.ResolveConversation(&conv, users.HandleMap{"U0903ABCDEF": "zed", "U09036M8VEU": "alice"})
+
+	path := filepath.Join(t.TempDir(), "reactions.csv")
+	if err := writeCSV(path, buildOutput(&conv, encodeOptions{}), "", ','); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]string
+	for _, r := range rows[1:] {
+		got = append(got, []string{r[5], r[6], r[7]})
+	}
+	want := [][]string{{"eyes", "zed", "1"}, {"eyes", "alice", "2"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reaction, user, position = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rusq/slackdump/v3"
+	"github.com/rusq/slackdump/v3/auth"
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/spf13/cobra"
+	"github.com/wham/gh-slackdump/internal/errs"
+	"github.com/wham/gh-slackdump/internal/format"
+)
+
+// digestEntry is a thread listed in a --threads-file.
+type digestEntry struct {
+	url  string
+	link archiveLink
+}
+
+// readThreadsFile reads the permalinks of a --threads-file, one per line;
+// blank lines and lines starting with # are skipped. Every link must be a
+// thread link on the same workspace host. Links to the same thread, such
+// as two replies of it, are listed once, at the first, with a warning naming
+// both.
+func readThreadsFile(path string) ([]digestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		entries []digestEntry
+		host    string
+		// seen maps the threads listed to the lines listing them first.
+		seen = make(map[string]string)
+	)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		link, err := parseArchiveLink(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if link.thread() == "" {
+			return nil, fmt.Errorf("%s:%d: %s is a conversation link; list thread links", path, n, line)
+		}
+		u, _ := url.Parse(line)
+		if host == "" {
+			host = u.Host
+		} else if u.Host != host {
+			return nil, fmt.Errorf("%s:%d: %s is on %s, not %s; a digest covers one workspace", path, n, line, u.Host, host)
+		}
+		if first, ok := seen[link.target()]; ok {
+			slog.Warn("thread listed twice, dumping it once", "link", line, "line", n, "first", first)
+			continue
+		}
+		seen[link.target()] = line
+		entries = append(entries, digestEntry{url: line, link: link})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s lists no thread links", path)
+	}
+	return entries, nil
+}
+
+// checkDigestFlags rejects the flags that don't apply to --threads-file,
+// which writes its own Markdown document.
+func checkDigestFlags(cmd *cobra.Command) error {
+	for _, name := range []string{"format", "template", "template-string", "split-by", "since-last-message", "estimate", "require-complete", "fields", "top", "score", "stats-json", "emoji-dir", "grep", "grep-logic", "last"} {
+		if cmd.Flags().Changed(name) {
+			return fmt.Errorf("--threads-file writes a Markdown digest, so it can't be combined with --%s", name)
+		}
+	}
+	if sortBy != "ts" {
+		return errors.New("--threads-file can only be sorted by ts")
+	}
+	return nil
+}
+
+// writeDigest dumps each thread of entries and writes them as a Markdown
+// digest to the -o file, or to stdout: in the file's order, or by the
+// parents' time when byTime is set. A thread that can't be dumped is noted
+// in the digest and logged as a warning rather than failing the run.
+func writeDigest(ctx context.Context, sd *slackdump.Session, prov auth.Provider, workspaceURL string, entries []digestEntry, byTime bool) error {
+	threads := make([]format.DigestThread, len(entries))
+	var convs []*types.Conversation
+	for i, e := range entries {
+		threads[i].Link = e.url
+		conv, err := sd.Dump(ctx, e.link.target(), time.Time{}, time.Time{}, progressReporter.ProcessFunc())
+		if err == nil && len(conv.Messages) == 0 {
+			err = errs.New(errs.ErrNotFound, "the thread has no messages")
+		}
+		if err != nil {
+			err = errs.Classify(err)
+			if errors.Is(err, errs.ErrCancelled) {
+				return err
+			}
+			slog.Warn("can't dump thread, noting it in the digest", "link", e.url, "error", err)
+			threads[i].Err = err
+			continue
+		}
+		normalizeConversation(conv)
+		countMessages(conv.Messages)
+		threads[i].Conversation = conv
+		convs = append(convs, conv)
+	}
+	if err := resolveConversationUsers(ctx, prov, workspaceURL, convs...); err != nil {
+		return err
+	}
+	if byTime {
+		slices.SortStableFunc(threads, func(a, b format.DigestThread) int {
+			return strings.Compare(digestTS(a), digestTS(b))
+		})
+	}
+	size, err := writeOutputTo(outputFile, func(w io.Writer) error {
+		return format.WriteDigest(w, "Thread digest", outputOptions.permalinks, threads)
+	})
+	if err != nil {
+		return err
+	}
+	if outputFile != "" {
+		slog.Info("output written", "file", encryptedPath(outputFile), "size", size, "threads", len(threads))
+	}
+	return nil
+}
+
+// digestTS returns the ts a thread is sorted by: its parent's, padded so
+// that ts strings compare as numbers. Failed threads sort last.
+func digestTS(t format.DigestThread) string {
+	if t.Conversation == nil || len(t.Conversation.Messages) == 0 {
+		return "~"
+	}
+	sec, frac, _ := strings.Cut(t.Conversation.Messages[0].Timestamp, ".")
+	return fmt.Sprintf("%020s.%s", sec, frac)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/format"
+)
+
+func TestReadThreadsFile(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "threads.txt")
+		os.WriteFile(path, []byte(content), 0o644)
+		return path
+	}
+
+	var logs strings.Builder
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	path := write(t, `# this week
+https://example.slack.com/archives/C1/p1700000000000100
+
+https://example.slack.com/archives/C2/p1700000200000100
+https://example.slack.com/archives/C1/p1700000050000100?thread_ts=1700000000.000100&cid=C1
+`)
+	entries, err := readThreadsFile(path)
+	if err != nil {
+		t.Fatalf("readThreadsFile() error: %v", err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.link.target())
+	}
+	// The reply's thread is already listed, so it is dropped.
+	if want := []string{"C1:1700000000.000100", "C2:1700000200.000100"}; !slices.Equal(got, want) {
+		t.Errorf("threads = %v, want %v", got, want)
+	}
+	for _, want := range []string{"thread listed twice", "https://example.slack.com/archives/C1/p1700000000000100", "thread_ts=1700000000.000100"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log lacks %q:\n%s", want, logs.String())
+		}
+	}
+
+	for name, content := range map[string]string{
+		"conversation link": "https://example.slack.com/archives/C1\n",
+		"other workspace":   "https://example.slack.com/archives/C1/p1700000000000100\nhttps://other.slack.com/archives/C1/p1700000000000100\n",
+		"not a link":        "see thread\n",
+		"empty":             "# nothing yet\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := readThreadsFile(write(t, content)); err == nil {
+				t.Error("readThreadsFile() succeeded")
+			}
+		})
+	}
+}
+
+func TestDigestTS(t *testing.T) {
+	thread := func(ts string) format.DigestThread {
+		return format.DigestThread{Conversation: &types.Conversation{Messages: []types.Message{
+			{Message: slack.Message{Msg: slack.Msg{Timestamp: ts}}},
+		}}}
+	}
+	threads := []format.DigestThread{{Link: "failed"}, thread("1700000000.000100"), thread("999999999.000100")}
+	slices.SortStableFunc(threads, func(a, b format.DigestThread) int {
+		return strings.Compare(digestTS(a), digestTS(b))
+	})
+	if threads[0].Conversation.Messages[0].Timestamp != "999999999.000100" || threads[2].Link != "failed" {
+		t.Errorf("sorted by time = %+v, want the shorter ts first and the failed thread last", threads)
+	}
+}
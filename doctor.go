@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	sdauth "github.com/wham/gh-slackdump/internal/auth"
+	"github.com/wham/gh-slackdump/internal/users"
+)
+
+var (
+	doctorJSON        bool
+	doctorInteractive bool
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check why gh-slackdump can or can't sign in to Slack",
+	Long: `Checks what signing in to Slack and dumping depend on, printing pass, warn
+or fail and what was found for each:
+
+  - the Slack desktop app's configuration directory and cookie database,
+    with the Slack cookies it holds and when they expire (or the
+    --cookie-file, when given)
+  - the Keychain item whose password encrypts those cookies; it is only
+    looked up, which never prompts, unless --interactive reads it
+  - that slack.com answers over the TLS transport a dump uses, with
+    --tls-hello, --ca-bundle and the other TLS flags applied
+  - that the user cache directory (--cache-dir) is writable
+
+Nothing is sent to a workspace and no cookie value is printed. --json
+prints one JSON object, with the version and platform, to attach to a bug
+report. Exits non-zero when a check fails.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runDoctor(context.Background(), os.Stdout)
+	},
+}
+
+func init() {
+	addSessionFlags(doctorCmd)
+	doctorCmd.Flags().BoolVar(&doctorJSON, "json", false, "Print the checks as one JSON object, for bug reports")
+	doctorCmd.Flags().BoolVar(&doctorInteractive, "interactive", false, "Read the Keychain password, which may show the Keychain's access prompt")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// doctorReport is what gh slackdump doctor --json prints.
+type doctorReport struct {
+	Version      string             `json:"version"`
+	OS           string             `json:"os"`
+	Arch         string             `json:"arch"`
+	Capabilities []string           `json:"capabilities"`
+	Checks       []sdauth.Diagnosis `json:"checks"`
+}
+
+// runDoctor runs the checks and writes them to w.
+func runDoctor(ctx context.Context, w io.Writer) error {
+	if verbose || trace {
+		setupLogging(logLevel(), false)
+	} else {
+		setupLogging(slog.LevelError, false)
+	}
+	users.SetCacheDir(cacheDir)
+	r := doctorReport{Version: version, OS: runtime.GOOS, Arch: runtime.GOARCH, Capabilities: sdauth.Capabilities()}
+	if cookieFile != "" {
+		r.Checks = append(r.Checks, sdauth.DiagnoseCookieFile(cookieFile))
+	} else {
+		r.Checks = append(r.Checks, sdauth.DiagnoseDesktopApp(time.Now())...)
+		r.Checks = append(r.Checks, sdauth.DiagnoseKeychain(doctorInteractive))
+	}
+	r.Checks = append(r.Checks, sdauth.DiagnoseReachability(ctx, transportOptions()))
+	r.Checks = append(r.Checks, diagnoseCacheDir(users.CacheRoot()))
+
+	if doctorJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(w, "gh-slackdump %s on %s/%s (%s)\n", version, runtime.GOOS, runtime.GOARCH, strings.Join(r.Capabilities, ", "))
+		for _, c := range r.Checks {
+			fmt.Fprintln(w, formatDiagnosis(c))
+		}
+	}
+	failed := 0
+	for _, c := range r.Checks {
+		if c.Status == sdauth.DiagnosisFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(r.Checks))
+	}
+	return nil
+}
+
+// formatDiagnosis renders a doctor check as a single line.
+func formatDiagnosis(d sdauth.Diagnosis) string {
+	return fmt.Sprintf("%-4s %s: %s", strings.ToUpper(d.Status), d.Name, d.Detail)
+}
+
+// diagnoseCacheDir checks that the user cache can be written under dir by
+// writing and removing a file there.
+func diagnoseCacheDir(dir string) sdauth.Diagnosis {
+	d := sdauth.Diagnosis{Name: "cache directory", Status: sdauth.DiagnosisFail}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		d.Detail = err.Error()
+		return d
+	}
+	f, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		d.Detail = fmt.Sprintf("%s isn't writable: %v", dir, err)
+		return d
+	}
+	f.Close()
+	os.Remove(f.Name())
+	d.Status, d.Detail = sdauth.DiagnosisPass, dir+" is writable"
+	return d
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rusq/slack"
+	"github.com/spf13/cobra"
+	"github.com/wham/gh-slackdump/internal/emoji"
+	"github.com/wham/gh-slackdump/internal/users"
+)
+
+var emojiCmd = &cobra.Command{
+	Use:   "emoji <workspace-url>",
+	Short: "Download a workspace's custom emoji, for --emoji-dir",
+	Long: `Lists the workspace's custom emoji with emoji.list and downloads the image of
+each into the -o directory, as <name>.<ext>. An alias gets the file of the
+emoji it stands for; aliases of standard emoji are left out. index.json in
+the directory maps every name to its file:
+
+  {"party-wizard": "party-wizard.gif", "wizard": "party-wizard.gif"}
+
+Give the directory to --emoji-dir when dumping or converting to --format
+html or gh-markdown to show custom emoji as images instead of :name:.
+
+An image that can't be downloaded is reported and left out of the index.
+A directory that isn't empty needs --overwrite.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runEmoji(context.Background(), args[0], os.Stderr)
+	},
+}
+
+func init() {
+	addSessionFlags(emojiCmd)
+	emojiCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Directory to download the emoji into (required)")
+	emojiCmd.Flags().BoolVar(&overwrite, "overwrite", false, "Write into an -o directory that isn't empty")
+	emojiCmd.Flags().IntVar(&downloadConcurrency, "download-concurrency", 4, "How many images to download at a time")
+	rootCmd.AddCommand(emojiCmd)
+}
+
+// emojiIndexFile is the file in an emoji directory that maps names to
+// images.
+const emojiIndexFile = "index.json"
+
+// runEmoji downloads the custom emoji of the workspace of slackLink and
+// reports what it did to w.
+func runEmoji(ctx context.Context, slackLink string, w io.Writer) error {
+	if outputFile == "" {
+		return errors.New("-o is required: the directory to download the emoji into")
+	}
+	if downloadConcurrency < 1 {
+		return errors.New("--download-concurrency must be at least 1")
+	}
+	if err := checkOverwrite(outputFile, overwrite); err != nil {
+		return err
+	}
+	if verbose || trace {
+		setupLogging(logLevel(), false)
+	} else {
+		setupLogging(slog.LevelError, false)
+	}
+	users.SetCacheDir(cacheDir)
+
+	sess, err := openSession(ctx, slackLink)
+	if err != nil {
+		return err
+	}
+	defer sess.close()
+	list, err := sess.sd.DumpEmojis(ctx)
+	if err != nil {
+		return fmt.Errorf("can't list custom emoji: %w", err)
+	}
+	client, err := sess.provider.HTTPClient()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outputFile, 0o755); err != nil {
+		return err
+	}
+	// The images are on Slack's CDN, which needs no token.
+	d := fileDownloader{client: client, dir: outputFile}
+	return downloadEmoji(ctx, d, list, w)
+}
+
+// downloadEmoji downloads the images of list, a workspace's emoji.list,
+// with d and writes the index of those it got.
+func downloadEmoji(ctx context.Context, d fileDownloader, list map[string]string, w io.Writer) error {
+	images := emoji.Images(list)
+	// Each image is downloaded once, named after the emoji that isn't an
+	// alias.
+	files := make(map[string]string)
+	for _, name := range slices.Sorted(maps.Keys(list)) {
+		if u := list[name]; !strings.HasPrefix(u, "alias:") {
+			files[u] = emojiFileName(name, u)
+		}
+	}
+
+	urls := make(chan string)
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed = make(map[string]error)
+	)
+	for range min(downloadConcurrency, max(len(files), 1)) {
+		wg.Go(func() {
+			for u := range urls {
+				_, err := withRetries(ctx, files[u], func() (fileState, error) {
+					return d.fetch(ctx, u, slack.File{}, filepath.Join(d.dir, files[u]))
+				})
+				if err != nil {
+					mu.Lock()
+					failed[u] = err
+					mu.Unlock()
+				}
+			}
+		})
+	}
+	for _, u := range slices.Sorted(maps.Keys(files)) {
+		select {
+		case urls <- u:
+		case <-ctx.Done():
+		}
+	}
+	close(urls)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	index := make(map[string]string, len(images))
+	var aliases int
+	for name, u := range images {
+		if failed[u] != nil {
+			continue
+		}
+		index[name] = files[u]
+		if list[name] != u {
+			aliases++
+		}
+	}
+	err := writeFileAtomic(filepath.Join(d.dir, emojiIndexFile), func(w io.Writer) error {
+		return encodeJSON(w, index, "  ")
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, u := range slices.Sorted(maps.Keys(failed)) {
+		fmt.Fprintf(w, "can't download %s: %v\n", files[u], failed[u])
+	}
+	fmt.Fprintf(w, "emoji: %d images, %d aliases of them", len(files)-len(failed), aliases)
+	if len(failed) > 0 {
+		fmt.Fprintf(w, ", %d failed", len(failed))
+	}
+	fmt.Fprintf(w, "; index in %s\n", filepath.Join(d.dir, emojiIndexFile))
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d emoji images couldn't be downloaded", len(failed), len(files))
+	}
+	return nil
+}
+
+// emojiFileName names the image of the custom emoji name at u
+// <name>.<ext>, with the extension of the URL.
+func emojiFileName(name, u string) string {
+	ext := ".png"
+	if parsed, err := url.Parse(u); err == nil {
+		if e := path.Ext(parsed.Path); e != "" && len(e) <= 6 {
+			ext = strings.ToLower(e)
+		}
+	}
+	return unsafeNameRe.ReplaceAllString(name, "_") + ext
+}
+
+// loadCustomEmoji reads the index.json of an emoji directory written by gh
+// slackdump emoji and returns the URL of each emoji's image, relative to
+// the directory base, where the output that shows them goes.
+func loadCustomEmoji(dir, base string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, emojiIndexFile))
+	if err != nil {
+		return nil, fmt.Errorf("--emoji-dir: %w; download the emoji with gh slackdump emoji first", err)
+	}
+	var index map[string]string
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("--emoji-dir: %s: %w", emojiIndexFile, err)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return nil, err
+	}
+	images := make(map[string]string, len(index))
+	for name, file := range index {
+		if !filepath.IsLocal(file) {
+			return nil, fmt.Errorf("--emoji-dir: %s: %q is outside the directory", emojiIndexFile, file)
+		}
+		rel, err := filepath.Rel(absBase, filepath.Join(absDir, file))
+		if err != nil {
+			return nil, fmt.Errorf("--emoji-dir: %w", err)
+		}
+		images[name] = (&url.URL{Path: filepath.ToSlash(rel)}).String()
+	}
+	return images, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadEmoji(t *testing.T) {
+	oldRetry := fileRetryWait
+	defer func() { fileRetryWait = oldRetry }()
+	fileRetryWait = time.Millisecond
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			http.Error(w, "the CDN gets no token", http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/party-wizard/abc.gif":
+			w.Write([]byte("GIF89a"))
+		case "/shipit/def.png":
+			w.Write([]byte("PNG"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	list := map[string]string{
+		"party-wizard": srv.URL + "/party-wizard/abc.gif",
+		"wizard":       "alias:party-wizard",
+		"ship:it":      srv.URL + "/shipit/def.png",
+		"yes":          "alias:thumbsup",
+		"gone":         srv.URL + "/gone/ghi.png",
+	}
+	var out bytes.Buffer
+	err := downloadEmoji(context.Background(), fileDownloader{client: srv.Client(), dir: dir}, list, &out)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3") {
+		t.Errorf("downloadEmoji() = %v, want the missing image reported", err)
+	}
+	if !strings.Contains(out.String(), "emoji: 2 images, 1 aliases of them, 1 failed") {
+		t.Errorf("summary = %q", out.String())
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, emojiIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index map[string]string
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"party-wizard": "party-wizard.gif", "wizard": "party-wizard.gif", "ship:it": "ship_it.png"}
+	if !maps.Equal(index, want) {
+		t.Errorf("index = %v, want %v", index, want)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "party-wizard.gif")); string(got) != "GIF89a" {
+		t.Errorf("party-wizard.gif = %q", got)
+	}
+
+	// The pages of an -o file in another directory link the images
+	// relative to themselves.
+	out2 := filepath.Join(t.TempDir(), "html")
+	images, err := loadCustomEmoji(dir, out2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, _ := filepath.Rel(out2, filepath.Join(dir, "ship_it.png"))
+	if images["ship:it"] != filepath.ToSlash(rel) || !strings.HasSuffix(images["wizard"], "/party-wizard.gif") {
+		t.Errorf("images = %v", images)
+	}
+}
+
+func TestLoadCustomEmojiErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := loadCustomEmoji(dir, "."); err == nil || !strings.Contains(err.Error(), "gh slackdump emoji") {
+		t.Errorf("without an index, loadCustomEmoji() = %v, want a hint to download the emoji", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, emojiIndexFile), []byte(`{"x": "../secret.png"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCustomEmoji(dir, "."); err == nil || !strings.Contains(err.Error(), "outside") {
+		t.Errorf("with a file outside the directory, loadCustomEmoji() = %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/format"
+)
+
+// outConversation is the document written to the output. It is slackdump's
+// conversation with gh-slackdump's optional per-message additions; with no
+// additions enabled and --no-metadata it encodes exactly like
+// types.Conversation, bar the HTML escaping encodeJSON turns off.
+type outConversation struct {
+	types.Conversation
+	// Channel and Dump describe where the messages come from and how they
+	// were dumped, unless --no-metadata is set.
+	Channel *outChannel `json:"channel,omitempty"`
+	Dump    *outDump    `json:"dump,omitempty"`
+	// Stats counts what was dumped, with --stats-json.
+	Stats    *dumpStats   `json:"stats,omitempty"`
+	Messages []outMessage `json:"messages"`
+}
+
+// outMessage is a message as written to the output.
+type outMessage struct {
+	types.Message
+	// Score is the importance score, set when scoring is enabled.
+	Score *float64 `json:"gh_slackdump_score,omitempty"`
+	// FirstReactor is the earliest reacting user, set when enabled.
+	FirstReactor string `json:"gh_slackdump_first_reactor,omitempty"`
+	// SharedMessages normalizes the attachments that share another message.
+	SharedMessages []sharedMessage `json:"gh_slackdump_shared_messages,omitempty"`
+	// Permalink links to the message in Slack, set with --permalinks.
+	Permalink string `json:"permalink,omitempty"`
+	// Matches labels the --grep patterns the message matches.
+	Matches []string `json:"matches,omitempty"`
+	// LinkTarget marks the reply a thread link points at.
+	LinkTarget    bool         `json:"link_target,omitempty"`
+	ThreadReplies []outMessage `json:"slackdump_thread_replies,omitempty"`
+
+	// fields, when set, are the only keys written (--fields).
+	fields map[string]bool
+	// iso, when set, adds ISO 8601 siblings to the timestamps (--iso-dates).
+	iso *time.Location
+	// localFiles, when set, mark the files downloaded or filtered out by
+	// --files, by ID.
+	localFiles map[string]fileMark
+}
+
+// MarshalJSON encodes the message, keeping only its --fields and adding the
+// --iso-dates timestamps and the local paths of --files if set.
+func (m outMessage) MarshalJSON() ([]byte, error) {
+	type plain outMessage
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, plain(m), ""); err != nil {
+		return nil, err
+	}
+	data := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	local := m.localFiles
+	if len(m.Files) == 0 {
+		local = nil
+	}
+	if m.fields == nil && m.iso == nil && local == nil {
+		return data, nil
+	}
+	return rewriteMessage(data, m.fields, m.iso, local)
+}
+
+// encodeOptions selects the additions applied while building the output.
+type encodeOptions struct {
+	// weights enables importance scores when non-nil.
+	weights *scoreWeights
+	// sortBy orders parent messages: "" or "ts" keeps chronological order,
+	// "score" ranks by descending score.
+	sortBy string
+	// top keeps only the top N messages by score when positive.
+	top int
+	// firstReactor adds each message's earliest reacting user.
+	firstReactor bool
+	// sharedThreads holds the threads of shared messages fetched with
+	// --expand-shares, keyed by shareKey.
+	sharedThreads map[string][]types.Message
+	// compact writes the document without indentation (--compact).
+	compact bool
+	// linkTarget is the ts of the reply the link points at, if any.
+	linkTarget string
+	// fields, when set, prunes each message to these keys (--fields).
+	fields map[string]bool
+	// iso, when set, is the zone of the --iso-dates timestamps.
+	iso *time.Location
+	// localFiles, when set, mark the files downloaded or filtered out with
+	// --files, by file ID.
+	localFiles map[string]fileMark
+	// permalinks, when set, is the workspace URL of the permalink added to
+	// each message of conversation permalinkChannel (--permalinks).
+	permalinks       string
+	permalinkChannel string
+	// grepMatches, when set, holds the labels of the --grep patterns each
+	// matching message matches, by ts.
+	grepMatches map[string][]string
+	// customEmoji, when set, maps custom emoji to the URLs of their images
+	// from --emoji-dir, for HTML and gh-markdown.
+	customEmoji map[string]string
+	// channel and dump are the document's metadata, nil for none.
+	channel *outChannel
+	dump    *outDump
+	// stats, when set, is written as the document's stats (--stats-json).
+	stats *dumpStats
+}
+
+// buildOutput converts a conversation into the output document.
+func buildOutput(conv *types.Conversation, opts encodeOptions) *outConversation {
+	out := &outConversation{Conversation: *conv, Channel: opts.channel, Dump: opts.dump, Stats: opts.stats, Messages: buildMessages(conv.Messages, opts)}
+	if opts.top > 0 {
+		out.Messages = topMessages(out.Messages, opts.top)
+	}
+	if opts.sortBy == "score" {
+		out.Messages = rankMessages(out.Messages)
+	}
+	return out
+}
+
+func buildMessages(msgs []types.Message, opts encodeOptions) []outMessage {
+	if msgs == nil {
+		return nil
+	}
+	out := make([]outMessage, len(msgs))
+	for i := range msgs {
+		m := &out[i]
+		m.Message = msgs[i]
+		m.Message.ThreadReplies = nil
+		m.ThreadReplies = buildMessages(msgs[i].ThreadReplies, opts)
+		if opts.weights != nil {
+			s := opts.weights.score(&msgs[i])
+			m.Score = &s
+		}
+		if opts.firstReactor {
+			m.FirstReactor = firstReactor(&msgs[i])
+		}
+		m.SharedMessages = sharedMessages(&msgs[i], opts.sharedThreads)
+		if opts.permalinks != "" {
+			m.Permalink = format.Permalink(opts.permalinks, opts.permalinkChannel, msgs[i].Timestamp, msgs[i].ThreadTimestamp)
+		}
+		m.Matches = opts.grepMatches[msgs[i].Timestamp]
+		m.LinkTarget = opts.linkTarget != "" && msgs[i].Timestamp == opts.linkTarget
+		m.fields = opts.fields
+		m.iso = opts.iso
+		m.localFiles = opts.localFiles
+	}
+	return out
+}
+
+// encodeConversation writes the output document as two-space indented JSON,
+// or on one line with --compact, followed by exactly one newline.
+func encodeConversation(w io.Writer, conv *types.Conversation) error {
+	opts := outputOptions
+	if conv.Messages == nil || opts.top > 0 || opts.sortBy == "score" {
+		return encodeDocument(w, buildOutput(conv, opts))
+	}
+	// Nothing needs all the messages at once: build each as it is written.
+	envelope := *conv
+	envelope.Messages = []types.Message{}
+	return encodeMessages(w, buildOutput(&envelope, opts), len(conv.Messages), func(i int) (*outMessage, error) {
+		return &buildMessages(conv.Messages[i:i+1], opts)[0], nil
+	})
+}
+
+// encodeDocument writes doc as encodeConversation does.
+func encodeDocument(w io.Writer, doc *outConversation) error {
+	if doc.Messages == nil {
+		return encodeJSON(w, doc, documentIndent())
+	}
+	envelope := *doc
+	envelope.Messages = []outMessage{}
+	return encodeMessages(w, &envelope, len(doc.Messages), func(i int) (*outMessage, error) { return &doc.Messages[i], nil })
+}
+
+// documentIndent is the indent of the output document: none with --compact.
+func documentIndent() string {
+	if outputOptions.compact {
+		return ""
+	}
+	return "  "
+}
+
+// encodeMessages writes envelope, a document with no messages, with the n
+// messages message returns in its messages array. They are encoded and
+// written one at a time, so only one message's JSON is held in memory, not
+// the whole document's. An error from message stops the write.
+func encodeMessages(w io.Writer, envelope *outConversation, n int, message func(i int) (*outMessage, error)) error {
+	indent := documentIndent()
+	var head bytes.Buffer
+	if err := encodeJSON(&head, envelope, indent); err != nil {
+		return err
+	}
+	// The messages go into the envelope's empty array, its last key.
+	empty := []byte(`"messages":[]`)
+	if indent != "" {
+		empty = []byte(`"messages": []`)
+	}
+	at := bytes.LastIndex(head.Bytes(), empty)
+	if at < 0 {
+		return errors.New("encode: the document has no messages key")
+	}
+	at += len(empty) - 1
+
+	bw := bufio.NewWriter(w)
+	bw.Write(head.Bytes()[:at])
+	elemIndent := indent + indent
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if indent != "" {
+		enc.SetIndent(elemIndent, indent)
+	}
+	for i := range n {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		if indent != "" {
+			bw.WriteString("\n" + elemIndent)
+		}
+		m, err := message(i)
+		if err != nil {
+			return err
+		}
+		buf.Reset()
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+		bw.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	}
+	if indent != "" && n > 0 {
+		bw.WriteString("\n" + indent)
+	}
+	bw.Write(head.Bytes()[at:])
+	return bw.Flush()
+}
+
+// encodeIndented writes v as two-space indented JSON followed by one newline.
+func encodeIndented(w io.Writer, v any) error {
+	return encodeJSON(w, v, "  ")
+}
+
+// encodeJSON writes v as JSON indented by indent, on one line when it is
+// empty, followed by one newline. <, > and & are written as they are, so
+// mentions like <@U123> and URLs stay readable.
+func encodeJSON(w io.Writer, v any, indent string) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if indent != "" {
+		encoder.SetIndent("", indent)
+	}
+	return encoder.Encode(v)
+}
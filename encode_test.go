@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestEncodeConversationMatchesSlackdump(t *testing.T) {
+	conv := &types.Conversation{
+		ID:       "C1",
+		ThreadTS: "1700000000.000100",
+		Name:     "general",
+		Messages: []types.Message{
+			{
+				Message: slack.Message{Msg: slack.Msg{Type: "message", User: "U1", Text: "hi <@U2>", Timestamp: "1700000000.000100"}},
+				ThreadReplies: []types.Message{
+					{Message: slack.Message{Msg: slack.Msg{Type: "message", User: "U2", Text: "hey", Timestamp: "1700000001.000100"}}},
+				},
+			},
+		},
+	}
+
+	// Apart from the unescaped <, > and &, the output is slackdump's own.
+	var want bytes.Buffer
+	enc := json.NewEncoder(&want)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(conv); err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+	if err := encodeConversation(&got, conv); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("encodeConversation() =\n%s\nwant\n%s", got.String(), want.String())
+	}
+}
+
+var update = flag.Bool("update", false, "update golden files")
+
+// TestEncodeConversationGolden pins the output contract: two-space
+// indentation (none with --compact), <, > and & unescaped, exactly one
+// trailing newline, and numbers written as they are modeled upstream
+// (attachment ts as json.Number, file and bot profile times as integer
+// JSONTime). A toolchain or dependency bump that changes any byte fails
+// here.
+func TestEncodeConversationGolden(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "conversation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conv types.Conversation
+	if err := json.Unmarshal(data, &conv); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		compact bool
+		golden  string
+	}{
+		{false, "conversation.golden.json"},
+		{true, "conversation.compact.golden.json"},
+	} {
+		t.Run(tt.golden, func(t *testing.T) {
+			saved := outputOptions
+			t.Cleanup(func() { outputOptions = saved })
+			outputOptions.compact = tt.compact
+
+			var got bytes.Buffer
+			if err := encodeConversation(&got, &conv); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("encoded output drifted from %s (run go test -update to accept):\n%s", golden, got.String())
+			}
+			if !bytes.HasSuffix(got.Bytes(), []byte("}\n")) || bytes.HasSuffix(got.Bytes(), []byte("\n\n")) {
+				t.Error("output must end with exactly one trailing newline")
+			}
+			if lines := bytes.Count(got.Bytes(), []byte("\n")); tt.compact && lines != 1 {
+				t.Errorf("compact output has %d lines, want 1", lines)
+			}
+			if !bytes.Contains(got.Bytes(), []byte("<@U0903ABCDEF> & team")) {
+				t.Error("<, > or & were escaped")
+			}
+		})
+	}
+}
+
+func TestCompactOutput(t *testing.T) {
+	savedCompact, savedFile := compact, outputFile
+	t.Cleanup(func() { compact, outputFile = savedCompact, savedFile })
+	tests := []struct {
+		name           string
+		flag, set, tty bool
+		file           string
+		want           bool
+	}{
+		{name: "terminal", tty: true, want: false},
+		{name: "pipe", tty: false, want: true},
+		{name: "file", tty: false, file: "out.json", want: false},
+		{name: "--compact on a terminal", flag: true, set: true, tty: true, want: true},
+		{name: "--compact=false into a pipe", flag: false, set: true, tty: false, want: false},
+	}
+	for _, tt := range tests {
+		compact, outputFile = tt.flag, tt.file
+		if got := compactOutput(tt.set, tt.tty); got != tt.want {
+			t.Errorf("%s: compactOutput() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildOutputLinkTarget(t *testing.T) {
+	conv := &types.Conversation{ID: "C1", ThreadTS: "1700000000.000100", Messages: []types.Message{
+		{Message: slack.Message{Msg: slack.Msg{Timestamp: "1700000000.000100", ThreadTimestamp: "1700000000.000100"}}},
+		{Message: slack.Message{Msg: slack.Msg{Timestamp: "1700000001.000100", ThreadTimestamp: "1700000000.000100"}}},
+	}}
+	out := buildOutput(conv, encodeOptions{linkTarget: "1700000001.000100"})
+	if out.Messages[0].LinkTarget || !out.Messages[1].LinkTarget {
+		t.Errorf("link_target = %v, %v; want only the reply marked", out.Messages[0].LinkTarget, out.Messages[1].LinkTarget)
+	}
+	data, err := json.Marshal(out.Messages[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"link_target":true`)) {
+		t.Errorf("marked message encodes as %s, want link_target", data)
+	}
+	if data, _ := json.Marshal(out.Messages[0]); bytes.Contains(data, []byte("link_target")) {
+		t.Errorf("unmarked message encodes link_target: %s", data)
+	}
+}
+
+func TestBuildOutputPermalinks(t *testing.T) {
+	conv := &types.Conversation{ID: "C1", Messages: []types.Message{{
+		Message: slack.Message{Msg: slack.Msg{Timestamp: "1700000000.000100", ThreadTimestamp: "1700000000.000100"}},
+		ThreadReplies: []types.Message{
+			{Message: slack.Message{Msg: slack.Msg{Timestamp: "1700000001.000200", ThreadTimestamp: "1700000000.000100"}}},
+		},
+	}}}
+	out := buildOutput(conv, encodeOptions{permalinks: "https://acme.slack.com", permalinkChannel: "C1"})
+	if got, want := out.Messages[0].Permalink, "https://acme.slack.com/archives/C1/p1700000000000100"; got != want {
+		t.Errorf("parent permalink = %q, want %q", got, want)
+	}
+	if got, want := out.Messages[0].ThreadReplies[0].Permalink, "https://acme.slack.com/archives/C1/p1700000001000200?thread_ts=1700000000.000100&cid=C1"; got != want {
+		t.Errorf("reply permalink = %q, want %q", got, want)
+	}
+	if data, _ := json.Marshal(buildOutput(conv, encodeOptions{}).Messages[0]); bytes.Contains(data, []byte("permalink")) {
+		t.Errorf("without --permalinks the message encodes a permalink: %s", data)
+	}
+}
+
+// largeConversation is a synthetic channel of n threads of three messages.
+func largeConversation(n int) *types.Conversation {
+	conv := &types.Conversation{ID: "C1", Name: "general", Messages: make([]types.Message, n)}
+	for i := range conv.Messages {
+		ts := fmt.Sprintf("%d.%06d", 1700000000+i, i)
+		m := types.Message{Message: slack.Message{Msg: slack.Msg{
+			Type: "message", User: "U0903ABCDEF", Timestamp: ts, ThreadTimestamp: ts, ReplyCount: 2,
+			Text:      strings.Repeat("Deploy <https://example.com/notes|notes> for <@U09036M8VEU> ", 4),
+			Reactions: []slack.ItemReaction{{Name: "+1", Count: 2, Users: []string{"U1", "U2"}}},
+		}}}
+		for j := range 2 {
+			reply := m
+			reply.Timestamp = fmt.Sprintf("%d.%06d", 1700000000+i, i+j+1)
+			reply.ReplyCount, reply.Reactions = 0, nil
+			m.ThreadReplies = append(m.ThreadReplies, reply)
+		}
+		conv.Messages[i] = m
+	}
+	return conv
+}
+
+// benchPeakHeap benchmarks run, reporting as peak-heap-B the most memory in
+// use on top of what was in use before it, sampled every millisecond.
+func benchPeakHeap(run func() error) func(b *testing.B) {
+	return func(b *testing.B) {
+		b.ReportAllocs()
+		var peak uint64
+		for b.Loop() {
+			runtime.GC()
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			base := ms.HeapAlloc
+			done := make(chan uint64)
+			go func() {
+				var top uint64
+				for {
+					select {
+					case done <- top:
+						return
+					case <-time.After(time.Millisecond):
+						var ms runtime.MemStats
+						runtime.ReadMemStats(&ms)
+						top = max(top, ms.HeapAlloc-min(base, ms.HeapAlloc))
+					}
+				}
+			}()
+			if err := run(); err != nil {
+				b.Fatal(err)
+			}
+			peak = max(peak, <-done)
+		}
+		b.ReportMetric(float64(peak), "peak-heap-B")
+	}
+}
+
+// maxWriter records the largest single write.
+type maxWriter struct{ max int }
+
+func (w *maxWriter) Write(p []byte) (int, error) {
+	w.max = max(w.max, len(p))
+	return len(p), nil
+}
+
+func TestEncodeConversationStreams(t *testing.T) {
+	conv := largeConversation(2000)
+	t.Cleanup(func() { outputOptions = encodeOptions{} })
+	for _, compact := range []bool{false, true} {
+		outputOptions = encodeOptions{compact: compact}
+		var want bytes.Buffer
+		if err := encodeJSON(&want, buildOutput(conv, outputOptions), documentIndent()); err != nil {
+			t.Fatal(err)
+		}
+		var got bytes.Buffer
+		w := &maxWriter{}
+		if err := encodeConversation(io.MultiWriter(&got, w), conv); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("compact=%v: streamed document differs from the encoded one", compact)
+		}
+		if w.max > 64<<10 {
+			t.Errorf("compact=%v: a single write of %d bytes of a %d-byte document; want it written as encoded", compact, w.max, got.Len())
+		}
+	}
+}
+
+// BenchmarkEncodeConversation compares encoding the whole document at once,
+// as before messages were streamed, with encodeConversation. peak-heap-B is
+// the most memory in use on top of the conversation while encoding, sampled.
+func BenchmarkEncodeConversation(b *testing.B) {
+	conv := largeConversation(20000)
+	b.Cleanup(func() { outputOptions = encodeOptions{} })
+	outputOptions = encodeOptions{compact: true}
+	b.Run("whole", benchPeakHeap(func() error {
+		return encodeJSON(io.Discard, buildOutput(conv, outputOptions), "")
+	}))
+	b.Run("streamed", benchPeakHeap(func() error {
+		return encodeConversation(io.Discard, conv)
+	}))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"github.com/cli/go-gh/v2/pkg/term"
+)
+
+// ageExt is appended to the name of every file written with --encrypt-to.
+const ageExt = ".age"
+
+// encryptTo holds the --encrypt-to values: age recipients, SSH public keys,
+// or files of either.
+var encryptTo []string
+
+// outputRecipients are the recipients the output is encrypted to, nil for
+// none; run and convert set them from --encrypt-to.
+var outputRecipients []age.Recipient
+
+// parseRecipients parses the --encrypt-to values. Each is an age recipient
+// (age1…), an SSH public key (ssh-ed25519 or ssh-rsa), or the path of a
+// file of them, one per line, such as ~/.ssh/id_ed25519.pub or an age
+// recipients file; blank lines and # comments are skipped.
+func parseRecipients(values []string) ([]age.Recipient, error) {
+	var out []age.Recipient
+	for _, v := range values {
+		if strings.HasPrefix(v, "age1") || strings.HasPrefix(v, "ssh-") {
+			r, err := parseRecipient(v)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, r)
+			continue
+		}
+		rs, err := readRecipientsFile(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rs...)
+	}
+	return out, nil
+}
+
+// parseRecipient parses an age recipient or an SSH public key.
+func parseRecipient(s string) (age.Recipient, error) {
+	if strings.HasPrefix(s, "age1") {
+		r, err := age.ParseX25519Recipient(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", s, err)
+		}
+		return r, nil
+	}
+	r, err := agessh.ParseRecipient(s)
+	if err != nil {
+		return nil, fmt.Errorf("%.40q: %w", s, err)
+	}
+	return r, nil
+}
+
+// readRecipientsFile reads the recipients in the file at path.
+func readRecipientsFile(path string) ([]age.Recipient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("not an age recipient or SSH public key, nor a file of them: %w", err)
+	}
+	defer f.Close()
+	var out []age.Recipient
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := parseRecipient(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		out = append(out, r)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s holds no recipients", path)
+	}
+	return out, nil
+}
+
+// checkEncryptFlags sets outputRecipients from --encrypt-to and checks it
+// against the rest of the flags, before resolveOutputPath. A -o file
+// already ending in .age is taken without it, so its compression is still
+// read from the extension before. The dump and convert share it.
+func checkEncryptFlags() error {
+	if len(encryptTo) == 0 {
+		outputRecipients = nil
+		return nil
+	}
+	rs, err := parseRecipients(encryptTo)
+	if err != nil {
+		return fmt.Errorf("--encrypt-to: %w", err)
+	}
+	switch {
+	case sinceLast:
+		return errors.New("--encrypt-to can't be combined with --since-last-message, which reads the output back")
+	case gist:
+		return errors.New("--gist: gists hold text, so the output can't be encrypted")
+	case outputFile == "" && term.FromEnv().IsTerminalOutput():
+		return errors.New("--encrypt-to writes binary output: use -o, or redirect stdout")
+	}
+	if !writesDirectory() {
+		outputFile = strings.TrimSuffix(outputFile, ageExt)
+	}
+	outputRecipients = rs
+	return nil
+}
+
+// encryptedPath returns the name path is written under: with .age appended
+// when the output is encrypted.
+func encryptedPath(path string) string {
+	if outputRecipients == nil || path == "" || strings.HasSuffix(path, ageExt) {
+		return path
+	}
+	return path + ageExt
+}
+
+// encryptWriter returns a writer encrypting to outputRecipients into w, or
+// nil when the output isn't encrypted. Closing it finishes the encryption;
+// it doesn't close w.
+func encryptWriter(w io.Writer) (io.WriteCloser, error) {
+	if outputRecipients == nil {
+		return nil, nil
+	}
+	return age.Encrypt(w, outputRecipients...)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseRecipients(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshLine := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))) + " alice@laptop"
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "id_ed25519.pub")
+	if err := os.WriteFile(keyFile, []byte(sshLine+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	listFile := filepath.Join(dir, "recipients.txt")
+	if err := os.WriteFile(listFile, []byte("# team\n"+id.Recipient().String()+"\n\n"+sshLine+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(emptyFile, []byte("# nobody\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		values  []string
+		want    int
+		wantErr bool
+	}{
+		{values: []string{id.Recipient().String()}, want: 1},
+		{values: []string{sshLine}, want: 1},
+		{values: []string{keyFile}, want: 1},
+		{values: []string{listFile, id.Recipient().String()}, want: 3},
+		{values: []string{"age1nope"}, wantErr: true},
+		{values: []string{"ssh-ed25519 AAAA"}, wantErr: true},
+		{values: []string{filepath.Join(dir, "missing.pub")}, wantErr: true},
+		{values: []string{emptyFile}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRecipients(tt.values)
+		if (err != nil) != tt.wantErr || len(got) != tt.want {
+			t.Errorf("parseRecipients(%q) = %d recipients, %v; want %d, error %v", tt.values, len(got), err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestEncryptedOutputRoundTrip(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshRecipient, err := agessh.NewEd25519Recipient(sshPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshID, err := agessh.NewEd25519Identity(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRecipients, oldCompression := outputRecipients, outputCompression
+	outputRecipients = []age.Recipient{id.Recipient(), sshRecipient}
+	outputCompression = compressGzip
+	defer func() { outputRecipients, outputCompression = oldRecipients, oldCompression }()
+
+	path := filepath.Join(t.TempDir(), "general.json.gz")
+	const want = `{"messages":[]}`
+	if _, err := writeOutputTo(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, want)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s was written unencrypted", path)
+	}
+	for _, identity := range []age.Identity{id, sshID} {
+		f, err := os.Open(path + ageExt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := age.Decrypt(f, identity)
+		if err != nil {
+			f.Close()
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			f.Close()
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(zr)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("decrypted %q, want %q", got, want)
+		}
+	}
+}
+
+func TestEncryptedPath(t *testing.T) {
+	old := outputRecipients
+	defer func() { outputRecipients = old }()
+
+	outputRecipients = nil
+	if got := encryptedPath("general.json"); got != "general.json" {
+		t.Errorf("without recipients, encryptedPath = %q", got)
+	}
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputRecipients = []age.Recipient{id.Recipient()}
+	for path, want := range map[string]string{
+		"general.json":     "general.json.age",
+		"general.json.age": "general.json.age",
+		"":                 "",
+	} {
+		if got := encryptedPath(path); got != want {
+			t.Errorf("encryptedPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// estimateSampleRate is the share of top-level messages --estimate renders:
+// one in estimateSampleRate, but never fewer than minEstimateSample.
+const (
+	estimateSampleRate = 100
+	minEstimateSample  = 10
+)
+
+// sizeEstimate is the projected size of the output document.
+type sizeEstimate struct {
+	// sampled and total count the top-level messages rendered and in the
+	// document.
+	sampled, total int
+	// bytes is the projected size of the encoded document.
+	bytes int64
+	// largest is the size of the largest sampled message with its thread.
+	largest int64
+}
+
+// estimateOutput projects the encoded size of conv by rendering an evenly
+// spread sample of its top-level messages (with their threads) through the
+// real encoder and extrapolating. The envelope is measured exactly, so the
+// error comes only from how representative the sample is.
+func estimateOutput(conv *types.Conversation, opts encodeOptions) (sizeEstimate, error) {
+	doc := buildOutput(conv, opts)
+	msgs := doc.Messages
+	n := len(msgs)
+	if n == 0 {
+		size, err := encodedSize(doc)
+		return sizeEstimate{bytes: size}, err
+	}
+	k := min(n, max((n+estimateSampleRate-1)/estimateSampleRate, minEstimateSample))
+
+	doc.Messages = []outMessage{}
+	envelope, err := encodedSize(doc)
+	if err != nil {
+		return sizeEstimate{}, err
+	}
+	sample := make([]outMessage, k)
+	var largest int64
+	for i := range sample {
+		sample[i] = msgs[i*n/k]
+		doc.Messages = sample[i : i+1]
+		size, err := encodedSize(doc)
+		if err != nil {
+			return sizeEstimate{}, err
+		}
+		largest = max(largest, size-envelope)
+	}
+	doc.Messages = sample
+	sampled, err := encodedSize(doc)
+	if err != nil {
+		return sizeEstimate{}, err
+	}
+	return sizeEstimate{
+		sampled: k,
+		total:   n,
+		bytes:   envelope + (sampled-envelope)*int64(n)/int64(k),
+		largest: largest,
+	}, nil
+}
+
+func encodedSize(doc *outConversation) (int64, error) {
+	var buf bytes.Buffer
+	if err := encodeDocument(&buf, doc); err != nil {
+		return 0, err
+	}
+	return int64(buf.Len()), nil
+}
+
+// String reports the estimate. Messages are encoded and written one at a
+// time, so encoding needs about the largest message's size on top of the
+// fetched conversation.
+func (e sizeEstimate) String() string {
+	return fmt.Sprintf("estimated output: %s as json (rendered %d of %d messages)\n"+
+		"estimated memory: %s to encode (messages are written one at a time; this is the largest sampled one)",
+		formatSize(e.bytes), e.sampled, e.total, formatSize(e.largest))
+}
+
+// postureNote is what --estimate says of a channel whose posting is
+// limited, as its threads won't look like an ordinary channel's: few in an
+// announcement channel, every reply in one when thread-only. It's "" for an
+// ordinary channel.
+func postureNote(name string, posture []string) string {
+	if len(posture) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("note: #%s is %s, so expect its threads to differ from an ordinary channel's", name, strings.Join(posture, " and "))
+}
+
+// formatSize renders n bytes with a binary unit, e.g. "1.5 MB".
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
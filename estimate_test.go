@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestEstimateOutput(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "conversation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixture types.Conversation
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		t.Fatal(err)
+	}
+
+	large := &types.Conversation{ID: "C1", Name: "general"}
+	for i := range 5000 {
+		m := types.Message{Message: slack.Message{Msg: slack.Msg{
+			Type:      "message",
+			User:      fmt.Sprintf("U%d", i%37),
+			Text:      strings.Repeat("word ", 5+i*7%60),
+			Timestamp: fmt.Sprintf("17000%05d.000100", i),
+		}}}
+		if i%9 == 0 {
+			m.ThreadReplies = []types.Message{
+				{Message: slack.Message{Msg: slack.Msg{Type: "message", User: "U2", Text: "reply", Timestamp: fmt.Sprintf("17000%05d.000200", i)}}},
+			}
+		}
+		large.Messages = append(large.Messages, m)
+	}
+
+	tests := []struct {
+		name        string
+		conv        *types.Conversation
+		opts        encodeOptions
+		wantSampled int
+		margin      float64
+	}{
+		{name: "fixture is rendered whole", conv: &fixture, wantSampled: len(fixture.Messages), margin: 0.01},
+		{name: "large conversation samples 1%", conv: large, wantSampled: 50, margin: 0.10},
+		{name: "with scores", conv: large, opts: encodeOptions{weights: &defaultScoreWeights}, wantSampled: 50, margin: 0.10},
+		{name: "empty", conv: &types.Conversation{ID: "C1"}, margin: 0.01},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			est, err := estimateOutput(tt.conv, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if est.sampled != tt.wantSampled {
+				t.Errorf("sampled %d messages, want %d", est.sampled, tt.wantSampled)
+			}
+
+			var buf bytes.Buffer
+			if err := encodeDocument(&buf, buildOutput(tt.conv, tt.opts)); err != nil {
+				t.Fatal(err)
+			}
+			actual := float64(buf.Len())
+			if off := (float64(est.bytes) - actual) / actual; off > tt.margin || off < -tt.margin {
+				t.Errorf("estimate %d bytes, actual %d (off by %.1f%%, margin %.0f%%)", est.bytes, buf.Len(), off*100, tt.margin*100)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KB"},
+		{400 << 20, "400.0 MB"},
+		{3 << 30, "3.0 GB"},
+	}
+	for _, tt := range tests {
+		if got := formatSize(tt.n); got != tt.want {
+			t.Errorf("formatSize(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestPostureNote(t *testing.T) {
+	if got := postureNote("general", nil); got != "" {
+		t.Errorf("postureNote(general) = %q, want none", got)
+	}
+	want := "note: #announcements is read-only and thread-only, so expect its threads to differ from an ordinary channel's"
+	if got := postureNote("announcements", []string{"read-only", "thread-only"}); got != want {
+		t.Errorf("postureNote(announcements) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3"
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/channels"
+	"github.com/wham/gh-slackdump/internal/errs"
+)
+
+// exportGroup is a conversation's entry in an export's groups.json or
+// mpims.json, as Slack writes it.
+type exportGroup struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name,omitempty"`
+	Created    slack.JSONTime `json:"created"`
+	Creator    string         `json:"creator"`
+	IsArchived bool           `json:"is_archived"`
+	Members    []string       `json:"members"`
+	Topic      slack.Topic    `json:"topic"`
+	Purpose    slack.Purpose  `json:"purpose"`
+}
+
+// exportChannel is a channel's entry in an export's channels.json.
+type exportChannel struct {
+	exportGroup
+	IsGeneral bool `json:"is_general"`
+}
+
+// exportDM is a DM's entry in an export's dms.json, which Slack keeps to
+// its ID, creation time and the IDs of its two members.
+type exportDM struct {
+	ID      string         `json:"id"`
+	Created slack.JSONTime `json:"created"`
+	Members []string       `json:"members"`
+}
+
+// exportLists are the list files of an export. Each is written, empty when
+// the conversation isn't in it, as viewers such as slack-export-viewer
+// read them all.
+var exportLists = []string{"channels.json", "groups.json", "dms.json", "mpims.json"}
+
+// resolveExportDir validates -o for the formats that write a directory
+// (export, zulip) and for --split: a directory, which is created if it
+// doesn't exist yet.
+func resolveExportDir(path string) error {
+	writer := "--format " + outputFormat
+	if splitPeriod != "" {
+		writer = "--split"
+	}
+	if path == "" {
+		return fmt.Errorf("%s requires -o <directory>", writer)
+	}
+	if fi, err := os.Stat(path); err == nil {
+		if !fi.IsDir() {
+			return fmt.Errorf("-o %s is a file; %s writes a directory", path, writer)
+		}
+		return nil
+	}
+	parent := filepath.Dir(filepath.Clean(path))
+	if fi, err := os.Stat(parent); err != nil || !fi.IsDir() {
+		return fmt.Errorf("-o %s: directory %s does not exist", path, parent)
+	}
+	return nil
+}
+
+// exportConversation writes conv as --format export to dir, with the
+// channel's entry from conversations.info and the workspace's users.
+func exportConversation(ctx context.Context, sd *slackdump.Session, dir string, conv *types.Conversation) error {
+	ch := conversationInfo(ctx, conv).Channel
+	users, err := sd.GetUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching users for users.json: %w", errs.Classify(err))
+	}
+	switch {
+	case ch.IsIM && ch.User != "":
+		ch.Members = slices.Compact(slices.Sorted(slices.Values([]string{ch.User, cmp.Or(sd.CurrentUserID(), ch.User)})))
+	case ch.IsMpIM:
+		if ch.Members, err = conversationMembers(ctx, sd.Client(), ch.ID); err != nil {
+			slog.Warn("can't list the group DM's members, listing its authors", "channel", ch.ID, "error", err)
+		}
+	}
+	return writeExport(dir, &ch, users, conv)
+}
+
+// conversationMembers lists the members of a conversation with
+// conversations.members, page by page.
+func conversationMembers(ctx context.Context, client *slack.Client, id string) ([]string, error) {
+	var members []string
+	params := &slack.GetUsersInConversationParameters{ChannelID: id, Limit: 1000}
+	for {
+		page, cursor, err := client.GetUsersInConversationContext(ctx, params)
+		if err != nil {
+			return nil, errs.Classify(err)
+		}
+		members = append(members, page...)
+		if cursor == "" {
+			return members, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// conversationInfo returns conv's channel from conversations.info, through
+// the run's conversationCache, or, when that fails, a channel with only its
+// ID and name.
+func conversationInfo(ctx context.Context, conv *types.Conversation) *channels.Channel {
+	ch, err := conversationCache.Info(ctx, conv.ID)
+	if err != nil {
+		slog.Warn("can't get channel info, writing only its ID and name", "channel", conv.ID, "error", err)
+		return &channels.Channel{Channel: slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: conv.ID}, Name: conv.Name}}}
+	}
+	return ch
+}
+
+// writeExport writes the Slack export layout to dir: users.json, the
+// channel list file, and one file per UTC day with the messages of that
+// day, thread replies included.
+func writeExport(dir string, ch *slack.Channel, users []slack.User, conv *types.Conversation) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if users == nil {
+		users = []slack.User{}
+	}
+	list, folder := exportPlacement(ch)
+	files := map[string]any{"users.json": users}
+	for _, l := range exportLists {
+		files[l] = []any{}
+	}
+	files[list] = []any{exportEntry(ch, conv)}
+	days, err := exportDays(exportMessages(conv))
+	if err != nil {
+		return err
+	}
+	for day, msgs := range days {
+		files[filepath.Join(folder, day+".json")] = msgs
+	}
+	if err := os.MkdirAll(filepath.Join(dir, folder), 0o755); err != nil {
+		return err
+	}
+	for name, v := range files {
+		if err := writeFileAtomic(filepath.Join(dir, name), func(w io.Writer) error {
+			return encodeIndented(w, v)
+		}); err != nil {
+			return err
+		}
+	}
+	slog.Info("output written", "dir", dir, "days", len(days))
+	return nil
+}
+
+// exportPlacement returns the list file a conversation is described in and
+// the folder its days go to, as in Slack's exports: DMs by ID, others by
+// name.
+func exportPlacement(ch *slack.Channel) (list, folder string) {
+	folder = ch.Name
+	if folder == "" {
+		folder = ch.ID
+	}
+	switch {
+	case ch.IsIM:
+		return "dms.json", ch.ID
+	case ch.IsMpIM:
+		return "mpims.json", folder
+	case ch.IsPrivate:
+		return "groups.json", folder
+	}
+	return "channels.json", folder
+}
+
+// exportEntry returns ch's entry in its list file: an exportDM, an
+// exportGroup or an exportChannel, as exportPlacement places it. A DM or
+// group DM without members, as conversations.info describes them, lists
+// the other user and the authors of conv's messages.
+func exportEntry(ch *slack.Channel, conv *types.Conversation) any {
+	members := ch.Members
+	if len(members) == 0 && (ch.IsIM || ch.IsMpIM) {
+		members = exportAuthors(conv)
+		if ch.User != "" {
+			members = append(members, ch.User)
+		}
+		members = slices.Compact(slices.Sorted(slices.Values(members)))
+	}
+	if members == nil {
+		members = []string{}
+	}
+	if ch.IsIM {
+		return exportDM{ID: ch.ID, Created: ch.Created, Members: members}
+	}
+	g := exportGroup{
+		ID:         ch.ID,
+		Name:       ch.Name,
+		Created:    ch.Created,
+		Creator:    ch.Creator,
+		IsArchived: ch.IsArchived,
+		Members:    members,
+		Topic:      ch.Topic,
+		Purpose:    ch.Purpose,
+	}
+	if ch.IsMpIM || ch.IsPrivate {
+		return g
+	}
+	return exportChannel{exportGroup: g, IsGeneral: ch.IsGeneral}
+}
+
+// exportAuthors returns the users who wrote conv's messages and replies,
+// bots left out.
+func exportAuthors(conv *types.Conversation) []string {
+	var ids []string
+	var walk func(msgs []types.Message)
+	walk = func(msgs []types.Message) {
+		for _, m := range msgs {
+			if m.User != "" && m.BotID == "" {
+				ids = append(ids, m.User)
+			}
+			walk(m.ThreadReplies)
+		}
+	}
+	walk(conv.Messages)
+	return ids
+}
+
+// exportMessages flattens conv into the messages of an export: thread
+// replies next to top-level messages, each once (a reply also sent to the
+// channel is listed in both places), sorted by ts. Replies get
+// parent_user_id and their parents the replies list, as Slack exports have
+// them.
+func exportMessages(conv *types.Conversation) []slack.Message {
+	var all []slack.Message
+	seen := make(map[string]bool)
+	var walk func(msgs []types.Message)
+	walk = func(msgs []types.Message) {
+		for _, m := range msgs {
+			if !seen[m.Timestamp] {
+				seen[m.Timestamp] = true
+				all = append(all, m.Message)
+			}
+			walk(m.ThreadReplies)
+		}
+	}
+	walk(conv.Messages)
+
+	parents := make(map[string]int)
+	for i, m := range all {
+		if m.ThreadTimestamp != "" && m.ThreadTimestamp == m.Timestamp {
+			parents[m.Timestamp] = i
+		}
+	}
+	replies := make(map[int][]slack.Reply)
+	for i := range all {
+		m := &all[i]
+		p, ok := parents[m.ThreadTimestamp]
+		if !ok || m.ThreadTimestamp == m.Timestamp {
+			continue
+		}
+		if m.ParentUserId == "" {
+			m.ParentUserId = all[p].User
+		}
+		replies[p] = append(replies[p], slack.Reply{User: m.User, Timestamp: m.Timestamp})
+	}
+	for p, rs := range replies {
+		parent := &all[p]
+		if len(parent.Replies) == 0 {
+			parent.Replies = rs
+		}
+		if len(parent.ReplyUsers) == 0 {
+			for _, r := range rs {
+				if !slices.Contains(parent.ReplyUsers, r.User) {
+					parent.ReplyUsers = append(parent.ReplyUsers, r.User)
+				}
+			}
+		}
+	}
+	slices.SortStableFunc(all, func(a, b slack.Message) int {
+		switch {
+		case tsAfter(b.Timestamp, a.Timestamp):
+			return -1
+		case tsAfter(a.Timestamp, b.Timestamp):
+			return 1
+		}
+		return 0
+	})
+	return all
+}
+
+// exportDays groups msgs by their UTC day, YYYY-MM-DD.
+func exportDays(msgs []slack.Message) (map[string][]slack.Message, error) {
+	days := make(map[string][]slack.Message)
+	for _, m := range msgs {
+		ts, err := parseSlackTS(m.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		day := ts.Format("2006-01-02")
+		days[day] = append(days[day], m)
+	}
+	return days, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func userMsg(ts, user, threadTS string, replies ...types.Message) types.Message {
+	m := msg(ts, replies...)
+	m.User, m.ThreadTimestamp = user, threadTS
+	return m
+}
+
+func TestWriteExport(t *testing.T) {
+	// 1700000000 is 2023-11-14 22:13:20 UTC; the thread runs into the 15th.
+	broadcast := userMsg("1700010000.000100", "U3", "1700000000.000100")
+	broadcast.SubType = "thread_broadcast"
+	conv := &types.Conversation{ID: "C1", Name: "general", Messages: []types.Message{
+		userMsg("1700000000.000100", "U1", "1700000000.000100",
+			userMsg("1700000100.000100", "U2", "1700000000.000100"),
+			broadcast,
+		),
+		broadcast,
+		userMsg("1700100000.000100", "U2", ""),
+	}}
+	ch := &slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "C1"}, Name: "general"}, IsGeneral: true}
+	dir := filepath.Join(t.TempDir(), "export")
+	if err := writeExport(dir, ch, []slack.User{{ID: "U1", Name: "alice"}}, conv); err != nil {
+		t.Fatalf("writeExport() error: %v", err)
+	}
+
+	read := func(name string, v any) {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	var channels []map[string]any
+	read("channels.json", &channels)
+	if len(channels) != 1 || channels[0]["id"] != "C1" || channels[0]["name"] != "general" || channels[0]["is_general"] != true {
+		t.Errorf("channels.json = %v", channels)
+	}
+	var users []slack.User
+	read("users.json", &users)
+	if len(users) != 1 || users[0].Name != "alice" {
+		t.Errorf("users.json = %+v", users)
+	}
+
+	var day1, day2 []slack.Message
+	read("general/2023-11-14.json", &day1)
+	read("general/2023-11-16.json", &day2)
+	var ts []string
+	for _, m := range day1 {
+		ts = append(ts, m.Timestamp)
+	}
+	if !slices.Equal(ts, []string{"1700000000.000100", "1700000100.000100"}) {
+		t.Fatalf("2023-11-14.json holds %v, want the parent and its first reply", ts)
+	}
+	parent, reply := day1[0], day1[1]
+	if len(parent.Replies) != 2 || !slices.Equal(parent.ReplyUsers, []string{"U2", "U3"}) {
+		t.Errorf("parent replies = %v, reply users = %v", parent.Replies, parent.ReplyUsers)
+	}
+	if reply.ParentUserId != "U1" || reply.ThreadTimestamp != "1700000000.000100" {
+		t.Errorf("reply = %+v, want parent_user_id U1 and the parent's thread_ts", reply)
+	}
+	var day15 []slack.Message
+	read("general/2023-11-15.json", &day15)
+	if len(day15) != 1 || day15[0].SubType != "thread_broadcast" || day15[0].ParentUserId != "U1" {
+		t.Errorf("2023-11-15.json = %+v, want the broadcast reply once", day15)
+	}
+	if len(day2) != 1 {
+		t.Errorf("2023-11-16.json has %d messages, want 1", len(day2))
+	}
+}
+
+func TestExportPlacement(t *testing.T) {
+	tests := []struct {
+		ch           slack.Channel
+		list, folder string
+	}{
+		{slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "C1"}, Name: "general"}}, "channels.json", "general"},
+		{slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "G1", IsPrivate: true}, Name: "secret"}}, "groups.json", "secret"},
+		{slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "D1", IsIM: true, IsPrivate: true}}}, "dms.json", "D1"},
+		{slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "G2", IsMpIM: true, IsPrivate: true}, Name: "mpdm-a--b-1"}}, "mpims.json", "mpdm-a--b-1"},
+	}
+	for _, tt := range tests {
+		if list, folder := exportPlacement(&tt.ch); list != tt.list || folder != tt.folder {
+			t.Errorf("exportPlacement(%s) = %s, %s; want %s, %s", tt.ch.ID, list, folder, tt.list, tt.folder)
+		}
+	}
+}
+
+// TestWriteExportSchema checks the entries of each list file against
+// testdata/export-schema.json, the keys of the entries in a real Slack
+// export, and that DMs and group DMs list their members' IDs.
+func TestWriteExportSchema(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "export-schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string][]string
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	conv := &types.Conversation{Messages: []types.Message{userMsg("1700000000.000100", "U2", ""), userMsg("1700000100.000100", "U1", "")}}
+	tests := []struct {
+		ch           slack.Channel
+		list, folder string
+		members      []string
+	}{
+		{slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "C1"}, Name: "general", Members: []string{"U1"}}}, "channels.json", "general", []string{"U1"}},
+		{slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "G1", IsPrivate: true}, Name: "secret"}}, "groups.json", "secret", []string{}},
+		{slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "D1", IsIM: true, IsPrivate: true, User: "U3"}}}, "dms.json", "D1", []string{"U1", "U2", "U3"}},
+		{slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "G2", IsMpIM: true, IsPrivate: true}, Name: "mpdm-a--b-1"}}, "mpims.json", "mpdm-a--b-1", []string{"U1", "U2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := writeExport(dir, &tt.ch, nil, conv); err != nil {
+				t.Fatalf("writeExport() error: %v", err)
+			}
+			for _, list := range slices.Sorted(maps.Keys(schema)) {
+				data, err := os.ReadFile(filepath.Join(dir, list))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var entries []map[string]any
+				if err := json.Unmarshal(data, &entries); err != nil {
+					t.Fatalf("%s: %v", list, err)
+				}
+				if list != tt.list {
+					if len(entries) != 0 {
+						t.Errorf("%s = %v, want []", list, entries)
+					}
+					continue
+				}
+				if len(entries) != 1 {
+					t.Fatalf("%s has %d entries, want 1", list, len(entries))
+				}
+				if keys := slices.Sorted(maps.Keys(entries[0])); !slices.Equal(keys, schema[list]) {
+					t.Errorf("%s keys = %v, want %v", list, keys, schema[list])
+				}
+				var members []string
+				for _, m := range entries[0]["members"].([]any) {
+					members = append(members, m.(string))
+				}
+				if !slices.Equal(members, tt.members) {
+					t.Errorf("%s members = %v, want %v", list, members, tt.members)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dir, tt.folder, "2023-11-14.json")); err != nil {
+				t.Errorf("messages not in %s/: %v", tt.folder, err)
+			}
+		})
+	}
+}
+
+func TestResolveExportDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "f.json")
+	os.WriteFile(file, nil, 0o644)
+	for path, ok := range map[string]bool{
+		dir:                              true,
+		filepath.Join(dir, "new"):        true,
+		filepath.Join(dir, "no", "such"): false,
+		file:                             false,
+		"":                               false,
+	} {
+		if err := resolveExportDir(path); (err == nil) != ok {
+			t.Errorf("resolveExportDir(%q) error = %v, want ok %v", path, err, ok)
+		}
+	}
+}
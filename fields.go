@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// repliesField is the key of a message's thread replies, which --fields
+// always keeps so replies are pruned like their parent rather than dropped.
+const repliesField = "slackdump_thread_replies"
+
+// messageFields returns the JSON keys a message can be written with, sorted:
+// slackdump's and the slack library's, and gh-slackdump's additions.
+func messageFields() []string {
+	var names []string
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := range t.NumField() {
+			f := t.Field(i)
+			tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			switch {
+			case f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct:
+				walk(f.Type)
+			case !f.IsExported() || tag == "-":
+			case tag != "":
+				names = append(names, tag)
+			default:
+				names = append(names, f.Name)
+			}
+		}
+	}
+	walk(reflect.TypeFor[outMessage]())
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// parseFields parses --fields, a comma-separated list of message keys, into
+// the set of keys to write.
+func parseFields(spec string) (map[string]bool, error) {
+	valid := messageFields()
+	fields := make(map[string]bool)
+	for name := range strings.SplitSeq(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := slices.BinarySearch(valid, name); !ok {
+			return nil, fmt.Errorf("unknown field %q; valid fields: %s", name, strings.Join(valid, ", "))
+		}
+		fields[name] = true
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields given; valid fields: %s", strings.Join(valid, ", "))
+	}
+	return fields, nil
+}
+
+// rewriteMessage returns the JSON object of a message with only the keys
+// in keep, if set, and the thread replies, in their original order. With
+// iso set, each ts, thread_ts and edited.ts is followed by a ts_iso,
+// thread_ts_iso or edited.ts_iso sibling: the time in that zone, RFC 3339.
+// With local set, the files it has a path for get a local_path.
+func rewriteMessage(data []byte, keep map[string]bool, iso *time.Location, local map[string]fileMark) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	field := func(key string, value []byte) {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		if keep != nil && !keep[key] && key != repliesField {
+			continue
+		}
+		if iso != nil && key == "edited" {
+			if value, err = rewriteMessage(value, nil, iso, nil); err != nil {
+				return nil, err
+			}
+		}
+		if local != nil && key == "files" {
+			if value, err = addLocalPaths(value, local); err != nil {
+				return nil, err
+			}
+		}
+		field(key, value)
+		if iso != nil && (key == "ts" || key == "thread_ts") {
+			if t, ok := isoTime(value, iso); ok {
+				field(key+"_iso", t)
+			}
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestParseFields(t *testing.T) {
+	fields, err := parseFields("ts, user,text,gh_slackdump_score")
+	if err != nil {
+		t.Fatalf("parseFields() error: %v", err)
+	}
+	if len(fields) != 4 || !fields["user"] || !fields["gh_slackdump_score"] {
+		t.Errorf("parseFields() = %v", fields)
+	}
+
+	_, err = parseFields("ts,usr")
+	if err == nil || !strings.Contains(err.Error(), `"usr"`) || !strings.Contains(err.Error(), "thread_ts") {
+		t.Errorf("parseFields(unknown) error = %v, want it named with the valid fields", err)
+	}
+	if _, err := parseFields(" , "); err == nil {
+		t.Error("parseFields(empty) succeeded")
+	}
+}
+
+func TestEncodeFields(t *testing.T) {
+	conv := &types.Conversation{
+		ID:   "C1",
+		Name: "general",
+		Messages: []types.Message{{
+			Message: slack.Message{Msg: slack.Msg{Type: "message", ClientMsgID: "x", User: "U1", Text: "a <b>", Timestamp: "1.000001", ThreadTimestamp: "1.000001"}},
+			ThreadReplies: []types.Message{
+				{Message: slack.Message{Msg: slack.Msg{Type: "message", User: "U2", Text: "reply", Timestamp: "2.000001", ThreadTimestamp: "1.000001"}}},
+			},
+		}},
+	}
+	fields, err := parseFields("ts,user,text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { outputOptions = encodeOptions{} })
+	outputOptions = encodeOptions{fields: fields, compact: true}
+
+	var got bytes.Buffer
+	if err := encodeConversation(&got, conv); err != nil {
+		t.Fatal(err)
+	}
+	// Keys keep their order, thread replies are pruned alike, and the
+	// conversation's own keys are untouched.
+	want := `{"channel_id":"C1","name":"general","messages":[{"user":"U1","text":"a <b>","ts":"1.000001","slackdump_thread_replies":[{"user":"U2","text":"reply","ts":"2.000001"}]}]}` + "\n"
+	if got.String() != want {
+		t.Errorf("encodeConversation() =\n%s\nwant\n%s", got.String(), want)
+	}
+}
+
+func TestEncodeISODates(t *testing.T) {
+	conv := &types.Conversation{
+		ID: "C1",
+		Messages: []types.Message{{
+			Message: slack.Message{Msg: slack.Msg{User: "U1", Timestamp: "1700000000.000100", ThreadTimestamp: "1700000000.000100", Edited: &slack.Edited{User: "U1", Timestamp: "1700000100.000000"}}},
+			ThreadReplies: []types.Message{
+				{Message: slack.Message{Msg: slack.Msg{User: "U2", Timestamp: "1700000060.250000", ThreadTimestamp: "1700000000.000100"}}},
+			},
+		}},
+	}
+	prague, err := parseTZ("Europe/Prague")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	t.Cleanup(func() { outputOptions = encodeOptions{} })
+
+	tests := []struct {
+		name string
+		opts encodeOptions
+		want string
+	}{
+		{
+			name: "UTC",
+			opts: encodeOptions{iso: time.UTC, fields: map[string]bool{"user": true, "ts": true, "thread_ts": true, "edited": true}},
+			want: `{"user":"U1","ts":"1700000000.000100","ts_iso":"2023-11-14T22:13:20.000100Z","thread_ts":"1700000000.000100","thread_ts_iso":"2023-11-14T22:13:20.000100Z",` +
+				`"edited":{"user":"U1","ts":"1700000100.000000","ts_iso":"2023-11-14T22:15:00.000000Z"},` +
+				`"slackdump_thread_replies":[{"user":"U2","ts":"1700000060.250000","ts_iso":"2023-11-14T22:14:20.250000Z","thread_ts":"1700000000.000100","thread_ts_iso":"2023-11-14T22:13:20.000100Z"}]}`,
+		},
+		{
+			name: "--tz",
+			opts: encodeOptions{iso: prague, fields: map[string]bool{"ts": true}},
+			want: `{"ts":"1700000000.000100","ts_iso":"2023-11-14T23:13:20.000100+01:00","slackdump_thread_replies":[{"ts":"1700000060.250000","ts_iso":"2023-11-14T23:14:20.250000+01:00"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.compact = true
+			outputOptions = tt.opts
+			var got bytes.Buffer
+			if err := encodeConversation(&got, conv); err != nil {
+				t.Fatal(err)
+			}
+			want := `{"channel_id":"C1","name":"","messages":[` + tt.want + "]}\n"
+			if got.String() != want {
+				t.Errorf("encodeConversation() =\n%s\nwant\n%s", got.String(), want)
+			}
+		})
+	}
+	if conv.Messages[0].Timestamp != "1700000000.000100" {
+		t.Error("--iso-dates changed the message")
+	}
+}
@@ -0,0 +1,905 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/auth"
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/progress"
+)
+
+var (
+	downloadFiles       bool
+	maxFileSize         string
+	downloadConcurrency int
+	verifyFiles         bool
+	filesInclude        []string
+	filesExclude        []string
+)
+
+// maxFileBytes is --max-file-size in bytes, 0 for no limit;
+// checkFilesFlags sets it.
+var maxFileBytes int64
+
+// fileDownloads counts the --files downloads for the run summary, nil
+// without --files.
+var fileDownloads *fileCounts
+
+// fileCounts counts what became of the files --files found.
+type fileCounts struct {
+	Downloaded int `json:"downloaded"`
+	// Kept counts the files an earlier run downloaded, which weren't
+	// downloaded again.
+	Kept int `json:"kept"`
+	// Skipped counts the files left out by --files-include and
+	// --files-exclude or over --max-file-size and those with nothing to
+	// download: deleted, external or hidden by the workspace's plan.
+	// SkippedBy counts them by reason.
+	Skipped   int            `json:"skipped"`
+	SkippedBy map[string]int `json:"skipped_by,omitempty"`
+	Failed    int            `json:"failed"`
+}
+
+// skip counts a file skipped for reason.
+func (c *fileCounts) skip(reason string) {
+	c.Skipped++
+	if c.SkippedBy == nil {
+		c.SkippedBy = make(map[string]int)
+	}
+	c.SkippedBy[reason]++
+}
+
+// The reasons a file is skipped, as fileCounts.SkippedBy counts them.
+const (
+	skippedByFilter = "filter"
+	skippedBySize   = "max_file_size"
+	skippedDeleted  = "deleted"
+	skippedHidden   = "hidden_by_limit"
+	skippedExternal = "external"
+	skippedNoLink   = "no_link"
+)
+
+const (
+	// fileAttempts is how many times a download is tried when it fails
+	// for a reason that may pass, such as a 5xx or a dropped connection.
+	fileAttempts = 3
+	// localPathField is the key --files adds to each downloaded file.
+	localPathField = "local_path"
+	// skippedByFilterField is the key --files adds to each file left out
+	// by --files-include or --files-exclude.
+	skippedByFilterField = "skipped_by_filter"
+)
+
+// fileMark is what --files adds to a file of the JSON: the path of the
+// downloaded file relative to the output's directory, or that a filter
+// left it out.
+type fileMark struct {
+	Path     string
+	Filtered bool
+}
+
+// fileRetryWait is the wait before the first retry of a download; it
+// doubles on each one. Tests shorten it.
+var fileRetryWait = 2 * time.Second
+
+// checkFilesFlags validates --files, --max-file-size, --files-include,
+// --files-exclude and --download-concurrency against the other flags and
+// parses the size.
+func checkFilesFlags() error {
+	fileDownloads, maxFileBytes = nil, 0
+	if !downloadFiles {
+		switch {
+		case maxFileSize != "":
+			return errors.New("--max-file-size requires --files")
+		case len(filesInclude) > 0:
+			return errors.New("--files-include requires --files")
+		case len(filesExclude) > 0:
+			return errors.New("--files-exclude requires --files")
+		}
+		return nil
+	}
+	if outputFormat == "html" && templateFile == "" && templateString == "" {
+		// --format html takes --files to inline the avatars instead of
+		// linking them; it downloads no attachments.
+		if maxFileSize != "" || len(filesInclude) > 0 || len(filesExclude) > 0 {
+			return errors.New("--max-file-size, --files-include and --files-exclude select attachments to download, which --format html doesn't do")
+		}
+		return nil
+	}
+	for _, p := range slices.Concat(filesInclude, filesExclude) {
+		if err := checkFilePattern(p); err != nil {
+			return err
+		}
+	}
+	switch {
+	case downloadConcurrency < 1:
+		return errors.New("--download-concurrency must be at least 1")
+	case outputFile == "":
+		return errors.New("--files requires -o: the files are written next to it, to <output>__files")
+	case threadsFile != "":
+		return errors.New("--files adds local paths to JSON messages, so it can't be combined with --threads-file")
+	case outputFormat != "json" || templateFile != "" || templateString != "":
+		return errors.New("--files adds local paths to JSON messages, so it only applies to --format json, and to --format html for the avatars")
+	case sinceLast:
+		return errors.New("--files can't be combined with --since-last-message")
+	}
+	if maxFileSize != "" {
+		n, err := parseByteSize(maxFileSize)
+		if err != nil {
+			return fmt.Errorf("--max-file-size: %w", err)
+		}
+		maxFileBytes = n
+	}
+	fileDownloads = &fileCounts{}
+	return nil
+}
+
+// checkFilePattern validates a --files-include or --files-exclude pattern:
+// an extension, such as pdf or .pdf, or a MIME type, such as
+// application/pdf or image/*.
+func checkFilePattern(p string) error {
+	p = strings.TrimSpace(p)
+	if strings.TrimPrefix(p, ".") == "" {
+		return errors.New("--files-include and --files-exclude take extensions such as pdf or MIME types such as image/*, not empty patterns")
+	}
+	if _, err := path.Match(p, ""); err != nil {
+		return fmt.Errorf("--files-include/--files-exclude: %q: %w", p, err)
+	}
+	return nil
+}
+
+// fileMatches reports whether f matches one of patterns: an extension,
+// matched against the type Slack reports and the extension of the file's
+// name, or a MIME type with * wildcards, matched against its MIME type.
+// Case is ignored.
+func fileMatches(f slack.File, patterns []string) bool {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(f.Name)), ".")
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if strings.Contains(p, "/") {
+			if ok, _ := path.Match(p, strings.ToLower(f.Mimetype)); ok {
+				return true
+			}
+			continue
+		}
+		if p = strings.TrimPrefix(p, "."); p == strings.ToLower(f.Filetype) || p == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// fileWanted reports whether --files-include and --files-exclude let f be
+// downloaded.
+func fileWanted(f slack.File) bool {
+	return (len(filesInclude) == 0 || fileMatches(f, filesInclude)) && !fileMatches(f, filesExclude)
+}
+
+var byteSizeRe = regexp.MustCompile(`(?i)^([0-9]+(?:\.[0-9]+)?)\s*([KMGT]?)(?:i?B)?$`)
+
+// parseByteSize parses a size such as 500KB, 25MB or 1.5G, with binary
+// units as the summary prints them; a bare number is bytes.
+func parseByteSize(s string) (int64, error) {
+	m := byteSizeRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("%q isn't a size: use bytes or a number with KB, MB or GB, e.g. 25MB", s)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	if m[2] != "" {
+		for range strings.Index("KMGT", strings.ToUpper(m[2])) + 1 {
+			n *= 1024
+		}
+	}
+	return int64(n), nil
+}
+
+// downloadsAttachments reports whether --files downloads the files
+// attached to messages, as it does for --format json; for --format html it
+// only inlines the avatars.
+func downloadsAttachments() bool {
+	return downloadFiles && outputFormat != "html"
+}
+
+// filesDir is the directory --files downloads to: <output>__files.
+func filesDir() string {
+	return outputFile + "__files"
+}
+
+// fileQueue downloads files into filesDir as they are found, with
+// --download-concurrency workers, each file once however often it is
+// shared. Files --files-include and --files-exclude leave out are never
+// queued. The workers use the session's HTTP client, whose pacer they
+// share with the dump's API calls, taking at most half its rate so message
+// fetching keeps the rest; they wait when Slack answers them 429 and, before each file, while
+// the dump's API calls wait out a 429 or an outage.
+// Failures are warnings, counted in fileDownloads; only a cancelled context
+// fails the downloads.
+type fileQueue struct {
+	d      fileDownloader
+	ctx    context.Context
+	cancel context.CancelFunc
+	// yield waits while the API backs off, when the provider tells.
+	yield func(ctx context.Context) error
+	// workers counts the running workers.
+	workers sync.WaitGroup
+	// saved saves state once, from wait or stop.
+	saved sync.Once
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	seen map[string]bool
+	// pending holds the files found and not yet taken by a worker; closed
+	// is set once no more are added.
+	pending []slack.File
+	closed  bool
+	local   map[string]fileMark
+	state   filesState
+}
+
+// startFileDownloads creates filesDir, reads the state of earlier runs
+// from it and starts the workers of a fileQueue, which wait for add.
+func startFileDownloads(ctx context.Context, prov auth.Provider) (*fileQueue, error) {
+	client, err := prov.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	dir := filesDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("--files: %w", err)
+	}
+	state, err := loadFilesState(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		// The files are still found by their size; only those that can't
+		// be, the encrypted ones, are downloaded again.
+		slog.Warn("can't read the state of earlier downloads, starting afresh", "error", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	q := &fileQueue{
+		d: fileDownloader{
+			client:    client,
+			token:     prov.SlackToken(),
+			dir:       dir,
+			max:       maxFileBytes,
+			encrypted: outputRecipients != nil,
+		},
+		ctx:    ctx,
+		cancel: cancel,
+		seen:   make(map[string]bool),
+		local:  make(map[string]fileMark),
+		state:  state,
+	}
+	if p, ok := prov.(interface {
+		YieldToAPI(ctx context.Context) error
+	}); ok {
+		q.yield = p.YieldToAPI
+	}
+	q.cond = sync.NewCond(&q.mu)
+	// Wake the idle workers so they see the cancellation.
+	context.AfterFunc(ctx, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.cond.Broadcast()
+	})
+	for range max(downloadConcurrency, 1) {
+		q.workers.Go(q.work)
+	}
+	return q, nil
+}
+
+// add queues the files of msgs, replies included, that weren't queued
+// before. A nil queue ignores them.
+func (q *fileQueue) add(msgs []types.Message) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	found := len(q.pending)
+	var collect func(msgs []types.Message)
+	collect = func(msgs []types.Message) {
+		for _, m := range msgs {
+			for _, f := range m.Files {
+				if f.ID == "" || q.seen[f.ID] {
+					continue
+				}
+				q.seen[f.ID] = true
+				if !fileWanted(f) {
+					q.local[f.ID] = fileMark{Filtered: true}
+					fileDownloads.skip(skippedByFilter)
+					continue
+				}
+				q.pending = append(q.pending, f)
+			}
+			collect(m.ThreadReplies)
+		}
+	}
+	collect(msgs)
+	if n := len(q.pending) - found; n > 0 {
+		progressReporter.FilesFound(n)
+		q.cond.Broadcast()
+	}
+}
+
+// work downloads queued files until the queue is closed and empty, or the
+// context is cancelled.
+func (q *fileQueue) work() {
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 && !q.closed && q.ctx.Err() == nil {
+			q.cond.Wait()
+		}
+		if len(q.pending) == 0 || q.ctx.Err() != nil {
+			q.mu.Unlock()
+			return
+		}
+		f := q.pending[0]
+		q.pending = q.pending[1:]
+		prev := q.state.Files[f.ID]
+		q.mu.Unlock()
+
+		if q.yield != nil {
+			if err := q.yield(q.ctx); err != nil {
+				return
+			}
+		}
+		got, kept, err := q.d.download(q.ctx, f, prev)
+		q.mu.Lock()
+		switch {
+		case q.ctx.Err() != nil:
+		case errors.Is(err, errFileSkipped):
+			var skipped *skippedFileError
+			errors.As(err, &skipped)
+			fileDownloads.skip(skipped.reason)
+			slog.Info("file skipped", "id", f.ID, "reason", err)
+		case err != nil:
+			fileDownloads.Failed++
+			slog.Warn("can't download file", "id", f.ID, "name", f.Name, "error", err)
+		default:
+			if kept {
+				fileDownloads.Kept++
+			} else {
+				fileDownloads.Downloaded++
+			}
+			if q.state.Files == nil {
+				q.state.Files = make(map[string]fileState)
+			}
+			q.state.Files[f.ID] = got
+			rel, _ := filepath.Rel(filepath.Dir(outputFile), filepath.Join(q.d.dir, got.Path))
+			q.local[f.ID] = fileMark{Path: filepath.ToSlash(rel)}
+		}
+		q.mu.Unlock()
+		progressReporter.FileDone()
+	}
+}
+
+// wait closes the queue, waits for the files still queued, saves the state
+// and returns the marks of the downloaded and filtered files, by file ID.
+func (q *fileQueue) wait() (map[string]fileMark, error) {
+	q.mu.Lock()
+	q.closed = true
+	if len(q.seen) > 0 {
+		progressReporter.Stage(progress.StageDownloadingFiles)
+	}
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	q.workers.Wait()
+	defer q.cancel()
+	err := q.save()
+	if ctxErr := q.ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("--files: %w", err)
+	}
+	if len(q.seen) > 0 {
+		slog.Info("downloaded files", "downloaded", fileDownloads.Downloaded, "kept", fileDownloads.Kept, "skipped", fileDownloads.Skipped, "skipped_by", fileDownloads.SkippedBy, "failed", fileDownloads.Failed)
+	}
+	return q.local, nil
+}
+
+// stop cancels the downloads, for a run that fails before wait, and saves
+// the state of those that finished. A nil queue has nothing to stop.
+func (q *fileQueue) stop() {
+	if q == nil {
+		return
+	}
+	q.cancel()
+	q.workers.Wait()
+	if err := q.save(); err != nil {
+		slog.Warn("can't save the state of the downloaded files", "error", err)
+	}
+}
+
+// save writes the state to filesDir, once.
+func (q *fileQueue) save() error {
+	var err error
+	q.saved.Do(func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if len(q.state.Files) > 0 {
+			err = saveFilesState(q.d.dir, q.state)
+		}
+	})
+	return err
+}
+
+// filesStateName is the file in filesDir that records what earlier runs
+// downloaded.
+const filesStateName = ".files-state.json"
+
+// filesState records the files downloaded into a filesDir, by file ID, so a
+// later run keeps them instead of downloading them again and --verify-files
+// can check them.
+type filesState struct {
+	Files map[string]fileState `json:"files"`
+}
+
+// fileState is a downloaded file as written to disk: encrypted, with
+// --encrypt-to.
+type fileState struct {
+	// Path is the file's name in filesDir.
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// loadFilesState reads the state of dir, empty when it has none.
+func loadFilesState(dir string) (filesState, error) {
+	var st filesState
+	data, err := os.ReadFile(filepath.Join(dir, filesStateName))
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return filesState{}, fmt.Errorf("%s: %w", filesStateName, err)
+	}
+	return st, nil
+}
+
+// saveFilesState writes st to dir, unencrypted like the --manifest: it
+// holds no content, and --verify-files reads it without the key.
+func saveFilesState(dir string, st filesState) error {
+	f, err := createPlainAtomic(filepath.Join(dir, filesStateName))
+	if err != nil {
+		return err
+	}
+	if err := encodeJSON(f, st, "  "); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit()
+}
+
+// verifyDownloadedFiles checks the files the state of filesDir records
+// against it, checksumming each again, and writes a line per file to w.
+// It downloads nothing.
+func verifyDownloadedFiles(w io.Writer) error {
+	if outputFile == "" {
+		return errors.New("--verify-files requires -o, the output the files were downloaded next to")
+	}
+	dir := filesDir()
+	st, err := loadFilesState(dir)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("--verify-files: %s has no %s; download the files with --files first", dir, filesStateName)
+	case err != nil:
+		return fmt.Errorf("--verify-files: %w", err)
+	case len(st.Files) == 0:
+		return fmt.Errorf("--verify-files: %s lists no files", filesStateName)
+	}
+	files := slices.SortedFunc(maps.Values(st.Files), func(a, b fileState) int { return strings.Compare(a.Path, b.Path) })
+	failed := 0
+	for _, f := range files {
+		if err := verifyDownloadedFile(dir, f); err != nil {
+			failed++
+			fmt.Fprintf(w, "FAILED  %s: %v\n", f.Path, err)
+			continue
+		}
+		fmt.Fprintf(w, "OK      %s\n", f.Path)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files don't match %s; remove them and run with --files again to download them afresh", failed, len(files), filepath.Join(dir, filesStateName))
+	}
+	return nil
+}
+
+// verifyDownloadedFile checks the file f of the state of dir.
+func verifyDownloadedFile(dir string, f fileState) error {
+	if !filepath.IsLocal(f.Path) || filepath.Base(f.Path) != f.Path {
+		return errors.New("not a file name within the directory")
+	}
+	size, sum, err := hashFile(filepath.Join(dir, f.Path))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return errors.New("missing")
+	case err != nil:
+		return err
+	case size != f.Size:
+		return fmt.Errorf("%d bytes, downloaded as %d", size, f.Size)
+	case sum != f.SHA256:
+		return errors.New("SHA-256 doesn't match")
+	}
+	return nil
+}
+
+// errFileSkipped wraps the reasons a file isn't downloaded, which aren't
+// failures.
+var errFileSkipped = errors.New("skipped")
+
+// skippedFileError is a file that isn't downloaded for reason, one of the
+// skipped constants. It is errFileSkipped.
+type skippedFileError struct {
+	reason string
+	detail string
+}
+
+func (e *skippedFileError) Error() string { return "skipped: " + e.detail }
+
+func (e *skippedFileError) Is(target error) bool { return target == errFileSkipped }
+
+// fileDownloader downloads files with the session's HTTP client, which
+// carries the d cookie and waits out 429s, sending the token, if any, as
+// Slack's clients do.
+type fileDownloader struct {
+	client *http.Client
+	token  string
+	dir    string
+	// max is the largest file downloaded, 0 for any size.
+	max int64
+	// encrypted is set with --encrypt-to. Encrypted files can't be resumed
+	// or compared with the size Slack reports.
+	encrypted bool
+}
+
+// partSuffix is appended to the name of a download in progress. Unlike
+// createAtomic's temporary files, it is left behind when a download fails,
+// for the next attempt or run to resume.
+const partSuffix = ".part"
+
+// download writes f to the directory, retrying failures that may pass, and
+// returns its state. A file an earlier run downloaded is kept: it is
+// reported with kept set and not downloaded again. prev is f's state from
+// that run, zero if it has none. It is safe for concurrent use.
+func (d fileDownloader) download(ctx context.Context, f slack.File, prev fileState) (st fileState, kept bool, err error) {
+	url := cmp.Or(f.URLPrivateDownload, f.URLPrivate)
+	switch {
+	case f.Mode == "tombstone":
+		return st, false, &skippedFileError{skippedDeleted, "the file was deleted"}
+	case f.Mode == "hidden_by_limit":
+		return st, false, &skippedFileError{skippedHidden, "the file is hidden by the workspace's plan"}
+	case f.IsExternal:
+		return st, false, &skippedFileError{skippedExternal, "the file is stored outside Slack"}
+	case url == "":
+		return st, false, &skippedFileError{skippedNoLink, "the file has no download link"}
+	case d.max > 0 && int64(f.Size) > d.max:
+		return st, false, &skippedFileError{skippedBySize, formatSize(int64(f.Size)) + " is over --max-file-size"}
+	}
+	path := filepath.Join(d.dir, localFileName(f))
+	if st, ok := d.existing(f, path, prev); ok {
+		recordWrite(filepath.Join(d.dir, st.Path), st.Size)
+		return st, true, nil
+	}
+	st, err = withRetries(ctx, f.ID, func() (fileState, error) {
+		if d.encrypted {
+			return d.fetch(ctx, url, f, path)
+		}
+		return d.fetchResumable(ctx, url, f, path)
+	})
+	return st, false, err
+}
+
+// withRetries makes up to fileAttempts attempts at the download of the file
+// id, waiting longer after each, while it fails for a reason that may pass.
+func withRetries(ctx context.Context, id string, fetch func() (fileState, error)) (fileState, error) {
+	wait := fileRetryWait
+	for attempt := 1; ; attempt++ {
+		st, err := fetch()
+		var retry *retryableFileError
+		if err == nil || !errors.As(err, &retry) || attempt == fileAttempts {
+			return st, err
+		}
+		slog.Info("file download failed, retrying", "id", id, "attempt", attempt, "error", err, "wait", wait)
+		select {
+		case <-ctx.Done():
+			return st, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// existing returns the state of f when an earlier run downloaded it to
+// path whole: the file there has the size its state records or, for a file
+// with no state yet, the size Slack reports, and is then checksummed for
+// the state. Anything else is downloaded again.
+func (d fileDownloader) existing(f slack.File, path string, prev fileState) (fileState, bool) {
+	path = encryptedPath(path)
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return fileState{}, false
+	}
+	name := filepath.Base(path)
+	switch {
+	case prev.Path == name && prev.Size == fi.Size() && (d.encrypted || f.Size == 0 || int64(f.Size) == prev.Size):
+		return prev, true
+	case prev.Path == "" && !d.encrypted && f.Size > 0 && int64(f.Size) == fi.Size():
+		size, sum, err := hashFile(path)
+		if err != nil || size != fi.Size() {
+			return fileState{}, false
+		}
+		return fileState{Path: name, Size: size, SHA256: sum}, true
+	}
+	return fileState{}, false
+}
+
+// retryableFileError is a download failure that may pass on a retry.
+type retryableFileError struct{ err error }
+
+func (e *retryableFileError) Error() string { return e.err.Error() }
+func (e *retryableFileError) Unwrap() error { return e.err }
+
+// get requests url from byte offset on, 0 for the whole file, and checks
+// that Slack answered with the file. The caller closes the body.
+func (d fileDownloader) get(ctx context.Context, url string, f slack.File, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.token)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, &retryableFileError{err}
+	}
+	fail := func(err error) (*http.Response, error) {
+		resp.Body.Close()
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode >= 500:
+		return fail(&retryableFileError{fmt.Errorf("Slack answered %s", resp.Status)})
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return fail(&retryableFileError{fmt.Errorf("Slack answered with the wrong range, %q", resp.Header.Get("Content-Range"))})
+		}
+	case resp.StatusCode != http.StatusOK:
+		return fail(fmt.Errorf("Slack answered %s", resp.Status))
+	}
+	// Without access, Slack answers a file link with its sign-in page.
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt == "text/html" && f.Mimetype != "text/html" {
+		return fail(errors.New("Slack answered with a web page instead of the file; the session may have no access to it"))
+	}
+	total := resp.ContentLength
+	if total >= 0 && resp.StatusCode == http.StatusPartialContent {
+		total += offset
+	}
+	if d.max > 0 && total > d.max {
+		return fail(fmt.Errorf("%w: %s is over --max-file-size", errFileSkipped, formatSize(total)))
+	}
+	return resp, nil
+}
+
+// fetchResumable makes one attempt at downloading url to path, through
+// path.part: a part left by an earlier attempt or run is resumed with a
+// Range request, and a failed attempt leaves what it got there. A file
+// that doesn't end up the size Slack reports is thrown away, to be
+// downloaded afresh.
+func (d fileDownloader) fetchResumable(ctx context.Context, url string, f slack.File, path string) (fileState, error) {
+	part := path + partSuffix
+	var offset int64
+	if fi, err := os.Stat(part); err == nil {
+		offset = fi.Size()
+	}
+	if f.Size > 0 && offset > int64(f.Size) {
+		os.Remove(part)
+		offset = 0
+	}
+	// A part of the full size lacks only its rename.
+	if f.Size == 0 || offset < int64(f.Size) {
+		resp, err := d.get(ctx, url, f, offset)
+		if err != nil {
+			return fileState{}, err
+		}
+		defer resp.Body.Close()
+		flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		if resp.StatusCode != http.StatusPartialContent {
+			// Slack sent the whole file.
+			offset, flag = 0, flag|os.O_TRUNC
+		}
+		out, err := os.OpenFile(part, flag, 0o644)
+		if err != nil {
+			return fileState{}, err
+		}
+		body := io.Reader(countingReader{resp.Body})
+		if d.max > 0 {
+			body = io.LimitReader(body, d.max-offset+1)
+		}
+		n, err := io.Copy(out, body)
+		if err == nil {
+			err = out.Sync()
+		}
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return fileState{}, ctx.Err()
+			}
+			return fileState{}, &retryableFileError{err}
+		case d.max > 0 && offset+n > d.max:
+			os.Remove(part)
+			return fileState{}, fmt.Errorf("%w: the file is over --max-file-size", errFileSkipped)
+		case f.Size > 0 && offset+n != int64(f.Size):
+			os.Remove(part)
+			return fileState{}, &retryableFileError{fmt.Errorf("got %d bytes of the %d Slack reports", offset+n, f.Size)}
+		}
+	}
+	if err := os.Rename(part, path); err != nil {
+		return fileState{}, err
+	}
+	syncDir(d.dir)
+	return d.written(path)
+}
+
+// fetch makes one attempt at downloading url to path, atomically and
+// encrypted, with --encrypt-to; it can't be resumed.
+func (d fileDownloader) fetch(ctx context.Context, url string, f slack.File, path string) (fileState, error) {
+	resp, err := d.get(ctx, url, f, 0)
+	if err != nil {
+		return fileState{}, err
+	}
+	defer resp.Body.Close()
+	out, err := createAtomic(path)
+	if err != nil {
+		return fileState{}, err
+	}
+	body := io.Reader(countingReader{resp.Body})
+	if d.max > 0 {
+		body = io.LimitReader(body, d.max+1)
+	}
+	n, err := io.Copy(out, body)
+	switch {
+	case err != nil:
+		out.abort()
+		if ctx.Err() != nil {
+			return fileState{}, ctx.Err()
+		}
+		return fileState{}, &retryableFileError{err}
+	case d.max > 0 && n > d.max:
+		out.abort()
+		return fileState{}, fmt.Errorf("%w: the file is over --max-file-size", errFileSkipped)
+	case f.Size > 0 && n != int64(f.Size):
+		out.abort()
+		return fileState{}, &retryableFileError{fmt.Errorf("got %d bytes of the %d Slack reports", n, f.Size)}
+	}
+	if err := out.commit(); err != nil {
+		return fileState{}, err
+	}
+	return d.checksum(out.path)
+}
+
+// written records the file at path, just downloaded, for the run summary
+// and returns its state.
+func (d fileDownloader) written(path string) (fileState, error) {
+	st, err := d.checksum(path)
+	if err == nil {
+		recordWrite(path, st.Size)
+	}
+	return st, err
+}
+
+// checksum returns the state of the file at path.
+func (d fileDownloader) checksum(path string) (fileState, error) {
+	size, sum, err := hashFile(path)
+	if err != nil {
+		return fileState{}, err
+	}
+	return fileState{Path: filepath.Base(path), Size: size, SHA256: sum}, nil
+}
+
+// countingReader counts the bytes read from r into the progress.
+type countingReader struct{ r io.Reader }
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	progressReporter.FileBytes(n)
+	return n, err
+}
+
+// unsafeNameRe matches what can't go in a file name on some system.
+var unsafeNameRe = regexp.MustCompile(`[\x00-\x1f/\\:*?"<>|]`)
+
+// maxNameBytes bounds the name part of a downloaded file's name, well
+// within the 255 bytes file systems allow.
+const maxNameBytes = 200
+
+// localFileName names a downloaded file <file ID>-<name>: the ID keeps
+// files of the same name apart.
+func localFileName(f slack.File) string {
+	name := unsafeNameRe.ReplaceAllString(cmp.Or(f.Name, f.Title, "file"), "_")
+	if len(name) > maxNameBytes {
+		ext := filepath.Ext(name)
+		if len(ext) > 20 {
+			ext = ""
+		}
+		cut := maxNameBytes - len(ext)
+		for !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = name[:cut] + ext
+	}
+	return f.ID + "-" + name
+}
+
+// addLocalPaths adds local_path to the files of a message's JSON files
+// array that local has a path for, and skipped_by_filter to those it marks
+// filtered.
+func addLocalPaths(value json.RawMessage, local map[string]fileMark) (json.RawMessage, error) {
+	var files []json.RawMessage
+	if err := json.Unmarshal(value, &files); err != nil {
+		return nil, err
+	}
+	for i, f := range files {
+		var file struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(f, &file); err != nil {
+			return nil, err
+		}
+		mark, ok := local[file.ID]
+		if !ok {
+			continue
+		}
+		end := bytes.LastIndexByte(f, '}')
+		if mark.Filtered {
+			files[i] = slices.Concat(f[:end], []byte(`,"`+skippedByFilterField+`":true}`))
+			continue
+		}
+		var p bytes.Buffer
+		if err := encodeJSON(&p, mark.Path, ""); err != nil {
+			return nil, err
+		}
+		files[i] = slices.Concat(f[:end], []byte(`,"`+localPathField+`":`), bytes.TrimSuffix(p.Bytes(), []byte("\n")), []byte("}"))
+	}
+	// Joined by hand: json.Marshal would escape the <, > and & encodeJSON
+	// keeps.
+	var b bytes.Buffer
+	b.WriteByte('[')
+	for i, f := range files {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(f)
+	}
+	b.WriteByte(']')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/auth"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// fileProvider serves files with a plain HTTP client.
+type fileProvider struct{ auth.Provider }
+
+func (fileProvider) SlackToken() string                { return "xoxc-test" }
+func (fileProvider) HTTPClient() (*http.Client, error) { return http.DefaultClient, nil }
+
+func TestDownloadConversationFiles(t *testing.T) {
+	oldOutput, oldRetry, oldCounts := outputFile, fileRetryWait, fileDownloads
+	defer func() { outputFile, fileRetryWait, fileDownloads, maxFileBytes = oldOutput, oldRetry, oldCounts, 0 }()
+	outputFile = filepath.Join(t.TempDir(), "general.json")
+	fileRetryWait = time.Millisecond
+	fileDownloads, maxFileBytes = &fileCounts{}, 1024
+
+	flaky := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxc-test" {
+			http.Error(w, "no token", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/report.pdf":
+			w.Write([]byte("%PDF report"))
+		case "/flaky.txt":
+			if flaky++; flaky < 2 {
+				http.Error(w, "try again", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("second try"))
+		case "/signin":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html>sign in</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	report := slack.File{ID: "F1", Name: "Q3 report/final.pdf", Mimetype: "application/pdf", Size: 11, URLPrivateDownload: srv.URL + "/report.pdf"}
+	conv := &types.Conversation{Messages: []types.Message{
+		{Message: slack.Message{Msg: slack.Msg{Files: []slack.File{
+			report,
+			{ID: "F2", Name: "big.iso", Size: 4096, URLPrivate: srv.URL + "/big.iso"},
+			{ID: "F3", Mode: "tombstone"},
+		}}}},
+		{
+			Message: slack.Message{Msg: slack.Msg{Files: []slack.File{report}}},
+			ThreadReplies: []types.Message{{Message: slack.Message{Msg: slack.Msg{Files: []slack.File{
+				{ID: "F4", Name: "flaky.txt", URLPrivate: srv.URL + "/flaky.txt"},
+				{ID: "F5", Name: "gone.txt", URLPrivate: srv.URL + "/gone.txt"},
+				{ID: "F6", Name: "notes.txt", Mimetype: "text/plain", URLPrivate: srv.URL + "/signin"},
+			}}}}},
+		},
+	}}
+
+	q, err := startFileDownloads(context.Background(), fileProvider{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As the dump finds them, then the whole conversation again: each file
+	// is downloaded once.
+	q.add(conv.Messages[:1])
+	q.add(conv.Messages)
+	local, err := q.wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]fileMark{
+		"F1": {Path: "general.json__files/F1-Q3 report_final.pdf"},
+		"F4": {Path: "general.json__files/F4-flaky.txt"},
+	}
+	if !maps.Equal(local, want) {
+		t.Errorf("local paths = %v, want %v", local, want)
+	}
+	if got, err := os.ReadFile(filepath.Join(filepath.Dir(outputFile), want["F4"].Path)); err != nil || string(got) != "second try" {
+		t.Errorf("flaky.txt = %q, %v; want the retried download", got, err)
+	}
+	wantCounts := fileCounts{Downloaded: 2, Skipped: 2, SkippedBy: map[string]int{skippedBySize: 1, skippedDeleted: 1}, Failed: 2}
+	if !reflect.DeepEqual(*fileDownloads, wantCounts) {
+		t.Errorf("counts = %+v, want 2 downloaded, 2 skipped by size and deletion, 2 failed", *fileDownloads)
+	}
+}
+
+func TestFileQueueConcurrency(t *testing.T) {
+	oldOutput, oldCounts, oldConcurrency := outputFile, fileDownloads, downloadConcurrency
+	defer func() { outputFile, fileDownloads, downloadConcurrency = oldOutput, oldCounts, oldConcurrency }()
+	outputFile = filepath.Join(t.TempDir(), "general.json")
+	fileDownloads, downloadConcurrency = &fileCounts{}, 3
+
+	// Each request waits until three are in flight, so the downloads only
+	// finish if the workers run at once.
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	all := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		if inFlight == 3 {
+			close(all)
+		}
+		mu.Unlock()
+		select {
+		case <-all:
+		case <-time.After(5 * time.Second):
+		}
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	var msgs []types.Message
+	for i := range 6 {
+		id := fmt.Sprintf("F%d", i)
+		msgs = append(msgs, types.Message{Message: slack.Message{Msg: slack.Msg{Files: []slack.File{{ID: id, Name: id + ".txt", URLPrivate: srv.URL + "/" + id}}}}})
+	}
+	q, err := startFileDownloads(context.Background(), fileProvider{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.add(msgs)
+	local, err := q.wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(local) != 6 || peak != 3 {
+		t.Errorf("downloaded %d files with %d at once, want 6 with 3", len(local), peak)
+	}
+}
+
+// yieldingProvider is a fileProvider whose API is backing off until
+// resume is closed.
+type yieldingProvider struct {
+	fileProvider
+	resume chan struct{}
+}
+
+func (p yieldingProvider) YieldToAPI(ctx context.Context) error {
+	select {
+	case <-p.resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestFileQueueYieldsToAPI(t *testing.T) {
+	oldOutput, oldCounts := outputFile, fileDownloads
+	defer func() { outputFile, fileDownloads = oldOutput, oldCounts }()
+	outputFile = filepath.Join(t.TempDir(), "general.json")
+	fileDownloads = &fileCounts{}
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("report"))
+	}))
+	defer srv.Close()
+
+	prov := yieldingProvider{resume: make(chan struct{})}
+	q, err := startFileDownloads(context.Background(), prov)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.add([]types.Message{{Message: slack.Message{Msg: slack.Msg{Files: []slack.File{{ID: "F1", Name: "report.txt", URLPrivate: srv.URL + "/F1"}}}}}})
+	time.Sleep(50 * time.Millisecond)
+	if n := requests.Load(); n != 0 {
+		t.Fatalf("%d downloads started while the API backs off, want none", n)
+	}
+	close(prov.resume)
+	local, err := q.wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(local) != 1 || requests.Load() != 1 {
+		t.Errorf("downloaded %d files in %d requests once the API resumed, want 1 in 1", len(local), requests.Load())
+	}
+}
+
+func TestFileQueueCancel(t *testing.T) {
+	oldOutput, oldCounts := outputFile, fileDownloads
+	defer func() { outputFile, fileDownloads = oldOutput, oldCounts }()
+	outputFile = filepath.Join(t.TempDir(), "general.json")
+	fileDownloads = &fileCounts{}
+
+	started := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q, err := startFileDownloads(ctx, fileProvider{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.add([]types.Message{{Message: slack.Message{Msg: slack.Msg{Files: []slack.File{{ID: "F1", Name: "slow.bin", URLPrivate: srv.URL + "/slow"}}}}}})
+	<-started
+	cancel()
+	if _, err := q.wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait() = %v, want context.Canceled", err)
+	}
+	if !reflect.DeepEqual(*fileDownloads, fileCounts{}) {
+		t.Errorf("counts = %+v, want a cancelled download left uncounted", *fileDownloads)
+	}
+}
+
+func TestFilesResume(t *testing.T) {
+	oldOutput, oldCounts := outputFile, fileDownloads
+	defer func() { outputFile, fileDownloads = oldOutput, oldCounts }()
+	outputFile = filepath.Join(t.TempDir(), "general.json")
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	var mu sync.Mutex
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "big.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+	conv := []types.Message{{Message: slack.Message{Msg: slack.Msg{Files: []slack.File{
+		{ID: "F1", Name: "big.bin", Size: len(content), URLPrivate: srv.URL + "/big.bin"},
+	}}}}}
+	dir, path := filesDir(), filepath.Join(filesDir(), "F1-big.bin")
+	run := func() fileCounts {
+		t.Helper()
+		fileDownloads = &fileCounts{}
+		q, err := startFileDownloads(context.Background(), fileProvider{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.add(conv)
+		if _, err := q.wait(); err != nil {
+			t.Fatal(err)
+		}
+		return *fileDownloads
+	}
+
+	// An interrupted download left the first 4000 bytes.
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+partSuffix, content[:4000], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := run(); !reflect.DeepEqual(got, fileCounts{Downloaded: 1}) || !slices.Equal(ranges, []string{"bytes=4000-"}) {
+		t.Fatalf("resuming: counts %+v, requests %q; want one download of bytes=4000-", got, ranges)
+	}
+	if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("resumed file = %d bytes, %v; want the whole file", len(got), err)
+	}
+	if _, err := os.Stat(path + partSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the part is left: %v", err)
+	}
+
+	if got := run(); !reflect.DeepEqual(got, fileCounts{Kept: 1}) || len(ranges) != 1 {
+		t.Errorf("again: counts %+v after %d requests, want the file kept", got, len(ranges))
+	}
+	var out bytes.Buffer
+	if err := verifyDownloadedFiles(&out); err != nil || out.String() != "OK      F1-big.bin\n" {
+		t.Errorf("verifying: %q, %v", out.String(), err)
+	}
+
+	// The same size with other bytes passes for kept, but not verified.
+	corrupt := slices.Clone(content)
+	corrupt[0] = 'x'
+	if err := os.WriteFile(path, corrupt, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := verifyDownloadedFiles(&out); err == nil || out.String() != "FAILED  F1-big.bin: SHA-256 doesn't match\n" {
+		t.Errorf("verifying a corrupted file: %q, %v", out.String(), err)
+	}
+	// A file cut short is downloaded again.
+	if err := os.WriteFile(path, content[:10], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := run(); !reflect.DeepEqual(got, fileCounts{Downloaded: 1}) || len(ranges) != 2 || ranges[1] != "" {
+		t.Errorf("after truncating: counts %+v, requests %q; want a whole download", got, ranges)
+	}
+}
+
+func TestEncodeLocalPaths(t *testing.T) {
+	conv := &types.Conversation{Messages: []types.Message{{Message: slack.Message{Msg: slack.Msg{
+		Timestamp: "1700000000.000100",
+		Files:     []slack.File{{ID: "F1", Name: "a&b.txt"}, {ID: "F2", Name: "skipped.iso"}},
+	}}}}}
+	doc := buildOutput(conv, encodeOptions{localFiles: map[string]fileMark{"F1": {Path: "out.json__files/F1-a&b.txt"}, "F2": {Filtered: true}}, fields: map[string]bool{"ts": true, "files": true}})
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, doc, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"local_path":"out.json__files/F1-a&b.txt"`) {
+		t.Errorf("output lacks the local path:\n%s", buf.String())
+	}
+	var out struct {
+		Messages []struct {
+			Files []map[string]any `json:"files"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	files := out.Messages[0].Files
+	if files[0]["local_path"] != "out.json__files/F1-a&b.txt" || files[0]["name"] != "a&b.txt" || files[1]["local_path"] != nil || files[1]["skipped_by_filter"] != true {
+		t.Errorf("files = %v, want a local_path on F1 and F2 marked skipped_by_filter", files)
+	}
+}
+
+func TestCheckFilesFlags(t *testing.T) {
+	oldFiles, oldMax, oldOutput, oldFormat, oldConcurrency := downloadFiles, maxFileSize, outputFile, outputFormat, downloadConcurrency
+	defer func() {
+		downloadFiles, maxFileSize, outputFile, outputFormat, downloadConcurrency = oldFiles, oldMax, oldOutput, oldFormat, oldConcurrency
+		fileDownloads, maxFileBytes = nil, 0
+	}()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "old.json__files"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "old.json__files", "F1-a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		files       bool
+		max         string
+		output      string
+		format      string
+		concurrency int
+		wantMax     int64
+		wantErr     string
+	}{
+		{format: "json"},
+		{files: true, output: filepath.Join(dir, "a.json"), format: "json"},
+		{files: true, max: "1.5MB", output: filepath.Join(dir, "a.json"), format: "json", wantMax: 1572864},
+		{files: true, max: "500", output: filepath.Join(dir, "a.json"), format: "json", wantMax: 500},
+		{max: "25MB", format: "json", wantErr: "requires --files"},
+		{files: true, format: "json", wantErr: "requires -o"},
+		{files: true, output: filepath.Join(dir, "a.csv"), format: "csv", wantErr: "only applies to --format json"},
+		// --format html inlines the avatars, to stdout too.
+		{files: true, format: "html"},
+		{files: true, max: "25MB", format: "html", wantErr: "--format html doesn't"},
+		{files: true, max: "lots", output: filepath.Join(dir, "a.json"), format: "json", wantErr: "--max-file-size"},
+		// The files of an earlier run are kept, not overwritten.
+		{files: true, output: filepath.Join(dir, "old.json"), format: "json"},
+		{files: true, output: filepath.Join(dir, "a.json"), format: "json", concurrency: -1, wantErr: "--download-concurrency"},
+	}
+	for _, tt := range tests {
+		downloadFiles, maxFileSize, outputFile, outputFormat = tt.files, tt.max, tt.output, tt.format
+		downloadConcurrency = cmp.Or(tt.concurrency, 4)
+		err := checkFilesFlags()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%+v: checkFilesFlags() = %v, want error %q", tt, err, tt.wantErr)
+		}
+		if err == nil && maxFileBytes != tt.wantMax {
+			t.Errorf("%+v: max = %d, want %d", tt, maxFileBytes, tt.wantMax)
+		}
+	}
+}
+
+func TestFilesFilters(t *testing.T) {
+	oldOutput, oldCounts, oldInclude, oldExclude := outputFile, fileDownloads, filesInclude, filesExclude
+	defer func() {
+		outputFile, fileDownloads, filesInclude, filesExclude = oldOutput, oldCounts, oldInclude, oldExclude
+	}()
+	outputFile = filepath.Join(t.TempDir(), "general.json")
+	fileDownloads = &fileCounts{}
+	filesInclude, filesExclude = []string{"PDF", ".docx", "image/*"}, []string{"image/gif"}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data"))
+	}))
+	defer srv.Close()
+	files := []slack.File{
+		{ID: "F1", Name: "report.pdf", Filetype: "pdf", Mimetype: "application/pdf"},
+		{ID: "F2", Name: "notes.DOCX"},
+		{ID: "F3", Name: "photo.png", Mimetype: "image/png"},
+		{ID: "F4", Name: "party.gif", Mimetype: "image/gif"},
+		{ID: "F5", Name: "talk.mp4", Mimetype: "video/mp4"},
+	}
+	for i := range files {
+		files[i].URLPrivate = srv.URL + "/" + files[i].Name
+	}
+
+	q, err := startFileDownloads(context.Background(), fileProvider{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.add([]types.Message{{Message: slack.Message{Msg: slack.Msg{Files: files}}}})
+	local, err := q.wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, filtered := range map[string]bool{"F1": false, "F2": false, "F3": false, "F4": true, "F5": true} {
+		if local[id].Filtered != filtered || (local[id].Path == "") != filtered {
+			t.Errorf("%s: %+v, want filtered %v", id, local[id], filtered)
+		}
+	}
+	want := fileCounts{Downloaded: 3, Skipped: 2, SkippedBy: map[string]int{skippedByFilter: 2}}
+	if !reflect.DeepEqual(*fileDownloads, want) {
+		t.Errorf("counts = %+v, want %+v", *fileDownloads, want)
+	}
+
+	var out strings.Builder
+	if err := writeSummary(&out, runSummary{Artifacts: []artifact{}, Downloads: fileDownloads}, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "files: 3 downloaded, 2 skipped (2 filter), 0 failed") {
+		t.Errorf("summary = %q", out.String())
+	}
+}
+
+func TestCheckFilesFilterFlags(t *testing.T) {
+	oldFiles, oldOutput, oldFormat, oldInclude, oldExclude := downloadFiles, outputFile, outputFormat, filesInclude, filesExclude
+	defer func() {
+		downloadFiles, outputFile, outputFormat, filesInclude, filesExclude = oldFiles, oldOutput, oldFormat, oldInclude, oldExclude
+		fileDownloads, maxFileBytes = nil, 0
+	}()
+	outputFile, outputFormat = filepath.Join(t.TempDir(), "a.json"), "json"
+	tests := []struct {
+		files            bool
+		include, exclude []string
+		wantErr          string
+	}{
+		{files: true, include: []string{"pdf", "image/*"}, exclude: []string{".gif"}},
+		{include: []string{"pdf"}, wantErr: "--files-include requires --files"},
+		{exclude: []string{"pdf"}, wantErr: "--files-exclude requires --files"},
+		{files: true, include: []string{"."}, wantErr: "not empty patterns"},
+		{files: true, exclude: []string{"image/[png"}, wantErr: "syntax error"},
+	}
+	for _, tt := range tests {
+		downloadFiles, filesInclude, filesExclude = tt.files, tt.include, tt.exclude
+		err := checkFilesFlags()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%+v: checkFilesFlags() = %v, want error %q", tt, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wham/gh-slackdump/internal/format"
+)
+
+// writeGitHubMarkdown writes doc as --format gh-markdown, in parts that fit
+// in a GitHub comment: part-01.md, part-02.md, … in dir, or to stdout
+// without -o, where the conversation must fit in one. Each part's header
+// links source, the Slack link it was dumped from.
+func writeGitHubMarkdown(dir, source string, doc *outConversation) error {
+	parts := gitHubMarkdownParts(source, doc)
+	if dir == "" {
+		if len(parts) > 1 {
+			return fmt.Errorf("--format gh-markdown: the conversation takes %d GitHub comments; write them to a directory with -o", len(parts))
+		}
+		_, err := writeOutputTo("", func(w io.Writer) error {
+			_, err := io.WriteString(w, parts[0])
+			return err
+		})
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for i, p := range parts {
+		if err := writeFileAtomic(filepath.Join(dir, gitHubPartName(i)), func(w io.Writer) error {
+			_, err := io.WriteString(w, p)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	slog.Info("output written", "dir", dir, "parts", len(parts))
+	return nil
+}
+
+// writeGitHubMarkdownSplit writes doc as --format gh-markdown split by
+// spec's period into dir: a file per period, 2024-01-15.md, numbered like
+// 2024-01-15.0002.md when the period takes more than one GitHub comment,
+// and then the index.
+func writeGitHubMarkdownSplit(dir, source string, doc *outConversation, spec splitSpec) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	index := splitIndex{SplitBy: spec.String(), Format: outputFormat, Files: []splitChunk{}}
+	for _, p := range splitParts(dir, outputFormat, doc.Messages, spec) {
+		period := *doc
+		period.Messages = p.msgs
+		parts := gitHubMarkdownParts(source, &period)
+		chunk := describeChunk(filepath.Base(p.path), p.msgs)
+		for i, part := range parts {
+			path := p.path
+			if len(parts) > 1 {
+				path = chunkPath(p.path, i+1)
+				chunk.Parts = append(chunk.Parts, filepath.Base(path))
+			}
+			if err := writeFileAtomic(path, func(w io.Writer) error {
+				_, err := io.WriteString(w, part)
+				return err
+			}); err != nil {
+				return err
+			}
+		}
+		if len(parts) > 1 {
+			chunk.File = chunk.Parts[0]
+		}
+		index.Files = append(index.Files, chunk)
+	}
+	if err := writeSplitIndex(spec.indexPath(dir), &index); err != nil {
+		return err
+	}
+	slog.Info("output written", "dir", dir, "files", len(index.Files), "index", spec.indexPath(dir))
+	return nil
+}
+
+// gitHubMarkdownParts renders doc as the parts of --format gh-markdown.
+func gitHubMarkdownParts(source string, doc *outConversation) []string {
+	conv := doc.Conversation
+	conv.Messages = plainMessages(doc.Messages)
+	return format.GitHubMarkdown(conv, format.GitHubOptions{Source: source, Workspace: outputOptions.permalinks, CustomEmoji: outputOptions.customEmoji, Posture: doc.Channel.posture(), RawTS: showRawTS, Matches: outputOptions.grepMatches})
+}
+
+// gitHubPartName is the file name of the i-th part, from 0.
+func gitHubPartName(i int) string {
+	return fmt.Sprintf("part-%02d.md", i+1)
+}
+
+// conversationLink returns the Slack link of a dumped conversation, made
+// from the workspace, the channel and, for a thread, its ts; "" when the
+// workspace isn't known.
+func conversationLink(workspace, channel, threadTS string) string {
+	switch {
+	case workspace == "":
+		return ""
+	case threadTS != "":
+		return format.Permalink(workspace, channel, threadTS, "")
+	}
+	return strings.TrimSuffix(workspace, "/") + "/archives/" + channel
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cli/go-gh/v2/pkg/api"
+)
+
+// gistFileLimit is the most bytes put in one file of a gist: GitHub serves
+// larger files only through git. Larger outputs are split across files.
+const gistFileLimit = 10 << 20
+
+// gistMaxFiles is the most files a gist created through the API can hold.
+const gistMaxFiles = 300
+
+// gistTempStem names the output written for --gist without -o, in a
+// temporary directory; its files are named after the channel in the gist.
+const gistTempStem = "output"
+
+// gistTempDir, when set, is the temporary directory --gist without -o
+// writes the output to.
+var gistTempDir string
+
+type gistFile struct {
+	Content string `json:"content"`
+}
+
+type gistRequest struct {
+	Description string              `json:"description"`
+	Public      bool                `json:"public"`
+	Files       map[string]gistFile `json:"files"`
+}
+
+// gistCreator creates gists as the gh user.
+type gistCreator struct {
+	rest *api.RESTClient
+	// apiBase prefixes REST paths; empty means the gh host's API.
+	apiBase string
+}
+
+// newGistCreator returns a creator authenticated with the gh token.
+func newGistCreator() (*gistCreator, error) {
+	rest, err := api.DefaultRESTClient()
+	if err != nil {
+		return nil, err
+	}
+	return &gistCreator{rest: rest}, nil
+}
+
+// create creates a gist of files and returns its URL.
+func (c *gistCreator) create(ctx context.Context, req gistRequest) (string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	var gist struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := c.rest.DoWithContext(ctx, http.MethodPost, c.apiBase+"gists", bytes.NewReader(body), &gist); err != nil {
+		return "", err
+	}
+	return gist.HTMLURL, nil
+}
+
+// setGistOutput points -o at a temporary directory for --gist without -o:
+// the directory itself for the formats that write one, else a file in it
+// with the format's extension. An interrupted run removes the directory
+// (pendingFiles).
+func setGistOutput(digest bool) error {
+	dir, err := os.MkdirTemp("", "gh-slackdump-gist-")
+	if err != nil {
+		return err
+	}
+	trackTemp(dir)
+	gistTempDir = dir
+	if writesDirectory() {
+		outputFile = dir
+		return nil
+	}
+	ext := map[string]string{"json": ".json", "html": ".html", "csv": ".csv", "text": ".txt", "ndjson": ".ndjson", "mattermost": ".jsonl"}[outputFormat]
+	switch {
+	case digest:
+		ext = ".md"
+	case templateFile != "" || templateString != "":
+		ext = ".txt"
+	}
+	outputFile = filepath.Join(dir, gistTempStem+ext)
+	return nil
+}
+
+// gistFiles reads the written files for a gist, named by their path in the
+// -o directory, with "-" for "/", or by their base name; a temporary
+// output's by the channel. Files over gistFileLimit are split between lines
+// into numbered files, as --split-by names them.
+func gistFiles(paths []string, channel string) (map[string]gistFile, error) {
+	files := make(map[string]gistFile)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(data) {
+			return nil, fmt.Errorf("%s isn't text, which a gist needs", path)
+		}
+		name := filepath.Base(path)
+		if writesDirectory() {
+			if rel, err := filepath.Rel(outputFile, path); err == nil {
+				name = strings.ReplaceAll(filepath.ToSlash(rel), "/", "-")
+			}
+		} else if gistTempDir != "" {
+			name = strings.Replace(name, gistTempStem, cmp.Or(channel, "slack"), 1)
+		}
+		pieces := splitGistContent(string(data), gistFileLimit)
+		for i, p := range pieces {
+			n := name
+			if len(pieces) > 1 {
+				n = chunkPath(name, i+1)
+			}
+			files[n] = gistFile{Content: p}
+		}
+	}
+	if len(files) > gistMaxFiles {
+		return nil, fmt.Errorf("the output takes %d gist files, more than the %d a gist holds", len(files), gistMaxFiles)
+	}
+	return files, nil
+}
+
+// splitGistContent cuts s into pieces of at most n bytes, between lines
+// where it can and between characters where a line is longer.
+func splitGistContent(s string, n int) []string {
+	var out []string
+	for len(s) > n {
+		cut := strings.LastIndexByte(s[:n], '\n') + 1
+		if cut <= 0 {
+			cut = n
+			for cut > 0 && !utf8.RuneStart(s[cut]) {
+				cut--
+			}
+		}
+		out = append(out, s[:cut])
+		s = s[cut:]
+	}
+	return append(out, s)
+}
+
+// gistDescription names a gist after the channel and the days of its
+// messages, from the run's stats.
+func gistDescription(channel string, stats *dumpStats) string {
+	desc := cmp.Or(channel, "Slack thread digest")
+	if stats == nil || stats.From == nil || stats.To == nil {
+		return desc
+	}
+	from, to := stats.From.UTC().Format(time.DateOnly), stats.To.UTC().Format(time.DateOnly)
+	if from == to {
+		return desc + ", " + from
+	}
+	return desc + ", " + from + " to " + to
+}
+
+// publishGist creates a gist of the files the run wrote, printing its URL.
+// The -o output is left in place when that fails. Gists hold text, so the
+// files downloaded with --files stay out.
+func publishGist(ctx context.Context) error {
+	var paths []string
+	writtenFiles.Lock()
+	for _, f := range writtenFiles.files {
+		if f.path != "" && f.path != anonymizeMapPath() && !(downloadsAttachments() && inDir(filesDir(), f.path)) {
+			paths = append(paths, f.path)
+		}
+	}
+	writtenFiles.Unlock()
+	if len(paths) == 0 {
+		return errors.New("--gist: nothing was written")
+	}
+	channel := dumpChannelName(ctx)
+	files, err := gistFiles(paths, channel)
+	if err != nil {
+		return fmt.Errorf("--gist: %w", err)
+	}
+	c, err := newGistCreator()
+	if err != nil {
+		return err
+	}
+	if channel != dumpChannel {
+		channel = "#" + channel
+	}
+	url, err := c.create(ctx, gistRequest{Description: gistDescription(channel, runStats), Public: gistPublic, Files: files})
+	if err != nil {
+		if gistTempDir == "" {
+			return fmt.Errorf("creating the gist: %w; the output is still in %s", err, outputFile)
+		}
+		return fmt.Errorf("creating the gist: %w", err)
+	}
+	slog.Info("created gist", "url", url, "files", len(files), "public", gistPublic)
+	fmt.Println(url)
+	return nil
+}
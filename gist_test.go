@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cli/go-gh/v2/pkg/api"
+)
+
+func TestGistCreatorCreate(t *testing.T) {
+	var got gistRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/gists" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "token secret" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"html_url":"https://gist.github.com/abc"}`))
+	}))
+	defer srv.Close()
+	rest, err := api.NewRESTClient(api.ClientOptions{Host: "127.0.0.1", AuthToken: "secret", Transport: http.DefaultTransport, LogIgnoreEnv: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &gistCreator{rest: rest, apiBase: srv.URL + "/"}
+
+	req := gistRequest{Description: "#general, 2024-01-01", Files: map[string]gistFile{"general.json": {Content: "{}"}}}
+	url, err := c.create(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://gist.github.com/abc" {
+		t.Errorf("url = %q", url)
+	}
+	if got.Description != req.Description || got.Public || got.Files["general.json"].Content != "{}" {
+		t.Errorf("request = %+v, want %+v", got, req)
+	}
+}
+
+func TestGistFiles(t *testing.T) {
+	t.Cleanup(func() { outputFile, outputFormat, gistTempDir = "", "json", "" })
+	dir := t.TempDir()
+	small := filepath.Join(dir, "output.csv")
+	big := filepath.Join(dir, "big.ndjson")
+	line := strings.Repeat("x", 1023) + "\n"
+	if err := os.WriteFile(small, []byte("ts,text\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(big, []byte(strings.Repeat(line, gistFileLimit/len(line)+10)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outputFile, outputFormat, gistTempDir = small, "csv", dir
+
+	files, err := gistFiles([]string{small, big}, "general")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := files["general.csv"]; !ok {
+		t.Errorf("the temporary output isn't named after the channel: %v", slices.Sorted(maps.Keys(files)))
+	}
+	first, second := files["big.0001.ndjson"].Content, files["big.0002.ndjson"].Content
+	if len(first) > gistFileLimit || !strings.HasSuffix(first, "\n") || len(second) != 10*len(line) {
+		t.Errorf("big file split into %d and %d bytes, want a full file and 10 lines (files %v)", len(first), len(second), slices.Sorted(maps.Keys(files)))
+	}
+
+	if err := os.WriteFile(small, []byte{0x1f, 0x8b, 0xff}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gistFiles([]string{small}, "general"); err == nil || !strings.Contains(err.Error(), "isn't text") {
+		t.Errorf("binary file: error = %v", err)
+	}
+}
+
+func TestGistDescription(t *testing.T) {
+	from := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 31, 17, 0, 0, 0, time.UTC)
+	tests := []struct {
+		channel string
+		stats   *dumpStats
+		want    string
+	}{
+		{"#general", &dumpStats{From: &from, To: &to}, "#general, 2024-01-01 to 2024-01-31"},
+		{"#general", &dumpStats{From: &from, To: &from}, "#general, 2024-01-01"},
+		{"#general", nil, "#general"},
+		{"", &dumpStats{From: &from, To: &to}, "Slack thread digest, 2024-01-01 to 2024-01-31"},
+	}
+	for _, tt := range tests {
+		if got := gistDescription(tt.channel, tt.stats); got != tt.want {
+			t.Errorf("gistDescription(%q) = %q, want %q", tt.channel, got, tt.want)
+		}
+	}
+}
+
+func TestSetGistOutputInterrupted(t *testing.T) {
+	t.Cleanup(func() { outputFile, outputFormat, gistTempDir = "", "json", "" })
+	outputFormat = "json"
+	if err := setGistOutput(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(outputFile, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	removeTempFiles()
+	if _, err := os.Stat(gistTempDir); !os.IsNotExist(err) {
+		t.Errorf("--gist directory %s left behind after an interrupt: %v", gistTempDir, err)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/grep"
+)
+
+var (
+	grepPatterns []string
+	grepLogic    string
+)
+
+// messageGrep selects the messages written with --grep, nil without;
+// checkGrepFlags sets it.
+var messageGrep *grep.Matcher
+
+// checkGrepFlags sets messageGrep from --grep and --grep-logic.
+func checkGrepFlags() error {
+	messageGrep = nil
+	logic, err := grep.ParseLogic(cmp.Or(grepLogic, string(grep.Any)))
+	if err != nil {
+		return fmt.Errorf("--grep-logic: %w", err)
+	}
+	if len(grepPatterns) == 0 {
+		if logic != grep.Any {
+			return errors.New("--grep-logic combines --grep patterns, and none is given")
+		}
+		return nil
+	}
+	switch {
+	case outputFormat == "ndjson":
+		return errors.New("--grep can't be combined with --format ndjson, which writes messages as they are fetched")
+	case sinceLast:
+		return errors.New("--grep can't be combined with --since-last-message, which rewrites the -o file with every message")
+	}
+	m, err := grep.New(grepPatterns, logic)
+	if err != nil {
+		return fmt.Errorf("--grep: %w", err)
+	}
+	messageGrep = m
+	return nil
+}
+
+// grepConversation keeps the messages of conv that match --grep, with the
+// thread replies that do; a parent that doesn't match is kept as the
+// context of its matching replies. It returns the labels of the patterns
+// each matching message matched, by ts, nil without --grep.
+func grepConversation(conv *types.Conversation) map[string][]string {
+	if messageGrep == nil {
+		return nil
+	}
+	matches := make(map[string][]string)
+	var keep func(msgs []types.Message) []types.Message
+	keep = func(msgs []types.Message) []types.Message {
+		var kept []types.Message
+		for _, m := range msgs {
+			m.ThreadReplies = keep(m.ThreadReplies)
+			labels, ok := messageGrep.Match(grepTexts(m)...)
+			if ok {
+				matches[m.Timestamp] = labels
+			}
+			if ok || len(m.ThreadReplies) > 0 {
+				kept = append(kept, m)
+			}
+		}
+		return kept
+	}
+	conv.Messages = keep(conv.Messages)
+	if conv.Messages == nil {
+		conv.Messages = []types.Message{}
+	}
+	return matches
+}
+
+// grepTexts returns the text --grep searches in m: its own and that of its
+// attachments, such as shared messages and link previews.
+func grepTexts(m types.Message) []string {
+	texts := []string{m.Text}
+	for _, a := range m.Attachments {
+		texts = append(texts, a.Pretext, a.Title, a.Text, a.Fallback)
+	}
+	return texts
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func textMsg(ts, text string, replies ...types.Message) types.Message {
+	m := msg(ts, replies...)
+	m.Text = text
+	return m
+}
+
+// withGrep runs checkGrepFlags with patterns and logic, restoring the flags
+// at the end of the test.
+func withGrep(t *testing.T, logic string, patterns ...string) {
+	t.Helper()
+	oldPatterns, oldLogic, oldFormat := grepPatterns, grepLogic, outputFormat
+	t.Cleanup(func() { grepPatterns, grepLogic, outputFormat, messageGrep = oldPatterns, oldLogic, oldFormat, nil })
+	grepPatterns, grepLogic, outputFormat = patterns, logic, "json"
+	if err := checkGrepFlags(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func grepConv() *types.Conversation {
+	return &types.Conversation{Messages: []types.Message{
+		textMsg("1.000100", "payment_id=42 failed"),
+		textMsg("2.000100", "lunch?"),
+		textMsg("3.000100", "incident thread",
+			textMsg("3.000200", "refund for payment_id=7 issued"),
+			textMsg("3.000300", "thanks"),
+		),
+		{Message: slack.Message{Msg: slack.Msg{Timestamp: "4.000100", Text: "fyi", Attachments: []slack.Attachment{{Text: "Refund policy"}}}}},
+	}}
+}
+
+func TestGrepConversation(t *testing.T) {
+	tests := []struct {
+		logic   string
+		kept    []string
+		matches map[string][]string
+	}{
+		{"any", []string{"1.000100", "3.000100", "3.000200", "4.000100"}, map[string][]string{
+			"1.000100": {"payment"},
+			"3.000200": {"payment", "refund"},
+			"4.000100": {"refund"},
+		}},
+		// The incident thread stays as the context of its matching reply.
+		{"all", []string{"3.000100", "3.000200"}, map[string][]string{
+			"3.000200": {"payment", "refund"},
+		}},
+	}
+	for _, tt := range tests {
+		withGrep(t, tt.logic, `payment:payment_id=\d+`, `refund:(?i)refund`)
+		conv := grepConv()
+		matches := grepConversation(conv)
+		var kept []string
+		for _, m := range conv.Messages {
+			kept = append(kept, m.Timestamp)
+			for _, r := range m.ThreadReplies {
+				kept = append(kept, r.Timestamp)
+			}
+		}
+		if !slices.Equal(kept, tt.kept) {
+			t.Errorf("%s: kept %v, want %v", tt.logic, kept, tt.kept)
+		}
+		if len(matches) != len(tt.matches) {
+			t.Errorf("%s: matches = %v, want %v", tt.logic, matches, tt.matches)
+		}
+		for ts, want := range tt.matches {
+			if !slices.Equal(matches[ts], want) {
+				t.Errorf("%s: matches[%s] = %v, want %v", tt.logic, ts, matches[ts], want)
+			}
+		}
+	}
+}
+
+func TestGrepConversationNone(t *testing.T) {
+	withGrep(t, "any", "nothing-matches-this")
+	conv := grepConv()
+	grepConversation(conv)
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, buildOutput(conv, encodeOptions{}), ""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"messages":[]`) {
+		t.Errorf("no match encodes as %s, want an empty messages array", buf.String())
+	}
+}
+
+func TestGrepMatchesJSON(t *testing.T) {
+	withGrep(t, "any", `payment:payment_id=\d+`, `refund`)
+	conv := grepConv()
+	out := buildOutput(conv, encodeOptions{grepMatches: grepConversation(conv)})
+	data, err := json.Marshal(out.Messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []struct {
+		TS      string   `json:"ts"`
+		Matches []string `json:"matches"`
+		Replies []struct {
+			TS      string   `json:"ts"`
+			Matches []string `json:"matches"`
+		} `json:"slackdump_thread_replies"`
+	}
+	if err := json.Unmarshal(data, &msgs); err != nil {
+		t.Fatal(err)
+	}
+	// Patterns are case-sensitive unless they say otherwise: the
+	// attachment's "Refund" doesn't match.
+	if len(msgs) != 2 {
+		t.Fatalf("kept %d messages, want 2", len(msgs))
+	}
+	if !slices.Equal(msgs[0].Matches, []string{"payment"}) {
+		t.Errorf("matches = %v, want [payment]", msgs[0].Matches)
+	}
+	if parent := msgs[1]; parent.Matches != nil || !slices.Equal(parent.Replies[0].Matches, []string{"payment", "refund"}) {
+		t.Errorf("thread = %+v, want matches on the reply only", parent)
+	}
+}
+
+func TestCheckGrepFlags(t *testing.T) {
+	defer func(p []string, l, f string, s bool) {
+		grepPatterns, grepLogic, outputFormat, sinceLast, messageGrep = p, l, f, s, nil
+	}(grepPatterns, grepLogic, outputFormat, sinceLast)
+	tests := []struct {
+		patterns []string
+		logic    string
+		format   string
+		since    bool
+		want     string
+	}{
+		{nil, "any", "json", false, ""},
+		{nil, "all", "json", false, "none is given"},
+		{[]string{"a"}, "or", "json", false, "--grep-logic"},
+		{[]string{"("}, "any", "json", false, "--grep"},
+		{[]string{"x:a", "x:b"}, "any", "json", false, "taken"},
+		{[]string{"a"}, "any", "ndjson", false, "ndjson"},
+		{[]string{"a"}, "any", "json", true, "--since-last-message"},
+		{[]string{"a", "b"}, "all", "gh-markdown", false, ""},
+	}
+	for _, tt := range tests {
+		grepPatterns, grepLogic, outputFormat, sinceLast = tt.patterns, tt.logic, tt.format, tt.since
+		err := checkGrepFlags()
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("checkGrepFlags(%q, %s, %s) error: %v", tt.patterns, tt.logic, tt.format, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("checkGrepFlags(%q, %s, %s) = %v, want an error about %s", tt.patterns, tt.logic, tt.format, err, tt.want)
+		}
+	}
+}
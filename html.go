@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/format"
+)
+
+// writeHTML writes doc as --format html: to stdout as one page, or to path
+// and, above pageSize top-level messages, further pages numbered like split
+// files (general.html, general.0002.html, ...) linked to each other.
+// avatars maps users to avatar URLs and may be nil; images, from
+// inlineAvatars, holds the avatars shown inline.
+func writeHTML(path string, doc *outConversation, pageSize int, avatars, images map[string]string) error {
+	conv := doc.Conversation
+	conv.Messages = plainMessages(doc.Messages)
+	target := linkTargetTS(doc.Messages)
+	var topic string
+	if doc.Channel != nil {
+		topic = format.PlainText(doc.Channel.Topic)
+	}
+	if path == "" {
+		_, err := writeOutputTo("", func(w io.Writer) error {
+			return format.WriteHTML(w, format.HTMLPage{Conversation: conv, Number: 1, Total: 1, Avatars: avatars, Images: images, Target: target, Topic: topic, Workspace: outputOptions.permalinks, CustomEmoji: outputOptions.customEmoji, RawTS: showRawTS})
+		})
+		return err
+	}
+
+	pages := format.Paginate(conv.Messages, pageSize)
+	var size outputSize
+	for i, msgs := range pages {
+		page := format.HTMLPage{Conversation: conv, Number: i + 1, Total: len(pages), Avatars: avatars, Images: images, Target: target, Topic: topic, Workspace: outputOptions.permalinks, CustomEmoji: outputOptions.customEmoji, RawTS: showRawTS}
+		page.Conversation.Messages = msgs
+		if i > 0 {
+			page.Prev = filepath.Base(htmlPagePath(path, i))
+		}
+		if i+1 < len(pages) {
+			page.Next = filepath.Base(htmlPagePath(path, i+2))
+		}
+		pageSize, err := writeOutputTo(htmlPagePath(path, i+1), func(w io.Writer) error {
+			return format.WriteHTML(w, page)
+		})
+		if err != nil {
+			return err
+		}
+		size = size.add(pageSize)
+	}
+	slog.Info("output written", "file", path, "pages", len(pages), "size", size)
+	return nil
+}
+
+// maxAvatarSize caps the size of an avatar image inlined into an HTML page.
+// Slack's are 72 pixels square and a few KB.
+const maxAvatarSize = 256 << 10
+
+// inlineAvatars downloads the avatars the authors of doc are shown with and
+// returns them as data: URIs keyed by URL, for writeHTML, so the pages need
+// no network for them; it runs with --files, and without it the avatars are
+// linked. An avatar that can't be downloaded is logged and
+// left out, and stays linked.
+func inlineAvatars(ctx context.Context, client *http.Client, doc *outConversation, avatars map[string]string) map[string]string {
+	urls := format.AvatarURLs(plainMessages(doc.Messages), avatars)
+	images := make(map[string]string, len(urls))
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		next = make(chan string)
+	)
+	for range min(4, len(urls)) {
+		wg.Go(func() {
+			for u := range next {
+				img, err := fetchAvatar(ctx, client, u)
+				if err != nil {
+					slog.Info("can't inline avatar, linking it", "url", u, "error", err)
+					continue
+				}
+				mu.Lock()
+				images[u] = img
+				mu.Unlock()
+			}
+		})
+	}
+	for _, u := range urls {
+		next <- u
+	}
+	close(next)
+	wg.Wait()
+	return images
+}
+
+// fetchAvatar downloads the image at u and returns it as a data: URI.
+func fetchAvatar(ctx context.Context, client *http.Client, u string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "image/") {
+		return "", fmt.Errorf("not an image: %q", mediaType)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAvatarSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxAvatarSize {
+		return "", fmt.Errorf("larger than %d bytes", maxAvatarSize)
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// htmlPagePath returns the path of page n of an HTML export to path: path
+// itself for the first page.
+func htmlPagePath(path string, n int) string {
+	if n == 1 {
+		return path
+	}
+	return chunkPath(path, n)
+}
+
+// linkTargetTS returns the ts of the message marked link_target, or "".
+func linkTargetTS(msgs []outMessage) string {
+	for _, m := range msgs {
+		if m.LinkTarget {
+			return m.Timestamp
+		}
+		if ts := linkTargetTS(m.ThreadReplies); ts != "" {
+			return ts
+		}
+	}
+	return ""
+}
+
+// plainMessages turns output messages back into slackdump messages with
+// their replies nested, keeping the output's order.
+func plainMessages(msgs []outMessage) []types.Message {
+	if msgs == nil {
+		return nil
+	}
+	out := make([]types.Message, len(msgs))
+	for i := range msgs {
+		out[i] = msgs[i].Message
+		out[i].ThreadReplies = plainMessages(msgs[i].ThreadReplies)
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTMLPages(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "general.html")
+	if err := writeHTML(path, buildOutput(channelWithThreads(5), encodeOptions{}), 2, nil, nil); err != nil {
+		t.Fatalf("writeHTML() error: %v", err)
+	}
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{"general.html", []string{"Page 1 of 3", `href="general.0002.html"`, `id="m1700000000.000100"`, "2 replies"}},
+		{"general.0002.html", []string{"Page 2 of 3", `href="general.html"`, `href="general.0003.html"`, `id="m1700000003.000100"`}},
+		{"general.0003.html", []string{"Page 3 of 3", `href="general.0002.html"`, `id="m1700000004.000100"`}},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join(dir, tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%s lacks %q", tt.file, want)
+			}
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Errorf("wrote %d files, want 3 pages", len(entries))
+	}
+}
+
+func TestInlineAvatars(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("PNG"))
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	conv := channelWithThreads(3)
+	conv.Messages[1].User, conv.Messages[2].User = "U3", "U4"
+	doc := buildOutput(conv, encodeOptions{})
+	avatars := map[string]string{"U1": srv.URL + "/a.png", "U2": srv.URL + "/a.png", "U3": srv.URL + "/page", "U4": srv.URL + "/gone.png"}
+	images := inlineAvatars(context.Background(), srv.Client(), doc, avatars)
+	if len(images) != 1 || images[srv.URL+"/a.png"] != "data:image/png;base64,UE5H" {
+		t.Errorf("inlineAvatars() = %v, want only the PNG inlined", images)
+	}
+}
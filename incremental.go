@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rusq/slackdump/v3"
+	"github.com/rusq/slackdump/v3/auth"
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/errs"
+)
+
+// dumpSinceLastMessage re-dumps a thread and appends only the replies newer
+// than the newest message already present in the -o file. When the file
+// doesn't exist yet, the whole thread is dumped.
+func dumpSinceLastMessage(ctx context.Context, sd *slackdump.Session, prov auth.Provider, link archiveLink, workspaceURL string, latest time.Time) error {
+	prev, last, err := previousThread(outputFile, link.thread())
+	if err != nil {
+		return err
+	}
+	if last == "" {
+		slog.Info("no previous messages, dumping the whole thread", "file", outputFile)
+		conv, err := sd.Dump(ctx, link.target(), time.Time{}, latest, progressReporter.ProcessFunc())
+		if err != nil {
+			return errs.Classify(err)
+		}
+		if err := resolveConversationUsers(ctx, prov, workspaceURL, conv); err != nil {
+			return err
+		}
+		if normalizeEmoji {
+			normalizeConversationEmoji(ctx, sd, conv)
+		}
+		return writeOutput(conv)
+	}
+	oldest, err := parseSlackTS(last)
+	if err != nil {
+		return fmt.Errorf("previous output: %w", err)
+	}
+
+	conv, err := sd.Dump(ctx, link.target(), oldest, latest, progressReporter.ProcessFunc())
+	if err != nil {
+		return errs.Classify(err)
+	}
+	conv.Messages = messagesAfter(conv.Messages, last)
+	if len(conv.Messages) == 0 {
+		slog.Info("no new messages", "since", last, "file", outputFile)
+		return nil
+	}
+	if err := resolveConversationUsers(ctx, prov, workspaceURL, conv); err != nil {
+		return err
+	}
+	if normalizeEmoji {
+		normalizeConversationEmoji(ctx, sd, conv)
+	}
+
+	prev.Messages = append(prev.Messages, conv.Messages...)
+	if noNormalize {
+		types.SortMessages(prev.Messages)
+	} else {
+		normalizeConversation(prev)
+	}
+	countMessages(prev.Messages)
+	if statsJSON {
+		outputOptions.stats = runStats.finished(runStarted)
+	}
+	if _, err := writeOutputTo(outputFile, func(w io.Writer) error {
+		return encodeConversation(w, prev)
+	}); err != nil {
+		return err
+	}
+	slog.Info("appended new replies", "count", len(conv.Messages), "file", outputFile)
+	return nil
+}
+
+// loadPreviousDump reads a conversation previously written with -o,
+// compressed or not.
+func loadPreviousDump(path string) (*types.Conversation, error) {
+	f, err := openOutputFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var conv types.Conversation
+	if err := json.NewDecoder(f).Decode(&conv); err != nil {
+		return nil, err
+	}
+	if conv.ID == "" {
+		return nil, errors.New("not a gh-slackdump output file")
+	}
+	return &conv, nil
+}
+
+// previousThread reads the -o file at path that --since-last-message
+// appends to and returns it with the ts of its newest message. The ts is
+// empty when there is nothing to append to: no file, or one whose
+// messages array is empty.
+func previousThread(path, threadTS string) (*types.Conversation, string, error) {
+	prev, err := loadPreviousDump(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("reading previous output: %w", err)
+	}
+	if prev.ThreadTS != threadTS {
+		return nil, "", fmt.Errorf("%s holds thread %q, not %q", path, prev.ThreadTS, threadTS)
+	}
+	return prev, newestTS(prev.Messages), nil
+}
+
+// newestTS returns the newest timestamp among msgs and their thread replies.
+func newestTS(msgs []types.Message) string {
+	var newest string
+	for _, m := range msgs {
+		if tsAfter(m.Timestamp, newest) {
+			newest = m.Timestamp
+		}
+		if ts := newestTS(m.ThreadReplies); tsAfter(ts, newest) {
+			newest = ts
+		}
+	}
+	return newest
+}
+
+// messagesAfter returns the messages with a timestamp strictly after ts.
+func messagesAfter(msgs []types.Message, ts string) []types.Message {
+	var out []types.Message
+	for _, m := range msgs {
+		if tsAfter(m.Timestamp, ts) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// tsAfter reports whether Slack timestamp a is after b. An empty b is
+// before everything.
+func tsAfter(a, b string) bool {
+	if b == "" {
+		return a != ""
+	}
+	ta, errA := parseSlackTS(a)
+	tb, errB := parseSlackTS(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return ta.After(tb)
+}
+
+// parseSlackTS parses a Slack timestamp such as "1771747003.176409".
+func parseSlackTS(ts string) (time.Time, error) {
+	sec, frac, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid Slack timestamp %q", ts)
+	}
+	var us int64
+	if frac != "" {
+		frac = (frac + "000000")[:6]
+		if us, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}, fmt.Errorf("invalid Slack timestamp %q", ts)
+		}
+	}
+	return time.Unix(s, us*1000).UTC(), nil
+}
+
+// threadTSFromLink returns the thread timestamp of a Slack thread link, e.g.
+// .../archives/C09036MGFJ4/p1771747003176409 → 1771747003.176409.
+func threadTSFromLink(slackLink string) (string, bool) {
+	u, err := url.Parse(slackLink)
+	if err != nil {
+		return "", false
+	}
+	dir, last := filepath.Split(strings.TrimSuffix(u.Path, "/"))
+	if !strings.HasPrefix(dir, "/archives/") || len(last) < 8 || last[0] != 'p' {
+		return "", false
+	}
+	digits := last[1:]
+	if _, err := strconv.ParseUint(digits, 10, 64); err != nil {
+		return "", false
+	}
+	return digits[:len(digits)-6] + "." + digits[len(digits)-6:], true
+}
+
+// writeFileAtomic writes to a temporary file next to path and renames it into
+// place only after write succeeds and the file is synced to disk, so an
+// existing file is never left truncated or half-written, even by a crash.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit()
+}
+
+// atomicFile is a file written under a temporary name next to path, for
+// writes that don't fit in one writeFileAtomic call. commit renames it into
+// place; abort drops it. With --encrypt-to, what is written to it is
+// encrypted, and path has .age appended.
+type atomicFile struct {
+	*os.File
+	path string
+	mode os.FileMode
+	enc  io.WriteCloser
+}
+
+// pendingFiles holds the temporary files and directories of work still in
+// progress, for removeTempFiles: the atomicFiles not committed or aborted
+// yet, the message spool and the --gist directory.
+var pendingFiles = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// trackTemp adds name, a temporary file or directory, to pendingFiles.
+func trackTemp(name string) {
+	pendingFiles.Lock()
+	defer pendingFiles.Unlock()
+	pendingFiles.names[name] = true
+}
+
+// untrackTemp drops name from pendingFiles, once it is put in place or
+// removed.
+func untrackTemp(name string) {
+	pendingFiles.Lock()
+	defer pendingFiles.Unlock()
+	delete(pendingFiles.names, name)
+}
+
+// removeTemp removes name, a temporary file or directory, and drops it
+// from pendingFiles.
+func removeTemp(name string) {
+	os.RemoveAll(name)
+	untrackTemp(name)
+}
+
+// createAtomic starts an atomicFile for path, which keeps the permissions
+// of the file it replaces.
+func createAtomic(path string) (*atomicFile, error) {
+	f, err := createPlainAtomic(encryptedPath(path))
+	if err != nil {
+		return nil, err
+	}
+	if f.enc, err = encryptWriter(f.File); err != nil {
+		f.abort()
+		return nil, err
+	}
+	return f, nil
+}
+
+// createPlainAtomic is createAtomic without --encrypt-to, for files that
+// must stay readable without the key, such as the --manifest.
+func createPlainAtomic(path string) (*atomicFile, error) {
+	mode := os.FileMode(0o644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	trackTemp(f.Name())
+	return &atomicFile{File: f, path: path, mode: mode}, nil
+}
+
+func (f *atomicFile) Write(p []byte) (int, error) {
+	if f.enc != nil {
+		return f.enc.Write(p)
+	}
+	return f.File.Write(p)
+}
+
+// commit syncs and closes the file, renames it to its path and syncs the
+// directory, so the rename survives a crash.
+func (f *atomicFile) commit() error {
+	defer f.forget()
+	var err error
+	if f.enc != nil {
+		err = f.enc.Close()
+	}
+	if err == nil {
+		err = f.Chmod(f.mode)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	var size int64
+	if fi, statErr := f.Stat(); statErr == nil {
+		size = fi.Size()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	syncDir(filepath.Dir(f.path))
+	recordWrite(f.path, size)
+	return nil
+}
+
+// abort closes and removes the file, leaving path as it was.
+func (f *atomicFile) abort() {
+	defer f.forget()
+	f.Close()
+	os.Remove(f.Name())
+}
+
+func (f *atomicFile) forget() {
+	untrackTemp(f.Name())
+}
+
+// removeTempFiles removes the temporary files and directories of work
+// still in progress, for when the process is interrupted.
+func removeTempFiles() {
+	pendingFiles.Lock()
+	defer pendingFiles.Unlock()
+	for name := range pendingFiles.names {
+		os.RemoveAll(name)
+	}
+	clear(pendingFiles.names)
+}
+
+// syncDir syncs directory dir, so a rename into it survives a crash. Where
+// directories can't be synced (Windows), it does nothing.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
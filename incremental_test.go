@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func msg(ts string, replies ...types.Message) types.Message {
+	return types.Message{
+		Message:       slack.Message{Msg: slack.Msg{Timestamp: ts}},
+		ThreadReplies: replies,
+	}
+}
+
+func TestThreadTSFromLink(t *testing.T) {
+	tests := []struct {
+		link   string
+		want   string
+		wantOK bool
+	}{
+		{link: "https://ws.slack.com/archives/C09036MGFJ4/p1771747003176409", want: "1771747003.176409", wantOK: true},
+		{link: "https://ws.slack.com/archives/C09036MGFJ4/p1771747003176409/", want: "1771747003.176409", wantOK: true},
+		{link: "https://ws.slack.com/archives/C09036MGFJ4"},
+		{link: "https://ws.slack.com/archives/C09036MGFJ4/pabc"},
+		{link: "https://ws.slack.com/team/p1771747003176409"},
+	}
+	for _, tt := range tests {
+		got, ok := threadTSFromLink(tt.link)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("threadTSFromLink(%q) = %q, %v, want %q, %v", tt.link, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestParseSlackTS(t *testing.T) {
+	got, err := parseSlackTS("1771747003.176409")
+	if err != nil {
+		t.Fatalf("parseSlackTS error: %v", err)
+	}
+	want := time.Unix(1771747003, 176409000).UTC()
+	if !got.Equal(want) {
+		t.Errorf("parseSlackTS() = %v, want %v", got, want)
+	}
+	if _, err := parseSlackTS("nope"); err == nil {
+		t.Error("parseSlackTS(nope) should fail")
+	}
+}
+
+func TestNewestTSAndMessagesAfter(t *testing.T) {
+	msgs := []types.Message{
+		msg("1700000000.000100", msg("1700000300.000000")),
+		msg("1700000200.000000"),
+	}
+	if got := newestTS(msgs); got != "1700000300.000000" {
+		t.Errorf("newestTS() = %q, want 1700000300.000000", got)
+	}
+
+	fresh := []types.Message{msg("1700000200.000000"), msg("1700000200.000001"), msg("1700000400.000000")}
+	got := messagesAfter(fresh, "1700000200.000000")
+	if len(got) != 2 || got[0].Timestamp != "1700000200.000001" || got[1].Timestamp != "1700000400.000000" {
+		t.Errorf("messagesAfter() = %v, want the two newer messages", got)
+	}
+}
+
+func TestLoadPreviousDump(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "thread.json")
+	conv := &types.Conversation{ID: "C1", ThreadTS: "1700000000.000100", Messages: []types.Message{msg("1700000000.000100")}}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := encodeConversation(f, conv); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	got, err := loadPreviousDump(path)
+	if err != nil {
+		t.Fatalf("loadPreviousDump error: %v", err)
+	}
+	if got.ThreadTS != conv.ThreadTS || len(got.Messages) != 1 {
+		t.Errorf("loadPreviousDump() = %+v, want %+v", got, conv)
+	}
+
+	other := filepath.Join(dir, "other.json")
+	os.WriteFile(other, []byte(`{"foo":"bar"}`), 0o644)
+	if _, err := loadPreviousDump(other); err == nil {
+		t.Error("loadPreviousDump should reject files that aren't dumps")
+	}
+}
+
+func TestPreviousThread(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, conv *types.Conversation) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := encodeConversation(f, conv); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	const thread = "1700000000.000100"
+
+	tests := []struct {
+		name     string
+		path     string
+		wantLast string
+		wantErr  bool
+	}{
+		{name: "missing", path: filepath.Join(dir, "missing.json")},
+		{name: "no messages", path: write("empty.json", &types.Conversation{ID: "C1", ThreadTS: thread, Messages: []types.Message{}})},
+		{name: "replies", path: write("thread.json", &types.Conversation{ID: "C1", ThreadTS: thread, Messages: []types.Message{msg(thread), msg("1700000200.000000")}}), wantLast: "1700000200.000000"},
+		{name: "other thread", path: write("other.json", &types.Conversation{ID: "C1", ThreadTS: "1700000999.000000"}), wantErr: true},
+	}
+	for _, tt := range tests {
+		_, last, err := previousThread(tt.path, thread)
+		if (err != nil) != tt.wantErr || last != tt.wantLast {
+			t.Errorf("%s: previousThread() = %q, %v, want %q, error %v", tt.name, last, err, tt.wantLast, tt.wantErr)
+		}
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.json")
+	os.WriteFile(path, []byte("previous"), 0o600)
+
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return errors.New("boom")
+	})
+	if err == nil {
+		t.Fatal("writeFileAtomic should return the write error")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "previous" {
+		t.Errorf("failed write changed the file to %q", data)
+	}
+
+	if err := writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write([]byte("new"))
+		return err
+	}); err != nil {
+		t.Fatalf("writeFileAtomic error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("file = %q, want new", data)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600 preserved", fi.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestRemoveTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.json")
+	os.WriteFile(path, []byte("previous"), 0o644)
+
+	f, err := createAtomic(path)
+	if err != nil {
+		t.Fatalf("createAtomic error: %v", err)
+	}
+	f.Write([]byte("partial"))
+	removeTempFiles()
+	f.Close()
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "previous" {
+		t.Errorf("interrupted write changed the file to %q", data)
+	}
+	if err := f.commit(); err == nil {
+		t.Error("commit of a removed temporary file succeeded")
+	}
+}
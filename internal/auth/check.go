@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"time"
+
+	"github.com/rusq/slack"
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/wham/gh-slackdump/internal/redact"
+)
+
+// CheckStep is the outcome of one step of a workspace check.
+type CheckStep struct {
+	Name     string
+	Duration time.Duration
+	Detail   string // what the step found, when it succeeded
+	Err      error
+}
+
+// CheckWorkspace verifies that cookie authenticates against workspaceURL over
+// the same transport a dump would use: it exchanges the cookie for a token and
+// calls auth.test with it, timing each step. Steps after the first failure
+// are not run.
+func CheckWorkspace(ctx context.Context, workspaceURL, cookie string, opts TransportOptions) ([]CheckStep, error) {
+	t, err := newTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+	return checkWorkspace(ctx, &http.Client{Transport: t, Jar: jar}, apiURLFor(workspaceURL), workspaceURL, cookie), nil
+}
+
+func checkWorkspace(ctx context.Context, client *http.Client, apiURL, workspaceURL, cookie string) []CheckStep {
+	var token string
+	exchange := runCheckStep("token exchange", func() (string, error) {
+		var err error
+		token, err = exchangeCookieForToken(ctx, client, workspaceURL, cookie)
+		if err != nil {
+			return "", err
+		}
+		return "token " + redactToken(token), nil
+	})
+	if exchange.Err != nil {
+		return []CheckStep{exchange}
+	}
+
+	if u, err := url.Parse(apiURL); err == nil && client.Jar != nil {
+		client.Jar.SetCookies(u, []*http.Cookie{{Name: "d", Value: cookie}})
+	}
+	authTest := runCheckStep("auth.test", func() (string, error) {
+		resp, err := slack.New(token, slack.OptionHTTPClient(client), slack.OptionAPIURL(apiURL)).AuthTestContext(ctx)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("user %s on team %s", resp.User, resp.Team), nil
+	})
+	return []CheckStep{exchange, authTest}
+}
+
+func runCheckStep(name string, fn func() (string, error)) CheckStep {
+	start := time.Now()
+	detail, err := fn()
+	return CheckStep{Name: name, Duration: time.Since(start), Detail: detail, Err: redact.Error(err)}
+}
+
+// redactToken keeps only the token type prefix and the last few characters.
+func redactToken(token string) string {
+	if len(token) <= 12 {
+		return "..."
+	}
+	return token[:5] + "..." + token[len(token)-4:]
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckWorkspace(t *testing.T) {
+	tests := []struct {
+		name      string
+		page      string
+		authTest  string
+		wantSteps int
+		wantErrAt int // index of the failing step, -1 for none
+	}{
+		{
+			name:      "both steps pass",
+			page:      `{"api_token":"xoxc-1234567890-abcd"}`,
+			authTest:  `{"ok":true,"user":"alice","team":"Acme"}`,
+			wantSteps: 2,
+			wantErrAt: -1,
+		},
+		{
+			name:      "exchange fails",
+			page:      `<form id="signin_form">`,
+			wantSteps: 1,
+			wantErrAt: 0,
+		},
+		{
+			name:      "auth.test rejects token",
+			page:      `{"api_token":"xoxc-1234567890-abcd"}`,
+			authTest:  `{"ok":false,"error":"invalid_auth"}`,
+			wantSteps: 2,
+			wantErrAt: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/ssb/redirect":
+					w.Write([]byte(tt.page))
+				case "/api/auth.test":
+					if got := r.FormValue("token"); got != "xoxc-1234567890-abcd" {
+						t.Errorf("auth.test token = %q", got)
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.Write([]byte(tt.authTest))
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer srv.Close()
+
+			steps := checkWorkspace(context.Background(), srv.Client(), srv.URL+"/api/", srv.URL, "cookie")
+			if len(steps) != tt.wantSteps {
+				t.Fatalf("got %d steps, want %d: %+v", len(steps), tt.wantSteps, steps)
+			}
+			for i, s := range steps {
+				if (s.Err != nil) != (i == tt.wantErrAt) {
+					t.Errorf("step %q error = %v, want failure at step %d", s.Name, s.Err, tt.wantErrAt)
+				}
+				if s.Duration <= 0 {
+					t.Errorf("step %q has no duration", s.Name)
+				}
+			}
+			if tt.wantErrAt == -1 {
+				if got, want := steps[1].Detail, "user alice on team Acme"; got != want {
+					t.Errorf("auth.test detail = %q, want %q", got, want)
+				}
+				if got, want := steps[0].Detail, "token xoxc-...abcd"; got != want {
+					t.Errorf("exchange detail = %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactToken(t *testing.T) {
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{"xoxc-1234567890-abcd", "xoxc-...abcd"},
+		{"short", "..."},
+	}
+	for _, tt := range tests {
+		if got := redactToken(tt.token); got != tt.want {
+			t.Errorf("redactToken(%q) = %q, want %q", tt.token, got, tt.want)
+		}
+	}
+}
@@ -1,17 +1,36 @@
+//go:build cgo && !nokeychain
+
 package auth
 
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 
 	"github.com/keybase/go-keychain"
 )
 
+// keychainSupport reports that this build reads the cookie password from
+// the macOS Keychain.
+const keychainSupport = true
+
+// keychainAccounts are the accounts the cookie password is kept under,
+// depending on how the app was installed.
+var keychainAccounts = []string{"Slack Key", "Slack", "Slack App Store Key"}
+
 func cookiePassword() ([]byte, error) {
-	accountNames := []string{"Slack Key", "Slack", "Slack App Store Key"}
 	var lastErr error
-	for _, name := range accountNames {
+	for _, name := range keychainAccounts {
 		password, err := cookiePasswordFromKeychain(name)
+		if err != nil && isKeychainAPIError(err) {
+			// The Keychain API itself is unusable in this build or session;
+			// the security CLI can still show the access prompt.
+			slog.Debug("keychain query failed, falling back to the security CLI", "account", name, "error", err)
+			password, err = passwordFromSecurityCLI(name)
+			if errors.Is(err, errKeychainDenied) {
+				return nil, fmt.Errorf("%w — allow access to \"Slack Safe Storage\" when prompted by the Keychain dialog", err)
+			}
+		}
 		if err == nil {
 			return password, nil
 		}
@@ -20,6 +39,43 @@ func cookiePassword() ([]byte, error) {
 	return nil, fmt.Errorf("%w — make sure to allow access when prompted by the Keychain dialog", lastErr)
 }
 
+// isKeychainAPIError reports whether err from the Keychain API points at the
+// API being unavailable, rather than at the item (missing, or access
+// denied by the user).
+func isKeychainAPIError(err error) bool {
+	var kerr keychain.Error
+	if !errors.As(err, &kerr) {
+		return false
+	}
+	switch kerr {
+	case keychain.ErrorInteractionNotAllowed, keychain.ErrorNotAvailable, keychain.ErrorUnimplemented:
+		return true
+	}
+	return false
+}
+
+// keychainItem returns the account of the Keychain item holding the cookie
+// password, looking it up without reading the password, which never shows
+// the access prompt.
+func keychainItem() (string, error) {
+	for _, name := range keychainAccounts {
+		query := keychain.NewItem()
+		query.SetSecClass(keychain.SecClassGenericPassword)
+		query.SetService("Slack Safe Storage")
+		query.SetAccount(name)
+		query.SetMatchLimit(keychain.MatchLimitOne)
+		query.SetReturnAttributes(true)
+		results, err := keychain.QueryItem(query)
+		if err != nil {
+			return "", fmt.Errorf("looking up the \"Slack Safe Storage\" Keychain item: %w", err)
+		}
+		if len(results) > 0 {
+			return name, nil
+		}
+	}
+	return "", errors.New("no \"Slack Safe Storage\" Keychain item — has the Slack desktop app been signed in on this Mac?")
+}
+
 func cookiePasswordFromKeychain(accountName string) ([]byte, error) {
 	query := keychain.NewItem()
 	query.SetSecClass(keychain.SecClassGenericPassword)
@@ -0,0 +1,17 @@
+//go:build !darwin || !cgo || nokeychain
+
+package auth
+
+import "fmt"
+
+// keychainSupport reports that this build can't read the Keychain: it was
+// built with the nokeychain tag, without cgo, or for another OS.
+const keychainSupport = false
+
+func cookiePassword() ([]byte, error) {
+	return nil, fmt.Errorf("%w: this build can't read the Keychain password that encrypts Slack desktop app cookies", ErrUnsupportedSource)
+}
+
+func keychainItem() (string, error) {
+	return "", fmt.Errorf("%w: this build can't read the Keychain", ErrUnsupportedSource)
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wham/gh-slackdump/internal/redact"
+)
+
+// HTTPDebug traces every request sent over the uTLS transport: one line per
+// request with its method, URL, status, latency, protocol and response
+// size. With a Dir, the requests and responses are also written there in
+// full. Cookie and Authorization headers, and any token or cookie in a URL
+// or body, are masked.
+type HTTPDebug struct {
+	out io.Writer
+	// Dir receives NNNN-request.txt and NNNN-response.txt per request; empty
+	// means trace lines only.
+	Dir string
+
+	mu sync.Mutex
+	n  int
+}
+
+// NewHTTPDebug returns an HTTPDebug writing trace lines to stderr. With full,
+// bodies are dumped to a new temporary directory.
+func NewHTTPDebug(full bool) (*HTTPDebug, error) {
+	d := &HTTPDebug{out: os.Stderr}
+	if full {
+		dir, err := os.MkdirTemp("", "gh-slackdump-http-")
+		if err != nil {
+			return nil, err
+		}
+		d.Dir = dir
+	}
+	return d, nil
+}
+
+// sensitiveHeaders are masked in body dumps.
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// wrap returns base traced by d, or base itself when d is nil.
+func (d *HTTPDebug) wrap(base http.RoundTripper) http.RoundTripper {
+	if d == nil {
+		return base
+	}
+	return &debugTransport{base: base, debug: d}
+}
+
+func (d *HTTPDebug) next() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.n++
+	return d.n
+}
+
+func (d *HTTPDebug) printf(format string, args ...any) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprintf(d.out, format, args...)
+}
+
+// debugTransport traces the requests sent through base.
+type debugTransport struct {
+	base  http.RoundTripper
+	debug *HTTPDebug
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := t.debug.next()
+	target := redact.String(req.URL.String())
+	if t.debug.Dir != "" {
+		var err error
+		if req, err = t.dumpRequest(n, req); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	latency := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		t.debug.printf("http #%d %s %s: %s after %s\n", n, req.Method, target, redact.String(err.Error()), latency)
+		return nil, err
+	}
+
+	body := &tracedBody{ReadCloser: resp.Body}
+	if t.debug.Dir != "" {
+		body.copy = &bytes.Buffer{}
+	}
+	body.onClose = func() {
+		t.debug.printf("http #%d %s %s %d %s %s %d bytes\n", n, req.Method, target, resp.StatusCode, latency, protocol(resp), body.size)
+		if body.copy != nil {
+			t.writeDump(n, "response", fmt.Sprintf("%s %s\n", resp.Proto, resp.Status), resp.Header, body.copy.Bytes())
+		}
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// dumpRequest writes req to the dump directory and returns it with a body
+// that can still be sent.
+func (t *debugTransport) dumpRequest(n int, req *http.Request) (*http.Request, error) {
+	var data []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if data, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	t.writeDump(n, "request", fmt.Sprintf("%s %s\n", req.Method, req.URL), req.Header, data)
+	return req, nil
+}
+
+// writeDump writes one side of an exchange to NNNN-<kind>.txt, with secrets
+// masked.
+func (t *debugTransport) writeDump(n int, kind, first string, header http.Header, body []byte) {
+	var b strings.Builder
+	b.WriteString(first)
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range header[k] {
+			for _, s := range sensitiveHeaders {
+				if http.CanonicalHeaderKey(k) == s {
+					v = "REDACTED"
+				}
+			}
+			fmt.Fprintf(&b, "%s: %s\n", k, v)
+		}
+	}
+	b.WriteString("\n")
+	b.Write(body)
+	path := filepath.Join(t.debug.Dir, fmt.Sprintf("%04d-%s.txt", n, kind))
+	if err := os.WriteFile(path, []byte(redact.String(b.String())), 0o600); err != nil {
+		t.debug.printf("http #%d: writing %s: %v\n", n, path, err)
+	}
+}
+
+// protocol returns the protocol ALPN negotiated for resp: h2 or http/1.1.
+func protocol(resp *http.Response) string {
+	if resp.TLS != nil && resp.TLS.NegotiatedProtocol != "" {
+		return resp.TLS.NegotiatedProtocol
+	}
+	if resp.ProtoMajor == 2 {
+		return "h2"
+	}
+	return "http/1.1"
+}
+
+// tracedBody counts, and optionally copies, what is read from a response
+// body, and reports once it is closed.
+type tracedBody struct {
+	io.ReadCloser
+	size    int64
+	copy    *bytes.Buffer
+	onClose func()
+	once    sync.Once
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if b.copy != nil {
+		b.copy.Write(p[:n])
+	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.onClose)
+	return err
+}
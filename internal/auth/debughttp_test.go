@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDebugTransport(t *testing.T) {
+	const token = "xoxc-1234567890-abcdef"
+	const cookie = "xoxd-secret-cookie"
+	tests := []struct {
+		name      string
+		http2     bool
+		wantProto string
+	}{
+		{name: "h2", http2: true, wantProto: " h2 "},
+		{name: "http/1.1", wantProto: " http/1.1 "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"ok":true,"token":"` + token + `"}`))
+			}))
+			srv.EnableHTTP2 = tt.http2
+			srv.StartTLS()
+			defer srv.Close()
+
+			var out bytes.Buffer
+			debug := &HTTPDebug{out: &out, Dir: t.TempDir()}
+			tr, err := newUTLSTransport(TransportOptions{InsecureSkipVerify: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr.proxy = nil
+			client := &http.Client{Transport: debug.wrap(tr)}
+
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/auth.test", strings.NewReader(url.Values{"token": {token}}.Encode()))
+			req.Header.Set("Cookie", "d="+cookie)
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error: %v", err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			line := out.String()
+			for _, want := range []string{"http #1 POST ", "/api/auth.test 200 ", tt.wantProto, " 44 bytes"} {
+				if !strings.Contains(line, want) {
+					t.Errorf("trace %q doesn't contain %q", line, want)
+				}
+			}
+
+			for _, name := range []string{"0001-request.txt", "0001-response.txt"} {
+				data, err := os.ReadFile(filepath.Join(debug.Dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, secret := range []string{token, cookie} {
+					if bytes.Contains(data, []byte(secret)) {
+						t.Errorf("%s contains %q:\n%s", name, secret, data)
+					}
+				}
+			}
+			reqDump, _ := os.ReadFile(filepath.Join(debug.Dir, "0001-request.txt"))
+			if !bytes.Contains(reqDump, []byte("Cookie: REDACTED")) || !bytes.Contains(reqDump, []byte("Authorization: REDACTED")) {
+				t.Errorf("request dump doesn't mask the headers:\n%s", reqDump)
+			}
+		})
+	}
+}
+
+func TestDebugTransportError(t *testing.T) {
+	var out bytes.Buffer
+	debug := &HTTPDebug{out: &out}
+	tr, err := newUTLSTransport(TransportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.proxy = nil
+	// Nothing listens on port 1.
+	if _, err := (&http.Client{Transport: debug.wrap(tr)}).Get("https://127.0.0.1:1/"); err == nil {
+		t.Fatal("Get() succeeded")
+	}
+	if !strings.HasPrefix(out.String(), "http #1 GET https://127.0.0.1:1/: ") {
+		t.Errorf("trace = %q, want the failed request", out.String())
+	}
+}
@@ -6,34 +6,43 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/sha1"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
-	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	utls "github.com/refraction-networking/utls"
 	"github.com/rusq/slack"
 	"github.com/rusq/slackdump/v3/auth"
 	"golang.org/x/crypto/pbkdf2"
-	"golang.org/x/net/http2"
 	"golang.org/x/net/publicsuffix"
 	_ "modernc.org/sqlite"
+
+	"github.com/wham/gh-slackdump/internal/errs"
+	"github.com/wham/gh-slackdump/internal/redact"
 )
 
 // Provider wraps slackdump's ValueAuth with uTLS fingerprinting
-// to mimic Safari's TLS fingerprint.
+// to mimic a browser's TLS fingerprint.
 type Provider struct {
 	auth.ValueAuth
+	opts TransportOptions
+	// domain is the workspace's Slack domain, slack.com or slack-gov.com.
+	domain string
+	// pacer rate-limits every client HTTPClient returns.
+	pacer *pacer
 }
 
 func (p *Provider) HTTPClient() (*http.Client, error) {
@@ -43,12 +52,42 @@ func (p *Provider) HTTPClient() (*http.Client, error) {
 	}
 	u, _ := url.Parse(auth.SlackURL)
 	jar.SetCookies(u, p.Cookies())
+	rt, err := newTransport(p.opts)
+	if err != nil {
+		return nil, err
+	}
+	if p.domain != "" && p.domain != slackDomain {
+		rt = &apiHostTransport{base: rt, domain: p.domain}
+	}
+	if p.pacer != nil {
+		rt = &rateLimitTransport{base: rt, pacer: p.pacer}
+	}
 	return &http.Client{
 		Jar:       jar,
-		Transport: &utlsTransport{h2: &http2.Transport{}},
+		Transport: rt,
 	}, nil
 }
 
+// Stats returns the counters of the requests sent so far through the
+// provider's HTTP clients.
+func (p *Provider) Stats() RequestStats {
+	if p.pacer == nil {
+		return RequestStats{}
+	}
+	return p.pacer.snapshot()
+}
+
+// YieldToAPI waits while a Web API request sent through the provider's
+// HTTP clients is waiting out a 429 or an outage, so downloads don't add to
+// the load while Slack asks for less. It returns the context's error if it
+// is done first.
+func (p *Provider) YieldToAPI(ctx context.Context) error {
+	if p.pacer == nil {
+		return nil
+	}
+	return p.pacer.yield(ctx)
+}
+
 func (p *Provider) Test(ctx context.Context) (*slack.AuthTestResponse, error) {
 	cl, err := p.HTTPClient()
 	if err != nil {
@@ -57,194 +96,410 @@ func (p *Provider) Test(ctx context.Context) (*slack.AuthTestResponse, error) {
 	return slack.New(p.SlackToken(), slack.OptionHTTPClient(cl)).AuthTestContext(ctx)
 }
 
-// utlsTransport uses uTLS to mimic Safari's TLS fingerprint.
-// It caches and reuses HTTP/2 connections per host, matching real browser behavior.
-type utlsTransport struct {
-	h2   *http2.Transport
-	mu   sync.Mutex
-	h2cc map[string]*http2.ClientConn
-}
-
-func (t *utlsTransport) getOrDialH2(req *http.Request) (*http2.ClientConn, error) {
-	addr := req.URL.Host
-	if req.URL.Port() == "" {
-		addr += ":443"
+// NewProvider creates a new auth provider by reading Slack "d" cookies from
+// sources, in order, and exchanging them for a Slack API token until one
+// works. All connections use uTLS to mimic a browser's TLS fingerprint.
+func NewProvider(ctx context.Context, workspaceURL string, sources []AuthSource, opts TransportOptions) (*Provider, error) {
+	t, err := newTransport(opts)
+	if err != nil {
+		return nil, err
 	}
+	client := &http.Client{Transport: t}
+	return newProvider(ctx, workspaceURL, sources, func(ctx context.Context, workspaceURL, cookie string) (string, error) {
+		return exchangeCookieForToken(ctx, client, workspaceURL, cookie)
+	}, opts)
+}
 
-	t.mu.Lock()
-	if t.h2cc == nil {
-		t.h2cc = make(map[string]*http2.ClientConn)
+func newProvider(ctx context.Context, workspaceURL string, sources []AuthSource, exchange tokenExchanger, opts TransportOptions) (*Provider, error) {
+	candidates, err := cookiesFor(sources, workspaceURL)
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrAuth, err)
 	}
-	cc, ok := t.h2cc[addr]
-	t.mu.Unlock()
 
-	if ok && cc.CanTakeNewRequest() {
-		return cc, nil
+	token, cookie, err := exchangeFirst(ctx, exchange, workspaceURL, candidates)
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrAuth, redact.Error(fmt.Errorf("cookie did not work for workspace: %w", err)))
 	}
+	redact.Secret(token)
 
-	conn, err := net.DialTimeout("tcp", addr, 30*time.Second)
+	slog.Info("authenticated", "source", cookie.source, "domain", cookie.Domain)
+	va, err := auth.NewValueAuth(token, cookie.Value)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("creating auth: %w", err)
 	}
+	return &Provider{ValueAuth: va, opts: opts, domain: domainFor(workspaceURL), pacer: newPacer(opts.RateLimit, opts.OutageMaxWait)}, nil
+}
 
-	tlsConn := utls.UClient(conn, &utls.Config{ServerName: req.URL.Hostname()}, utls.HelloSafari_Auto)
-	if err := tlsConn.Handshake(); err != nil {
-		conn.Close()
-		return nil, err
-	}
+var apiTokenRE = regexp.MustCompile(`"api_token":"([^"]+)"`)
 
-	cc, err = t.h2.NewClientConn(tlsConn)
-	if err != nil {
-		conn.Close()
-		return nil, err
+// Errors returned when the token exchange page doesn't carry an API token.
+var (
+	// ErrSignedOut means Slack served its sign-in page, i.e. the cookie
+	// belongs to a signed-out session or to another workspace.
+	ErrSignedOut = errs.New(errs.ErrAuth, "Slack session is signed out")
+	// ErrChallenged means Slack's edge answered with a bot challenge page.
+	ErrChallenged = errs.New(errs.ErrAuth, "Slack served a browser challenge page")
+	// ErrEnterpriseGate means the workspace is gated by an Enterprise Grid
+	// policy that doesn't accept this session.
+	ErrEnterpriseGate = errs.New(errs.ErrAuth, "workspace access is restricted by the Enterprise organization")
+)
+
+// ErrAppBoundEncryption means a cookie is protected with Chromium's
+// app-bound encryption (a v20 value), whose key is bound to the Slack app
+// itself and can't be derived from the Keychain password.
+var ErrAppBoundEncryption = errs.New(errs.ErrUnsupportedPlatform, "cookie uses app-bound encryption, which can't be decrypted outside the Slack app")
+
+// ErrUnsupportedSource means a cookie source isn't available in this build,
+// e.g. the Slack desktop app's encrypted cookies in a nokeychain build.
+var ErrUnsupportedSource = errs.New(errs.ErrUnsupportedPlatform, "cookie source not supported by this build")
+
+// Capabilities lists the optional features compiled into this build.
+func Capabilities() []string {
+	if keychainSupport {
+		return []string{"keychain"}
 	}
+	return []string{"nokeychain"}
+}
+
+// exchangePageMarkers maps known page variants to their errors. The markers
+// are substrings observed in the HTML Slack serves instead of the client page.
+var exchangePageMarkers = []struct {
+	err     error
+	markers []string
+}{
+	{ErrChallenged, []string{"cf-challenge", "challenge-platform", "cf_chl_"}},
+	{ErrEnterpriseGate, []string{"enterprise_restricted", "org_login_required", "sso_required"}},
+	{ErrSignedOut, []string{"signin_form", `data-qa="signin_`}},
+}
+
+const (
+	// exchangeMaxAttempts bounds how many times the token exchange is tried
+	// when Slack answers with a transient status.
+	exchangeMaxAttempts = 4
+	// exchangeMaxRetryAfter caps a server-provided Retry-After delay.
+	exchangeMaxRetryAfter = 30 * time.Second
+	// exchangeMaxRedirects bounds the redirect chain followed by one attempt.
+	exchangeMaxRedirects = 5
+	// exchangeMaxBody caps how much of the exchange page is read.
+	exchangeMaxBody = 4 << 20
+)
 
-	t.mu.Lock()
-	t.h2cc[addr] = cc
-	t.mu.Unlock()
+// exchangeRetryDelay is the initial backoff between exchange attempts. It
+// doubles after each retry. Tests shorten it.
+var exchangeRetryDelay = time.Second
 
-	return cc, nil
+// retryableStatusError reports a transient HTTP status (429 or 5xx) from the
+// token exchange endpoint.
+type retryableStatusError struct {
+	code       int
+	retryAfter time.Duration
 }
 
-const safariUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.3 Safari/605.1.15"
+func (e *retryableStatusError) Error() string {
+	return fmt.Sprintf("status code %d", e.code)
+}
 
-func (t *utlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	if req.Header.Get("User-Agent") == "" {
-		req = req.Clone(req.Context())
-		req.Header.Set("User-Agent", safariUserAgent)
-	}
-	cc, err := t.getOrDialH2(req)
-	if err != nil {
-		return nil, err
+// exchangeCookieForToken exchanges a Slack "d" cookie for an API token
+// by hitting the workspace's /ssb/redirect endpoint. Transient failures
+// (429 and 5xx) are retried with exponential backoff, honoring Retry-After.
+func exchangeCookieForToken(ctx context.Context, client *http.Client, workspaceURL, cookie string) (string, error) {
+	delay := exchangeRetryDelay
+	for attempt := 1; ; attempt++ {
+		token, err := fetchToken(ctx, client, workspaceURL, cookie)
+		var rse *retryableStatusError
+		if err == nil || !errors.As(err, &rse) || attempt == exchangeMaxAttempts {
+			return token, err
+		}
+		wait := delay
+		if rse.retryAfter > 0 {
+			wait = rse.retryAfter
+		}
+		slog.Info("token exchange failed, retrying", "status", rse.code, "attempt", attempt, "wait", wait)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
 	}
-	return cc.RoundTrip(req)
 }
 
-// NewProvider creates a new auth provider by reading the Slack "d" cookie
-// from the Slack desktop app and exchanging it for a Slack API token.
-// All connections use uTLS to mimic Safari's TLS fingerprint.
-func NewProvider(ctx context.Context, workspaceURL string) (*Provider, error) {
-	cookie, err := readDesktopCookie()
+// fetchToken performs a single token exchange. Redirects are followed
+// explicitly so that the raw Cookie header is re-attached on every hop and a
+// bounce to the sign-in page can be reported as an invalid cookie.
+func fetchToken(ctx context.Context, client *http.Client, workspaceURL, cookie string) (string, error) {
+	base, err := url.Parse(workspaceURL)
 	if err != nil {
-		return nil, fmt.Errorf("reading Slack cookie: %w", err)
+		return "", err
 	}
-	if cookie == "" {
-		return nil, errors.New("no Slack cookies found — sign in to Slack in the Slack desktop app")
+	noFollow := *client
+	noFollow.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
 	}
 
-	slog.Info("trying cookie", "source", "Slack desktop app")
-	token, err := exchangeCookieForToken(workspaceURL, cookie)
-	if err != nil {
-		return nil, fmt.Errorf("cookie did not work for workspace: %w", err)
-	}
+	target := workspaceURL + "/ssb/redirect"
+	for hops := 0; ; hops++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Cookie", "d="+cookie)
 
-	slog.Info("authenticated", "source", "Slack desktop app")
-	va, err := auth.NewValueAuth(token, cookie)
-	if err != nil {
-		return nil, fmt.Errorf("creating auth: %w", err)
-	}
-	return &Provider{ValueAuth: va}, nil
-}
+		resp, err := noFollow.Do(req)
+		if err != nil {
+			return "", err
+		}
 
-var apiTokenRE = regexp.MustCompile(`"api_token":"([^"]+)"`)
+		if isRedirectStatus(resp.StatusCode) {
+			resp.Body.Close()
+			loc, err := resp.Location()
+			if err != nil {
+				return "", fmt.Errorf("redirect without location: %w", err)
+			}
+			if isSigninPath(loc.Path) {
+				return "", fmt.Errorf("%w: cookie is not valid for workspace %s (redirected to %s)", ErrSignedOut, base.Hostname(), loc.Path)
+			}
+			if !sameSite(base, loc) {
+				return "", fmt.Errorf("refusing to follow redirect to %s", loc.Hostname())
+			}
+			if hops == exchangeMaxRedirects {
+				return "", fmt.Errorf("stopped after %d redirects", exchangeMaxRedirects)
+			}
+			slog.Debug("following token exchange redirect", "location", loc.Redacted())
+			target = loc.String()
+			continue
+		}
 
-// exchangeCookieForToken exchanges a Slack "d" cookie for an API token
-// by hitting the workspace's /ssb/redirect endpoint through uTLS.
-func exchangeCookieForToken(workspaceURL, cookie string) (string, error) {
-	req, err := http.NewRequest("GET", workspaceURL+"/ssb/redirect", nil)
-	if err != nil {
-		return "", err
+		defer resp.Body.Close()
+		return readToken(resp)
 	}
-	req.Header.Set("Cookie", "d="+cookie)
-	req.Header.Set("User-Agent", safariUserAgent)
+}
 
-	client := &http.Client{
-		Transport: &utlsTransport{h2: &http2.Transport{}},
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+// readToken extracts the API token from a final exchange response.
+func readToken(resp *http.Response) (string, error) {
+	if isRetryableStatus(resp.StatusCode) {
+		return "", &retryableStatusError{code: resp.StatusCode, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
 	}
-	defer resp.Body.Close()
-
 	if resp.StatusCode != http.StatusOK {
 		return "", fmt.Errorf("status code %d", resp.StatusCode)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, exchangeMaxBody+1))
 	if err != nil {
 		return "", err
 	}
+	if len(body) > exchangeMaxBody {
+		return "", fmt.Errorf("token exchange page is larger than %d MB", exchangeMaxBody>>20)
+	}
 
 	matches := apiTokenRE.FindSubmatch(body)
 	if len(matches) < 2 {
-		return "", errors.New("api token not found in response")
+		sum := sha256.Sum256(body)
+		slog.Debug("token exchange response without api token", "bytes", len(body), "sha256", hex.EncodeToString(sum[:]))
+		return "", classifyExchangePage(body)
 	}
 
 	return string(matches[1]), nil
 }
 
-// ReadCookie reads the Slack "d" cookie from the Slack desktop app's cookie database.
-func ReadCookie() (string, error) {
-	cookie, err := readDesktopCookie()
-	if err != nil {
-		return "", err
+// classifyExchangePage returns the error matching a known page variant, or a
+// generic error when the page format is unknown.
+func classifyExchangePage(body []byte) error {
+	for _, p := range exchangePageMarkers {
+		for _, m := range p.markers {
+			if bytes.Contains(body, []byte(m)) {
+				return p.err
+			}
+		}
+	}
+	return errors.New("api token not found in response")
+}
+
+func isRedirectStatus(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// isSigninPath reports whether a redirect target is one of Slack's sign-in
+// pages, which means the cookie isn't accepted by the workspace.
+func isSigninPath(p string) bool {
+	return strings.HasPrefix(p, "/signin") || strings.HasPrefix(p, "/workspace-signin")
+}
+
+// sameSite reports whether a redirect target stays on the workspace's site,
+// e.g. myworkspace.slack.com → app.slack.com.
+func sameSite(base, target *url.URL) bool {
+	if target.Hostname() == base.Hostname() {
+		return true
+	}
+	a, errA := publicsuffix.EffectiveTLDPlusOne(base.Hostname())
+	b, errB := publicsuffix.EffectiveTLDPlusOne(target.Hostname())
+	return errA == nil && errB == nil && a == b
+}
+
+// isRetryableStatus reports whether an exchange response status is transient.
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as
+// an HTTP date. It returns zero when the header is absent or malformed.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
 	}
-	slog.Info("using Slack desktop cookie")
-	return cookie, nil
+	var d time.Duration
+	if secs, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = time.Until(t)
+	}
+	if d < 0 {
+		return 0
+	}
+	return min(d, exchangeMaxRetryAfter)
 }
 
-// readDesktopCookie reads and decrypts the Slack "d" cookie from the
-// Slack desktop app's local cookie database.
-func readDesktopCookie() (string, error) {
+// DesktopSource reads the "d" cookies of the Slack desktop app's Chromium
+// cookie database.
+type DesktopSource struct{}
+
+func (DesktopSource) Name() string { return "Slack desktop app" }
+
+func (DesktopSource) ReadCookies() ([]Cookie, error) {
 	dbPath, err := slackCookieDBPath()
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("reading Slack cookie: %w", err)
 	}
+	cookies, err := readCookieDB(dbPath, func() ([]byte, error) {
+		password, err := cookiePassword()
+		redact.Secret(string(password))
+		return password, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading Slack cookie: %w", err)
+	}
+	return cookies, nil
+}
 
+// readCookieDB reads and decrypts every Slack "d" cookie in a Chromium
+// cookie database. Signed in to several orgs, the desktop app keeps one per
+// domain (.slack.com, .enterprise.slack.com, an org's own host, or their
+// GovSlack slack-gov.com counterparts). Cookies
+// that fail to decrypt are skipped unless none can be read.
+func readCookieDB(dbPath string, password func() ([]byte, error)) ([]Cookie, error) {
 	slog.Info("reading Slack cookie", "path", dbPath)
 
 	db, err := sql.Open("sqlite", dbPath+"?mode=ro")
 	if err != nil {
-		return "", fmt.Errorf("opening cookie database: %w", err)
+		return nil, fmt.Errorf("opening cookie database: %w", err)
 	}
 	defer db.Close()
 
-	var cookie string
-	var encryptedValue []byte
-	err = db.QueryRow(`SELECT value, encrypted_value FROM cookies WHERE host_key=".slack.com" AND name="d"`).Scan(&cookie, &encryptedValue)
+	rows, err := db.Query(`SELECT host_key, value, encrypted_value FROM cookies
+		WHERE name = 'd' AND (host_key IN ('slack.com', '.slack.com', 'slack-gov.com', '.slack-gov.com')
+			OR host_key LIKE '%.slack.com' OR host_key LIKE '%.slack-gov.com')`)
 	if err != nil {
-		return "", fmt.Errorf("querying cookie: %w", err)
+		return nil, fmt.Errorf("querying cookie: %w", err)
+	}
+	defer rows.Close()
+
+	// The Keychain is asked at most once, however many cookies are encrypted.
+	password = sync.OnceValues(password)
+	var cookies []Cookie
+	var lastErr error
+	for rows.Next() {
+		var c Cookie
+		var encryptedValue []byte
+		if err := rows.Scan(&c.Domain, &c.Value, &encryptedValue); err != nil {
+			return nil, fmt.Errorf("querying cookie: %w", err)
+		}
+		if c.Value == "" {
+			decrypted, err := decryptCookieValue(encryptedValue, c.Domain, password)
+			if err != nil {
+				slog.Debug("skipping undecryptable cookie", "domain", c.Domain, "error", err)
+				lastErr = err
+				continue
+			}
+			c.Value = string(decrypted)
+		}
+		if c.Value != "" {
+			cookies = append(cookies, c)
+		}
 	}
-
-	if cookie != "" {
-		return cookie, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("querying cookie: %w", err)
 	}
-
-	if len(encryptedValue) < 4 {
-		return "", errors.New("encrypted cookie value too short")
+	if len(cookies) == 0 && lastErr != nil {
+		return nil, lastErr
 	}
+	return cookies, nil
+}
 
-	// Remove version prefix (e.g. "v11" = 3 bytes)
-	encryptedValue = encryptedValue[3:]
-
-	key, err := cookiePassword()
-	if err != nil {
-		return "", fmt.Errorf("getting cookie password: %w", err)
+// decryptCookieValue decrypts a Chromium encrypted_value stored for hostKey.
+// Its version prefix selects the scheme: on macOS, v10 and v11 both use
+// AES-CBC keyed from the Keychain password (they only differ on Linux and
+// Windows). v20 values use app-bound encryption and fail with
+// ErrAppBoundEncryption. A value without a prefix is accepted as-is when it
+// looks like a plaintext cookie.
+func decryptCookieValue(value []byte, hostKey string, password func() ([]byte, error)) ([]byte, error) {
+	version, payload := splitCookieVersion(value)
+	switch version {
+	case "v10", "v11":
+		key, err := password()
+		if err != nil {
+			return nil, fmt.Errorf("getting cookie password: %w", err)
+		}
+		decrypted, err := decryptCookie(payload, key)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting %s cookie: %w", version, err)
+		}
+		return removeDomainHashPrefix(decrypted, hostKey), nil
+	case "v20":
+		return nil, ErrAppBoundEncryption
+	case "":
+		if isPlainCookie(value) {
+			return value, nil
+		}
+		return nil, errors.New("encrypted cookie value has no version prefix")
+	default:
+		return nil, fmt.Errorf("unsupported cookie encryption version %q", version)
 	}
+}
 
-	decrypted, err := decryptCookie(encryptedValue, key)
-	if err != nil {
-		return "", fmt.Errorf("decrypting cookie: %w", err)
+// splitCookieVersion splits a "vNN" version prefix off value. It returns an
+// empty version when value has none.
+func splitCookieVersion(value []byte) (string, []byte) {
+	if len(value) >= 3 && value[0] == 'v' && isDigit(value[1]) && isDigit(value[2]) {
+		return string(value[:3]), value[3:]
 	}
+	return "", value
+}
 
-	decrypted = removeDomainHashPrefix(decrypted)
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
 
-	return string(decrypted), nil
+// isPlainCookie reports whether value is a non-empty run of the printable
+// ASCII characters cookie values are made of.
+func isPlainCookie(value []byte) bool {
+	for _, b := range value {
+		if b <= ' ' || b > '~' {
+			return false
+		}
+	}
+	return len(value) > 0
 }
 
 // decryptCookie decrypts a Chromium-encrypted cookie value using PBKDF2 + AES-CBC.
 func decryptCookie(value, key []byte) ([]byte, error) {
+	if len(value) == 0 || len(value)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("ciphertext length %d is not a multiple of the AES block size", len(value))
+	}
 	dk := pbkdf2.Key(key, []byte("saltysalt"), 1003, 16, sha1.New)
 
 	block, err := aes.NewCipher(dk)
@@ -272,16 +527,29 @@ func decryptCookie(value, key []byte) ([]byte, error) {
 	return decrypted, nil
 }
 
-// Chromium prefixes encrypted cookie values with a SHA256 hash of the domain.
+// Chromium 128+ prefixes the plaintext of encrypted cookie values with the
+// SHA256 hash of the cookie's host_key.
 // See https://chromium-review.googlesource.com/c/chromium/src/+/5792044
+//
+// domainHashPrefixes are the hashes of Slack's own domains, tried when the
+// value doesn't start with the hash of its host_key.
 var domainHashPrefixes = [][]byte{
 	// slack.com
 	{3, 202, 236, 172, 132, 247, 212, 240, 217, 211, 68, 226, 103, 153, 245, 64, 85, 68, 2, 183, 83, 182, 186, 218, 14, 102, 237, 62, 231, 241, 231, 142},
 	// .slack.com
 	{145, 28, 115, 68, 173, 92, 42, 78, 104, 243, 5, 63, 24, 206, 51, 190, 31, 169, 160, 244, 247, 106, 147, 228, 60, 68, 92, 134, 105, 199, 162, 120},
+	// slack-gov.com
+	{134, 94, 113, 112, 165, 230, 137, 150, 205, 179, 66, 86, 69, 121, 187, 109, 163, 107, 221, 169, 48, 33, 36, 252, 139, 52, 149, 95, 100, 245, 170, 77},
+	// .slack-gov.com
+	{138, 67, 33, 93, 78, 61, 185, 18, 207, 42, 16, 212, 181, 192, 175, 69, 205, 247, 255, 56, 254, 61, 28, 121, 250, 143, 121, 61, 5, 144, 35, 2},
 }
 
-func removeDomainHashPrefix(value []byte) []byte {
+// removeDomainHashPrefix strips the domain hash from a decrypted cookie value
+// stored for hostKey. Values without one are returned unchanged.
+func removeDomainHashPrefix(value []byte, hostKey string) []byte {
+	if h := sha256.Sum256([]byte(hostKey)); bytes.HasPrefix(value, h[:]) {
+		return value[len(h):]
+	}
 	for _, prefix := range domainHashPrefixes {
 		if bytes.HasPrefix(value, prefix) {
 			return value[len(prefix):]
@@ -320,4 +588,3 @@ func slackConfigDir() (string, error) {
 	}
 	return second, nil
 }
-
@@ -2,11 +2,21 @@ package auth
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
 	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/rusq/slackdump/v3/auth"
 	"golang.org/x/crypto/pbkdf2"
@@ -117,44 +127,400 @@ func TestDecryptCookie(t *testing.T) {
 	}
 }
 
+// encryptCookie encrypts plaintext the way Chromium does on macOS.
+func encryptCookie(t *testing.T, plaintext, key []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(pbkdf2.Key(key, []byte("saltysalt"), 1003, 16, sha1.New))
+	if err != nil {
+		t.Fatal(err)
+	}
+	padLen := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(bytes.Clone(plaintext), bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, bytes.Repeat([]byte{' '}, 16)).CryptBlocks(encrypted, padded)
+	return encrypted
+}
+
+func TestDecryptCookieValue(t *testing.T) {
+	key := []byte("test-password")
+	password := func() ([]byte, error) { return key, nil }
+	encrypted := encryptCookie(t, []byte("xoxd-secret"), key)
+
+	tests := []struct {
+		name    string
+		value   []byte
+		want    string
+		wantErr string
+	}{
+		{name: "v10", value: append([]byte("v10"), encrypted...), want: "xoxd-secret"},
+		{name: "v11", value: append([]byte("v11"), encrypted...), want: "xoxd-secret"},
+		{name: "plaintext without prefix", value: []byte("xoxd-plain%2Fvalue"), want: "xoxd-plain%2Fvalue"},
+		{name: "binary without prefix", value: encrypted, wantErr: "no version prefix"},
+		{name: "app-bound v20", value: append([]byte("v20"), encrypted...), wantErr: "app-bound encryption"},
+		{name: "unknown version", value: append([]byte("v99"), encrypted...), wantErr: `unsupported cookie encryption version "v99"`},
+		{name: "truncated ciphertext", value: append([]byte("v10"), encrypted[:5]...), wantErr: "not a multiple of the AES block size"},
+		{name: "empty ciphertext", value: []byte("v11"), wantErr: "not a multiple of the AES block size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptCookieValue(tt.value, ".slack.com", password)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decryptCookieValue() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decryptCookieValue() error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("decryptCookieValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecryptCookieValuePasswordError(t *testing.T) {
+	_, err := decryptCookieValue([]byte("v10"+strings.Repeat("x", 16)), ".slack.com", func() ([]byte, error) {
+		return nil, errors.New("denied")
+	})
+	if err == nil || !strings.Contains(err.Error(), "getting cookie password: denied") {
+		t.Errorf("decryptCookieValue() error = %v, want the password error", err)
+	}
+}
+
 func TestRemoveDomainHashPrefix(t *testing.T) {
-	// slack.com prefix
-	slackPrefix := []byte{3, 202, 236, 172, 132, 247, 212, 240, 217, 211, 68, 226, 103, 153, 245, 64, 85, 68, 2, 183, 83, 182, 186, 218, 14, 102, 237, 62, 231, 241, 231, 142}
-	// .slack.com prefix
-	dotSlackPrefix := []byte{145, 28, 115, 68, 173, 92, 42, 78, 104, 243, 5, 63, 24, 206, 51, 190, 31, 169, 160, 244, 247, 106, 147, 228, 60, 68, 92, 134, 105, 199, 162, 120}
+	hashOf := func(hostKey string) []byte {
+		h := sha256.Sum256([]byte(hostKey))
+		return h[:]
+	}
 
 	tests := []struct {
-		name  string
-		input []byte
-		want  string
+		name    string
+		hostKey string
+		input   []byte
+		want    string
 	}{
 		{
-			name:  "with slack.com prefix",
-			input: append(slackPrefix, []byte("cookie-value")...),
-			want:  "cookie-value",
+			name:    "slack.com",
+			hostKey: "slack.com",
+			input:   append(hashOf("slack.com"), "cookie-value"...),
+			want:    "cookie-value",
+		},
+		{
+			name:    ".slack.com",
+			hostKey: ".slack.com",
+			input:   append(hashOf(".slack.com"), "cookie-value"...),
+			want:    "cookie-value",
+		},
+		{
+			name:    "enterprise host_key",
+			hostKey: ".acme.enterprise.slack.com",
+			input:   append(hashOf(".acme.enterprise.slack.com"), "cookie-value"...),
+			want:    "cookie-value",
 		},
 		{
-			name:  "with .slack.com prefix",
-			input: append(dotSlackPrefix, []byte("cookie-value")...),
-			want:  "cookie-value",
+			name:    "GovSlack org host_key",
+			hostKey: "agency.slack-gov.com",
+			input:   append(hashOf("agency.slack-gov.com"), "cookie-value"...),
+			want:    "cookie-value",
 		},
 		{
-			name:  "without prefix",
-			input: []byte("cookie-value"),
-			want:  "cookie-value",
+			name:    "known Slack domain hash under another host_key",
+			hostKey: ".acme.enterprise.slack.com",
+			input:   append(hashOf(".slack.com"), "cookie-value"...),
+			want:    "cookie-value",
 		},
 		{
-			name:  "empty input",
-			input: []byte{},
-			want:  "",
+			name:    "hash of an unrelated domain is kept",
+			hostKey: ".slack.com",
+			input:   append(hashOf("example.com"), "cookie-value"...),
+			want:    string(hashOf("example.com")) + "cookie-value",
+		},
+		{
+			name:    "without prefix",
+			hostKey: ".acme.enterprise.slack.com",
+			input:   []byte("cookie-value"),
+			want:    "cookie-value",
+		},
+		{
+			name:    "empty input",
+			hostKey: ".slack.com",
+			input:   []byte{},
+			want:    "",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := removeDomainHashPrefix(tt.input)
+			got := removeDomainHashPrefix(tt.input, tt.hostKey)
 			if !bytes.Equal(got, []byte(tt.want)) {
 				t.Errorf("removeDomainHashPrefix() = %q, want %q", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestExchangeCookieForTokenRetries(t *testing.T) {
+	exchangeRetryDelay = time.Millisecond
+	t.Cleanup(func() { exchangeRetryDelay = time.Second })
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		want         string
+		wantErr      bool
+		wantAttempts int32
+	}{
+		{name: "success first try", statuses: []int{200}, want: "xoxc-abc", wantAttempts: 1},
+		{name: "retries 503 then succeeds", statuses: []int{503, 503, 200}, want: "xoxc-abc", wantAttempts: 3},
+		{name: "retries 429 then succeeds", statuses: []int{429, 200}, want: "xoxc-abc", wantAttempts: 2},
+		{name: "gives up after max attempts", statuses: []int{502, 502, 502, 502, 200}, wantErr: true, wantAttempts: exchangeMaxAttempts},
+		{name: "forbidden is not retried", statuses: []int{403, 200}, wantErr: true, wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := attempts.Add(1)
+				if got := r.Header.Get("Cookie"); got != "d=cookie" {
+					t.Errorf("Cookie header = %q, want d=cookie", got)
+				}
+				status := tt.statuses[n-1]
+				if status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "0")
+				}
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					w.Write([]byte(`{"api_token":"xoxc-abc"}`))
+				}
+			}))
+			defer srv.Close()
+
+			got, err := exchangeCookieForToken(context.Background(), srv.Client(), srv.URL, "cookie")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("exchangeCookieForToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("exchangeCookieForToken() = %q, want %q", got, tt.want)
+			}
+			if n := attempts.Load(); n != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", n, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  time.Duration
+	}{
+		{name: "empty", input: "", want: 0},
+		{name: "seconds", input: "5", want: 5 * time.Second},
+		{name: "capped", input: "3600", want: exchangeMaxRetryAfter},
+		{name: "negative", input: "-1", want: 0},
+		{name: "date in the past", input: "Mon, 02 Jan 2006 15:04:05 GMT", want: 0},
+		{name: "garbage", input: "soon", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.input); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeCookieForTokenRedirects(t *testing.T) {
+	tests := []struct {
+		name      string
+		redirects map[string]string
+		wantErr   string
+	}{
+		{
+			name: "follows same-site chain",
+			redirects: map[string]string{
+				"/ssb/redirect": "/?redir=%2Fclient",
+				"/":             "/client",
+			},
+		},
+		{
+			name: "signin is a hard error",
+			redirects: map[string]string{
+				"/ssb/redirect": "/signin?redir=%2Fssb%2Fredirect",
+			},
+			wantErr: "signed out",
+		},
+		{
+			name: "workspace signin is a hard error",
+			redirects: map[string]string{
+				"/ssb/redirect": "/workspace-signin",
+			},
+			wantErr: "cookie is not valid for workspace",
+		},
+		{
+			name: "off-site redirect is refused",
+			redirects: map[string]string{
+				"/ssb/redirect": "https://example.com/client",
+			},
+			wantErr: "refusing to follow redirect",
+		},
+		{
+			name: "redirect loop is bounded",
+			redirects: map[string]string{
+				"/ssb/redirect": "/loop",
+				"/loop":         "/loop",
+			},
+			wantErr: "stopped after 5 redirects",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Cookie"); got != "d=cookie" {
+					t.Errorf("%s: Cookie header = %q, want d=cookie", r.URL.Path, got)
+				}
+				if loc, ok := tt.redirects[r.URL.Path]; ok {
+					http.Redirect(w, r, loc, http.StatusFound)
+					return
+				}
+				if r.URL.Path == "/client" {
+					w.Write([]byte(`<script>{"api_token":"xoxc-abc"}</script>`))
+					return
+				}
+				http.NotFound(w, r)
+			}))
+			defer srv.Close()
+
+			got, err := exchangeCookieForToken(context.Background(), srv.Client(), srv.URL, "cookie")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("exchangeCookieForToken() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("exchangeCookieForToken() error: %v", err)
+			}
+			if got != "xoxc-abc" {
+				t.Errorf("exchangeCookieForToken() = %q, want xoxc-abc", got)
+			}
+		})
+	}
+}
+
+func TestExchangeCookieForTokenPageErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr error
+	}{
+		{name: "signin form", body: `<form id="signin_form" action="/signin">`, wantErr: ErrSignedOut},
+		{name: "cloudflare challenge", body: `<div id="cf-challenge-running">`, wantErr: ErrChallenged},
+		{name: "enterprise gate", body: `{"error":"enterprise_restricted"}`, wantErr: ErrEnterpriseGate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			_, err := exchangeCookieForToken(context.Background(), srv.Client(), srv.URL, "cookie")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("exchangeCookieForToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("unknown page", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<html>something new</html>"))
+		}))
+		defer srv.Close()
+
+		_, err := exchangeCookieForToken(context.Background(), srv.Client(), srv.URL, "cookie")
+		if err == nil || !strings.Contains(err.Error(), "api token not found") {
+			t.Errorf("exchangeCookieForToken() error = %v, want api token not found", err)
+		}
+		for _, known := range []error{ErrSignedOut, ErrChallenged, ErrEnterpriseGate} {
+			if errors.Is(err, known) {
+				t.Errorf("unknown page classified as %v", known)
+			}
+		}
+	})
+}
+
+func TestExchangeCookieForTokenBodyLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("x"), exchangeMaxBody))
+		w.Write([]byte(`{"api_token":"xoxc-abc"}`))
+	}))
+	defer srv.Close()
+
+	_, err := exchangeCookieForToken(context.Background(), srv.Client(), srv.URL, "cookie")
+	if err == nil || !strings.Contains(err.Error(), "larger than 4 MB") {
+		t.Errorf("exchangeCookieForToken() error = %v, want body limit error", err)
+	}
+}
+
+func TestReadCookieDB(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "Cookies")
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE cookies (host_key TEXT, name TEXT, value TEXT, encrypted_value BLOB)`,
+		`INSERT INTO cookies VALUES ('.slack.com', 'd', 'generic', x'')`,
+		`INSERT INTO cookies VALUES ('.enterprise.slack.com', 'd', 'enterprise', x'')`,
+		`INSERT INTO cookies VALUES ('.slack.com', 'lc', 'other', x'')`,
+		`INSERT INTO cookies VALUES ('.example.com', 'd', 'unrelated', x'')`,
+		`INSERT INTO cookies VALUES ('acme.slack.com', 'd', '', x'763130deadbeef')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	calls := 0
+	password := func() ([]byte, error) {
+		calls++
+		return []byte("peanuts"), nil
+	}
+	got, err := readCookieDB(dbPath, password)
+	if err != nil {
+		t.Fatalf("readCookieDB() error: %v", err)
+	}
+	want := []Cookie{{".slack.com", "generic"}, {".enterprise.slack.com", "enterprise"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("readCookieDB() = %v, want %v (the undecryptable cookie skipped)", got, want)
+	}
+	if calls != 1 {
+		t.Errorf("password called %d times, want 1", calls)
+	}
+}
+
+func TestReadCookieDBAppBound(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "Cookies")
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE cookies (host_key TEXT, name TEXT, value TEXT, encrypted_value BLOB)`,
+		`INSERT INTO cookies VALUES ('.slack.com', 'd', '', x'763230000102030405060708090a0b0c0d0e0f')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	_, err = readCookieDB(dbPath, func() ([]byte, error) { return []byte("peanuts"), nil })
+	if !errors.Is(err, ErrAppBoundEncryption) {
+		t.Errorf("readCookieDB() error = %v, want ErrAppBoundEncryption", err)
+	}
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wham/gh-slackdump/internal/redact"
+)
+
+// Outcomes of a Diagnosis.
+const (
+	DiagnosisPass = "pass"
+	DiagnosisWarn = "warn"
+	DiagnosisFail = "fail"
+)
+
+// Diagnosis is the outcome of one check of gh slackdump doctor.
+type Diagnosis struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+func pass(name, format string, a ...any) Diagnosis {
+	return Diagnosis{Name: name, Status: DiagnosisPass, Detail: fmt.Sprintf(format, a...)}
+}
+
+func warn(name, format string, a ...any) Diagnosis {
+	return Diagnosis{Name: name, Status: DiagnosisWarn, Detail: fmt.Sprintf(format, a...)}
+}
+
+func fail(name string, err error) Diagnosis {
+	return Diagnosis{Name: name, Status: DiagnosisFail, Detail: redact.Error(err).Error()}
+}
+
+// DiagnoseDesktopApp checks the Slack desktop app's configuration directory
+// and cookie database, and the expiry of its Slack "d" cookies, without
+// decrypting them, so the Keychain isn't asked.
+func DiagnoseDesktopApp(now time.Time) []Diagnosis {
+	dir, err := slackConfigDir()
+	if err != nil {
+		return []Diagnosis{fail("Slack desktop app", err)}
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return []Diagnosis{fail("Slack desktop app", fmt.Errorf("no configuration directory at %s — is the Slack desktop app installed?", dir))}
+	}
+	out := []Diagnosis{pass("Slack desktop app", "configuration directory %s", dir)}
+	dbPath, err := slackCookieDBPath()
+	if err != nil {
+		return append(out, fail("cookie database", err))
+	}
+	return append(out, diagnoseCookieDB(dbPath, now)...)
+}
+
+// diagnoseCookieDB checks that the Chromium cookie database at dbPath opens
+// and lists its Slack "d" cookies with their expiry, which Chromium keeps
+// in microseconds since 1601, 0 for a session cookie.
+func diagnoseCookieDB(dbPath string, now time.Time) []Diagnosis {
+	db, err := sql.Open("sqlite", dbPath+"?mode=ro")
+	if err != nil {
+		return []Diagnosis{fail("cookie database", err)}
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT host_key, expires_utc FROM cookies
+		WHERE name = 'd' AND (host_key IN ('slack.com', '.slack.com', 'slack-gov.com', '.slack-gov.com')
+			OR host_key LIKE '%.slack.com' OR host_key LIKE '%.slack-gov.com')`)
+	if err != nil {
+		return []Diagnosis{fail("cookie database", fmt.Errorf("%s: %w", dbPath, err))}
+	}
+	defer rows.Close()
+	var cookies []Diagnosis
+	for rows.Next() {
+		var domain string
+		var expires int64
+		if err := rows.Scan(&domain, &expires); err != nil {
+			return []Diagnosis{fail("cookie database", fmt.Errorf("%s: %w", dbPath, err))}
+		}
+		name := "cookie " + domain
+		switch {
+		case expires == 0:
+			cookies = append(cookies, pass(name, "session cookie, kept while the app runs"))
+		case chromiumTime(expires).Before(now):
+			cookies = append(cookies, warn(name, "expired %s — sign in to the workspace again in the Slack desktop app", chromiumTime(expires).Format(time.DateOnly)))
+		default:
+			cookies = append(cookies, pass(name, "expires %s", chromiumTime(expires).Format(time.DateOnly)))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return []Diagnosis{fail("cookie database", fmt.Errorf("%s: %w", dbPath, err))}
+	}
+	if len(cookies) == 0 {
+		return []Diagnosis{fail("cookie database", fmt.Errorf("%s holds no Slack cookies — sign in to a workspace in the Slack desktop app", dbPath))}
+	}
+	return append([]Diagnosis{pass("cookie database", "%s, %d Slack cookies", dbPath, len(cookies))}, cookies...)
+}
+
+// chromiumTime converts a Chromium timestamp, in microseconds since
+// 1601-01-01 UTC, to a time.
+func chromiumTime(us int64) time.Time {
+	const unixEpochOffset = 11644473600 // seconds from 1601 to 1970
+	return time.Unix(us/1e6-unixEpochOffset, us%1e6*1e3).UTC()
+}
+
+// DiagnoseKeychain checks the Keychain item whose password encrypts the
+// desktop app's cookies. Only with interactive is the password read, which
+// may show the Keychain's access prompt; otherwise the item is only looked
+// up, which never prompts.
+func DiagnoseKeychain(interactive bool) Diagnosis {
+	const name = "Keychain"
+	if !keychainSupport {
+		return warn(name, "this build can't read the Keychain; use --cookie-file, or a macOS build with cgo")
+	}
+	if !interactive {
+		account, err := keychainItem()
+		if err != nil {
+			return fail(name, err)
+		}
+		return pass(name, "\"Slack Safe Storage\" item for %q found; --interactive also reads it", account)
+	}
+	password, err := cookiePassword()
+	redact.Secret(string(password))
+	if err != nil {
+		return fail(name, err)
+	}
+	return pass(name, "\"Slack Safe Storage\" password read")
+}
+
+// DiagnoseCookieFile checks that the --cookie-file at path holds a cookie.
+func DiagnoseCookieFile(path string) Diagnosis {
+	cookies, err := FileSource{Path: path}.ReadCookies()
+	if err != nil {
+		return fail("cookie file", err)
+	}
+	redact.Secret(cookies[0].Value)
+	return pass("cookie file", "%s holds a cookie", path)
+}
+
+// slackAPITestURL is called to check that Slack is reachable; api.test
+// needs no token.
+var slackAPITestURL = "https://slack.com/api/api.test"
+
+// DiagnoseReachability calls Slack's api.test over the transport a dump
+// uses, uTLS fingerprint, CA bundle and pins included.
+func DiagnoseReachability(ctx context.Context, opts TransportOptions) Diagnosis {
+	const name = "network"
+	t, err := newTransport(opts)
+	if err != nil {
+		return fail(name, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, slackAPITestURL, nil)
+	if err != nil {
+		return fail(name, err)
+	}
+	start := time.Now()
+	resp, err := (&http.Client{Transport: t}).Do(req)
+	if err != nil {
+		return fail(name, fmt.Errorf("reaching slack.com: %w", err))
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"ok":true`) {
+		return fail(name, errors.New("slack.com answered api.test with "+resp.Status))
+	}
+	return pass(name, "slack.com reached in %s (%s)", elapsed, resp.Proto)
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDiagnoseCookieDB(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	// Chromium keeps expiries in microseconds since 1601-01-01.
+	chromium := func(t time.Time) int64 { return (t.Unix() + 11644473600) * 1e6 }
+	dbPath := filepath.Join(t.TempDir(), "Cookies")
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE cookies (host_key TEXT, name TEXT, value TEXT, encrypted_value BLOB, expires_utc INTEGER)`,
+		`INSERT INTO cookies VALUES ('.slack.com', 'd', '', x'763130', ` + strconv.FormatInt(chromium(now.AddDate(1, 0, 0)), 10) + `)`,
+		`INSERT INTO cookies VALUES ('.enterprise.slack.com', 'd', '', x'763130', ` + strconv.FormatInt(chromium(now.AddDate(0, -1, 0)), 10) + `)`,
+		`INSERT INTO cookies VALUES ('acme.slack.com', 'd', '', x'763130', 0)`,
+		`INSERT INTO cookies VALUES ('.slack.com', 'lc', 'other', x'', 0)`,
+		`INSERT INTO cookies VALUES ('.example.com', 'd', 'unrelated', x'', 0)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	got := diagnoseCookieDB(dbPath, now)
+	want := []Diagnosis{
+		{Name: "cookie database", Status: DiagnosisPass, Detail: dbPath + ", 3 Slack cookies"},
+		{Name: "cookie .slack.com", Status: DiagnosisPass, Detail: "expires 2025-06-01"},
+		{Name: "cookie .enterprise.slack.com", Status: DiagnosisWarn, Detail: "expired 2024-05-01 — sign in to the workspace again in the Slack desktop app"},
+		{Name: "cookie acme.slack.com", Status: DiagnosisPass, Detail: "session cookie, kept while the app runs"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("diagnoseCookieDB() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("diagnoseCookieDB()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if got := diagnoseCookieDB(filepath.Join(t.TempDir(), "missing"), now); got[0].Status != DiagnosisFail {
+		t.Errorf("diagnoseCookieDB(missing) = %+v, want a failure", got)
+	}
+}
+
+func TestDiagnoseReachability(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/api.test" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	writeCertPEM(t, bundle, srv.Certificate().Raw)
+	t.Setenv("SSL_CERT_FILE", "")
+
+	old := slackAPITestURL
+	defer func() { slackAPITestURL = old }()
+	for path, want := range map[string]string{"/api/api.test": DiagnosisPass, "/elsewhere": DiagnosisFail} {
+		slackAPITestURL = srv.URL + path
+		if got := DiagnoseReachability(context.Background(), TransportOptions{CABundle: bundle}); got.Status != want {
+			t.Errorf("DiagnoseReachability(%s) = %+v, want %s", path, got, want)
+		}
+	}
+	slackAPITestURL = srv.URL + "/api/api.test"
+	if got := DiagnoseReachability(context.Background(), TransportOptions{}); got.Status != DiagnosisFail {
+		t.Errorf("DiagnoseReachability() without the test CA = %+v, want a failure", got)
+	}
+}
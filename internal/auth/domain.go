@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Slack's domains: commercial Slack and GovSlack. Workspaces, the API and
+// the session cookie all live under one of them.
+const (
+	slackDomain    = "slack.com"
+	govSlackDomain = "slack-gov.com"
+)
+
+// SlackDomain returns the Slack domain host belongs to, or "" when it isn't
+// a Slack host.
+func SlackDomain(host string) string {
+	for _, d := range []string{slackDomain, govSlackDomain} {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return d
+		}
+	}
+	return ""
+}
+
+// IsEnterpriseHost reports whether host is an Enterprise Grid workspace,
+// e.g. myorg.enterprise.slack.com.
+func IsEnterpriseHost(host string) bool {
+	d := SlackDomain(host)
+	return d != "" && strings.HasSuffix(host, ".enterprise."+d)
+}
+
+// vanityMaxRedirects bounds the redirect chain ResolveSlackHost follows.
+const vanityMaxRedirects = 5
+
+// ResolveSlackHost follows the redirects of a link on a vanity host, e.g.
+// chat.example.com → example.enterprise.slack.com, and returns the first
+// Slack host reached. Only HEAD requests without credentials are sent, over
+// the same transport a dump would use.
+func ResolveSlackHost(ctx context.Context, link string, opts TransportOptions) (string, error) {
+	t, err := newTransport(opts)
+	if err != nil {
+		return "", err
+	}
+	return resolveSlackHost(ctx, &http.Client{Transport: t}, link)
+}
+
+func resolveSlackHost(ctx context.Context, client *http.Client, link string) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	noFollow := *client
+	noFollow.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	start := u.Hostname()
+	for hops := 0; ; hops++ {
+		if SlackDomain(u.Hostname()) != "" {
+			return u.Hostname(), nil
+		}
+		if hops == vanityMaxRedirects {
+			return "", fmt.Errorf("%s: no Slack host reached after %d redirects", start, vanityMaxRedirects)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := noFollow.Do(req)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		if !isRedirectStatus(resp.StatusCode) {
+			return "", fmt.Errorf("%s does not redirect to a Slack workspace (%s answered %d)", start, u.Hostname(), resp.StatusCode)
+		}
+		loc, err := resp.Location()
+		if err != nil {
+			return "", fmt.Errorf("redirect without location: %w", err)
+		}
+		slog.Debug("following vanity host redirect", "location", loc.Redacted())
+		u = loc
+	}
+}
+
+// apiURLFor returns the Slack Web API base URL for a workspace.
+func apiURLFor(workspaceURL string) string {
+	return "https://" + domainFor(workspaceURL) + "/api/"
+}
+
+// domainFor returns the Slack domain of a workspace URL, defaulting to
+// slack.com.
+func domainFor(workspaceURL string) string {
+	if u, err := url.Parse(workspaceURL); err == nil {
+		if d := SlackDomain(u.Hostname()); d != "" {
+			return d
+		}
+	}
+	return slackDomain
+}
+
+// apiHostTransport sends requests for slack.com to another Slack domain.
+// slackdump builds its API clients with slack.com hard-coded, so GovSlack
+// sessions reroute them here.
+type apiHostTransport struct {
+	base   http.RoundTripper
+	domain string
+}
+
+func (t *apiHostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if SlackDomain(host) != slackDomain || req.URL.Port() != "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.URL.Host = strings.TrimSuffix(host, slackDomain) + t.domain
+	req.Host = ""
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSlackDomain(t *testing.T) {
+	tests := []struct {
+		host           string
+		wantDomain     string
+		wantEnterprise bool
+	}{
+		{"myworkspace.slack.com", "slack.com", false},
+		{"myworkspace.enterprise.slack.com", "slack.com", true},
+		{"agency.slack-gov.com", "slack-gov.com", false},
+		{"agency.enterprise.slack-gov.com", "slack-gov.com", true},
+		{"slack.com", "slack.com", false},
+		{"enterprise.slack.com", "slack.com", false},
+		{"myworkspace.notslack.com", "", false},
+		{"example.com", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := SlackDomain(tt.host); got != tt.wantDomain {
+				t.Errorf("SlackDomain(%q) = %q, want %q", tt.host, got, tt.wantDomain)
+			}
+			if got := IsEnterpriseHost(tt.host); got != tt.wantEnterprise {
+				t.Errorf("IsEnterpriseHost(%q) = %v, want %v", tt.host, got, tt.wantEnterprise)
+			}
+		})
+	}
+}
+
+func TestAPIURLFor(t *testing.T) {
+	tests := []struct {
+		workspaceURL string
+		want         string
+	}{
+		{"https://myworkspace.slack.com", "https://slack.com/api/"},
+		{"https://myworkspace.enterprise.slack.com", "https://slack.com/api/"},
+		{"https://agency.slack-gov.com", "https://slack-gov.com/api/"},
+		{"https://agency.enterprise.slack-gov.com", "https://slack-gov.com/api/"},
+	}
+	for _, tt := range tests {
+		if got := apiURLFor(tt.workspaceURL); got != tt.want {
+			t.Errorf("apiURLFor(%q) = %q, want %q", tt.workspaceURL, got, tt.want)
+		}
+	}
+}
+
+type recordingTransport struct{ got []*url.URL }
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.got = append(r.got, req.URL)
+	return httptest.NewRecorder().Result(), nil
+}
+
+func TestAPIHostTransport(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://slack.com/api/auth.test", "https://slack-gov.com/api/auth.test"},
+		{"https://edgeapi.slack.com/cache/T1/users/info", "https://edgeapi.slack-gov.com/cache/T1/users/info"},
+		{"https://agency.slack-gov.com/ssb/redirect", "https://agency.slack-gov.com/ssb/redirect"},
+		{"https://files.example.com/a.png", "https://files.example.com/a.png"},
+	}
+	for _, tt := range tests {
+		rec := &recordingTransport{}
+		tr := &apiHostTransport{base: rec, domain: govSlackDomain}
+		req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+		if _, err := tr.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+		if got := rec.got[0].String(); got != tt.want {
+			t.Errorf("RoundTrip(%s) sent to %s, want %s", tt.url, got, tt.want)
+		}
+		if req.URL.String() != tt.url {
+			t.Errorf("RoundTrip modified the caller's request URL to %s", req.URL)
+		}
+	}
+}
+
+func TestResolveSlackHost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.Header.Get("Cookie") != "" {
+			t.Errorf("got %s with cookie %q, want a bare HEAD", r.Method, r.Header.Get("Cookie"))
+		}
+		switch r.URL.Path {
+		case "/archives/C1":
+			http.Redirect(w, r, "/sso/archives/C1", http.StatusFound)
+		case "/sso/archives/C1":
+			http.Redirect(w, r, "https://example.enterprise.slack.com/archives/C1", http.StatusMovedPermanently)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		link    string
+		want    string
+		wantErr string
+	}{
+		{name: "slack host needs no request", link: "https://acme.slack.com/archives/C1", want: "acme.slack.com"},
+		{name: "redirect chain", link: srv.URL + "/archives/C1", want: "example.enterprise.slack.com"},
+		{name: "no redirect", link: srv.URL + "/about", wantErr: "does not redirect to a Slack workspace"},
+		{name: "redirect loop", link: srv.URL + "/loop", wantErr: "after 5 redirects"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveSlackHost(context.Background(), srv.Client(), tt.link)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveSlackHost() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveSlackHost() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// acceptEncoding is sent on requests that don't set Accept-Encoding. It
+// lists only what decodeBody understands.
+const acceptEncoding = "gzip, deflate"
+
+// decodeBody replaces a gzip- or deflate-encoded response body with the
+// decoded stream and drops the headers that describe the encoded form, as
+// net/http's own transport does. Other encodings are left untouched.
+func decodeBody(resp *http.Response) {
+	enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if enc != "gzip" && enc != "deflate" {
+		return
+	}
+	resp.Body = &decodedBody{body: resp.Body, encoding: enc}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// decodedBody starts decoding on the first Read, so that a response whose
+// body is never read (e.g. a 204) doesn't fail on its missing header.
+type decodedBody struct {
+	body     io.ReadCloser
+	encoding string
+	r        io.Reader
+	err      error
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.r == nil && b.err == nil {
+		b.r, b.err = newDecoder(b.encoding, b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.r.Read(p)
+}
+
+func (b *decodedBody) Close() error {
+	return b.body.Close()
+}
+
+// newDecoder returns a reader decoding r. "deflate" is meant to be zlib
+// framed, but some servers send raw DEFLATE; both are accepted.
+func newDecoder(encoding string, r io.Reader) (io.Reader, error) {
+	if encoding == "gzip" {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("decoding gzip response: %w", err)
+		}
+		return zr, nil
+	}
+	br := bufio.NewReader(r)
+	if h, err := br.Peek(2); err == nil && isZlibHeader(h) {
+		zr, err := zlib.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("decoding deflate response: %w", err)
+		}
+		return zr, nil
+	}
+	return flate.NewReader(br), nil
+}
+
+// isZlibHeader reports whether h starts a zlib stream (RFC 1950).
+func isZlibHeader(h []byte) bool {
+	return h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0
+}
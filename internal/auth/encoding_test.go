@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const encodedPage = `<script>{"api_token":"xoxc-abc"}</script>`
+
+// encodingHandler compresses encodedPage with the encoding named by the
+// "enc" query parameter.
+func encodingHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := r.URL.Query().Get("enc")
+		if enc == "" {
+			w.Write([]byte(encodedPage))
+			return
+		}
+		if got := r.Header.Get("Accept-Encoding"); got != acceptEncoding {
+			t.Errorf("Accept-Encoding = %q, want %q", got, acceptEncoding)
+		}
+		var buf bytes.Buffer
+		var zw io.WriteCloser
+		switch enc {
+		case "gzip":
+			zw = gzip.NewWriter(&buf)
+		case "deflate":
+			zw = zlib.NewWriter(&buf)
+		case "raw-deflate":
+			zw, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+			enc = "deflate"
+		}
+		zw.Write([]byte(encodedPage))
+		zw.Close()
+		w.Header().Set("Content-Encoding", enc)
+		w.Write(buf.Bytes())
+	})
+}
+
+func TestUTLSTransportDecodesBody(t *testing.T) {
+	h1 := httptest.NewUnstartedServer(encodingHandler(t))
+	h1.StartTLS()
+	defer h1.Close()
+	h2 := httptest.NewUnstartedServer(encodingHandler(t))
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+
+	tr, err := newUTLSTransport(TransportOptions{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.proxy = nil
+	client := &http.Client{Transport: tr}
+
+	for _, srv := range []struct {
+		name  string
+		url   string
+		proto int
+	}{{"http/1.1", h1.URL, 1}, {"h2", h2.URL, 2}} {
+		for _, enc := range []string{"", "gzip", "deflate", "raw-deflate"} {
+			t.Run(srv.name+"/"+enc, func(t *testing.T) {
+				resp, err := client.Get(srv.url + "/?enc=" + enc)
+				if err != nil {
+					t.Fatalf("Get() error: %v", err)
+				}
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatalf("reading body: %v", err)
+				}
+				if resp.ProtoMajor != srv.proto {
+					t.Errorf("protocol = %s, want HTTP/%d", resp.Proto, srv.proto)
+				}
+				if string(body) != encodedPage {
+					t.Errorf("body = %q, want decoded page", body)
+				}
+				if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+					t.Errorf("Content-Encoding = %q, want it removed", ce)
+				}
+			})
+		}
+	}
+}
+
+func TestUTLSTransportKeepsCallerEncoding(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write([]byte("not really gzip"))
+	}))
+	srv.StartTLS()
+	defer srv.Close()
+
+	tr, err := newUTLSTransport(TransportOptions{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.proxy = nil
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "not really gzip" || resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Errorf("got %q with Content-Encoding %q, want the body untouched", body, resp.Header.Get("Content-Encoding"))
+	}
+}
+
+func TestDecodeBodyInvalid(t *testing.T) {
+	resp := &http.Response{
+		Header: http.Header{"Content-Encoding": {"gzip"}},
+		Body:   io.NopCloser(strings.NewReader("not gzip")),
+	}
+	decodeBody(resp)
+	if _, err := io.ReadAll(resp.Body); err == nil || !strings.Contains(err.Error(), "decoding gzip response") {
+		t.Errorf("reading body error = %v, want a gzip decoding error", err)
+	}
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// certPins maps a host to the accepted base64 SHA-256 hashes of a
+// certificate's SubjectPublicKeyInfo. A host entry also covers its
+// subdomains unless a more specific entry exists.
+type certPins map[string][]string
+
+// loadPins reads a pin file. Each non-empty line holds a host and a base64
+// SPKI SHA-256 hash, optionally prefixed with "sha256/"; lines starting with
+// # are comments.
+//
+// No pins are built in: Slack rotates certificates and intermediates, and a
+// stale compiled-in pin would lock every user out, so pins always come from
+// a file the user keeps current.
+func loadPins(path string) (certPins, error) {
+	if path == "" {
+		return nil, errors.New("--pin-slack-certs needs a pin file (--pin-file)")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading pin file: %w", err)
+	}
+	defer f.Close()
+
+	pins := make(certPins)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("pin file %s:%d: want \"<host> <sha256>\"", path, n)
+		}
+		hash := strings.TrimPrefix(fields[1], "sha256/")
+		if b, err := base64.StdEncoding.DecodeString(hash); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("pin file %s:%d: %q is not a base64 SHA-256 hash", path, n, fields[1])
+		}
+		host := strings.ToLower(fields[0])
+		pins[host] = append(pins[host], hash)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(pins) == 0 {
+		return nil, fmt.Errorf("pin file %s has no pins", path)
+	}
+	return pins, nil
+}
+
+// forHost returns the pins for host, preferring the most specific entry.
+func (p certPins) forHost(host string) []string {
+	host = strings.ToLower(host)
+	for h := host; h != ""; {
+		if pins, ok := p[h]; ok {
+			return pins
+		}
+		_, parent, found := strings.Cut(h, ".")
+		if !found {
+			break
+		}
+		h = parent
+	}
+	return nil
+}
+
+// verify checks that one of the certificates served for host matches a pin.
+// It fails closed when host has no pins.
+func (p certPins) verify(host string, certs []*x509.Certificate) error {
+	pins := p.forHost(host)
+	if len(pins) == 0 {
+		return fmt.Errorf("certificate pinning: no pins for %s", host)
+	}
+	for _, c := range certs {
+		if slices.Contains(pins, spkiHash(c)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("certificate pinning: certificates served for %s match no pin — the connection may be intercepted", host)
+}
+
+// spkiHash returns the base64 SHA-256 hash of a certificate's public key info.
+func spkiHash(c *x509.Certificate) string {
+	sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
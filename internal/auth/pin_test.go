@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePinFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pins.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPins(t *testing.T) {
+	hash := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: "# comment\nslack.com " + hash + "\nfiles.slack.com sha256/" + hash + "\n"},
+		{name: "missing hash", content: "slack.com\n", wantErr: true},
+		{name: "bad hash", content: "slack.com abc\n", wantErr: true},
+		{name: "empty", content: "# nothing\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadPins(writePinFile(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadPins() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := loadPins(""); err == nil {
+		t.Error("loadPins(\"\") should require a pin file")
+	}
+}
+
+func TestCertPinsForHost(t *testing.T) {
+	pins := certPins{
+		"slack.com":       {"general"},
+		"files.slack.com": {"files"},
+	}
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "slack.com", want: "general"},
+		{host: "myworkspace.slack.com", want: "general"},
+		{host: "FILES.slack.com", want: "files"},
+		{host: "example.com", want: ""},
+	}
+	for _, tt := range tests {
+		got := strings.Join(pins.forHost(tt.host), ",")
+		if got != tt.want {
+			t.Errorf("forHost(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestUTLSTransportPinning(t *testing.T) {
+	srv := startTLSServer(t)
+	t.Setenv("SSL_CERT_FILE", "")
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	writeCertPEM(t, caBundle, srv.Certificate().Raw)
+	served := spkiHash(srv.Certificate())
+	other := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	tests := []struct {
+		name    string
+		pins    string
+		wantErr string
+	}{
+		{name: "matching pin", pins: "127.0.0.1 " + served},
+		{name: "mismatched pin", pins: "127.0.0.1 " + other, wantErr: "served for 127.0.0.1 match no pin"},
+		{name: "host without pins", pins: "slack.com " + served, wantErr: "no pins for 127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := newUTLSTransport(TransportOptions{
+				CABundle:      caBundle,
+				PinSlackCerts: true,
+				PinFile:       writePinFile(t, tt.pins),
+			})
+			if err != nil {
+				t.Fatalf("newUTLSTransport() error: %v", err)
+			}
+			tr.proxy = nil
+			resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Get() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get() error: %v", err)
+			}
+			resp.Body.Close()
+		})
+	}
+
+	_, err := newUTLSTransport(TransportOptions{
+		InsecureSkipVerify: true,
+		PinSlackCerts:      true,
+		PinFile:            writePinFile(t, "127.0.0.1 "+served),
+	})
+	if err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("newUTLSTransport() error = %v, want mutually exclusive", err)
+	}
+}
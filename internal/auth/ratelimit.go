@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wham/gh-slackdump/internal/errs"
+	"golang.org/x/time/rate"
+)
+
+// DefaultRateLimit is the default request rate in requests per second:
+// Slack's Tier 3, 50 requests per minute.
+const DefaultRateLimit = 50.0 / 60
+
+const (
+	// rateLimitBurst is how many requests may be sent back to back before
+	// pacing starts, the same burst slackdump allows for Tier 3 methods.
+	rateLimitBurst = 5
+	// rateLimitMaxRetries bounds how many times one request is retried after
+	// a 429.
+	rateLimitMaxRetries = 5
+	// downloadShare is the part of the rate downloads may take, so a busy
+	// download pool can't starve the API calls of the rest.
+	downloadShare = 0.5
+)
+
+// DefaultOutageMaxWait is how long an outage is waited out by default
+// before giving up.
+const DefaultOutageMaxWait = 10 * time.Minute
+
+// outageMaxBackoff caps the wait between retries during an outage.
+const outageMaxBackoff = 2 * time.Minute
+
+// ErrSlackOutage means the Slack API kept answering with an HTML page, such
+// as a maintenance or incident page, for longer than the outage budget.
+var ErrSlackOutage = errs.New(errs.ErrUnavailable, "Slack API is answering with HTML pages instead of JSON")
+
+var (
+	// defaultRetryAfter is the wait after a 429 without a usable
+	// Retry-After. Tests shorten it.
+	defaultRetryAfter = time.Second
+	// outageInitialWait is the first wait after an HTML answer from the API;
+	// it doubles on each consecutive one. Tests shorten it.
+	outageInitialWait = 10 * time.Second
+)
+
+// RequestStats counts the requests sent through a Provider's HTTP clients.
+type RequestStats struct {
+	Requests    int
+	RateLimited int
+	// Waited is the time spent pacing and sleeping out 429s and outages.
+	Waited time.Duration
+}
+
+// pacer is the token bucket shared by every HTTP client of a Provider, its
+// counters, and the state of an ongoing outage.
+type pacer struct {
+	limiter *rate.Limiter
+	// downloads holds downloads to their share of limiter's rate; they
+	// take from both.
+	downloads *rate.Limiter
+	// outageBudget is how long an outage is waited out.
+	outageBudget time.Duration
+
+	mu    sync.Mutex
+	stats RequestStats
+	// outageSince is when the current outage was first seen, zero when the
+	// API is answering normally; outageBackoff is the next wait.
+	outageSince   time.Time
+	outageBackoff time.Duration
+	// backoffUntil is when the API's current wait for a 429 or an outage
+	// ends, zero or past when the API isn't waiting.
+	backoffUntil time.Time
+}
+
+// newPacer returns a pacer allowing perSecond requests per second; zero or
+// less disables pacing, but 429s are still retried. Outages are waited out
+// for outageBudget, or DefaultOutageMaxWait when it is zero.
+func newPacer(perSecond float64, outageBudget time.Duration) *pacer {
+	limit := rate.Limit(perSecond)
+	if perSecond <= 0 {
+		limit = rate.Inf
+	}
+	if outageBudget == 0 {
+		outageBudget = DefaultOutageMaxWait
+	}
+	return &pacer{
+		limiter:      rate.NewLimiter(limit, rateLimitBurst),
+		downloads:    rate.NewLimiter(limit*downloadShare, max(rateLimitBurst/2, 1)),
+		outageBudget: outageBudget,
+	}
+}
+
+// outageWait returns how long to wait before retrying after an HTML answer,
+// backing off exponentially, or ErrSlackOutage once the outage has lasted
+// for the whole budget.
+func (p *pacer) outageWait(now time.Time) (time.Duration, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.outageSince.IsZero() {
+		p.outageSince, p.outageBackoff = now, outageInitialWait
+	}
+	left := p.outageBudget - now.Sub(p.outageSince)
+	if left <= 0 {
+		return 0, fmt.Errorf("%w for %s", ErrSlackOutage, p.outageBudget)
+	}
+	wait := min(p.outageBackoff, left)
+	p.outageBackoff = min(p.outageBackoff*2, outageMaxBackoff)
+	return wait, nil
+}
+
+// outageOver records a normal answer, ending any outage.
+func (p *pacer) outageOver() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.outageSince = time.Time{}
+}
+
+// backOff records that an API request waits until until, so that
+// yield holds other traffic back until then.
+func (p *pacer) backOff(until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if until.After(p.backoffUntil) {
+		p.backoffUntil = until
+	}
+}
+
+// yield waits while an API request is waiting out a 429 or an outage, and
+// until the context is done.
+func (p *pacer) yield(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		wait := time.Until(p.backoffUntil)
+		p.mu.Unlock()
+		if wait <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// wait waits for req's turn: a download for its share of the rate first,
+// then every request for the rate shared with the API calls.
+func (p *pacer) wait(ctx context.Context, req *http.Request) error {
+	start := time.Now()
+	defer func() { p.record(func(s *RequestStats) { s.Waited += time.Since(start) }) }()
+	if !isAPIRequest(req) {
+		if err := p.downloads.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return p.limiter.Wait(ctx)
+}
+
+func (p *pacer) record(f func(*RequestStats)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f(&p.stats)
+}
+
+func (p *pacer) snapshot() RequestStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// rateLimitTransport paces requests through a pacer: Web API calls and
+// downloads, from files.slack.com or the emoji CDN, take from the same
+// budget, so together they stay within Slack's tier. Downloads are held to
+// downloadShare of it, so the API calls always keep the rest.
+//
+// A 429, to an API call or a download, is slept out for its Retry-After and
+// the request sent again. An HTML page answering an API call (an outage or
+// maintenance page) is backed off from until the pacer's outage budget runs
+// out. The pacer records how long the API waits, for downloads to yield to.
+type rateLimitTransport struct {
+	base  http.RoundTripper
+	pacer *pacer
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	// A body that can't be replayed can't be retried.
+	replayable := req.Body == nil || req.GetBody != nil
+	limited := 0
+	for {
+		if err := t.pacer.wait(ctx, req); err != nil {
+			return nil, err
+		}
+		resp, err := t.base.RoundTrip(req)
+		t.pacer.record(func(s *RequestStats) { s.Requests++ })
+		if err != nil {
+			return resp, err
+		}
+
+		var wait time.Duration
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			t.pacer.record(func(s *RequestStats) { s.RateLimited++ })
+			limited++
+			if limited > rateLimitMaxRetries || !replayable {
+				return resp, nil
+			}
+			resp.Body.Close()
+			wait = parseRetryAfter(resp.Header.Get("Retry-After"))
+			if wait == 0 {
+				wait = defaultRetryAfter
+			}
+			slog.Info("rate limited, waiting", "host", req.URL.Host, "path", req.URL.Path, "attempt", limited, "retry_after", wait)
+		case isOutagePage(req, resp):
+			resp.Body.Close()
+			if wait, err = t.pacer.outageWait(time.Now()); err != nil {
+				return nil, err
+			}
+			if !replayable {
+				return nil, fmt.Errorf("%w (%s)", ErrSlackOutage, req.URL.Path)
+			}
+			slog.Warn("Slack API answered with an HTML page, likely an outage; waiting", "path", req.URL.Path, "status", resp.StatusCode, "wait", wait)
+		default:
+			t.pacer.outageOver()
+			return resp, nil
+		}
+
+		start := time.Now()
+		if isAPIRequest(req) {
+			t.pacer.backOff(start.Add(wait))
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		t.pacer.record(func(s *RequestStats) { s.Waited += time.Since(start) })
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// isAPIRequest reports whether req calls a Slack Web API method.
+func isAPIRequest(req *http.Request) bool {
+	return strings.HasPrefix(req.URL.Path, "/api/")
+}
+
+// isOutagePage reports whether resp is an HTML page answering a Web API
+// call, which always answers JSON when Slack is up.
+func isOutagePage(req *http.Request, resp *http.Response) bool {
+	if !isAPIRequest(req) {
+		return false
+	}
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mt == "text/html"
+}
@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wham/gh-slackdump/internal/errs"
+)
+
+// throttlingServer answers the first limited requests with 429 and the rest
+// with the request body echoed back.
+func throttlingServer(t *testing.T, limited int) *httptest.Server {
+	t.Helper()
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		if n <= limited {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRateLimitTransportRetries(t *testing.T) {
+	defaultRetryAfter = time.Millisecond
+	t.Cleanup(func() { defaultRetryAfter = time.Second })
+
+	srv := throttlingServer(t, 2)
+	p := newPacer(0, 0)
+	client := &http.Client{Transport: &rateLimitTransport{base: http.DefaultTransport, pacer: p}}
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("cursor=abc"))
+	if err != nil {
+		t.Fatalf("Post() error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "cursor=abc" {
+		t.Errorf("got %d %q, want 200 with the request body replayed", resp.StatusCode, body)
+	}
+	if s := p.snapshot(); s.Requests != 3 || s.RateLimited != 2 || s.Waited <= 0 {
+		t.Errorf("stats = %+v, want 3 requests, 2 rate limited, some wait", s)
+	}
+}
+
+func TestRateLimitTransportGivesUp(t *testing.T) {
+	defaultRetryAfter = time.Millisecond
+	t.Cleanup(func() { defaultRetryAfter = time.Second })
+
+	srv := throttlingServer(t, rateLimitMaxRetries+10)
+	p := newPacer(0, 0)
+	client := &http.Client{Transport: &rateLimitTransport{base: http.DefaultTransport, pacer: p}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429 after the retries run out", resp.StatusCode)
+	}
+	if s := p.snapshot(); s.Requests != rateLimitMaxRetries+1 {
+		t.Errorf("requests = %d, want %d", s.Requests, rateLimitMaxRetries+1)
+	}
+}
+
+func TestRateLimitTransportPaces(t *testing.T) {
+	srv := throttlingServer(t, 0)
+	p := newPacer(20, 0)
+	client := &http.Client{Transport: &rateLimitTransport{base: http.DefaultTransport, pacer: p}}
+	start := time.Now()
+	for range rateLimitBurst + 2 {
+		resp, err := client.Get(srv.URL + "/api/conversations.history")
+		if err != nil {
+			t.Fatalf("Get() error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	// The burst goes out at once; the two requests after it wait 50ms each.
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("%d requests took %s, want them paced to 20/s after the burst", rateLimitBurst+2, elapsed)
+	}
+	if s := p.snapshot(); s.Requests != rateLimitBurst+2 || s.Waited < 90*time.Millisecond {
+		t.Errorf("stats = %+v, want %d requests and the pacing wait counted", s, rateLimitBurst+2)
+	}
+}
+
+func TestRateLimitTransportPacesDownloads(t *testing.T) {
+	srv := throttlingServer(t, 0)
+	p := newPacer(20, 0)
+	client := &http.Client{Transport: &rateLimitTransport{base: http.DefaultTransport, pacer: p}}
+	get := func(path string) {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("Get() error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	// The API calls use up the burst, so the downloads wait for the
+	// budget they share.
+	for range rateLimitBurst {
+		get("/api/conversations.history")
+	}
+	start := time.Now()
+	for range 2 {
+		get("/files-pri/T1-F1/download/report.pdf")
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("2 downloads after the API's burst took %s, want them paced to 20/s", elapsed)
+	}
+	if s := p.snapshot(); s.Requests != rateLimitBurst+2 {
+		t.Errorf("stats = %+v, want the downloads counted", s)
+	}
+}
+
+func TestPacerDownloadShare(t *testing.T) {
+	p := newPacer(100, 0)
+	download := httptest.NewRequest(http.MethodGet, "https://files.slack.com/files-pri/T1-F1/download/report.pdf", nil)
+	api := httptest.NewRequest(http.MethodGet, "https://slack.com/api/conversations.history", nil)
+
+	start := time.Now()
+	for range 12 {
+		if err := p.wait(t.Context(), download); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("12 downloads took %s, want them held to half of 100/s", elapsed)
+	}
+	// The downloads left the API calls their half, so the API's burst is
+	// still there.
+	start = time.Now()
+	for range rateLimitBurst {
+		if err := p.wait(t.Context(), api); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 30*time.Millisecond {
+		t.Errorf("%d API calls after the downloads took %s, want them not kept waiting", rateLimitBurst, elapsed)
+	}
+}
+
+func TestRateLimitTransportBacksOff(t *testing.T) {
+	// Each path is answered 429 once.
+	limited := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limited[r.URL.Path] {
+			limited[r.URL.Path] = true
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+	p := newPacer(0, 0)
+	client := &http.Client{Transport: &rateLimitTransport{base: http.DefaultTransport, pacer: p}}
+
+	// A download's 429 is its own; only the API's make others yield.
+	resp, err := client.Get(srv.URL + "/files-pri/T1-F1/download/report.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := p.yield(t.Context()); err != nil {
+		t.Fatalf("yield() = %v with no API wait", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if resp, err := client.Get(srv.URL + "/api/conversations.history"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if err := p.yield(t.Context()); err != nil {
+		t.Fatalf("yield() = %v", err)
+	}
+	if waited := time.Since(start); waited < 500*time.Millisecond {
+		t.Errorf("yield() returned after %s, want it to wait out the API's 1s Retry-After", waited)
+	}
+	<-done
+}
+
+// pagingServer serves a three-page users.list and answers the requests for
+// page 2 with an HTML incident page the first outage times.
+func pagingServer(t *testing.T, outage int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		cursor := r.Form.Get("cursor")
+		if cursor == "2" && outage > 0 {
+			outage--
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html><body>Slack is having trouble. See status.slack.com</body></html>"))
+			return
+		}
+		next := map[string]string{"": "2", "2": "3", "3": ""}[cursor]
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprintf(w, `{"ok":true,"members":[],"response_metadata":{"next_cursor":%q}}`, next)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// fetchPages pages through users.list and returns the cursors requested.
+func fetchPages(client *http.Client, apiURL string) ([]string, error) {
+	var cursors []string
+	cursor := ""
+	for {
+		cursors = append(cursors, cursor)
+		resp, err := client.PostForm(apiURL+"users.list", url.Values{"cursor": {cursor}})
+		if err != nil {
+			return cursors, err
+		}
+		var body struct {
+			ResponseMetadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return cursors, err
+		}
+		if cursor = body.ResponseMetadata.NextCursor; cursor == "" {
+			return cursors, nil
+		}
+	}
+}
+
+func TestRateLimitTransportOutage(t *testing.T) {
+	outageInitialWait = time.Millisecond
+	t.Cleanup(func() { outageInitialWait = 10 * time.Second })
+
+	t.Run("recovers", func(t *testing.T) {
+		srv := pagingServer(t, 3)
+		p := newPacer(0, time.Minute)
+		client := &http.Client{Transport: &rateLimitTransport{base: http.DefaultTransport, pacer: p}}
+		cursors, err := fetchPages(client, srv.URL+"/api/")
+		if err != nil {
+			t.Fatalf("paging error: %v", err)
+		}
+		if !slices.Equal(cursors, []string{"", "2", "3"}) {
+			t.Errorf("requested cursors %q, want every page once", cursors)
+		}
+		if s := p.snapshot(); s.Requests != 6 {
+			t.Errorf("requests = %d, want 3 pages and 3 retries", s.Requests)
+		}
+	})
+	t.Run("outlasts the budget", func(t *testing.T) {
+		srv := pagingServer(t, 1000)
+		p := newPacer(0, 20*time.Millisecond)
+		client := &http.Client{Transport: &rateLimitTransport{base: http.DefaultTransport, pacer: p}}
+		_, err := fetchPages(client, srv.URL+"/api/")
+		if !errors.Is(err, ErrSlackOutage) || !errors.Is(err, errs.ErrUnavailable) {
+			t.Fatalf("paging error = %v, want ErrSlackOutage, an errs.ErrUnavailable", err)
+		}
+	})
+	t.Run("html outside the api is passed on", func(t *testing.T) {
+		srv := pagingServer(t, 1)
+		client := &http.Client{Transport: &rateLimitTransport{base: http.DefaultTransport, pacer: newPacer(0, 0)}}
+		resp, err := client.PostForm(srv.URL+"/ssb/redirect", url.Values{"cursor": {"2"}})
+		if err != nil {
+			t.Fatalf("PostForm() error: %v", err)
+		}
+		resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("Content-Type = %q, want the HTML page", ct)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Errors from the security CLI fallback that callers tell apart.
+var (
+	// errKeychainItemNotFound means the keychain has no such item.
+	errKeychainItemNotFound = errors.New("keychain item not found")
+	// errKeychainDenied means the user denied access in the Keychain prompt.
+	errKeychainDenied = errors.New("keychain access denied")
+)
+
+// security exit codes, which are Security framework result codes truncated
+// to a byte: errSecItemNotFound (-25300) and errSecUserCanceled (-128).
+const (
+	securityExitItemNotFound = 44
+	securityExitUserCanceled = 128
+)
+
+// runSecurity runs the macOS security CLI, returning its stdout, stderr, and
+// exit code. Tests replace it.
+var runSecurity = func(args ...string) (stdout, stderr []byte, exitCode int, err error) {
+	var out, errOut bytes.Buffer
+	cmd := exec.Command("/usr/bin/security", args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return out.Bytes(), errOut.Bytes(), exitErr.ExitCode(), nil
+	}
+	return out.Bytes(), errOut.Bytes(), 0, err
+}
+
+// passwordFromSecurityCLI reads the Slack Safe Storage password for account
+// with `security find-generic-password`, for builds where the Keychain API
+// can't be used.
+func passwordFromSecurityCLI(account string) ([]byte, error) {
+	stdout, stderr, code, err := runSecurity("find-generic-password", "-s", "Slack Safe Storage", "-a", account, "-w")
+	if err != nil {
+		return nil, fmt.Errorf("running security: %w", err)
+	}
+	msg := strings.TrimSpace(string(stderr))
+	switch {
+	case code == 0:
+		// -w prints the password followed by a newline.
+		password := bytes.TrimSuffix(stdout, []byte("\n"))
+		if len(password) == 0 {
+			return nil, errors.New("security printed an empty password")
+		}
+		return password, nil
+	case code == securityExitItemNotFound:
+		return nil, fmt.Errorf("%w: %s", errKeychainItemNotFound, account)
+	case code == securityExitUserCanceled || strings.Contains(strings.ToLower(msg), "user canceled"):
+		return nil, fmt.Errorf("%w for %s", errKeychainDenied, account)
+	}
+	return nil, fmt.Errorf("security exited with status %d: %s", code, msg)
+}
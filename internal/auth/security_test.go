@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestPasswordFromSecurityCLI(t *testing.T) {
+	tests := []struct {
+		name     string
+		stdout   string
+		stderr   string
+		code     int
+		runErr   error
+		want     string
+		wantErr  error
+		anyError bool
+	}{
+		{name: "password", stdout: "s3cret==\n", want: "s3cret=="},
+		{name: "password without newline", stdout: "s3cret==", want: "s3cret=="},
+		{name: "empty password", stdout: "\n", anyError: true},
+		{
+			name:    "item not found",
+			stderr:  "security: SecKeychainSearchCopyNext: The specified item could not be found in the keychain.",
+			code:    44,
+			wantErr: errKeychainItemNotFound,
+		},
+		{name: "user denied", code: 128, wantErr: errKeychainDenied},
+		{name: "user canceled message", stderr: "security: User canceled the operation.", code: 1, wantErr: errKeychainDenied},
+		{name: "other failure", stderr: "security: boom", code: 51, anyError: true},
+		{name: "not runnable", runErr: errors.New("exec: not found"), anyError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotArgs []string
+			orig := runSecurity
+			runSecurity = func(args ...string) ([]byte, []byte, int, error) {
+				gotArgs = args
+				return []byte(tt.stdout), []byte(tt.stderr), tt.code, tt.runErr
+			}
+			t.Cleanup(func() { runSecurity = orig })
+
+			got, err := passwordFromSecurityCLI("Slack Key")
+			wantArgs := []string{"find-generic-password", "-s", "Slack Safe Storage", "-a", "Slack Key", "-w"}
+			if !slices.Equal(gotArgs, wantArgs) {
+				t.Errorf("security args = %q, want %q", gotArgs, wantArgs)
+			}
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("passwordFromSecurityCLI() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.anyError:
+				if err == nil {
+					t.Errorf("passwordFromSecurityCLI() = %q, want an error", got)
+				}
+			default:
+				if err != nil || string(got) != tt.want {
+					t.Errorf("passwordFromSecurityCLI() = %q, %v, want %q", got, err, tt.want)
+				}
+			}
+		})
+	}
+}
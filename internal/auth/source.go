@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/wham/gh-slackdump/internal/redact"
+)
+
+// Cookie is a Slack "d" session cookie and the domain it is set for. An
+// empty Domain applies to every workspace.
+type Cookie struct {
+	Domain string
+	Value  string
+}
+
+// AuthSource is somewhere Slack session cookies can be read from.
+type AuthSource interface {
+	// Name describes the source in logs.
+	Name() string
+	// ReadCookies returns every "d" cookie the source holds; the ones that
+	// apply to a workspace are picked by domain.
+	ReadCookies() ([]Cookie, error)
+}
+
+// DefaultSources returns the sources used when none is chosen: the Slack
+// desktop app.
+func DefaultSources() []AuthSource {
+	return []AuthSource{DesktopSource{}}
+}
+
+// FileSource reads a "d" cookie value from a file, e.g. one copied from a
+// browser's developer tools. It applies to every workspace.
+type FileSource struct {
+	Path string
+}
+
+func (s FileSource) Name() string { return "file " + s.Path }
+
+func (s FileSource) ReadCookies() ([]Cookie, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("reading Slack cookie: %w", err)
+	}
+	v := strings.TrimSpace(string(data))
+	if !isPlainCookie([]byte(v)) {
+		return nil, fmt.Errorf("reading Slack cookie: %s does not hold a single cookie value", s.Path)
+	}
+	return []Cookie{{Value: v}}, nil
+}
+
+// tokenExchanger exchanges a cookie for a Slack API token.
+type tokenExchanger func(ctx context.Context, workspaceURL, cookie string) (string, error)
+
+// candidate is a cookie that applies to the workspace and its source.
+type candidate struct {
+	Cookie
+	source string
+}
+
+// cookiesFor reads the cookies that apply to the workspace from each source
+// in turn: a source's cookies all come before the next source's, most
+// specific domain first. A source that fails to read is skipped; its error
+// is returned only when no source has a cookie for the workspace.
+func cookiesFor(sources []AuthSource, workspaceURL string) ([]candidate, error) {
+	u, err := url.Parse(workspaceURL)
+	if err != nil {
+		return nil, err
+	}
+	var out []candidate
+	var lastErr error
+	for _, s := range sources {
+		cookies, err := s.ReadCookies()
+		if err != nil {
+			slog.Debug("skipping cookie source", "source", s.Name(), "error", err)
+			lastErr = err
+			continue
+		}
+		for _, c := range cookiesForHost(cookies, u.Hostname()) {
+			redact.Secret(c.Value)
+			out = append(out, candidate{Cookie: c, source: s.Name()})
+		}
+	}
+	if len(out) > 0 {
+		return out, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("no Slack cookies found for %s — sign in to this workspace in the Slack desktop app", u.Hostname())
+}
+
+// cookiesForHost returns the cookies a browser would send to host, most
+// specific domain first: the exact host, then a parent such as
+// .enterprise.slack.com, then .slack.com.
+func cookiesForHost(cookies []Cookie, host string) []Cookie {
+	var out []Cookie
+	for _, c := range cookies {
+		d := strings.TrimPrefix(c.Domain, ".")
+		if d == "" || host == d || strings.HasSuffix(host, "."+d) {
+			out = append(out, c)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b Cookie) int {
+		return len(strings.TrimPrefix(b.Domain, ".")) - len(strings.TrimPrefix(a.Domain, "."))
+	})
+	return out
+}
+
+// exchangeFirst tries each cookie in turn and returns the token from the
+// first one the workspace accepts.
+func exchangeFirst(ctx context.Context, exchange tokenExchanger, workspaceURL string, cookies []candidate) (string, candidate, error) {
+	var lastErr error
+	for _, c := range cookies {
+		slog.Info("trying cookie", "source", c.source, "domain", c.Domain)
+		token, err := exchange(ctx, workspaceURL, c.Value)
+		if err == nil {
+			return token, c, nil
+		}
+		if ctx.Err() != nil {
+			return "", candidate{}, err
+		}
+		slog.Debug("cookie rejected", "source", c.source, "domain", c.Domain, "error", err)
+		lastErr = err
+	}
+	return "", candidate{}, lastErr
+}
+
+// ReadCookie reads the Slack "d" cookie from sources. With a workspace URL it
+// returns the first source's cookie that best matches the workspace host;
+// otherwise it prefers the one for .slack.com.
+func ReadCookie(workspaceURL string, sources []AuthSource) (string, error) {
+	if workspaceURL == "" {
+		workspaceURL = "https://slack.com"
+	}
+	cookies, err := cookiesFor(sources, workspaceURL)
+	if err != nil {
+		return "", err
+	}
+	slog.Info("using Slack cookie", "source", cookies[0].source, "domain", cookies[0].Domain, "candidates", len(cookies))
+	return cookies[0].Value, nil
+}
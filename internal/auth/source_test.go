@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/wham/gh-slackdump/internal/errs"
+)
+
+// fakeSource is an AuthSource with fixed cookies or a read error.
+type fakeSource struct {
+	name    string
+	cookies []Cookie
+	err     error
+}
+
+func (s fakeSource) Name() string { return s.name }
+
+func (s fakeSource) ReadCookies() ([]Cookie, error) { return s.cookies, s.err }
+
+func TestCookiesForHost(t *testing.T) {
+	cookies := []Cookie{
+		{".slack.com", "generic"},
+		{"acme.slack.com", "acme"},
+		{".enterprise.slack.com", "enterprise"},
+		{"other.slack.com", "other"},
+		{".slack-gov.com", "gov"},
+	}
+	tests := []struct {
+		host string
+		want []string
+	}{
+		{"acme.slack.com", []string{"acme", "generic"}},
+		{"acme.enterprise.slack.com", []string{"enterprise", "generic"}},
+		{"globex.slack.com", []string{"generic"}},
+		{"slack.com", []string{"generic"}},
+		{"agency.enterprise.slack-gov.com", []string{"gov"}},
+		{"example.com", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			var got []string
+			for _, c := range cookiesForHost(cookies, tt.host) {
+				got = append(got, c.Value)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("cookiesForHost(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeFirst(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("d"); err == nil && c.Value == "good" {
+			w.Write([]byte(`{"api_token":"xoxc-123"}`))
+			return
+		}
+		http.Redirect(w, r, "/signin", http.StatusFound)
+	}))
+	defer srv.Close()
+	exchange := func(ctx context.Context, workspaceURL, cookie string) (string, error) {
+		return exchangeCookieForToken(ctx, srv.Client(), workspaceURL, cookie)
+	}
+
+	cookies := []candidate{
+		{Cookie: Cookie{"acme.slack.com", "stale"}, source: "desktop"},
+		{Cookie: Cookie{".slack.com", "good"}, source: "desktop"},
+	}
+	token, c, err := exchangeFirst(context.Background(), exchange, srv.URL, cookies)
+	if err != nil {
+		t.Fatalf("exchangeFirst() error: %v", err)
+	}
+	if token != "xoxc-123" || c.Domain != ".slack.com" {
+		t.Errorf("exchangeFirst() = %q from %q, want xoxc-123 from .slack.com", token, c.Domain)
+	}
+
+	if _, _, err := exchangeFirst(context.Background(), exchange, srv.URL, cookies[:1]); err == nil {
+		t.Error("exchangeFirst() with only a stale cookie succeeded")
+	}
+}
+
+func TestNewProviderSources(t *testing.T) {
+	// The exchange server accepts the cookies whose value starts with "good".
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch c, _ := r.Cookie("d"); {
+		case c != nil && strings.HasPrefix(c.Value, "good"):
+			w.Write([]byte(`{"api_token":"xoxc-` + c.Value + `"}`))
+		default:
+			w.Write([]byte(`<form id="signin_form">`))
+		}
+	}))
+	defer srv.Close()
+	const host = "acme.slack.com"
+
+	tests := []struct {
+		name      string
+		sources   []fakeSource
+		wantToken string
+		wantTried []string
+		wantErr   error
+		// wantClass is the internal/errs class of the error.
+		wantClass error
+	}{
+		{
+			name: "first source wins",
+			sources: []fakeSource{
+				{name: "a", cookies: []Cookie{{".slack.com", "good-a"}}},
+				{name: "b", cookies: []Cookie{{".slack.com", "good-b"}}},
+			},
+			wantToken: "xoxc-good-a",
+			wantTried: []string{"good-a"},
+		},
+		{
+			name: "unreadable source is skipped",
+			sources: []fakeSource{
+				{name: "a", err: ErrUnsupportedSource},
+				{name: "b", cookies: []Cookie{{".slack.com", "good-b"}}},
+			},
+			wantToken: "xoxc-good-b",
+			wantTried: []string{"good-b"},
+		},
+		{
+			name: "cookie found but exchange fails falls through to the next source",
+			sources: []fakeSource{
+				{name: "a", cookies: []Cookie{{host, "stale"}, {".slack.com", "expired"}}},
+				{name: "b", cookies: []Cookie{{"", "good-b"}}},
+			},
+			wantToken: "xoxc-good-b",
+			wantTried: []string{"stale", "expired", "good-b"},
+		},
+		{
+			name: "cookies for other workspaces are not tried",
+			sources: []fakeSource{
+				{name: "a", cookies: []Cookie{{"globex.slack.com", "good-globex"}, {".slack.com", "good-a"}}},
+			},
+			wantToken: "xoxc-good-a",
+			wantTried: []string{"good-a"},
+		},
+		{
+			name: "every exchange fails",
+			sources: []fakeSource{
+				{name: "a", cookies: []Cookie{{".slack.com", "stale"}}},
+			},
+			wantTried: []string{"stale"},
+			wantErr:   ErrSignedOut,
+			wantClass: errs.ErrAuth,
+		},
+		{
+			name: "no source can be read",
+			sources: []fakeSource{
+				{name: "a", err: errors.New("boom")},
+				{name: "b", err: ErrUnsupportedSource},
+			},
+			wantErr:   ErrUnsupportedSource,
+			wantClass: errs.ErrUnsupportedPlatform,
+		},
+		{
+			name: "a source fails with an unclassified error",
+			sources: []fakeSource{
+				{name: "a", err: errors.New("keychain locked")},
+			},
+			wantClass: errs.ErrAuth,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sources []AuthSource
+			for _, s := range tt.sources {
+				sources = append(sources, s)
+			}
+			var tried []string
+			exchange := func(ctx context.Context, workspaceURL, cookie string) (string, error) {
+				tried = append(tried, cookie)
+				return exchangeCookieForToken(ctx, srv.Client(), srv.URL, cookie)
+			}
+
+			p, err := newProvider(context.Background(), "https://"+host, sources, exchange, TransportOptions{})
+			if tt.wantClass != nil {
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("newProvider() error = %v, want %v", err, tt.wantErr)
+				}
+				if !errors.Is(err, tt.wantClass) {
+					t.Fatalf("newProvider() error = %v, want class %v", err, tt.wantClass)
+				}
+			} else if err != nil {
+				t.Fatalf("newProvider() error = %v", err)
+			} else if p.SlackToken() != tt.wantToken {
+				t.Errorf("token = %q, want %q", p.SlackToken(), tt.wantToken)
+			}
+			if !slices.Equal(tried, tt.wantTried) {
+				t.Errorf("tried cookies %v, want %v", tried, tt.wantTried)
+			}
+		})
+	}
+}
+
+func TestNewProviderRedactsErrors(t *testing.T) {
+	const cookie = "plain-session-cookie-value"
+	const token = "xoxc-1234567890-abcdef"
+	sources := []AuthSource{fakeSource{name: "a", cookies: []Cookie{{".slack.com", cookie}}}}
+	exchange := func(ctx context.Context, workspaceURL, cookie string) (string, error) {
+		return "", fmt.Errorf("%w: GET %s/ssb/redirect?d=%s&token=%s", ErrSignedOut, workspaceURL, cookie, token)
+	}
+
+	_, err := newProvider(context.Background(), "https://acme.slack.com", sources, exchange, TransportOptions{})
+	if !errors.Is(err, ErrSignedOut) {
+		t.Fatalf("newProvider() error = %v, want ErrSignedOut", err)
+	}
+	for _, secret := range []string{cookie, token} {
+		if strings.Contains(err.Error(), secret) {
+			t.Errorf("newProvider() error %q contains %q", err, secret)
+		}
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "cookie")
+	if err := os.WriteFile(good, []byte("xoxd-abc%2Fdef\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(dir, "bad")
+	if err := os.WriteFile(bad, []byte("xoxd-abc\nxoxd-def\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadCookie("https://acme.slack-gov.com", []AuthSource{FileSource{Path: good}})
+	if err != nil || got != "xoxd-abc%2Fdef" {
+		t.Errorf("ReadCookie() = %q, %v, want the file's value for any workspace", got, err)
+	}
+	if _, err := (FileSource{Path: bad}).ReadCookies(); err == nil {
+		t.Error("ReadCookies() of a two-line file succeeded")
+	}
+	if _, err := (FileSource{Path: filepath.Join(dir, "missing")}).ReadCookies(); err == nil {
+		t.Error("ReadCookies() of a missing file succeeded")
+	}
+}
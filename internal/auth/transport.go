@@ -0,0 +1,535 @@
+package auth
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	safariUserAgent  = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.3 Safari/605.1.15"
+	chromeUserAgent  = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36"
+	firefoxUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:133.0) Gecko/20100101 Firefox/133.0"
+)
+
+// DefaultTimeout bounds each request until its response headers arrive,
+// covering the dial, any proxy CONNECT, and the TLS handshake.
+const DefaultTimeout = 30 * time.Second
+
+// errTimeout is the cancellation cause when a request exceeds its timeout.
+var errTimeout = errors.New("timeout")
+
+// TLSHellos lists the accepted TransportOptions.Hello values.
+var TLSHellos = []string{"auto", "safari", "chrome", "firefox"}
+
+// TransportOptions configures the uTLS transport used for all Slack requests.
+type TransportOptions struct {
+	// Hello selects the TLS ClientHello fingerprint: "safari", "chrome",
+	// "firefox", or "auto" (the default), which matches the User-Agent.
+	Hello string
+	// CABundle is a PEM file with extra root CAs to trust, e.g. the root of
+	// a TLS-intercepting proxy. SSL_CERT_FILE is loaded the same way.
+	CABundle string
+	// InsecureSkipVerify disables certificate verification.
+	InsecureSkipVerify bool
+	// PinSlackCerts requires the served certificates to match the SPKI pins
+	// in PinFile. It can't be combined with InsecureSkipVerify.
+	PinSlackCerts bool
+	PinFile       string
+	// Timeout bounds each request until its response headers arrive.
+	// Zero means DefaultTimeout.
+	Timeout time.Duration
+	// RateLimit caps the requests per second sent through a Provider's HTTP
+	// clients. Zero or less disables pacing; 429s are retried either way.
+	RateLimit float64
+	// OutageMaxWait is how long a Provider's clients wait out HTML answers
+	// from the API before failing with ErrSlackOutage. Zero means
+	// DefaultOutageMaxWait.
+	OutageMaxWait time.Duration
+	// Debug traces every request when set (--debug-http).
+	Debug *HTTPDebug
+}
+
+// clientHello is a ClientHello fingerprint and the User-Agent sent with it.
+type clientHello struct {
+	id utls.ClientHelloID
+	ua string
+}
+
+// helloFallbacks is the ladder tried, in order, when the server rejects the
+// handshake with --tls-hello auto. An empty ua keeps the current User-Agent.
+var helloFallbacks = []clientHello{
+	{id: utls.HelloChrome_Auto, ua: chromeUserAgent},
+	{id: utls.HelloGolang},
+}
+
+// utlsTransport uses uTLS to mimic a browser's TLS fingerprint.
+// It caches and reuses HTTP/2 connections per host, matching real browser behavior.
+type utlsTransport struct {
+	h2       *http2.Transport
+	roots    *x509.CertPool
+	insecure bool
+	pins     certPins
+	timeout  time.Duration
+	// proxy returns the proxy for a request URL, or nil to dial directly.
+	proxy func(*url.URL) (*url.URL, error)
+	mu    sync.Mutex
+	h2cc  map[string]*http2.ClientConn
+	// hello is the current fingerprint. fallbacks are the hellos still to
+	// try if it is rejected; they are dropped after the first successful
+	// handshake so the fingerprint doesn't change within a session.
+	hello     clientHello
+	fallbacks []clientHello
+}
+
+// newTransport returns the transport for opts: the uTLS transport, traced
+// when opts.Debug is set.
+func newTransport(opts TransportOptions) (http.RoundTripper, error) {
+	t, err := newUTLSTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	return opts.Debug.wrap(t), nil
+}
+
+// newUTLSTransport creates a transport whose ClientHello and default
+// User-Agent describe the same browser.
+func newUTLSTransport(opts TransportOptions) (*utlsTransport, error) {
+	hello, ua, err := resolveHello(opts.Hello, safariUserAgent)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := loadRoots(opts.CABundle, os.Getenv("SSL_CERT_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	if opts.Timeout < 0 {
+		return nil, errors.New("timeout must be positive")
+	}
+	var pins certPins
+	if opts.PinSlackCerts {
+		if opts.InsecureSkipVerify {
+			return nil, errors.New("--pin-slack-certs and --insecure-skip-verify are mutually exclusive")
+		}
+		if pins, err = loadPins(opts.PinFile); err != nil {
+			return nil, err
+		}
+	}
+	var fallbacks []clientHello
+	if opts.Hello == "" || opts.Hello == "auto" {
+		for _, fb := range helloFallbacks {
+			if fb.id != hello {
+				fallbacks = append(fallbacks, fb)
+			}
+		}
+	}
+	return &utlsTransport{
+		h2:        &http2.Transport{},
+		hello:     clientHello{id: hello, ua: ua},
+		fallbacks: fallbacks,
+		roots:     roots,
+		insecure:  opts.InsecureSkipVerify,
+		pins:      pins,
+		timeout:   cmp.Or(opts.Timeout, DefaultTimeout),
+		proxy:     proxyFromEnvironment(),
+	}, nil
+}
+
+// loadRoots returns the system roots extended with the certificates in the
+// given PEM files. It returns nil, meaning the system roots, when no file is
+// given.
+func loadRoots(files ...string) (*x509.CertPool, error) {
+	var pool *x509.CertPool
+	for _, f := range files {
+		if f == "" {
+			continue
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		if pool == nil {
+			if pool, err = x509.SystemCertPool(); err != nil {
+				pool = x509.NewCertPool()
+			}
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", f)
+		}
+	}
+	return pool, nil
+}
+
+// proxyFromEnvironment resolves proxies from HTTPS_PROXY, HTTP_PROXY, and
+// NO_PROXY (and their lowercase forms). ALL_PROXY is used for HTTPS requests
+// when HTTPS_PROXY is unset, which allows socks5:// proxies.
+func proxyFromEnvironment() func(*url.URL) (*url.URL, error) {
+	cfg := httpproxy.FromEnvironment()
+	if cfg.HTTPSProxy == "" {
+		cfg.HTTPSProxy = cmp.Or(os.Getenv("ALL_PROXY"), os.Getenv("all_proxy"))
+	}
+	return cfg.ProxyFunc()
+}
+
+// resolveHello maps a --tls-hello name to a ClientHello and the User-Agent
+// sent with it. "auto" keeps ua and picks the hello consistent with it:
+// Chrome for Chrome-like agents, Safari otherwise.
+func resolveHello(name, ua string) (utls.ClientHelloID, string, error) {
+	switch name {
+	case "", "auto":
+		if isChromeLike(ua) {
+			return utls.HelloChrome_Auto, ua, nil
+		}
+		return utls.HelloSafari_Auto, ua, nil
+	case "safari":
+		return utls.HelloSafari_Auto, safariUserAgent, nil
+	case "chrome":
+		return utls.HelloChrome_Auto, chromeUserAgent, nil
+	case "firefox":
+		return utls.HelloFirefox_Auto, firefoxUserAgent, nil
+	}
+	return utls.ClientHelloID{}, "", fmt.Errorf("unknown TLS hello %q (want one of %s)", name, strings.Join(TLSHellos, ", "))
+}
+
+// isChromeLike reports whether a User-Agent identifies a Chromium browser.
+func isChromeLike(ua string) bool {
+	return strings.Contains(ua, "Chrome/") || strings.Contains(ua, "Chromium/")
+}
+
+// getOrDial returns a cached HTTP/2 connection for the request's host, or
+// dials a new one. When the server doesn't negotiate h2, the fresh TLS
+// connection is returned instead for a one-off HTTP/1.1 exchange.
+func (t *utlsTransport) getOrDial(req *http.Request) (*http2.ClientConn, *utls.UConn, error) {
+	addr := req.URL.Host
+	if req.URL.Port() == "" {
+		addr += ":443"
+	}
+
+	t.mu.Lock()
+	if t.h2cc == nil {
+		t.h2cc = make(map[string]*http2.ClientConn)
+	}
+	cc, ok := t.h2cc[addr]
+	t.mu.Unlock()
+
+	if ok && cc.CanTakeNewRequest() {
+		return cc, nil, nil
+	}
+
+	tlsConn, err := t.connect(req.Context(), req.URL, addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if tlsConn.ConnectionState().NegotiatedProtocol != http2.NextProtoTLS {
+		return nil, tlsConn, nil
+	}
+
+	cc, err = t.h2.NewClientConn(tlsConn)
+	if err != nil {
+		tlsConn.Close()
+		return nil, nil, err
+	}
+
+	t.mu.Lock()
+	t.h2cc[addr] = cc
+	t.mu.Unlock()
+
+	return cc, nil, nil
+}
+
+// roundTripHTTP1 sends req over an established TLS connection using
+// HTTP/1.1. The connection is used for this request only and is closed
+// with the response body, or as soon as the request context is done.
+func roundTripHTTP1(tlsConn *utls.UConn, req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Close = true
+	stop := context.AfterFunc(req.Context(), func() { tlsConn.Close() })
+	if err := req.Write(tlsConn); err != nil {
+		stop()
+		tlsConn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(tlsConn), req)
+	if err != nil {
+		stop()
+		tlsConn.Close()
+		return nil, err
+	}
+	resp.Body = &closeHookBody{ReadCloser: resp.Body, onClose: func() {
+		stop()
+		tlsConn.Close()
+	}}
+	return resp, nil
+}
+
+// closeHookBody runs onClose after closing the body.
+type closeHookBody struct {
+	io.ReadCloser
+	onClose func()
+}
+
+func (b *closeHookBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.onClose()
+	return err
+}
+
+// connect dials addr and completes the TLS handshake. When the server
+// rejects the handshake and fallbacks remain, it retries on a fresh
+// connection with the next hello.
+func (t *utlsTransport) connect(ctx context.Context, target *url.URL, addr string) (*utls.UConn, error) {
+	host := target.Hostname()
+	fellBack := false
+	for {
+		hello := t.currentHello()
+		conn, err := t.dial(ctx, target, addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn, err := t.handshake(ctx, conn, host, hello.id)
+		if err != nil {
+			if ctx.Err() != nil || !isHandshakeRejection(err) || !t.nextHello(hello) {
+				return nil, err
+			}
+			slog.Debug("TLS handshake rejected, trying another hello", "hello", hello.id.Str(), "error", err)
+			fellBack = true
+			continue
+		}
+
+		t.mu.Lock()
+		t.fallbacks = nil
+		t.mu.Unlock()
+		if fellBack {
+			slog.Info("TLS handshake succeeded with fallback hello", "hello", hello.id.Str())
+		}
+
+		if t.pins != nil {
+			if err := t.pins.verify(host, tlsConn.ConnectionState().PeerCertificates); err != nil {
+				tlsConn.Close()
+				return nil, err
+			}
+		}
+		return tlsConn, nil
+	}
+}
+
+func (t *utlsTransport) currentHello() clientHello {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.hello
+}
+
+// nextHello moves past failed to the next fallback. It reports whether
+// there is a hello left to try; a concurrent request may already have
+// moved on, in which case the current hello is tried.
+func (t *utlsTransport) nextHello(failed clientHello) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hello != failed {
+		return true
+	}
+	if len(t.fallbacks) == 0 {
+		return false
+	}
+	next := t.fallbacks[0]
+	t.fallbacks = t.fallbacks[1:]
+	next.ua = cmp.Or(next.ua, t.hello.ua)
+	t.hello = next
+	return true
+}
+
+// isHandshakeRejection reports whether a handshake error may be specific to
+// the ClientHello, as opposed to a certificate problem that no other hello
+// would fix.
+func isHandshakeRejection(err error) bool {
+	var cve *utls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	return !errors.As(err, &cve) && !errors.As(err, &unknownAuthority) &&
+		!errors.As(err, &hostname) && !errors.As(err, &invalid)
+}
+
+// handshake runs the uTLS handshake on conn, closing it on failure.
+func (t *utlsTransport) handshake(ctx context.Context, conn net.Conn, host string, hello utls.ClientHelloID) (*utls.UConn, error) {
+	tlsConn := utls.UClient(conn, &utls.Config{
+		ServerName:         host,
+		RootCAs:            t.roots,
+		InsecureSkipVerify: t.insecure,
+	}, hello)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, describeCertError(host, err)
+	}
+	return tlsConn, nil
+}
+
+// describeCertError names the issuer of an untrusted certificate chain so
+// users can recognize a TLS-intercepting appliance.
+func describeCertError(host string, err error) error {
+	var cve *utls.CertificateVerificationError
+	if !errors.As(err, &cve) || len(cve.UnverifiedCertificates) == 0 {
+		return err
+	}
+	chain := cve.UnverifiedCertificates
+	issuer := chain[len(chain)-1].Issuer.String()
+	return fmt.Errorf("certificate for %s issued by %q is not trusted — if your network intercepts TLS, pass its root CA with --ca-bundle: %w", host, issuer, err)
+}
+
+// dial opens a TCP connection to addr, tunneling through the configured
+// proxy when there is one. Cancelling ctx aborts the dial.
+func (t *utlsTransport) dial(ctx context.Context, target *url.URL, addr string) (net.Conn, error) {
+	var proxyURL *url.URL
+	if t.proxy != nil {
+		var err error
+		if proxyURL, err = t.proxy(target); err != nil {
+			return nil, fmt.Errorf("resolving proxy: %w", err)
+		}
+	}
+	var d net.Dialer
+	if proxyURL == nil {
+		return d.DialContext(ctx, "tcp", addr)
+	}
+
+	switch proxyURL.Scheme {
+	case "http":
+		return dialConnect(ctx, proxyURL, addr)
+	case "socks5", "socks5h":
+		var creds *proxy.Auth
+		if u := proxyURL.User; u != nil {
+			pw, _ := u.Password()
+			creds = &proxy.Auth{User: u.Username(), Password: pw}
+		}
+		sd, err := proxy.SOCKS5("tcp", proxyURL.Host, creds, &d)
+		if err != nil {
+			return nil, err
+		}
+		return sd.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+}
+
+// dialConnect connects to an HTTP proxy and opens a CONNECT tunnel to addr.
+// Credentials in the proxy URL are sent as Proxy-Authorization.
+func dialConnect(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr += ":80"
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	// Unblock the CONNECT exchange when ctx is done.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := proxyURL.User; u != nil {
+		pw, _ := u.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + pw))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT to %s via %s: %s", addr, proxyURL.Host, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		conn.Close()
+		return nil, errors.New("proxy CONNECT: unexpected data after response")
+	}
+	if !stop() {
+		conn.Close()
+		return nil, context.Cause(ctx)
+	}
+	return conn, nil
+}
+
+// RoundTrip sends req, failing if its response headers haven't arrived
+// within the transport's timeout. The request context is honored for the
+// whole exchange, including reading the body.
+func (t *utlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timeout := cmp.Or(t.timeout, DefaultTimeout)
+	timer := time.AfterFunc(timeout, func() { cancel(errTimeout) })
+	setUA := req.Header.Get("User-Agent") == ""
+	req = req.Clone(ctx)
+	// Compression is negotiated here for both protocols, since the HTTP/1.1
+	// path doesn't go through net/http's transport.
+	decode := req.Header.Get("Accept-Encoding") == "" && req.Method != http.MethodHead
+	if decode {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
+	resp, err := t.roundTrip(req, setUA)
+	if !timer.Stop() && err == nil {
+		resp.Body.Close()
+		err = errTimeout
+	}
+	if err != nil {
+		cancel(nil)
+		if context.Cause(ctx) == errTimeout {
+			return nil, fmt.Errorf("%s: no response within %s", req.URL.Host, timeout)
+		}
+		return nil, err
+	}
+	resp.Body = &closeHookBody{ReadCloser: resp.Body, onClose: func() { cancel(nil) }}
+	if decode {
+		decodeBody(resp)
+	}
+	return resp, nil
+}
+
+// roundTrip sends req on a cached or new connection. With setUA, the
+// User-Agent matching the hello in use is added once connected, since the
+// handshake may have fallen back to another hello.
+func (t *utlsTransport) roundTrip(req *http.Request, setUA bool) (*http.Response, error) {
+	cc, tlsConn, err := t.getOrDial(req)
+	if err != nil {
+		return nil, err
+	}
+	if setUA {
+		req.Header.Set("User-Agent", t.currentHello().ua)
+	}
+	if tlsConn != nil {
+		return roundTripHTTP1(tlsConn, req)
+	}
+	return cc.RoundTrip(req)
+}
@@ -0,0 +1,476 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func TestResolveHello(t *testing.T) {
+	tests := []struct {
+		name      string
+		hello     string
+		ua        string
+		wantHello utls.ClientHelloID
+		wantUA    string
+		wantErr   bool
+	}{
+		{name: "default is auto", hello: "", ua: safariUserAgent, wantHello: utls.HelloSafari_Auto, wantUA: safariUserAgent},
+		{name: "auto with safari UA", hello: "auto", ua: safariUserAgent, wantHello: utls.HelloSafari_Auto, wantUA: safariUserAgent},
+		{name: "auto with chrome UA", hello: "auto", ua: chromeUserAgent, wantHello: utls.HelloChrome_Auto, wantUA: chromeUserAgent},
+		{name: "safari", hello: "safari", ua: chromeUserAgent, wantHello: utls.HelloSafari_Auto, wantUA: safariUserAgent},
+		{name: "chrome", hello: "chrome", ua: safariUserAgent, wantHello: utls.HelloChrome_Auto, wantUA: chromeUserAgent},
+		{name: "firefox", hello: "firefox", ua: safariUserAgent, wantHello: utls.HelloFirefox_Auto, wantUA: firefoxUserAgent},
+		{name: "unknown", hello: "edge", ua: safariUserAgent, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hello, ua, err := resolveHello(tt.hello, tt.ua)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveHello(%q) error = %v, wantErr %v", tt.hello, err, tt.wantErr)
+			}
+			if hello != tt.wantHello {
+				t.Errorf("resolveHello(%q) hello = %v, want %v", tt.hello, hello, tt.wantHello)
+			}
+			if ua != tt.wantUA {
+				t.Errorf("resolveHello(%q) UA = %q, want %q", tt.hello, ua, tt.wantUA)
+			}
+		})
+	}
+}
+
+// startEchoServer starts a TCP server that echoes one line back.
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				conn.Write([]byte(line))
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// startConnectProxy starts a minimal HTTP CONNECT proxy. When wantAuth is
+// set, requests without matching Proxy-Authorization get a 407.
+func startConnectProxy(t *testing.T, wantAuth string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil || req.Method != http.MethodConnect {
+					conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+					return
+				}
+				if wantAuth != "" && req.Header.Get("Proxy-Authorization") != wantAuth {
+					conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+					return
+				}
+				upstream, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+					return
+				}
+				defer upstream.Close()
+				conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestUTLSTransportDialThroughProxy(t *testing.T) {
+	target := startEchoServer(t)
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+
+	tests := []struct {
+		name     string
+		wantAuth string
+		proxyURL string
+		wantErr  bool
+	}{
+		{name: "no auth", proxyURL: "http://%s"},
+		{name: "basic auth", wantAuth: basic, proxyURL: "http://user:secret@%s"},
+		{name: "wrong credentials", wantAuth: basic, proxyURL: "http://user:wrong@%s", wantErr: true},
+		{name: "unsupported scheme", proxyURL: "ftp://%s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyAddr := startConnectProxy(t, tt.wantAuth)
+			proxyURL, err := url.Parse(fmt.Sprintf(tt.proxyURL, proxyAddr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr := &utlsTransport{proxy: func(*url.URL) (*url.URL, error) { return proxyURL, nil }}
+
+			conn, err := tr.dial(context.Background(), &url.URL{Scheme: "https", Host: target}, target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dial() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.Write([]byte("ping\n"))
+			got, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil || got != "ping\n" {
+				t.Errorf("echo through tunnel = %q, %v, want ping", got, err)
+			}
+		})
+	}
+}
+
+func TestUTLSTransportDialDirect(t *testing.T) {
+	target := startEchoServer(t)
+	tr := &utlsTransport{proxy: func(*url.URL) (*url.URL, error) { return nil, nil }}
+	conn, err := tr.dial(context.Background(), &url.URL{Scheme: "https", Host: target}, target)
+	if err != nil {
+		t.Fatalf("dial() error: %v", err)
+	}
+	conn.Close()
+}
+
+// startTLSServer starts an HTTP/2 TLS test server answering "ok".
+func startTLSServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// writeCertPEM writes a DER certificate to path as PEM.
+func writeCertPEM(t *testing.T, path string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUTLSTransportCertificates(t *testing.T) {
+	srv := startTLSServer(t)
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	writeCertPEM(t, bundle, srv.Certificate().Raw)
+	t.Setenv("SSL_CERT_FILE", "")
+
+	tests := []struct {
+		name    string
+		opts    TransportOptions
+		wantErr string
+	}{
+		{name: "untrusted names issuer", opts: TransportOptions{}, wantErr: `issued by "O=Acme Co"`},
+		{name: "ca bundle", opts: TransportOptions{CABundle: bundle}},
+		{name: "insecure skip verify", opts: TransportOptions{InsecureSkipVerify: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := newUTLSTransport(tt.opts)
+			if err != nil {
+				t.Fatalf("newUTLSTransport() error: %v", err)
+			}
+			tr.proxy = nil
+			resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Get() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get() error: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != "ok" {
+				t.Errorf("body = %q, want ok", body)
+			}
+		})
+	}
+}
+
+func TestLoadRoots(t *testing.T) {
+	if pool, err := loadRoots("", ""); err != nil || pool != nil {
+		t.Errorf("loadRoots() with no files = %v, %v, want nil pool", pool, err)
+	}
+	notPEM := filepath.Join(t.TempDir(), "bad.pem")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0o644)
+	if _, err := loadRoots(notPEM); err == nil {
+		t.Error("loadRoots() should reject files without certificates")
+	}
+	if _, err := loadRoots(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("loadRoots() should fail for missing files")
+	}
+}
+
+func TestUTLSTransportHTTP1(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 1 {
+			t.Errorf("request protocol = %s, want HTTP/1.1", r.Proto)
+		}
+		// Flushing before the end forces a chunked response.
+		w.Write([]byte("chunk one, "))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("chunk two"))
+	}))
+	srv.StartTLS()
+	defer srv.Close()
+
+	tr, err := newUTLSTransport(TransportOptions{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.proxy = nil
+	client := &http.Client{Transport: tr}
+	for i := range 2 {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("request %d: Get() error: %v", i, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("request %d: reading body: %v", i, err)
+		}
+		if resp.ProtoMajor != 1 || string(body) != "chunk one, chunk two" {
+			t.Errorf("request %d: got %s %q, want HTTP/1.1 with both chunks", i, resp.Proto, body)
+		}
+	}
+}
+
+// startBlackhole accepts connections and never answers, like a firewall
+// that silently drops traffic after the TCP handshake.
+func startBlackhole(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestUTLSTransportTimeout(t *testing.T) {
+	addr := startBlackhole(t)
+	tr, err := newUTLSTransport(TransportOptions{Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.proxy = nil
+
+	start := time.Now()
+	_, err = (&http.Client{Transport: tr}).Get("https://" + addr)
+	if err == nil || !strings.Contains(err.Error(), "no response within 100ms") {
+		t.Fatalf("Get() error = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timed out after %s, want about 100ms", elapsed)
+	}
+}
+
+func TestUTLSTransportContextCancel(t *testing.T) {
+	addr := startBlackhole(t)
+	tr, err := newUTLSTransport(TransportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.proxy = nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://"+addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := tr.RoundTrip(req); err == nil {
+		t.Fatal("RoundTrip() succeeded against a blackhole")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("RoundTrip() returned after %s, want prompt return on cancel", elapsed)
+	}
+}
+
+func TestNewUTLSTransportTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "default", want: DefaultTimeout},
+		{name: "custom", timeout: 5 * time.Second, want: 5 * time.Second},
+		{name: "negative", timeout: -time.Second, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := newUTLSTransport(TransportOptions{Timeout: tt.timeout})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newUTLSTransport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tr.timeout != tt.want {
+				t.Errorf("timeout = %s, want %s", tr.timeout, tt.want)
+			}
+		})
+	}
+}
+
+// rejectingListener closes the first reject connections it accepts, like a
+// middlebox dropping a ClientHello it doesn't like.
+type rejectingListener struct {
+	net.Listener
+	reject   int32
+	accepted atomic.Int32
+}
+
+func (l *rejectingListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.accepted.Add(1) > l.reject {
+			return conn, nil
+		}
+		conn.Close()
+	}
+}
+
+func TestUTLSTransportHelloFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		hello     string
+		reject    int32
+		wantHello utls.ClientHelloID
+		wantUA    string
+		wantErr   bool
+	}{
+		{name: "first hello accepted", reject: 0, wantHello: utls.HelloSafari_Auto, wantUA: safariUserAgent},
+		{name: "falls back to chrome", reject: 1, wantHello: utls.HelloChrome_Auto, wantUA: chromeUserAgent},
+		{name: "falls back to golang", reject: 2, wantHello: utls.HelloGolang, wantUA: chromeUserAgent},
+		{name: "ladder exhausted", reject: 3, wantErr: true},
+		{name: "explicit hello doesn't fall back", hello: "safari", reject: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUA atomic.Value
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUA.Store(r.UserAgent())
+				w.Write([]byte("ok"))
+			}))
+			ln := &rejectingListener{Listener: srv.Listener, reject: tt.reject}
+			srv.Listener = ln
+			srv.StartTLS()
+			defer srv.Close()
+
+			tr, err := newUTLSTransport(TransportOptions{Hello: tt.hello, InsecureSkipVerify: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr.proxy = nil
+			client := &http.Client{Transport: tr}
+			resp, err := client.Get(srv.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+			if got := tr.currentHello().id; got != tt.wantHello {
+				t.Errorf("hello = %s, want %s", got.Str(), tt.wantHello.Str())
+			}
+			if got := gotUA.Load(); got != tt.wantUA {
+				t.Errorf("User-Agent = %q, want %q", got, tt.wantUA)
+			}
+
+			// The hello that worked sticks: the next connection uses it
+			// right away, even if the server would now take any hello.
+			accepted := ln.accepted.Load()
+			resp, err = client.Get(srv.URL)
+			if err != nil {
+				t.Fatalf("second Get() error: %v", err)
+			}
+			resp.Body.Close()
+			if n := ln.accepted.Load() - accepted; n != 1 {
+				t.Errorf("second request used %d connections, want 1", n)
+			}
+			if got := tr.currentHello().id; got != tt.wantHello {
+				t.Errorf("hello after second request = %s, want %s", got.Str(), tt.wantHello.Str())
+			}
+		})
+	}
+}
+
+func TestUTLSTransportNoFallbackOnCertError(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ln := &rejectingListener{Listener: srv.Listener}
+	srv.Listener = ln
+	srv.StartTLS()
+	defer srv.Close()
+	t.Setenv("SSL_CERT_FILE", "")
+
+	tr, err := newUTLSTransport(TransportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.proxy = nil
+	if _, err := (&http.Client{Transport: tr}).Get(srv.URL); err == nil {
+		t.Fatal("Get() succeeded with an untrusted certificate")
+	}
+	if n := ln.accepted.Load(); n != 1 {
+		t.Errorf("made %d connections, want 1 (certificate errors don't fall back)", n)
+	}
+}
@@ -0,0 +1,169 @@
+// Package channels caches conversations.info answers per workspace, so the
+// features that need a conversation's details look each one up at most once
+// per run and, while the entry is fresh, not at all.
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/wham/gh-slackdump/internal/errs"
+)
+
+const (
+	// TTL is how long a conversation's details are reused.
+	TTL = 24 * time.Hour
+	// NegativeTTL is how long a lookup that failed for good (a deleted or
+	// invisible conversation) is remembered.
+	NegativeTTL = time.Hour
+)
+
+// Fetcher looks up a conversation with conversations.info.
+type Fetcher func(ctx context.Context, id string) (*Channel, error)
+
+// entry is a cached lookup: the channel, or the Slack error code it failed
+// with.
+type entry struct {
+	Channel *Channel  `json:"channel,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Fetched time.Time `json:"fetched"`
+}
+
+// Cache is the conversations cache of a workspace. It is safe for
+// concurrent use.
+type Cache struct {
+	// SkipReads makes Info fetch every conversation, as for --no-cache;
+	// what it fetches is still saved.
+	SkipReads bool
+
+	path  string
+	fetch Fetcher
+	now   func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]entry
+	dirty   bool
+	hits    int
+	misses  int
+}
+
+// Open returns the cache stored at path, fetching with fetch. A missing or
+// unreadable file starts an empty cache.
+func Open(path string, fetch Fetcher) *Cache {
+	c := &Cache{path: path, fetch: fetch, now: time.Now, entries: make(map[string]entry)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Debug("can't read conversations cache", "path", path, "error", err)
+		}
+		return c
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		slog.Debug("ignoring corrupt conversations cache", "path", path, "error", err)
+		c.entries = make(map[string]entry)
+	}
+	return c
+}
+
+// Info returns the conversation id from the cache or, when it has no fresh
+// entry, from conversations.info. Lookups that fail with a Slack error of
+// class errs.ErrNotFound are cached too, for NegativeTTL, and return the
+// same error while remembered; other failures aren't cached.
+func (c *Cache) Info(ctx context.Context, id string) (*Channel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if e, ok := c.entries[id]; ok && c.SkipReads {
+		slog.Debug("bypassing conversations cache", "channel", id)
+	} else if ok {
+		switch {
+		case e.Error != "" && now.Sub(e.Fetched) < NegativeTTL:
+			c.hits++
+			return nil, errs.Classify(slack.SlackErrorResponse{Err: e.Error})
+		case e.Error == "" && now.Sub(e.Fetched) < TTL:
+			c.hits++
+			return e.Channel, nil
+		}
+	}
+	c.misses++
+	ch, err := c.fetch(ctx, id)
+	var slackErr slack.SlackErrorResponse
+	switch {
+	case err == nil:
+		c.entries[id] = entry{Channel: ch, Fetched: now}
+		c.dirty = true
+	case errors.Is(errs.Classify(err), errs.ErrNotFound) && errors.As(err, &slackErr):
+		c.entries[id] = entry{Error: slackErr.Err, Fetched: now}
+		c.dirty = true
+	}
+	return ch, errs.Classify(err)
+}
+
+// Stats returns how many lookups the cache answered and how many it had to
+// fetch.
+func (c *Cache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Save writes the cache back to its file if a lookup changed it, dropping
+// expired entries.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	now := c.now()
+	for id, e := range c.entries {
+		ttl := TTL
+		if e.Error != "" {
+			ttl = NegativeTTL
+		}
+		if now.Sub(e.Fetched) >= ttl {
+			delete(c.entries, id)
+		}
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	if err := writeAtomic(c.path, data); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// writeAtomic writes data to path through a synced temporary file in the
+// same directory, so readers never see a partial file.
+func writeAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
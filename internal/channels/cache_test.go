@@ -0,0 +1,124 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/wham/gh-slackdump/internal/errs"
+)
+
+// countingFetcher answers conversations.info for C1 and fails with
+// channel_not_found for anything else, counting the calls per ID.
+func countingFetcher(calls map[string]int) Fetcher {
+	return func(ctx context.Context, id string) (*Channel, error) {
+		calls[id]++
+		if id != "C1" {
+			return nil, slack.SlackErrorResponse{Err: "channel_not_found"}
+		}
+		ch := &Channel{}
+		ch.ID, ch.Name = id, "general"
+		return ch, nil
+	}
+}
+
+func TestCacheFetchesEachConversationOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.json")
+	calls := map[string]int{}
+	c := Open(path, countingFetcher(calls))
+
+	// As the features of one run would: export, mattermost and zulip each
+	// look up the conversation, and a deleted one is asked for repeatedly.
+	for range 3 {
+		ch, err := c.Info(context.Background(), "C1")
+		if err != nil || ch.Name != "general" {
+			t.Fatalf("Info(C1) = %v, %v", ch, err)
+		}
+		if _, err := c.Info(context.Background(), "CGONE"); !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Info(CGONE) error = %v, want ErrNotFound", err)
+		}
+	}
+	if calls["C1"] != 1 || calls["CGONE"] != 1 {
+		t.Errorf("conversations.info calls = %v, want one per ID", calls)
+	}
+	if hits, misses := c.Stats(); hits != 4 || misses != 2 {
+		t.Errorf("Stats() = %d hits, %d misses, want 4, 2", hits, misses)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	// The next run answers from the file.
+	c = Open(path, countingFetcher(calls))
+	c.Info(context.Background(), "C1")
+	c.Info(context.Background(), "CGONE")
+	if calls["C1"] != 1 || calls["CGONE"] != 1 {
+		t.Errorf("conversations.info calls after reopening = %v, want none more", calls)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	calls := map[string]int{}
+	c := Open(filepath.Join(t.TempDir(), "conversations.json"), countingFetcher(calls))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.Info(context.Background(), "C1")
+	c.Info(context.Background(), "CGONE")
+
+	now = now.Add(NegativeTTL)
+	c.Info(context.Background(), "C1")
+	c.Info(context.Background(), "CGONE")
+	if calls["C1"] != 1 || calls["CGONE"] != 2 {
+		t.Errorf("after an hour: calls = %v, want the failure fetched again only", calls)
+	}
+
+	now = now.Add(TTL)
+	c.Info(context.Background(), "C1")
+	if calls["C1"] != 2 {
+		t.Errorf("after a day: C1 fetched %d times, want 2", calls["C1"])
+	}
+}
+
+func TestCacheSkipsTransientErrors(t *testing.T) {
+	calls := 0
+	c := Open(filepath.Join(t.TempDir(), "conversations.json"), func(ctx context.Context, id string) (*Channel, error) {
+		calls++
+		return nil, &slack.RateLimitedError{}
+	})
+	c.Info(context.Background(), "C1")
+	c.Info(context.Background(), "C1")
+	if calls != 2 {
+		t.Errorf("a rate-limited lookup was cached: %d calls, want 2", calls)
+	}
+}
+
+func TestCacheSkipReads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.json")
+	calls := map[string]int{}
+	c := Open(path, countingFetcher(calls))
+	c.Info(context.Background(), "C1")
+	c.Info(context.Background(), "C2")
+	c.Save()
+
+	// --no-cache: C1 is fetched again and saved, C2 is kept for later runs.
+	c = Open(path, countingFetcher(calls))
+	c.SkipReads = true
+	c.Info(context.Background(), "C1")
+	c.Info(context.Background(), "C1")
+	if calls["C1"] != 3 {
+		t.Errorf("C1 fetched %d times, want every lookup to fetch", calls["C1"])
+	}
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	c = Open(path, countingFetcher(calls))
+	c.Info(context.Background(), "C1")
+	c.Info(context.Background(), "C2")
+	if calls["C1"] != 3 || calls["C2"] != 1 {
+		t.Errorf("calls after a --no-cache run = %v, want both answered from the cache", calls)
+	}
+}
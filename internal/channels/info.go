@@ -0,0 +1,88 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rusq/slack"
+)
+
+// Channel is a conversation as conversations.info describes it, with the
+// posting flags slack.Channel leaves out.
+type Channel struct {
+	slack.Channel
+	// IsThreadOnly is set for channels where members may only reply in
+	// threads.
+	IsThreadOnly bool `json:"is_thread_only,omitempty"`
+	// IsLocked is set for channels no one may post in.
+	IsLocked bool `json:"is_locked,omitempty"`
+}
+
+// Posture returns what limits posting in the channel, as Posture.
+func (ch *Channel) Posture() []string {
+	return Posture(ch.IsReadOnly, ch.IsThreadOnly, ch.IsLocked)
+}
+
+// Posture names the flags that limit posting in a channel, in a fixed
+// order: "read-only" (an announcement channel only some members post in),
+// "thread-only" and "locked"; nil for an ordinary channel.
+func Posture(readOnly, threadOnly, locked bool) []string {
+	var p []string
+	if readOnly {
+		p = append(p, "read-only")
+	}
+	if threadOnly {
+		p = append(p, "thread-only")
+	}
+	if locked {
+		p = append(p, "locked")
+	}
+	return p
+}
+
+// NewFetcher returns a Fetcher that calls conversations.info at apiURL
+// itself, as slack's GetConversationInfo drops the is_thread_only and
+// is_locked flags.
+func NewFetcher(hc *http.Client, token, apiURL string) Fetcher {
+	return func(ctx context.Context, id string) (*Channel, error) {
+		form := url.Values{
+			"token":   {token},
+			"channel": {id},
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+"conversations.info", strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := hc.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			retry, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			return nil, &slack.RateLimitedError{RetryAfter: time.Duration(retry) * time.Second}
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("conversations.info: %w", slack.StatusCodeError{Code: resp.StatusCode, Status: resp.Status})
+		}
+		var body struct {
+			slack.SlackResponse
+			Channel Channel `json:"channel"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return nil, fmt.Errorf("conversations.info: %w", err)
+		}
+		if err := body.Err(); err != nil {
+			return nil, fmt.Errorf("conversations.info: %w", err)
+		}
+		return &body.Channel, nil
+	}
+}
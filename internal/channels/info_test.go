@@ -0,0 +1,64 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/rusq/slack"
+)
+
+// infoFixtures are conversations.info answers, by channel ID, for each
+// combination of the posting flags.
+var infoFixtures = map[string]string{
+	"C1": `{"ok":true,"channel":{"id":"C1","name":"general"}}`,
+	"C2": `{"ok":true,"channel":{"id":"C2","name":"announcements","is_read_only":true}}`,
+	"C3": `{"ok":true,"channel":{"id":"C3","name":"questions","is_thread_only":true}}`,
+	"C4": `{"ok":true,"channel":{"id":"C4","name":"old-launch","is_locked":true}}`,
+	"C5": `{"ok":true,"channel":{"id":"C5","name":"news","is_read_only":true,"is_thread_only":true}}`,
+	"C6": `{"ok":true,"channel":{"id":"C6","name":"frozen","is_read_only":true,"is_thread_only":true,"is_locked":true}}`,
+}
+
+func TestFetcherPosture(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/conversations.info" || r.FormValue("token") != "xoxc-test" {
+			t.Errorf("request %s with token %q", r.URL.Path, r.FormValue("token"))
+		}
+		body, ok := infoFixtures[r.FormValue("channel")]
+		if !ok {
+			body = `{"ok":false,"error":"channel_not_found"}`
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	fetch := NewFetcher(srv.Client(), "xoxc-test", srv.URL+"/api/")
+
+	tests := []struct {
+		id   string
+		want []string
+	}{
+		{"C1", nil},
+		{"C2", []string{"read-only"}},
+		{"C3", []string{"thread-only"}},
+		{"C4", []string{"locked"}},
+		{"C5", []string{"read-only", "thread-only"}},
+		{"C6", []string{"read-only", "thread-only", "locked"}},
+	}
+	for _, tt := range tests {
+		ch, err := fetch(context.Background(), tt.id)
+		if err != nil {
+			t.Fatalf("fetch(%s): %v", tt.id, err)
+		}
+		if ch.ID != tt.id || !reflect.DeepEqual(ch.Posture(), tt.want) {
+			t.Errorf("fetch(%s) = %s with posture %v, want %v", tt.id, ch.ID, ch.Posture(), tt.want)
+		}
+	}
+
+	var slackErr slack.SlackErrorResponse
+	if _, err := fetch(context.Background(), "C9"); !errors.As(err, &slackErr) || slackErr.Err != "channel_not_found" {
+		t.Errorf("fetch(C9) error = %v, want channel_not_found", err)
+	}
+}
@@ -0,0 +1,168 @@
+// Package emoji knows the names of standard emoji and the aliases Slack
+// accepts for them, so the same emoji can be recognized, and rendered,
+// under whichever name a message uses.
+package emoji
+
+import "strings"
+
+// standardEmoji maps the canonical names of common standard emoji to their
+// characters.
+var standardEmoji = map[string]string{
+	"+1": "👍", "-1": "👎",
+	"smile": "😄", "smiley": "😃", "grinning": "😀", "grin": "😁", "joy": "😂",
+	"rolling_on_the_floor_laughing": "🤣", "sweat_smile": "😅", "laughing": "😆",
+	"wink": "😉", "blush": "😊", "slightly_smiling_face": "🙂", "upside_down_face": "🙃",
+	"heart_eyes": "😍", "kissing_heart": "😘", "thinking_face": "🤔",
+	"neutral_face": "😐", "expressionless": "😑", "unamused": "😒", "face_with_rolling_eyes": "🙄", "grimacing": "😬", "relieved": "😌", "pensive": "😔",
+	"sleeping": "😴", "sunglasses": "😎", "confused": "😕", "worried": "😟",
+	"slightly_frowning_face": "🙁", "open_mouth": "😮", "astonished": "😲", "flushed": "😳",
+	"cry": "😢", "sob": "😭", "scream": "😱", "rage": "😡", "angry": "😠",
+	"skull": "💀", "see_no_evil": "🙈", "hugging_face": "🤗",
+	"exploding_head": "🤯", "partying_face": "🥳", "melting_face": "🫠", "saluting_face": "🫡",
+	"face_palm": "🤦", "shrug": "🤷", "pray": "🙏", "clap": "👏",
+	"wave": "👋", "raised_hands": "🙌", "muscle": "💪", "point_up": "☝️", "point_right": "👉",
+	"ok_hand": "👌", "v": "✌️", "crossed_fingers": "🤞", "eyes": "👀", "brain": "🧠",
+	"heart": "❤️", "blue_heart": "💙", "green_heart": "💚", "yellow_heart": "💛",
+	"purple_heart": "💜", "broken_heart": "💔", "sparkling_heart": "💖",
+	"fire": "🔥", "tada": "🎉", "sparkles": "✨", "star": "⭐", "star2": "🌟", "zap": "⚡",
+	"boom": "💥", "100": "💯", "rocket": "🚀", "bulb": "💡", "memo": "📝", "pushpin": "📌", "link": "🔗", "lock": "🔒", "key": "🔑", "bug": "🐛",
+	"hammer_and_wrench": "🛠️", "wrench": "🔧", "gear": "⚙️", "package": "📦", "calendar": "📆",
+	"hourglass": "⌛", "stopwatch": "⏱️", "coffee": "☕", "beer": "🍺", "pizza": "🍕", "cake": "🍰",
+	"white_check_mark": "✅", "heavy_check_mark": "✔️", "ballot_box_with_check": "☑️",
+	"x": "❌", "heavy_multiplication_x": "✖️", "warning": "⚠️", "no_entry": "⛔",
+	"no_entry_sign": "🚫", "question": "❓", "grey_question": "❔", "exclamation": "❗", "bangbang": "‼️", "heavy_plus_sign": "➕",
+	"heavy_minus_sign": "➖", "arrow_up": "⬆️", "arrow_down": "⬇️", "arrow_right": "➡️",
+	"arrow_left": "⬅️", "repeat": "🔁", "recycle": "♻️", "red_circle": "🔴",
+	"large_green_circle": "🟢", "large_yellow_circle": "🟡", "large_blue_circle": "🔵",
+	"rotating_light": "🚨", "construction": "🚧", "mag": "🔍", "speech_balloon": "💬",
+	"thread": "🧵", "raising_hand": "🙋", "money_with_wings": "💸", "chart_with_upwards_trend": "📈",
+	"chart_with_downwards_trend": "📉", "bar_chart": "📊", "trophy": "🏆", "medal": "🏅",
+	"robot_face": "🤖", "ghost": "👻", "hankey": "💩", "shipit": "🐿️", "turtle": "🐢", "snail": "🐌", "sunny": "☀️", "cloud": "☁️",
+	"umbrella": "☔", "snowflake": "❄️", "rainbow": "🌈", "earth_americas": "🌎",
+}
+
+// skinTones are the modifiers Slack appends to names as ::skin-tone-N.
+var skinTones = map[string]string{
+	"skin-tone-2": "\U0001F3FB", "skin-tone-3": "\U0001F3FC", "skin-tone-4": "\U0001F3FD",
+	"skin-tone-5": "\U0001F3FE", "skin-tone-6": "\U0001F3FF",
+}
+
+// standardAliases maps the alternative names Slack accepts for standard
+// emoji to the canonical name its emoji picker uses.
+var standardAliases = map[string]string{
+	"thumbsup": "+1", "thumbsdown": "-1", "satisfied": "laughing", "thinking": "thinking_face",
+	"roll_eyes": "face_with_rolling_eyes", "hugs": "hugging_face", "facepalm": "face_palm",
+	"collision": "boom", "pencil": "memo", "heavy_exclamation_mark": "exclamation",
+	"poop": "hankey", "shit": "hankey", "squirrel": "shipit", "thumbs_up": "+1", "thumbs_down": "-1",
+}
+
+// Char returns the character for a standard emoji name or alias such as
+// "thumbsup" or "wave::skin-tone-3".
+func Char(name string) (string, bool) {
+	base, tone, _ := strings.Cut(name, "::")
+	if c, ok := standardAliases[base]; ok {
+		base = c
+	}
+	c, ok := standardEmoji[base]
+	if !ok {
+		return "", false
+	}
+	if m, ok := skinTones[tone]; ok {
+		c = strings.TrimSuffix(c, "\ufe0f") + m
+	}
+	return c, true
+}
+
+// gitHubNames maps the canonical names of standard emoji whose GitHub
+// shortcode differs to that shortcode.
+var gitHubNames = map[string]string{
+	"thinking_face": "thinking", "face_palm": "facepalm", "hugging_face": "hugs",
+	"face_with_rolling_eyes": "roll_eyes", "robot_face": "robot",
+	"large_green_circle": "green_circle", "large_yellow_circle": "yellow_circle",
+}
+
+// GitHub returns an emoji by name as GitHub Markdown writes it: the GitHub
+// shortcode of a standard emoji, its character when it has a skin tone
+// (shortcodes take none), and :name: for any other, such as custom emoji,
+// which GitHub shows as text.
+func GitHub(name string) string {
+	base, tone, _ := strings.Cut(name, "::")
+	if tone != "" {
+		if c, ok := Char(name); ok {
+			return c
+		}
+		return ":" + name + ":"
+	}
+	if c, ok := standardAliases[base]; ok {
+		base = c
+	}
+	if _, ok := standardEmoji[base]; !ok {
+		return ":" + name + ":"
+	}
+	if gh, ok := gitHubNames[base]; ok {
+		base = gh
+	}
+	return ":" + base + ":"
+}
+
+// Normalizer maps emoji names to canonical ones: standard aliases, and the
+// workspace's custom aliases when it was given its emoji.list.
+type Normalizer struct {
+	custom map[string]string
+}
+
+// NewNormalizer returns a Normalizer for a workspace's emoji.list, a map of
+// names to image URLs or, for aliases, "alias:<name>". list may be nil.
+func NewNormalizer(list map[string]string) *Normalizer {
+	n := &Normalizer{custom: make(map[string]string)}
+	for name, v := range list {
+		if target, ok := strings.CutPrefix(v, "alias:"); ok {
+			n.custom[name] = target
+		}
+	}
+	return n
+}
+
+// maxAliasHops bounds how many custom aliases are followed, in case of a
+// cycle.
+const maxAliasHops = 8
+
+// Name returns the canonical name for name, keeping any skin tone suffix.
+func (n *Normalizer) Name(name string) string {
+	base, tone, hasTone := strings.Cut(name, "::")
+	for range maxAliasHops {
+		target, ok := n.custom[base]
+		if !ok {
+			break
+		}
+		base = target
+	}
+	if c, ok := standardAliases[base]; ok {
+		base = c
+	}
+	if hasTone {
+		return base + "::" + tone
+	}
+	return base
+}
+
+// Images maps each custom emoji in a workspace's emoji.list to the URL of
+// its image, following aliases to their target's. Aliases of standard emoji,
+// or of custom emoji that are gone, are left out.
+func Images(list map[string]string) map[string]string {
+	images := make(map[string]string, len(list))
+	for name := range list {
+		target := name
+		for range maxAliasHops {
+			next, ok := strings.CutPrefix(list[target], "alias:")
+			if !ok {
+				break
+			}
+			target = next
+		}
+		if url := list[target]; url != "" && !strings.HasPrefix(url, "alias:") {
+			images[name] = url
+		}
+	}
+	return images
+}
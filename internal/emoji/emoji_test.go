@@ -0,0 +1,89 @@
+package emoji
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestChar(t *testing.T) {
+	tests := []struct {
+		name, want string
+		ok         bool
+	}{
+		{name: "+1", want: "👍", ok: true},
+		{name: "thumbsup", want: "👍", ok: true},
+		{name: "wave::skin-tone-3", want: "👋\U0001F3FC", ok: true},
+		{name: "v::skin-tone-6", want: "✌\U0001F3FF", ok: true},
+		{name: "partyparrot"},
+	}
+	for _, tt := range tests {
+		got, ok := Char(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Char(%q) = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestGitHub(t *testing.T) {
+	for name, want := range map[string]string{
+		"thumbsup":          ":+1:",
+		"thinking_face":     ":thinking:",
+		"roll_eyes":         ":roll_eyes:",
+		"wave::skin-tone-3": "👋\U0001F3FC",
+		"partyparrot":       ":partyparrot:",
+	} {
+		if got := GitHub(name); got != want {
+			t.Errorf("GitHub(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestNormalizerName(t *testing.T) {
+	n := NewNormalizer(map[string]string{
+		"yes":         "alias:thumbsup",
+		"yep":         "alias:yes",
+		"partyparrot": "https://emoji.example/parrot.gif",
+		"loop-a":      "alias:loop-b",
+		"loop-b":      "alias:loop-a",
+	})
+	tests := []struct{ in, want string }{
+		{"thumbsup", "+1"},
+		{"+1", "+1"},
+		{"yep", "+1"},
+		{"yes::skin-tone-2", "+1::skin-tone-2"},
+		{"partyparrot", "partyparrot"},
+		{"eyes", "eyes"},
+	}
+	for _, tt := range tests {
+		if got := n.Name(tt.in); got != tt.want {
+			t.Errorf("Name(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	// A cycle of aliases ends instead of looping.
+	if got := n.Name("loop-a"); got != "loop-a" && got != "loop-b" {
+		t.Errorf("Name(loop-a) = %q", got)
+	}
+	if got := NewNormalizer(nil).Name("satisfied"); got != "laughing" {
+		t.Errorf("without emoji.list, Name(satisfied) = %q, want laughing", got)
+	}
+}
+
+func TestImages(t *testing.T) {
+	got := Images(map[string]string{
+		"party-wizard": "https://emoji.example/party-wizard.gif",
+		"wizard":       "alias:party-wizard",
+		"mage":         "alias:wizard",
+		"yes":          "alias:thumbsup",
+		"orphan":       "alias:deleted",
+		"loop-a":       "alias:loop-b",
+		"loop-b":       "alias:loop-a",
+	})
+	want := map[string]string{
+		"party-wizard": "https://emoji.example/party-wizard.gif",
+		"wizard":       "https://emoji.example/party-wizard.gif",
+		"mage":         "https://emoji.example/party-wizard.gif",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("Images() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+// Package errs classifies the errors gh-slackdump returns, so callers and
+// the exit code can tell failures apart with errors.Is instead of matching
+// the errors of slackdump, the slack library or the cookie sources.
+//
+// Errors are classified where they enter gh-slackdump's code, with Wrap
+// where the meaning is known and Classify otherwise; main maps the classes
+// to exit codes.
+package errs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/rusq/slack"
+)
+
+// The classes of errors. An error is of a class when errors.Is reports it;
+// its message is the underlying error's.
+var (
+	// ErrAuth means the Slack session couldn't be set up or was refused.
+	ErrAuth = errors.New("authentication failed")
+	// ErrNotFound means a conversation, thread or user doesn't exist or
+	// isn't visible to the session.
+	ErrNotFound = errors.New("not found")
+	// ErrRateLimited means Slack kept refusing requests for their rate.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrPartial means the output was written, but is incomplete.
+	ErrPartial = errors.New("incomplete result")
+	// ErrUnsupportedPlatform means a feature isn't available on this
+	// platform or in this build.
+	ErrUnsupportedPlatform = errors.New("not supported on this platform or build")
+	// ErrCancelled means the run was cancelled.
+	ErrCancelled = errors.New("cancelled")
+	// ErrUnavailable means Slack itself was down for longer than the run
+	// waits for it.
+	ErrUnavailable = errors.New("Slack is unavailable")
+)
+
+// classified is an error of a class.
+type classified struct {
+	class error
+	err   error
+}
+
+func (e *classified) Error() string   { return e.err.Error() }
+func (e *classified) Unwrap() []error { return []error{e.err, e.class} }
+
+// New returns an error with text, of class.
+func New(class error, text string) error {
+	return &classified{class: class, err: errors.New(text)}
+}
+
+// Wrap returns err as an error of class. An error that already has a class
+// keeps it, so the most specific classification wins; nil stays nil.
+func Wrap(class, err error) error {
+	if err == nil || Class(err) != nil {
+		return err
+	}
+	return &classified{class: class, err: err}
+}
+
+// Classify returns err with the class of the Slack API, HTTP or context
+// error in its chain, if any, and otherwise unchanged.
+func Classify(err error) error {
+	if err == nil || Class(err) != nil {
+		return err
+	}
+	if class := thirdPartyClass(err); class != nil {
+		return &classified{class: class, err: err}
+	}
+	return err
+}
+
+// Class returns the class of err, or nil if it has none.
+func Class(err error) error {
+	var c *classified
+	if errors.As(err, &c) {
+		return c.class
+	}
+	return nil
+}
+
+// slackErrors maps Slack API error codes to classes.
+var slackErrors = map[string]error{
+	"invalid_auth":             ErrAuth,
+	"not_authed":               ErrAuth,
+	"account_inactive":         ErrAuth,
+	"token_revoked":            ErrAuth,
+	"token_expired":            ErrAuth,
+	"enterprise_is_restricted": ErrAuth,
+	"channel_not_found":        ErrNotFound,
+	"thread_not_found":         ErrNotFound,
+	"message_not_found":        ErrNotFound,
+	"user_not_found":           ErrNotFound,
+	"ratelimited":              ErrRateLimited,
+}
+
+func thirdPartyClass(err error) error {
+	var (
+		slackErr  slack.SlackErrorResponse
+		rateErr   *slack.RateLimitedError
+		statusErr slack.StatusCodeError
+	)
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrCancelled
+	case errors.As(err, &rateErr):
+		return ErrRateLimited
+	case errors.As(err, &slackErr):
+		return slackErrors[slackErr.Err]
+	case errors.As(err, &statusErr):
+		switch statusErr.Code {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return ErrAuth
+		case http.StatusNotFound:
+			return ErrNotFound
+		case http.StatusTooManyRequests:
+			return ErrRateLimited
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rusq/slack"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"invalid auth", fmt.Errorf("dump: %w", slack.SlackErrorResponse{Err: "invalid_auth"}), ErrAuth},
+		{"channel not found", slack.SlackErrorResponse{Err: "channel_not_found"}, ErrNotFound},
+		{"thread not found", fmt.Errorf("replies: %w", slack.SlackErrorResponse{Err: "thread_not_found"}), ErrNotFound},
+		{"rate limited", &slack.RateLimitedError{}, ErrRateLimited},
+		{"403", slack.StatusCodeError{Code: 403, Status: "403 Forbidden"}, ErrAuth},
+		{"429", slack.StatusCodeError{Code: 429}, ErrRateLimited},
+		{"cancelled", fmt.Errorf("fetch: %w", context.Canceled), ErrCancelled},
+		{"already classified", New(ErrPartial, "incomplete"), ErrPartial},
+		{"other Slack error", slack.SlackErrorResponse{Err: "fatal_error"}, nil},
+		{"500", slack.StatusCodeError{Code: 500}, nil},
+		{"plain", errors.New("disk full"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Classify(tt.err)
+			if Class(got) != tt.want {
+				t.Errorf("Class(Classify(%v)) = %v, want %v", tt.err, Class(got), tt.want)
+			}
+			if tt.want != nil && !errors.Is(got, tt.want) {
+				t.Errorf("errors.Is(%v, %v) = false", got, tt.want)
+			}
+			if got.Error() != tt.err.Error() {
+				t.Errorf("message = %q, want %q unchanged", got, tt.err)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	base := slack.SlackErrorResponse{Err: "invalid_auth"}
+	err := Wrap(ErrAuth, fmt.Errorf("cookie did not work: %w", base))
+	var slackErr slack.SlackErrorResponse
+	if !errors.Is(err, ErrAuth) || !errors.As(err, &slackErr) || slackErr.Err != "invalid_auth" {
+		t.Errorf("Wrap() = %v, want ErrAuth keeping the Slack error", err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Error("a wrapped error matches another class")
+	}
+
+	// The first classification wins.
+	inner := New(ErrUnsupportedPlatform, "no keychain in this build")
+	if err := Wrap(ErrAuth, fmt.Errorf("reading cookies: %w", inner)); errors.Is(err, ErrAuth) || !errors.Is(err, inner) {
+		t.Errorf("Wrap() = %v reclassified an error of class %v", err, Class(inner))
+	}
+	if Wrap(ErrAuth, nil) != nil || Classify(nil) != nil {
+		t.Error("nil errors are classified")
+	}
+}
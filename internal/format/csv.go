@@ -0,0 +1,151 @@
+package format
+
+import (
+	"cmp"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// CSVHeader names the columns WriteCSV writes.
+var CSVHeader = []string{"ts", "iso_datetime", "channel", "thread_ts", "user_handle", "text", "reply_count", "reaction_count", "file_count", "permalink_ts", "thread_permalink", "parent_user", "workflow_fields"}
+
+// WriteCSV writes conv as one row per message, each thread reply on its
+// own row after its parent. Rows of a thread share its thread_ts, the
+// parent's ts, so they group together, and its thread_permalink, the
+// parent's permalink on the workspace at workspaceURL, and parent_user,
+// the parent's author; both are empty outside threads, and
+// thread_permalink also without workspaceURL. workflow_fields holds the
+// fields of a workflow or app message as a JSON array of name and value
+// objects, empty for other messages. comma separates the fields.
+// Cells a spreadsheet would run as a formula are defused with a leading '.
+func WriteCSV(w io.Writer, conv types.Conversation, workspaceURL string, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write(CSVHeader); err != nil {
+		return err
+	}
+	channel := conv.Name
+	if channel == "" {
+		channel = conv.ID
+	}
+	// A thread dump lists the replies next to their parent, so parents are
+	// looked up among all messages.
+	authors := make(map[string]string)
+	var index func(msgs []types.Message)
+	index = func(msgs []types.Message) {
+		for _, m := range msgs {
+			authors[m.Timestamp] = author(m)
+			index(m.ThreadReplies)
+		}
+	}
+	index(conv.Messages)
+	var write func(msgs []types.Message) error
+	write = func(msgs []types.Message) error {
+		for i := range msgs {
+			row := csvRow(channel, &msgs[i])
+			var threadLink, parentUser string
+			if ts := msgs[i].ThreadTimestamp; ts != "" {
+				if workspaceURL != "" {
+					threadLink = Permalink(workspaceURL, conv.ID, ts, "")
+				}
+				parentUser = csvCell(authors[ts])
+			}
+			if err := cw.Write(append(row, threadLink, parentUser, workflowCSV(WorkflowFields(msgs[i])))); err != nil {
+				return err
+			}
+			if err := write(msgs[i].ThreadReplies); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := write(conv.Messages); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReactionsCSVHeader names the columns WriteReactionsCSV writes.
+var ReactionsCSVHeader = []string{"ts", "iso_datetime", "channel", "thread_ts", "permalink_ts", "reaction", "user_handle", "position", "reaction_count"}
+
+// WriteReactionsCSV writes conv as one row per user of each reaction of a
+// message or reply: the message's ts, time, channel, thread_ts and
+// permalink_ts as WriteCSV has them, the reaction, the user, their
+// position, from 1, among the users Slack lists for it, which is the order
+// they reacted in, and the reaction's count. Slack lists only the first
+// users of a crowded reaction, so its count may exceed the rows it gets.
+// Messages without reactions get no rows. comma separates the fields.
+func WriteReactionsCSV(w io.Writer, conv types.Conversation, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write(ReactionsCSVHeader); err != nil {
+		return err
+	}
+	channel := csvCell(cmp.Or(conv.Name, conv.ID))
+	var write func(msgs []types.Message) error
+	write = func(msgs []types.Message) error {
+		for _, m := range msgs {
+			for _, r := range m.Reactions {
+				for i, u := range r.Users {
+					row := []string{
+						m.Timestamp,
+						iso(m.Timestamp),
+						channel,
+						m.ThreadTimestamp,
+						"p" + strings.ReplaceAll(m.Timestamp, ".", ""),
+						csvCell(r.Name),
+						csvCell(u),
+						strconv.Itoa(i + 1),
+						strconv.Itoa(r.Count),
+					}
+					if err := cw.Write(row); err != nil {
+						return err
+					}
+				}
+			}
+			if err := write(m.ThreadReplies); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := write(conv.Messages); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvRow(channel string, m *types.Message) []string {
+	reactions := 0
+	for _, r := range m.Reactions {
+		reactions += r.Count
+	}
+	return []string{
+		m.Timestamp,
+		iso(m.Timestamp),
+		csvCell(channel),
+		m.ThreadTimestamp,
+		csvCell(author(*m)),
+		csvCell(PlainText(m.Text)),
+		strconv.Itoa(m.ReplyCount),
+		strconv.Itoa(reactions),
+		strconv.Itoa(len(m.Files)),
+		"p" + strings.ReplaceAll(m.Timestamp, ".", ""),
+	}
+}
+
+// csvCell prefixes s with ' when it starts like a spreadsheet formula, so
+// Excel, LibreOffice and Google Sheets show text such as "=HYPERLINK(...)"
+// instead of running it.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,153 @@
+package format
+
+import (
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestWriteCSV(t *testing.T) {
+	conv := types.Conversation{ID: "C1", Name: "general", Messages: []types.Message{
+		{Message: slack.Message{Msg: slack.Msg{
+			User: "alice", Timestamp: "1700000000.000100", ThreadTimestamp: "1700000000.000100", ReplyCount: 1,
+			Text:      "line one, with \"quotes\"\n*line* two <https://example.com|docs>",
+			Reactions: []slack.ItemReaction{{Name: "+1", Count: 2}, {Name: "eyes", Count: 1}},
+			Files:     []slack.File{{ID: "F1"}},
+		}}, ThreadReplies: []types.Message{
+			{Message: slack.Message{Msg: slack.Msg{User: "bob", Timestamp: "1700000060.000200", ThreadTimestamp: "1700000000.000100", Text: "ok"}}},
+		}},
+		{Message: slack.Message{Msg: slack.Msg{Username: "deploybot", Timestamp: "1700000120.000300", Text: "done"}}},
+	}}
+
+	var b strings.Builder
+	if err := WriteCSV(&b, conv, "https://ws.slack.com", ','); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("output doesn't parse as CSV: %v\n%s", err, b.String())
+	}
+	want := [][]string{
+		CSVHeader,
+		{"1700000000.000100", "2023-11-14T22:13:20Z", "general", "1700000000.000100", "alice", "line one, with \"quotes\"\nline two docs", "1", "3", "1", "p1700000000000100", "https://ws.slack.com/archives/C1/p1700000000000100", "alice", ""},
+		{"1700000060.000200", "2023-11-14T22:14:20Z", "general", "1700000000.000100", "bob", "ok", "0", "0", "0", "p1700000060000200", "https://ws.slack.com/archives/C1/p1700000000000100", "alice", ""},
+		{"1700000120.000300", "2023-11-14T22:15:20Z", "general", "", "deploybot", "done", "0", "0", "0", "p1700000120000300", "", "", ""},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d:\n%s", len(rows), len(want), b.String())
+	}
+	for i := range want {
+		if !slices.Equal(rows[i], want[i]) {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+
+	b.Reset()
+	if err := WriteCSV(&b, conv, "", '\t'); err != nil {
+		t.Fatal(err)
+	}
+	if first, _, _ := strings.Cut(b.String(), "\n"); first != strings.Join(CSVHeader, "\t") {
+		t.Errorf("TSV header = %q", first)
+	}
+}
+
+func TestWriteCSVThreadDump(t *testing.T) {
+	// A thread dump has the parent and its replies side by side.
+	conv := types.Conversation{ID: "C1", ThreadTS: "1700000000.000100", Messages: []types.Message{
+		{Message: slack.Message{Msg: slack.Msg{User: "alice", Timestamp: "1700000000.000100", ThreadTimestamp: "1700000000.000100", Text: "q"}}},
+		{Message: slack.Message{Msg: slack.Msg{User: "bob", Timestamp: "1700000060.000200", ThreadTimestamp: "1700000000.000100", Text: "a"}}},
+	}}
+	var b strings.Builder
+	if err := WriteCSV(&b, conv, "", ','); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows[1:] {
+		if row[10] != "" || row[11] != "alice" {
+			t.Errorf("row %q: thread_permalink %q, parent_user %q; want none without a workspace, and alice", row[0], row[10], row[11])
+		}
+	}
+}
+
+func TestWriteCSVDefusesFormulas(t *testing.T) {
+	conv := types.Conversation{ID: "C1", Name: "general"}
+	for i, text := range []string{"=HYPERLINK(\"https://evil.example\")", "+1 agreed", "-2", "@here lunch", "\t=1", "plain = text"} {
+		conv.Messages = append(conv.Messages, types.Message{Message: slack.Message{Msg: slack.Msg{User: "@alice", Timestamp: fmt.Sprintf("1700000000.00010%d", i), Text: text}}})
+	}
+	var b strings.Builder
+	if err := WriteCSV(&b, conv, "", ','); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, row := range rows[1:] {
+		texts = append(texts, row[5])
+		if row[4] != "'@alice" {
+			t.Errorf("user_handle = %q, want '@alice", row[4])
+		}
+	}
+	want := []string{"'=HYPERLINK(\"https://evil.example\")", "'+1 agreed", "'-2", "'@here lunch", "'\t=1", "plain = text"}
+	if !slices.Equal(texts, want) {
+		t.Errorf("text cells = %q, want %q", texts, want)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"*bold* _it_ ~gone~ `x`", "bold it gone x"},
+		{"see <https://example.com/a?b=1&amp;c=2> and <https://example.com|the docs>", "see https://example.com/a?b=1&c=2 and the docs"},
+		{"<@U1> <@U2|bob> <#C1|general> <!here> <!subteam^S1|@oncall>", "@U1 @bob #general @here @oncall"},
+		{"a &lt; b &amp;&amp; c &gt; d :tada:", "a < b && c > d :tada:"},
+		{"```code *x*```", "code *x*"},
+	}
+	for _, tt := range tests {
+		if got := PlainText(tt.in); got != tt.want {
+			t.Errorf("PlainText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteReactionsCSV(t *testing.T) {
+	conv := types.Conversation{ID: "C1", Messages: []types.Message{
+		{Message: slack.Message{Msg: slack.Msg{
+			Timestamp: "1700000000.000100",
+			Reactions: []slack.ItemReaction{
+				{Name: "eyes", Count: 3, Users: []string{"zed", "alice"}},
+				{Name: "+1", Count: 1, Users: []string{"=bob"}},
+			},
+		}}, ThreadReplies: []types.Message{
+			{Message: slack.Message{Msg: slack.Msg{Timestamp: "1700000060.000200", ThreadTimestamp: "1700000000.000100", Reactions: []slack.ItemReaction{{Name: "tada", Count: 1, Users: []string{"carol"}}}}}},
+		}},
+		{Message: slack.Message{Msg: slack.Msg{Timestamp: "1700000120.000300", Text: "no reactions"}}},
+	}}
+
+	var b strings.Builder
+	if err := WriteReactionsCSV(&b, conv, ','); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("output doesn't parse as CSV: %v\n%s", err, b.String())
+	}
+	want := [][]string{
+		ReactionsCSVHeader,
+		{"1700000000.000100", "2023-11-14T22:13:20Z", "C1", "", "p1700000000000100", "eyes", "zed", "1", "3"},
+		{"1700000000.000100", "2023-11-14T22:13:20Z", "C1", "", "p1700000000000100", "eyes", "alice", "2", "3"},
+		{"1700000000.000100", "2023-11-14T22:13:20Z", "C1", "", "p1700000000000100", "'+1", "'=bob", "1", "1"},
+		{"1700000060.000200", "2023-11-14T22:14:20Z", "C1", "1700000000.000100", "p1700000060000200", "tada", "carol", "1", "1"},
+	}
+	if !slices.EqualFunc(rows, want, slices.Equal) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+}
@@ -0,0 +1,91 @@
+package format
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// DigestThread is a thread of a digest: the dumped thread, or the error
+// that kept it from being dumped.
+type DigestThread struct {
+	// Link is the permalink the thread was listed with.
+	Link string
+	// Conversation is the thread as dumped, its parent first; nil when Err
+	// is set.
+	Conversation *types.Conversation
+	Err          error
+}
+
+// WriteDigest writes threads as one Markdown document: a table of contents
+// linking to a section per thread, in the order given, with the parent and
+// its replies. A thread that failed gets a section noting why. With
+// workspaceURL set, each message's time links to its Slack permalink.
+func WriteDigest(w io.Writer, title, workspaceURL string, threads []DigestThread) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %s\n\n", title)
+	for i, t := range threads {
+		fmt.Fprintf(bw, "%d. [%s](#thread-%d)\n", i+1, digestTitle(t), i+1)
+	}
+	for i, t := range threads {
+		fmt.Fprintf(bw, "\n<a id=\"thread-%d\"></a>\n\n## %d. %s\n\n", i+1, i+1, digestTitle(t))
+		fmt.Fprintf(bw, "[Open in Slack](%s)\n", t.Link)
+		if t.Err != nil {
+			fmt.Fprintf(bw, "\n> **Note:** this thread couldn't be dumped: %s\n", oneLine(t.Err.Error()))
+			continue
+		}
+		// A thread dump lists the parent, then its replies.
+		msgs := t.Conversation.Messages
+		channel := t.Conversation.ID
+		writeDigestMessage(bw, msgs[0], "", workspaceURL, channel)
+		if len(msgs) > 1 {
+			fmt.Fprintf(bw, "\n**Replies: %d**\n", len(msgs)-1)
+		}
+		for _, r := range msgs[1:] {
+			writeDigestMessage(bw, r, "> ", workspaceURL, channel)
+		}
+	}
+	return bw.Flush()
+}
+
+// digestTitle names a thread in the table of contents and its heading: the
+// channel and the first line of the parent as plain text.
+func digestTitle(t DigestThread) string {
+	if t.Conversation == nil {
+		return "Unavailable thread"
+	}
+	channel := "#" + cmp.Or(t.Conversation.Name, t.Conversation.ID)
+	if len(t.Conversation.Messages) == 0 {
+		return channel
+	}
+	first, _, _ := strings.Cut(PlainText(t.Conversation.Messages[0].Text), "\n")
+	first = strings.NewReplacer("[", "(", "]", ")").Replace(strings.TrimSpace(first))
+	if first == "" {
+		return channel
+	}
+	return channel + ": " + abbrev(60, first)
+}
+
+// writeDigestMessage writes m's author, time, text, workflow fields and
+// shared messages, each line prefixed
+// with prefix. With workspaceURL set, the time links to m's permalink in
+// channel.
+func writeDigestMessage(w io.Writer, m types.Message, prefix, workspaceURL, channel string) {
+	when := msgTime(m.Timestamp).Format("2006-01-02 15:04 UTC")
+	if workspaceURL != "" {
+		when = fmt.Sprintf("[%s](%s)", when, Permalink(workspaceURL, channel, m.Timestamp, m.ThreadTimestamp))
+	}
+	fmt.Fprintf(w, "\n%s**%s** · %s\n%s\n", prefix, author(m), when, prefix)
+	for _, line := range withShares(workflowLines(m, GFM(m.Text, m.Blocks, GFMOptions{}), GFMOptions{}), m, GFMOptions{}) {
+		fmt.Fprintf(w, "%s%s\n", prefix, line)
+	}
+}
+
+// oneLine joins the lines of s with spaces.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
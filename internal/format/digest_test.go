@@ -0,0 +1,65 @@
+package format
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestWriteDigest(t *testing.T) {
+	msg := func(user, text, ts string) types.Message {
+		return types.Message{Message: slack.Message{Msg: slack.Msg{User: user, Text: text, Timestamp: ts}}}
+	}
+	threads := []DigestThread{
+		{
+			Link: "https://example.slack.com/archives/C1/p1700000000000100",
+			Conversation: &types.Conversation{ID: "C1", Name: "support", Messages: []types.Message{
+				msg("alice", "Login *fails* for [EU] users\nmore detail", "1700000000.000100"),
+				msg("bob", "fixed\nin prod", "1700000060.000100"),
+			}},
+		},
+		{
+			Link: "https://example.slack.com/archives/C2/p1700000100000100",
+			Err:  errors.New("channel_not_found"),
+		},
+	}
+	var buf bytes.Buffer
+	if err := WriteDigest(&buf, "Thread digest", "", threads); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"# Thread digest\n\n1. [#support: Login fails for (EU) users](#thread-1)\n2. [Unavailable thread](#thread-2)\n",
+		"<a id=\"thread-1\"></a>\n\n## 1. #support: Login fails for (EU) users\n\n[Open in Slack](https://example.slack.com/archives/C1/p1700000000000100)\n",
+		"**alice** · 2023-11-14 22:13 UTC\n\nLogin **fails** for [EU] users\nmore detail\n",
+		"**Replies: 1**\n\n> **bob** · 2023-11-14 22:14 UTC\n> \n> fixed\n> in prod\n",
+		"## 2. Unavailable thread\n\n[Open in Slack](https://example.slack.com/archives/C2/p1700000100000100)\n\n> **Note:** this thread couldn't be dumped: channel_not_found\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("digest lacks %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestWriteDigestPermalinks(t *testing.T) {
+	conv := &types.Conversation{ID: "C1", Messages: []types.Message{
+		{Message: slack.Message{Msg: slack.Msg{User: "alice", Text: "q", Timestamp: "1700000000.000100", ThreadTimestamp: "1700000000.000100"}}},
+		{Message: slack.Message{Msg: slack.Msg{User: "bob", Text: "a", Timestamp: "1700000060.000100", ThreadTimestamp: "1700000000.000100"}}},
+	}}
+	var buf bytes.Buffer
+	if err := WriteDigest(&buf, "Thread digest", "https://example.slack.com", []DigestThread{{Link: "https://example.slack.com/archives/C1/p1700000000000100", Conversation: conv}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"**alice** · [2023-11-14 22:13 UTC](https://example.slack.com/archives/C1/p1700000000000100)\n",
+		"> **bob** · [2023-11-14 22:14 UTC](https://example.slack.com/archives/C1/p1700000060000100?thread_ts=1700000000.000100&cid=C1)\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("digest lacks %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package format
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rusq/slack"
+)
+
+// GFMOptions tunes GFM for where its Markdown is read.
+type GFMOptions struct {
+	// Text, when set, rewrites text outside code, mentions included, once
+	// it is escaped: GitHub output uses it to keep @name from notifying a
+	// GitHub user.
+	Text func(string) string
+	// Emoji renders an emoji by name; as :name: when nil.
+	Emoji func(name string) string
+}
+
+// GFM returns a message as GitHub-flavored Markdown. When the message has
+// rich_text blocks they are used, as they say exactly what is formatted
+// and how; otherwise its mrkdwn text is converted. Either way bold, italic,
+// strike and code become **bold**, _italic_, ~~strike~~ and `code`, code
+// blocks are fenced on lines of their own, links become [label](url),
+// mentions and broadcasts @name or #name, quotes > lines and lists - or 1.
+// items. Slack's escaping is undone, and text that Markdown would take for
+// markup or HTML is escaped.
+func GFM(text string, blocks slack.Blocks, opts GFMOptions) string {
+	if md, ok := opts.richText(blocks); ok {
+		return md
+	}
+	return opts.mrkdwn(text)
+}
+
+func (o GFMOptions) text(s string) string {
+	if o.Text == nil {
+		return s
+	}
+	return o.Text(s)
+}
+
+func (o GFMOptions) emoji(name string) string {
+	if o.Emoji == nil {
+		return ":" + name + ":"
+	}
+	return o.Emoji(name)
+}
+
+// richText renders the rich_text blocks of a message, reporting false when
+// it has none. Blocks of other types, which apps post, are left to the
+// text, as the Slack client does.
+func (o GFMOptions) richText(blocks slack.Blocks) (string, bool) {
+	var chunks []string
+	found, prevList := false, false
+	// widths are the marker widths of the latest list at each indent, which
+	// the items of deeper lists are indented by.
+	widths := map[int]int{}
+	for _, bl := range blocks.BlockSet {
+		rt, ok := bl.(*slack.RichTextBlock)
+		if !ok {
+			continue
+		}
+		found = true
+		for _, e := range rt.Elements {
+			var chunk string
+			list := false
+			switch e := e.(type) {
+			case *slack.RichTextSection:
+				chunk = escapeBlockStarts(o.section(e.Elements))
+			case *slack.RichTextQuote:
+				chunk = quoteLines(escapeBlockStarts(o.section(e.Elements)))
+			case *slack.RichTextPreformatted:
+				var code strings.Builder
+				for _, se := range e.Elements {
+					code.WriteString(plainText(se))
+				}
+				chunk = fence(code.String())
+			case *slack.RichTextList:
+				chunk, list = o.list(e, widths), true
+			}
+			if chunk = strings.Trim(chunk, "\n"); chunk == "" {
+				continue
+			}
+			// Markdown needs a blank line to end a list or quote before the
+			// text that follows, but one list nests in another without.
+			if len(chunks) > 0 {
+				sep := "\n\n"
+				if list && prevList {
+					sep = "\n"
+				}
+				chunks = append(chunks, sep)
+			}
+			chunks = append(chunks, chunk)
+			prevList = list
+		}
+	}
+	return strings.Join(chunks, ""), found
+}
+
+// list renders the items of a rich text list, indented under the items of
+// the lists it nests in.
+func (o GFMOptions) list(l *slack.RichTextList, widths map[int]int) string {
+	var pad strings.Builder
+	for i := range l.Indent {
+		w, ok := widths[i]
+		if !ok {
+			w = 2
+		}
+		pad.WriteString(strings.Repeat(" ", w))
+	}
+	var b strings.Builder
+	for i, item := range l.Elements {
+		marker := "- "
+		if l.Style == slack.RTEListOrdered {
+			marker = fmt.Sprintf("%d. ", l.Offset+i+1)
+		}
+		widths[l.Indent] = len(marker)
+		var text string
+		if s, ok := item.(*slack.RichTextSection); ok {
+			text = escapeBlockStarts(o.section(s.Elements))
+		}
+		lines := strings.Split(strings.Trim(text, "\n"), "\n")
+		b.WriteString(pad.String() + marker + lines[0] + "\n")
+		for _, line := range lines[1:] {
+			b.WriteString(pad.String() + strings.Repeat(" ", len(marker)) + line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// section renders the inline elements of a rich text section.
+func (o GFMOptions) section(elems []slack.RichTextSectionElement) string {
+	var b strings.Builder
+	for _, e := range elems {
+		switch e := e.(type) {
+		case *slack.RichTextSectionTextElement:
+			if e.Style != nil && e.Style.Code {
+				b.WriteString(styleLines(e.Style, codeSpan(e.Text)))
+				continue
+			}
+			b.WriteString(styleLines(e.Style, o.text(escapeGFM(e.Text))))
+		case *slack.RichTextSectionLinkElement:
+			if e.Text == "" || e.Text == e.URL {
+				b.WriteString(styleLines(e.Style, e.URL))
+				continue
+			}
+			b.WriteString(styleLines(e.Style, "["+o.text(escapeGFM(e.Text))+"]("+linkTarget(e.URL)+")"))
+		case *slack.RichTextSectionEmojiElement:
+			b.WriteString(o.emoji(e.Name))
+		case *slack.RichTextSectionUserElement:
+			b.WriteString(styleLines(e.Style, o.text(escapeGFM("@"+e.UserID))))
+		case *slack.RichTextSectionUserGroupElement:
+			b.WriteString(o.text(escapeGFM("@" + e.UsergroupID)))
+		case *slack.RichTextSectionChannelElement:
+			b.WriteString(styleLines(e.Style, o.text(escapeGFM("#"+e.ChannelID))))
+		case *slack.RichTextSectionBroadcastElement:
+			b.WriteString(o.text("@" + e.Range))
+		case *slack.RichTextSectionTeamElement, *slack.RichTextSectionDateElement, *slack.RichTextSectionColorElement:
+			b.WriteString(o.text(escapeGFM(plainText(e))))
+		}
+	}
+	return b.String()
+}
+
+// styleLines wraps each line of s in the Markdown of style. Spaces at
+// either end are kept outside, where Markdown needs them to see the
+// markers.
+func styleLines(style *slack.RichTextSectionTextStyle, s string) string {
+	if style == nil {
+		return s
+	}
+	var open, close string
+	for _, t := range []struct {
+		on     bool
+		marker string
+	}{{style.Bold, "**"}, {style.Italic, "_"}, {style.Strike, "~~"}} {
+		if t.on {
+			open += t.marker
+			close = t.marker + close
+		}
+	}
+	if open == "" {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		core := strings.TrimSpace(l)
+		if core == "" {
+			continue
+		}
+		start := strings.Index(l, core)
+		lines[i] = l[:start] + open + core + close + l[start+len(core):]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// codeSpan returns s as inline code, delimited by more backticks than it
+// holds in a row.
+func codeSpan(s string) string {
+	tick := strings.Repeat("`", longestRun(s, '`')+1)
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return tick + s + tick
+}
+
+// fence returns code as a fenced code block.
+func fence(code string) string {
+	tick := strings.Repeat("`", max(3, longestRun(code, '`')+1))
+	return tick + "\n" + strings.Trim(code, "\n") + "\n" + tick
+}
+
+func longestRun(s string, c byte) int {
+	n, run := 0, 0
+	for i := range len(s) {
+		if s[i] != c {
+			run = 0
+			continue
+		}
+		run++
+		n = max(n, run)
+	}
+	return n
+}
+
+// quoteLines prefixes each line of s with "> ".
+func quoteLines(s string) string {
+	lines := strings.Split(strings.Trim(s, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight("> "+l, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// linkTarget returns url as the target of a Markdown link, which ends at
+// a space or an unmatched parenthesis.
+var linkTarget = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace
+
+// escapeGFM escapes rich text, which is literal, where Markdown would take
+// it for formatting, links or HTML.
+func escapeGFM(s string) string {
+	return escapeEntities(gfmEscaper.Replace(s))
+}
+
+var (
+	gfmEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`)
+	// blockStartRe matches what starts a Markdown block at the start of a
+	// line: a heading, quote, list item or rule.
+	blockStartRe = regexp.MustCompile(`(?m)^( {0,3})(#{1,6}(?:[ \t]|$)|>|[-+](?:[ \t]|$)|[-=]{2,}[ \t]*$|\d{1,9}[.)](?:[ \t]|$))`)
+	// headingStartRe matches the headings and rules of blockStartRe, which
+	// mrkdwn text has none of; its quotes and lists are converted.
+	headingStartRe = regexp.MustCompile(`(?m)^( {0,3})(#{1,6}(?:[ \t]|$)|[-=]{2,}[ \t]*$)`)
+)
+
+// escapeBlockStarts escapes the block markup re matches at the start of
+// the lines of s, so rich text reads as the text it is.
+func escapeBlockStarts(s string) string {
+	return escapeStarts(blockStartRe, s)
+}
+
+func escapeStarts(re *regexp.Regexp, s string) string {
+	return re.ReplaceAllStringFunc(s, func(m string) string {
+		marker := strings.TrimLeft(m, " ")
+		indent := m[:len(m)-len(marker)]
+		// An ordered item's number stays; its . or ) is escaped.
+		i := strings.IndexFunc(marker, func(r rune) bool { return r < '0' || r > '9' })
+		return indent + marker[:i] + `\` + marker[i:]
+	})
+}
+
+// mrkdwn converts mrkdwn text: code blocks first, which nothing applies
+// in, then the lines between them.
+func (o GFMOptions) mrkdwn(text string) string {
+	parts := strings.Split(text, "```")
+	var b strings.Builder
+	for i, p := range parts {
+		switch {
+		case i%2 == 0:
+		case i < len(parts)-1:
+			// Code blocks show a link's URL, as Slack does.
+			code := slackEntityRe.ReplaceAllStringFunc(p, func(m string) string {
+				t, href := entityText(m[1 : len(m)-1])
+				if href != "" {
+					return href
+				}
+				return t
+			})
+			b.WriteString("\n" + fence(unescapeSlack(code)) + "\n")
+			continue
+		default:
+			// An unclosed block is text, as in Slack.
+			p = "\\`\\`\\`" + p
+		}
+		b.WriteString(o.mrkdwnLines(p))
+	}
+	return strings.Trim(b.String(), "\n")
+}
+
+// mrkdwnLines converts text outside code blocks line by line: &gt; quotes
+// and • bullets, which Slack writes lists as, become Markdown's.
+func (o GFMOptions) mrkdwnLines(s string) string {
+	lines := strings.Split(s, "\n")
+	var out []string
+	inBlock := false
+	for _, l := range lines {
+		block := true
+		switch rest, ok := cutQuote(l); {
+		case ok:
+			l = strings.TrimRight("> "+o.mrkdwnInline(rest), " ")
+		default:
+			trimmed := strings.TrimLeft(l, " \t")
+			bullet, item, ok := cutBullet(trimmed)
+			if !ok {
+				block = false
+				l = escapeStarts(headingStartRe, o.mrkdwnInline(l))
+				break
+			}
+			// Slack indents nested items by four spaces, or marks them
+			// with a different bullet.
+			depth := (len(l) - len(trimmed)) / 4
+			if depth == 0 {
+				depth = strings.Index("•◦▪", bullet) / len("•")
+			}
+			l = strings.Repeat("  ", depth) + "- " + o.mrkdwnInline(item)
+		}
+		// A line of text after a quote or list would continue it.
+		if inBlock && !block && l != "" {
+			out = append(out, "")
+		}
+		out = append(out, l)
+		inBlock = block
+	}
+	return strings.Join(out, "\n")
+}
+
+// cutQuote returns the text of a > quote line, which Slack escapes.
+func cutQuote(l string) (string, bool) {
+	for _, q := range []string{"&gt;", ">"} {
+		if rest, ok := strings.CutPrefix(l, q); ok {
+			return strings.TrimPrefix(rest, " "), true
+		}
+	}
+	return "", false
+}
+
+// cutBullet returns the bullet and text of a list item as Slack writes it.
+func cutBullet(l string) (bullet, item string, ok bool) {
+	for _, b := range []string{"•", "◦", "▪"} {
+		if rest, ok := strings.CutPrefix(l, b+" "); ok {
+			return b, rest, true
+		}
+	}
+	return "", "", false
+}
+
+// mrkdwnInline converts a line of mrkdwn text, keeping `code` as it is.
+func (o GFMOptions) mrkdwnInline(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range inlineCodeRe.FindAllStringIndex(s, -1) {
+		b.WriteString(o.mrkdwnFormat(s[last:loc[0]]))
+		b.WriteString(unescapeSlack(s[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	b.WriteString(o.mrkdwnFormat(s[last:]))
+	return b.String()
+}
+
+// gfmEntityRe matches an HTML entity, which Markdown reads as the character
+// it stands for.
+var gfmEntityRe = regexp.MustCompile(`&(#[0-9]+|#[xX][0-9a-fA-F]+|[A-Za-z][A-Za-z0-9]*);`)
+
+// escapeEntities escapes the & of text that reads as an HTML entity, such
+// as a literal &lt;, so it shows as typed.
+func escapeEntities(s string) string {
+	return gfmEntityRe.ReplaceAllString(s, "&amp;$1;")
+}
+
+// mrkdwnFormat converts mrkdwn text outside code: <...> entities, then
+// Slack's escaping, then *bold* and ~strike~ (_italic_ reads the same),
+// then emoji.
+func (o GFMOptions) mrkdwnFormat(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range slackEntityRe.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(escapeMrkdwn(s[last:loc[0]]))
+		b.WriteString(gfmEntity(s[loc[2]:loc[3]]))
+		last = loc[1]
+	}
+	b.WriteString(escapeMrkdwn(s[last:]))
+	s = boldRe.ReplaceAllString(b.String(), "$1**$2**")
+	s = strikeRe.ReplaceAllString(s, "$1~~$2~~")
+	s = o.text(s)
+	return emojiRe.ReplaceAllStringFunc(s, func(m string) string {
+		return o.emoji(strings.Trim(m, ":"))
+	})
+}
+
+// escapeMrkdwn undoes Slack's escaping of text, escaping what Markdown
+// would then take for HTML. Formatting characters are left for mrkdwn's
+// own formatting, which GFM reads alike.
+func escapeMrkdwn(s string) string {
+	return strings.ReplaceAll(escapeEntities(unescapeSlack(s)), "<", `\<`)
+}
+
+// gfmEntity renders the inside of a <...> entity: a link as [label](url),
+// a date as its fallback text and anything else as entityText names it.
+func gfmEntity(s string) string {
+	if strings.HasPrefix(s, "!date^") {
+		_, label, _ := strings.Cut(s, "|")
+		return escapeMrkdwn(label)
+	}
+	t, href := entityText(s)
+	t = escapeMrkdwn(t)
+	href = unescapeSlack(href)
+	if href == "" || t == href {
+		return t
+	}
+	return "[" + strings.NewReplacer("[", `\[`, "]", `\]`).Replace(t) + "](" + linkTarget(href) + ")"
+}
@@ -0,0 +1,53 @@
+package format
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// TestGFMCorpus renders each message in testdata/gfm, as Slack's API returns
+// it, and compares the result with the .md file of the same name.
+func TestGFMCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "gfm", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no messages in testdata/gfm")
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var m slack.Message
+			if err := json.Unmarshal(data, &m); err != nil {
+				t.Fatal(err)
+			}
+			got := GFM(m.Text, m.Blocks, GFMOptions{}) + "\n"
+			golden := strings.TrimSuffix(file, ".json") + ".md"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("GFM drifted from %s (run go test -update to accept):\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
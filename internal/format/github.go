@@ -0,0 +1,249 @@
+package format
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/emoji"
+)
+
+// GitHubCommentLimit is the most characters GitHub takes in the body of an
+// issue, discussion or comment.
+const GitHubCommentLimit = 65536
+
+// GitHubOptions tunes GitHubMarkdown.
+type GitHubOptions struct {
+	// Source is the Slack link the conversation was dumped from, linked in
+	// each part's header; empty when unknown.
+	Source string
+	// Workspace, when set, links each message's time to its permalink.
+	Workspace string
+	// CustomEmoji maps the names of custom emoji to the URLs of their
+	// images, shown inline; those missing from it stay :name:, which GitHub
+	// shows as text.
+	CustomEmoji map[string]string
+	// Posture names what limits posting in the channel, such as
+	// "read-only", shown after the channel in each part's title.
+	Posture []string
+	// Matches maps the ts of messages to the labels of the patterns they
+	// matched, shown after their time as badges.
+	Matches map[string][]string
+	// RawTS adds each message's ts, from which its permalink is made, after
+	// its time.
+	RawTS bool
+	// Limit is the most bytes of a part, header included;
+	// GitHubCommentLimit when 0. Bytes are never fewer than characters, so
+	// parts fit GitHub's limit whatever the text.
+	Limit int
+}
+
+// GitHubMarkdown returns conv as GitHub-flavored Markdown, in parts that
+// each fit in one GitHub comment. Each part starts with a header naming the
+// channel, the part's number and the time range of its messages, and
+// linking the Slack source. Messages are as in WriteDigest, with replies
+// quoted under their parent, files as links and reactions as GitHub emoji.
+// Parts break between messages; a thread broken across parts says so where
+// it continues, and a message too long for a part of its own is cut between
+// lines.
+func GitHubMarkdown(conv types.Conversation, opts GitHubOptions) []string {
+	limit := cmp.Or(opts.Limit, GitHubCommentLimit)
+	title := "#" + cmp.Or(conv.Name, conv.ID)
+	var posture string
+	if len(opts.Posture) > 0 {
+		posture = " (" + strings.Join(opts.Posture, ", ") + ")"
+	}
+	units := gitHubUnits(conv, opts)
+	total := 0
+	for _, u := range units {
+		total += len(u.cont) + len(u.text)
+	}
+	// Every part holds a byte at least, so there are no more parts than
+	// bytes: the header of that many parts is the longest there can be.
+	budget := max(limit-len(gitHubHeader(title, posture, opts.Source, total+1, total+1, "0", "0")), 1)
+
+	var parts []*gitHubPart
+	var cur *gitHubPart
+	for _, u := range units {
+		if cur != nil && cur.body.Len()+len(u.text) > budget {
+			cur = nil
+		}
+		text := u.text
+		if cur == nil {
+			text = u.cont + u.text
+		}
+		for _, chunk := range splitLines(text, budget) {
+			if cur == nil || cur.body.Len()+len(chunk) > budget {
+				cur = &gitHubPart{first: u.ts}
+				parts = append(parts, cur)
+			}
+			cur.body.WriteString(chunk)
+			cur.last = u.ts
+		}
+	}
+	if len(parts) == 0 {
+		return []string{gitHubHeader(title, posture, opts.Source, 1, 1, "", "")}
+	}
+	out := make([]string, len(parts))
+	for i, p := range parts {
+		out[i] = gitHubHeader(title, posture, opts.Source, i+1, len(parts), p.first, p.last) + p.body.String()
+	}
+	return out
+}
+
+// gitHubUnit is a message of GitHubMarkdown, which parts don't break: its
+// ts, its Markdown and, for a reply, the line that continues its thread at
+// the start of a part.
+type gitHubUnit struct {
+	ts, text, cont string
+}
+
+type gitHubPart struct {
+	body        strings.Builder
+	first, last string
+}
+
+// gitHubUnits renders the messages of conv, each reply after its parent.
+func gitHubUnits(conv types.Conversation, opts GitHubOptions) []gitHubUnit {
+	gfm := gitHubGFM
+	if len(opts.CustomEmoji) > 0 {
+		gfm.Emoji = gitHubEmoji(opts.CustomEmoji)
+	}
+	msgs := conv.Messages
+	if conv.ThreadTS != "" {
+		msgs = nestThread(msgs, conv.ThreadTS)
+	}
+	var units []gitHubUnit
+	for _, m := range msgs {
+		text := gitHubMessage(m, "", conv.ID, opts, gfm)
+		if len(m.ThreadReplies) > 0 {
+			text += fmt.Sprintf("\n**Replies: %d**\n", len(m.ThreadReplies))
+		}
+		units = append(units, gitHubUnit{ts: m.Timestamp, text: text})
+		when := clock(m.Timestamp)
+		if opts.RawTS {
+			when += markdownTS(m.Timestamp)
+		}
+		cont := fmt.Sprintf("\n*Continuing the thread of **%s** · %s:*\n", author(m), when)
+		for _, r := range m.ThreadReplies {
+			units = append(units, gitHubUnit{ts: r.Timestamp, text: gitHubMessage(r, "> ", conv.ID, opts, gfm), cont: cont})
+		}
+	}
+	return units
+}
+
+// gitHubHeader is the header of part i of n, whose messages run from the
+// ts first to last, with the channel's posture after its title.
+func gitHubHeader(title, posture, source string, i, n int, first, last string) string {
+	var b strings.Builder
+	b.WriteString("# " + title + posture)
+	if n > 1 {
+		fmt.Fprintf(&b, " · part %d of %d", i, n)
+	}
+	b.WriteString("\n\n")
+	if source != "" {
+		fmt.Fprintf(&b, "Moved from [%s on Slack](%s).  \n", title, source)
+	}
+	if first != "" {
+		fmt.Fprintf(&b, "Messages from %s to %s.\n", clock(first), clock(last))
+	}
+	b.WriteString("\n---\n")
+	return b.String()
+}
+
+// gitHubMessage writes m's author, time, text, workflow fields, shared
+// messages, files and reactions, each line prefixed with prefix, rendering
+// text and emoji with gfm. With opts.Workspace set, the time links to m's
+// permalink in channel; with opts.RawTS, m's ts follows it, then the
+// labels of the patterns m matched as badges.
+func gitHubMessage(m types.Message, prefix, channel string, opts GitHubOptions, gfm GFMOptions) string {
+	when := clock(m.Timestamp)
+	if opts.Workspace != "" {
+		when = fmt.Sprintf("[%s](%s)", when, Permalink(opts.Workspace, channel, m.Timestamp, m.ThreadTimestamp))
+	}
+	if opts.RawTS {
+		when += markdownTS(m.Timestamp)
+	}
+	if labels := opts.Matches[m.Timestamp]; len(labels) > 0 {
+		when += " · 🔎 `" + strings.Join(labels, "` `") + "`"
+	}
+	lines := []string{fmt.Sprintf("**%s** · %s", author(m), when), ""}
+	lines = append(lines, withShares(workflowLines(m, GFM(m.Text, m.Blocks, gfm), gfm), m, gfm)...)
+	if len(m.Files) > 0 {
+		lines = append(lines, "")
+	}
+	for _, f := range m.Files {
+		name := cmp.Or(f.Name, f.Title, f.ID)
+		if href := fileLink(f); href != "" {
+			name = fmt.Sprintf("[%s](%s)", name, href)
+		}
+		lines = append(lines, "- 📎 "+name)
+	}
+	if len(m.Reactions) > 0 {
+		r := make([]string, len(m.Reactions))
+		for i, re := range m.Reactions {
+			r[i] = fmt.Sprintf("%s %d", gfm.emoji(re.Name), re.Count)
+		}
+		lines = append(lines, "", strings.Join(r, " · "))
+	}
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString("\n" + strings.TrimRight(prefix+l, " "))
+	}
+	return b.String() + "\n"
+}
+
+// markdownTS is the suffix RawTS adds after a time in Markdown: the ts as
+// code, so it reads as an identifier and copies as is.
+func markdownTS(ts string) string {
+	return " · `" + ts + "`"
+}
+
+// gitHubGFM renders messages for GitHub: a zero-width space after the @
+// of a mention, resolved or not, keeps GitHub from linking, and notifying,
+// a GitHub user of that name, and emoji are GitHub shortcodes.
+var gitHubGFM = GFMOptions{
+	Text: func(s string) string {
+		return gitHubMentionRe.ReplaceAllString(s, "$1@&#8203;$2")
+	},
+	Emoji: emoji.GitHub,
+}
+
+// gitHubEmoji renders emoji as gitHubGFM does, but custom emoji with an
+// image in custom as that image, at the height of the text around it.
+func gitHubEmoji(custom map[string]string) func(name string) string {
+	return func(name string) string {
+		if _, ok := emoji.Char(name); !ok && custom[name] != "" {
+			code := html.EscapeString(":" + name + ":")
+			return `<img src="` + html.EscapeString(custom[name]) + `" alt="` + code + `" title="` + code + `" height="20">`
+		}
+		return emoji.GitHub(name)
+	}
+}
+
+var gitHubMentionRe = regexp.MustCompile(`(^|[^\w/&;])@(\w)`)
+
+// splitLines cuts s into pieces of at most n bytes, between lines where it
+// can and between characters where a line is longer.
+func splitLines(s string, n int) []string {
+	var out []string
+	for len(s) > n {
+		cut := strings.LastIndexByte(s[:n], '\n')
+		if cut <= 0 {
+			cut = n
+			for cut > 0 && !utf8.RuneStart(s[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				_, cut = utf8.DecodeRuneInString(s)
+			}
+		}
+		out = append(out, s[:cut])
+		s = s[cut:]
+	}
+	return append(out, s)
+}
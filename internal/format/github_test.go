@@ -0,0 +1,118 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestGitHubGFM(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"*bold* _it_ ~gone~ `*x*` :thinking_face: :partyparrot:", "**bold** _it_ ~~gone~~ `*x*` :thinking: :partyparrot:"},
+		{"hi @bob and <@alice>, mail a@b.example", "hi @&#8203;bob and @&#8203;alice, mail a@b.example"},
+		{"see <https://example.com|the docs> &lt;div&gt;", "see [the docs](https://example.com) \\<div>"},
+		{"run ```go test &lt;pkg&gt;``` now", "run \n```\ngo test <pkg>\n```\n now"},
+		{"```\ncode\n```", "```\ncode\n```"},
+	}
+	for _, tt := range tests {
+		if got := GFM(tt.in, slack.Blocks{}, gitHubGFM); got != tt.want {
+			t.Errorf("GFM(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGitHubMarkdownCustomEmoji(t *testing.T) {
+	msg := types.Message{Message: slack.Message{Msg: slack.Msg{Timestamp: "1704099600.000100", User: "alice", Text: "shipped :party-wizard: :thinking_face:"}}}
+	msg.Reactions = []slack.ItemReaction{{Name: "party-wizard", Count: 3}}
+	conv := types.Conversation{ID: "C1", Name: "general", Messages: []types.Message{msg}}
+	parts := GitHubMarkdown(conv, GitHubOptions{CustomEmoji: map[string]string{"party-wizard": "../emoji/party-wizard.gif"}})
+	img := `<img src="../emoji/party-wizard.gif" alt=":party-wizard:" title=":party-wizard:" height="20">`
+	if len(parts) != 1 || strings.Count(parts[0], img) != 2 || !strings.Contains(parts[0], ":thinking:") {
+		t.Errorf("custom emoji aren't images in the text and reactions:\n%s", parts)
+	}
+}
+
+func TestGitHubMarkdownMatches(t *testing.T) {
+	conv := types.Conversation{ID: "C1", Name: "general", Messages: []types.Message{
+		{Message: slack.Message{Msg: slack.Msg{Timestamp: "1704099600.000100", User: "alice", Text: "payment_id=42 refunded"}}},
+		{Message: slack.Message{Msg: slack.Msg{Timestamp: "1704099700.000100", User: "bob", Text: "context"}}},
+	}}
+	got := GitHubMarkdown(conv, GitHubOptions{Matches: map[string][]string{"1704099600.000100": {"payment", "refund"}}})[0]
+	if want := "**alice** · 2024-01-01 09:00 UTC · 🔎 `payment` `refund`\n"; !strings.Contains(got, want) {
+		t.Errorf("gh-markdown lacks %q:\n%s", want, got)
+	}
+	if want := "**bob** · 2024-01-01 09:01 UTC\n"; !strings.Contains(got, want) {
+		t.Errorf("gh-markdown lacks %q, a message without matches:\n%s", want, got)
+	}
+}
+
+func TestGitHubMarkdown(t *testing.T) {
+	msg := func(ts, user, text string) types.Message {
+		return types.Message{Message: slack.Message{Msg: slack.Msg{Timestamp: ts, User: user, Text: text}}}
+	}
+	parent := msg("1704099600.000100", "alice", "question")
+	parent.Reactions = []slack.ItemReaction{{Name: "thumbsup", Count: 2}}
+	parent.Files = []slack.File{{Name: "log.txt", Permalink: "https://acme.slack.com/files/U1/F1/log.txt"}}
+	for i := range 20 {
+		parent.ThreadReplies = append(parent.ThreadReplies, msg(fmt.Sprintf("1704099660.%06d", i), "bob", strings.Repeat("answer ", 10)))
+	}
+	conv := types.Conversation{ID: "C1", Name: "general", Messages: []types.Message{parent}}
+	opts := GitHubOptions{Source: "https://acme.slack.com/archives/C1", Limit: 1000}
+
+	parts := GitHubMarkdown(conv, opts)
+	if len(parts) < 2 {
+		t.Fatalf("%d parts, want several under 1000 bytes", len(parts))
+	}
+	for i, p := range parts {
+		if len(p) > opts.Limit {
+			t.Errorf("part %d has %d bytes, over the limit", i+1, len(p))
+		}
+		if !strings.Contains(p, "Moved from [#general on Slack](https://acme.slack.com/archives/C1)") {
+			t.Errorf("part %d doesn't link the source:\n%s", i+1, p)
+		}
+	}
+	for _, want := range []string{"# #general · part 1 of", "- 📎 [log.txt](https://acme.slack.com/files/U1/F1/log.txt)", ":+1: 2", "**Replies: 20**", "> **bob** · 2024-01-01 09:01 UTC"} {
+		if !strings.Contains(parts[0], want) {
+			t.Errorf("first part is missing %q:\n%s", want, parts[0])
+		}
+	}
+	if !strings.Contains(parts[1], "*Continuing the thread of **alice** · 2024-01-01 09:00 UTC:*") {
+		t.Errorf("second part doesn't continue the thread:\n%s", parts[1])
+	}
+	if n := strings.Count(strings.Join(parts, ""), "> **bob**"); n != 20 {
+		t.Errorf("%d replies across the parts, want 20", n)
+	}
+
+	// A message longer than a part is cut between lines.
+	long := msg("1704099600.000100", "alice", strings.Repeat("line of text\n", 200))
+	parts = GitHubMarkdown(types.Conversation{ID: "C1", Messages: []types.Message{long}}, GitHubOptions{Limit: 1000})
+	for i, p := range parts {
+		if len(p) > 1000 {
+			t.Errorf("part %d of a long message has %d bytes", i+1, len(p))
+		}
+	}
+	if got := strings.Count(strings.Join(parts, ""), "line of text"); got != 200 {
+		t.Errorf("%d lines across the parts, want 200", got)
+	}
+}
+
+func TestGitHubMarkdownPosture(t *testing.T) {
+	conv := types.Conversation{ID: "C1", Name: "announcements"}
+	tests := []struct {
+		posture []string
+		want    string
+	}{
+		{nil, "# #announcements\n"},
+		{[]string{"read-only"}, "# #announcements (read-only)\n"},
+		{[]string{"read-only", "thread-only", "locked"}, "# #announcements (read-only, thread-only, locked)\n"},
+	}
+	for _, tt := range tests {
+		parts := GitHubMarkdown(conv, GitHubOptions{Source: "https://acme.slack.com/archives/C1", Posture: tt.posture})
+		if !strings.HasPrefix(parts[0], tt.want) || !strings.Contains(parts[0], "[#announcements on Slack]") {
+			t.Errorf("Posture %v: header =\n%s\nwant it to start with %q and link #announcements", tt.posture, parts[0], tt.want)
+		}
+	}
+}
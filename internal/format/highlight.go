@@ -0,0 +1,53 @@
+package format
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// tokenRe splits code into comments, strings, numbers and words. Slack code
+// blocks carry no language, so the rules are the ones most languages share.
+var tokenRe = regexp.MustCompile(`(//[^\n]*|/\*(?s:.*?)\*/|#[^\n]*)` +
+	`|("(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*'|` + "`[^`]*`" + `)` +
+	`|(\b[0-9][0-9a-fA-FxX_.]*)` +
+	`|([A-Za-z_][A-Za-z0-9_]*)`)
+
+// keywords are highlighted in code blocks, across common languages.
+var keywords = map[string]bool{}
+
+func init() {
+	for _, k := range strings.Fields(`break case catch class const continue def default defer
+		do elif else end except export extends false finally fn for from func function go
+		if import in interface let map match nil None null package pass private protected
+		public raise return select self static struct switch then this throw true True
+		False try type var void while with yield async await lambda new echo fi done`) {
+		keywords[k] = true
+	}
+}
+
+// highlight returns code as HTML with comments, strings, numbers and
+// keywords wrapped in spans for the stylesheet to color.
+func highlight(code string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range tokenRe.FindAllStringSubmatchIndex(code, -1) {
+		b.WriteString(html.EscapeString(code[last:m[0]]))
+		tok := html.EscapeString(code[m[0]:m[1]])
+		switch {
+		case m[2] >= 0:
+			b.WriteString(`<span class="tok-c">` + tok + "</span>")
+		case m[4] >= 0:
+			b.WriteString(`<span class="tok-s">` + tok + "</span>")
+		case m[6] >= 0:
+			b.WriteString(`<span class="tok-n">` + tok + "</span>")
+		case keywords[code[m[0]:m[1]]]:
+			b.WriteString(`<span class="tok-k">` + tok + "</span>")
+		default:
+			b.WriteString(tok)
+		}
+		last = m[1]
+	}
+	b.WriteString(html.EscapeString(code[last:]))
+	return b.String()
+}
@@ -0,0 +1,277 @@
+// Package format renders dumped conversations in formats other than
+// slackdump's JSON.
+package format
+
+import (
+	"embed"
+	"html"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+//go:embed html.tmpl style.css
+var htmlFS embed.FS
+
+var htmlTemplate = template.Must(template.New("html.tmpl").Funcs(template.FuncMap{
+	"author":   author,
+	"initial":  initial,
+	"avatar":   func(types.Message) any { return "" },
+	"target":   func(types.Message) bool { return false },
+	"timeLink": func(types.Message) string { return "" },
+	"rawTS":    func(types.Message) string { return "" },
+	"clock":    clock,
+	"iso":      iso,
+	"body":     htmlText{}.body,
+	"emoji":    htmlText{}.emoji,
+	"replies":  replies,
+	"fileLink": fileLink,
+}).ParseFS(htmlFS, "html.tmpl"))
+
+var styleCSS = func() template.CSS {
+	b, err := htmlFS.ReadFile("style.css")
+	if err != nil {
+		panic(err)
+	}
+	return template.CSS(b)
+}()
+
+// HTMLPage is one page of an HTML export.
+type HTMLPage struct {
+	// Conversation holds the conversation with this page's messages only.
+	Conversation types.Conversation
+	// Number counts pages from 1 out of Total.
+	Number, Total int
+	// Prev and Next link the neighbouring pages, relative to this one; they
+	// are empty on the first and last page.
+	Prev, Next string
+	// Avatars maps users, by ID or handle, to avatar URLs. Users missing
+	// from it get their initial instead.
+	Avatars map[string]string
+	// Images maps avatar URLs, of users and bots, to the data: URIs of
+	// their images, shown in their place so the page needs no network for
+	// them. Avatars missing from it are linked.
+	Images map[string]string
+	// Target is the ts of the message the dumped link points at, marked as
+	// the linked message; empty for none.
+	Target string
+	// Topic is the channel's topic, shown under its name; empty for none.
+	Topic string
+	// Workspace, when set, is the URL of the workspace, and each message's
+	// time links to its Slack permalink instead of to the message on the
+	// page.
+	Workspace string
+	// CustomEmoji maps the names of custom emoji to the URLs of their
+	// images, relative to the page; those missing from it show as :name:.
+	CustomEmoji map[string]string
+	// RawTS shows each message's ts, which its anchor and permalink are
+	// made from, after its time.
+	RawTS bool
+}
+
+// Paginate splits msgs into pages of at most size top-level messages, each
+// with its thread. A size of zero or less keeps everything on one page.
+func Paginate(msgs []types.Message, size int) [][]types.Message {
+	if size <= 0 || len(msgs) <= size {
+		return [][]types.Message{msgs}
+	}
+	var pages [][]types.Message
+	for start := 0; start < len(msgs); start += size {
+		pages = append(pages, msgs[start:min(start+size, len(msgs))])
+	}
+	return pages
+}
+
+// WriteHTML writes p as a standalone HTML document laid out like the Slack
+// client. The stylesheet is inlined, so the page needs no network access
+// apart from avatars missing from p.Images, which are linked from Slack,
+// and custom emoji images.
+func WriteHTML(w io.Writer, p HTMLPage) error {
+	t, err := htmlTemplate.Clone()
+	if err != nil {
+		return err
+	}
+	h := htmlText{customEmoji: p.CustomEmoji}
+	t.Funcs(template.FuncMap{
+		"body":  h.body,
+		"emoji": h.emoji,
+		"avatar": func(m types.Message) any {
+			u := avatar(m, p.Avatars)
+			if img, ok := p.Images[u]; ok && strings.HasPrefix(img, "data:image/") {
+				return template.URL(img)
+			}
+			return u
+		},
+		"target": func(m types.Message) bool { return p.Target != "" && m.Timestamp == p.Target },
+		"timeLink": func(m types.Message) string {
+			if p.Workspace == "" {
+				return "#m" + m.Timestamp
+			}
+			return Permalink(p.Workspace, p.Conversation.ID, m.Timestamp, m.ThreadTimestamp)
+		},
+		"rawTS": func(m types.Message) string {
+			if !p.RawTS {
+				return ""
+			}
+			return m.Timestamp
+		},
+	})
+	return t.Execute(w, struct {
+		HTMLPage
+		Title string
+		CSS   template.CSS
+	}{p, title(&p.Conversation), styleCSS})
+}
+
+func title(c *types.Conversation) string {
+	name := c.Name
+	if name == "" {
+		name = c.ID
+	} else if !strings.HasPrefix(name, "@") {
+		name = "#" + name
+	}
+	if c.ThreadTS != "" {
+		return "Thread in " + name
+	}
+	return name
+}
+
+// author returns the name shown above a message: the workflow or app whose
+// fields it carries, the user, which is the handle when IDs were resolved,
+// or the bot.
+func author(m types.Message) string {
+	if name, ok := workflowName(m); ok {
+		return name
+	}
+	switch {
+	case m.User != "":
+		return m.User
+	case m.Username != "":
+		return m.Username
+	case m.BotProfile != nil && m.BotProfile.Name != "":
+		return m.BotProfile.Name
+	}
+	return m.BotID
+}
+
+// initial is the letter shown in place of a missing avatar.
+func initial(m types.Message) string {
+	for _, r := range author(m) {
+		return strings.ToUpper(string(r))
+	}
+	return "?"
+}
+
+// avatar returns the URL of the author's avatar, if known: from avatars for
+// users, and from the message itself for bots.
+func avatar(m types.Message, avatars map[string]string) string {
+	switch {
+	case avatars[m.User] != "":
+		return avatars[m.User]
+	case m.BotProfile != nil && m.BotProfile.Icons != nil && m.BotProfile.Icons.Image72 != "":
+		return m.BotProfile.Icons.Image72
+	case m.Icons != nil:
+		return m.Icons.IconURL
+	}
+	return ""
+}
+
+// AvatarURLs returns the avatar URLs the authors of msgs and their replies
+// are shown with, each once, as WriteHTML looks them up in avatars.
+func AvatarURLs(msgs []types.Message, avatars map[string]string) []string {
+	seen := make(map[string]bool)
+	var urls []string
+	var walk func([]types.Message)
+	walk = func(msgs []types.Message) {
+		for _, m := range msgs {
+			if u := avatar(m, avatars); u != "" && !seen[u] {
+				seen[u] = true
+				urls = append(urls, u)
+			}
+			walk(m.ThreadReplies)
+		}
+	}
+	walk(msgs)
+	return urls
+}
+
+// msgTime parses a Slack timestamp; the zero time means it didn't parse.
+func msgTime(ts string) time.Time {
+	sec, frac, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	us, _ := strconv.ParseInt((frac + "000000")[:6], 10, 64)
+	return time.Unix(s, us*1000).UTC()
+}
+
+func clock(ts string) string {
+	t := msgTime(ts)
+	if t.IsZero() {
+		return ts
+	}
+	return t.Format("2006-01-02 15:04 UTC")
+}
+
+func iso(ts string) string {
+	t := msgTime(ts)
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func replies(n int) string {
+	if n == 1 {
+		return "1 reply"
+	}
+	return strconv.Itoa(n) + " replies"
+}
+
+// fileLink returns the link for a file chip: its permalink, when that is a
+// web URL.
+func fileLink(f slack.File) string {
+	if safeURL(f.Permalink) {
+		return f.Permalink
+	}
+	return ""
+}
+
+// body renders a message's text: its rich_text blocks when it has any, as
+// the Slack client does, and its mrkdwn text otherwise, then its workflow
+// fields as a definition list and the messages it shares as quotes linking
+// to them.
+func (h htmlText) body(m types.Message) template.HTML {
+	var b strings.Builder
+	for _, blk := range m.Blocks.BlockSet {
+		if rt, ok := blk.(*slack.RichTextBlock); ok {
+			h.writeRichText(&b, rt.Elements)
+		}
+	}
+	if b.Len() == 0 {
+		h.writeMrkdwn(&b, m.Text)
+	}
+	if fields := WorkflowFields(m); len(fields) > 0 {
+		b.WriteString(`<dl class="workflow">`)
+		for _, f := range fields {
+			b.WriteString("<dt>" + html.EscapeString(f.Name) + "</dt><dd>")
+			h.writeMrkdwn(&b, f.Value)
+			b.WriteString("</dd>")
+		}
+		b.WriteString("</dl>")
+	}
+	for _, a := range shares(m) {
+		b.WriteString(`<blockquote class="share"><div class="meta"><span class="author">` + html.EscapeString(shareAuthor(a)) + "</span> ")
+		b.WriteString(link(a.FromURL, `<time class="time" datetime="`+iso(a.Ts.String())+`">`+clock(a.Ts.String())+"</time>"))
+		b.WriteString("</div>")
+		h.writeMrkdwn(&b, a.Text)
+		b.WriteString("</blockquote>")
+	}
+	return template.HTML(b.String())
+}
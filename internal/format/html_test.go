@@ -0,0 +1,259 @@
+package format
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func render(t *testing.T, p HTMLPage) string {
+	t.Helper()
+	var b strings.Builder
+	if err := WriteHTML(&b, p); err != nil {
+		t.Fatalf("WriteHTML() error: %v", err)
+	}
+	return b.String()
+}
+
+func TestWriteHTMLGolden(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "conversation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conv types.Conversation
+	if err := json.Unmarshal(data, &conv); err != nil {
+		t.Fatal(err)
+	}
+	out := render(t, HTMLPage{Conversation: conv, Number: 1, Total: 1, Avatars: map[string]string{"U09036M8VEU": "https://avatars.example/u.png"}})
+	for _, want := range []string{
+		"<title>#general</title>",
+		"<style>:root",
+		`<img class="avatar" src="https://avatars.example/u.png"`,
+		`<div class="avatar">U</div>`,
+		`<time datetime="2026-02-22T07:56:43Z">2026-02-22 07:56 UTC</time>`,
+		`<span class="edited">(edited)</span>`,
+		`Deploy <span class="mention">@U0903ABCDEF</span>`,
+		"<details class=\"thread\">\n<summary>1 reply</summary>",
+		"Done ✅",
+		`<span class="emoji" title=":eyes:">👀</span> 2`,
+		"📎 Report",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q", want)
+		}
+	}
+	if strings.Contains(out, "<nav>") {
+		t.Error("a single page has page navigation")
+	}
+	for _, external := range []string{"<script", "<link", "@import"} {
+		if strings.Contains(out, external) {
+			t.Errorf("output contains %q; the page must be self-contained", external)
+		}
+	}
+}
+
+func TestWriteHTMLRichText(t *testing.T) {
+	blocks := slack.Blocks{BlockSet: []slack.Block{slack.NewRichTextBlock("b",
+		slack.NewRichTextSection(
+			&slack.RichTextSectionTextElement{Type: slack.RTSEText, Text: "see ", Style: &slack.RichTextSectionTextStyle{Bold: true}},
+			&slack.RichTextSectionLinkElement{Type: slack.RTSELink, URL: "https://example.com/?a=1&b=2", Text: "docs"},
+			&slack.RichTextSectionLinkElement{Type: slack.RTSELink, URL: "javascript:alert(1)", Text: "bad"},
+			&slack.RichTextSectionEmojiElement{Type: slack.RTSEEmoji, Name: "wave::skin-tone-3"},
+			&slack.RichTextSectionEmojiElement{Type: slack.RTSEEmoji, Name: "partyparrot"},
+		),
+		&slack.RichTextPreformatted{RichTextSection: slack.RichTextSection{Type: slack.RTEPreformatted, Elements: []slack.RichTextSectionElement{
+			&slack.RichTextSectionTextElement{Type: slack.RTSEText, Text: "if x < 10 {\n\treturn \"<b>\" // done\n}"},
+		}}},
+		&slack.RichTextList{Type: slack.RTEList, Style: slack.RTEListBullet, Elements: []slack.RichTextElement{
+			slack.NewRichTextSection(&slack.RichTextSectionTextElement{Type: slack.RTSEText, Text: "one"}),
+		}},
+	)}}
+	conv := types.Conversation{ID: "C1", Messages: []types.Message{{Message: slack.Message{Msg: slack.Msg{User: "alice", Timestamp: "1700000000.000100", Blocks: blocks, Text: "ignored"}}}}}
+	out := render(t, HTMLPage{Conversation: conv, Number: 1, Total: 1})
+	for _, want := range []string{
+		"<strong>see </strong>",
+		`<a href="https://example.com/?a=1&amp;b=2" rel="noopener noreferrer">docs</a>`,
+		"bad<span",
+		"👋\U0001F3FC",
+		`<span class="emoji-custom">:partyparrot:</span>`,
+		`<pre class="code"><code><span class="tok-k">if</span> x &lt; <span class="tok-n">10</span> {` + "\n\t" +
+			`<span class="tok-k">return</span> <span class="tok-s">&#34;&lt;b&gt;&#34;</span> <span class="tok-c">// done</span>` + "\n}</code></pre>",
+		"<ul><li>one</li></ul>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q", want)
+		}
+	}
+	if strings.Contains(out, "ignored") || strings.Contains(out, "javascript:") {
+		t.Errorf("output renders the fallback text or a javascript: link:\n%s", out)
+	}
+}
+
+func TestWriteHTMLMrkdwn(t *testing.T) {
+	text := "*bold* _it_ ~gone~ `a<b` :tada: <https://example.com|site> <@U1> <!here> <script>alert(1)</script> &lt;tag&gt;\n```x = 'y' # note```"
+	conv := types.Conversation{ID: "C1", Messages: []types.Message{{Message: slack.Message{Msg: slack.Msg{User: "alice", Timestamp: "1700000000.000100", Text: text}}}}}
+	out := render(t, HTMLPage{Conversation: conv, Number: 1, Total: 1})
+	for _, want := range []string{
+		"<strong>bold</strong> <em>it</em> <s>gone</s> <code>a&lt;b</code>",
+		`title=":tada:">🎉</span>`,
+		`<a href="https://example.com" rel="noopener noreferrer">site</a>`,
+		`<span class="mention">@U1</span> <span class="mention">@here</span>`,
+		"&lt;tag&gt;",
+		`x = <span class="tok-s">&#39;y&#39;</span> <span class="tok-c"># note</span>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q", want)
+		}
+	}
+	if strings.Contains(out, "<script>") {
+		t.Error("message text was not escaped")
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	msgs := make([]types.Message, 7)
+	pages := Paginate(msgs, 3)
+	if len(pages) != 3 || len(pages[0]) != 3 || len(pages[2]) != 1 {
+		t.Errorf("Paginate(7, 3) page sizes = %d pages, want 3, 3, 1", len(pages))
+	}
+	if pages := Paginate(msgs, 0); len(pages) != 1 || len(pages[0]) != 7 {
+		t.Errorf("Paginate(7, 0) = %d pages, want one", len(pages))
+	}
+	if pages := Paginate(nil, 3); len(pages) != 1 {
+		t.Errorf("Paginate(nil, 3) = %d pages, want one empty page", len(pages))
+	}
+
+	out := render(t, HTMLPage{Conversation: types.Conversation{ID: "C1", Name: "general"}, Number: 2, Total: 3, Prev: "general.html", Next: "general.0003.html"})
+	for _, want := range []string{
+		"<title>#general (2/3)</title>",
+		`<a href="general.html">&larr; Previous</a> <span>Page 2 of 3</span> <a href="general.0003.html">Next &rarr;</a>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q", want)
+		}
+	}
+}
+
+func TestWriteHTMLTarget(t *testing.T) {
+	msgs := []types.Message{
+		{Message: slack.Message{Msg: slack.Msg{User: "U1", Text: "question", Timestamp: "1700000000.000100"}}},
+		{Message: slack.Message{Msg: slack.Msg{User: "U2", Text: "answer", Timestamp: "1700000001.000100"}}},
+	}
+	out := render(t, HTMLPage{Conversation: types.Conversation{ID: "C1", Messages: msgs}, Number: 1, Total: 1, Target: "1700000001.000100"})
+	if !strings.Contains(out, `<article class="message link-target" id="m1700000001.000100">`) {
+		t.Error("the linked message is not marked")
+	}
+	if strings.Count(out, "link-target\"") != 1 || strings.Count(out, "⟶ linked message") != 1 {
+		t.Error("want exactly one message marked as linked")
+	}
+}
+
+func TestWriteHTMLPermalinks(t *testing.T) {
+	msgs := []types.Message{
+		{Message: slack.Message{Msg: slack.Msg{User: "U1", Text: "question", Timestamp: "1700000000.000100", ThreadTimestamp: "1700000000.000100"}}},
+		{Message: slack.Message{Msg: slack.Msg{User: "U2", Text: "answer", Timestamp: "1700000001.000100", ThreadTimestamp: "1700000000.000100"}}},
+	}
+	page := HTMLPage{Conversation: types.Conversation{ID: "C1", ThreadTS: "1700000000.000100", Messages: msgs}, Number: 1, Total: 1}
+	if out := render(t, page); !strings.Contains(out, `<a class="time" href="#m1700000001.000100">`) {
+		t.Error("without Workspace, times don't link to their message on the page")
+	}
+	page.Workspace = "https://acme.slack.com"
+	out := render(t, page)
+	for _, want := range []string{
+		`<a class="time" href="https://acme.slack.com/archives/C1/p1700000000000100">`,
+		`<a class="time" href="https://acme.slack.com/archives/C1/p1700000001000100?thread_ts=1700000000.000100&amp;cid=C1">`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("page lacks %s", want)
+		}
+	}
+}
+
+func TestWriteHTMLCustomEmoji(t *testing.T) {
+	msg := types.Message{Message: slack.Message{Msg: slack.Msg{User: "U1", Text: "shipped :party-wizard: :tada: :unknown-one:", Timestamp: "1700000000.000100"}}}
+	msg.Reactions = []slack.ItemReaction{{Name: "party-wizard", Count: 2}}
+	page := HTMLPage{Conversation: types.Conversation{ID: "C1", Messages: []types.Message{msg}}, Number: 1, Total: 1, CustomEmoji: map[string]string{"party-wizard": "emoji/party-wizard.gif"}}
+	out := render(t, page)
+	if n := strings.Count(out, `<img class="emoji-custom" src="emoji/party-wizard.gif" alt=":party-wizard:" title=":party-wizard:">`); n != 2 {
+		t.Errorf("custom emoji shown as an image %d times, want in the text and the reaction", n)
+	}
+	if !strings.Contains(out, "🎉") || !strings.Contains(out, ":unknown-one:") {
+		t.Error("standard and unknown emoji aren't shown as before")
+	}
+}
+
+func TestWriteHTMLInlineAvatars(t *testing.T) {
+	alice := types.Message{Message: slack.Message{Msg: slack.Msg{User: "U1", Text: "hi", Timestamp: "1700000000.000100"}}}
+	bob := types.Message{Message: slack.Message{Msg: slack.Msg{User: "U2", Text: "hey", Timestamp: "1700000000.000200"}}}
+	alice.ThreadReplies = []types.Message{bob}
+	avatars := map[string]string{"U1": "https://avatars.example/a.png", "U2": "https://avatars.example/b.png"}
+	if got := AvatarURLs([]types.Message{alice}, avatars); len(got) != 2 || got[0] != avatars["U1"] || got[1] != avatars["U2"] {
+		t.Errorf("AvatarURLs() = %v, want alice's and bob's", got)
+	}
+
+	page := HTMLPage{Conversation: types.Conversation{ID: "C1", Messages: []types.Message{alice}}, Number: 1, Total: 1, Avatars: avatars,
+		Images: map[string]string{avatars["U1"]: "data:image/png;base64,iVBORw0K"}}
+	out := render(t, page)
+	if !strings.Contains(out, `src="data:image/png;base64,iVBORw0K"`) {
+		t.Error("alice's avatar isn't inlined")
+	}
+	if !strings.Contains(out, `src="https://avatars.example/b.png"`) {
+		t.Error("bob's avatar, missing from Images, isn't linked")
+	}
+}
+
+// TestShowRawTSGolden renders a conversation in each format --show-raw-ts
+// applies to, with it and without, and compares the results with the files
+// in testdata/rawts: .md for gh-markdown, .txt for text and .html for the
+// HTML page's messages, .raw before the extension with the flag.
+func TestShowRawTSGolden(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "conversation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conv types.Conversation
+	if err := json.Unmarshal(data, &conv); err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range []bool{false, true} {
+		var text strings.Builder
+		if err := WriteText(&text, conv, TextOptions{RawTS: raw}); err != nil {
+			t.Fatal(err)
+		}
+		page := render(t, HTMLPage{Conversation: conv, Number: 1, Total: 1, Workspace: "https://example.slack.com", RawTS: raw})
+		messages := page[strings.Index(page, "<article"):strings.LastIndex(page, "</article>")+len("</article>")] + "\n"
+		rendered := map[string]string{
+			".md":   GitHubMarkdown(conv, GitHubOptions{Workspace: "https://example.slack.com", RawTS: raw})[0],
+			".txt":  text.String(),
+			".html": messages,
+		}
+		for ext, got := range rendered {
+			golden := filepath.Join("testdata", "rawts", "conversation"+ext)
+			if raw {
+				golden = filepath.Join("testdata", "rawts", "conversation.raw"+ext)
+			}
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("%s drifted from %s (run go test -update to accept):\ngot:\n%s\nwant:\n%s", ext, golden, got, want)
+			}
+			for _, m := range conv.Messages {
+				if has := strings.Contains(got, m.Timestamp+"`") || strings.Contains(got, "· "+m.Timestamp); has != raw {
+					t.Errorf("%s shows the ts of %s: %v, want %v", golden, m.Timestamp, has, raw)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package format
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// MattermostChannel is the channel a Mattermost bulk import creates.
+type MattermostChannel struct {
+	// Team is the name of the Mattermost team the channel goes into.
+	Team        string
+	Name        string
+	DisplayName string
+	Private     bool
+	Header      string
+	Purpose     string
+}
+
+// importedSubtypes are the message subtypes imported as posts; the
+// others (joins, topic changes, pins, ...) have no Mattermost or Zulip
+// post.
+var importedSubtypes = map[string]bool{
+	"":                 true,
+	"me_message":       true,
+	"thread_broadcast": true,
+	"file_share":       true,
+	"bot_message":      true,
+}
+
+type mmLine struct {
+	Type    string     `json:"type"`
+	Version int        `json:"version,omitempty"`
+	Channel *mmChannel `json:"channel,omitempty"`
+	Post    *mmPost    `json:"post,omitempty"`
+}
+
+type mmChannel struct {
+	Team        string `json:"team"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Type        string `json:"type"`
+	Header      string `json:"header,omitempty"`
+	Purpose     string `json:"purpose,omitempty"`
+}
+
+type mmPost struct {
+	Team      string       `json:"team,omitempty"`
+	Channel   string       `json:"channel,omitempty"`
+	User      string       `json:"user"`
+	Message   string       `json:"message"`
+	CreateAt  int64        `json:"create_at"`
+	Reactions []mmReaction `json:"reactions,omitempty"`
+	Replies   []mmPost     `json:"replies,omitempty"`
+}
+
+type mmReaction struct {
+	User      string `json:"user"`
+	EmojiName string `json:"emoji_name"`
+	CreateAt  int64  `json:"create_at"`
+}
+
+// WriteMattermost writes conv as a Mattermost bulk import file (JSONL): the
+// version line, the channel line, and a post line per top-level message
+// with its thread replies nested. Message authors and reacting users must
+// already be usernames. Messages Mattermost can't import, of other
+// subtypes or without an author, are left out; WriteMattermost returns
+// how many of each subtype were.
+func WriteMattermost(w io.Writer, conv types.Conversation, ch MattermostChannel) (map[string]int, error) {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	typ := "O"
+	if ch.Private {
+		typ = "P"
+	}
+	if err := enc.Encode(mmLine{Type: "version", Version: 1}); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(mmLine{Type: "channel", Channel: &mmChannel{
+		Team: ch.Team, Name: ch.Name, DisplayName: ch.DisplayName, Type: typ, Header: ch.Header, Purpose: ch.Purpose,
+	}}); err != nil {
+		return nil, err
+	}
+
+	msgs := conv.Messages
+	if conv.ThreadTS != "" {
+		msgs = nestThread(msgs, conv.ThreadTS)
+	}
+	parents := make(map[string]bool, len(msgs))
+	for _, m := range msgs {
+		parents[m.Timestamp] = true
+	}
+	skipped := make(map[string]int)
+	importable := func(m *types.Message) bool {
+		if !importedSubtypes[m.SubType] || m.User == "" {
+			skipped[m.SubType]++
+			return false
+		}
+		return true
+	}
+	for i := range msgs {
+		m := &msgs[i]
+		// A reply also sent to the channel is imported once, in its thread.
+		if m.SubType == "thread_broadcast" && parents[m.ThreadTimestamp] && m.ThreadTimestamp != m.Timestamp {
+			continue
+		}
+		if !importable(m) {
+			continue
+		}
+		post := mattermostPost(m)
+		post.Team, post.Channel = ch.Team, ch.Name
+		for j := range m.ThreadReplies {
+			if r := &m.ThreadReplies[j]; importable(r) {
+				post.Replies = append(post.Replies, mattermostPost(r))
+			}
+		}
+		if err := enc.Encode(mmLine{Type: "post", Post: &post}); err != nil {
+			return nil, err
+		}
+	}
+	return skipped, nil
+}
+
+// nestThread turns a thread link's dump, the parent and its replies side
+// by side, into the parent with the replies nested.
+func nestThread(msgs []types.Message, threadTS string) []types.Message {
+	for i, m := range msgs {
+		if m.Timestamp == threadTS {
+			parent := m
+			parent.ThreadReplies = append(append([]types.Message{}, msgs[:i]...), msgs[i+1:]...)
+			return []types.Message{parent}
+		}
+	}
+	return msgs
+}
+
+func mattermostPost(m *types.Message) mmPost {
+	at := createAt(m.Timestamp)
+	p := mmPost{User: m.User, Message: Markdown(m.Text), CreateAt: at}
+	for _, r := range m.Reactions {
+		name, _, _ := strings.Cut(r.Name, "::")
+		for _, u := range r.Users {
+			p.Reactions = append(p.Reactions, mmReaction{User: u, EmojiName: name, CreateAt: at})
+		}
+	}
+	return p
+}
+
+// createAt returns a Slack ts in Unix milliseconds.
+func createAt(ts string) int64 {
+	t := msgTime(ts)
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
@@ -0,0 +1,89 @@
+package format
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func mmMsg(ts, user, threadTS, subtype, text string, replies ...types.Message) types.Message {
+	return types.Message{Message: slack.Message{Msg: slack.Msg{
+		Timestamp: ts, User: user, ThreadTimestamp: threadTS, SubType: subtype, Text: text,
+	}}, ThreadReplies: replies}
+}
+
+func TestWriteMattermost(t *testing.T) {
+	broadcast := mmMsg("1700000060.000200", "bob", "1700000000.000100", "thread_broadcast", "also here")
+	parent := mmMsg("1700000000.000100", "alice", "1700000000.000100", "", "*ship* it <#C1|general>",
+		mmMsg("1700000030.000100", "bob", "1700000000.000100", "", "ok"),
+		broadcast,
+		mmMsg("1700000040.000100", "", "1700000000.000100", "bot_message", "beep"),
+	)
+	parent.Reactions = []slack.ItemReaction{{Name: "+1::skin-tone-2", Users: []string{"bob", "carol"}, Count: 2}}
+	conv := types.Conversation{ID: "C1", Name: "general", Messages: []types.Message{
+		parent,
+		broadcast,
+		mmMsg("1700000100.000100", "carol", "", "channel_join", "<@carol> has joined the channel"),
+		mmMsg("1700000200.000100", "carol", "", "", "bye"),
+	}}
+
+	var b strings.Builder
+	skipped, err := WriteMattermost(&b, conv, MattermostChannel{Team: "eng", Name: "general", DisplayName: "general", Private: true, Header: "topic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	want := []string{
+		`{"type":"version","version":1}`,
+		`{"type":"channel","channel":{"team":"eng","name":"general","display_name":"general","type":"P","header":"topic"}}`,
+		`{"type":"post","post":{"team":"eng","channel":"general","user":"alice","message":"**ship** it ~general","create_at":1700000000000,` +
+			`"reactions":[{"user":"bob","emoji_name":"+1","create_at":1700000000000},{"user":"carol","emoji_name":"+1","create_at":1700000000000}],` +
+			`"replies":[{"user":"bob","message":"ok","create_at":1700000030000},{"user":"bob","message":"also here","create_at":1700000060000}]}}`,
+		`{"type":"post","post":{"team":"eng","channel":"general","user":"carol","message":"bye","create_at":1700000200000}}`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), b.String())
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d =\n%s\nwant\n%s", i, lines[i], want[i])
+		}
+		if !json.Valid([]byte(lines[i])) {
+			t.Errorf("line %d is not JSON", i)
+		}
+	}
+	if len(skipped) != 2 || skipped["channel_join"] != 1 || skipped["bot_message"] != 1 {
+		t.Errorf("skipped = %v, want one channel_join and one authorless bot_message", skipped)
+	}
+}
+
+func TestWriteMattermostThreadLink(t *testing.T) {
+	conv := types.Conversation{ID: "C1", ThreadTS: "1700000000.000100", Messages: []types.Message{
+		mmMsg("1700000000.000100", "alice", "1700000000.000100", "", "q"),
+		mmMsg("1700000030.000100", "bob", "1700000000.000100", "", "a"),
+	}}
+	var b strings.Builder
+	if _, err := WriteMattermost(&b, conv, MattermostChannel{Team: "eng", Name: "general"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(b.String(), `"type":"post"`); n != 1 || !strings.Contains(b.String(), `"replies":[{"user":"bob","message":"a"`) {
+		t.Errorf("thread link not imported as one post with its reply:\n%s", b.String())
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"*bold* _it_ ~gone~ `*x*`", "**bold** _it_ ~~gone~~ `*x*`"},
+		{"see <https://example.com/a?b=1&amp;c=2> and <https://example.com|the docs>", "see https://example.com/a?b=1&c=2 and [the docs](https://example.com)"},
+		{"@bob <#C1|general> <!here> <!subteam^S1|@oncall>", "@bob ~general @here @oncall"},
+		{"```x *y* <https://example.com|docs>```", "```x *y* https://example.com```"},
+	}
+	for _, tt := range tests {
+		if got := Markdown(tt.in); got != tt.want {
+			t.Errorf("Markdown(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package format
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Permalink returns the link to the message with ts in channel on the
+// workspace at workspaceURL, as Slack's "Copy link" makes it:
+// <workspace>/archives/<channel>/p<ts digits>, and for a reply, with
+// threadTS, ?thread_ts=<threadTS>&cid=<channel>. It is made from the ts
+// alone, with no API call.
+func Permalink(workspaceURL, channel, ts, threadTS string) string {
+	link := strings.TrimSuffix(workspaceURL, "/") + "/archives/" + url.PathEscape(channel) + "/p" + strings.ReplaceAll(ts, ".", "")
+	if threadTS != "" && threadTS != ts {
+		link += "?thread_ts=" + url.QueryEscape(threadTS) + "&cid=" + url.QueryEscape(channel)
+	}
+	return link
+}
@@ -0,0 +1,176 @@
+package format
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/emoji"
+)
+
+// TextOptions tunes WriteText.
+type TextOptions struct {
+	// Color adds ANSI colors for a terminal: each author in a color of
+	// their own, times and thread markers dimmed.
+	Color bool
+	// CollapseThreads writes a thread's reply count in place of its replies.
+	CollapseThreads bool
+	// Target is the ts of the message the dumped link points at, marked as
+	// the linked message; empty for none.
+	Target string
+	// RawTS adds each message's ts after its time.
+	RawTS bool
+}
+
+// ANSI escapes of WriteText.
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiDim   = "\x1b[2m"
+)
+
+// authorColors are the colors authors get, by a hash of their name.
+var authorColors = []string{"\x1b[31m", "\x1b[32m", "\x1b[33m", "\x1b[34m", "\x1b[35m", "\x1b[36m"}
+
+// WriteText writes conv as plain text for reading in a terminal or pager:
+// a heading per UTC day, then each message as its time, author and text,
+// with its files and reactions (standard emoji as characters) below, and
+// its thread replies indented under it.
+func WriteText(w io.Writer, conv types.Conversation, opts TextOptions) error {
+	bw := bufio.NewWriter(w)
+	t := &textWriter{w: bw, opts: opts}
+	t.style(ansiBold, "#"+cmp.Or(conv.Name, conv.ID))
+	fmt.Fprintln(bw)
+	msgs := conv.Messages
+	if conv.ThreadTS != "" {
+		msgs = nestThread(msgs, conv.ThreadTS)
+	}
+	for _, m := range msgs {
+		if d := msgTime(m.Timestamp).Format(textDay); d != t.day {
+			t.day = d
+			fmt.Fprintln(bw)
+			t.style(ansiDim, "── "+d+" ──")
+			fmt.Fprintln(bw)
+		}
+		t.message(m, "")
+		if len(m.ThreadReplies) == 0 {
+			continue
+		}
+		if opts.CollapseThreads {
+			t.style(ansiDim, "      ▸ "+replies(len(m.ThreadReplies)))
+			fmt.Fprintln(bw)
+			continue
+		}
+		for _, r := range m.ThreadReplies {
+			t.message(r, "      │ ")
+		}
+	}
+	return bw.Flush()
+}
+
+// textDay is the layout of WriteText's day headings.
+const textDay = "Monday, 2 January 2006"
+
+type textWriter struct {
+	w    *bufio.Writer
+	opts TextOptions
+	// day is the day of the last heading.
+	day string
+}
+
+// message writes m, each line after prefix: "09:00 alice: text", the text's
+// further lines, workflow fields as "name: value", shared messages quoted
+// with their author, time and link, files and reactions indented to align
+// with its start. A
+// reply posted on another day than the heading's has its date too, and with
+// RawTS the time is followed by m's ts.
+func (t *textWriter) message(m types.Message, prefix string) {
+	name := author(m)
+	at := msgTime(m.Timestamp)
+	stamp := at.Format("15:04")
+	if at.Format(textDay) != t.day {
+		stamp = at.Format("2006-01-02 15:04")
+	}
+	if t.opts.RawTS {
+		stamp += " · " + m.Timestamp
+	}
+	indent := prefix + strings.Repeat(" ", utf8.RuneCountInString(stamp)+1)
+	t.style(ansiDim, prefix)
+	t.style(ansiDim, stamp)
+	t.w.WriteString(" ")
+	t.style(ansiBold+t.authorColor(name), name)
+	if t.opts.Target != "" && m.Timestamp == t.opts.Target {
+		t.style(ansiBold, " ⟶ linked message")
+	}
+	lines := strings.Split(PlainText(m.Text), "\n")
+	fields := WorkflowFields(m)
+	if len(fields) > 0 && strings.TrimSpace(m.Text) == "" {
+		lines = nil
+		fmt.Fprintln(t.w, ":")
+	} else {
+		fmt.Fprintf(t.w, ": %s\n", lines[0])
+		lines = lines[1:]
+	}
+	for _, l := range lines {
+		t.style(ansiDim, indent)
+		fmt.Fprintf(t.w, "%s\n", l)
+	}
+	for _, f := range fields {
+		value := strings.Split(PlainText(f.Value), "\n")
+		t.style(ansiDim, indent)
+		t.style(ansiBold, f.Name+":")
+		fmt.Fprintf(t.w, " %s\n", value[0])
+		for _, l := range value[1:] {
+			t.style(ansiDim, indent+strings.Repeat(" ", utf8.RuneCountInString(f.Name)+2))
+			fmt.Fprintf(t.w, "%s\n", l)
+		}
+	}
+	for _, a := range shares(m) {
+		t.style(ansiDim, indent+"┃ ")
+		t.style(ansiBold, shareAuthor(a))
+		t.style(ansiDim, " · "+clock(a.Ts.String()))
+		fmt.Fprintln(t.w)
+		for _, l := range strings.Split(PlainText(a.Text), "\n") {
+			t.style(ansiDim, indent+"┃ ")
+			fmt.Fprintf(t.w, "%s\n", l)
+		}
+		t.style(ansiDim, indent+"┃ "+a.FromURL)
+		fmt.Fprintln(t.w)
+	}
+	for _, f := range m.Files {
+		t.style(ansiDim, indent)
+		fmt.Fprintf(t.w, "📎 %s\n", cmp.Or(f.Name, f.Title, f.ID))
+	}
+	if len(m.Reactions) > 0 {
+		parts := make([]string, len(m.Reactions))
+		for i, r := range m.Reactions {
+			e, ok := emoji.Char(r.Name)
+			if !ok {
+				e = ":" + r.Name + ":"
+			}
+			parts[i] = fmt.Sprintf("%s %d", e, r.Count)
+		}
+		t.style(ansiDim, indent)
+		fmt.Fprintf(t.w, "%s\n", strings.Join(parts, "  "))
+	}
+}
+
+// style writes s, in the ANSI style when colored.
+func (t *textWriter) style(ansi, s string) {
+	if !t.opts.Color || s == "" {
+		t.w.WriteString(s)
+		return
+	}
+	t.w.WriteString(ansi + s + ansiReset)
+}
+
+func (t *textWriter) authorColor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return authorColors[h.Sum32()%uint32(len(authorColors))]
+}
@@ -0,0 +1,63 @@
+package format
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestWriteText(t *testing.T) {
+	msg := func(ts, user, text string) types.Message {
+		return types.Message{Message: slack.Message{Msg: slack.Msg{Timestamp: ts, User: user, Text: text}}}
+	}
+	// Monday 2024-01-01 09:00 UTC.
+	parent := msg("1704099600.000100", "alice", "hello <@bob>")
+	parent.Reactions = []slack.ItemReaction{{Name: "+1", Count: 2}, {Name: "partyparrot", Count: 1}}
+	parent.ThreadReplies = []types.Message{msg("1704099660.000200", "bob", "hi"), msg("1704186000.000300", "carol", "a day later")}
+	conv := types.Conversation{ID: "C1", Name: "general", Messages: []types.Message{parent}}
+
+	tests := []struct {
+		name string
+		opts TextOptions
+		want string
+	}{
+		{"threads", TextOptions{Target: "1704099660.000200"}, `#general
+
+── Monday, 1 January 2024 ──
+09:00 alice: hello @bob
+      👍 2  :partyparrot: 1
+      │ 09:01 bob ⟶ linked message: hi
+      │ 2024-01-02 09:00 carol: a day later
+`},
+		{"collapsed", TextOptions{CollapseThreads: true}, `#general
+
+── Monday, 1 January 2024 ──
+09:00 alice: hello @bob
+      👍 2  :partyparrot: 1
+      ▸ 2 replies
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := WriteText(&b, conv, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("WriteText =\n%s\nwant\n%s", b.String(), tt.want)
+			}
+		})
+	}
+
+	// A thread dump lists the parent and replies flat; they are nested.
+	thread := types.Conversation{ID: "C1", ThreadTS: parent.Timestamp, Messages: []types.Message{msg(parent.Timestamp, "alice", "q"), msg("1704099660.000200", "bob", "a")}}
+	var b strings.Builder
+	if err := WriteText(&b, thread, TextOptions{Color: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), ansiDim+"      │ "+ansiReset) || !strings.Contains(b.String(), ansiBold+"#C1"+ansiReset) {
+		t.Errorf("colored thread dump isn't nested:\n%q", b.String())
+	}
+}
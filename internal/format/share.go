@@ -0,0 +1,56 @@
+package format
+
+import (
+	"cmp"
+	"regexp"
+	"strings"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// shareLinkRe matches the from_url of an attachment that shares, or
+// forwards, another Slack message: that message's archives link.
+var shareLinkRe = regexp.MustCompile(`^https?://[^/?#]+/archives/[A-Z0-9]+/p[0-9]{7,}`)
+
+// shares returns the attachments of m that share another Slack message.
+func shares(m types.Message) []slack.Attachment {
+	var out []slack.Attachment
+	for _, a := range m.Attachments {
+		if shareLinkRe.MatchString(a.FromURL) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// shareAuthor names the author of a shared message as author names a
+// message's: by their ID, which is their handle once IDs are resolved, or
+// the name Slack shows.
+func shareAuthor(a slack.Attachment) string {
+	return cmp.Or(a.AuthorID, a.AuthorSubname, a.AuthorName, "unknown")
+}
+
+// shareMarkdown renders a as a Markdown quote: its author and time, linked
+// to the shared message's permalink, over its text rendered with gfm.
+func shareMarkdown(a slack.Attachment, gfm GFMOptions) []string {
+	lines := []string{"> **" + shareAuthor(a) + "** · [" + clock(a.Ts.String()) + "](" + a.FromURL + ")", ">"}
+	for _, l := range strings.Split(gfm.mrkdwn(a.Text), "\n") {
+		lines = append(lines, strings.TrimRight("> "+l, " "))
+	}
+	return lines
+}
+
+// withShares returns lines, a message's rendered text, followed by a
+// quote of each message m shares; blank text is left out.
+func withShares(lines []string, m types.Message, gfm GFMOptions) []string {
+	for _, a := range shares(m) {
+		if strings.TrimSpace(strings.Join(lines, "")) == "" {
+			lines = nil
+		} else {
+			lines = append(lines, "")
+		}
+		lines = append(lines, shareMarkdown(a, gfm)...)
+	}
+	return lines
+}
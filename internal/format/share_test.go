@@ -0,0 +1,76 @@
+package format
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// sharingConversation has a message forwarding another, whose author was
+// resolved to alice, and an attachment unfurling a web page.
+func sharingConversation() types.Conversation {
+	return types.Conversation{ID: "C1", Name: "general", Messages: []types.Message{
+		{Message: slack.Message{Msg: slack.Msg{User: "bob", Timestamp: "1700000600.000100", Text: "see this", Attachments: []slack.Attachment{
+			{
+				AuthorID:      "alice",
+				AuthorSubname: "Alice",
+				Text:          "Deploy is *done*\nall green",
+				FromURL:       "https://ws.slack.com/archives/C2/p1700000000000200?thread_ts=1699999999.000100",
+				Ts:            "1700000000.000200",
+			},
+			{Title: "Example", TitleLink: "https://example.com", FromURL: "https://example.com", Text: "A web page"},
+		}}}},
+	}}
+}
+
+func TestGitHubMarkdownShares(t *testing.T) {
+	got := GitHubMarkdown(sharingConversation(), GitHubOptions{})[0]
+	want := `**bob** · 2023-11-14 22:23 UTC
+
+see this
+
+> **alice** · [2023-11-14 22:13 UTC](https://ws.slack.com/archives/C2/p1700000000000200?thread_ts=1699999999.000100)
+>
+> Deploy is **done**
+> all green
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("gh-markdown =\n%s\nwant it to end with\n%s", got, want)
+	}
+	if strings.Contains(got, "A web page") {
+		t.Errorf("gh-markdown quotes an attachment that shares no message:\n%s", got)
+	}
+}
+
+func TestWriteTextShares(t *testing.T) {
+	var b strings.Builder
+	if err := WriteText(&b, sharingConversation(), TextOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := `22:23 bob: see this
+      ┃ alice · 2023-11-14 22:13 UTC
+      ┃ Deploy is done
+      ┃ all green
+      ┃ https://ws.slack.com/archives/C2/p1700000000000200?thread_ts=1699999999.000100
+`
+	if !strings.HasSuffix(b.String(), want) {
+		t.Errorf("text =\n%s\nwant it to end with\n%s", b.String(), want)
+	}
+}
+
+func TestHTMLBodyShares(t *testing.T) {
+	got := string(htmlText{}.body(sharingConversation().Messages[0]))
+	want := `see this<blockquote class="share"><div class="meta"><span class="author">alice</span> <a href="https://ws.slack.com/archives/C2/p1700000000000200?thread_ts=1699999999.000100" rel="noopener noreferrer"><time class="time" datetime="2023-11-14T22:13:20Z">2023-11-14 22:13 UTC</time></a></div>Deploy is <strong>done</strong>
+all green</blockquote>`
+	if got != want {
+		t.Errorf("body =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestShareAuthorUnresolved(t *testing.T) {
+	if got := shareAuthor(slack.Attachment{AuthorSubname: "Alice", AuthorName: "Alice Smith"}); got != "Alice" {
+		t.Errorf("shareAuthor() = %q, want the subname when there is no author ID", got)
+	}
+}
@@ -0,0 +1,184 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// TemplateMessage is what a --template is executed with, once per
+// top-level message.
+type TemplateMessage struct {
+	// Channel is the conversation's name, or its ID.
+	Channel string
+	TS      string
+	// Time is TS as a time in UTC; the zero time if it didn't parse.
+	Time     time.Time
+	ThreadTS string
+	// User is the author: the handle when IDs were resolved, or the bot.
+	User      string
+	Text      string
+	Replies   []TemplateMessage
+	Reactions []TemplateReaction
+	Files     []TemplateFile
+	// Message is the message as dumped, for anything else.
+	Message types.Message
+}
+
+// TemplateReaction is a reaction of a TemplateMessage.
+type TemplateReaction struct {
+	Name  string
+	Count int
+	Users []string
+}
+
+// TemplateFile is a file of a TemplateMessage.
+type TemplateFile struct {
+	Name      string
+	Title     string
+	Mimetype  string
+	Size      int
+	Permalink string
+}
+
+// Template is a parsed --template.
+type Template struct {
+	t *template.Template
+}
+
+// templateFuncs are the helpers a template can use besides text/template's
+// own, named and taking their arguments as in sprig, so the value can be
+// piped in last.
+var templateFuncs = template.FuncMap{
+	"date": func(layout string, t time.Time) string { return t.Format(layout) },
+	"dateInZone": func(layout string, t time.Time, zone string) (string, error) {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return "", err
+		}
+		return t.In(loc).Format(layout), nil
+	},
+	"trunc":   trunc,
+	"abbrev":  abbrev,
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"trim":    strings.TrimSpace,
+	"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"indent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+	},
+	"join":     func(sep string, s []string) string { return strings.Join(s, sep) },
+	"default":  orDefault,
+	"plain":    PlainText,
+	"markdown": Markdown,
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// trunc returns s cut to n characters; a negative n keeps the last -n.
+func trunc(n int, s string) string {
+	r := []rune(s)
+	switch {
+	case n >= 0 && len(r) > n:
+		return string(r[:n])
+	case n < 0 && len(r) > -n:
+		return string(r[len(r)+n:])
+	}
+	return s
+}
+
+// abbrev returns s cut to n characters, the last of them an ellipsis.
+func abbrev(n int, s string) string {
+	r := []rune(s)
+	if n < 1 || len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// orDefault returns v, or def when v is empty: nil, a zero value, or an
+// empty slice or map.
+func orDefault(def, v any) any {
+	rv := reflect.ValueOf(v)
+	switch {
+	case !rv.IsValid(), rv.IsZero():
+		return def
+	case (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Map) && rv.Len() == 0:
+		return def
+	}
+	return v
+}
+
+// ParseTemplate parses text as a template named name. Each execution ends
+// with a newline, added when text doesn't end with one. It also executes
+// the template on a sample message, so references to fields that don't
+// exist fail here rather than on the first message.
+func ParseTemplate(name, text string) (*Template, error) {
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	sample := types.Message{Message: slack.Message{Msg: slack.Msg{
+		Timestamp:       "1700000000.000100",
+		ThreadTimestamp: "1700000000.000100",
+		User:            "U1",
+		Text:            "sample",
+		Reactions:       []slack.ItemReaction{{Name: "wave", Count: 1, Users: []string{"U1"}}},
+		Files:           []slack.File{{Name: "sample.txt"}},
+	}}}
+	sample.ThreadReplies = []types.Message{sample}
+	if err := t.Execute(io.Discard, templateMessage("C1", &sample)); err != nil {
+		return nil, err
+	}
+	return &Template{t: t}, nil
+}
+
+// Execute writes the template executed on each top-level message of conv,
+// in order.
+func (t *Template) Execute(w io.Writer, conv types.Conversation) error {
+	channel := conv.Name
+	if channel == "" {
+		channel = conv.ID
+	}
+	for i := range conv.Messages {
+		if err := t.t.Execute(w, templateMessage(channel, &conv.Messages[i])); err != nil {
+			return fmt.Errorf("message %s: %w", conv.Messages[i].Timestamp, err)
+		}
+	}
+	return nil
+}
+
+func templateMessage(channel string, m *types.Message) TemplateMessage {
+	tm := TemplateMessage{
+		Channel:  channel,
+		TS:       m.Timestamp,
+		Time:     msgTime(m.Timestamp),
+		ThreadTS: m.ThreadTimestamp,
+		User:     author(*m),
+		Text:     m.Text,
+		Message:  *m,
+	}
+	for i := range m.ThreadReplies {
+		tm.Replies = append(tm.Replies, templateMessage(channel, &m.ThreadReplies[i]))
+	}
+	for _, r := range m.Reactions {
+		tm.Reactions = append(tm.Reactions, TemplateReaction{Name: r.Name, Count: r.Count, Users: r.Users})
+	}
+	for _, f := range m.Files {
+		tm.Files = append(tm.Files, TemplateFile{Name: f.Name, Title: f.Title, Mimetype: f.Mimetype, Size: f.Size, Permalink: f.Permalink})
+	}
+	return tm
+}
@@ -0,0 +1,71 @@
+package format
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestTemplate(t *testing.T) {
+	parent := mmMsg("1700000000.000100", "alice", "1700000000.000100", "", "*ship* it, a long message",
+		mmMsg("1700000030.000100", "bob", "1700000000.000100", "", "ok"),
+	)
+	parent.Reactions = []slack.ItemReaction{{Name: "+1", Users: []string{"bob", "carol"}, Count: 2}}
+	parent.Files = []slack.File{{Name: "log.txt", Size: 12}}
+	conv := types.Conversation{ID: "C1", Name: "general", Messages: []types.Message{
+		parent,
+		mmMsg("1700000200.000100", "", "", "", "bye"),
+	}}
+
+	tmpl, err := ParseTemplate("test", `#{{.Channel}} {{date "2006-01-02 15:04" .Time}} {{default "nobody" .User}}: {{plain .Text | abbrev 10}}
+{{- range .Replies}} [{{.User}}: {{.Text}}]{{end}}
+{{- range .Reactions}} :{{.Name}}:x{{.Count}} by {{join "," .Users}}{{end}}
+{{- range .Files}} ({{.Name}}, {{.Size}} bytes){{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, conv); err != nil {
+		t.Fatal(err)
+	}
+	want := "#general 2023-11-14 22:13 alice: ship it, …" +
+		" [bob: ok] :+1:x2 by bob,carol (log.txt, 12 bytes)\n" +
+		"#general 2023-11-14 22:16 nobody: bye\n"
+	if b.String() != want {
+		t.Errorf("output =\n%q\nwant\n%q", b.String(), want)
+	}
+}
+
+func TestParseTemplateFailsEarly(t *testing.T) {
+	for _, text := range []string{
+		"{{.User",
+		"{{.Author}}",
+		"{{range .Replies}}{{.Body}}{{end}}",
+		"{{nosuchfunc .Text}}",
+		`{{dateInZone "15:04" .Time "Nowhere/Else"}}`,
+	} {
+		if _, err := ParseTemplate("test", text); err == nil {
+			t.Errorf("ParseTemplate(%q) succeeded, want an error", text)
+		}
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	tests := []struct{ got, want string }{
+		{trunc(3, "héllo"), "hél"},
+		{trunc(-2, "héllo"), "lo"},
+		{trunc(10, "héllo"), "héllo"},
+		{abbrev(4, "héllo"), "hél…"},
+		{abbrev(5, "héllo"), "héllo"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %q, want %q", tt.got, tt.want)
+		}
+	}
+	if orDefault("x", "") != "x" || orDefault("x", []string{}) != "x" || orDefault("x", 0) != "x" || orDefault("x", "y") != "y" {
+		t.Error("default doesn't treat empty values as empty")
+	}
+}
@@ -0,0 +1,322 @@
+package format
+
+import (
+	"cmp"
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/rusq/slack"
+	"github.com/wham/gh-slackdump/internal/emoji"
+)
+
+// htmlText renders message text as HTML.
+type htmlText struct {
+	// customEmoji maps the names of custom emoji to the URLs of their
+	// images; those missing from it show as :name:.
+	customEmoji map[string]string
+}
+
+// writeRichText renders the elements of a rich_text block.
+func (h htmlText) writeRichText(b *strings.Builder, elems []slack.RichTextElement) {
+	for _, e := range elems {
+		switch e := e.(type) {
+		case *slack.RichTextSection:
+			h.writeSection(b, e.Elements)
+		case *slack.RichTextQuote:
+			b.WriteString("<blockquote>")
+			h.writeSection(b, e.Elements)
+			b.WriteString("</blockquote>")
+		case *slack.RichTextPreformatted:
+			var code strings.Builder
+			for _, se := range e.Elements {
+				code.WriteString(plainText(se))
+			}
+			writeCode(b, code.String())
+		case *slack.RichTextList:
+			tag := "ul"
+			if e.Style == slack.RTEListOrdered {
+				tag = "ol"
+			}
+			b.WriteString("<" + tag + ">")
+			for _, item := range e.Elements {
+				b.WriteString("<li>")
+				h.writeRichText(b, []slack.RichTextElement{item})
+				b.WriteString("</li>")
+			}
+			b.WriteString("</" + tag + ">")
+		}
+	}
+}
+
+// writeSection renders the inline elements of a rich text section.
+func (h htmlText) writeSection(b *strings.Builder, elems []slack.RichTextSectionElement) {
+	for _, e := range elems {
+		switch e := e.(type) {
+		case *slack.RichTextSectionTextElement:
+			writeStyled(b, e.Style, html.EscapeString(e.Text))
+		case *slack.RichTextSectionLinkElement:
+			text := e.Text
+			if text == "" {
+				text = e.URL
+			}
+			writeStyled(b, e.Style, link(e.URL, html.EscapeString(text)))
+		case *slack.RichTextSectionEmojiElement:
+			b.WriteString(string(h.emoji(e.Name)))
+		case *slack.RichTextSectionUserElement:
+			writeStyled(b, e.Style, mention("@"+e.UserID))
+		case *slack.RichTextSectionUserGroupElement:
+			b.WriteString(mention("@" + e.UsergroupID))
+		case *slack.RichTextSectionChannelElement:
+			writeStyled(b, e.Style, mention("#"+e.ChannelID))
+		case *slack.RichTextSectionBroadcastElement:
+			b.WriteString(mention("@" + e.Range))
+		case *slack.RichTextSectionTeamElement, *slack.RichTextSectionDateElement, *slack.RichTextSectionColorElement:
+			b.WriteString(html.EscapeString(plainText(e)))
+		}
+	}
+}
+
+// plainText returns the text an inline element stands for, as used in code
+// blocks where no markup applies.
+func plainText(e slack.RichTextSectionElement) string {
+	switch e := e.(type) {
+	case *slack.RichTextSectionTextElement:
+		return e.Text
+	case *slack.RichTextSectionLinkElement:
+		if e.Text != "" {
+			return e.Text
+		}
+		return e.URL
+	case *slack.RichTextSectionEmojiElement:
+		return ":" + e.Name + ":"
+	case *slack.RichTextSectionUserElement:
+		return "@" + e.UserID
+	case *slack.RichTextSectionChannelElement:
+		return "#" + e.ChannelID
+	case *slack.RichTextSectionTeamElement:
+		return e.TeamID
+	case *slack.RichTextSectionDateElement:
+		if e.Fallback != nil {
+			return *e.Fallback
+		}
+		return e.Timestamp.Time().UTC().Format("2006-01-02 15:04 UTC")
+	case *slack.RichTextSectionColorElement:
+		return e.Value
+	}
+	return ""
+}
+
+func writeStyled(b *strings.Builder, s *slack.RichTextSectionTextStyle, inner string) {
+	if s == nil {
+		b.WriteString(inner)
+		return
+	}
+	var open, close string
+	for _, t := range []struct {
+		on  bool
+		tag string
+	}{{s.Bold, "strong"}, {s.Italic, "em"}, {s.Strike, "s"}, {s.Code, "code"}} {
+		if t.on {
+			open += "<" + t.tag + ">"
+			close = "</" + t.tag + ">" + close
+		}
+	}
+	b.WriteString(open + inner + close)
+}
+
+func mention(name string) string {
+	return `<span class="mention">` + html.EscapeString(name) + "</span>"
+}
+
+// link renders an anchor around inner, which is already escaped. Links
+// other than web and mail links are left as text.
+func link(href, inner string) string {
+	if !safeURL(href) {
+		return inner
+	}
+	return `<a href="` + html.EscapeString(href) + `" rel="noopener noreferrer">` + inner + "</a>"
+}
+
+func safeURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// writeCode renders a code block with syntax highlighting.
+func writeCode(b *strings.Builder, code string) {
+	b.WriteString(`<pre class="code"><code>`)
+	b.WriteString(highlight(strings.Trim(code, "\n")))
+	b.WriteString("</code></pre>")
+}
+
+var (
+	// slackEntityRe matches Slack's <...> markup: links, mentions and
+	// special commands.
+	slackEntityRe = regexp.MustCompile(`<([^<>\n]+)>`)
+	inlineCodeRe  = regexp.MustCompile("`([^`\n]+)`")
+	boldRe        = regexp.MustCompile(`(^|[\s(])\*([^*\n]+)\*`)
+	italicRe      = regexp.MustCompile(`(^|[\s(])_([^_\n]+)_`)
+	strikeRe      = regexp.MustCompile(`(^|[\s(])~([^~\n]+)~`)
+	emojiRe       = regexp.MustCompile(`:([a-z0-9_+'-]+(?:::skin-tone-[2-6])?):`)
+)
+
+// unescapeSlack undoes the escaping Slack applies to message text.
+var unescapeSlack = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace
+
+// writeMrkdwn renders a message's mrkdwn text: ``` code blocks, Slack's
+// <...> links and mentions, and inline formatting.
+func (h htmlText) writeMrkdwn(b *strings.Builder, text string) {
+	for i, part := range strings.Split(text, "```") {
+		if i%2 == 1 {
+			writeCode(b, unescapeSlack(part))
+			continue
+		}
+		last := 0
+		for _, loc := range slackEntityRe.FindAllStringSubmatchIndex(part, -1) {
+			b.WriteString(h.mrkdwnInline(part[last:loc[0]]))
+			b.WriteString(slackEntity(part[loc[2]:loc[3]]))
+			last = loc[1]
+		}
+		b.WriteString(h.mrkdwnInline(part[last:]))
+	}
+}
+
+// slackEntity renders the inside of a <...> entity.
+func slackEntity(s string) string {
+	text, href := entityText(s)
+	if href == "" {
+		return mention(unescapeSlack(text))
+	}
+	return link(unescapeSlack(href), html.EscapeString(unescapeSlack(text)))
+}
+
+// entityText returns the text a <...> entity shows and, for a link, its
+// target: @name or #name for mentions, the label or the URL for links.
+func entityText(s string) (text, href string) {
+	target, label, _ := strings.Cut(s, "|")
+	switch {
+	case strings.HasPrefix(target, "@"), strings.HasPrefix(target, "#"):
+		if label != "" {
+			return target[:1] + label, ""
+		}
+		return target, ""
+	case strings.HasPrefix(target, "!"):
+		name := strings.TrimPrefix(target, "!")
+		if label != "" {
+			name = strings.TrimPrefix(label, "@")
+		}
+		return "@" + strings.TrimPrefix(name, "subteam^"), ""
+	}
+	if label == "" {
+		label = target
+	}
+	return label, target
+}
+
+// mrkdwnInline renders plain mrkdwn text: `code`, *bold*, _italic_,
+// ~strike~ and :emoji:.
+func (h htmlText) mrkdwnInline(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range inlineCodeRe.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(h.formatInline(s[last:loc[0]]))
+		b.WriteString("<code>" + html.EscapeString(unescapeSlack(s[loc[2]:loc[3]])) + "</code>")
+		last = loc[1]
+	}
+	b.WriteString(h.formatInline(s[last:]))
+	return b.String()
+}
+
+func (h htmlText) formatInline(s string) string {
+	s = html.EscapeString(unescapeSlack(s))
+	s = boldRe.ReplaceAllString(s, "$1<strong>$2</strong>")
+	s = italicRe.ReplaceAllString(s, "$1<em>$2</em>")
+	s = strikeRe.ReplaceAllString(s, "$1<s>$2</s>")
+	return emojiRe.ReplaceAllStringFunc(s, func(m string) string {
+		return string(h.emoji(strings.Trim(m, ":")))
+	})
+}
+
+// emoji renders an emoji by name: the character for standard emoji, the
+// image of a custom emoji in customEmoji, and :name: otherwise.
+func (h htmlText) emoji(name string) template.HTML {
+	if c, ok := emoji.Char(name); ok {
+		return template.HTML(`<span class="emoji" title=":` + html.EscapeString(name) + `:">` + c + "</span>")
+	}
+	if src := h.customEmoji[name]; src != "" {
+		code := html.EscapeString(":" + name + ":")
+		return template.HTML(`<img class="emoji-custom" src="` + html.EscapeString(src) + `" alt="` + code + `" title="` + code + `">`)
+	}
+	return template.HTML(`<span class="emoji-custom">:` + html.EscapeString(name) + ":</span>")
+}
+
+// PlainText returns mrkdwn text as plain text: links as their label,
+// mentions as @name or #name, formatting markers outside code dropped and
+// Slack's escaping undone. Emoji stay as :name:.
+func PlainText(text string) string {
+	text = slackEntityRe.ReplaceAllStringFunc(text, func(m string) string {
+		t, _ := entityText(m[1 : len(m)-1])
+		return t
+	})
+	parts := strings.Split(text, "```")
+	for i := 0; i < len(parts); i += 2 {
+		p := inlineCodeRe.ReplaceAllString(parts[i], "$1")
+		p = boldRe.ReplaceAllString(p, "$1$2")
+		p = italicRe.ReplaceAllString(p, "$1$2")
+		parts[i] = strikeRe.ReplaceAllString(p, "$1$2")
+	}
+	return unescapeSlack(strings.Join(parts, ""))
+}
+
+// Markdown returns mrkdwn text as standard Markdown, as Mattermost reads
+// it: links as [label](url), channel mentions as ~name, and, outside code,
+// *bold* as **bold** and ~strike~ as ~~strike~~. Slack's escaping is
+// undone.
+func Markdown(text string) string {
+	parts := strings.Split(text, "```")
+	for i, p := range parts {
+		if i%2 == 1 {
+			// Code blocks show a link's URL, as Slack does.
+			parts[i] = slackEntityRe.ReplaceAllStringFunc(p, func(m string) string {
+				t, href := entityText(m[1 : len(m)-1])
+				return cmp.Or(href, t)
+			})
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, loc := range inlineCodeRe.FindAllStringIndex(p, -1) {
+			b.WriteString(markdownInline(p[last:loc[0]]))
+			b.WriteString(p[loc[0]:loc[1]])
+			last = loc[1]
+		}
+		b.WriteString(markdownInline(p[last:]))
+		parts[i] = b.String()
+	}
+	return unescapeSlack(strings.Join(parts, "```"))
+}
+
+func markdownInline(s string) string {
+	s = slackEntityRe.ReplaceAllStringFunc(s, func(m string) string {
+		t, href := entityText(m[1 : len(m)-1])
+		switch {
+		case href == "" && strings.HasPrefix(t, "#"):
+			return "~" + t[1:]
+		case href == "" || t == href:
+			return t
+		}
+		return "[" + t + "](" + href + ")"
+	})
+	s = boldRe.ReplaceAllString(s, "$1**$2**")
+	return strikeRe.ReplaceAllString(s, "$1~~$2~~")
+}
@@ -0,0 +1,154 @@
+package format
+
+import (
+	"encoding/json"
+	"html"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// WorkflowField is a field a workflow or app submitted with a message: its
+// name and its value, as mrkdwn.
+type WorkflowField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// workflowFieldRe matches the mrkdwn of a section Workflow Builder posts for
+// a form field: the field's name in bold on a line of its own, then its
+// value.
+var workflowFieldRe = regexp.MustCompile(`(?s)^\*([^*\n]+)\*\n(.+)$`)
+
+// WorkflowFields returns the fields of a message posted by a workflow or
+// app, whose content is in its blocks and metadata rather than its text:
+// the sections and section fields that are a bold name over a value, as
+// Workflow Builder posts form submissions, the input blocks with a value,
+// then the metadata's event payload, by key. Messages not posted by a bot
+// have none.
+func WorkflowFields(m types.Message) []WorkflowField {
+	if m.BotID == "" && m.BotProfile == nil && m.SubType != slack.MsgSubTypeBotMessage {
+		return nil
+	}
+	var fields []WorkflowField
+	section := func(t *slack.TextBlockObject) {
+		if t == nil || t.Type != slack.MarkdownType {
+			return
+		}
+		if sm := workflowFieldRe.FindStringSubmatch(strings.TrimSpace(t.Text)); sm != nil {
+			fields = append(fields, WorkflowField{Name: strings.TrimSpace(sm[1]), Value: strings.TrimSpace(sm[2])})
+		}
+	}
+	for _, bl := range m.Blocks.BlockSet {
+		switch bl := bl.(type) {
+		case *slack.SectionBlock:
+			section(bl.Text)
+			for _, f := range bl.Fields {
+				section(f)
+			}
+		case *slack.InputBlock:
+			if bl.Label == nil {
+				continue
+			}
+			if v := inputValue(bl.Element); v != "" {
+				fields = append(fields, WorkflowField{Name: bl.Label.Text, Value: v})
+			}
+		}
+	}
+	payload := m.Metadata.EventPayload
+	for _, k := range slices.Sorted(maps.Keys(payload)) {
+		v, ok := payload[k].(string)
+		if !ok {
+			data, err := json.Marshal(payload[k])
+			if err != nil {
+				continue
+			}
+			v = string(data)
+		}
+		fields = append(fields, WorkflowField{Name: k, Value: v})
+	}
+	return fields
+}
+
+// inputValue returns the value an input block's element holds.
+func inputValue(e slack.BlockElement) string {
+	switch e := e.(type) {
+	case *slack.PlainTextInputBlockElement:
+		return e.InitialValue
+	case *slack.DatePickerBlockElement:
+		return e.InitialDate
+	case *slack.SelectBlockElement:
+		switch {
+		case e.InitialOption != nil && e.InitialOption.Text != nil:
+			return e.InitialOption.Text.Text
+		case e.InitialUser != "":
+			return "<@" + e.InitialUser + ">"
+		case e.InitialChannel != "":
+			return "<#" + e.InitialChannel + ">"
+		case e.InitialConversation != "":
+			return "<#" + e.InitialConversation + ">"
+		}
+	}
+	return ""
+}
+
+// workflowName returns the name of the workflow or app that posted m, when
+// it carries fields: the bot's name, which for a workflow is the
+// workflow's.
+func workflowName(m types.Message) (string, bool) {
+	if m.BotProfile == nil || m.BotProfile.Name == "" || len(WorkflowFields(m)) == 0 {
+		return "", false
+	}
+	return m.BotProfile.Name, true
+}
+
+// workflowLines returns the lines of md, m's text as Markdown, followed by
+// the definition list of m's workflow fields, if any; an empty text is left
+// out.
+func workflowLines(m types.Message, md string, gfm GFMOptions) []string {
+	lines := strings.Split(md, "\n")
+	fields := WorkflowFields(m)
+	switch {
+	case len(fields) == 0:
+		return lines
+	case strings.TrimSpace(md) == "":
+		lines = nil
+	default:
+		lines = append(lines, "")
+	}
+	return append(lines, workflowMarkdown(fields, gfm)...)
+}
+
+// workflowMarkdown renders fields as an HTML definition list, which GitHub
+// shows as such; blank lines around each value let its Markdown, rendered
+// with gfm, be read inside the list.
+func workflowMarkdown(fields []WorkflowField, gfm GFMOptions) []string {
+	lines := []string{"<dl>"}
+	for _, f := range fields {
+		lines = append(lines, "<dt>"+html.EscapeString(f.Name)+"</dt>", "<dd>", "")
+		lines = append(lines, strings.Split(gfm.mrkdwn(f.Value), "\n")...)
+		lines = append(lines, "", "</dd>")
+	}
+	return append(lines, "</dl>")
+}
+
+// workflowCSV returns fields as the JSON array of WriteCSV's
+// workflow_fields column, their values as plain text; empty for none.
+func workflowCSV(fields []WorkflowField) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	plain := make([]WorkflowField, len(fields))
+	for i, f := range fields {
+		plain[i] = WorkflowField{Name: f.Name, Value: PlainText(f.Value)}
+	}
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(plain)
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,84 @@
+package format
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// TestWorkflowCorpus renders each workflow message in testdata/workflow, as
+// Slack's API returns it, in each format that shows its fields, and
+// compares the results with the files of the same name: .md for
+// gh-markdown, .txt for text, .html for the HTML message body and .csv.
+func TestWorkflowCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "workflow", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no messages in testdata/workflow")
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var m types.Message
+			if err := json.Unmarshal(data, &m); err != nil {
+				t.Fatal(err)
+			}
+			conv := types.Conversation{ID: "C0HELPDESK", Name: "help-it", Messages: []types.Message{m}}
+
+			var text, csv strings.Builder
+			if err := WriteText(&text, conv, TextOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := WriteCSV(&csv, conv, "https://example.slack.com", ','); err != nil {
+				t.Fatal(err)
+			}
+			rendered := map[string]string{
+				".md":   GitHubMarkdown(conv, GitHubOptions{Workspace: "https://example.slack.com"})[0],
+				".txt":  text.String(),
+				".html": string(htmlText{}.body(m)) + "\n",
+				".csv":  csv.String(),
+			}
+			for _, ext := range slices.Sorted(maps.Keys(rendered)) {
+				golden := strings.TrimSuffix(file, ".json") + ext
+				got := rendered[ext]
+				if *update {
+					if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != string(want) {
+					t.Errorf("%s drifted from %s (run go test -update to accept):\ngot:\n%s\nwant:\n%s", ext, golden, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWorkflowFieldsOnlyFromBots(t *testing.T) {
+	var m types.Message
+	if err := json.Unmarshal([]byte(`{"user":"U1","ts":"1.0","text":"*Agenda*\nplanning","blocks":[{"type":"section","text":{"type":"mrkdwn","text":"*Agenda*\nplanning"}}]}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if f := WorkflowFields(m); f != nil {
+		t.Errorf("WorkflowFields() = %+v for a person's message, want none", f)
+	}
+	if got := author(m); got != "U1" {
+		t.Errorf("author() = %q, want the user", got)
+	}
+}
@@ -0,0 +1,380 @@
+package format
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/emoji"
+)
+
+// ZulipStream is the stream a Zulip import creates for the channel.
+type ZulipStream struct {
+	// Realm is the organization's name; Zulip takes its subdomain from
+	// the import command.
+	Realm       string
+	Name        string
+	Description string
+	Private     bool
+}
+
+// zulipMaxTopic is the longest topic name Zulip accepts, in characters.
+const zulipMaxTopic = 60
+
+// zulipDefaultTopic holds the messages that didn't start a thread, as
+// Zulip's own Slack importer names it.
+const zulipDefaultTopic = "imported from Slack"
+
+// zulipBatch is how many messages go in each messages-*.json file.
+const zulipBatch = 1000
+
+// Recipient types, the member role and the read flag, as Zulip's models
+// number them.
+const (
+	zulipRecipientPersonal = 1
+	zulipRecipientStream   = 2
+	zulipRoleMember        = 400
+	zulipFlagRead          = 1
+)
+
+// ZulipExport is a conversation as the files of a Zulip data export, read
+// by "manage.py import".
+type ZulipExport struct {
+	// Realm is realm.json: the organization, its users, the stream and its
+	// subscriptions, and the reactions.
+	Realm map[string]any
+	// Messages are the messages-NNNNNN.json files, in order.
+	Messages []ZulipMessages
+	// Skipped counts the messages left out, by subtype ("" for no author).
+	Skipped map[string]int
+	// SkippedReactions counts reactions with no standard emoji equivalent.
+	SkippedReactions int
+}
+
+// ZulipMessages is one messages-NNNNNN.json file.
+type ZulipMessages struct {
+	Message     []zulipMessage     `json:"zerver_message"`
+	UserMessage []zulipUserMessage `json:"zerver_usermessage"`
+}
+
+type zulipUser struct {
+	ID            int     `json:"id"`
+	Email         string  `json:"email"`
+	DeliveryEmail string  `json:"delivery_email"`
+	FullName      string  `json:"full_name"`
+	Realm         int     `json:"realm"`
+	IsActive      bool    `json:"is_active"`
+	IsBot         bool    `json:"is_bot"`
+	IsMirrorDummy bool    `json:"is_mirror_dummy"`
+	Role          int     `json:"role"`
+	DateJoined    float64 `json:"date_joined"`
+	AvatarSource  string  `json:"avatar_source"`
+	Timezone      string  `json:"timezone"`
+}
+
+type zulipRecipient struct {
+	ID     int `json:"id"`
+	TypeID int `json:"type_id"`
+	Type   int `json:"type"`
+}
+
+type zulipStreamRow struct {
+	ID                         int     `json:"id"`
+	Name                       string  `json:"name"`
+	Description                string  `json:"description"`
+	RenderedDescription        string  `json:"rendered_description"`
+	Realm                      int     `json:"realm"`
+	InviteOnly                 bool    `json:"invite_only"`
+	HistoryPublicToSubscribers bool    `json:"history_public_to_subscribers"`
+	IsWebPublic                bool    `json:"is_web_public"`
+	Deactivated                bool    `json:"deactivated"`
+	DateCreated                float64 `json:"date_created"`
+	Recipient                  int     `json:"recipient"`
+}
+
+type zulipSubscription struct {
+	ID           int    `json:"id"`
+	UserProfile  int    `json:"user_profile"`
+	Recipient    int    `json:"recipient"`
+	Active       bool   `json:"active"`
+	IsUserActive bool   `json:"is_user_active"`
+	IsMuted      bool   `json:"is_muted"`
+	PinToTop     bool   `json:"pin_to_top"`
+	Color        string `json:"color"`
+}
+
+type zulipReaction struct {
+	ID           int    `json:"id"`
+	UserProfile  int    `json:"user_profile"`
+	Message      int    `json:"message"`
+	EmojiName    string `json:"emoji_name"`
+	EmojiCode    string `json:"emoji_code"`
+	ReactionType string `json:"reaction_type"`
+}
+
+type zulipMessage struct {
+	ID              int      `json:"id"`
+	Sender          int      `json:"sender"`
+	Recipient       int      `json:"recipient"`
+	Realm           int      `json:"realm"`
+	Subject         string   `json:"subject"`
+	Content         string   `json:"content"`
+	RenderedContent *string  `json:"rendered_content"`
+	DateSent        float64  `json:"date_sent"`
+	SendingClient   int      `json:"sending_client"`
+	LastEditTime    *float64 `json:"last_edit_time"`
+	HasAttachment   bool     `json:"has_attachment"`
+	HasImage        bool     `json:"has_image"`
+	HasLink         bool     `json:"has_link"`
+}
+
+type zulipUserMessage struct {
+	ID          int `json:"id"`
+	UserProfile int `json:"user_profile"`
+	Message     int `json:"message"`
+	FlagsMask   int `json:"flags_mask"`
+}
+
+// zulip builds a ZulipExport, numbering rows as it goes.
+type zulip struct {
+	names     map[string]string
+	users     []zulipUser
+	userIDs   map[string]int
+	reactions []zulipReaction
+	messages  []zulipMessage
+	// created is the time of the earliest message, given to the realm, the
+	// stream and the users.
+	created float64
+	export  *ZulipExport
+}
+
+// Zulip converts conv into a Zulip data export of one stream: a thread
+// becomes a topic named after the first line of its parent, and the other
+// messages go in the topic "imported from Slack". names maps Slack user IDs
+// to the names their Zulip users get; a user missing from it is named by
+// the message's username, or its ID. Users get placeholder addresses
+// <id>@slack.invalid, as the user cache has no emails. Reactions are kept
+// where the emoji has a standard Unicode character.
+func Zulip(conv types.Conversation, stream ZulipStream, names map[string]string) ZulipExport {
+	z := &zulip{names: names, userIDs: make(map[string]int), export: &ZulipExport{Skipped: make(map[string]int)}}
+	msgs := conv.Messages
+	if conv.ThreadTS != "" {
+		msgs = nestThread(msgs, conv.ThreadTS)
+	}
+	parents := make(map[string]bool, len(msgs))
+	for _, m := range msgs {
+		parents[m.Timestamp] = true
+	}
+	for i := range msgs {
+		m := &msgs[i]
+		// A reply also sent to the channel is imported once, in its thread.
+		if m.SubType == "thread_broadcast" && parents[m.ThreadTimestamp] && m.ThreadTimestamp != m.Timestamp {
+			continue
+		}
+		topic := zulipDefaultTopic
+		if len(m.ThreadReplies) > 0 {
+			topic = zulipTopic(m.Text, m.Timestamp)
+		}
+		z.add(m, topic)
+		for j := range m.ThreadReplies {
+			z.add(&m.ThreadReplies[j], topic)
+		}
+	}
+	return z.finish(stream)
+}
+
+// zulipTopic names the topic of a thread after the first line of its
+// parent's text, as plain text, cut to zulipMaxTopic characters. A parent
+// without text names it by its time.
+func zulipTopic(text, ts string) string {
+	first, _, _ := strings.Cut(strings.TrimSpace(PlainText(text)), "\n")
+	first = strings.TrimSpace(first)
+	if first == "" {
+		return "thread " + clock(ts)
+	}
+	if r := []rune(first); len(r) > zulipMaxTopic {
+		first = strings.TrimSpace(string(r[:zulipMaxTopic-1])) + "…"
+	}
+	return first
+}
+
+func (z *zulip) add(m *types.Message, topic string) {
+	sender := cmp.Or(m.User, m.BotID)
+	if !importedSubtypes[m.SubType] || sender == "" {
+		z.export.Skipped[m.SubType]++
+		return
+	}
+	id := len(z.messages) + 1
+	sent := float64(msgTime(m.Timestamp).UnixMicro()) / 1e6
+	if z.created == 0 || sent < z.created {
+		z.created = sent
+	}
+	content := z.mentions(Markdown(m.Text))
+	z.messages = append(z.messages, zulipMessage{
+		ID:            id,
+		Sender:        z.user(sender, cmp.Or(m.Username, botName(m)), m.User == ""),
+		Realm:         1,
+		Subject:       topic,
+		Content:       content,
+		DateSent:      sent,
+		SendingClient: 1,
+		HasAttachment: len(m.Files) > 0,
+		HasLink:       strings.Contains(content, "://"),
+	})
+	for _, r := range m.Reactions {
+		name, _, _ := strings.Cut(r.Name, "::")
+		code, ok := zulipEmojiCode(r.Name)
+		if !ok {
+			z.export.SkippedReactions += len(r.Users)
+			continue
+		}
+		for _, u := range r.Users {
+			z.reactions = append(z.reactions, zulipReaction{
+				ID: len(z.reactions) + 1, UserProfile: z.user(u, "", false), Message: id,
+				EmojiName: name, EmojiCode: code, ReactionType: "unicode_emoji",
+			})
+		}
+	}
+}
+
+func botName(m *types.Message) string {
+	if m.BotProfile != nil {
+		return m.BotProfile.Name
+	}
+	return ""
+}
+
+// user returns the Zulip ID of a Slack user, adding the user on first use.
+func (z *zulip) user(slackID, fallback string, bot bool) int {
+	if id, ok := z.userIDs[slackID]; ok {
+		return id
+	}
+	id := len(z.users) + 1
+	z.userIDs[slackID] = id
+	email := strings.ToLower(slackID) + "@slack.invalid"
+	z.users = append(z.users, zulipUser{
+		ID: id, Email: email, DeliveryEmail: email,
+		FullName: cmp.Or(z.names[slackID], fallback, slackID),
+		Realm:    1, IsActive: true, IsBot: bot, Role: zulipRoleMember, AvatarSource: "G",
+	})
+	return id
+}
+
+var zulipMentionRe = regexp.MustCompile(`@([UW][A-Z0-9]+)\b`)
+
+// mentions turns the @<user ID> Markdown leaves for user mentions into
+// Zulip mentions of known users.
+func (z *zulip) mentions(s string) string {
+	return zulipMentionRe.ReplaceAllStringFunc(s, func(m string) string {
+		if name := z.names[m[1:]]; name != "" {
+			return "@**" + name + "**"
+		}
+		return m
+	})
+}
+
+// zulipEmojiCode returns Zulip's code for a standard emoji: its code
+// points in hex, joined by dashes, without variation selectors.
+func zulipEmojiCode(name string) (string, bool) {
+	c, ok := emoji.Char(name)
+	if !ok {
+		return "", false
+	}
+	var points []string
+	for _, r := range c {
+		if r != '\ufe0f' {
+			points = append(points, fmt.Sprintf("%x", r))
+		}
+	}
+	return strings.Join(points, "-"), true
+}
+
+func (z *zulip) finish(stream ZulipStream) ZulipExport {
+	e := z.export
+	for i := range z.users {
+		z.users[i].DateJoined = z.created
+	}
+	// Every user gets a personal recipient, then the stream gets its own.
+	var recipients []zulipRecipient
+	for _, u := range z.users {
+		recipients = append(recipients, zulipRecipient{ID: u.ID, TypeID: u.ID, Type: zulipRecipientPersonal})
+	}
+	streamRecipient := len(recipients) + 1
+	recipients = append(recipients, zulipRecipient{ID: streamRecipient, TypeID: 1, Type: zulipRecipientStream})
+
+	// Users are subscribed to their personal recipient and to the stream.
+	var subs []zulipSubscription
+	for _, r := range recipients[:len(z.users)] {
+		subs = append(subs, zulipSubscription{ID: len(subs) + 1, UserProfile: r.TypeID, Recipient: r.ID, Active: true, IsUserActive: true, Color: "#c2c2c2"})
+	}
+	for _, u := range z.users {
+		subs = append(subs, zulipSubscription{ID: len(subs) + 1, UserProfile: u.ID, Recipient: streamRecipient, Active: true, IsUserActive: true, Color: "#76ce90"})
+	}
+
+	e.Realm = map[string]any{
+		"zerver_realm": []map[string]any{{
+			"id": 1, "string_id": "", "name": stream.Realm, "date_created": z.created,
+		}},
+		"zerver_client":      []map[string]any{{"id": 1, "name": "populate_db"}},
+		"zerver_userprofile": nonNil(z.users),
+		"zerver_recipient":   recipients,
+		"zerver_stream": []zulipStreamRow{{
+			ID: 1, Name: stream.Name, Description: stream.Description, Realm: 1,
+			InviteOnly: stream.Private, HistoryPublicToSubscribers: true,
+			DateCreated: z.created, Recipient: streamRecipient,
+		}},
+		"zerver_subscription": subs,
+		"zerver_reaction":     nonNil(z.reactions),
+	}
+	for _, table := range []string{
+		"zerver_defaultstream", "zerver_huddle", "zerver_realmdomain", "zerver_realmemoji",
+		"zerver_realmfilter", "zerver_useractivity", "zerver_useractivityinterval",
+		"zerver_userpresence", "zerver_customprofilefield", "zerver_customprofilefieldvalue",
+		"zerver_userprofile_crossrealm", "zerver_userprofile_mirrordummy",
+	} {
+		e.Realm[table] = []any{}
+	}
+
+	for start := 0; start < len(z.messages); start += zulipBatch {
+		batch := ZulipMessages{Message: z.messages[start:min(start+zulipBatch, len(z.messages))]}
+		for _, m := range batch.Message {
+			for _, u := range z.users {
+				batch.UserMessage = append(batch.UserMessage, zulipUserMessage{
+					ID: len(batch.UserMessage) + start*len(z.users) + 1, UserProfile: u.ID, Message: m.ID, FlagsMask: zulipFlagRead,
+				})
+			}
+		}
+		for i := range batch.Message {
+			batch.Message[i].Recipient = streamRecipient
+		}
+		e.Messages = append(e.Messages, batch)
+	}
+	return *e
+}
+
+// Files returns the export's files by path relative to the export
+// directory: realm.json, the messages files, and the empty records of the
+// attachments, avatars, uploads and emoji "manage.py import" also reads.
+func (e ZulipExport) Files() map[string]any {
+	files := map[string]any{
+		"realm.json":               e.Realm,
+		"attachment.json":          map[string][]any{"zerver_attachment": {}},
+		"avatars/records.json":     []any{},
+		"uploads/records.json":     []any{},
+		"emoji/records.json":       []any{},
+		"realm_icons/records.json": []any{},
+	}
+	for i, m := range e.Messages {
+		files[fmt.Sprintf("messages-%06d.json", i+1)] = m
+	}
+	return files
+}
+
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,99 @@
+package format
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestZulip(t *testing.T) {
+	broadcast := mmMsg("1700000060.000200", "U2", "1700000000.000100", "thread_broadcast", "also here")
+	parent := mmMsg("1700000000.000100", "U1", "1700000000.000100", "", "*Deploy* failed\nsee logs",
+		mmMsg("1700000030.000100", "U2", "1700000000.000100", "", "on it <@U1>"),
+		broadcast,
+	)
+	parent.Reactions = []slack.ItemReaction{
+		{Name: "wave::skin-tone-3", Users: []string{"U2"}, Count: 1},
+		{Name: "heart", Users: []string{"U3"}, Count: 1},
+		{Name: "partyparrot", Users: []string{"U2", "U3"}, Count: 2},
+	}
+	conv := types.Conversation{ID: "C1", Messages: []types.Message{
+		parent,
+		broadcast,
+		mmMsg("1700000100.000100", "U3", "", "channel_join", "<@U3> has joined the channel"),
+		mmMsg("1700000200.000100", "U3", "", "", "bye"),
+	}}
+	e := Zulip(conv, ZulipStream{Realm: "Example", Name: "general", Private: true}, map[string]string{"U1": "alice", "U2": "bob"})
+
+	if len(e.Messages) != 1 {
+		t.Fatalf("got %d messages files, want 1", len(e.Messages))
+	}
+	msgs := e.Messages[0].Message
+	var topics, contents []string
+	for _, m := range msgs {
+		topics = append(topics, m.Subject)
+		contents = append(contents, m.Content)
+	}
+	wantTopics := []string{"Deploy failed", "Deploy failed", "Deploy failed", "imported from Slack"}
+	if strings.Join(topics, "|") != strings.Join(wantTopics, "|") {
+		t.Errorf("topics = %q, want %q", topics, wantTopics)
+	}
+	if contents[1] != "on it @**alice**" || contents[0] != "**Deploy** failed\nsee logs" {
+		t.Errorf("contents = %q", contents)
+	}
+	if msgs[0].DateSent != 1700000000.0001 || msgs[0].Recipient != 4 {
+		t.Errorf("first message = %+v, want sent at its ts to the stream's recipient 4", msgs[0])
+	}
+	if got := len(e.Messages[0].UserMessage); got != 4*3 {
+		t.Errorf("got %d user messages, want one per message and user", got)
+	}
+
+	users := e.Realm["zerver_userprofile"].([]zulipUser)
+	if len(users) != 3 || users[0].FullName != "alice" || users[2].FullName != "U3" || users[2].Email != "u3@slack.invalid" {
+		t.Errorf("users = %+v, want alice, bob and U3 by ID", users)
+	}
+	reactions := e.Realm["zerver_reaction"].([]zulipReaction)
+	if len(reactions) != 2 || reactions[0].EmojiCode != "1f44b-1f3fc" || reactions[0].EmojiName != "wave" || reactions[1].EmojiCode != "2764" {
+		t.Errorf("reactions = %+v, want wave with its tone and heart", reactions)
+	}
+	if e.SkippedReactions != 2 || len(e.Skipped) != 1 || e.Skipped["channel_join"] != 1 {
+		t.Errorf("skipped = %v and %d reactions, want one channel_join and 2 custom reactions", e.Skipped, e.SkippedReactions)
+	}
+	stream := e.Realm["zerver_stream"].([]zulipStreamRow)[0]
+	if stream.Name != "general" || !stream.InviteOnly || stream.DateCreated != 1700000000.0001 {
+		t.Errorf("stream = %+v", stream)
+	}
+
+	files := e.Files()
+	for _, name := range []string{"realm.json", "messages-000001.json", "attachment.json", "avatars/records.json", "emoji/records.json"} {
+		v, ok := files[name]
+		if !ok {
+			t.Errorf("files lack %s", name)
+			continue
+		}
+		if _, err := json.Marshal(v); err != nil {
+			t.Errorf("%s doesn't encode: %v", name, err)
+		}
+	}
+}
+
+func TestZulipTopic(t *testing.T) {
+	long := strings.Repeat("é", 70)
+	tests := []struct{ text, want string }{
+		{"Release *1.2* <https://x.example|notes>\nmore", "Release 1.2 notes"},
+		{"", "thread 2023-11-14 22:13 UTC"},
+		{long, strings.Repeat("é", 59) + "…"},
+	}
+	for _, tt := range tests {
+		got := zulipTopic(tt.text, "1700000000.000100")
+		if got != tt.want {
+			t.Errorf("zulipTopic(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+		if n := len([]rune(got)); n > zulipMaxTopic {
+			t.Errorf("zulipTopic(%q) has %d characters", tt.text, n)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package grep matches message text against --grep patterns: regular
+// expressions, each with a label that names it in the output, combined with
+// any or all logic.
+package grep
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Logic is how a Matcher combines its patterns.
+type Logic string
+
+const (
+	// Any matches text that any pattern matches.
+	Any Logic = "any"
+	// All matches text that every pattern matches.
+	All Logic = "all"
+)
+
+// ParseLogic parses a --grep-logic value.
+func ParseLogic(s string) (Logic, error) {
+	switch l := Logic(s); l {
+	case Any, All:
+		return l, nil
+	}
+	return "", fmt.Errorf("unknown logic %q: use any or all", s)
+}
+
+// Pattern is a compiled pattern and its label.
+type Pattern struct {
+	Label string
+	re    *regexp.Regexp
+}
+
+// labelRe matches the label of a pattern.
+var labelRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// Compile compiles a pattern: "<label>:<regular expression>", e.g.
+// payment:payment_id=\d+, or a regular expression, labeled by itself. A
+// leading ":" leaves the label out, for an expression that starts like one,
+// such as :https?://example\.com.
+func Compile(spec string) (Pattern, error) {
+	label, expr := "", spec
+	if l, e, ok := strings.Cut(spec, ":"); ok && (l == "" || labelRe.MatchString(l)) {
+		label, expr = l, e
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Pattern{}, fmt.Errorf("%q: %w", spec, err)
+	}
+	if re.MatchString("") {
+		return Pattern{}, fmt.Errorf("%q matches empty text", spec)
+	}
+	if label == "" {
+		label = expr
+	}
+	return Pattern{Label: label, re: re}, nil
+}
+
+// Matcher matches text against its patterns.
+type Matcher struct {
+	patterns []Pattern
+	logic    Logic
+}
+
+// New returns a Matcher of specs, compiled with Compile, combined with
+// logic. Two patterns can't share a label.
+func New(specs []string, logic Logic) (*Matcher, error) {
+	m := &Matcher{logic: logic}
+	seen := make(map[string]bool)
+	for _, s := range specs {
+		p, err := Compile(s)
+		if err != nil {
+			return nil, err
+		}
+		if seen[p.Label] {
+			return nil, fmt.Errorf("%q: the label %s is taken", s, p.Label)
+		}
+		seen[p.Label] = true
+		m.patterns = append(m.patterns, p)
+	}
+	if len(m.patterns) == 0 {
+		return nil, errors.New("no patterns")
+	}
+	return m, nil
+}
+
+// Match returns the labels of the patterns that match any of texts, in the
+// order the patterns were given, and whether they satisfy the Matcher's
+// logic: one of them with Any, all of them with All.
+func (m *Matcher) Match(texts ...string) ([]string, bool) {
+	var labels []string
+	for _, p := range m.patterns {
+		for _, t := range texts {
+			if p.re.MatchString(t) {
+				labels = append(labels, p.Label)
+				break
+			}
+		}
+	}
+	if m.logic == All {
+		return labels, len(labels) == len(m.patterns)
+	}
+	return labels, len(labels) > 0
+}
@@ -0,0 +1,103 @@
+package grep
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		spec, label, match string
+	}{
+		{`payment:payment_id=\d+`, "payment", "payment_id=42"},
+		{`refund`, "refund", "a refund"},
+		{`:https?://example\.com`, `https?://example\.com`, "see https://example.com"},
+		{`https://example\.com`, "https", "see //example.com"},
+		{`https?://example\.com`, `https?://example\.com`, "see http://example.com"},
+		{`(?i)outage`, "(?i)outage", "OUTAGE"},
+		{`p-1_x:a`, "p-1_x", "a"},
+	}
+	for _, tt := range tests {
+		p, err := Compile(tt.spec)
+		if err != nil {
+			t.Errorf("Compile(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if p.Label != tt.label || !p.re.MatchString(tt.match) {
+			t.Errorf("Compile(%q) = %s %v, want label %s matching %q", tt.spec, p.Label, p.re, tt.label, tt.match)
+		}
+	}
+
+	for _, bad := range []string{`(`, `x*`, `label:(`, `label:`, ``} {
+		if _, err := Compile(bad); err == nil {
+			t.Errorf("Compile(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	specs := []string{`payment:payment_id=\d+`, `refund:(?i)refund`, `timeout`}
+	tests := []struct {
+		text   string
+		logic  Logic
+		labels []string
+		ok     bool
+	}{
+		{"nothing here", Any, nil, false},
+		{"nothing here", All, nil, false},
+		{"payment_id=42 failed", Any, []string{"payment"}, true},
+		{"payment_id=42 failed", All, []string{"payment"}, false},
+		{"Refund of payment_id=42 after a timeout", Any, []string{"payment", "refund", "timeout"}, true},
+		{"Refund of payment_id=42 after a timeout", All, []string{"payment", "refund", "timeout"}, true},
+		{"timeout, then refund", All, []string{"refund", "timeout"}, false},
+	}
+	for _, tt := range tests {
+		m, err := New(specs, tt.logic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		labels, ok := m.Match(tt.text)
+		if !slices.Equal(labels, tt.labels) || ok != tt.ok {
+			t.Errorf("%s Match(%q) = %v, %v; want %v, %v", tt.logic, tt.text, labels, ok, tt.labels, tt.ok)
+		}
+	}
+}
+
+func TestMatcherTexts(t *testing.T) {
+	// All is satisfied across the texts of a message, its text and an
+	// attachment's, not only within one.
+	m, err := New([]string{"a:alpha", "b:beta"}, All)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels, ok := m.Match("alpha", "beta"); !ok || !slices.Equal(labels, []string{"a", "b"}) {
+		t.Errorf("Match() = %v, %v; want both labels", labels, ok)
+	}
+	if labels, ok := m.Match("alpha", ""); ok || !slices.Equal(labels, []string{"a"}) {
+		t.Errorf("Match() = %v, %v; want a only, unsatisfied", labels, ok)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for name, specs := range map[string][]string{
+		"none":          nil,
+		"label twice":   {"x:a", "x:b"},
+		"bad pattern":   {"ok", "("},
+		"same as label": {"a", "a"},
+	} {
+		if _, err := New(specs, Any); err == nil {
+			t.Errorf("%s: New(%q) succeeded, want an error", name, specs)
+		}
+	}
+}
+
+func TestParseLogic(t *testing.T) {
+	for _, s := range []string{"any", "all"} {
+		if l, err := ParseLogic(s); err != nil || string(l) != s {
+			t.Errorf("ParseLogic(%q) = %q, %v", s, l, err)
+		}
+	}
+	if _, err := ParseLogic("or"); err == nil {
+		t.Error("ParseLogic(or) succeeded")
+	}
+}
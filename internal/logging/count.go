@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// Count wraps next so that every record at or above level adds one to n,
+// whether or not next logs it. Handlers derived with attributes or groups
+// share n.
+func Count(next slog.Handler, level slog.Level, n *atomic.Int64) slog.Handler {
+	return &counter{next: next, level: level, n: n}
+}
+
+type counter struct {
+	next  slog.Handler
+	level slog.Level
+	n     *atomic.Int64
+}
+
+func (h *counter) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level || h.next.Enabled(ctx, level)
+}
+
+func (h *counter) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= h.level {
+		h.n.Add(1)
+	}
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *counter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &counter{next: h.next.WithAttrs(attrs), level: h.level, n: h.n}
+}
+
+func (h *counter) WithGroup(name string) slog.Handler {
+	return &counter{next: h.next.WithGroup(name), level: h.level, n: h.n}
+}
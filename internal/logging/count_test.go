@@ -0,0 +1,24 @@
+package logging
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	var n atomic.Int64
+	rec := &recorder{level: slog.LevelError}
+	l := slog.New(NewThrottle(Count(rec, slog.LevelWarn, &n)))
+	l.Info("fetched")
+	l.With("channel", "C1").Warn("share skipped")
+	l.Warn("share skipped")
+	l.Error("failed")
+
+	if got := n.Load(); got != 3 {
+		t.Errorf("counted %d records, want 3 warnings and errors", got)
+	}
+	if len(rec.records) != 1 || rec.records[0].Message != "failed" {
+		t.Errorf("records below the next handler's level were passed on: %v", rec.records)
+	}
+}
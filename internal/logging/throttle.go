@@ -0,0 +1,176 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// LevelTrace is below slog.LevelDebug. With it enabled, Throttle passes
+// every record through.
+const LevelTrace = slog.LevelDebug - 4
+
+const (
+	// summaryInterval and summaryEvery bound how long and how many repeats
+	// of a message are held back before a summary line is written.
+	summaryInterval = 5 * time.Second
+	summaryEvery    = 100
+)
+
+// Throttle collapses high-frequency log records, such as one per fetched
+// page or thread. Only records that opt in are held back: those of a logger
+// from Frequent, and those with one of the messages given to NewThrottle,
+// for loops in libraries. The first such record with a given level and
+// message is passed through; repeats are counted instead, and every
+// summaryInterval or summaryEvery repeats the latest of them is written
+// with a "repeated" count and the time it covers. A message that hasn't
+// repeated within summaryInterval starts over. Warnings and errors are
+// never held back.
+type Throttle struct {
+	next  slog.Handler
+	state *throttleState
+	// frequent is set on the handlers of Frequent loggers.
+	frequent bool
+}
+
+type throttleState struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	bursts   map[string]*burst
+	messages map[string]bool
+}
+
+// burst is the run of repeats of one message since its last summary.
+type burst struct {
+	start    time.Time
+	repeated int
+	last     slog.Record
+	// next is the handler the latest repeat was meant for, which carries its
+	// logger's attributes and groups.
+	next slog.Handler
+}
+
+// summary is a pending summary line.
+type summary struct {
+	next   slog.Handler
+	record slog.Record
+}
+
+// NewThrottle returns a Throttle logging to next that also holds back
+// repeats of records with one of messages.
+func NewThrottle(next slog.Handler, messages ...string) *Throttle {
+	s := &throttleState{now: time.Now, bursts: map[string]*burst{}, messages: map[string]bool{}}
+	for _, m := range messages {
+		s.messages[m] = true
+	}
+	return &Throttle{next: next, state: s}
+}
+
+// Frequent returns a logger for high-frequency events, such as one per
+// fetched page, whose repeats l's Throttle collapses. Without a Throttle, l
+// is returned as is.
+func Frequent(l *slog.Logger) *slog.Logger {
+	h, ok := l.Handler().(*Throttle)
+	if !ok {
+		return l
+	}
+	return slog.New(&Throttle{next: h.next, state: h.state, frequent: true})
+}
+
+func (h *Throttle) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *Throttle) Handle(ctx context.Context, r slog.Record) error {
+	s := h.state
+	if r.Level >= slog.LevelWarn || h.next.Enabled(ctx, LevelTrace) || !h.frequent && !s.messages[r.Message] {
+		return h.next.Handle(ctx, r)
+	}
+	key := r.Level.String() + " " + r.Message
+
+	s.mu.Lock()
+	now := s.now()
+	due := s.expire(now)
+	b, seen := s.bursts[key]
+	if !seen {
+		s.bursts[key] = &burst{start: now}
+	} else {
+		b.repeated++
+		b.last = r.Clone()
+		b.next = h.next
+		if b.repeated >= summaryEvery {
+			due = append(due, b.summarize(now))
+		}
+	}
+	s.mu.Unlock()
+
+	for _, d := range due {
+		if err := d.next.Handle(ctx, d.record); err != nil {
+			return err
+		}
+	}
+	if !seen {
+		return h.next.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (h *Throttle) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Throttle{next: h.next.WithAttrs(attrs), state: h.state, frequent: h.frequent}
+}
+
+func (h *Throttle) WithGroup(name string) slog.Handler {
+	return &Throttle{next: h.next.WithGroup(name), state: h.state, frequent: h.frequent}
+}
+
+// Flush writes the summaries of every message with repeats held back. Call
+// it before exiting.
+func (h *Throttle) Flush() {
+	s := h.state
+	s.mu.Lock()
+	now := s.now()
+	var due []summary
+	for key, b := range s.bursts {
+		if b.repeated > 0 {
+			due = append(due, b.summarize(now))
+		}
+		delete(s.bursts, key)
+	}
+	s.mu.Unlock()
+
+	for _, d := range due {
+		d.next.Handle(context.Background(), d.record)
+	}
+}
+
+// expire summarizes the bursts whose interval has passed and forgets those
+// that didn't repeat. s.mu must be held.
+func (s *throttleState) expire(now time.Time) []summary {
+	var due []summary
+	for key, b := range s.bursts {
+		if now.Sub(b.start) < summaryInterval {
+			continue
+		}
+		if b.repeated == 0 {
+			delete(s.bursts, key)
+			continue
+		}
+		due = append(due, b.summarize(now))
+	}
+	return due
+}
+
+// summarize returns the summary line for b's repeats and starts a new
+// interval.
+func (b *burst) summarize(now time.Time) summary {
+	r := slog.NewRecord(b.last.Time, b.last.Level, b.last.Message, b.last.PC)
+	b.last.Attrs(func(a slog.Attr) bool {
+		r.AddAttrs(a)
+		return true
+	})
+	r.AddAttrs(slog.Int("repeated", b.repeated), slog.Duration("over", now.Sub(b.start).Round(time.Millisecond)))
+	sum := summary{next: b.next, record: r}
+	*b = burst{start: now}
+	return sum
+}
@@ -0,0 +1,174 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder collects the records a handler writes.
+type recorder struct {
+	mu      sync.Mutex
+	level   slog.Level
+	records []slog.Record
+}
+
+func (r *recorder) Enabled(_ context.Context, l slog.Level) bool { return l >= r.level }
+
+func (r *recorder) Handle(_ context.Context, rec slog.Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, rec.Clone())
+	return nil
+}
+
+func (r *recorder) WithAttrs([]slog.Attr) slog.Handler { return r }
+func (r *recorder) WithGroup(string) slog.Handler      { return r }
+
+// attr returns the value of key in rec, or nil.
+func attr(rec slog.Record, key string) any {
+	var v any
+	rec.Attrs(func(a slog.Attr) bool {
+		if a.Key == key {
+			v = a.Value.Any()
+		}
+		return true
+	})
+	return v
+}
+
+// newTestThrottle returns a Throttle on a manual clock.
+func newTestThrottle(level slog.Level) (*Throttle, *recorder, *time.Time) {
+	rec := &recorder{level: level}
+	h := NewThrottle(rec)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.state.now = func() time.Time { return now }
+	return h, rec, &now
+}
+
+// countEvents returns how many events the written records stand for: one per
+// passed record, plus the repeats each summary reports.
+func countEvents(t *testing.T, records []slog.Record, msg string) (passed, summarized int) {
+	t.Helper()
+	for _, r := range records {
+		if r.Message != msg {
+			continue
+		}
+		if n, ok := attr(r, "repeated").(int64); ok {
+			summarized += int(n)
+		} else {
+			passed++
+		}
+	}
+	return passed, summarized
+}
+
+func TestThrottleSummarizesEvery100(t *testing.T) {
+	h, rec, _ := newTestThrottle(slog.LevelInfo)
+	logger := Frequent(slog.New(h))
+	for page := 1; page <= 250; page++ {
+		logger.Info("fetching users", "page", page)
+	}
+	h.Flush()
+
+	// The first page, summaries after 100 and 200 repeats, and the final 49.
+	if len(rec.records) != 4 {
+		t.Fatalf("wrote %d records, want 4", len(rec.records))
+	}
+	passed, summarized := countEvents(t, rec.records, "fetching users")
+	if passed != 1 || passed+summarized != 250 {
+		t.Errorf("passed %d, summarized %d; want 1 passed and all 250 accounted for", passed, summarized)
+	}
+	if got := attr(rec.records[1], "page"); got != int64(101) {
+		t.Errorf("first summary page = %v, want the latest repeat's, 101", got)
+	}
+}
+
+func TestThrottleSummarizesEveryInterval(t *testing.T) {
+	h, rec, now := newTestThrottle(slog.LevelInfo)
+	logger := Frequent(slog.New(h))
+	for i := range 12 {
+		logger.Info("fetching thread", "n", i)
+		*now = now.Add(time.Second)
+	}
+	h.Flush()
+
+	passed, summarized := countEvents(t, rec.records, "fetching thread")
+	if passed != 1 || passed+summarized != 12 {
+		t.Errorf("passed %d, summarized %d; want 1 passed and all 12 accounted for", passed, summarized)
+	}
+	// A summary is due each time 5s have passed: at 5s and at 10s.
+	if len(rec.records) != 4 {
+		t.Errorf("wrote %d records, want the first, two interval summaries and the flush", len(rec.records))
+	}
+	if got := attr(rec.records[1], "over"); got != 5*time.Second {
+		t.Errorf("summary covers %v, want 5s", got)
+	}
+}
+
+func TestThrottleIdleMessageStartsOver(t *testing.T) {
+	h, rec, now := newTestThrottle(slog.LevelInfo)
+	logger := Frequent(slog.New(h))
+	logger.Info("authenticating")
+	*now = now.Add(time.Minute)
+	logger.Info("authenticating")
+	h.Flush()
+
+	if passed, summarized := countEvents(t, rec.records, "authenticating"); passed != 2 || summarized != 0 {
+		t.Errorf("passed %d, summarized %d; want both passed", passed, summarized)
+	}
+}
+
+func TestThrottleListedMessages(t *testing.T) {
+	rec := &recorder{level: slog.LevelDebug}
+	h := NewThrottle(rec, "- message")
+	logger := slog.New(h)
+	for i := range 5 {
+		logger.Debug("- message", "i", i)
+		logger.Debug("other", "i", i)
+	}
+	h.Flush()
+	if passed, summarized := countEvents(t, rec.records, "- message"); passed != 1 || summarized != 4 {
+		t.Errorf("listed message: passed %d, summarized %d; want 1 and 4", passed, summarized)
+	}
+	if passed, _ := countEvents(t, rec.records, "other"); passed != 5 {
+		t.Errorf("other message: passed %d, want all 5", passed)
+	}
+}
+
+func TestThrottlePassesThrough(t *testing.T) {
+	t.Run("warnings", func(t *testing.T) {
+		h, rec, _ := newTestThrottle(slog.LevelInfo)
+		logger := Frequent(slog.New(h))
+		for range 10 {
+			logger.Warn("skipping shared message")
+		}
+		if len(rec.records) != 10 {
+			t.Errorf("wrote %d warnings, want all 10", len(rec.records))
+		}
+	})
+	t.Run("records that don't opt in", func(t *testing.T) {
+		h, rec, _ := newTestThrottle(slog.LevelInfo)
+		logger := slog.New(h)
+		for i := range 10 {
+			logger.Info("downloaded file", "id", i)
+		}
+		h.Flush()
+		if len(rec.records) != 10 || attr(rec.records[9], "id") != int64(9) {
+			t.Errorf("wrote %d records, want all 10 with their attributes", len(rec.records))
+		}
+	})
+	t.Run("trace level", func(t *testing.T) {
+		h, rec, _ := newTestThrottle(LevelTrace)
+		logger := Frequent(slog.New(h))
+		for range 150 {
+			logger.Info("fetching users")
+		}
+		h.Flush()
+		if len(rec.records) != 150 {
+			t.Errorf("wrote %d records, want all 150 at trace level", len(rec.records))
+		}
+	})
+}
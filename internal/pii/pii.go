@@ -0,0 +1,161 @@
+// Package pii masks personal data and secrets in message text: email
+// addresses, phone and card numbers, cloud and Slack tokens, and patterns
+// of the user's own. Each match becomes [REDACTED:<type>], and the
+// Redactor counts them by type.
+package pii
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// A rule masks the matches of re that check, when set, accepts; check is
+// given the text and where the match is in it.
+type rule struct {
+	kind  string
+	re    *regexp.Regexp
+	check func(s string, start, end int) bool
+}
+
+// builtin are the --redact rules, in the order they are applied: tokens
+// first, so their digits aren't taken for numbers.
+var builtin = []rule{
+	{kind: "slack-token", re: regexp.MustCompile(`\bxox[abpeorsd]-[0-9A-Za-z-]{10,}|https://hooks\.slack\.com/services/[0-9A-Za-z/]+`)},
+	{kind: "github-token", re: regexp.MustCompile(`\b(?:gh[pousr]_[0-9A-Za-z]{36,255}|github_pat_[0-9A-Za-z_]{22,255})\b`)},
+	{kind: "aws-key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{kind: "email", re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`)},
+	{kind: "card", re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), check: luhn},
+	{kind: "phone", re: regexp.MustCompile(`(?:\+\d{1,3}[ -]?)?(?:\(\d{1,4}\)[ -]?|\b\d{2,4}[ -])\d{2,4}[ -]?\d{3,4}\b`), check: phoneNumber},
+}
+
+// Redactor masks text with its rules. It is safe for concurrent use.
+type Redactor struct {
+	rules []rule
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// New returns a Redactor with the built-in rules when builtins is set, and
+// a rule per pattern. A pattern is a regular expression, typed "custom",
+// or "<type>=<regular expression>", e.g. employee-id=E\d{6}. The patterns
+// are applied before the built-in rules.
+func New(builtins bool, patterns []string) (*Redactor, error) {
+	r := &Redactor{counts: make(map[string]int)}
+	for _, p := range patterns {
+		kind, expr := "custom", p
+		if k, e, ok := strings.Cut(p, "="); ok && kindRe.MatchString(k) {
+			kind, expr = k, e
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", p, err)
+		}
+		if re.MatchString("") {
+			return nil, fmt.Errorf("%q matches empty text", p)
+		}
+		r.rules = append(r.rules, rule{kind: kind, re: re})
+	}
+	if builtins {
+		r.rules = append(r.rules, builtin...)
+	}
+	return r, nil
+}
+
+// kindRe matches the type of a pattern.
+var kindRe = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// String returns s with every match of the rules masked.
+func (r *Redactor) String(s string) string {
+	for _, rl := range r.rules {
+		var b strings.Builder
+		n, last := 0, 0
+		for _, m := range rl.re.FindAllStringIndex(s, -1) {
+			if rl.check != nil && !rl.check(s, m[0], m[1]) {
+				continue
+			}
+			b.WriteString(s[last:m[0]])
+			b.WriteString("[REDACTED:" + rl.kind + "]")
+			n, last = n+1, m[1]
+		}
+		if n == 0 {
+			continue
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+		r.mu.Lock()
+		r.counts[rl.kind] += n
+		r.mu.Unlock()
+	}
+	return s
+}
+
+// Counts returns the number of matches masked so far, by type.
+func (r *Redactor) Counts() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return maps.Clone(r.counts)
+}
+
+// luhn reports whether the digits of the match pass the Luhn check card
+// numbers carry.
+func luhn(s string, start, end int) bool {
+	s = s[start:end]
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// phoneNumber reports whether the match has as many digits as a phone
+// number with its area code, 9 to 15, and isn't part of a longer run of
+// digit groups, such as a card number that failed luhn.
+func phoneNumber(s string, start, end int) bool {
+	if groupNext(s[end:]) || groupNext(reverse(s[:start])) {
+		return false
+	}
+	n := 0
+	for _, c := range s[start:end] {
+		if c >= '0' && c <= '9' {
+			n++
+		}
+	}
+	return n >= 9 && n <= 15
+}
+
+// groupNext reports whether s starts with another group of digits: a
+// digit, or a space or dash and a digit.
+func groupNext(s string) bool {
+	if len(s) > 1 && (s[0] == ' ' || s[0] == '-') {
+		s = s[1:]
+	}
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
+
+// reverse returns the last two bytes of s in reverse order, for groupNext
+// to look behind a match.
+func reverse(s string) string {
+	if len(s) > 2 {
+		s = s[len(s)-2:]
+	}
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
@@ -0,0 +1,374 @@
+// Package progress writes the machine-readable progress stream behind
+// --progress-fd and --progress-file: one JSON object per line (NDJSON),
+// separate from the human-readable logs.
+//
+// The stream is a stable contract for wrapper UIs. Every event carries
+// "v": 1; fields are only ever added to version 1, never renamed or removed,
+// and consumers should ignore fields and event types they don't know.
+package progress
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rusq/slackdump/v3"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// Version is the version of the event schema.
+const Version = 1
+
+// Event types.
+const (
+	// TypeStage starts a stage; Stage names it.
+	TypeStage = "stage"
+	// TypeProgress updates the counters within a stage.
+	TypeProgress = "progress"
+	// TypeWarning reports a warning; Message holds it. The run goes on.
+	TypeWarning = "warning"
+	// TypeDone ends a successful run. It is always the last event.
+	TypeDone = "done"
+	// TypeError ends a failed run with Message. It is always the last event.
+	TypeError = "error"
+)
+
+// Stages, in the order a run goes through them. Optional stages are
+// skipped when their flag isn't set.
+const (
+	StageAuthenticating   = "authenticating"
+	StageDumping          = "dumping"
+	StageExpandShares     = "expanding_shares"
+	StageResolvingUsers   = "resolving_users"
+	StageDownloadingFiles = "downloading_files"
+	StageWriting          = "writing"
+)
+
+// DefaultInterval is the least time between two progress events.
+const DefaultInterval = 500 * time.Millisecond
+
+// Event is one line of the stream.
+type Event struct {
+	V    int       `json:"v"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Stage is the current stage.
+	Stage string `json:"stage"`
+	// Messages and Replies count what has been fetched so far: top-level
+	// messages and thread replies.
+	Messages int `json:"messages"`
+	Replies  int `json:"replies"`
+	// Requests counts the requests sent to Slack so far.
+	Requests int `json:"requests"`
+	// Percent and ETASeconds estimate the progress of the dumping stage.
+	// They are only set when the time range is bounded, with --from.
+	Percent    *float64 `json:"percent,omitempty"`
+	ETASeconds *float64 `json:"eta_seconds,omitempty"`
+	// Files counts the downloads of --files. It is only set once a file to
+	// download has been found, which may be while dumping.
+	Files *Files `json:"files,omitempty"`
+	// Message is the text of a warning or error.
+	Message string `json:"message,omitempty"`
+}
+
+// Files counts the downloads of --files.
+type Files struct {
+	// Found counts the files found to download so far, Remaining those not
+	// yet downloaded, skipped or failed.
+	Found     int `json:"found"`
+	Remaining int `json:"remaining"`
+	// Bytes counts the bytes downloaded, BytesPerSecond their rate since the
+	// first file was found.
+	Bytes          int64   `json:"bytes"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+}
+
+// Reporter writes the stream. A nil *Reporter discards everything, so
+// callers need not check whether a stream was asked for.
+type Reporter struct {
+	// Interval is the least time between two progress events; stage,
+	// warning and final events are never held back.
+	Interval time.Duration
+	// now is the clock; tests replace it.
+	now func() time.Time
+
+	mu         sync.Mutex
+	enc        *json.Encoder
+	requests   func() int
+	waited     func() time.Duration
+	ev         Event
+	lastSent   time.Time
+	stageStart time.Time
+	// oldest and latest bound the dump for Percent; oldest is zero when the
+	// range is open.
+	oldest, latest time.Time
+	// threads counts the fetched messages with replies, threadsDone those
+	// whose replies came with them.
+	threads, threadsDone int
+	// filesStart is when the first file to download was found.
+	filesStart time.Time
+	// status shows the progress on stderr, nil when it isn't shown.
+	status *status
+	ended  bool
+}
+
+// New returns a Reporter writing to w. With a nil w it writes no stream,
+// for a Reporter that only shows its status.
+func New(w io.Writer) *Reporter {
+	r := &Reporter{Interval: DefaultInterval, now: time.Now}
+	if w != nil {
+		r.enc = json.NewEncoder(w)
+	}
+	return r
+}
+
+// CountRequests sets the function reporting the number of requests sent.
+func (r *Reporter) CountRequests(f func() int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = f
+}
+
+// Stage starts a stage.
+func (r *Reporter) Stage(name string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ev.Stage, r.stageStart = name, r.now()
+	r.ev.Percent, r.ev.ETASeconds = nil, nil
+	r.send(TypeStage, "")
+}
+
+// DumpRange sets the time range being dumped, from which Percent is
+// estimated. A zero latest means now.
+func (r *Reporter) DumpRange(oldest, latest time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if latest.IsZero() {
+		latest = r.now()
+	}
+	r.oldest, r.latest = oldest, latest
+}
+
+// Fetched counts a chunk of fetched messages, with their thread replies,
+// and sends a progress event unless one was sent less than Interval ago.
+// Slack returns history newest first, so the oldest message of the chunk
+// tells how far into the range the dump is.
+func (r *Reporter) Fetched(chunk []types.Message) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var oldest time.Time
+	for _, m := range chunk {
+		r.ev.Messages++
+		r.ev.Replies += len(m.ThreadReplies)
+		if m.ReplyCount > 0 {
+			r.threads++
+			if len(m.ThreadReplies) > 0 {
+				r.threadsDone++
+			}
+		}
+		if t, ok := parseTS(m.Timestamp); ok && (oldest.IsZero() || t.Before(oldest)) {
+			oldest = t
+		}
+	}
+	if !r.oldest.IsZero() && !oldest.IsZero() && r.latest.After(r.oldest) {
+		p := float64(r.latest.Sub(oldest)) / float64(r.latest.Sub(r.oldest))
+		p = min(max(p, 0), 1)
+		pct := p * 100
+		r.ev.Percent = &pct
+		if p > 0 {
+			eta := r.now().Sub(r.stageStart).Seconds() * (1 - p) / p
+			r.ev.ETASeconds = &eta
+		}
+	}
+	if r.now().Sub(r.lastSent) >= r.Interval {
+		r.send(TypeProgress, "")
+	}
+}
+
+// ProcessFunc returns a slackdump process function that reports each
+// chunk of a conversation as it is fetched.
+func (r *Reporter) ProcessFunc() slackdump.ProcessFunc {
+	var first string
+	var seen int
+	return func(chunk []types.Message, _ string) (slackdump.ProcessResult, error) {
+		// For a thread link, slackdump passes the whole thread fetched so
+		// far with every page, its parent first; count only the new part.
+		all := len(chunk)
+		if all > 0 && chunk[0].Timestamp == first {
+			chunk = chunk[min(seen, all):]
+		} else if all > 0 {
+			first = chunk[0].Timestamp
+		}
+		seen = all
+		r.Fetched(chunk)
+		return slackdump.ProcessResult{Entity: "progress", Count: len(chunk)}, nil
+	}
+}
+
+// FilesFound counts n more files to download.
+func (r *Reporter) FilesFound(n int) {
+	if r == nil || n == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ev.Files == nil {
+		r.ev.Files, r.filesStart = &Files{}, r.now()
+	}
+	r.ev.Files.Found += n
+	r.ev.Files.Remaining += n
+	r.filesProgress()
+}
+
+// FileBytes counts n bytes downloaded. Workers call it as the bytes come
+// in, so the rate doesn't wait for a large file to finish.
+func (r *Reporter) FileBytes(n int) {
+	if r == nil || n == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ev.Files == nil {
+		return
+	}
+	r.ev.Files.Bytes += int64(n)
+	r.filesProgress()
+}
+
+// FileDone counts a file downloaded, skipped or failed.
+func (r *Reporter) FileDone() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ev.Files == nil {
+		return
+	}
+	r.ev.Files.Remaining = max(r.ev.Files.Remaining-1, 0)
+	r.filesProgress()
+}
+
+// filesProgress updates the download rate and sends a progress event
+// unless one was sent less than Interval ago. r.mu must be held.
+func (r *Reporter) filesProgress() {
+	if elapsed := r.now().Sub(r.filesStart).Seconds(); elapsed > 0 {
+		r.ev.Files.BytesPerSecond = float64(r.ev.Files.Bytes) / elapsed
+	}
+	if r.now().Sub(r.lastSent) >= r.Interval {
+		r.send(TypeProgress, "")
+	}
+}
+
+// Warn sends a warning event.
+func (r *Reporter) Warn(msg string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.send(TypeWarning, msg)
+}
+
+// End sends the final event: done, or error when err is non-nil. Later
+// events are dropped.
+func (r *Reporter) End(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopStatus()
+	if err != nil {
+		r.send(TypeError, err.Error())
+	} else {
+		r.send(TypeDone, "")
+	}
+	r.ended = true
+}
+
+func (r *Reporter) send(typ, msg string) {
+	if r.ended || r.enc == nil {
+		return
+	}
+	ev := r.ev
+	ev.V, ev.Type, ev.Time, ev.Message = Version, typ, r.now().UTC(), msg
+	if r.requests != nil {
+		ev.Requests = r.requests()
+	}
+	r.lastSent = r.now()
+	// The stream is best effort: a wrapper that stopped reading must not
+	// fail the dump.
+	_ = r.enc.Encode(ev)
+}
+
+func parseTS(ts string) (time.Time, bool) {
+	sec, frac, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	us, _ := strconv.ParseInt((frac + "000000")[:6], 10, 64)
+	return time.Unix(s, us*1000), true
+}
+
+// LogHandler wraps a slog handler so warnings and errors logged during a
+// run are also sent to r as warning events.
+func LogHandler(next slog.Handler, r *Reporter) slog.Handler {
+	return &logHandler{next: next, r: r}
+}
+
+type logHandler struct {
+	next  slog.Handler
+	r     *Reporter
+	attrs []slog.Attr
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || h.next.Enabled(ctx, level)
+}
+
+func (h *logHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if rec.Level >= slog.LevelWarn {
+		var b strings.Builder
+		b.WriteString(rec.Message)
+		write := func(a slog.Attr) bool {
+			b.WriteString(" " + a.Key + "=" + a.Value.String())
+			return true
+		}
+		for _, a := range h.attrs {
+			write(a)
+		}
+		rec.Attrs(write)
+		h.r.Warn(b.String())
+	}
+	if !h.next.Enabled(ctx, rec.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, rec)
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logHandler{next: h.next.WithAttrs(attrs), r: h.r, attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{next: h.next.WithGroup(name), r: h.r, attrs: h.attrs}
+}
@@ -0,0 +1,280 @@
+package progress
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// near reports whether an optional estimate is set and within 0.01 of want.
+func near(v *float64, want float64) bool {
+	return v != nil && math.Abs(*v-want) < 0.01
+}
+
+// decode parses a stream and checks every event against the schema.
+func decode(t *testing.T, stream []byte) []Event {
+	t.Helper()
+	known := []string{TypeStage, TypeProgress, TypeWarning, TypeDone, TypeError}
+	var events []Event
+	sc := bufio.NewScanner(bytes.NewReader(stream))
+	for sc.Scan() {
+		var raw map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &raw); err != nil {
+			t.Fatalf("line %q is not a JSON object: %v", sc.Text(), err)
+		}
+		for _, field := range []string{"v", "type", "time", "stage", "messages", "replies", "requests"} {
+			if _, ok := raw[field]; !ok {
+				t.Errorf("line %s lacks %q", sc.Text(), field)
+			}
+		}
+		var ev Event
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.V != Version || !slices.Contains(known, ev.Type) || ev.Time.IsZero() {
+			t.Errorf("bad event %s", sc.Text())
+		}
+		if (ev.Type == TypeWarning || ev.Type == TypeError) != (ev.Message != "") {
+			t.Errorf("event %s: message set for the wrong type", sc.Text())
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestNilReporter(t *testing.T) {
+	var r *Reporter
+	r.Stage(StageDumping)
+	r.Fetched(make([]types.Message, 3))
+	r.FilesFound(2)
+	r.FileBytes(10)
+	r.FileDone()
+	r.Warn("x")
+	r.End(nil)
+	if _, err := r.ProcessFunc()(nil, "C1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReporterBoundsRate(t *testing.T) {
+	var buf bytes.Buffer
+	r := New(&buf)
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return clock }
+	r.Stage(StageDumping)
+	r.DumpRange(clock.Add(-100*time.Hour), clock)
+	for i := range 10 {
+		clock = clock.Add(100 * time.Millisecond)
+		ts := fmt.Sprintf("%d.000100", clock.Add(-time.Duration(i+1)*10*time.Hour).Unix())
+		r.Fetched([]types.Message{{Message: slack.Message{Msg: slack.Msg{Timestamp: ts}}}})
+	}
+	r.Warn("slow")
+	r.End(nil)
+	r.Warn("after the end")
+
+	events := decode(t, buf.Bytes())
+	var kinds []string
+	for _, ev := range events {
+		kinds = append(kinds, ev.Type)
+	}
+	// A second of chunks 100ms apart yields two progress events 500ms apart.
+	want := []string{TypeStage, TypeProgress, TypeProgress, TypeWarning, TypeDone}
+	if !slices.Equal(kinds, want) {
+		t.Fatalf("event types = %v, want %v", kinds, want)
+	}
+	last := events[len(events)-1]
+	if last.Messages != 10 || !near(last.Percent, 100) || !near(last.ETASeconds, 0) {
+		t.Errorf("final event = %+v, want 10 messages at 100%% with no time left", last)
+	}
+	mid := events[1]
+	if !near(mid.Percent, 50) || !near(mid.ETASeconds, 0.5) {
+		t.Errorf("first progress event = %+v, want 50%% after 0.5s with 0.5s left", mid)
+	}
+}
+
+func TestReporterThreadPages(t *testing.T) {
+	var buf bytes.Buffer
+	r := New(&buf)
+	r.Interval = 0
+	fn := r.ProcessFunc()
+	// For a thread link, slackdump passes the whole thread fetched so far.
+	thread := make([]types.Message, 2, 3)
+	thread[0].Timestamp = "1.0"
+	fn(thread, "C1")
+	fn(append(thread, types.Message{}), "C1")
+
+	events := decode(t, buf.Bytes())
+	if len(events) != 2 || events[1].Messages != 3 {
+		t.Errorf("events = %+v, want 3 messages after two pages", events)
+	}
+}
+
+func TestReporterFiles(t *testing.T) {
+	var buf bytes.Buffer
+	r := New(&buf)
+	r.Interval = 0
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return clock }
+	r.CountRequests(func() int { return 0 })
+	r.ShowStatus(io.Discard, true)
+	defer r.End(nil)
+	r.Stage(StageDumping)
+	r.FileBytes(100) // before any file is found: ignored
+	r.FilesFound(3)
+	clock = clock.Add(2 * time.Second)
+	r.FileBytes(3 << 20)
+	r.FileDone()
+
+	events := decode(t, buf.Bytes())
+	last := events[len(events)-1]
+	want := Files{Found: 3, Remaining: 2, Bytes: 3 << 20, BytesPerSecond: 1.5 * (1 << 20)}
+	if last.Files == nil || *last.Files != want {
+		t.Errorf("files = %+v, want %+v", last.Files, want)
+	}
+	if events[0].Files != nil {
+		t.Errorf("the stage event has files before any was found: %+v", events[0].Files)
+	}
+	r.mu.Lock()
+	line := r.statusLine()
+	r.mu.Unlock()
+	if !strings.Contains(line, " · files 2 left, 1.5 MB/s") {
+		t.Errorf("statusLine() = %q, want the files left and the rate", line)
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	var stream, logs bytes.Buffer
+	r := New(&stream)
+	l := slog.New(LogHandler(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelError}), r))
+	l.With("channel", "C1").Warn("share skipped", "reason", "not_in_channel")
+	l.Info("not forwarded")
+	r.End(errors.New("boom"))
+
+	events := decode(t, stream.Bytes())
+	if len(events) != 2 || events[0].Message != "share skipped channel=C1 reason=not_in_channel" || events[1].Type != TypeError || events[1].Message != "boom" {
+		t.Errorf("events = %+v", events)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("a warning below the log level reached the logs: %s", logs.String())
+	}
+}
+
+// fakeProvider authenticates against a fake Slack server.
+type fakeProvider struct{ srv *httptest.Server }
+
+func (p fakeProvider) SlackToken() string      { return "xoxc-test" }
+func (p fakeProvider) Cookies() []*http.Cookie { return nil }
+func (p fakeProvider) Validate() error         { return nil }
+func (p fakeProvider) Test(ctx context.Context) (*slack.AuthTestResponse, error) {
+	return &slack.AuthTestResponse{}, nil
+}
+func (p fakeProvider) HTTPClient() (*http.Client, error) {
+	u, _ := url.Parse(p.srv.URL)
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+		return http.DefaultTransport.RoundTrip(req)
+	})}, nil
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// slackServer serves a channel of two history pages, the first message
+// with a two-reply thread.
+func slackServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		switch strings.TrimPrefix(r.URL.Path, "/api/") {
+		case "auth.test":
+			fmt.Fprint(w, `{"ok":true,"url":"https://example.slack.com/","team":"Example","user":"alice","team_id":"T1","user_id":"U1"}`)
+		case "conversations.history":
+			if r.Form.Get("cursor") == "" {
+				fmt.Fprint(w, `{"ok":true,"has_more":true,"response_metadata":{"next_cursor":"p2"},"messages":[
+					{"type":"message","user":"U1","text":"three","ts":"1700000300.000100"},
+					{"type":"message","user":"U1","text":"two","ts":"1700000200.000100"}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"ok":true,"has_more":false,"messages":[
+				{"type":"message","user":"U1","text":"one","ts":"1700000100.000100","thread_ts":"1700000100.000100","reply_count":2}]}`)
+		case "conversations.replies":
+			fmt.Fprint(w, `{"ok":true,"has_more":false,"messages":[
+				{"type":"message","user":"U1","text":"one","ts":"1700000100.000100","thread_ts":"1700000100.000100","reply_count":2},
+				{"type":"message","user":"U2","text":"r1","ts":"1700000110.000100","thread_ts":"1700000100.000100"},
+				{"type":"message","user":"U2","text":"r2","ts":"1700000120.000100","thread_ts":"1700000100.000100"}]}`)
+		case "conversations.info":
+			fmt.Fprint(w, `{"ok":true,"channel":{"id":"C1","name":"general"}}`)
+		default:
+			http.Error(w, "unexpected "+r.URL.Path, http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestReporterDuringDump(t *testing.T) {
+	ctx := context.Background()
+	sd, err := slackdump.New(ctx, fakeProvider{slackServer(t)})
+	if err != nil {
+		t.Fatalf("slackdump.New() error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	r := New(&buf)
+	r.Interval = 0
+	requests := 0
+	r.CountRequests(func() int { requests++; return requests })
+	r.Stage(StageDumping)
+	r.DumpRange(time.Unix(1700000000, 0), time.Unix(1700000400, 0))
+	conv, err := sd.Dump(ctx, "C1", time.Unix(1700000000, 0), time.Unix(1700000400, 0), r.ProcessFunc())
+	if err != nil {
+		t.Fatalf("Dump() error: %v", err)
+	}
+	r.Stage(StageWriting)
+	r.End(nil)
+
+	events := decode(t, buf.Bytes())
+	var progress []Event
+	for _, ev := range events {
+		if ev.Type == TypeProgress {
+			progress = append(progress, ev)
+		}
+	}
+	if len(progress) != 2 {
+		t.Fatalf("got %d progress events, want one per history page: %+v", len(progress), events)
+	}
+	if p := progress[0]; p.Stage != StageDumping || p.Messages != 2 || p.Replies != 0 || !near(p.Percent, 50) {
+		t.Errorf("first page event = %+v, want 2 messages at 50%%", p)
+	}
+	if p := progress[1]; p.Messages != 3 || p.Replies != 2 || !near(p.Percent, 75) {
+		t.Errorf("second page event = %+v, want 3 messages, 2 replies at 75%%", p)
+	}
+	last := events[len(events)-1]
+	if last.Type != TypeDone || last.Stage != StageWriting || last.Messages != len(conv.Messages) {
+		t.Errorf("last event = %+v, want done in the writing stage with %d messages", last, len(conv.Messages))
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Messages < events[i-1].Messages || events[i].Requests < events[i-1].Requests {
+			t.Errorf("counters went backwards at event %d: %+v", i, events[i])
+		}
+	}
+}
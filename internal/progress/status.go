@@ -0,0 +1,258 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// StatusInterval is how often the status line on a terminal is redrawn.
+	StatusInterval = time.Second
+	// StatusLogInterval is how often the status is logged when stderr isn't
+	// a terminal.
+	StatusLogInterval = 30 * time.Second
+)
+
+// status shows the progress to a person: a line redrawn in place on a
+// terminal, or a log line now and then otherwise.
+type status struct {
+	w    io.Writer
+	tty  bool
+	stop chan struct{}
+	done sync.WaitGroup
+	// shown is the width of the line on the terminal, 0 when cleared.
+	shown int
+	// lastRequests and lastTime are the request count and time of the
+	// previous status, for the request rate.
+	lastRequests int
+	lastTime     time.Time
+}
+
+// ShowStatus shows the progress on w until End: on a terminal (tty), as a
+// line redrawn every StatusInterval; otherwise as an info log line every
+// StatusLogInterval. Logs written to w while the line is shown should go
+// through StatusWriter, so they don't run into it.
+func (r *Reporter) ShowStatus(w io.Writer, tty bool) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status != nil || r.ended {
+		return
+	}
+	s := &status{w: w, tty: tty, stop: make(chan struct{}), lastTime: r.now()}
+	r.status = s
+	interval := StatusLogInterval
+	if tty {
+		interval = StatusInterval
+	}
+	s.done.Add(1)
+	go func() {
+		defer s.done.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-t.C:
+				r.mu.Lock()
+				r.showStatus()
+				r.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// CountWaited sets the function reporting the time spent waiting on
+// Slack's rate limits.
+func (r *Reporter) CountWaited(f func() time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.waited = f
+}
+
+// StatusWriter returns w, or when the status line is shown on a terminal, a
+// writer that clears the line before each write to w and redraws it after.
+func (r *Reporter) StatusWriter(w io.Writer) io.Writer {
+	if r == nil {
+		return w
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status == nil || !r.status.tty {
+		return w
+	}
+	return statusWriter{r: r, w: w}
+}
+
+type statusWriter struct {
+	r *Reporter
+	w io.Writer
+}
+
+func (sw statusWriter) Write(p []byte) (int, error) {
+	sw.r.mu.Lock()
+	defer sw.r.mu.Unlock()
+	s := sw.r.status
+	if s == nil {
+		return sw.w.Write(p)
+	}
+	redraw := s.shown > 0
+	s.clear()
+	n, err := sw.w.Write(p)
+	if redraw && !sw.r.ended {
+		sw.r.drawStatus()
+	}
+	return n, err
+}
+
+// showStatus redraws or logs the status. r.mu must be held.
+func (r *Reporter) showStatus() {
+	s := r.status
+	if s == nil || r.ended {
+		return
+	}
+	if s.tty {
+		r.drawStatus()
+		return
+	}
+	args := []any{"stage", r.ev.Stage, "messages", r.ev.Messages, "replies", r.ev.Replies}
+	if r.threadsDone > 0 {
+		args = append(args, "threads", fmt.Sprintf("%d/%d", r.threadsDone, r.threads))
+	}
+	args = append(args, "requests_per_second", fmt.Sprintf("%.1f", r.requestRate()))
+	if f := r.ev.Files; f != nil {
+		args = append(args, "files_remaining", f.Remaining, "download_rate", byteRate(f.BytesPerSecond))
+	}
+	if w := r.waitedFor(); w > 0 {
+		args = append(args, "rate_limited", w.Round(time.Second))
+	}
+	if r.ev.ETASeconds != nil {
+		args = append(args, "percent", fmt.Sprintf("%.0f", *r.ev.Percent), "eta", etaDuration(*r.ev.ETASeconds))
+	}
+	slog.Info("progress", args...)
+}
+
+// drawStatus writes the status line over the previous one. r.mu must be
+// held.
+func (r *Reporter) drawStatus() {
+	s := r.status
+	line := r.statusLine()
+	width := utf8.RuneCountInString(line)
+	pad := max(s.shown-width, 0)
+	fmt.Fprintf(s.w, "\r%s%s", line, strings.Repeat(" ", pad))
+	s.shown = width
+}
+
+// statusLine describes the progress so far, e.g. "dumping: 12034 messages,
+// 3180 replies · threads 412/420 · 4.8 req/s · files 85 left, 1.2 MB/s ·
+// rate-limited 1m30s · 37%, ETA 12m". r.mu must be held.
+func (r *Reporter) statusLine() string {
+	parts := []string{fmt.Sprintf("%s: %d messages, %d replies", r.ev.Stage, r.ev.Messages, r.ev.Replies)}
+	if r.threadsDone > 0 {
+		parts = append(parts, fmt.Sprintf("threads %d/%d", r.threadsDone, r.threads))
+	}
+	parts = append(parts, fmt.Sprintf("%.1f req/s", r.requestRate()))
+	if f := r.ev.Files; f != nil {
+		parts = append(parts, fmt.Sprintf("files %d left, %s", f.Remaining, byteRate(f.BytesPerSecond)))
+	}
+	if w := r.waitedFor(); w > 0 {
+		parts = append(parts, "rate-limited "+w.Round(time.Second).String())
+	}
+	if r.ev.ETASeconds != nil {
+		parts = append(parts, fmt.Sprintf("%.0f%%, ETA %s", *r.ev.Percent, etaDuration(*r.ev.ETASeconds)))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// requestRate returns the requests per second since the previous status.
+// r.mu must be held.
+func (r *Reporter) requestRate() float64 {
+	s := r.status
+	if r.requests == nil {
+		return 0
+	}
+	now, n := r.now(), r.requests()
+	elapsed := now.Sub(s.lastTime).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	rate := float64(n-s.lastRequests) / elapsed
+	s.lastRequests, s.lastTime = n, now
+	return rate
+}
+
+func (r *Reporter) waitedFor() time.Duration {
+	if r.waited == nil {
+		return 0
+	}
+	return r.waited()
+}
+
+// byteRate formats a download rate in binary units, e.g. "1.2 MB/s".
+func byteRate(perSecond float64) string {
+	const unit = 1024
+	if perSecond < unit {
+		return fmt.Sprintf("%.0f B/s", perSecond)
+	}
+	exp := 0
+	for perSecond /= unit; perSecond >= unit && exp < 4; perSecond /= unit {
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB/s", perSecond, "KMGTP"[exp])
+}
+
+// etaDuration rounds an ETA in seconds for display: to the second below a
+// minute, else to the minute, e.g. "45s", "12m", "2h5m".
+func etaDuration(sec float64) string {
+	d := time.Duration(sec * float64(time.Second))
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+}
+
+// clear removes the status line from the terminal.
+func (s *status) clear() {
+	if s.shown == 0 {
+		return
+	}
+	fmt.Fprintf(s.w, "\r%s\r", strings.Repeat(" ", s.shown))
+	s.shown = 0
+}
+
+// HideStatus stops showing the status, clearing the line, before a run
+// prints its own ending.
+func (r *Reporter) HideStatus() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopStatus()
+}
+
+// stopStatus stops showing the status and clears the line. r.mu must be
+// held; it is released while the redrawing goroutine exits.
+func (r *Reporter) stopStatus() {
+	s := r.status
+	if s == nil {
+		return
+	}
+	close(s.stop)
+	r.mu.Unlock()
+	s.done.Wait()
+	r.mu.Lock()
+	s.clear()
+	r.status = nil
+}
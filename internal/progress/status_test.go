@@ -0,0 +1,82 @@
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestStatusLine(t *testing.T) {
+	now := time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)
+	r := New(nil)
+	r.now = func() time.Time { return now }
+	requests := 0
+	r.CountRequests(func() int { return requests })
+	r.CountWaited(func() time.Duration { return 90 * time.Second })
+	var out bytes.Buffer
+	r.ShowStatus(&out, true)
+	defer r.End(nil)
+
+	r.Stage(StageDumping)
+	r.DumpRange(now.AddDate(0, 0, -10), now)
+	msg := func(day, replyCount, replies int) types.Message {
+		m := types.Message{Message: slack.Message{Msg: slack.Msg{Timestamp: fmt.Sprintf("%d.000000", now.AddDate(0, 0, -day).Unix()), ReplyCount: replyCount}}}
+		m.ThreadReplies = make([]types.Message, replies)
+		return m
+	}
+	now = now.Add(time.Minute)
+	r.Fetched([]types.Message{msg(1, 2, 2), msg(2, 3, 0), msg(4, 0, 0)})
+	requests = 30
+	now = now.Add(time.Minute)
+
+	r.mu.Lock()
+	got := r.statusLine()
+	r.mu.Unlock()
+	if want := "dumping: 3 messages, 2 replies · threads 1/2 · 0.2 req/s · rate-limited 1m30s · 40%, ETA 2m"; got != want {
+		t.Errorf("statusLine() =\n%q, want\n%q", got, want)
+	}
+	if out.Len() != 0 {
+		t.Errorf("the stream was written to: %q", out.String())
+	}
+}
+
+func TestStatusWriter(t *testing.T) {
+	r := New(nil)
+	var out bytes.Buffer
+	r.ShowStatus(&out, true)
+	r.Stage(StageDumping)
+	r.mu.Lock()
+	r.drawStatus()
+	r.mu.Unlock()
+	line := out.String()
+
+	fmt.Fprintln(r.StatusWriter(&out), "level=INFO msg=hello")
+	got := out.String()[len(line):]
+	clear := "\r" + strings.Repeat(" ", len([]rune(line))-1) + "\r"
+	if !strings.HasPrefix(got, clear+"level=INFO msg=hello\n\r") {
+		t.Errorf("a log line doesn't clear the status and redraw it after: %q", got)
+	}
+
+	r.End(nil)
+	if !strings.HasSuffix(out.String(), clear) {
+		t.Errorf("End left the status line: %q", out.String())
+	}
+	if w := r.StatusWriter(&out); w != &out {
+		t.Error("StatusWriter wraps the writer after End")
+	}
+}
+
+func TestStatusNotTerminal(t *testing.T) {
+	r := New(nil)
+	var out bytes.Buffer
+	r.ShowStatus(&out, false)
+	defer r.End(nil)
+	if w := r.StatusWriter(&out); w != &out {
+		t.Error("StatusWriter wraps the writer when stderr isn't a terminal")
+	}
+}
@@ -0,0 +1,129 @@
+package redact
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// mask replaces a redacted value.
+const mask = "REDACTED"
+
+var (
+	// tokenRE matches Slack tokens and cookie values: xoxc- API tokens,
+	// xoxd- session cookies, and the other xox*- types.
+	tokenRE = regexp.MustCompile(`(xox[a-z])-\S+`)
+	// cookieRE matches a d= cookie pair, e.g. in a Cookie header.
+	cookieRE = regexp.MustCompile(`\bd=[^;\s]+`)
+)
+
+var (
+	mu      sync.RWMutex
+	secrets []string
+)
+
+// minSecretLen keeps short values, which would mask unrelated text, out of
+// the registry.
+const minSecretLen = 8
+
+// Secret registers a value that doesn't follow a known format, such as the
+// Keychain password, to be masked wherever it appears.
+func Secret(v string) {
+	if len(v) < minSecretLen {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, s := range secrets {
+		if s == v {
+			return
+		}
+	}
+	secrets = append(secrets, v)
+}
+
+// String masks Slack tokens, d= cookie values and registered secrets in s.
+func String(s string) string {
+	mu.RLock()
+	for _, v := range secrets {
+		s = strings.ReplaceAll(s, v, mask)
+	}
+	mu.RUnlock()
+	s = tokenRE.ReplaceAllString(s, "$1-"+mask)
+	return cookieRE.ReplaceAllString(s, "d="+mask)
+}
+
+// Error returns err with its message masked by String. errors.Is and
+// errors.As see through it to err.
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{err: err}
+}
+
+type redactedError struct{ err error }
+
+func (e *redactedError) Error() string { return String(e.err.Error()) }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// Handler masks the message and attribute values of every record before
+// passing it on.
+type Handler struct {
+	next slog.Handler
+}
+
+// NewHandler returns a Handler logging to next.
+func NewHandler(next slog.Handler) *Handler {
+	return &Handler{next: next}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, String(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(attr(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		masked[i] = attr(a)
+	}
+	return &Handler{next: h.next.WithAttrs(masked)}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: h.next.WithGroup(name)}
+}
+
+// attr masks an attribute's value. Values that aren't strings are masked in
+// their formatted form, so errors and Stringers are covered too.
+func attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, String(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		masked := make([]any, len(group))
+		for i, g := range group {
+			masked[i] = attr(g)
+		}
+		return slog.Group(a.Key, masked...)
+	case slog.KindAny:
+		if s := fmt.Sprint(v.Any()); s != String(s) {
+			return slog.String(a.Key, String(s))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
@@ -0,0 +1,93 @@
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const (
+	token  = "xoxc-1234567890-0987654321-abcdef"
+	cookie = "xoxd-AbC%2FdEf%2BgHi%3D"
+)
+
+func TestString(t *testing.T) {
+	Secret("peanuts-keychain-password")
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"token", "token " + token + " rejected", "token xoxc-REDACTED rejected"},
+		{"cookie value", "cookie " + cookie, "cookie xoxd-REDACTED"},
+		{"cookie header", "Cookie: d=abc123; d-s=1700000000", "Cookie: d=REDACTED; d-s=1700000000"},
+		{"query parameter", "https://acme.slack.com/?id=7&d=abc123", "https://acme.slack.com/?id=7&d=REDACTED"},
+		{"registered secret", "password peanuts-keychain-password", "password REDACTED"},
+		{"nothing to mask", "channel C012345 not found", "channel C012345 not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := String(tt.in); got != tt.want {
+				t.Errorf("String(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretIgnoresShortValues(t *testing.T) {
+	Secret("ok")
+	if got := String("ok, done"); got != "ok, done" {
+		t.Errorf("String() = %q, want short secrets left alone", got)
+	}
+}
+
+func TestError(t *testing.T) {
+	if Error(nil) != nil {
+		t.Error("Error(nil) != nil")
+	}
+
+	// A failed API call during a dump reports the request URL.
+	sentinel := errors.New("EOF")
+	dumpErr := fmt.Errorf("dumping C012345: %w", &url.Error{
+		Op:  "Post",
+		URL: "https://slack.com/api/conversations.replies?token=" + token,
+		Err: sentinel,
+	})
+	err := Error(dumpErr)
+	if strings.Contains(err.Error(), token) {
+		t.Errorf("Error() = %q, contains the token", err)
+	}
+	if !errors.Is(err, sentinel) {
+		t.Error("errors.Is() doesn't see through the redacted error")
+	}
+	var ue *url.Error
+	if !errors.As(err, &ue) {
+		t.Error("errors.As() doesn't see through the redacted error")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(slog.NewTextHandler(&buf, nil)))
+	logger.With("cookie", cookie).
+		WithGroup("req").
+		Info("exchanging "+token,
+			"header", "d="+cookie,
+			"error", errors.New("bad token "+token),
+			slog.Group("auth", "token", token),
+			"count", 3)
+
+	out := buf.String()
+	for _, secret := range []string{token, cookie, "1234567890"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log output contains %q:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "req.count=3") {
+		t.Errorf("log output lost an attribute:\n%s", out)
+	}
+}
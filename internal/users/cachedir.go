@@ -0,0 +1,93 @@
+package users
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/cli/go-gh/v2/pkg/config"
+)
+
+// CacheDirEnv names the environment variable that overrides the cache
+// directory, as --cache-dir does.
+const CacheDirEnv = "GH_SLACKDUMP_CACHE_DIR"
+
+// cacheOverride is the --cache-dir flag, set with SetCacheDir.
+var cacheOverride string
+
+// SetCacheDir makes dir the cache directory, ahead of CacheDirEnv and the
+// platform default.
+func SetCacheDir(dir string) {
+	cacheOverride = dir
+}
+
+// CacheRoot returns the directory gh-slackdump caches user lists in, one
+// subdirectory per workspace host. On first use after the default moved
+// from the gh CLI's cache directory, the old cache is copied over.
+func CacheRoot() string {
+	return migrateCache(locateCache(cacheOverride, runtime.GOOS))
+}
+
+// locateCache returns the cache directory and, when it is the platform
+// default, the legacy directory to migrate from. The order is the explicit
+// dir, CacheDirEnv, then on platforms other than macOS the XDG cache
+// directory ($XDG_CACHE_HOME, else ~/.cache), and finally the gh CLI's
+// cache directory, where caches lived before and still do on macOS.
+func locateCache(explicit, goos string) (dir, legacy string) {
+	if explicit != "" {
+		return explicit, ""
+	}
+	if env := os.Getenv(CacheDirEnv); env != "" {
+		return env, ""
+	}
+	legacy = filepath.Join(config.CacheDir(), "slackdump")
+	if goos == "darwin" {
+		return legacy, ""
+	}
+	base := os.Getenv("XDG_CACHE_HOME")
+	if base == "" {
+		var err error
+		if base, err = os.UserCacheDir(); err != nil {
+			return legacy, ""
+		}
+	}
+	return filepath.Join(base, "gh-slackdump"), legacy
+}
+
+// migrateCache returns dir, first copying legacy into it if legacy exists
+// and dir doesn't yet. The copy goes through a temporary directory renamed
+// into place, so an interrupted copy is redone on the next run. If copying
+// fails, legacy is used for this run.
+func migrateCache(dir, legacy string) string {
+	if legacy == "" {
+		return dir
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+		return dir
+	}
+	if fi, err := os.Stat(legacy); err != nil || !fi.IsDir() {
+		return dir
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		slog.Warn("can't migrate user cache, using the old location", "from", legacy, "to", dir, "error", err)
+		return legacy
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+".tmp*")
+	if err == nil {
+		if err = os.CopyFS(tmp, os.DirFS(legacy)); err == nil {
+			err = os.Rename(tmp, dir)
+		}
+		if err != nil {
+			os.RemoveAll(tmp)
+		}
+	}
+	if err != nil {
+		slog.Warn("can't migrate user cache, using the old location", "from", legacy, "to", dir, "error", err)
+		return legacy
+	}
+	slog.Info("migrated user cache", "from", legacy, "to", dir)
+	return dir
+}
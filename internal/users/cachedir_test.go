@@ -0,0 +1,79 @@
+package users
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocateCache(t *testing.T) {
+	xdg := t.TempDir()
+	legacy := filepath.Join(xdg, "gh", "slackdump")
+	tests := []struct {
+		name           string
+		explicit, env  string
+		goos           string
+		wantDir, wantL string
+	}{
+		{"flag wins", "/flag", "/env", "linux", "/flag", ""},
+		{"env next", "", "/env", "linux", "/env", ""},
+		{"XDG on Linux", "", "", "linux", filepath.Join(xdg, "gh-slackdump"), legacy},
+		{"gh location on macOS", "", "", "darwin", legacy, ""},
+		{"flag on macOS", "/flag", "", "darwin", "/flag", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", xdg)
+			t.Setenv(CacheDirEnv, tt.env)
+			dir, l := locateCache(tt.explicit, tt.goos)
+			if dir != tt.wantDir || l != tt.wantL {
+				t.Errorf("locateCache() = %q, %q; want %q, %q", dir, l, tt.wantDir, tt.wantL)
+			}
+		})
+	}
+}
+
+func TestMigrateCache(t *testing.T) {
+	root := t.TempDir()
+	legacy := filepath.Join(root, "gh", "slackdump")
+	dir := filepath.Join(root, "gh-slackdump")
+	old := filepath.Join(legacy, "example.slack.com", "users.json")
+	if err := os.MkdirAll(filepath.Dir(old), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(old, []byte(`[{"id":"U1","name":"alice"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := migrateCache(dir, legacy); got != dir {
+		t.Fatalf("migrateCache() = %q, want %q", got, dir)
+	}
+	m, err := loadCache(filepath.Join(dir, "example.slack.com", "users.json"))
+	if err != nil || m["U1"] != "alice" {
+		t.Fatalf("migrated cache = %v, %v; want alice", m, err)
+	}
+	if _, err := os.Stat(old); err != nil {
+		t.Errorf("the old cache was not kept: %v", err)
+	}
+
+	// Once the new directory exists, the old one is not copied again.
+	if err := os.WriteFile(old, []byte(`[{"id":"U1","name":"bob"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	migrateCache(dir, legacy)
+	if m, _ := loadCache(filepath.Join(dir, "example.slack.com", "users.json")); m["U1"] != "alice" {
+		t.Errorf("cache migrated twice: %v", m)
+	}
+}
+
+func TestMigrateCacheWithoutLegacy(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv(CacheDirEnv, "")
+	dir, _ := locateCache("", "linux")
+	if got := migrateCache(locateCache("", "linux")); got != dir {
+		t.Errorf("migrateCache() = %q, want the new location %q", got, dir)
+	}
+	if _, err := os.Stat(dir); err == nil {
+		t.Error("an empty cache directory was created with nothing to migrate")
+	}
+}
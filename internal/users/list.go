@@ -0,0 +1,175 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/auth"
+	"github.com/wham/gh-slackdump/internal/logging"
+)
+
+const (
+	// pageLimit is the users.list page size.
+	pageLimit = 200
+	// checkpointMaxAge is how old a checkpoint may be to resume from it.
+	checkpointMaxAge = time.Hour
+)
+
+// checkpointPages is how many pages are fetched between checkpoints. Tests
+// lower it.
+var checkpointPages = 10
+
+// rateLimitBackoff is the first wait after a 429 without Retry-After. It
+// doubles on each such 429 in a row, up to rateLimitMaxBackoff. Tests lower
+// it.
+var rateLimitBackoff = time.Second
+
+// rateLimitMaxBackoff caps the wait after a 429 without Retry-After.
+const rateLimitMaxBackoff = time.Minute
+
+// Client calls users.list itself rather than through slack's
+// UserPagination, which doesn't expose the cursor needed to resume an
+// interrupted fetch.
+type Client struct {
+	http   *http.Client
+	token  string
+	apiURL string
+}
+
+// NewClient returns a users.list client for an authenticated session.
+// slack.com is used for every workspace; the provider's HTTP client reroutes
+// it for GovSlack.
+func NewClient(prov auth.Provider) (*Client, error) {
+	hc, err := prov.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	return &Client{http: hc, token: prov.SlackToken(), apiURL: slack.APIURL}, nil
+}
+
+// checkpoint is the progress of an interrupted users.list fetch.
+type checkpoint struct {
+	Cursor  string       `json:"cursor"`
+	SavedAt time.Time    `json:"saved_at"`
+	Users   []CachedUser `json:"users"`
+}
+
+// fetchUsers fetches all users page by page, respecting Slack rate limits.
+// Every checkpointPages pages the cursor and the users so far are saved to
+// partialPath; a checkpoint younger than checkpointMaxAge is resumed from
+// instead of starting over. The caller removes it once the cache is written.
+func (c *Client) fetchUsers(ctx context.Context, partialPath string) ([]CachedUser, error) {
+	var all []CachedUser
+	cursor := ""
+	if cp, err := loadCheckpoint(partialPath); err == nil && time.Since(cp.SavedAt) < checkpointMaxAge && cp.Cursor != "" {
+		all, cursor = cp.Users, cp.Cursor
+		slog.Info("resuming user fetch", "checkpoint", partialPath, "users", len(all), "saved_at", cp.SavedAt)
+	}
+
+	seen := make(map[string]bool, len(all))
+	for _, u := range all {
+		seen[u.ID] = true
+	}
+	backoff := rateLimitBackoff
+	for page := 1; ; page++ {
+		members, next, err := c.usersPage(ctx, cursor)
+		if err != nil {
+			var rl *slack.RateLimitedError
+			if errors.As(err, &rl) {
+				wait := rl.RetryAfter
+				if wait <= 0 {
+					wait = backoff
+					backoff = min(2*backoff, rateLimitMaxBackoff)
+				}
+				slog.Info("rate limited, waiting", "retry_after", wait)
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(wait):
+				}
+				page--
+				continue
+			}
+			return nil, err
+		}
+		backoff = rateLimitBackoff
+		for _, u := range members {
+			if u.Name == "" || seen[u.ID] {
+				continue
+			}
+			seen[u.ID] = true
+			all = append(all, CachedUser{ID: u.ID, Name: u.Name, Avatar: u.Profile.Image72})
+		}
+		logging.Frequent(slog.Default()).Info("fetching users", "page", page, "fetched", len(members), "total", len(all))
+		if next == "" {
+			return all, nil
+		}
+		cursor = next
+		if page%checkpointPages == 0 {
+			if err := writeJSONAtomic(partialPath, checkpoint{Cursor: cursor, SavedAt: time.Now(), Users: all}); err != nil {
+				slog.Warn("can't save user fetch checkpoint", "path", partialPath, "error", err)
+			}
+		}
+	}
+}
+
+// usersPage fetches the users.list page at cursor and returns its members
+// and the next cursor, empty on the last page.
+func (c *Client) usersPage(ctx context.Context, cursor string) ([]slack.User, string, error) {
+	form := url.Values{
+		"token":  {c.token},
+		"limit":  {strconv.Itoa(pageLimit)},
+		"cursor": {cursor},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL+"users.list", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retry, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return nil, "", &slack.RateLimitedError{RetryAfter: time.Duration(retry) * time.Second}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("users.list: %w", slack.StatusCodeError{Code: resp.StatusCode, Status: resp.Status})
+	}
+	var body struct {
+		slack.SlackResponse
+		Members []slack.User `json:"members"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, "", fmt.Errorf("users.list: %w", err)
+	}
+	if err := body.Err(); err != nil {
+		return nil, "", fmt.Errorf("users.list: %w", err)
+	}
+	return body.Members, body.ResponseMetadata.Cursor, nil
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
@@ -0,0 +1,235 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wham/gh-slackdump/internal/errs"
+)
+
+// usersServer serves users.list in pages of two users, failing once with a
+// 500 at failAt (a 1-based page number, 0 for never).
+type usersServer struct {
+	pages  int
+	failAt int
+
+	mu      sync.Mutex
+	cursors []string
+}
+
+func (s *usersServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/users.list" || r.FormValue("token") != "xoxc-token" {
+		http.NotFound(w, r)
+		return
+	}
+	cursor := r.FormValue("cursor")
+	page := 1
+	if cursor != "" {
+		fmt.Sscanf(cursor, "page%d", &page)
+	}
+	s.mu.Lock()
+	s.cursors = append(s.cursors, cursor)
+	if page == s.failAt {
+		s.failAt = 0
+		s.mu.Unlock()
+		http.Error(w, "boom", http.StatusInternalServerError)
+		return
+	}
+	s.mu.Unlock()
+
+	next := ""
+	if page < s.pages {
+		next = fmt.Sprintf("page%d", page+1)
+	}
+	members := []map[string]string{
+		{"id": fmt.Sprintf("U%d", 2*page-1), "name": fmt.Sprintf("user%d", 2*page-1)},
+		{"id": fmt.Sprintf("U%d", 2*page), "name": fmt.Sprintf("user%d", 2*page)},
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"ok":                true,
+		"members":           members,
+		"response_metadata": map[string]string{"next_cursor": next},
+	})
+}
+
+func wantUserIDs(n int) []string {
+	var ids []string
+	for i := 1; i <= n; i++ {
+		ids = append(ids, fmt.Sprintf("U%d", i))
+	}
+	return ids
+}
+
+func userIDs(users []CachedUser) []string {
+	var ids []string
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	return ids
+}
+
+func TestFetchUsersResumesFromCheckpoint(t *testing.T) {
+	old := checkpointPages
+	checkpointPages = 2
+	defer func() { checkpointPages = old }()
+
+	srv := &usersServer{pages: 5, failAt: 4}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	c := &Client{http: ts.Client(), token: "xoxc-token", apiURL: ts.URL + "/"}
+	partial := filepath.Join(t.TempDir(), "users.partial.json")
+
+	if _, err := c.fetchUsers(context.Background(), partial); err == nil {
+		t.Fatal("first fetch succeeded, want the page 4 failure")
+	}
+	cp, err := loadCheckpoint(partial)
+	if err != nil {
+		t.Fatalf("no checkpoint after the interruption: %v", err)
+	}
+	if cp.Cursor != "page3" || len(cp.Users) != 4 {
+		t.Fatalf("checkpoint = cursor %q with %d users, want page3 with 4", cp.Cursor, len(cp.Users))
+	}
+
+	srv.cursors = nil
+	users, err := c.fetchUsers(context.Background(), partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"page3", "page4", "page5"}; !slices.Equal(srv.cursors, want) {
+		t.Errorf("resumed fetch requested %v, want %v", srv.cursors, want)
+	}
+	if got, want := userIDs(users), wantUserIDs(10); !slices.Equal(got, want) {
+		t.Errorf("users = %v, want %v without duplicates or gaps", got, want)
+	}
+}
+
+func TestFetchUsersIgnoresStaleCheckpoint(t *testing.T) {
+	srv := &usersServer{pages: 2}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	c := &Client{http: ts.Client(), token: "xoxc-token", apiURL: ts.URL + "/"}
+	partial := filepath.Join(t.TempDir(), "users.partial.json")
+	stale := checkpoint{Cursor: "page2", SavedAt: time.Now().Add(-2 * checkpointMaxAge), Users: []CachedUser{{ID: "U1", Name: "old"}}}
+	if err := writeJSONAtomic(partial, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := c.fetchUsers(context.Background(), partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.cursors[0] != "" {
+		t.Errorf("fetch started at cursor %q, want the first page", srv.cursors[0])
+	}
+	if got, want := userIDs(users), wantUserIDs(4); !slices.Equal(got, want) {
+		t.Errorf("users = %v, want %v", got, want)
+	}
+	if users[0].Name != "user1" {
+		t.Errorf("users[0] = %+v, want the fresh user1", users[0])
+	}
+}
+
+func TestFetchUsersBacksOffWithoutRetryAfter(t *testing.T) {
+	old := rateLimitBackoff
+	rateLimitBackoff = 20 * time.Millisecond
+	defer func() { rateLimitBackoff = old }()
+
+	srv := &usersServer{pages: 2}
+	var limited int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limited < 2 {
+			limited++
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	c := &Client{http: ts.Client(), token: "xoxc-token", apiURL: ts.URL + "/"}
+
+	start := time.Now()
+	users, err := c.fetchUsers(context.Background(), filepath.Join(t.TempDir(), "users.partial.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two 429s in a row wait 20ms, then 40ms.
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("fetch took %v, want at least 60ms of backoff", elapsed)
+	}
+	if got, want := userIDs(users), wantUserIDs(4); !slices.Equal(got, want) {
+		t.Errorf("users = %v, want %v", got, want)
+	}
+}
+
+func TestWriteJSONAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "users.json")
+	if err := writeJSONAtomic(path, []CachedUser{{ID: "U1", Name: "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadCache(path)
+	if err != nil || m["U1"] != "alice" {
+		t.Errorf("loadCache() = %v, %v, want U1 → alice", m, err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only users.json", len(entries))
+	}
+}
+
+func TestAvatars(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	path, err := cachePath("https://example.slack.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := []CachedUser{{ID: "U1", Name: "alice", Avatar: "https://avatars.example/a.png"}, {ID: "U2", Name: "bob"}}
+	if err := writeJSONAtomic(path, cached); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Avatars("https://example.slack.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["U1"] != cached[0].Avatar || m["alice"] != cached[0].Avatar || len(m) != 2 {
+		t.Errorf("Avatars() = %v, want alice's avatar under U1 and alice only", m)
+	}
+}
+
+func TestLoadOrFetchUsersClassifiesErrors(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv(CacheDirEnv, "")
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    error
+	}{
+		{"invalid-auth", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"ok":false,"error":"invalid_auth"}`)
+		}, errs.ErrAuth},
+		{"forbidden", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "no", http.StatusForbidden)
+		}, errs.ErrAuth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(tt.handler)
+			defer ts.Close()
+			c := &Client{http: ts.Client(), token: "xoxc-token", apiURL: ts.URL + "/"}
+			_, err := LoadOrFetchUsers(context.Background(), c, "https://"+tt.name+".slack.com", false)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("LoadOrFetchUsers() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
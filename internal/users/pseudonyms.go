@@ -0,0 +1,153 @@
+package users
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rusq/slack"
+)
+
+// Pseudonyms replaces user IDs with stable pseudonyms, user-1, user-2 and
+// on, numbered in the order the users first appear, so the same messages
+// always get the same pseudonyms. Its scrub also drops the profile fields
+// Slack copies into messages. System identities, Slackbot and the bot users
+// of workflows and apps, keep their IDs. It is safe for concurrent use.
+type Pseudonyms struct {
+	handles HandleMap
+
+	mu sync.Mutex
+	// byID maps user IDs to pseudonyms, ids the other way.
+	byID map[string]string
+	ids  map[string]string
+	// kept holds the user IDs left as they are.
+	kept map[string]bool
+}
+
+// SystemUsers are the user IDs Pseudonyms always keep: Slackbot.
+var SystemUsers = []string{"USLACKBOT"}
+
+// Pseudonym is who a pseudonym stands for: the user ID, and the handle
+// when the handles were loaded.
+type Pseudonym struct {
+	ID     string `json:"id"`
+	Handle string `json:"handle,omitempty"`
+}
+
+// NewPseudonyms returns empty Pseudonyms that keep the SystemUsers and the
+// keep user IDs as they are. handles, which may be nil, only names the
+// users in Mapping.
+func NewPseudonyms(handles HandleMap, keep ...string) *Pseudonyms {
+	p := &Pseudonyms{handles: handles, byID: make(map[string]string), ids: make(map[string]string), kept: make(map[string]bool)}
+	for _, id := range slices.Concat(SystemUsers, keep) {
+		p.kept[id] = true
+	}
+	return p
+}
+
+// IsUserID reports whether s is shaped like a user ID.
+func IsUserID(s string) bool {
+	return userIDRe.MatchString(s)
+}
+
+// userIDRe matches user IDs, so names in fields that hold either, such as
+// an attachment's author_subname, aren't taken for users.
+var userIDRe = regexp.MustCompile(`^[UW][A-Z0-9]{2,}$`)
+
+// lookup returns the user's pseudonym, giving it the next one the first
+// time. A pseudonym stands for itself, so resolving twice is harmless.
+func (p *Pseudonyms) lookup(id string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.ids[id]; ok {
+		return id, true
+	}
+	if p.kept[id] || !userIDRe.MatchString(id) {
+		return "", false
+	}
+	name, ok := p.byID[id]
+	if !ok {
+		name = "user-" + strconv.Itoa(len(p.byID)+1)
+		p.byID[id], p.ids[name] = name, id
+	}
+	return name, true
+}
+
+// enter keeps the bot user of a message with a bot_profile, as workflows
+// and apps post, unless it already has a pseudonym, so no user gets both.
+func (p *Pseudonyms) enter(msg *slack.Msg) {
+	if msg.BotProfile == nil || msg.User == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.ids[msg.User]; !ok {
+		p.kept[msg.User] = true
+	}
+}
+
+// scrub replaces the user IDs the handles leave, of files, comments,
+// replies and channel members, and clears the names, avatars and profile
+// links of users: usernames of messages not from bots or kept users, and
+// the author of shared messages, its subname too unless it was a user ID.
+func (p *Pseudonyms) scrub(msg *slack.Msg) {
+	if msg.BotID == "" && !p.isKept(msg.User) {
+		msg.Username = ""
+	}
+	for i, id := range msg.Members {
+		msg.Members[i] = resolve(p, id)
+	}
+	for i := range msg.Replies {
+		msg.Replies[i].User = resolve(p, msg.Replies[i].User)
+	}
+	if msg.Comment != nil {
+		msg.Comment.User = resolve(p, msg.Comment.User)
+	}
+	for i := range msg.Files {
+		f := &msg.Files[i]
+		if id := f.User; id != "" {
+			// Permalinks name the uploader: /files/<user ID>/<file ID>/.
+			f.User = resolve(p, id)
+			f.Permalink = strings.Replace(f.Permalink, "/"+id+"/", "/"+f.User+"/", 1)
+			f.PermalinkPublic = strings.Replace(f.PermalinkPublic, "/"+id+"/", "/"+f.User+"/", 1)
+		}
+		f.From, f.To, f.Cc = nil, nil, nil
+	}
+	for i := range msg.Attachments {
+		a := &msg.Attachments[i]
+		if a.AuthorID == "" || p.isKept(a.AuthorID) {
+			continue
+		}
+		a.AuthorName, a.AuthorIcon, a.AuthorLink = "", "", ""
+		if !p.isPseudonym(a.AuthorSubname) {
+			a.AuthorSubname = ""
+		}
+	}
+}
+
+func (p *Pseudonyms) isKept(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.kept[id]
+}
+
+func (p *Pseudonyms) isPseudonym(s string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.ids[s]
+	return ok
+}
+
+// Mapping returns who each pseudonym given so far stands for. Kept users
+// have no pseudonym, so they aren't in it.
+func (p *Pseudonyms) Mapping() map[string]Pseudonym {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m := make(map[string]Pseudonym, len(p.ids))
+	for name, id := range p.ids {
+		m[name] = Pseudonym{ID: id, Handle: p.handles[id]}
+	}
+	return m
+}
@@ -0,0 +1,152 @@
+package users
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func pseudonymConversation() *types.Conversation {
+	return &types.Conversation{Messages: []types.Message{
+		{
+			Message: slack.Message{Msg: slack.Msg{
+				User:     "U002",
+				Username: "bob.smith",
+				Text:     "Hello <@U001>",
+				Reactions: []slack.ItemReaction{
+					{Name: "eyes", Users: []string{"U003", "U002"}},
+				},
+				ReplyUsers: []string{"U001"},
+				Files: []slack.File{{
+					User:      "U002",
+					Permalink: "https://acme.slack.com/files/U002/F001/notes.txt",
+				}},
+				Attachments: []slack.Attachment{{
+					AuthorID:      "U003",
+					AuthorName:    "Charlie Brown",
+					AuthorSubname: "Charlie Brown",
+					AuthorIcon:    "https://avatars.slack-edge.com/charlie.png",
+					AuthorLink:    "https://acme.slack.com/team/U003",
+					Text:          "shared",
+				}},
+			}},
+			ThreadReplies: []types.Message{{Message: slack.Message{Msg: slack.Msg{
+				User:   "U001",
+				Text:   "Thanks <@U002>",
+				Blocks: slack.Blocks{BlockSet: []slack.Block{slack.NewRichTextBlock("b", slack.NewRichTextSection(slack.NewRichTextSectionUserElement("U003", nil)))}},
+			}}}},
+		},
+		{Message: slack.Message{Msg: slack.Msg{
+			BotID:    "B001",
+			Username: "deploybot",
+			Text:     "deployed",
+		}}},
+	}}
+}
+
+func TestPseudonyms(t *testing.T) {
+	conv := pseudonymConversation()
+	p := NewPseudonyms(HandleMap{"U001": "alice"})
+	ResolveConversation(conv, p)
+
+	msg := conv.Messages[0]
+	if msg.User != "user-1" || msg.Text != "Hello @user-2" {
+		t.Errorf("User, Text = %q, %q; want user-1, Hello @user-2", msg.User, msg.Text)
+	}
+	if got := msg.Reactions[0].Users; !reflect.DeepEqual(got, []string{"user-3", "user-1"}) {
+		t.Errorf("Reactions.Users = %v, want [user-3 user-1]", got)
+	}
+	if msg.Username != "" {
+		t.Errorf("Username = %q, want it cleared", msg.Username)
+	}
+	if f := msg.Files[0]; f.User != "user-1" || f.Permalink != "https://acme.slack.com/files/user-1/F001/notes.txt" {
+		t.Errorf("file = %q, %q; want user-1 in both", f.User, f.Permalink)
+	}
+	att := msg.Attachments[0]
+	if att.AuthorID != "user-3" || att.AuthorName != "" || att.AuthorSubname != "" || att.AuthorIcon != "" || att.AuthorLink != "" {
+		t.Errorf("attachment author = %+v, want only the pseudonym", att)
+	}
+	reply := msg.ThreadReplies[0]
+	if reply.User != "user-2" || reply.Text != "Thanks @user-1" {
+		t.Errorf("reply User, Text = %q, %q; want user-2, Thanks @user-1", reply.User, reply.Text)
+	}
+	ue := reply.Blocks.BlockSet[0].(*slack.RichTextBlock).Elements[0].(*slack.RichTextSection).Elements[0].(*slack.RichTextSectionUserElement)
+	if ue.UserID != "user-3" {
+		t.Errorf("rich-text user = %q, want user-3", ue.UserID)
+	}
+	if bot := conv.Messages[1]; bot.Username != "deploybot" {
+		t.Errorf("bot Username = %q, want it kept", bot.Username)
+	}
+
+	want := map[string]Pseudonym{
+		"user-1": {ID: "U002"},
+		"user-2": {ID: "U001", Handle: "alice"},
+		"user-3": {ID: "U003"},
+	}
+	if got := p.Mapping(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Mapping() = %v, want %v", got, want)
+	}
+}
+
+func TestPseudonymsStable(t *testing.T) {
+	a, b := pseudonymConversation(), pseudonymConversation()
+	ResolveConversation(a, NewPseudonyms(nil))
+	ResolveConversation(b, NewPseudonyms(nil))
+	if !reflect.DeepEqual(a, b) {
+		t.Error("the same messages got different pseudonyms")
+	}
+
+	// Resolving again, as a writer might, keeps the pseudonyms.
+	c, p := pseudonymConversation(), NewPseudonyms(nil)
+	ResolveConversation(c, p)
+	ResolveConversation(c, p)
+	if c.Messages[0].User != "user-1" || len(p.Mapping()) != 3 {
+		t.Errorf("resolving twice: User = %q, %d pseudonyms; want user-1, 3", c.Messages[0].User, len(p.Mapping()))
+	}
+}
+
+func TestPseudonymsKeepSystemUsers(t *testing.T) {
+	conv := &types.Conversation{Messages: []types.Message{
+		{Message: slack.Message{Msg: slack.Msg{
+			User: "USLACKBOT",
+			Text: "Reminder: standup for <@U001>",
+		}}},
+		{Message: slack.Message{Msg: slack.Msg{
+			User:       "U0WORKFLOW",
+			BotID:      "B001",
+			BotProfile: &slack.BotProfile{ID: "B001", Name: "Standup Workflow"},
+			Username:   "Standup Workflow",
+			Text:       "<@U001> posted an update",
+		}}},
+		{Message: slack.Message{Msg: slack.Msg{
+			User: "U0ALERTS",
+			Text: "disk full, cc <@U0WORKFLOW>",
+			Reactions: []slack.ItemReaction{
+				{Name: "eyes", Users: []string{"U001", "USLACKBOT"}},
+			},
+		}}},
+	}}
+	p := NewPseudonyms(nil, "U0ALERTS")
+	ResolveConversation(conv, p)
+
+	for i, want := range []struct{ user, text string }{
+		{"USLACKBOT", "Reminder: standup for @user-1"},
+		{"U0WORKFLOW", "@user-1 posted an update"},
+		{"U0ALERTS", "disk full, cc <@U0WORKFLOW>"},
+	} {
+		if msg := conv.Messages[i]; msg.User != want.user || msg.Text != want.text {
+			t.Errorf("message %d: User, Text = %q, %q; want %q, %q", i, msg.User, msg.Text, want.user, want.text)
+		}
+	}
+	if got := conv.Messages[1].Username; got != "Standup Workflow" {
+		t.Errorf("workflow Username = %q, want it kept", got)
+	}
+	if got := conv.Messages[2].Reactions[0].Users; !reflect.DeepEqual(got, []string{"user-1", "USLACKBOT"}) {
+		t.Errorf("Reactions.Users = %v, want [user-1 USLACKBOT]", got)
+	}
+	if got, want := p.Mapping(), map[string]Pseudonym{"user-1": {ID: "U001"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Mapping() = %v, want %v", got, want)
+	}
+}
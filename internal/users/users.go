@@ -3,7 +3,6 @@ package users
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log/slog"
 	"net/url"
@@ -11,18 +10,20 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
-	"time"
 
-	"github.com/cli/go-gh/v2/pkg/config"
 	"github.com/rusq/slack"
-	"github.com/rusq/slackdump/v3"
 	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/errs"
+	"github.com/wham/gh-slackdump/internal/walk"
 )
 
-// CachedUser stores only the user ID and Slack handle.
+// CachedUser stores the user ID, Slack handle and avatar URL.
 type CachedUser struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
+	// Avatar is the 72px profile image; caches written before it was added
+	// lack it until re-fetched.
+	Avatar string `json:"avatar,omitempty"`
 }
 
 // HandleMap maps user IDs to Slack handles.
@@ -34,7 +35,7 @@ func cacheDir(workspaceURL string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(config.CacheDir(), "slackdump", u.Hostname()), nil
+	return filepath.Join(CacheRoot(), u.Hostname()), nil
 }
 
 // cachePath returns the full path to users.json for a workspace.
@@ -48,17 +49,26 @@ func cachePath(workspaceURL string) (string, error) {
 
 // LoadOrFetch loads users from cache, or fetches from the API if the cache
 // doesn't exist or force is true. Returns the handle map.
-func LoadOrFetch(ctx context.Context, sd *slackdump.Session, workspaceURL string, force bool) (HandleMap, error) {
+func LoadOrFetch(ctx context.Context, c *Client, workspaceURL string, force bool) (HandleMap, error) {
+	users, err := LoadOrFetchUsers(ctx, c, workspaceURL, force)
+	if err != nil {
+		return nil, err
+	}
+	return buildMap(users), nil
+}
+
+// LoadOrFetchUsers is LoadOrFetch returning the cached users themselves.
+func LoadOrFetchUsers(ctx context.Context, c *Client, workspaceURL string, force bool) ([]CachedUser, error) {
 	path, err := cachePath(workspaceURL)
 	if err != nil {
 		return nil, err
 	}
 
 	if !force {
-		m, err := loadCache(path)
+		cached, err := readCache(path)
 		if err == nil {
-			slog.Info("loaded cached users", "path", path, "count", len(m))
-			return m, nil
+			slog.Info("loaded cached users", "path", path, "count", len(cached))
+			return cached, nil
 		}
 		if !os.IsNotExist(err) {
 			return nil, fmt.Errorf("reading user cache: %w", err)
@@ -66,54 +76,40 @@ func LoadOrFetch(ctx context.Context, sd *slackdump.Session, workspaceURL string
 	}
 
 	slog.Info("fetching users from Slack API")
-	slackUsers, err := fetchUsersPaginated(ctx, sd)
+	partial := partialPath(path)
+	users, err := c.fetchUsers(ctx, partial)
 	if err != nil {
-		return nil, fmt.Errorf("fetching users: %w", err)
+		return nil, fmt.Errorf("fetching users: %w", errs.Classify(err))
 	}
 
-	if err := saveCache(path, slackUsers); err != nil {
+	if err := writeJSONAtomic(path, users); err != nil {
 		return nil, fmt.Errorf("writing user cache: %w", err)
 	}
-	slog.Info("cached users", "path", path, "count", len(slackUsers))
+	if err := os.Remove(partial); err != nil && !os.IsNotExist(err) {
+		slog.Warn("can't remove user fetch checkpoint", "path", partial, "error", err)
+	}
+	slog.Info("cached users", "path", path, "count", len(users))
 
-	return buildMap(slackUsers), nil
+	return users, nil
 }
 
-// fetchUsersPaginated fetches all users page by page, logging progress
-// and respecting Slack rate limits.
-func fetchUsersPaginated(ctx context.Context, sd *slackdump.Session) ([]slack.User, error) {
-	var all []slack.User
-	page := 0
-	pager := sd.Client().GetUsersPaginated()
-	for {
-		page++
-		var err error
-		pager, err = pager.Next(ctx)
-		if pager.Done(err) {
-			break
-		}
-		if err = pager.Failure(err); err != nil {
-			var rl *slack.RateLimitedError
-			if errors.As(err, &rl) {
-				slog.Info("rate limited, waiting", "retry_after", rl.RetryAfter)
-				select {
-				case <-ctx.Done():
-					return nil, ctx.Err()
-				case <-time.After(rl.RetryAfter):
-				}
-				page--
-				continue
-			}
-			return nil, err
-		}
-		all = append(all, pager.Users...)
-		slog.Info("fetching users", "page", page, "fetched", len(pager.Users), "total", len(all))
-	}
-	return all, nil
+// partialPath returns where an interrupted fetch of the cache at path keeps
+// its checkpoint.
+func partialPath(path string) string {
+	return strings.TrimSuffix(path, ".json") + ".partial.json"
 }
 
 // loadCache reads CachedUser entries from disk and returns a HandleMap.
 func loadCache(path string) (HandleMap, error) {
+	cached, err := readCache(path)
+	if err != nil {
+		return nil, err
+	}
+	return buildMap(cached), nil
+}
+
+// readCache reads CachedUser entries from disk.
+func readCache(path string) ([]CachedUser, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -122,46 +118,96 @@ func loadCache(path string) (HandleMap, error) {
 	if err := json.Unmarshal(data, &cached); err != nil {
 		return nil, err
 	}
-	m := make(HandleMap, len(cached))
-	for _, u := range cached {
-		m[u.ID] = u.Name
-	}
-	return m, nil
+	return cached, nil
 }
 
-// saveCache writes only IDs and handles to disk.
-func saveCache(path string, users types.Users) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+// writeJSONAtomic writes v as indented JSON to path through a temporary
+// file in the same directory, synced before it is renamed, so readers never
+// see a partial file, even after a crash.
+func writeJSONAtomic(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
 		return err
 	}
-	cached := make([]CachedUser, 0, len(users))
-	for _, u := range users {
-		if u.Name == "" {
-			continue
-		}
-		cached = append(cached, CachedUser{ID: u.ID, Name: u.Name})
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
 	}
-	data, err := json.MarshalIndent(cached, "", "  ")
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0o644)
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Avatars returns the avatar URLs in a workspace's user cache, keyed by both
+// user ID and handle so they can be looked up before or after IDs are
+// resolved.
+func Avatars(workspaceURL string) (map[string]string, error) {
+	path, err := cachePath(workspaceURL)
+	if err != nil {
+		return nil, err
+	}
+	cached, err := readCache(path)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string)
+	for _, u := range cached {
+		if u.Avatar != "" {
+			m[u.ID], m[u.Name] = u.Avatar, u.Avatar
+		}
+	}
+	return m, nil
 }
 
-// buildMap creates a HandleMap from a slice of slack.User.
-func buildMap(users types.Users) HandleMap {
+// buildMap creates a HandleMap from cached users.
+func buildMap(users []CachedUser) HandleMap {
 	m := make(HandleMap, len(users))
 	for _, u := range users {
-		if u.Name != "" {
-			m[u.ID] = u.Name
-		}
+		m[u.ID] = u.Name
 	}
 	return m
 }
 
-// resolve returns the Slack handle for a user ID, or the original ID if unknown.
-func (m HandleMap) resolve(id string) string {
-	if name, ok := m[id]; ok {
+// Resolver replaces the user IDs of messages: a HandleMap with Slack
+// handles, Pseudonyms with pseudonyms.
+type Resolver interface {
+	// enter looks at msg before its IDs are resolved.
+	enter(msg *slack.Msg)
+	// lookup returns what replaces the user ID, and false to keep it.
+	lookup(id string) (string, bool)
+	// scrub clears or replaces what else in msg identifies people, after
+	// its IDs are resolved.
+	scrub(msg *slack.Msg)
+}
+
+func (m HandleMap) lookup(id string) (string, bool) {
+	name, ok := m[id]
+	return name, ok
+}
+
+// enter does nothing: handles replace every ID they know.
+func (m HandleMap) enter(*slack.Msg) {}
+
+// scrub leaves the message as it is: handles only replace IDs.
+func (m HandleMap) scrub(*slack.Msg) {}
+
+// resolve returns the replacement for a user ID, or the original ID if
+// unknown.
+func resolve(r Resolver, id string) string {
+	if name, ok := r.lookup(id); ok {
 		return name
 	}
 	return id
@@ -169,126 +215,41 @@ func (m HandleMap) resolve(id string) string {
 
 var mentionRe = regexp.MustCompile(`<@(U[A-Z0-9]+)>`)
 
-// ResolveConversation replaces user IDs with Slack handles throughout the
-// conversation, modifying it in place.
-func ResolveConversation(conv *types.Conversation, m HandleMap) {
-	for i := range conv.Messages {
-		resolveMessage(&conv.Messages[i], m)
-	}
+// ResolveConversation replaces user IDs with what r maps them to throughout
+// the conversation, modifying it in place.
+func ResolveConversation(conv *types.Conversation, r Resolver) {
+	walk.Conversation(conv, visitor(r))
 }
 
-func resolveMessage(msg *types.Message, m HandleMap) {
-	resolveMsg(&msg.Msg, m)
-	if msg.SubMessage != nil {
-		resolveMsg(msg.SubMessage, m)
-	}
-	if msg.PreviousMessage != nil {
-		resolveMsg(msg.PreviousMessage, m)
-	}
-	if msg.Root != nil {
-		resolveMsg(msg.Root, m)
-	}
-	for i := range msg.ThreadReplies {
-		resolveMessage(&msg.ThreadReplies[i], m)
-	}
+// ResolveMessage replaces user IDs with what r maps them to throughout one
+// message, its thread replies included, modifying it in place. Streaming
+// writers call it per message, with the same result as ResolveConversation.
+func ResolveMessage(msg *types.Message, r Resolver) {
+	walk.Message(msg, visitor(r))
 }
 
-func resolveMsg(msg *slack.Msg, m HandleMap) {
-	msg.User = m.resolve(msg.User)
-	if msg.Edited != nil {
-		msg.Edited.User = m.resolve(msg.Edited.User)
-	}
-	msg.Inviter = resolveIfSet(msg.Inviter, m)
-	msg.ParentUserId = resolveIfSet(msg.ParentUserId, m)
-	for i, uid := range msg.ReplyUsers {
-		msg.ReplyUsers[i] = m.resolve(uid)
-	}
-	for i := range msg.Reactions {
-		for j, uid := range msg.Reactions[i].Users {
-			msg.Reactions[i].Users[j] = m.resolve(uid)
-		}
+// visitor resolves the user IDs walk visits, <@USERID> mentions in text
+// included, then scrubs each message.
+func visitor(r Resolver) walk.Visitor {
+	return walk.Visitor{
+		Enter: r.enter,
+		Text:  func(s string) string { return resolveMentions(s, r) },
+		User:  func(id string) string { return resolve(r, id) },
+		Msg:   r.scrub,
 	}
-	// Replace <@USERID> mentions in text.
-	msg.Text = resolveMentions(msg.Text, m)
-	for i := range msg.Attachments {
-		msg.Attachments[i].Text = resolveMentions(msg.Attachments[i].Text, m)
-		msg.Attachments[i].Pretext = resolveMentions(msg.Attachments[i].Pretext, m)
-		msg.Attachments[i].Fallback = resolveMentions(msg.Attachments[i].Fallback, m)
-		msg.Attachments[i].Footer = resolveMentions(msg.Attachments[i].Footer, m)
-		msg.Attachments[i].AuthorID = resolveIfSet(msg.Attachments[i].AuthorID, m)
-	}
-	resolveBlocks(&msg.Blocks, m)
 }
 
-// resolveMentions replaces <@USERID> patterns in a string with @handle.
-func resolveMentions(s string, m HandleMap) string {
+// resolveMentions replaces <@USERID> patterns in a string with @handle, or
+// @ and the pseudonym.
+func resolveMentions(s string, r Resolver) string {
 	if !strings.Contains(s, "<@U") {
 		return s
 	}
 	return mentionRe.ReplaceAllStringFunc(s, func(match string) string {
 		id := mentionRe.FindStringSubmatch(match)[1]
-		if name, ok := m[id]; ok {
+		if name, ok := r.lookup(id); ok {
 			return "@" + name
 		}
 		return match
 	})
 }
-
-func resolveBlocks(blocks *slack.Blocks, m HandleMap) {
-	for _, b := range blocks.BlockSet {
-		switch blk := b.(type) {
-		case *slack.SectionBlock:
-			resolveTextBlockObject(blk.Text, m)
-			for _, f := range blk.Fields {
-				resolveTextBlockObject(f, m)
-			}
-		case *slack.HeaderBlock:
-			resolveTextBlockObject(blk.Text, m)
-		case *slack.ContextBlock:
-			for _, el := range blk.ContextElements.Elements {
-				if tbo, ok := el.(*slack.TextBlockObject); ok {
-					resolveTextBlockObject(tbo, m)
-				}
-			}
-		case *slack.RichTextBlock:
-			resolveRichTextElements(blk.Elements, m)
-		}
-	}
-}
-
-func resolveTextBlockObject(tbo *slack.TextBlockObject, m HandleMap) {
-	if tbo == nil {
-		return
-	}
-	tbo.Text = resolveMentions(tbo.Text, m)
-}
-
-func resolveRichTextElements(elements []slack.RichTextElement, m HandleMap) {
-	for _, el := range elements {
-		switch rte := el.(type) {
-		case *slack.RichTextSection:
-			resolveRichTextSectionElements(rte.Elements, m)
-		case *slack.RichTextQuote:
-			resolveRichTextSectionElements(rte.Elements, m)
-		case *slack.RichTextPreformatted:
-			resolveRichTextSectionElements(rte.Elements, m)
-		case *slack.RichTextList:
-			resolveRichTextElements(rte.Elements, m)
-		}
-	}
-}
-
-func resolveRichTextSectionElements(elements []slack.RichTextSectionElement, m HandleMap) {
-	for _, el := range elements {
-		if u, ok := el.(*slack.RichTextSectionUserElement); ok {
-			u.UserID = m.resolve(u.UserID)
-		}
-	}
-}
-
-func resolveIfSet(id string, m HandleMap) string {
-	if id == "" {
-		return ""
-	}
-	return m.resolve(id)
-}
@@ -236,3 +236,22 @@ func TestResolveConversationRichText(t *testing.T) {
 		t.Errorf("RichTextSectionUserElement.UserID = %q, want alice", ue.UserID)
 	}
 }
+
+func TestResolveConversationAttachmentAuthors(t *testing.T) {
+	conv := &types.Conversation{Messages: []types.Message{{Message: slack.Message{Msg: slack.Msg{
+		Attachments: []slack.Attachment{
+			{AuthorID: "U001", AuthorSubname: "U002"},
+			{AuthorSubname: "via <@U003>"},
+			{AuthorSubname: "Alice Smith"},
+		},
+	}}}}}
+	ResolveConversation(conv, HandleMap{"U001": "alice", "U002": "bob", "U003": "charlie"})
+
+	atts := conv.Messages[0].Attachments
+	want := []struct{ id, subname string }{{"alice", "bob"}, {"", "via @charlie"}, {"", "Alice Smith"}}
+	for i, w := range want {
+		if atts[i].AuthorID != w.id || atts[i].AuthorSubname != w.subname {
+			t.Errorf("attachment %d author = %q/%q, want %q/%q", i, atts[i].AuthorID, atts[i].AuthorSubname, w.id, w.subname)
+		}
+	}
+}
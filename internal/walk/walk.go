@@ -0,0 +1,164 @@
+// Package walk visits the text and user IDs of Slack messages: the message
+// text, its attachments, blocks and rich text, and the fields that name a
+// user. User resolution and text redaction share it, so both reach the
+// same parts of a message.
+package walk
+
+import (
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// Visitor says what to do with the parts of a message. A nil func leaves
+// those parts as they are.
+type Visitor struct {
+	// Enter is called with each message before its text and user IDs are
+	// visited.
+	Enter func(msg *slack.Msg)
+	// Text returns the replacement for a text field: a message's text, its
+	// attachments' text, and the text of its blocks and rich text.
+	Text func(s string) string
+	// User returns the replacement for a user ID. It isn't called for
+	// empty fields.
+	User func(id string) string
+	// Msg is called with each message once its text and user IDs are
+	// visited, for the fields the walk doesn't know.
+	Msg func(msg *slack.Msg)
+}
+
+// Conversation visits every message of conv, modifying it in place.
+func Conversation(conv *types.Conversation, v Visitor) {
+	for i := range conv.Messages {
+		Message(&conv.Messages[i], v)
+	}
+}
+
+// Message visits one message, the messages it embeds and its thread
+// replies, modifying it in place.
+func Message(msg *types.Message, v Visitor) {
+	visitMsg(&msg.Msg, v)
+	if msg.SubMessage != nil {
+		visitMsg(msg.SubMessage, v)
+	}
+	if msg.PreviousMessage != nil {
+		visitMsg(msg.PreviousMessage, v)
+	}
+	if msg.Root != nil {
+		visitMsg(msg.Root, v)
+	}
+	for i := range msg.ThreadReplies {
+		Message(&msg.ThreadReplies[i], v)
+	}
+}
+
+// visitMsg visits the user IDs and text of msg in a fixed order, so a User
+// that numbers users sees them in the same order every time.
+func visitMsg(msg *slack.Msg, v Visitor) {
+	if v.Enter != nil {
+		v.Enter(msg)
+	}
+	msg.User = v.user(msg.User)
+	if msg.Edited != nil {
+		msg.Edited.User = v.user(msg.Edited.User)
+	}
+	msg.Inviter = v.user(msg.Inviter)
+	msg.ParentUserId = v.user(msg.ParentUserId)
+	for i, id := range msg.ReplyUsers {
+		msg.ReplyUsers[i] = v.user(id)
+	}
+	for i := range msg.Reactions {
+		for j, id := range msg.Reactions[i].Users {
+			msg.Reactions[i].Users[j] = v.user(id)
+		}
+	}
+	msg.Text = v.text(msg.Text)
+	for i := range msg.Attachments {
+		a := &msg.Attachments[i]
+		a.Title = v.text(a.Title)
+		a.Text = v.text(a.Text)
+		a.Pretext = v.text(a.Pretext)
+		a.Fallback = v.text(a.Fallback)
+		a.Footer = v.text(a.Footer)
+		for j := range a.Fields {
+			a.Fields[j].Value = v.text(a.Fields[j].Value)
+		}
+		a.AuthorID = v.user(a.AuthorID)
+		// The subname is a user ID for some apps, and text for others.
+		a.AuthorSubname = v.user(v.text(a.AuthorSubname))
+	}
+	v.blocks(&msg.Blocks)
+	if v.Msg != nil {
+		v.Msg(msg)
+	}
+}
+
+func (v Visitor) text(s string) string {
+	if v.Text == nil || s == "" {
+		return s
+	}
+	return v.Text(s)
+}
+
+func (v Visitor) user(id string) string {
+	if v.User == nil || id == "" {
+		return id
+	}
+	return v.User(id)
+}
+
+func (v Visitor) blocks(blocks *slack.Blocks) {
+	for _, b := range blocks.BlockSet {
+		switch blk := b.(type) {
+		case *slack.SectionBlock:
+			v.textObject(blk.Text)
+			for _, f := range blk.Fields {
+				v.textObject(f)
+			}
+		case *slack.HeaderBlock:
+			v.textObject(blk.Text)
+		case *slack.ContextBlock:
+			for _, el := range blk.ContextElements.Elements {
+				if tbo, ok := el.(*slack.TextBlockObject); ok {
+					v.textObject(tbo)
+				}
+			}
+		case *slack.RichTextBlock:
+			v.richText(blk.Elements)
+		}
+	}
+}
+
+func (v Visitor) textObject(tbo *slack.TextBlockObject) {
+	if tbo != nil {
+		tbo.Text = v.text(tbo.Text)
+	}
+}
+
+func (v Visitor) richText(elements []slack.RichTextElement) {
+	for _, el := range elements {
+		switch rte := el.(type) {
+		case *slack.RichTextSection:
+			v.richTextSection(rte.Elements)
+		case *slack.RichTextQuote:
+			v.richTextSection(rte.Elements)
+		case *slack.RichTextPreformatted:
+			v.richTextSection(rte.Elements)
+		case *slack.RichTextList:
+			v.richText(rte.Elements)
+		}
+	}
+}
+
+func (v Visitor) richTextSection(elements []slack.RichTextSectionElement) {
+	for _, el := range elements {
+		switch e := el.(type) {
+		case *slack.RichTextSectionTextElement:
+			e.Text = v.text(e.Text)
+		case *slack.RichTextSectionLinkElement:
+			e.URL = v.text(e.URL)
+			e.Text = v.text(e.Text)
+		case *slack.RichTextSectionUserElement:
+			e.UserID = v.user(e.UserID)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package walk
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestMessage(t *testing.T) {
+	msg := &types.Message{
+		Message: slack.Message{Msg: slack.Msg{
+			User:      "U1",
+			Text:      "text",
+			Reactions: []slack.ItemReaction{{Name: "eyes", Users: []string{"U2"}}},
+			Attachments: []slack.Attachment{{
+				Title:    "title",
+				Fallback: "fallback",
+				Fields:   []slack.AttachmentField{{Title: "Owner", Value: "value"}},
+				AuthorID: "U3",
+			}},
+			Blocks: slack.Blocks{BlockSet: []slack.Block{
+				slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "section", false, false), nil, nil),
+				slack.NewRichTextBlock("b", slack.NewRichTextSection(
+					slack.NewRichTextSectionTextElement("rich", nil),
+					&slack.RichTextSectionLinkElement{Type: slack.RTSELink, URL: "mailto:link", Text: "link"},
+					slack.NewRichTextSectionUserElement("U4", nil),
+				)),
+			}},
+		}},
+		ThreadReplies: []types.Message{{Message: slack.Message{Msg: slack.Msg{User: "U5", Text: "reply"}}}},
+	}
+	var users []string
+	var msgs int
+	Message(msg, Visitor{
+		Text: strings.ToUpper,
+		User: func(id string) string { users = append(users, id); return strings.ToLower(id) },
+		Msg:  func(*slack.Msg) { msgs++ },
+	})
+
+	if want := []string{"U1", "U2", "U3", "U4", "U5"}; !reflect.DeepEqual(users, want) {
+		t.Errorf("users visited %v, want %v", users, want)
+	}
+	if msgs != 2 {
+		t.Errorf("Msg called %d times, want 2", msgs)
+	}
+	a := msg.Attachments[0]
+	if msg.Text != "TEXT" || a.Title != "TITLE" || a.Fallback != "FALLBACK" || a.Fields[0].Value != "VALUE" || a.AuthorID != "u3" {
+		t.Errorf("message or attachment not visited: %q %+v", msg.Text, a)
+	}
+	if got := msg.Blocks.BlockSet[0].(*slack.SectionBlock).Text.Text; got != "SECTION" {
+		t.Errorf("section text = %q, want SECTION", got)
+	}
+	rich := msg.Blocks.BlockSet[1].(*slack.RichTextBlock).Elements[0].(*slack.RichTextSection).Elements
+	link := rich[1].(*slack.RichTextSectionLinkElement)
+	if rich[0].(*slack.RichTextSectionTextElement).Text != "RICH" || link.URL != "MAILTO:LINK" || link.Text != "LINK" || rich[2].(*slack.RichTextSectionUserElement).UserID != "u4" {
+		t.Errorf("rich text not visited: %+v %+v %+v", rich[0], rich[1], rich[2])
+	}
+	if r := msg.ThreadReplies[0]; r.User != "u5" || r.Text != "REPLY" {
+		t.Errorf("reply = %q %q, want u5 REPLY", r.User, r.Text)
+	}
+}
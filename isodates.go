@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// isoLayout is RFC 3339 with the microseconds of a Slack ts.
+const isoLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// parseTZ returns the zone --tz names: an IANA name such as Europe/Prague,
+// Local, or UTC (the default).
+func parseTZ(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("--tz: unknown time zone %q: use an IANA name such as Europe/Prague, Local or UTC", name)
+	}
+	return loc, nil
+}
+
+// isoTime returns the JSON string value of a Slack ts as the time in loc,
+// or false when value isn't a valid ts.
+func isoTime(value json.RawMessage, loc *time.Location) (json.RawMessage, bool) {
+	var ts string
+	if err := json.Unmarshal(value, &ts); err != nil || ts == "" {
+		return nil, false
+	}
+	t, err := parseSlackTS(ts)
+	if err != nil {
+		return nil, false
+	}
+	b, _ := json.Marshal(t.In(loc).Format(isoLayout))
+	return b, true
+}
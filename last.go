@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/rusq/slackdump/v3"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// lastN is --last: how many of a channel's newest top-level messages to
+// dump, 0 for all.
+var lastN int
+
+// errLastFetched stops a dump once its --last messages are fetched.
+var errLastFetched = errors.New("fetched the newest messages --last asks for")
+
+// lastCollector keeps the pages of a channel dump for --last.
+// conversations.history returns them newest first, so once they hold n
+// top-level messages the older pages aren't needed, and processFunc stops
+// the dump instead of letting it walk the rest of the channel.
+type lastCollector struct {
+	n    int
+	msgs []types.Message
+}
+
+// processFunc collects each page, with the thread replies slackdump added
+// to it, and returns errLastFetched once n messages are in.
+func (c *lastCollector) processFunc() slackdump.ProcessFunc {
+	return func(chunk []types.Message, _ string) (slackdump.ProcessResult, error) {
+		c.msgs = append(c.msgs, chunk...)
+		if len(c.msgs) >= c.n {
+			return slackdump.ProcessResult{Entity: "messages", Count: len(chunk)}, errLastFetched
+		}
+		return slackdump.ProcessResult{Entity: "messages", Count: len(chunk)}, nil
+	}
+}
+
+// messages returns the n newest messages collected, oldest first, as
+// slackdump orders a finished dump.
+func (c *lastCollector) messages() []types.Message {
+	msgs := slices.Clone(c.msgs)
+	types.SortMessages(msgs)
+	return msgs[max(len(msgs)-c.n, 0):]
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3"
+	"github.com/wham/gh-slackdump/internal/channels"
+)
+
+// fakeHistory serves a channel of n messages, a second apart, through
+// conversations.history as Slack pages it: newest first, by cursor. It
+// counts the history calls.
+type fakeHistory struct {
+	n     int
+	calls atomic.Int32
+}
+
+func (f *fakeHistory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	var resp any
+	switch r.URL.Path {
+	case "/api/auth.test":
+		resp = map[string]any{"ok": true, "url": "https://acme.slack.com/", "team": "Acme", "team_id": "T1", "user_id": "U1"}
+	case "/api/conversations.info":
+		resp = map[string]any{"ok": true, "channel": map[string]any{"id": "C1", "name": "general"}}
+	case "/api/conversations.history":
+		f.calls.Add(1)
+		offset, _ := strconv.Atoi(r.Form.Get("cursor"))
+		limit, _ := strconv.Atoi(r.Form.Get("limit"))
+		var msgs []map[string]any
+		for i := offset; i < min(offset+limit, f.n); i++ {
+			msgs = append(msgs, map[string]any{"type": "message", "user": "U1", "text": "hi", "ts": fakeTS(f.n - 1 - i)})
+		}
+		more := offset+limit < f.n
+		resp = map[string]any{"ok": true, "messages": msgs, "has_more": more, "response_metadata": map[string]any{"next_cursor": map[bool]string{true: strconv.Itoa(offset + limit)}[more]}}
+	default:
+		resp = map[string]any{"ok": false, "error": "unknown_method"}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// fakeTS is the ts of the i-th message of fakeHistory, from the oldest.
+func fakeTS(i int) string {
+	return fmt.Sprintf("%d.000100", 1700000000+i)
+}
+
+// fakeProvider signs in to whatever server its client reaches.
+type fakeProvider struct{ client *http.Client }
+
+func (fakeProvider) SlackToken() string                  { return "xoxc-test" }
+func (fakeProvider) Cookies() []*http.Cookie             { return nil }
+func (fakeProvider) Validate() error                     { return nil }
+func (p fakeProvider) HTTPClient() (*http.Client, error) { return p.client, nil }
+func (fakeProvider) Test(context.Context) (*slack.AuthTestResponse, error) {
+	return &slack.AuthTestResponse{}, nil
+}
+
+// toServer sends every request to the test server instead of Slack.
+type toServer struct{ url *url.URL }
+
+func (t toServer) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = t.url.Scheme, t.url.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestDumpConversationLast(t *testing.T) {
+	fake := &fakeHistory{n: 100000}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: toServer{u}}
+
+	defer func(n int, c *channels.Cache) { lastN, conversationCache = n, c }(lastN, conversationCache)
+	conversationCache = channels.Open(filepath.Join(t.TempDir(), "conversations.json"), channels.NewFetcher(client, "xoxc-test", slack.APIURL))
+	lastN = 50
+
+	ctx := context.Background()
+	sd, err := slackdump.New(ctx, fakeProvider{client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := parseArchiveLink("https://acme.slack.com/archives/C1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, err := dumpConversation(ctx, sd, link, time.Time{}, time.Time{}, nil)
+	if err != nil {
+		t.Fatalf("dumpConversation() error: %v", err)
+	}
+	if calls := fake.calls.Load(); calls > 2 {
+		t.Errorf("made %d conversations.history calls for --last 50 of 100,000 messages, want a page or two", calls)
+	}
+	if len(conv.Messages) != 50 || conv.Name != "general" {
+		t.Fatalf("dumped %d messages of %s, want the 50 newest of general", len(conv.Messages), conv.Name)
+	}
+	if first, last := conv.Messages[0].Timestamp, conv.Messages[49].Timestamp; first != fakeTS(99950) || last != fakeTS(99999) {
+		t.Errorf("messages run from %s to %s, want %s to %s, oldest first", first, last, fakeTS(99950), fakeTS(99999))
+	}
+}
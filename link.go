@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// archiveLink is a Slack archives link to a conversation or to a message in
+// it, e.g. https://ws.slack.com/archives/C012345/p1771747003176409?thread_ts=1771740000.123456&cid=C012345.
+type archiveLink struct {
+	channel string
+	// ts is the linked message, empty for a conversation link.
+	ts string
+	// threadTS is the thread_ts query parameter "Copy link" adds to replies.
+	threadTS string
+}
+
+// parseArchiveLink parses a Slack archives link. Of the query parameters,
+// thread_ts selects the reply's thread and cid must name the path's channel;
+// the rest are ignored.
+func parseArchiveLink(slackLink string) (archiveLink, error) {
+	u, err := url.Parse(slackLink)
+	if err != nil {
+		return archiveLink{}, err
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "archives" || parts[1] == "" {
+		return archiveLink{}, fmt.Errorf("%s is not a channel, DM, or thread link: want https://<workspace>.slack.com/archives/<channel>[/p<ts>]", slackLink)
+	}
+	l := archiveLink{channel: parts[1]}
+	if len(parts) == 3 {
+		ts, ok := threadTSFromLink(slackLink)
+		if !ok {
+			return archiveLink{}, fmt.Errorf("%s: %q is not a message in the conversation", slackLink, parts[2])
+		}
+		l.ts = ts
+	}
+
+	q := u.Query()
+	if cid := q.Get("cid"); cid != "" && cid != l.channel {
+		return archiveLink{}, fmt.Errorf("%s: cid %s conflicts with channel %s in the path", slackLink, cid, l.channel)
+	}
+	if threadTS := q.Get("thread_ts"); threadTS != "" {
+		if _, err := parseSlackTS(threadTS); err != nil {
+			return archiveLink{}, fmt.Errorf("%s: thread_ts: %w", slackLink, err)
+		}
+		l.threadTS = threadTS
+	}
+	return l, nil
+}
+
+// thread returns the thread to dump: the thread of a linked reply, the
+// linked message itself, or "" for a conversation link.
+func (l archiveLink) thread() string {
+	if l.threadTS != "" {
+		return l.threadTS
+	}
+	return l.ts
+}
+
+// reply returns the ts of the reply a link points at within its thread, or
+// "" when the link is to a conversation or a thread's parent.
+func (l archiveLink) reply() string {
+	if l.threadTS != "" && l.ts != l.threadTS {
+		return l.ts
+	}
+	return ""
+}
+
+// target returns the link in the "<channel>[:<thread_ts>]" form
+// slackdump.Session.Dump takes, so slackdump never sees the query string.
+func (l archiveLink) target() string {
+	if ts := l.thread(); ts != "" {
+		return l.channel + ":" + ts
+	}
+	return l.channel
+}
+
+// warnMissingTarget logs a warning when the linked reply ts is not among
+// msgs or their replies, as when it was deleted.
+func warnMissingTarget(msgs []types.Message, ts string) {
+	if ts != "" && !containsTS(msgs, ts) {
+		slog.Warn("the linked reply is not in the thread; it may have been deleted", "ts", ts)
+	}
+}
+
+func containsTS(msgs []types.Message, ts string) bool {
+	for i := range msgs {
+		if msgs[i].Timestamp == ts || containsTS(msgs[i].ThreadReplies, ts) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestParseArchiveLink(t *testing.T) {
+	tests := []struct {
+		name       string
+		link       string
+		wantThread string
+		wantTarget string
+		wantReply  string
+		wantErr    string
+	}{
+		{
+			name:       "channel",
+			link:       "https://ws.slack.com/archives/C012345",
+			wantTarget: "C012345",
+		},
+		{
+			name:       "thread",
+			link:       "https://ws.slack.com/archives/C012345/p1771747003176409",
+			wantThread: "1771747003.176409",
+			wantTarget: "C012345:1771747003.176409",
+		},
+		{
+			name:       "reply copied with thread_ts and cid",
+			link:       "https://ws.slack.com/archives/C012345/p1771747003176409?thread_ts=1771740000.123456&cid=C012345",
+			wantThread: "1771740000.123456",
+			wantTarget: "C012345:1771740000.123456",
+			wantReply:  "1771747003.176409",
+		},
+		{
+			name:       "parent copied with its own thread_ts",
+			link:       "https://ws.slack.com/archives/C012345/p1771740000123456?thread_ts=1771740000.123456&cid=C012345",
+			wantThread: "1771740000.123456",
+			wantTarget: "C012345:1771740000.123456",
+		},
+		{
+			name:       "unrelated query parameters",
+			link:       "https://agency.slack-gov.com/archives/C012345/p1771747003176409?utm_source=x",
+			wantThread: "1771747003.176409",
+			wantTarget: "C012345:1771747003.176409",
+		},
+		{
+			name:    "conflicting cid",
+			link:    "https://ws.slack.com/archives/C012345/p1771747003176409?thread_ts=1771740000.123456&cid=C999999",
+			wantErr: "conflicts with channel C012345",
+		},
+		{
+			name:    "invalid thread_ts",
+			link:    "https://ws.slack.com/archives/C012345/p1771747003176409?thread_ts=abc",
+			wantErr: "thread_ts",
+		},
+		{
+			name:    "invalid message",
+			link:    "https://ws.slack.com/archives/C012345/pabc",
+			wantErr: "not a message",
+		},
+		{
+			name:    "not an archives link",
+			link:    "https://ws.slack.com/team/U012345",
+			wantErr: "not a channel",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseArchiveLink(tt.link)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseArchiveLink(%q) error = %v, want %q", tt.link, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseArchiveLink(%q) error = %v", tt.link, err)
+			}
+			if got.thread() != tt.wantThread {
+				t.Errorf("thread() = %q, want %q", got.thread(), tt.wantThread)
+			}
+			if got.target() != tt.wantTarget {
+				t.Errorf("target() = %q, want %q", got.target(), tt.wantTarget)
+			}
+			if got.reply() != tt.wantReply {
+				t.Errorf("reply() = %q, want %q", got.reply(), tt.wantReply)
+			}
+		})
+	}
+}
+
+func TestContainsTS(t *testing.T) {
+	msgs := []types.Message{{
+		Message:       slack.Message{Msg: slack.Msg{Timestamp: "1.0"}},
+		ThreadReplies: []types.Message{{Message: slack.Message{Msg: slack.Msg{Timestamp: "2.0"}}}},
+	}}
+	if !containsTS(msgs, "1.0") || !containsTS(msgs, "2.0") || containsTS(msgs, "3.0") {
+		t.Error("containsTS() misses a message or finds a missing one")
+	}
+}
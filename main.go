@@ -1,43 +1,185 @@
 package main
 
 import (
+	"cmp"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	sdauth "github.com/wham/gh-slackdump/internal/auth"
+	"github.com/wham/gh-slackdump/internal/channels"
+	"github.com/wham/gh-slackdump/internal/errs"
+	"github.com/wham/gh-slackdump/internal/format"
+	"github.com/wham/gh-slackdump/internal/logging"
+	"github.com/wham/gh-slackdump/internal/progress"
+	"github.com/wham/gh-slackdump/internal/redact"
 	"github.com/wham/gh-slackdump/internal/users"
 
+	"github.com/cli/go-gh/v2/pkg/term"
+	"github.com/rusq/slack"
 	"github.com/rusq/slackdump/v3"
+	"github.com/rusq/slackdump/v3/auth"
+	"github.com/rusq/slackdump/v3/types"
 	"github.com/spf13/cobra"
 )
 
 var version = "dev"
 
 var (
-	testFlag     bool
-	outputFile   string
-	fromTime     string
-	toTime       string
-	resolveUsers bool
-	forceUsers   bool
+	testFlag        bool
+	outputFile      string
+	fromTime        string
+	toTime          string
+	resolveUsers    bool
+	forceUsers      bool
+	noCache         bool
+	overwrite       bool
+	fieldsSpec      string
+	threadsFile     string
+	noMetadata      bool
+	isoDates        bool
+	permalinks      bool
+	showRawTS       bool
+	tzName          string
+	cacheDir        string
+	compact         bool
+	sinceLast       bool
+	tlsHello        string
+	caBundle        string
+	insecureTLS     bool
+	pinCerts        bool
+	pinFile         string
+	scoreSpec       string
+	sortBy          string
+	topN            int
+	workspace       string
+	timeout         time.Duration
+	firstReact      bool
+	releaseSpec     string
+	createRelease   bool
+	forceAsset      bool
+	gist            bool
+	gistPublic      bool
+	expandShared    bool
+	ignoreMismatch  bool
+	estimate        bool
+	proceed         bool
+	followVanity    bool
+	cookieFile      string
+	rateLimit       float64
+	showSecrets     bool
+	verbose         bool
+	jsonSummary     bool
+	statsJSON       bool
+	trace           bool
+	debugHTTP       string
+	outageMaxWait   time.Duration
+	splitBy         string
+	splitPeriod     string
+	outputFormat    string
+	htmlPageSize    int
+	emojiDir        string
+	csvDelimiter    string
+	csvRows         string
+	normalizeEmoji  bool
+	noNormalize     bool
+	progressFD      int
+	progressFile    string
+	ndjsonThreads   string
+	requireComplete bool
+	mattermostTeam  string
+	templateFile    string
+	templateString  string
+	compressFlag    string
 )
 
+// exitOutage is the exit code when Slack stayed unavailable for longer than
+// --outage-max-wait; other failures exit with 1.
+const exitOutage = 3
+
+// exitIncomplete is the exit code when --require-complete finds the dump
+// incomplete.
+const exitIncomplete = 4
+
+// exitInterrupted is the exit code when the run is stopped by SIGINT or
+// SIGTERM, as shells report a process killed by SIGINT.
+const exitInterrupted = 130
+
+// outputOptions holds the output additions selected by flags.
+var outputOptions encodeOptions
+
 var rootCmd = &cobra.Command{
 	Use:   "gh slackdump <slack-link>",
 	Short: "Dump Slack conversations to stdout in JSON export format",
 	Long: `GH CLI extension that uses slackdump to dump the content of a Slack link
 to stdout in Slack's JSON export format.
 
-Supports channels, threads, and direct messages in both regular (*.slack.com)
-and enterprise (*.enterprise.slack.com) workspaces. Authenticates via the Slack
-desktop app's local cookie storage — requires the Slack desktop app to be
-signed in to your workspace.
+Supports channels, threads, and direct messages in regular (*.slack.com),
+enterprise (*.enterprise.slack.com), and GovSlack (*.slack-gov.com)
+workspaces. Authenticates via the Slack desktop app's local cookie storage —
+requires the Slack desktop app to be signed in to your workspace.
+
+A link to a thread reply (with ?thread_ts=...&cid=...) dumps the reply's
+whole thread and marks the reply: "link_target": true in JSON and NDJSON,
+"⟶ linked message" in HTML. A warning names the reply's ts if it isn't in
+the thread, as when it was deleted. A cid naming another channel than the
+link's path is an error.
+
+Links on a vanity host that redirects to Slack (e.g. chat.example.com) are
+refused unless --follow-redirects is passed; it follows the host's redirects
+to find the Slack workspace and dumps from there.
+
+JSON is indented with two spaces, except with --compact, which writes it on
+one line. --compact is the default when stdout is not a terminal, as when
+piping into jq; pass --compact=false to indent anyway. The document starts
+with a channel object (from conversations.info, with is_read_only,
+is_thread_only and is_locked when set) and a dump object (tool version,
+workspace, requested range, generation time); --no-metadata leaves them
+out. --fields keeps only
+the given keys of each message (e.g. ts,user,text), thread replies included.
+--iso-dates adds ts_iso, thread_ts_iso and edited.ts_iso next to the Slack
+timestamps, in UTC or the --tz zone. --permalinks adds each message's Slack
+permalink, made from its ts without API calls (replies get the thread_ts
+form); in --format html and gh-markdown and --threads-file digests, times
+link to it. --show-raw-ts shows each message's ts after its time in
+--format html, text and gh-markdown ("07:56 · 1771747003.176409"), to look
+the message up in logs or the API; anchors and permalinks are made from
+the same ts.
+
+Use --threads-file instead of a link to dump the threads of a file of
+permalinks, one per line, into one Markdown digest with a table of contents,
+in the file's order or by time with --sort ts. Links to the same thread,
+such as a reply's and the parent's, are dumped once, with a warning naming
+both. A thread that can't be dumped gets a note in the digest and a
+warning rather than failing the run.
+
+Use --compress gzip or --compress zstd to compress the output as it is
+written, e.g. when piping it. With -o, a file name ending in .gz or .zst
+selects the compression by itself. --split-by and --split files and
+--format html pages are compressed one by one (the split index isn't),
+and --since-last-message and gh slackdump merge read compressed files
+back. The "output written" log line gives the size before and after
+compression. Directory formats (export, zulip) aren't compressed.
+
+Use --encrypt-to to encrypt the output with age, after compressing it, to
+an age recipient (age1...), an SSH public key, or a file of them such as
+~/.ssh/id_ed25519.pub; repeat it for more recipients. Every file written
+gets .age appended (general.json.zst.age, each split file and page,
+each file of a directory format), and stdout is encrypted for piping into
+storage tools. Decrypt with age -d or rage. It can't be combined with
+--since-last-message, which reads the output back, or --gist.
 
 Use --from and --to to restrict the dump to a specific time range. Both flags
 accept RFC3339 timestamps (e.g. 2024-01-15T09:00:00Z) or plain dates
@@ -45,118 +187,1494 @@ accept RFC3339 timestamps (e.g. 2024-01-15T09:00:00Z) or plain dates
 are dumped. The time range filters by parent message timestamp; thread
 replies are included or excluded together with their parent.
 
+Use --last N to dump only a channel's N newest top-level messages, with
+their threads. Slack returns a channel's history newest first, so the
+fetch stops at the page that holds them instead of walking the whole
+channel; with --to they are the newest before it, and --from bounds them
+too. The messages are written oldest first, as always. It doesn't apply
+to thread links or --format ndjson.
+
 Use -u to replace user IDs with Slack handles. The workspace user list is
-fetched once and cached. Use -f to force a re-fetch.`,
-	Example: `  gh slackdump https://myworkspace.slack.com/archives/C09036MGFJ4
-  gh slackdump -u https://myworkspace.slack.com/archives/C09036MGFJ4
-  gh slackdump -u -f https://myworkspace.slack.com/archives/C09036MGFJ4
-  gh slackdump -o output.json https://myworkspace.enterprise.slack.com/archives/CMH59UX4P
-  gh slackdump --from 2024-01-01 --to 2024-01-31 https://myworkspace.slack.com/archives/C09036MGFJ4
-  gh slackdump --from 2024-01-15T09:00:00Z --to 2024-01-15T17:00:00Z https://myworkspace.slack.com/archives/C09036MGFJ4
-  gh slackdump --test`,
+fetched once and cached, under --cache-dir, $GH_SLACKDUMP_CACHE_DIR or
+$XDG_CACHE_HOME/gh-slackdump (the gh CLI cache directory on macOS); a cache
+in the gh CLI cache directory is copied over on first use. Use -f to force a
+re-fetch.
+
+Use --anonymize to replace every user with a pseudonym instead: user-1,
+user-2 and on, numbered in the order they first appear, in authors,
+mentions, reactions, rich text and files alike, with user names, avatars and
+profile links left out. Slackbot and the bot users of workflows and apps
+keep their IDs, as do the users passed to --anonymize-keep. --anonymize-map
+writes which user ID (and handle, with -u) each pseudonym stands for to a
+separate JSON file, encrypted too with --encrypt-to and never added to a
+--gist.
+
+Use --redact to replace email addresses, phone numbers, card numbers (that
+pass the Luhn check) and AWS access key IDs, Slack tokens and webhooks and
+GitHub tokens in message text with [REDACTED:<type>], in attachments,
+blocks and rich text too. --redact-pattern adds a regular expression of
+your own, [REDACTED:custom], or <type>=<regexp> to name its type; it works
+without --redact, redacting just its matches. The run summary counts the
+replacements by type.
+
+Use --files with -o to download the files attached to messages, which
+Slack only serves to a signed-in session, into <output>__files, named
+<file ID>-<name>, and add each one's local_path to the JSON. Files are
+downloaded as the dump finds them, --download-concurrency (default 4) at a
+time. Downloads share --rate-limit's budget with the API calls, taking
+at most half of it so fetching messages keeps the rest; they wait when
+Slack answers them 429, hold off new files while the dump's API calls wait
+out a 429, and are retried when they fail for a reason that may pass.
+--max-file-size (e.g. 25MB) skips larger files. --files-include and
+--files-exclude take extensions (pdf, docx) or MIME types (image/*,
+video/*): only files matching an include and no exclude are downloaded,
+and the others are marked "skipped_by_filter": true in the JSON. The status line shows the files
+left and the download rate; the run summary counts the files downloaded,
+skipped (by reason) and failed.
+
+Running --files again into the same directory keeps the files already
+downloaded, by the size and SHA-256 recorded in its .files-state.json, and
+resumes interrupted downloads (<name>.part) with a Range request. Use
+--verify-files -o <output> to checksum the downloaded files again against
+that record, without downloading anything.
+
+Channel details from conversations.info (for --format export, mattermost and
+zulip) are cached in the same directory for a day; conversations that don't
+exist are remembered for an hour. Use --no-cache to fetch fresh data for one
+run, e.g. after a rename: neither cache is read, but both are updated. It
+doesn't imply -u, and the file --since-last-message appends to is still read.
+
+Use --since-last-message with a thread link and -o to fetch only the replies
+newer than the newest message already in the output file and append them to
+it. The file is rewritten atomically; when there is nothing new it is left
+untouched. A missing file, or one with no messages, gets the whole thread.
+
+Output files are written to a temporary file next to them and renamed into
+place once complete and synced to disk, so a failed or interrupted run never
+leaves a truncated file behind. On Ctrl-C or SIGTERM the temporary files are
+removed and the run exits with code 130. An -o file that already has content
+is only replaced with --overwrite; otherwise the run stops before
+authenticating.
+
+Connections to Slack mimic a browser's TLS fingerprint. Use --tls-hello to
+choose it (safari, chrome, firefox); the User-Agent is switched to match.
+The default, auto, picks the fingerprint consistent with the User-Agent and,
+if the handshake is rejected, falls back to chrome and then Go's standard
+fingerprint; the one that works is kept for the rest of the run.
+
+Behind a TLS-intercepting proxy, pass its root CA with --ca-bundle (a PEM
+file; SSL_CERT_FILE is honored too). --insecure-skip-verify turns off
+certificate verification entirely and should only be used for debugging.
+
+Use --pin-slack-certs with --pin-file to require that every certificate
+chain Slack serves contains a public key from the pin file; any other chain,
+including one re-signed by a trusted corporate proxy, fails the connection.
+
+Every request to Slack must get its response headers within --timeout
+(default 30s), which covers connecting, any proxy CONNECT, and the TLS
+handshake, so an unreachable host fails instead of hanging.
+
+API requests to Slack are paced to --rate-limit requests per second, all
+methods together (default Slack's Tier 3, 50 per minute, with bursts of 5;
+0 disables pacing); file downloads take from the same budget. A 429 answer is waited
+out per its Retry-After and the request sent again. With -o, the run ends
+by logging how many requests were made, how many were rate limited, and the
+time spent waiting.
+
+When the Slack API answers with an HTML page instead of JSON (a maintenance
+or incident page), the request is retried with growing waits (10s, doubling
+up to 2m) for up to --outage-max-wait (default 10m). If Slack is still
+unavailable then, the run fails with exit code 3 and points at
+status.slack.com; nothing is written.
+
+Use --score to add a gh_slackdump_score to every message, weighing reaction
+count, reply count, distinct repliers, and being pinned (e.g.
+--score "reactions=2,replies=1,pinned=10"; unlisted signals weigh 0). Use
+--sort score to rank top-level messages by score (ties keep the older
+message first) and --top N to keep only the N highest-scoring ones. Without
+--score these use reactions=1,replies=1,reply_users=1,pinned=5.
+
+Use --grep to keep only the messages whose text, or an attachment's,
+matches a regular expression, with their matching thread replies (a thread
+parent that doesn't match is kept for them). Repeat it for several
+patterns, kept when any matches or, with --grep-logic all, when every one
+does. Label a pattern as <label>:<regexp> (--grep "payment:payment_id=\d+")
+to name it in the output: JSON messages list the patterns they matched in
+"matches" (the expression itself for unlabeled ones), and gh-markdown shows
+them as badges after the time. It can't be combined with --format ndjson,
+--since-last-message or --threads-file.
+
+Use --split-by count:N with -o to write the dump as numbered files of at
+most N top-level messages each (threads stay with their parent), e.g.
+general.0001.json, general.0002.json, and an index, general.index.json,
+listing each file's message count and ts range. Each file is a complete
+dump of its messages. gh slackdump merge general.index.json puts them back
+together into exactly the file -o would have written.
+
+Use --split day or --split month with -o <directory> to write a file per
+UTC day or month of the top-level messages into the directory instead,
+e.g. 2024-01-15.json or 2024-01.json, and an index.json that also gives the
+overall ts range; thread replies stay in their parent's file whatever day
+they were posted. It works with --format json, ndjson (the files are
+written as the dump streams in, 2024-01-15.ndjson) and gh-markdown
+(2024-01-15.md, numbered like 2024-01-15.0002.md when a day takes more
+than one comment). gh slackdump merge <directory> only reassembles JSON.
+
+Use gh slackdump stats with a link, instead of dumping it, to print an
+analytics report of the channel or thread within --from and --to: top
+posters, messages per weekday and hour (in --tz), thread participation,
+the median time to a thread's first answer, the most-used reactions and
+the busiest days. --json prints it as JSON; see gh slackdump stats --help.
+
+Use gh slackdump convert general.json with --format, --template or other
+output flags to write an earlier JSON dump again without Slack, resolving
+user IDs with --users-file; see gh slackdump convert --help.
+
+Use gh slackdump view with a link or an earlier dump to read it in the
+terminal: colored per author, threads indented under their parent (or
+collapsed with --collapse-threads), reactions inline, and paged through
+less, where / searches; see gh slackdump view --help. --format text writes
+the same text without colors.
+
+Use --format html to write a single self-contained HTML page laid out like
+the Slack client instead of JSON: avatars (with -u, from the user cache;
+refresh an older cache with -f to add them), names and times, threads
+folded under their parent, reactions and standard emoji, and code blocks
+with syntax highlighting. The stylesheet is inlined; the avatars are
+linked, or with --files downloaded and inlined, so the page opens offline
+(an avatar that can't be downloaded stays linked). With -o, more than
+--html-page-size top-level messages (default 5000) are written as linked
+pages: general.html, general.0002.html, and so on.
+
+Use --format csv for a flat table with one row per message, thread replies
+included right after their parent: ts, iso_datetime, channel, thread_ts,
+user_handle, text (mrkdwn reduced to plain text), reply_count,
+reaction_count, file_count, permalink_ts (the p1771747003176409 form
+used in links), thread_permalink (the link to the thread's parent),
+parent_user (the parent's author) and workflow_fields. Replies and their
+parent share thread_ts, thread_permalink and parent_user, which are empty
+outside threads. workflow_fields is a JSON array of name and value
+objects for a message a workflow or app posted with its content in blocks
+or metadata, such as a Workflow Builder form submission; html, text and
+gh-markdown show those fields as a definition list, with the workflow's
+name as the author. Fields are
+quoted as needed, so text with commas, quotes or newlines stays in one
+cell, and cells starting like a formula (=, +, -, @) get a leading ' so
+spreadsheets don't run them; --csv-delimiter tab writes TSV. With
+--csv-rows reactions a row is a user's reaction instead: ts, channel,
+thread_ts and permalink_ts of the message, the reaction, user_handle,
+position (from 1, in the order users added the reaction) and
+reaction_count.
+
+Use --format ndjson to stream one JSON object per line instead of one
+document, for jq, DuckDB or log pipelines: each message is written as soon
+as its page has been fetched, so memory stays flat however large the
+channel. Thread replies stay nested in their parent's record, or, with
+--ndjson-threads separate, follow it as records of their own whose
+thread_ts names the parent. Records come in the order Slack returns them,
+newest page first for channels, so --sort score and --top don't apply.
+
+Use --format export -o <directory> for the layout of Slack's own exports,
+which tools such as slack-export-viewer and importers read: users.json,
+channels.json, groups.json, dms.json and mpims.json, the one for the
+conversation holding its entry from conversations.info (for a DM just
+its ID, creation time and the IDs of both members; for a group DM its
+members' IDs) and the others empty, and a <channel>/<YYYY-MM-DD>.json
+file per UTC day holding that day's raw messages (<DM ID>/ for a DM). Thread replies go in the day they were posted, with thread_ts
+and parent_user_id. User IDs are kept, since users.json names them.
+
+Use --format mattermost with -u and --mattermost-team to write a
+Mattermost bulk import file: a post per message, created at its Slack
+time, with thread replies nested, reactions, and mrkdwn turned into
+Markdown. The users must already exist in Mattermost. Messages of subtypes
+Mattermost has no post for, such as channel joins, are skipped and counted
+on stderr.
+
+Use --format zulip with -o <directory> to write a Zulip data export for
+"manage.py import": realm.json with a stream for the channel and a user
+per author or reacting user, named from the user cache, and
+messages-NNNNNN.json files. Each thread becomes a topic named after the
+first line of its parent (up to 60 characters); other messages go in
+"imported from Slack". Reactions are kept where the emoji has a standard
+Unicode character. Users get placeholder <id>@slack.invalid addresses.
+
+Use --format gh-markdown to move a conversation into GitHub: Markdown in
+parts of at most GitHub's 65,536 characters per comment, part-01.md,
+part-02.md, ... in the -o directory, or one part to stdout for
+gh issue create --body-file -. Each part's header links the Slack link it
+was dumped from and marks a read-only channel, as "#announcements
+(read-only)". Mentions stay plain @handle text that notifies no GitHub
+user, emoji use GitHub's shortcodes, code blocks are fenced and files are
+links.
+
+Custom emoji show as :name: in both unless --emoji-dir names a directory
+written by gh slackdump emoji <workspace-url> -o <directory>: they are then
+images from it, linked relative to the output, so keep the directory next
+to the pages when moving them (or commit it with the gh-markdown parts).
+
+Use --template with a Go text/template file to write each top-level
+message in a shape of your own instead, or --template-string for a
+one-liner. A template sees .Channel, .TS, .Time (a time.Time in UTC),
+.ThreadTS, .User (the handle with -u), .Text (mrkdwn), .Replies (with the
+same fields), .Reactions (.Name, .Count, .Users), .Files (.Name, .Title,
+.Mimetype, .Size, .Permalink) and .Message, the message as dumped. Besides
+the built-in functions it can use sprig-style date, dateInZone, trunc,
+abbrev, upper, lower, trim, replace, indent, join, default and json, and
+plain and markdown to convert mrkdwn. Each message's output ends with a
+newline. The template is parsed and tried on a sample message before
+anything is fetched, so mistakes fail right away.
+
+Use --release owner/repo@tag with -o to upload the output file as a GitHub
+release asset (up to 2 GB) using your gh credentials; the file is streamed
+from disk and the asset URL is printed. The asset is named after the
+channel and the days dumped (--from and --to, or else the oldest and newest
+message), e.g. general_2024-06-01_2024-07-01.json.gz, and replaces an asset
+of that name, so a dump can be re-run; the old asset is deleted only once
+the new one is uploaded. --create-release creates the release when the tag
+has none.
+
+Use --gist to put the output in a secret GitHub gist, with your gh
+credentials, and print its URL; --gist-public makes it public. The gist is
+named after the channel and the days of its messages, and holds every file
+written (split files, HTML pages, directory contents). A file over 10 MB is
+split between lines into numbered files. Without -o the output is written
+to a temporary directory for the gist only; with -o it stays there even
+when creating the gist fails.
+
+Use --manifest with -o to also write <output>.manifest.json, e.g.
+general.json.gz.manifest.json: the SHA-256 and size of every file written,
+the tool version, the workspace host, the channel's ID and name, the
+requested and actual time range, the message count and the user the cookie
+signs in as (per auth.test). It is uploaded next to a --release asset and
+never encrypted. gh slackdump verify checks the files against it and exits
+non-zero when one is missing or changed.
+
+Messages that share (forward) another Slack message get a
+gh_slackdump_shared_messages entry per share with the original channel, ts,
+author, text, and permalink; html, text and gh-markdown quote it under the
+message with its author, and its time linked to the permalink. Use
+--expand-shares to also fetch each shared message's thread; shares the
+token can't read are skipped with a warning.
+
+Messages are sorted by ts, oldest first, each thread's replies too, and
+copies of one message (same ts and author), such as a thread's parent
+returned again among its replies, are dropped, keeping the fullest copy.
+--no-normalize writes them as the session returned them.
+
+Slack stores a reaction under whichever name was used, so the same emoji
+can show up as thumbsup on one message and +1 on another. Use
+--normalize-emoji to rename reactions to one canonical name: standard
+aliases (thumbsup becomes +1) and the workspace's custom aliases, from
+emoji.list, become the emoji they stand for, and reactions that end up
+with the same name on one message are merged. --first-reactor and --score
+then see the merged reactions.
+
+Use --first-reactor to add gh_slackdump_first_reactor to every message with
+reactions: the first user of its first reaction, since Slack lists reactions
+and their users in the order they were added.
+
+Use --progress-fd 3 (an inherited file descriptor) or --progress-file to
+get a machine-readable progress stream for a wrapper UI, separate from the
+logs: one JSON object per line, each with "v": 1, a type (stage, progress,
+warning, then done or error last), the stage (authenticating, dumping,
+expanding_shares, resolving_users, writing), the messages, replies and
+requests so far, and a time. Progress events come at most every 500ms;
+with --from they also carry percent and eta_seconds. Version 1 only ever
+gains fields, so ignore what you don't know.
+
+With -o, the progress is also shown on stderr: the messages and replies
+fetched, threads fetched out of those with replies, requests per second,
+time spent waiting on rate limits and, with --from, percent and ETA. On a
+terminal it is a line redrawn every second; otherwise it is logged every
+30s. Writing to stdout shows nothing.
+
+Use --estimate to print the projected output size and the memory needed to
+encode it, then exit without writing; add --proceed to write it anyway. The
+estimate renders 1% of the top-level messages (at least 10) with the real
+encoder and extrapolates, so it is usually within 10% of the actual size;
+conversations whose message sizes vary widely can miss by more. It notes a
+read-only, thread-only or locked channel, whose threads differ.
+
+Use --require-complete for archiving that must be complete: after writing
+the output, every thread is checked against Slack's reply_count and the run
+must not have logged a warning or error. If a check fails, a report goes
+to stderr and the command exits with code 4, although the output was
+written (a --release upload is skipped). Threads reaching past --from or
+--to can't be checked and are left out.
+
+Before dumping, the workspace the Slack cookie signs in to (per auth.test)
+is compared with the link's; on a mismatch the run stops and names both.
+--ignore-workspace-mismatch dumps anyway. An Enterprise Grid session may
+use a link on its org's host (<org>.enterprise.slack.com), or be reported
+on it, without either.
+
+Use --cookie-file to read the d cookie from a file (just its value, e.g.
+copied from a browser) instead of the Slack desktop app.
+
+Use --test to check that the Slack cookie can be read. Add --workspace with
+the workspace URL (or any link into it) to also exchange the cookie for a
+token and call auth.test, printing each step with its timing; the command
+exits non-zero if a step fails. This is the recommended first-run check;
+gh slackdump quickstart walks through it interactively. The cookie value is
+masked unless --show-secrets is passed. When it fails, gh slackdump doctor
+checks what signing in depends on (the desktop app's cookies and their
+expiry, the Keychain item, reaching slack.com, the cache directory), with
+--json for bug reports.
+
+Use --debug-http to trace every request to Slack on stderr: method, URL,
+status, latency, negotiated protocol (h2 or http/1.1) and response size.
+--debug-http=full also writes each request and response, headers and body,
+to a temporary directory. Cookie and Authorization headers, tokens and
+cookie values are masked in both.
+
+A successful run ends with a summary on stderr of the files it wrote, their
+sizes and the time taken, and statistics of the dump: messages, threads,
+replies, users, the time range covered, files referenced and their size,
+reactions, and time spent waiting on rate limits. --json-summary prints it
+as JSON for wrappers; --stats-json writes the statistics into the JSON
+document as a stats object instead.
+
+Logs go to stderr. --verbose adds debug detail (and logs even when writing
+to stdout); messages repeated in tight loops, like one per fetched page, are
+logged once and then summarized with a repeated count every 5s or 100
+repeats. --trace logs every one of them.
+
+Slack tokens (xox*-...), d= cookie values and the Keychain password are
+masked in every log line and error message, so output can be pasted into
+an issue as-is.`,
 	Version:      version,
 	Args:         cobra.ExactArgs(1),
-	RunE:         run,
+	RunE:         runWithSummary,
 	SilenceUsage: true,
+	// main prints errors itself, with secrets masked.
+	SilenceErrors: true,
+}
+
+// examples are the --help examples. Those that read the Slack desktop app's
+// cookie need the keychain capability and are left out of builds without it.
+var examples = []struct {
+	cmd   string
+	needs string
+}{
+	{"gh slackdump https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump -u https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump -u -f https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump -o output.json https://myworkspace.enterprise.slack.com/archives/CMH59UX4P", "keychain"},
+	{"gh slackdump --from 2024-01-01 --to 2024-01-31 https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --from 2024-01-15T09:00:00Z --to 2024-01-15T17:00:00Z https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --last 50 https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --since-last-message -o thread.json https://myworkspace.slack.com/archives/C09036MGFJ4/p1771747003176409", "keychain"},
+	{"gh slackdump --sort score --top 20 https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --grep 'payment:payment_id=\\d+' --grep refund:refund --grep-logic all https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --estimate -o channel.json https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump -o general.json.zst https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --format ndjson --compress gzip https://myworkspace.slack.com/archives/C09036MGFJ4 > general.ndjson.gz", "keychain"},
+	{"gh slackdump --encrypt-to age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p -o general.json.zst https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --encrypt-to ~/.ssh/id_ed25519.pub --compress zstd https://myworkspace.slack.com/archives/C09036MGFJ4 | aws s3 cp - s3://backups/general.json.zst.age", "keychain"},
+	{"gh slackdump --split-by count:10000 -o general.json https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --split day --format ndjson -o general https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump merge general.index.json -o general.json", ""},
+	{"gh slackdump stats -u --from 2024-01-01 --tz Europe/Prague https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump convert --format html --users-file users.json -o general.html general.json", ""},
+	{"gh slackdump view -u https://myworkspace.slack.com/archives/C09036MGFJ4/p1771747003176409", "keychain"},
+	{"gh slackdump view --collapse-threads general.json.gz", ""},
+	{"gh slackdump emoji -o emoji https://myworkspace.slack.com", "keychain"},
+	{"gh slackdump convert --format html --emoji-dir emoji -o general.html general.json", ""},
+	{"gh slackdump -u --format html -o general.html https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump -u --format csv -o general.csv https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump convert --format text --show-raw-ts general.json", ""},
+	{"gh slackdump -u --format csv --csv-rows reactions -o reactions.csv https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --format export -o slack-export https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump -u --format mattermost --mattermost-team eng -o general.jsonl https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --format zulip -o zulip-export https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump -u --format gh-markdown https://myworkspace.slack.com/archives/C09036MGFJ4/p1771747003176409 | gh issue create --title \"From Slack\" --body-file -", "keychain"},
+	{`gh slackdump -u --template-string '{{date "2006-01-02 15:04" .Time}} {{.User}}: {{plain .Text | abbrev 80}}' https://myworkspace.slack.com/archives/C09036MGFJ4`, "keychain"},
+	{"gh slackdump -u --threads-file triage.txt -o digest.md", "keychain"},
+	{"gh slackdump -u --format ndjson --ndjson-threads separate https://myworkspace.slack.com/archives/C09036MGFJ4 | jq -r .text", "keychain"},
+	{"gh slackdump --progress-fd 3 --from 2024-01-01 -o general.json https://myworkspace.slack.com/archives/C09036MGFJ4 3>progress.ndjson", "keychain"},
+	{"gh slackdump -o archive.json --release myorg/slack-archive@2024-06 --create-release https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump -u --format html --gist https://myworkspace.slack.com/archives/C09036MGFJ4/p1771747003176409", "keychain"},
+	{"gh slackdump --manifest -o general.json.gz https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --anonymize --anonymize-map pseudonyms.json -o general.json https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --redact --redact-pattern 'employee-id=E[0-9]{6}' -o general.json https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --files --max-file-size 25MB --download-concurrency 8 -o general.json https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --files --files-include pdf,docx --files-exclude 'image/*' -o general.json https://myworkspace.slack.com/archives/C09036MGFJ4", "keychain"},
+	{"gh slackdump --verify-files -o general.json", ""},
+	{"gh slackdump verify general.json.gz", ""},
+	{"gh slackdump quickstart", ""},
+	{"gh slackdump --test", ""},
+	{"gh slackdump doctor --json > doctor.json", ""},
+	{"gh slackdump --test --workspace https://myworkspace.slack.com", "keychain"},
+}
+
+// buildExamples renders the examples that work with the given capabilities.
+func buildExamples(caps []string) string {
+	var lines []string
+	for _, e := range examples {
+		if e.needs == "" || slices.Contains(caps, e.needs) {
+			lines = append(lines, "  "+e.cmd)
+		}
+	}
+	return strings.Join(lines, "\n")
 }
 
 func init() {
+	rootCmd.Example = buildExamples(sdauth.Capabilities())
+	rootCmd.Version = version + " (" + strings.Join(sdauth.Capabilities(), ", ") + ")"
+	addSessionFlags(rootCmd)
+	addOutputFlags(rootCmd)
 	rootCmd.Flags().BoolVar(&testFlag, "test", false, "Show detected Slack cookie source and value, then exit")
-	rootCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Write output to file instead of stdout")
+	rootCmd.Flags().StringVar(&workspace, "workspace", "", "With --test, also exchange the cookie and call auth.test against this workspace URL")
+	rootCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "With --test, print the cookie value unmasked")
+	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "Log debug detail; repeated per-page messages are summarized every 5s or 100 repeats")
+	rootCmd.PersistentFlags().BoolVar(&trace, "trace", false, "Log everything, including every repeated per-page message")
+	rootCmd.PersistentFlags().StringVar(&debugHTTP, "debug-http", "", "Trace every Slack request to stderr (method, URL, status, latency, protocol, size); =full also writes bodies to a temp directory")
+	rootCmd.PersistentFlags().Lookup("debug-http").NoOptDefVal = "on"
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return setupHTTPDebug()
+	}
+	rootCmd.Flags().BoolVar(&statsJSON, "stats-json", false, "Write the end-of-run statistics into the JSON document as a stats object instead of to stderr")
+	rootCmd.Flags().BoolVar(&jsonSummary, "json-summary", false, "Print the end-of-run summary of the files written as one JSON object on stderr, for wrappers")
+	rootCmd.Flags().IntVar(&progressFD, "progress-fd", 0, "Write NDJSON progress events to this inherited file descriptor (e.g. 3)")
+	rootCmd.Flags().StringVar(&progressFile, "progress-file", "", "Write NDJSON progress events to this file")
 	rootCmd.Flags().StringVar(&fromTime, "from", "", "Dump messages after this time (RFC3339 or YYYY-MM-DD)")
 	rootCmd.Flags().StringVar(&toTime, "to", "", "Dump messages before this time (RFC3339 or YYYY-MM-DD)")
-	rootCmd.Flags().BoolVarP(&resolveUsers, "users", "u", false, "Replace user IDs with Slack handles (cached per workspace)")
-	rootCmd.Flags().BoolVarP(&forceUsers, "force", "f", false, "Force re-fetch of the user cache (implies -u)")
+	rootCmd.Flags().IntVar(&lastN, "last", 0, "Dump only the channel's N newest top-level messages, with their threads, fetching no older pages than they take")
+	rootCmd.Flags().BoolVar(&sinceLast, "since-last-message", false, "For thread links, append only replies newer than those already in the -o file")
+	rootCmd.Flags().StringVar(&splitBy, "split-by", "", "With -o, write the dump as numbered files of count:<N> top-level messages each, plus an index")
+	rootCmd.Flags().StringVar(&splitPeriod, "split", "", "Write a file per UTC day or month of the top-level messages, e.g. 2024-01-15.json, and an index.json to the -o directory (day or month; json, ndjson and gh-markdown)")
+	rootCmd.MarkFlagsMutuallyExclusive("split-by", "split")
+	rootCmd.Flags().StringVar(&releaseSpec, "release", "", "Upload the -o file as an asset of this GitHub release (owner/repo@tag)")
+	rootCmd.Flags().BoolVar(&createRelease, "create-release", false, "Create the --release release if the tag has none")
+	rootCmd.Flags().BoolVar(&forceAsset, "force-asset", false, "Replace a --release asset with the same name")
+	rootCmd.Flags().MarkDeprecated("force-asset", "a --release asset with the same name is always replaced")
+	rootCmd.Flags().BoolVar(&gist, "gist", false, "Create a secret GitHub gist of the output and print its URL")
+	rootCmd.Flags().BoolVar(&gistPublic, "gist-public", false, "Make the --gist gist public")
+	rootCmd.Flags().BoolVar(&writeManifest, "manifest", false, "With -o, also write <output>.manifest.json with the SHA-256 and size of each file written and how the dump was made, for gh slackdump verify")
+	rootCmd.Flags().BoolVar(&anonymize, "anonymize", false, "Replace every user with a pseudonym (user-1, user-2…), numbered by first appearance, and leave out names, avatars and profile links")
+	rootCmd.Flags().StringVar(&anonymizeMap, "anonymize-map", "", "With --anonymize, also write which user ID (and handle, with -u) each pseudonym stands for to this JSON file")
+	rootCmd.Flags().StringSliceVar(&anonymizeKeep, "anonymize-keep", nil, "With --anonymize, keep these user IDs as they are, like Slackbot and workflow bots, e.g. U0ALERTBOT")
+	rootCmd.Flags().BoolVar(&redactText, "redact", false, "Replace email addresses, phone and card numbers, and AWS, Slack and GitHub tokens in message text with [REDACTED:<type>]")
+	rootCmd.Flags().StringArrayVar(&redactPatterns, "redact-pattern", nil, "Also redact matches of this regular expression, as [REDACTED:custom], or [REDACTED:<type>] given as <type>=<regexp>; repeatable")
+	rootCmd.Flags().BoolVar(&downloadFiles, "files", false, "With -o, download the files attached to messages into <output>__files and add each one's local_path to the JSON; with --format html, inline the avatars")
+	rootCmd.Flags().StringVar(&maxFileSize, "max-file-size", "", "With --files, skip files larger than this, e.g. 25MB (default no limit)")
+	rootCmd.Flags().StringVar(&maxFileSize, "files-max-size", "", "Same as --max-file-size")
+	rootCmd.Flags().MarkDeprecated("files-max-size", "use --max-file-size")
+	rootCmd.MarkFlagsMutuallyExclusive("max-file-size", "files-max-size")
+	rootCmd.Flags().StringSliceVar(&filesInclude, "files-include", nil, "With --files, download only files of these extensions or MIME types, e.g. pdf,docx,image/*")
+	rootCmd.Flags().StringSliceVar(&filesExclude, "files-exclude", nil, "With --files, don't download files of these extensions or MIME types, e.g. video/*")
+	rootCmd.Flags().IntVar(&downloadConcurrency, "download-concurrency", 4, "With --files, how many files to download at a time")
+	rootCmd.Flags().BoolVar(&verifyFiles, "verify-files", false, "Checksum the files --files downloaded next to -o again and report mismatches, without dumping or downloading")
+	rootCmd.Flags().BoolVar(&expandShared, "expand-shares", false, "Fetch the thread of every shared (forwarded) message the token can read")
+	rootCmd.Flags().BoolVar(&requireComplete, "require-complete", false, "After writing, check that every thread has all its replies and nothing was logged as a warning; exit with code 4 if not")
+	rootCmd.Flags().BoolVar(&estimate, "estimate", false, "After the dump, print the projected output size and memory use, then exit without writing")
+	rootCmd.Flags().BoolVar(&proceed, "proceed", false, "With --estimate, write the output after printing the estimate")
+	rootCmd.Flags().BoolVar(&noNormalize, "no-normalize", false, "Write messages as the session returned them, without sorting them by ts or dropping duplicates")
+	rootCmd.Flags().BoolVar(&normalizeEmoji, "normalize-emoji", false, "Rename reactions to canonical emoji names (e.g. thumbsup to +1, custom aliases to their target), merging duplicates")
+	rootCmd.Flags().StringVar(&threadsFile, "threads-file", "", "Dump the threads of this file's permalinks (one per line) into one Markdown digest, in the file's order or by time with --sort ts")
 	rootCmd.Args = func(cmd *cobra.Command, args []string) error {
-		if testFlag {
+		switch {
+		case testFlag || threadsFile != "":
 			return cobra.NoArgs(cmd, args)
+		case verifyFiles:
+			// Only -o's files are read, so the link may be left out.
+			return cobra.MaximumNArgs(1)(cmd, args)
 		}
 		return cobra.ExactArgs(1)(cmd, args)
 	}
 }
 
+// addOutputFlags adds the flags that choose and shape the output, which
+// convert shares, to cmd.
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Write output to file instead of stdout")
+	cmd.Flags().StringVar(&compressFlag, "compress", "", "Compress the output with gzip or zstd, e.g. for stdout pipelines (default: by the -o extension, .gz or .zst)")
+	cmd.Flags().StringArrayVar(&encryptTo, "encrypt-to", nil, "Encrypt the output with age to this recipient (age1…), SSH public key, or file of them; repeatable. Files written get .age appended")
+	cmd.Flags().BoolVar(&noMetadata, "no-metadata", false, "Leave out the channel and dump objects, writing the JSON shape of earlier versions")
+	cmd.Flags().BoolVar(&isoDates, "iso-dates", false, "Add ts_iso, thread_ts_iso and edited.ts_iso (RFC 3339) next to each message's Slack timestamps")
+	cmd.Flags().StringVar(&tzName, "tz", "", "Time zone of the --iso-dates timestamps, e.g. Europe/Prague or Local (default UTC)")
+	cmd.Flags().BoolVar(&permalinks, "permalinks", false, "Add each message's Slack permalink, made from its ts without API calls; HTML, gh-markdown and --threads-file link message times to it")
+	cmd.Flags().BoolVar(&showRawTS, "show-raw-ts", false, "Show each message's Slack ts after its time, e.g. \"· 1709377440.123456\", in --format html, text and gh-markdown")
+	cmd.Flags().StringVar(&fieldsSpec, "fields", "", "Write only these comma-separated keys of each message, e.g. ts,user,text,thread_ts,reactions (JSON and NDJSON)")
+	cmd.Flags().BoolVar(&compact, "compact", false, "Write JSON on one line instead of indented (default when stdout is not a terminal; --compact=false to indent)")
+	cmd.Flags().BoolVar(&overwrite, "overwrite", false, "Replace an -o file (or write into an -o directory) that already has content")
+	cmd.Flags().StringVar(&scoreSpec, "score", "", "Add an importance score per message with these weights (e.g. reactions=2,replies=1,reply_users=1,pinned=10)")
+	cmd.Flags().StringVar(&sortBy, "sort", "ts", "Order of top-level messages: ts or score")
+	cmd.Flags().IntVar(&topN, "top", 0, "Keep only the N highest-scoring top-level messages")
+	cmd.Flags().StringVar(&outputFormat, "format", "json", "Output format: json, html for a self-contained page laid out like the Slack client, csv for one row per message, text for reading in a terminal, ndjson for one JSON object per message, streamed, export for Slack's export directory layout, mattermost for a Mattermost bulk import file, zulip for a Zulip data export directory, or gh-markdown for GitHub comments of at most 65,536 characters")
+	cmd.Flags().StringVar(&templateFile, "template", "", "Write each top-level message through this Go text/template file instead of as JSON")
+	cmd.Flags().StringVar(&templateString, "template-string", "", "Like --template, with the template given inline (e.g. '{{.User}}: {{plain .Text}}')")
+	cmd.Flags().StringVar(&mattermostTeam, "mattermost-team", "", "With --format mattermost, the Mattermost team to import the channel into")
+	cmd.Flags().StringVar(&ndjsonThreads, "ndjson-threads", threadsInline, "With --format ndjson, where thread replies go: inline in their parent's record, or separate records after it")
+	cmd.Flags().StringVar(&emojiDir, "emoji-dir", "", "With --format html or gh-markdown, show custom emoji as the images in this directory from gh slackdump emoji")
+	cmd.Flags().IntVar(&htmlPageSize, "html-page-size", 5000, "With --format html and -o, start a new linked page after this many top-level messages")
+	cmd.Flags().StringVar(&csvDelimiter, "csv-delimiter", ",", "With --format csv, the field separator: one character, or tab for TSV")
+	cmd.Flags().StringVar(&csvRows, "csv-rows", csvRowsMessages, "With --format csv, what a row is: messages, or reactions for one row per reacting user with their position in the order users reacted")
+	cmd.Flags().StringArrayVar(&grepPatterns, "grep", nil, "Write only the messages matching this regular expression, with their matching replies, and list the patterns each matched; label it as <label>:<regexp>, e.g. payment:payment_id=\\d+; repeatable")
+	cmd.Flags().StringVar(&grepLogic, "grep-logic", "any", "How repeated --grep patterns combine: any keeps a message one of them matches, all one every one of them matches")
+	cmd.Flags().BoolVar(&firstReact, "first-reactor", false, "Add gh_slackdump_first_reactor, the earliest reacting user, to every message")
+}
+
+// addSessionFlags adds the flags openSession reads, for authenticating,
+// reaching Slack and resolving users, to cmd.
+func addSessionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cookieFile, "cookie-file", "", "Read the Slack d cookie from this file instead of the Slack desktop app")
+	cmd.Flags().BoolVarP(&resolveUsers, "users", "u", false, "Replace user IDs with Slack handles (cached per workspace)")
+	cmd.Flags().BoolVarP(&forceUsers, "force", "f", false, "Force re-fetch of the user cache (implies -u)")
+	cmd.Flags().BoolVar(&noCache, "no-cache", false, "Fetch fresh data instead of reading the user and conversations caches; they are still updated")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "Cache the user list under this directory (default $"+users.CacheDirEnv+", else $XDG_CACHE_HOME/gh-slackdump)")
+	cmd.Flags().StringVar(&tlsHello, "tls-hello", "auto", "TLS fingerprint to present: "+strings.Join(sdauth.TLSHellos, ", "))
+	cmd.Flags().StringVar(&caBundle, "ca-bundle", "", "PEM file with extra root CAs to trust (e.g. a TLS-intercepting proxy)")
+	cmd.Flags().BoolVar(&insecureTLS, "insecure-skip-verify", false, "Disable TLS certificate verification (unsafe)")
+	cmd.Flags().BoolVar(&pinCerts, "pin-slack-certs", false, "Require Slack's certificates to match the SPKI pins in --pin-file")
+	cmd.Flags().StringVar(&pinFile, "pin-file", "", "Pin file for --pin-slack-certs: one \"<host> <base64 sha256>\" per line")
+	cmd.MarkFlagsMutuallyExclusive("pin-slack-certs", "insecure-skip-verify")
+	cmd.Flags().DurationVar(&timeout, "timeout", sdauth.DefaultTimeout, "Fail a Slack request if no response arrives within this time (covers connect, TLS handshake, and response headers)")
+	cmd.Flags().Float64Var(&rateLimit, "rate-limit", sdauth.DefaultRateLimit, "Maximum Slack API requests per second, all methods together, by default Slack's Tier 3 (50 per minute); 0 disables pacing")
+	cmd.Flags().DurationVar(&outageMaxWait, "outage-max-wait", sdauth.DefaultOutageMaxWait, "How long to keep retrying while the Slack API answers with HTML (maintenance or incident) pages")
+	cmd.Flags().BoolVar(&followVanity, "follow-redirects", false, "For links on a non-Slack (vanity) host, follow its redirects to find the Slack workspace")
+	cmd.Flags().BoolVar(&ignoreMismatch, "ignore-workspace-mismatch", false, "Dump even if the cookie authenticates to a different workspace than the link's")
+}
+
+// runWithSummary runs a dump and, when it succeeds, prints the summary of
+// what it wrote.
+func runWithSummary(cmd *cobra.Command, args []string) error {
+	runStarted = time.Now()
+	if err := run(cmd, args); err != nil || testFlag || verifyFiles {
+		return err
+	}
+	progressReporter.HideStatus()
+	return printSummary(runStarted)
+}
+
+// runStarted is when the run began, for its elapsed time.
+var runStarted time.Time
+
 func run(cmd *cobra.Command, args []string) error {
 	if testFlag {
-		return runTest()
+		return runTest(context.Background())
+	}
+	if workspace != "" {
+		return errors.New("--workspace only works with --test")
+	}
+	if showSecrets {
+		return errors.New("--show-secrets only works with --test")
+	}
+	if verifyFiles {
+		return verifyDownloadedFiles(os.Stdout)
+	}
+	users.SetCacheDir(cacheDir)
+	if err := setupProgress(); err != nil {
+		return err
 	}
 
 	// When outputting to stdout, suppress all logging so only JSON is emitted.
 	// When writing to a file, log progress to stdout.
-	if outputFile == "" {
-		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError})))
+	if outputFile == "" && !verbose && !trace {
+		setupLogging(slog.LevelError, false)
+	} else {
+		setupLogging(logLevel(), false)
 	}
 
-	slackLink := args[0]
 	ctx := context.Background()
+	var digest []digestEntry
+	if threadsFile != "" {
+		if err := checkDigestFlags(cmd); err != nil {
+			return err
+		}
+		entries, err := readThreadsFile(threadsFile)
+		if err != nil {
+			return fmt.Errorf("--threads-file: %w", err)
+		}
+		digest, args = entries, []string{entries[0].url}
+	}
+	slackLink := args[0]
 
-	workspaceURL, err := extractWorkspaceURL(slackLink)
+	link, err := parseArchiveLink(slackLink)
 	if err != nil {
 		return err
 	}
-
-	slog.Info("authenticating", "workspace", workspaceURL)
-	provider, err := sdauth.NewProvider(ctx, workspaceURL)
+	if writeManifest && outputFile == "" {
+		return errors.New("--manifest requires -o")
+	}
+	if gist && outputFile == "" {
+		if sinceLast {
+			return errors.New("--since-last-message requires -o")
+		}
+		if err := setGistOutput(digest != nil); err != nil {
+			return err
+		}
+		defer removeTemp(gistTempDir)
+	}
+	if err := checkEncryptFlags(); err != nil {
+		return err
+	}
+	if err := resolveOutputPath(); err != nil {
+		return err
+	}
+	if err := checkOverwrite(overwriteTarget(), overwrite); err != nil {
+		return err
+	}
+	if err := checkAnonymizeFlags(); err != nil {
+		return err
+	}
+	if err := checkRedactFlags(); err != nil {
+		return err
+	}
+	if err := checkFilesFlags(); err != nil {
+		return err
+	}
+	opts, err := parseOutputOptions()
 	if err != nil {
 		return err
 	}
+	outputOptions = opts
+	if outputCompression, err = parseCompression(compressFlag, outputFile); err != nil {
+		return err
+	}
+	outputOptions.linkTarget = link.reply()
+	outputOptions.compact = compactOutput(cmd.Flags().Changed("compact"), term.FromEnv().IsTerminalOutput())
 
-	isEnterprise := strings.Contains(workspaceURL, ".enterprise.slack.com")
-	sd, err := slackdump.New(ctx, provider, slackdump.WithForceEnterprise(isEnterprise))
+	if releaseSpec != "" {
+		if outputFile == "" {
+			return errors.New("--release requires -o")
+		}
+		if _, err := parseReleaseTarget(releaseSpec); err != nil {
+			return err
+		}
+	} else if createRelease {
+		return errors.New("--create-release requires --release")
+	}
+	if gist && outputCompression != "" {
+		return errors.New("--gist: gists hold text, so the output can't be compressed")
+	}
+	if gistPublic && !gist {
+		return errors.New("--gist-public requires --gist")
+	}
+	if sinceLast {
+		if outputFile == "" {
+			return errors.New("--since-last-message requires -o")
+		}
+		if link.thread() == "" {
+			return errors.New("--since-last-message only works with thread links")
+		}
+		if fromTime != "" {
+			return errors.New("--since-last-message can't be combined with --from")
+		}
+		if estimate {
+			return errors.New("--since-last-message can't be combined with --estimate")
+		}
+	}
+	if lastN < 0 {
+		return errors.New("--last must be positive")
+	}
+	if lastN > 0 {
+		switch {
+		case link.thread() != "":
+			return errors.New("--last keeps a channel's newest messages, so it doesn't work with thread links")
+		case outputFormat == "ndjson":
+			return errors.New("--last can't be combined with --format ndjson, which writes messages as they are fetched")
+		}
+	}
+	var split splitSpec
+	if splitBy != "" {
+		if split, err = parseSplitBy(splitBy); err != nil {
+			return fmt.Errorf("--split-by: %w", err)
+		}
+	}
+	if splitPeriod != "" {
+		if split, err = parseSplitPeriod(splitPeriod); err != nil {
+			return fmt.Errorf("--split: %w", err)
+		}
+	}
+	if split.splits() {
+		switch {
+		case outputFile == "":
+			return fmt.Errorf("%s requires -o", split.flag())
+		case releaseSpec != "":
+			return fmt.Errorf("%s can't be combined with --release", split.flag())
+		case sinceLast:
+			return fmt.Errorf("%s can't be combined with --since-last-message", split.flag())
+		}
+	}
+	tmpl, comma, err := checkFormatFlags(split)
 	if err != nil {
 		return err
 	}
+	if proceed && !estimate {
+		return errors.New("--proceed requires --estimate")
+	}
 
-	slog.Info("dumping conversation", "link", slackLink)
-	oldest, err := parseTime(fromTime)
+	sess, err := openSession(ctx, slackLink)
 	if err != nil {
-		return fmt.Errorf("--from: %w", err)
+		return err
+	}
+	defer sess.close()
+	sd, provider, workspaceURL := sess.sd, sess.provider, sess.workspaceURL
+	slackLink = sess.link
+	if permalinks {
+		outputOptions.permalinks, outputOptions.permalinkChannel = workspaceURL, link.channel
+	}
+	if digest == nil {
+		dumpChannel = link.channel
+	}
+	dumpAuth, dumpWorkspace = sd.Info(), workspaceURL
+	if digest != nil {
+		progressReporter.Stage(progress.StageDumping)
+		if err := writeDigest(ctx, sd, provider, workspaceURL, digest, cmd.Flags().Changed("sort")); err != nil {
+			return err
+		}
+		return publishOutput(ctx)
 	}
+
+	slog.Info("dumping conversation", "link", slackLink, "target", link.target())
 	latest, err := parseTime(toTime)
 	if err != nil {
 		return fmt.Errorf("--to: %w", err)
 	}
-	conv, err := sd.Dump(ctx, slackLink, oldest, latest)
+	progressReporter.Stage(progress.StageDumping)
+	if sinceLast {
+		setMetadata(ctx, sd, &types.Conversation{ID: link.channel}, workspaceURL, time.Time{}, latest)
+		if err := dumpSinceLastMessage(ctx, sd, provider, link, workspaceURL, latest); err != nil {
+			return err
+		}
+		if requireComplete {
+			// Check the whole thread in the file, not just the new replies.
+			conv, err := loadPreviousDump(outputFile)
+			if err != nil {
+				return fmt.Errorf("--require-complete: %w", err)
+			}
+			if err := verifyComplete(progressReporter.StatusWriter(os.Stderr), conv, time.Time{}, latest); err != nil {
+				return err
+			}
+		}
+		return publishOutput(ctx)
+	}
+	oldest, err := parseTime(fromTime)
+	if err != nil {
+		return fmt.Errorf("--from: %w", err)
+	}
+	progressReporter.DumpRange(oldest, latest)
+	if outputFormat == "ndjson" {
+		if err := dumpNDJSON(ctx, sd, provider, link, workspaceURL, oldest, latest, split); err != nil {
+			return err
+		}
+		return publishOutput(ctx)
+	}
+	// --files downloads as the messages come in, unless --estimate may stop
+	// the run before it writes.
+	var files *fileQueue
+	if downloadsAttachments() && (!estimate || proceed) {
+		if files, err = startFileDownloads(ctx, provider); err != nil {
+			return err
+		}
+		defer files.stop()
+	}
+	if spoolsDocument(link) {
+		if err := dumpSpooled(ctx, sd, provider, link, workspaceURL, oldest, latest, files); err != nil {
+			return err
+		}
+		return publishOutput(ctx)
+	}
+	conv, err := dumpConversation(ctx, sd, link, oldest, latest, files)
 	if err != nil {
 		return err
 	}
+	warnMissingTarget(conv.Messages, outputOptions.linkTarget)
+	if outputOptions.grepMatches = grepConversation(conv); messageGrep != nil {
+		slog.Info("kept the messages matching --grep", "matching", len(outputOptions.grepMatches), "messages", len(conv.Messages))
+	}
+	setMetadata(ctx, sd, conv, workspaceURL, oldest, latest)
 
-	if forceUsers {
-		resolveUsers = true
+	convs := []*types.Conversation{conv}
+	if expandShared {
+		progressReporter.Stage(progress.StageExpandShares)
+		outputOptions.sharedThreads = expandShares(ctx, sd, conv)
+		for _, msgs := range outputOptions.sharedThreads {
+			convs = append(convs, &types.Conversation{Messages: msgs})
+		}
+	}
+	if err := resolveConversationUsers(ctx, provider, workspaceURL, convs...); err != nil {
+		return err
+	}
+	if normalizeEmoji {
+		normalizeConversationEmoji(ctx, sd, convs...)
 	}
-	if resolveUsers {
-		handleMap, err := users.LoadOrFetch(ctx, sd, workspaceURL, forceUsers)
+
+	if estimate {
+		est, err := estimateOutput(conv, outputOptions)
 		if err != nil {
 			return err
 		}
-		users.ResolveConversation(conv, handleMap)
-		slog.Info("resolved user IDs", "users", len(handleMap))
+		fmt.Fprintln(progressReporter.StatusWriter(os.Stderr), est)
+		ch := conversationInfo(ctx, conv)
+		if note := postureNote(cmp.Or(ch.Name, conv.ID), ch.Posture()); note != "" {
+			fmt.Fprintln(progressReporter.StatusWriter(os.Stderr), note)
+		}
+		if !proceed {
+			return nil
+		}
 	}
 
-	var out *os.File
+	if files != nil {
+		files.add(conv.Messages)
+		if outputOptions.localFiles, err = files.wait(); err != nil {
+			return err
+		}
+	}
+
+	progressReporter.Stage(progress.StageWriting)
+	if statsJSON {
+		outputOptions.stats = runStats.finished(runStarted)
+		outputOptions.stats.Downloads = fileDownloads
+	}
+	switch {
+	case outputFormat == "gh-markdown" && split.period != "":
+		err = writeGitHubMarkdownSplit(outputFile, slackLink, buildOutput(conv, outputOptions), split)
+	case split.splits():
+		err = writeSplit(outputFile, buildOutput(conv, outputOptions), split)
+	case tmpl != nil:
+		err = writeTemplate(outputFile, buildOutput(conv, outputOptions), tmpl)
+	case outputFormat == "html":
+		doc, avatars := buildOutput(conv, outputOptions), htmlAvatars(workspaceURL)
+		var images map[string]string
+		if downloadFiles {
+			var client *http.Client
+			if client, err = provider.HTTPClient(); err != nil {
+				return err
+			}
+			images = inlineAvatars(ctx, client, doc, avatars)
+		}
+		err = writeHTML(outputFile, doc, htmlPageSize, avatars, images)
+	case outputFormat == "csv":
+		err = writeCSV(outputFile, buildOutput(conv, outputOptions), workspaceURL, comma)
+	case outputFormat == "text":
+		err = writeText(outputFile, buildOutput(conv, outputOptions), format.TextOptions{RawTS: showRawTS})
+	case outputFormat == "export":
+		err = exportConversation(ctx, sd, outputFile, conv)
+	case outputFormat == "mattermost":
+		err = writeMattermost(outputFile, &conversationInfo(ctx, conv).Channel, buildOutput(conv, outputOptions), mattermostTeam)
+	case outputFormat == "zulip":
+		loadNames := func() (map[string]string, error) { return zulipNames(ctx, provider, workspaceURL) }
+		err = writeZulip(outputFile, &conversationInfo(ctx, conv).Channel, cmp.Or(sd.Info().Team, workspaceURL), loadNames, buildOutput(conv, outputOptions))
+	case outputFormat == "gh-markdown":
+		err = writeGitHubMarkdown(outputFile, slackLink, buildOutput(conv, outputOptions))
+	default:
+		err = writeOutput(conv)
+	}
+	if err != nil {
+		return err
+	}
+	if requireComplete {
+		if err := verifyComplete(progressReporter.StatusWriter(os.Stderr), conv, oldest, latest); err != nil {
+			return err
+		}
+	}
+	return publishOutput(ctx)
+}
+
+// writesDirectory reports whether --format, or --split, writes its files
+// to the directory -o names.
+func writesDirectory() bool {
+	return outputFormat == "export" || outputFormat == "zulip" || outputFormat == "gh-markdown" || splitPeriod != ""
+}
+
+// resolveOutputPath checks -o against --format: the directory export, zulip
+// and gh-markdown write (gh-markdown writes a single part to stdout without
+// it) and --split writes, or the file of the others. The dump and convert
+// share it.
+func resolveOutputPath() error {
+	if !writesDirectory() {
+		_, err := resolveOutput(outputFile)
+		return err
+	}
+	if outputFormat == "gh-markdown" && outputFile == "" && splitPeriod == "" {
+		return nil
+	}
+	if err := resolveExportDir(outputFile); err != nil {
+		return err
+	}
+	// --split compresses each of its files.
+	if compressFlag != "" && splitPeriod == "" {
+		return fmt.Errorf("--format %s writes a directory, so --compress doesn't apply", outputFormat)
+	}
+	return nil
+}
+
+// checkFormatFlags validates --format and the flags that shape the output
+// against it, and parses --template and --csv-delimiter. The dump and
+// convert share it; flags a command lacks are at their zero values.
+func checkFormatFlags(split splitSpec) (tmpl *format.Template, comma rune, err error) {
+	tmpl, err = parseTemplateFlags(templateFile, templateString)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := checkGrepFlags(); err != nil {
+		return nil, 0, err
+	}
+	if tmpl != nil {
+		switch {
+		case outputFormat != "json":
+			return nil, 0, errors.New("--template writes its own format, so it can't be combined with --format")
+		case split.splits():
+			return nil, 0, fmt.Errorf("--template can't be combined with %s", split.flag())
+		case sinceLast:
+			return nil, 0, errors.New("--template can't be combined with --since-last-message")
+		case estimate:
+			return nil, 0, errors.New("--estimate only estimates JSON output")
+		}
+	}
+	if sinceLast && (sortBy == "score" || topN > 0) {
+		return nil, 0, errors.New("--since-last-message rewrites the -o file with every message, so it can't be combined with --sort score or --top, which would keep only the ranked ones")
+	}
+	if isoDates && (tmpl != nil || (outputFormat != "json" && outputFormat != "ndjson")) {
+		return nil, 0, errors.New("--iso-dates adds keys to JSON messages, so it only applies to --format json and ndjson")
+	}
+	if statsJSON && (tmpl != nil || outputFormat != "json") {
+		return nil, 0, errors.New("--stats-json adds a stats object to the JSON document, so it only applies to --format json")
+	}
+	if statsJSON && split.splits() {
+		return nil, 0, fmt.Errorf("--stats-json can't be combined with %s: every file would carry the stats of the whole dump, and merge would drop them", split.flag())
+	}
+	if permalinks && (tmpl != nil || (outputFormat != "json" && outputFormat != "ndjson" && outputFormat != "html" && outputFormat != "gh-markdown")) {
+		return nil, 0, errors.New("--permalinks only applies to --format json, ndjson, html and gh-markdown and to --threads-file")
+	}
+	if showRawTS && (tmpl != nil || (outputFormat != "html" && outputFormat != "text" && outputFormat != "gh-markdown")) {
+		return nil, 0, errors.New("--show-raw-ts only applies to --format html, text and gh-markdown")
+	}
+	if emojiDir != "" {
+		if tmpl != nil || (outputFormat != "html" && outputFormat != "gh-markdown") {
+			return nil, 0, errors.New("--emoji-dir shows custom emoji as images, so it only applies to --format html and gh-markdown")
+		}
+		// The images are linked from where the pages go: next to the -o
+		// file of html, in the -o directory of gh-markdown.
+		base := filepath.Dir(outputFile)
+		if outputFormat == "gh-markdown" && outputFile != "" {
+			base = outputFile
+		}
+		if outputOptions.customEmoji, err = loadCustomEmoji(emojiDir, base); err != nil {
+			return nil, 0, err
+		}
+	}
+	if fieldsSpec != "" {
+		switch {
+		case tmpl != nil || (outputFormat != "json" && outputFormat != "ndjson"):
+			return nil, 0, errors.New("--fields prunes JSON messages, so it only applies to --format json and ndjson")
+		case sinceLast && !outputOptions.fields["ts"]:
+			return nil, 0, errors.New("--since-last-message reads the ts of the messages in the file back, so --fields must include ts")
+		}
+	}
+	switch outputFormat {
+	case "json":
+	case "html", "csv", "text":
+		if outputFormat == "html" && htmlPageSize <= 0 {
+			return nil, 0, errors.New("--html-page-size must be positive")
+		}
+		if outputFormat == "csv" {
+			if comma, err = parseCSVDelimiter(csvDelimiter); err != nil {
+				return nil, 0, fmt.Errorf("--csv-delimiter: %w", err)
+			}
+			if csvRows != csvRowsMessages && csvRows != csvRowsReactions {
+				return nil, 0, fmt.Errorf("--csv-rows: unknown mode %q: use messages or reactions", csvRows)
+			}
+		}
+		switch {
+		case split.splits():
+			return nil, 0, fmt.Errorf("--format %s can't be combined with %s", outputFormat, split.flag())
+		case sinceLast:
+			return nil, 0, fmt.Errorf("--format %s can't be combined with --since-last-message", outputFormat)
+		case releaseSpec != "":
+			return nil, 0, fmt.Errorf("--format %s can't be combined with --release", outputFormat)
+		case estimate:
+			return nil, 0, errors.New("--estimate only estimates JSON output")
+		}
+	case "ndjson":
+		switch {
+		case ndjsonThreads != threadsInline && ndjsonThreads != threadsSeparate:
+			return nil, 0, fmt.Errorf("--ndjson-threads: unknown mode %q: use inline or separate", ndjsonThreads)
+		case split.count > 0:
+			return nil, 0, errors.New("--format ndjson writes messages as they are fetched, newest first, so it can only be split by day or month, with --split")
+		case sinceLast:
+			return nil, 0, errors.New("--format ndjson can't be combined with --since-last-message")
+		case estimate:
+			return nil, 0, errors.New("--estimate only estimates JSON output")
+		case sortBy == "score" || topN > 0:
+			return nil, 0, errors.New("--format ndjson writes messages as they are fetched, so it can't be combined with --sort score or --top")
+		case requireComplete:
+			return nil, 0, errors.New("--require-complete can't check --format ndjson output, which isn't kept after it is written")
+		}
+	case "export":
+		switch {
+		case resolveUsers || forceUsers:
+			return nil, 0, errors.New("--format export keeps user IDs, as Slack's exports do; names come from its users.json, so -u and -f don't apply")
+		case scoreSpec != "" || sortBy == "score" || topN > 0 || firstReact || expandShared:
+			return nil, 0, errors.New("--format export writes messages as Slack does, so it can't be combined with --score, --sort score, --top, --first-reactor or --expand-shares")
+		case split.splits():
+			return nil, 0, fmt.Errorf("--format export can't be combined with %s", split.flag())
+		case sinceLast:
+			return nil, 0, errors.New("--format export can't be combined with --since-last-message")
+		case releaseSpec != "":
+			return nil, 0, errors.New("--format export writes a directory, which --release can't upload")
+		case estimate:
+			return nil, 0, errors.New("--estimate only estimates JSON output")
+		}
+	case "mattermost":
+		switch {
+		case mattermostTeam == "":
+			return nil, 0, errors.New("--format mattermost requires --mattermost-team, the team to import the channel into")
+		case !resolveUsers && !forceUsers:
+			return nil, 0, errors.New("--format mattermost requires -u: Mattermost posts name their authors by username")
+		case split.splits():
+			return nil, 0, fmt.Errorf("--format mattermost can't be combined with %s", split.flag())
+		case sinceLast:
+			return nil, 0, errors.New("--format mattermost can't be combined with --since-last-message")
+		case releaseSpec != "":
+			return nil, 0, errors.New("--format mattermost can't be combined with --release")
+		case estimate:
+			return nil, 0, errors.New("--estimate only estimates JSON output")
+		}
+	case "zulip":
+		switch {
+		case resolveUsers || forceUsers:
+			return nil, 0, errors.New("--format zulip maps user IDs to Zulip users itself, from the user cache, so -u and -f don't apply")
+		case split.splits():
+			return nil, 0, fmt.Errorf("--format zulip can't be combined with %s", split.flag())
+		case sinceLast:
+			return nil, 0, errors.New("--format zulip can't be combined with --since-last-message")
+		case releaseSpec != "":
+			return nil, 0, errors.New("--format zulip writes a directory, which --release can't upload")
+		case estimate:
+			return nil, 0, errors.New("--estimate only estimates JSON output")
+		}
+	case "gh-markdown":
+		switch {
+		case compressFlag != "":
+			return nil, 0, errors.New("--format gh-markdown writes Markdown to paste into GitHub, so --compress doesn't apply")
+		case split.count > 0:
+			return nil, 0, errors.New("--format gh-markdown splits its output into parts itself, so it can't be combined with --split-by; --split writes a file per day or month")
+		case sinceLast:
+			return nil, 0, errors.New("--format gh-markdown can't be combined with --since-last-message")
+		case releaseSpec != "":
+			return nil, 0, errors.New("--format gh-markdown writes a directory, which --release can't upload")
+		case estimate:
+			return nil, 0, errors.New("--estimate only estimates JSON output")
+		}
+	default:
+		return nil, 0, fmt.Errorf("--format: unknown format %q: use json, html, csv, text, ndjson, export, mattermost, zulip or gh-markdown", outputFormat)
+	}
+	return tmpl, comma, nil
+}
+
+// session is an authenticated Slack session for a link's workspace, shared
+// by the dump and the stats subcommand.
+type session struct {
+	sd           *slackdump.Session
+	provider     *sdauth.Provider
+	workspaceURL string
+	// link is the Slack link, after any --follow-redirects.
+	link string
+}
+
+// openSession authenticates to the workspace of slackLink and opens the
+// conversations cache for it. It checks that the cookie is for that
+// workspace unless --ignore-workspace-mismatch is set. The caller must
+// close the session.
+func openSession(ctx context.Context, slackLink string) (*session, error) {
+	if rateLimit < 0 {
+		return nil, errors.New("--rate-limit can't be negative")
+	}
+	if outageMaxWait <= 0 {
+		return nil, errors.New("--outage-max-wait must be positive")
+	}
+	workspaceURL, err := extractWorkspaceURL(slackLink)
+	if err != nil && followVanity {
+		if slackLink, err = followVanityLink(ctx, slackLink); err == nil {
+			workspaceURL, err = extractWorkspaceURL(slackLink)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("authenticating", "workspace", workspaceURL)
+	progressReporter.Stage(progress.StageAuthenticating)
+	if insecureTLS {
+		fmt.Fprintln(os.Stderr, "WARNING: --insecure-skip-verify disables TLS certificate verification; your Slack session can be intercepted")
+	}
+	provider, err := sdauth.NewProvider(ctx, workspaceURL, authSources(), transportOptions())
+	if err != nil {
+		return nil, authHint(err)
+	}
+	progressReporter.CountRequests(func() int { return provider.Stats().Requests })
+	progressReporter.CountWaited(func() time.Duration { return provider.Stats().Waited })
+	rateLimitWaits = func() time.Duration { return provider.Stats().Waited }
+
+	u, _ := url.Parse(workspaceURL)
+	sd, err := slackdump.New(ctx, provider, slackdump.WithForceEnterprise(sdauth.IsEnterpriseHost(u.Hostname())))
+	if err != nil {
+		logRequestStats(provider)
+		return nil, errs.Wrap(errs.ErrAuth, errs.Classify(err))
+	}
+	hc, err := provider.HTTPClient()
+	if err != nil {
+		logRequestStats(provider)
+		return nil, err
+	}
+	conversationCache = channels.Open(filepath.Join(users.CacheRoot(), u.Hostname(), "conversations.json"), channels.NewFetcher(hc, provider.SlackToken(), slack.APIURL))
+	conversationCache.SkipReads = noCache
+	s := &session{sd: sd, provider: provider, workspaceURL: workspaceURL, link: slackLink}
+	if err := checkWorkspaceMatch(workspaceURL, sd.Info()); err != nil {
+		if !ignoreMismatch {
+			s.close()
+			return nil, err
+		}
+		slog.Warn("continuing despite workspace mismatch", "error", err)
+	}
+	return s, nil
+}
+
+// close writes the conversations cache back and logs the requests made.
+func (s *session) close() {
+	saveConversationCache()
+	logRequestStats(s.provider)
+}
+
+// dumpConversation fetches the link's channel or thread between oldest and
+// latest, normalized and counted into runStats. Each chunk's files are added
+// to files, when it isn't nil, as the chunk comes in. With --last, the
+// fetch stops at the page holding the channel's newest --last messages, and
+// only those are kept; their files are left to the caller, as the last page
+// holds older messages too.
+func dumpConversation(ctx context.Context, sd *slackdump.Session, link archiveLink, oldest, latest time.Time, files *fileQueue) (*types.Conversation, error) {
+	report := progressReporter.ProcessFunc()
+	process := func(chunk []types.Message, channelID string) (slackdump.ProcessResult, error) {
+		if lastN == 0 {
+			files.add(chunk)
+		}
+		return report(chunk, channelID)
+	}
+	processFns := []slackdump.ProcessFunc{process}
+	last := &lastCollector{n: lastN}
+	if lastN > 0 {
+		processFns = append(processFns, last.processFunc())
+	}
+	conv, err := sd.Dump(ctx, link.target(), oldest, latest, processFns...)
+	if errors.Is(err, errLastFetched) {
+		slog.Info("stopped fetching at the newest messages", "last", lastN)
+		conv = &types.Conversation{ID: link.channel, Messages: last.messages()}
+		conv.Name = conversationInfo(ctx, conv).Name
+		err = nil
+	}
+	if err != nil {
+		return nil, errs.Classify(err)
+	}
+	normalizeConversation(conv)
+	countMessages(conv.Messages)
+	return conv, nil
+}
+
+// authSources returns where to read the Slack cookie from: --cookie-file, or
+// the Slack desktop app.
+func authSources() []sdauth.AuthSource {
+	if cookieFile != "" {
+		return []sdauth.AuthSource{sdauth.FileSource{Path: cookieFile}}
+	}
+	return sdauth.DefaultSources()
+}
+
+// transportOptions collects the TLS flags for the auth package.
+func transportOptions() sdauth.TransportOptions {
+	return sdauth.TransportOptions{
+		Hello:              tlsHello,
+		CABundle:           caBundle,
+		InsecureSkipVerify: insecureTLS,
+		PinSlackCerts:      pinCerts,
+		PinFile:            pinFile,
+		Timeout:            timeout,
+		RateLimit:          rateLimit,
+		Debug:              httpDebug,
+		OutageMaxWait:      outageMaxWait,
+	}
+}
+
+// httpDebug traces requests for --debug-http, set up by setupHTTPDebug.
+var httpDebug *sdauth.HTTPDebug
+
+// setupHTTPDebug validates --debug-http and creates its tracer, reporting
+// where full dumps go.
+func setupHTTPDebug() error {
+	switch debugHTTP {
+	case "":
+		return nil
+	case "on", "full":
+	default:
+		return fmt.Errorf("--debug-http: unknown mode %q: use --debug-http or --debug-http=full", debugHTTP)
+	}
+	d, err := sdauth.NewHTTPDebug(debugHTTP == "full")
+	if err != nil {
+		return fmt.Errorf("--debug-http: %w", err)
+	}
+	if d.Dir != "" {
+		fmt.Fprintf(os.Stderr, "--debug-http=full: writing requests and responses to %s\n", d.Dir)
+	}
+	httpDebug = d
+	return nil
+}
+
+// progressReporter writes the --progress-fd/--progress-file stream and, with
+// -o, shows the progress on stderr; nil when none of these apply.
+var progressReporter *progress.Reporter
+
+// setupProgress opens the progress stream. Call it before setupLogging, which
+// forwards warnings to it.
+func setupProgress() error {
+	var w *os.File
+	switch {
+	case progressFD != 0 && progressFile != "":
+		return errors.New("--progress-fd and --progress-file can't be combined")
+	case progressFD == 1 && outputFile == "":
+		return errors.New("--progress-fd 1 is stdout, where the dump goes without -o")
+	case progressFD < 0:
+		return errors.New("--progress-fd must be a file descriptor number")
+	case progressFD != 0:
+		w = os.NewFile(uintptr(progressFD), "progress")
+		if _, err := w.Stat(); err != nil {
+			return fmt.Errorf("--progress-fd %d is not an open file descriptor", progressFD)
+		}
+	case progressFile != "":
+		f, err := os.Create(progressFile)
+		if err != nil {
+			return fmt.Errorf("--progress-file: %w", err)
+		}
+		w = f
+	case outputFile == "":
+		return nil
+	}
+	progressReporter = progress.New(w)
+	// With -o, show the progress on stderr too; writing to stdout stays
+	// silent.
 	if outputFile != "" {
-		f, err := os.Create(outputFile)
+		progressReporter.ShowStatus(os.Stderr, term.IsTerminal(os.Stderr))
+	}
+	return nil
+}
+
+// logRequestStats ends a run with the provider's request counters. Logs are
+// only shown when writing to a file.
+func logRequestStats(provider *sdauth.Provider) {
+	s := provider.Stats()
+	slog.Info("requests", "made", s.Requests, "rate_limited", s.RateLimited, "waited", s.Waited.Round(time.Millisecond))
+}
+
+// conversationCache answers the run's conversations.info lookups; run opens
+// it for the workspace once the session is up.
+var conversationCache *channels.Cache
+
+// saveConversationCache ends a run by writing the conversations cache back
+// and logging how many lookups it answered.
+func saveConversationCache() {
+	hits, misses := conversationCache.Stats()
+	if hits+misses > 0 {
+		slog.Info("conversations cache", "hits", hits, "misses", misses)
+	}
+	if err := conversationCache.Save(); err != nil {
+		slog.Warn("can't write conversations cache", "error", err)
+	}
+}
+
+// compactOutput reports whether to write compact JSON: as --compact says
+// when it is given, else when the output goes to a stdout that isn't a
+// terminal, such as a pipe into jq.
+func compactOutput(set, tty bool) bool {
+	if set {
+		return compact
+	}
+	return outputFile == "" && !tty
+}
+
+// parseOutputOptions validates the output flags before any API work.
+func parseOutputOptions() (encodeOptions, error) {
+	opts := encodeOptions{sortBy: sortBy, top: topN, firstReactor: firstReact}
+	switch sortBy {
+	case "ts", "score":
+	default:
+		return opts, fmt.Errorf("--sort: unknown order %q: use ts or score", sortBy)
+	}
+	if topN < 0 {
+		return opts, errors.New("--top must be positive")
+	}
+	if scoreSpec != "" {
+		w, err := parseScoreWeights(scoreSpec)
 		if err != nil {
-			return err
+			return opts, fmt.Errorf("--score: %w", err)
 		}
-		defer f.Close()
-		out = f
-	} else {
-		out = os.Stdout
+		opts.weights = &w
+	} else if sortBy == "score" || topN > 0 {
+		w := defaultScoreWeights
+		opts.weights = &w
+	}
+	if isoDates {
+		loc, err := parseTZ(tzName)
+		if err != nil {
+			return opts, err
+		}
+		opts.iso = loc
+	} else if tzName != "" {
+		return opts, errors.New("--tz sets the zone of --iso-dates, which isn't set")
+	}
+	if fieldsSpec != "" {
+		fields, err := parseFields(fieldsSpec)
+		if err != nil {
+			return opts, fmt.Errorf("--fields: %w", err)
+		}
+		opts.fields = fields
 	}
+	return opts, nil
+}
 
-	encoder := json.NewEncoder(out)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(conv); err != nil {
+// resolveConversationUsers replaces user IDs with handles when -u or -f is
+// set, or with pseudonyms with --anonymize, then masks the text with
+// --redact.
+func resolveConversationUsers(ctx context.Context, prov auth.Provider, workspaceURL string, convs ...*types.Conversation) error {
+	r, err := userResolver(ctx, prov, workspaceURL)
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		for _, conv := range convs {
+			users.ResolveConversation(conv, r)
+		}
+		if anonymize {
+			slog.Info("anonymized users", "users", len(pseudonyms.Mapping()))
+		} else {
+			slog.Info("resolved user IDs", "users", len(r.(users.HandleMap)))
+		}
+	}
+	redactConversations(convs...)
+	return nil
+}
+
+// loadHandles returns the workspace's user handles when -u or -f is set,
+// and nil otherwise.
+func loadHandles(ctx context.Context, prov auth.Provider, workspaceURL string) (users.HandleMap, error) {
+	if forceUsers {
+		resolveUsers = true
+	}
+	if !resolveUsers {
+		return nil, nil
+	}
+	progressReporter.Stage(progress.StageResolvingUsers)
+	uc, err := users.NewClient(prov)
+	if err != nil {
+		return nil, err
+	}
+	return users.LoadOrFetch(ctx, uc, workspaceURL, refetchUsers())
+}
+
+// overwriteTarget returns the path checkOverwrite guards: the -o file or
+// directory, or the index of a --split-by dump. --since-last-message
+// rewrites its file by design, so there is nothing to guard.
+func overwriteTarget() string {
+	switch {
+	case sinceLast || outputFile == "":
+		return ""
+	case splitBy != "":
+		return encryptedPath(indexPath(outputFile))
+	case writesDirectory():
+		return outputFile
+	}
+	return encryptedPath(outputFile)
+}
+
+// refetchUsers reports whether to fetch the user list even when it is
+// cached: with -f, or --no-cache, which unlike -f doesn't imply -u.
+func refetchUsers() bool {
+	if noCache && !forceUsers {
+		slog.Debug("bypassing user cache", "flag", "--no-cache")
+	}
+	return forceUsers || noCache
+}
+
+// htmlAvatars returns the avatars for --format html, which come with the
+// user cache and so only with -u, and never with --anonymize.
+func htmlAvatars(workspaceURL string) map[string]string {
+	if !resolveUsers || anonymize {
+		return nil
+	}
+	m, err := users.Avatars(workspaceURL)
+	if err != nil {
+		slog.Debug("no avatars", "error", err)
+		return nil
+	}
+	return m
+}
+
+// writeOutput encodes the conversation to the -o file, or to stdout. The
+// file is replaced only once the encoding succeeded.
+func writeOutput(conv *types.Conversation) error {
+	size, err := writeOutputTo(outputFile, func(w io.Writer) error {
+		return encodeConversation(w, conv)
+	})
+	if err != nil {
 		return err
 	}
 
 	if outputFile != "" {
-		slog.Info("output written", "file", outputFile)
+		slog.Info("output written", "file", encryptedPath(outputFile), "size", size)
 	}
 
 	return nil
 }
 
+// authHint appends a remediation hint to known token exchange failures.
+func authHint(err error) error {
+	var hint string
+	switch {
+	case errors.Is(err, sdauth.ErrSignedOut):
+		hint = "open the Slack desktop app, sign in to this workspace, and try again"
+	case errors.Is(err, sdauth.ErrChallenged):
+		hint = "Slack is challenging this network; open the workspace in a browser once, or retry from another network"
+	case errors.Is(err, sdauth.ErrEnterpriseGate):
+		hint = "your organization restricts this session; sign in through your organization's SSO in the Slack desktop app"
+	case errors.Is(err, sdauth.ErrAppBoundEncryption):
+		hint = "this Slack desktop app protects its cookies with app-bound encryption; copy the d cookie from a browser signed in to the workspace into a file and pass --cookie-file"
+	case errors.Is(err, sdauth.ErrUnsupportedSource):
+		hint = "this is a nokeychain build; install the full build to read the Slack desktop app's cookies"
+	default:
+		return err
+	}
+	return fmt.Errorf("%w\nhint: %s", err, hint)
+}
+
+// checkWorkspaceMatch reports an error when the session's auth.test identity
+// belongs to a different workspace than the link, which otherwise surfaces
+// as an unexplained channel_not_found. An Enterprise Grid session reports its
+// workspace's host, while links may use the org's (<org>.enterprise.slack.com)
+// or another workspace's of the org: with an enterprise ID in auth.test and
+// an enterprise host on either side, the hosts can't be compared.
+func checkWorkspaceMatch(workspaceURL string, info *slackdump.WorkspaceInfo) error {
+	want, err := url.Parse(workspaceURL)
+	if err != nil {
+		return err
+	}
+	got, err := url.Parse(info.URL)
+	if err != nil || got.Hostname() == "" {
+		// Nothing to compare against.
+		return nil
+	}
+	if strings.EqualFold(got.Hostname(), want.Hostname()) {
+		return nil
+	}
+	if info.EnterpriseID != "" && (sdauth.IsEnterpriseHost(got.Hostname()) || sdauth.IsEnterpriseHost(want.Hostname())) {
+		slog.Info("the link and the Slack cookie are on different hosts of one Enterprise Grid org", "link", want.Hostname(), "session", got.Hostname(), "enterprise", info.EnterpriseID)
+		return nil
+	}
+	return fmt.Errorf("the link is for %s, but the Slack cookie signs in as %s on %s (team %s)\n"+
+		"hint: sign in to %s in the Slack desktop app and check it with: gh slackdump --test --workspace %s\n"+
+		"hint: pass --ignore-workspace-mismatch if both are the same organization",
+		want.Hostname(), info.User, got.Hostname(), info.Team, want.Hostname(), workspaceURL)
+}
+
 // extractWorkspaceURL derives the workspace base URL from a Slack link.
 func extractWorkspaceURL(slackLink string) (string, error) {
 	u, err := url.Parse(slackLink)
@@ -164,12 +1682,28 @@ func extractWorkspaceURL(slackLink string) (string, error) {
 		return "", err
 	}
 	host := u.Hostname()
-	if !strings.HasSuffix(host, ".slack.com") {
+	if d := sdauth.SlackDomain(host); d == "" || host == d {
 		return "", &url.Error{Op: "parse", URL: slackLink, Err: os.ErrInvalid}
 	}
 	return u.Scheme + "://" + host, nil
 }
 
+// followVanityLink rewrites a link on a vanity host to the Slack host its
+// redirects lead to, keeping the path and query.
+func followVanityLink(ctx context.Context, slackLink string) (string, error) {
+	u, err := url.Parse(slackLink)
+	if err != nil {
+		return "", err
+	}
+	host, err := sdauth.ResolveSlackHost(ctx, slackLink, transportOptions())
+	if err != nil {
+		return "", fmt.Errorf("--follow-redirects: %w", err)
+	}
+	slog.Info("followed vanity host", "from", u.Hostname(), "to", host)
+	u.Scheme, u.Host = "https", host
+	return u.String(), nil
+}
+
 // parseTime parses a time string in RFC3339 or YYYY-MM-DD format. An empty
 // string returns a zero time.Time (meaning no bound).
 func parseTime(s string) (time.Time, error) {
@@ -184,21 +1718,142 @@ func parseTime(s string) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("invalid time %q: use RFC3339 (e.g. 2024-01-15T09:00:00Z) or YYYY-MM-DD", s)
 }
 
-func runTest() error {
-	cookie, err := sdauth.ReadCookie()
+func runTest(ctx context.Context) error {
+	var workspaceURL string
+	if workspace != "" {
+		u, err := extractWorkspaceURL(workspace)
+		if err != nil {
+			return fmt.Errorf("--workspace: %w", err)
+		}
+		workspaceURL = u
+	}
+
+	setupLogging(logLevel(), showSecrets)
+	slog.Info("build", "version", version, "capabilities", strings.Join(sdauth.Capabilities(), ","))
+	cookie, err := sdauth.ReadCookie(workspaceURL, authSources())
+	if err != nil {
+		return authHint(err)
+	}
+	// Masked by the log handler unless --show-secrets is set.
+	slog.Info("cookie", "value", cookie)
+	if workspaceURL == "" {
+		return nil
+	}
+
+	if insecureTLS {
+		fmt.Fprintln(os.Stderr, "WARNING: --insecure-skip-verify disables TLS certificate verification; your Slack session can be intercepted")
+	}
+	steps, err := sdauth.CheckWorkspace(ctx, workspaceURL, cookie, transportOptions())
 	if err != nil {
 		return err
 	}
-	v := cookie
-	if len(v) > 40 {
-		v = v[:40] + "..."
+	for _, s := range steps {
+		fmt.Println(formatCheckStep(s))
+	}
+	if last := steps[len(steps)-1]; last.Err != nil {
+		return authHint(fmt.Errorf("%s failed for %s: %w", last.Name, workspaceURL, last.Err))
 	}
-	slog.Info("cookie", "value", v)
 	return nil
 }
 
+// formatCheckStep renders one --test --workspace step as a single line.
+func formatCheckStep(s sdauth.CheckStep) string {
+	d := s.Duration.Round(time.Millisecond)
+	if s.Err != nil {
+		return fmt.Sprintf("FAIL %s (%s): %v", s.Name, d, s.Err)
+	}
+	return fmt.Sprintf("ok   %s (%s): %s", s.Name, d, s.Detail)
+}
+
+// loggedWarnings counts the warnings and errors logged during the run,
+// whatever the log level, for --require-complete.
+var loggedWarnings atomic.Int64
+
+// logThrottle is the installed log handler; main flushes its held-back
+// summaries before exiting.
+var logThrottle *logging.Throttle
+
+// setupLogging sends logs at level and above to stderr, with repeats of
+// high-frequency messages collapsed into summaries. Unless reveal is set,
+// Slack tokens, cookies and key material are masked first.
+func setupLogging(level slog.Level, reveal bool) {
+	if logThrottle != nil {
+		logThrottle.Flush()
+	}
+	var h slog.Handler = slog.NewTextHandler(progressReporter.StatusWriter(os.Stderr), &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && a.Value.Any() == logging.LevelTrace {
+				a.Value = slog.StringValue("TRACE")
+			}
+			return a
+		},
+	})
+	if progressReporter != nil {
+		h = progress.LogHandler(h, progressReporter)
+	}
+	h = logging.Count(h, slog.LevelWarn, &loggedWarnings)
+	if !reveal {
+		h = redact.NewHandler(h)
+	}
+	// slackdump logs each thread and message it processes at debug level.
+	logThrottle = logging.NewThrottle(h, "- getting thread", "- message")
+	slog.SetDefault(slog.New(logThrottle))
+}
+
+// logLevel returns the log level --verbose and --trace select.
+func logLevel() slog.Level {
+	switch {
+	case trace:
+		return logging.LevelTrace
+	case verbose:
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
 func main() {
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	setupLogging(slog.LevelInfo, false)
+	go handleInterrupts()
+	err := rootCmd.Execute()
+	logThrottle.Flush()
+	if err != nil {
+		progressReporter.End(redact.Error(err))
+	} else {
+		progressReporter.End(nil)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", redact.String(err.Error()))
+		if errors.Is(err, errs.ErrUnavailable) {
+			fmt.Fprintln(os.Stderr, "hint: Slack looks unavailable; check https://status.slack.com and run the dump again once it has recovered")
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+// handleInterrupts waits for SIGINT or SIGTERM and then exits, removing the
+// temporary files of writes in progress so none are left next to the
+// output; the files they would have replaced stay as they were.
+func handleInterrupts() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	sig := <-sigs
+	removeTempFiles()
+	logThrottle.Flush()
+	progressReporter.End(errors.New("interrupted"))
+	fmt.Fprintln(os.Stderr, "Error: interrupted by", sig)
+	os.Exit(exitInterrupted)
+}
+
+// exitCode maps an error class to the process exit code.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errs.ErrUnavailable):
+		return exitOutage
+	case errors.Is(err, errs.ErrPartial):
+		return exitIncomplete
 	}
+	return 1
 }
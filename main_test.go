@@ -1,8 +1,20 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	sdauth "github.com/wham/gh-slackdump/internal/auth"
+	"github.com/wham/gh-slackdump/internal/errs"
+
+	"github.com/rusq/slackdump/v3"
 )
 
 func TestExtractWorkspaceURL(t *testing.T) {
@@ -27,6 +39,26 @@ func TestExtractWorkspaceURL(t *testing.T) {
 			link: "https://myworkspace.slack.com/archives/C09036MGFJ4/p1771747003176409",
 			want: "https://myworkspace.slack.com",
 		},
+		{
+			name: "GovSlack workspace channel link",
+			link: "https://agency.slack-gov.com/archives/C09036MGFJ4",
+			want: "https://agency.slack-gov.com",
+		},
+		{
+			name: "GovSlack enterprise workspace channel link",
+			link: "https://agency.enterprise.slack-gov.com/archives/CMH59UX4P",
+			want: "https://agency.enterprise.slack-gov.com",
+		},
+		{
+			name:    "bare slack domain",
+			link:    "https://slack.com/archives/C09036MGFJ4",
+			wantErr: true,
+		},
+		{
+			name:    "lookalike domain",
+			link:    "https://myworkspace.notslack-gov.com/archives/C09036MGFJ4",
+			wantErr: true,
+		},
 		{
 			name:    "non-slack domain",
 			link:    "https://example.com/archives/C09036MGFJ4",
@@ -59,6 +91,11 @@ func TestVersion(t *testing.T) {
 	if rootCmd.Version == "" {
 		t.Error("rootCmd.Version should not be empty")
 	}
+	for _, c := range sdauth.Capabilities() {
+		if !strings.Contains(rootCmd.Version, c) {
+			t.Errorf("rootCmd.Version = %q, want it to list capability %q", rootCmd.Version, c)
+		}
+	}
 }
 
 func TestParseTime(t *testing.T) {
@@ -107,3 +144,167 @@ func TestParseTime(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthHint(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantHint string
+	}{
+		{name: "signed out", err: sdauth.ErrSignedOut, wantHint: "sign in to this workspace"},
+		{name: "challenged", err: sdauth.ErrChallenged, wantHint: "challenging this network"},
+		{name: "enterprise gate", err: sdauth.ErrEnterpriseGate, wantHint: "SSO"},
+		{name: "unsupported source", err: fmt.Errorf("reading Slack cookie: %w", sdauth.ErrUnsupportedSource), wantHint: "nokeychain build"},
+		{name: "app-bound encryption", err: sdauth.ErrAppBoundEncryption, wantHint: "--cookie-file"},
+		{name: "unknown error", err: errors.New("boom")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := fmt.Errorf("cookie did not work for workspace: %w", tt.err)
+			got := authHint(wrapped)
+			if !errors.Is(got, tt.err) {
+				t.Errorf("authHint() = %v, should wrap %v", got, tt.err)
+			}
+			if tt.wantHint == "" {
+				if got != wrapped {
+					t.Errorf("authHint() = %v, want error unchanged", got)
+				}
+				return
+			}
+			if !strings.Contains(got.Error(), "hint: ") || !strings.Contains(got.Error(), tt.wantHint) {
+				t.Errorf("authHint() = %q, want hint containing %q", got, tt.wantHint)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "success", want: 0},
+		{name: "outage", err: fmt.Errorf("dumping messages: %w", sdauth.ErrSlackOutage), want: exitOutage},
+		{name: "incomplete", err: errIncomplete, want: exitIncomplete},
+		{name: "auth", err: authHint(fmt.Errorf("cookie did not work: %w", sdauth.ErrSignedOut)), want: 1},
+		{name: "other", err: errors.New("boom"), want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorClasses(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "signed out", err: sdauth.ErrSignedOut, want: errs.ErrAuth},
+		{name: "challenged", err: sdauth.ErrChallenged, want: errs.ErrAuth},
+		{name: "enterprise gate", err: sdauth.ErrEnterpriseGate, want: errs.ErrAuth},
+		{name: "unsupported source", err: sdauth.ErrUnsupportedSource, want: errs.ErrUnsupportedPlatform},
+		{name: "app-bound encryption", err: sdauth.ErrAppBoundEncryption, want: errs.ErrUnsupportedPlatform},
+		{name: "outage", err: sdauth.ErrSlackOutage, want: errs.ErrUnavailable},
+		{name: "incomplete", err: errIncomplete, want: errs.ErrPartial},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := authHint(fmt.Errorf("wrapped: %w", tt.err)); !errors.Is(err, tt.want) {
+				t.Errorf("%v is not of class %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatCheckStep(t *testing.T) {
+	tests := []struct {
+		name string
+		step sdauth.CheckStep
+		want string
+	}{
+		{
+			name: "ok",
+			step: sdauth.CheckStep{Name: "auth.test", Duration: 123456789 * time.Nanosecond, Detail: "user alice on team Acme"},
+			want: "ok   auth.test (123ms): user alice on team Acme",
+		},
+		{
+			name: "failed",
+			step: sdauth.CheckStep{Name: "token exchange", Duration: 2 * time.Second, Err: errors.New("boom")},
+			want: "FAIL token exchange (2s): boom",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatCheckStep(tt.step); got != tt.want {
+				t.Errorf("formatCheckStep() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckWorkspaceMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		link       string
+		infoURL    string
+		enterprise string
+		wantErr    bool
+	}{
+		{name: "same workspace", infoURL: "https://myworkspace.slack.com/"},
+		{name: "host case differs", infoURL: "https://MyWorkspace.slack.com/"},
+		{name: "no URL in auth.test", infoURL: ""},
+		{name: "other workspace", infoURL: "https://personal.slack.com/", wantErr: true},
+		{name: "org link from a member workspace", link: "https://acme.enterprise.slack.com", infoURL: "https://myworkspace.slack.com/", enterprise: "E0123"},
+		{name: "workspace link from the org", infoURL: "https://acme.enterprise.slack.com/", enterprise: "E0123"},
+		{name: "org link without an enterprise session", link: "https://acme.enterprise.slack.com", infoURL: "https://myworkspace.slack.com/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link := cmp.Or(tt.link, "https://myworkspace.slack.com")
+			info := &slackdump.WorkspaceInfo{URL: tt.infoURL, User: "alice", Team: "Personal", EnterpriseID: tt.enterprise}
+			err := checkWorkspaceMatch(link, info)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkWorkspaceMatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				return
+			}
+			for _, want := range []string{"myworkspace.slack.com", "alice", "Personal", "--ignore-workspace-mismatch", "--test --workspace"} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("checkWorkspaceMatch() = %q, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNoCache(t *testing.T) {
+	t.Cleanup(func() { noCache, forceUsers, resolveUsers = false, false, false })
+	noCache = true
+
+	// Without -u the user list isn't needed, so --no-cache doesn't fetch it.
+	if m, err := loadHandles(context.Background(), nil, "https://example.slack.com"); m != nil || err != nil || resolveUsers {
+		t.Errorf("loadHandles() = %v, %v; --no-cache implied -u", m, err)
+	}
+	// With -u it re-fetches, as -f does; both together are the same.
+	if !refetchUsers() {
+		t.Error("refetchUsers() = false with --no-cache")
+	}
+	forceUsers = true
+	if !refetchUsers() {
+		t.Error("refetchUsers() = false with --no-cache and -f")
+	}
+
+	// The -o file of --since-last-message is state, not a cache: it is read.
+	path := filepath.Join(t.TempDir(), "thread.json")
+	os.WriteFile(path, []byte(`{"channel_id":"C1","messages":[{"ts":"1.000001"}]}`), 0o644)
+	if prev, err := loadPreviousDump(path); err != nil || prev.ID != "C1" {
+		t.Errorf("loadPreviousDump() with --no-cache = %v, %v", prev, err)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rusq/slackdump/v3"
+	"github.com/spf13/cobra"
+)
+
+// manifestSuffix is appended to the output's name to name its --manifest.
+const manifestSuffix = ".manifest.json"
+
+var writeManifest bool
+
+// dumpAuth is the auth.test identity of the run's session and dumpWorkspace
+// the workspace URL of its link, for the --manifest; run sets them.
+var (
+	dumpAuth      *slackdump.WorkspaceInfo
+	dumpWorkspace string
+)
+
+// dumpManifest is the --manifest of a dump: how it was made, and the size
+// and SHA-256 of each file it wrote, for gh slackdump verify.
+type dumpManifest struct {
+	Tool        string `json:"tool"`
+	Version     string `json:"version"`
+	GeneratedAt string `json:"generated_at"`
+	// Workspace is the host of the link's workspace.
+	Workspace string           `json:"workspace"`
+	User      *manifestUser    `json:"user,omitempty"`
+	Channel   *manifestChannel `json:"channel,omitempty"`
+	// Requested is the --from and --to range, Actual the oldest and newest
+	// message dumped; RFC 3339 in UTC, empty when open or nothing was.
+	Requested manifestRange `json:"requested"`
+	Actual    manifestRange `json:"actual"`
+	// Messages and Replies count the top-level messages and thread
+	// replies the run dumped.
+	Messages int            `json:"messages"`
+	Replies  int            `json:"replies"`
+	Files    []manifestFile `json:"files"`
+}
+
+// manifestUser is the user the Slack cookie signs in as, per auth.test.
+type manifestUser struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	TeamID string `json:"team_id,omitempty"`
+}
+
+type manifestChannel struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+type manifestRange struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// manifestFile is a file of the output, its path relative to the
+// manifest's directory, with slashes.
+type manifestFile struct {
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// manifestPath returns the --manifest path for the -o output: next to the
+// file written, or the directory of the formats that write one.
+func manifestPath() string {
+	if writesDirectory() {
+		return filepath.Clean(outputFile) + manifestSuffix
+	}
+	return encryptedPath(outputFile) + manifestSuffix
+}
+
+// writeDumpManifest writes the --manifest of the files the run wrote. It
+// isn't encrypted with --encrypt-to, so it can be verified without the key.
+func writeDumpManifest(ctx context.Context) error {
+	path := manifestPath()
+	m := newManifest(ctx, time.Now())
+	var paths []string
+	seen := map[string]bool{"": true, path: true, anonymizeMapPath(): true}
+	writtenFiles.Lock()
+	for _, f := range writtenFiles.files {
+		if !seen[f.path] {
+			seen[f.path] = true
+			paths = append(paths, f.path)
+		}
+	}
+	writtenFiles.Unlock()
+	var err error
+	if m.Files, err = manifestFiles(filepath.Dir(path), paths); err != nil {
+		return fmt.Errorf("--manifest: %w", err)
+	}
+	f, err := createPlainAtomic(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		f.abort()
+		return err
+	}
+	if err := f.commit(); err != nil {
+		return err
+	}
+	slog.Info("manifest written", "file", path, "files", len(m.Files))
+	return nil
+}
+
+// newManifest returns the manifest of the run, without its files,
+// generated at now.
+func newManifest(ctx context.Context, now time.Time) *dumpManifest {
+	m := &dumpManifest{Tool: "gh-slackdump", Version: version, GeneratedAt: now.UTC().Format(time.RFC3339), Files: []manifestFile{}}
+	if u, err := url.Parse(dumpWorkspace); err == nil {
+		m.Workspace = u.Hostname()
+	}
+	if dumpAuth != nil && !anonymize {
+		m.User = &manifestUser{ID: dumpAuth.UserID, Name: dumpAuth.User, TeamID: dumpAuth.TeamID}
+	}
+	if dumpChannel != "" {
+		m.Channel = &manifestChannel{ID: dumpChannel, Name: dumpChannelName(ctx)}
+		if m.Channel.Name == dumpChannel {
+			m.Channel.Name = ""
+		}
+	}
+	from, _ := parseTime(fromTime)
+	to, _ := parseTime(toTime)
+	m.Requested = newManifestRange(from, to)
+	if runStats != nil {
+		m.Messages, m.Replies = runStats.Messages, runStats.Replies
+		if runStats.From != nil && runStats.To != nil {
+			m.Actual = newManifestRange(*runStats.From, *runStats.To)
+		}
+	}
+	return m
+}
+
+func newManifestRange(from, to time.Time) manifestRange {
+	var r manifestRange
+	if !from.IsZero() {
+		r.From = from.UTC().Format(time.RFC3339)
+	}
+	if !to.IsZero() {
+		r.To = to.UTC().Format(time.RFC3339)
+	}
+	return r
+}
+
+// manifestFiles hashes the files at paths, named relative to dir.
+func manifestFiles(dir string, paths []string) ([]manifestFile, error) {
+	files := make([]manifestFile, 0, len(paths))
+	for _, p := range paths {
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return nil, err
+		}
+		size, sum, err := hashFile(p)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, manifestFile{Path: filepath.ToSlash(rel), Bytes: size, SHA256: sum})
+	}
+	return files, nil
+}
+
+// hashFile returns the size and hex SHA-256 of the file at path.
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify <manifest | output>",
+	Short: "Check the files of a dump against its --manifest",
+	Long: `Recomputes the size and SHA-256 of every file a --manifest lists and
+compares them with it, printing OK or FAILED and the reason per file. The
+argument is the manifest (general.json.manifest.json) or the output it was
+written for (general.json, or the directory of --format export, zulip or
+gh-markdown). Files are found relative to the manifest.
+
+Exits non-zero when a file is missing or doesn't match.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		if !strings.HasSuffix(path, manifestSuffix) {
+			path = filepath.Clean(path) + manifestSuffix
+		}
+		return verifyManifest(os.Stdout, path)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
+
+// verifyManifest checks the files the manifest at path lists, writing a
+// line per file to w.
+func verifyManifest(w io.Writer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var m dumpManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(m.Files) == 0 {
+		return fmt.Errorf("%s lists no files", path)
+	}
+	failed := 0
+	for _, f := range m.Files {
+		if err := verifyManifestFile(filepath.Dir(path), f); err != nil {
+			failed++
+			fmt.Fprintf(w, "FAILED  %s: %v\n", f.Path, err)
+			continue
+		}
+		fmt.Fprintf(w, "OK      %s\n", f.Path)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files don't match %s", failed, len(m.Files), path)
+	}
+	return nil
+}
+
+// verifyManifestFile checks the file f of a manifest in dir.
+func verifyManifestFile(dir string, f manifestFile) error {
+	if !filepath.IsLocal(filepath.FromSlash(f.Path)) {
+		return errors.New("not a path within the manifest's directory")
+	}
+	size, sum, err := hashFile(filepath.Join(dir, filepath.FromSlash(f.Path)))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return errors.New("missing")
+	case err != nil:
+		return err
+	case size != f.Bytes:
+		return fmt.Errorf("%d bytes, the manifest says %d", size, f.Bytes)
+	case sum != f.SHA256:
+		return errors.New("SHA-256 doesn't match")
+	}
+	return nil
+}
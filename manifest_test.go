@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rusq/slack"
+)
+
+func TestVerifyManifest(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "export")
+	if err := os.MkdirAll(filepath.Join(out, "general"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{filepath.Join(out, "users.json"), filepath.Join(out, "general", "2024-01-15.json")}
+	for _, p := range paths {
+		if err := os.WriteFile(p, []byte(`[{"ts":"1705309200.000100"}]`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := manifestFiles(dir, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[1].Path != "export/general/2024-01-15.json" || files[1].Bytes != 28 || len(files[1].SHA256) != 64 {
+		t.Errorf("manifestFiles()[1] = %+v", files[1])
+	}
+	manifest := out + manifestSuffix
+	writeManifestFile := func(files []manifestFile) {
+		t.Helper()
+		data, err := json.Marshal(dumpManifest{Files: files})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(manifest, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeManifestFile(files)
+
+	var buf bytes.Buffer
+	if err := verifyManifest(&buf, manifest); err != nil {
+		t.Fatalf("verifyManifest() = %v\n%s", err, buf.String())
+	}
+	if got := strings.Count(buf.String(), "OK "); got != 2 {
+		t.Errorf("verifyManifest() printed %d OK lines, want 2:\n%s", got, buf.String())
+	}
+
+	if err := os.WriteFile(paths[1], []byte(`[{"ts":"1705309200.000200"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	err = verifyManifest(&buf, manifest)
+	if err == nil || !strings.Contains(buf.String(), "FAILED  export/general/2024-01-15.json: SHA-256 doesn't match") {
+		t.Errorf("after changing a file, verifyManifest() = %v\n%s", err, buf.String())
+	}
+
+	os.Remove(paths[0])
+	writeManifestFile(append(files, manifestFile{Path: "../outside.json"}))
+	buf.Reset()
+	if err := verifyManifest(&buf, manifest); err == nil || !strings.Contains(err.Error(), "3 of 3 files") {
+		t.Errorf("verifyManifest() = %v, want 3 of 3 files failing\n%s", err, buf.String())
+	}
+	for _, want := range []string{"users.json: missing", "../outside.json: not a path within"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("verifyManifest() output lacks %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestNewManifest(t *testing.T) {
+	from := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	oldAuth, oldWorkspace, oldStats, oldFrom, oldChannel := dumpAuth, dumpWorkspace, runStats, fromTime, dumpChannel
+	defer func() {
+		dumpAuth, dumpWorkspace, runStats, fromTime, dumpChannel = oldAuth, oldWorkspace, oldStats, oldFrom, oldChannel
+	}()
+	dumpAuth = &slack.AuthTestResponse{UserID: "U1", User: "alice", TeamID: "T1"}
+	dumpWorkspace = "https://myworkspace.slack.com"
+	runStats = &dumpStats{Messages: 3, Replies: 2, From: &from, To: &to}
+	fromTime, dumpChannel = "2024-01-01", ""
+
+	m := newManifest(context.Background(), to)
+	if m.Workspace != "myworkspace.slack.com" || m.User == nil || m.User.Name != "alice" || m.Channel != nil {
+		t.Errorf("newManifest() = %+v", m)
+	}
+	if m.Requested != (manifestRange{From: "2024-01-01T00:00:00Z"}) {
+		t.Errorf("Requested = %+v", m.Requested)
+	}
+	if m.Actual != (manifestRange{From: "2024-01-15T09:00:00Z", To: "2024-01-15T10:00:00Z"}) {
+		t.Errorf("Actual = %+v", m.Actual)
+	}
+	if m.Messages != 3 || m.Replies != 2 || m.Version != version {
+		t.Errorf("newManifest() = %+v", m)
+	}
+}
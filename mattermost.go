@@ -0,0 +1,64 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rusq/slack"
+	"github.com/wham/gh-slackdump/internal/format"
+)
+
+// writeMattermost writes doc as --format mattermost to path, or to stdout,
+// and reports the messages left out to stderr. info describes the channel.
+func writeMattermost(path string, info *slack.Channel, doc *outConversation, team string) error {
+	if info.IsIM || info.IsMpIM {
+		return fmt.Errorf("--format mattermost: %s is a direct message; only channels can be imported", doc.ID)
+	}
+	name := cmp.Or(info.Name, doc.Name, strings.ToLower(doc.ID))
+	ch := format.MattermostChannel{
+		Team:        team,
+		Name:        name,
+		DisplayName: name,
+		Private:     info.IsPrivate,
+		Header:      info.Topic.Value,
+		Purpose:     info.Purpose.Value,
+	}
+	conv := doc.Conversation
+	conv.Messages = plainMessages(doc.Messages)
+
+	var skipped map[string]int
+	write := func(w io.Writer) error {
+		var err error
+		skipped, err = format.WriteMattermost(w, conv, ch)
+		return err
+	}
+	size, err := writeOutputTo(path, write)
+	if err != nil {
+		return err
+	}
+	if path != "" {
+		slog.Info("output written", "file", path, "size", size)
+	}
+	reportSkipped(os.Stderr, "Mattermost", skipped)
+	return nil
+}
+
+// reportSkipped writes how many messages of each subtype were left out of
+// an import into target, if any.
+func reportSkipped(w io.Writer, target string, skipped map[string]int) {
+	total := 0
+	var counts []string
+	for _, subtype := range slices.Sorted(maps.Keys(skipped)) {
+		total += skipped[subtype]
+		counts = append(counts, fmt.Sprintf("%s %d", cmp.Or(subtype, "no author"), skipped[subtype]))
+	}
+	if total > 0 {
+		fmt.Fprintf(w, "skipped %d messages %s can't import: %s\n", total, target, strings.Join(counts, ", "))
+	}
+}
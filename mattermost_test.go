@@ -0,0 +1,19 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReportSkipped(t *testing.T) {
+	var b strings.Builder
+	reportSkipped(&b, "Mattermost", map[string]int{"channel_join": 3, "": 1, "pinned_item": 2})
+	if want := "skipped 6 messages Mattermost can't import: no author 1, channel_join 3, pinned_item 2\n"; b.String() != want {
+		t.Errorf("report = %q, want %q", b.String(), want)
+	}
+	b.Reset()
+	reportSkipped(&b, "Mattermost", map[string]int{})
+	if b.Len() != 0 {
+		t.Errorf("reported %q with nothing skipped", b.String())
+	}
+}
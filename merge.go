@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mergeOutput    string
+	mergeOverwrite bool
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge <index.json|directory>",
+	Short: "Reassemble a dump written with --split-by or --split into one file",
+	Long: `Reads the index written by --split-by (e.g. general.index.json) or by
+--split (index.json in its directory, which can be given instead) and joins
+its files, in order, back into the single dump that would have been
+written without splitting. Only JSON dumps can be merged. Files compressed
+with gzip (.gz) or zstd (.zst) are read as such. Writes to stdout unless
+-o is given; an -o name ending in .gz or .zst is compressed. An existing
+-o file with content is only replaced with --overwrite.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if mergeOutput == "" {
+			return mergeSplit(os.Stdout, args[0])
+		}
+		if _, err := resolveOutput(mergeOutput); err != nil {
+			return err
+		}
+		if err := checkOverwrite(mergeOutput, mergeOverwrite); err != nil {
+			return err
+		}
+		var size outputSize
+		if err := writeFileAtomic(mergeOutput, func(w io.Writer) error {
+			var err error
+			size, err = writeCompressed(w, compressionOf(mergeOutput), func(w io.Writer) error {
+				return mergeSplit(w, args[0])
+			})
+			return err
+		}); err != nil {
+			return err
+		}
+		slog.Info("output written", "file", mergeOutput, "size", size)
+		return nil
+	},
+}
+
+func init() {
+	mergeCmd.Flags().StringVarP(&mergeOutput, "output", "o", "", "Write the merged dump to file instead of stdout")
+	mergeCmd.Flags().BoolVar(&mergeOverwrite, "overwrite", false, "Replace an -o file that already has content")
+	rootCmd.AddCommand(mergeCmd)
+}
+
+// rawConversation is a dump with its messages left as written, so merging
+// reproduces them byte for byte whatever additions they carry.
+type rawConversation struct {
+	types.Conversation
+	Channel  json.RawMessage   `json:"channel,omitempty"`
+	Dump     json.RawMessage   `json:"dump,omitempty"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// mergeSplit writes the dump the index at path was split from. path may
+// also be the directory of --split, holding the index.
+func mergeSplit(w io.Writer, path string) error {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		path = filepath.Join(path, periodIndexName)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var index splitIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if index.Format != "" {
+		return fmt.Errorf("%s indexes %s files; merge only reassembles JSON dumps", path, index.Format)
+	}
+	if len(index.Files) == 0 {
+		return fmt.Errorf("%s lists no files", path)
+	}
+
+	var merged rawConversation
+	for i, c := range index.Files {
+		file := filepath.Join(filepath.Dir(path), c.File)
+		part, err := readChunk(file)
+		if err != nil {
+			return err
+		}
+		if len(part.Messages) != c.Messages {
+			return fmt.Errorf("%s has %d messages, the index lists %d", file, len(part.Messages), c.Messages)
+		}
+		if i == 0 {
+			merged = part
+			continue
+		}
+		if part.ID != merged.ID || part.ThreadTS != merged.ThreadTS {
+			return fmt.Errorf("%s is from another conversation (%s)", file, part.Conversation)
+		}
+		merged.Messages = append(merged.Messages, part.Messages...)
+	}
+	return encodeIndented(w, &merged)
+}
+
+// readChunk reads a file written by --split-by or --split, compressed or
+// not.
+func readChunk(path string) (rawConversation, error) {
+	var part rawConversation
+	f, err := openOutputFile(path)
+	if err != nil {
+		return part, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&part); err != nil {
+		return part, fmt.Errorf("%s: %w", path, err)
+	}
+	return part, nil
+}
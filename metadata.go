@@ -0,0 +1,95 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"time"
+
+	"github.com/rusq/slackdump/v3"
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/channels"
+)
+
+// outChannel is the "channel" object of the output: where the messages
+// come from, as conversations.info describes the conversation.
+type outChannel struct {
+	ID         string `json:"id"`
+	Name       string `json:"name,omitempty"`
+	Topic      string `json:"topic,omitempty"`
+	Purpose    string `json:"purpose,omitempty"`
+	IsPrivate  bool   `json:"is_private"`
+	NumMembers int    `json:"num_members,omitempty"`
+	Team       string `json:"team,omitempty"`
+	// IsReadOnly, IsThreadOnly and IsLocked say what limits posting in the
+	// channel, as channels.Posture.
+	IsReadOnly   bool `json:"is_read_only,omitempty"`
+	IsThreadOnly bool `json:"is_thread_only,omitempty"`
+	IsLocked     bool `json:"is_locked,omitempty"`
+}
+
+// posture returns what limits posting in the channel, as
+// channels.Posture; nil without channel metadata.
+func (c *outChannel) posture() []string {
+	if c == nil {
+		return nil
+	}
+	return channels.Posture(c.IsReadOnly, c.IsThreadOnly, c.IsLocked)
+}
+
+// outDump is the "dump" object of the output: how it was made.
+type outDump struct {
+	Tool      string `json:"tool"`
+	Version   string `json:"version"`
+	Workspace string `json:"workspace"`
+	// From and To are the requested --from and --to, RFC 3339 in UTC;
+	// empty when not given.
+	From        string `json:"from,omitempty"`
+	To          string `json:"to,omitempty"`
+	GeneratedAt string `json:"generated_at"`
+}
+
+// setMetadata adds the channel and dump objects to the output, unless
+// --no-metadata is set. The channel comes from conversationInfo, so only
+// its ID and name are there when conversations.info fails.
+func setMetadata(ctx context.Context, sd *slackdump.Session, conv *types.Conversation, workspaceURL string, oldest, latest time.Time) {
+	if noMetadata {
+		return
+	}
+	ch := conversationInfo(ctx, conv)
+	if conv.Name == "" {
+		// So the HTML and CSV outputs and templates name the channel.
+		conv.Name = ch.Name
+	}
+	outputOptions.channel = channelMetadata(ch, sd.Info().TeamID)
+	outputOptions.dump = dumpMetadata(workspaceURL, oldest, latest, time.Now())
+}
+
+// channelMetadata returns the channel object for ch, a channel of team
+// unless conversations.info names another.
+func channelMetadata(ch *channels.Channel, team string) *outChannel {
+	return &outChannel{
+		ID:           ch.ID,
+		Name:         ch.Name,
+		Topic:        ch.Topic.Value,
+		Purpose:      ch.Purpose.Value,
+		IsPrivate:    ch.IsPrivate || ch.IsIM || ch.IsMpIM,
+		NumMembers:   ch.NumMembers,
+		Team:         cmp.Or(ch.ContextTeamID, team),
+		IsReadOnly:   ch.IsReadOnly,
+		IsThreadOnly: ch.IsThreadOnly,
+		IsLocked:     ch.IsLocked,
+	}
+}
+
+// dumpMetadata returns the dump object for a dump of workspaceURL over the
+// requested range, generated at now.
+func dumpMetadata(workspaceURL string, oldest, latest, now time.Time) *outDump {
+	d := &outDump{Tool: "gh-slackdump", Version: version, Workspace: workspaceURL, GeneratedAt: now.UTC().Format(time.RFC3339)}
+	if !oldest.IsZero() {
+		d.From = oldest.UTC().Format(time.RFC3339)
+	}
+	if !latest.IsZero() {
+		d.To = latest.UTC().Format(time.RFC3339)
+	}
+	return d
+}
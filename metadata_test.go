@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/channels"
+)
+
+func TestMetadata(t *testing.T) {
+	ch := &channels.Channel{}
+	ch.ID, ch.Name, ch.IsPrivate, ch.NumMembers = "C1", "general", true, 42
+	ch.Topic.Value, ch.Purpose.Value = "Launch on *Friday*", "Company-wide"
+
+	t.Cleanup(func() { outputOptions = encodeOptions{} })
+	outputOptions = encodeOptions{
+		compact: true,
+		channel: channelMetadata(ch, "T1"),
+		dump: dumpMetadata("https://example.slack.com",
+			time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{},
+			time.Date(2024, 2, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))),
+	}
+	conv := &types.Conversation{ID: "C1", Name: "general", Messages: []types.Message{}}
+
+	var got bytes.Buffer
+	if err := encodeConversation(&got, conv); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"channel_id":"C1","name":"general",` +
+		`"channel":{"id":"C1","name":"general","topic":"Launch on *Friday*","purpose":"Company-wide","is_private":true,"num_members":42,"team":"T1"},` +
+		`"dump":{"tool":"gh-slackdump","version":"` + version + `","workspace":"https://example.slack.com","from":"2024-01-01T00:00:00Z","generated_at":"2024-02-01T11:00:00Z"},` +
+		`"messages":[]}` + "\n"
+	if got.String() != want {
+		t.Errorf("encodeConversation() =\n%s\nwant\n%s", got.String(), want)
+	}
+}
+
+func TestChannelMetadataPosture(t *testing.T) {
+	tests := []struct {
+		readOnly, threadOnly, locked bool
+		want                         []string
+	}{
+		{want: nil},
+		{readOnly: true, want: []string{"read-only"}},
+		{threadOnly: true, want: []string{"thread-only"}},
+		{locked: true, want: []string{"locked"}},
+		{readOnly: true, threadOnly: true, locked: true, want: []string{"read-only", "thread-only", "locked"}},
+	}
+	for _, tt := range tests {
+		ch := &channels.Channel{IsThreadOnly: tt.threadOnly, IsLocked: tt.locked}
+		ch.ID, ch.Name, ch.IsReadOnly = "C1", "announcements", tt.readOnly
+		meta := channelMetadata(ch, "T1")
+		if got := meta.posture(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: posture() = %v, want %v", tt, got, tt.want)
+		}
+		data, err := json.Marshal(meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for flag, set := range map[string]bool{"is_read_only": tt.readOnly, "is_thread_only": tt.threadOnly, "is_locked": tt.locked} {
+			if got := bytes.Contains(data, []byte(`"`+flag+`":true`)); got != set {
+				t.Errorf("%+v: %s in %s = %v, want %v", tt, flag, data, got, set)
+			}
+		}
+	}
+	if got := (*outChannel)(nil).posture(); got != nil {
+		t.Errorf("posture() without metadata = %v, want nil", got)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3"
+	"github.com/rusq/slackdump/v3/auth"
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/emoji"
+	"github.com/wham/gh-slackdump/internal/errs"
+	"github.com/wham/gh-slackdump/internal/pii"
+	"github.com/wham/gh-slackdump/internal/users"
+	"github.com/wham/gh-slackdump/internal/walk"
+)
+
+// --ndjson-threads modes.
+const (
+	// threadsInline nests a message's replies in its record, under
+	// slackdump_thread_replies, as in the JSON document.
+	threadsInline = "inline"
+	// threadsSeparate writes each reply as a record of its own, right after
+	// its parent, with thread_ts naming the parent.
+	threadsSeparate = "separate"
+)
+
+// ndjsonWriter writes --format ndjson: one compact JSON object per message,
+// written as slackdump fetches each chunk instead of once the dump is done.
+type ndjsonWriter struct {
+	w        *bufio.Writer
+	enc      *json.Encoder
+	separate bool
+	opts     encodeOptions
+	// handles, when set, resolves user IDs in each message as it is written.
+	handles users.Resolver
+	// redactor, when set, masks the text of each message as it is written,
+	// after handles.
+	redactor *pii.Redactor
+	// prepare, when set, is applied to each chunk before it is written.
+	prepare func(msgs []types.Message)
+	// rotate, when set, is called with the ts of each top-level message
+	// before its records are written, with everything before flushed.
+	rotate  func(ts string) error
+	records int
+	// target is set once the record marked link_target is written.
+	target bool
+	// first and seen tell the new part of a chunk: for a thread link,
+	// slackdump passes the whole thread fetched so far with every page,
+	// its parent first.
+	first string
+	seen  int
+}
+
+func newNDJSONWriter(w io.Writer, threads string, opts encodeOptions) *ndjsonWriter {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	return &ndjsonWriter{w: bw, enc: enc, separate: threads == threadsSeparate, opts: opts}
+}
+
+// processFunc returns the slackdump process function that writes each chunk.
+func (nw *ndjsonWriter) processFunc() slackdump.ProcessFunc {
+	return func(chunk []types.Message, _ string) (slackdump.ProcessResult, error) {
+		msgs := nw.fresh(chunk)
+		if nw.prepare != nil {
+			nw.prepare(msgs)
+		}
+		n, err := nw.write(msgs)
+		if err == nil {
+			err = nw.w.Flush()
+		}
+		if err != nil {
+			return slackdump.ProcessResult{}, err
+		}
+		// slackdump keeps every chunk for the conversation it returns. Keep
+		// only the timestamps it sorts by, so written messages can be freed.
+		for i := range msgs {
+			msgs[i] = types.Message{Message: slack.Message{Msg: slack.Msg{Timestamp: msgs[i].Timestamp}}}
+		}
+		return slackdump.ProcessResult{Entity: "ndjson", Count: n}, nil
+	}
+}
+
+// fresh returns the part of chunk not written yet.
+func (nw *ndjsonWriter) fresh(chunk []types.Message) []types.Message {
+	all := len(chunk)
+	if all > 0 && chunk[0].Timestamp == nw.first {
+		chunk = chunk[min(nw.seen, all):]
+	} else if all > 0 {
+		nw.first = chunk[0].Timestamp
+	}
+	nw.seen = all
+	return chunk
+}
+
+// write writes msgs and returns the number of records written.
+func (nw *ndjsonWriter) write(msgs []types.Message) (int, error) {
+	n := 0
+	if nw.handles != nil {
+		for i := range msgs {
+			users.ResolveMessage(&msgs[i], nw.handles)
+		}
+	}
+	if nw.redactor != nil {
+		v := walk.Visitor{Text: nw.redactor.String}
+		for i := range msgs {
+			walk.Message(&msgs[i], v)
+		}
+	}
+	for _, m := range buildMessages(msgs, nw.opts) {
+		var replies []outMessage
+		if nw.separate {
+			replies, m.ThreadReplies = m.ThreadReplies, nil
+		}
+		if nw.rotate != nil {
+			if err := nw.w.Flush(); err != nil {
+				return n, err
+			}
+			if err := nw.rotate(m.Timestamp); err != nil {
+				return n, err
+			}
+		}
+		if err := nw.enc.Encode(m); err != nil {
+			return n, err
+		}
+		n++
+		nw.target = nw.target || m.LinkTarget
+		for _, r := range replies {
+			if r.ThreadTimestamp == "" {
+				r.ThreadTimestamp = m.ThreadTimestamp
+			}
+			if err := nw.enc.Encode(r); err != nil {
+				return n, err
+			}
+			n++
+			nw.target = nw.target || r.LinkTarget
+		}
+	}
+	nw.records += n
+	return n, nil
+}
+
+// dumpNDJSON dumps link as --format ndjson to the -o file, or to stdout,
+// or, with --split, to a file per period in the -o directory. User
+// handles and the emoji normalizer are loaded before dumping, so each
+// chunk can be resolved, normalized and written as soon as it is fetched.
+func dumpNDJSON(ctx context.Context, sd *slackdump.Session, prov auth.Provider, link archiveLink, workspaceURL string, oldest, latest time.Time, split splitSpec) error {
+	handles, err := userResolver(ctx, prov, workspaceURL)
+	if err != nil {
+		return err
+	}
+	var norm *emoji.Normalizer
+	if normalizeEmoji {
+		norm = emojiNormalizer(ctx, sd)
+	}
+
+	var records int
+	var pw *periodWriter
+	dump := func(w io.Writer) error {
+		nw := newNDJSONWriter(w, ndjsonThreads, outputOptions)
+		if pw != nil {
+			nw.rotate = pw.rotate
+		}
+		nw.handles = handles
+		nw.redactor = textRedactor
+		nw.opts.sharedThreads = make(map[string][]types.Message)
+		nw.prepare = func(msgs []types.Message) {
+			// Records keep the order pages come in; only the replies of
+			// each thread are normalized.
+			if !noNormalize {
+				for i := range msgs {
+					msgs[i].ThreadReplies, _ = normalizeMessages(msgs[i].ThreadReplies)
+				}
+			}
+			convs := []*types.Conversation{{Messages: msgs}}
+			var shared map[string][]types.Message
+			if expandShared {
+				shared = expandNewShares(ctx, sd, convs[0], nw.opts.sharedThreads)
+				for _, thread := range shared {
+					convs = append(convs, &types.Conversation{Messages: thread})
+				}
+			}
+			for i, conv := range convs {
+				// The chunk itself is resolved and redacted as it is
+				// written.
+				if handles != nil && i > 0 {
+					users.ResolveConversation(conv, handles)
+				}
+				if i > 0 {
+					redactConversations(conv)
+				}
+				if norm != nil {
+					normalizeReactions(conv.Messages, norm)
+				}
+			}
+			maps.Copy(nw.opts.sharedThreads, shared)
+			countMessages(msgs)
+		}
+		_, err := sd.Dump(ctx, link.target(), oldest, latest, progressReporter.ProcessFunc(), nw.processFunc())
+		records = nw.records
+		if err == nil && nw.opts.linkTarget != "" && !nw.target {
+			warnMissingTarget(nil, nw.opts.linkTarget)
+		}
+		return errs.Classify(err)
+	}
+	if split.period != "" {
+		if err := os.MkdirAll(outputFile, 0o755); err != nil {
+			return err
+		}
+		pw = newPeriodWriter(outputFile, split, "ndjson")
+		if err := dump(pw); err != nil {
+			pw.abort()
+			return err
+		}
+		if err := pw.finish(); err != nil {
+			return err
+		}
+		slog.Info("output written", "files", len(pw.index.Files), "index", encryptedPath(split.indexPath(outputFile)), "records", records, "size", pw.size)
+		return nil
+	}
+	size, err := writeOutputTo(outputFile, dump)
+	if err != nil || outputFile == "" {
+		return err
+	}
+	slog.Info("output written", "file", encryptedPath(outputFile), "records", records, "size", size)
+	return nil
+}
+
+// writeNDJSON writes the dumped conv as --format ndjson to path, or to
+// stdout, for convert.
+func writeNDJSON(path string, conv *types.Conversation) error {
+	var records int
+	size, err := writeOutputTo(path, func(w io.Writer) error {
+		nw := newNDJSONWriter(w, ndjsonThreads, outputOptions)
+		n, err := nw.write(conv.Messages)
+		records = n
+		if err != nil {
+			return err
+		}
+		return nw.w.Flush()
+	})
+	if err != nil || path == "" {
+		return err
+	}
+	slog.Info("output written", "file", path, "records", records, "size", size)
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/users"
+)
+
+// records decodes an NDJSON stream into the ts and thread_ts of each line,
+// with the number of replies nested in it.
+func records(t *testing.T, stream string) []string {
+	t.Helper()
+	var out []string
+	for _, line := range strings.Split(strings.TrimSuffix(stream, "\n"), "\n") {
+		var rec struct {
+			TS       string            `json:"ts"`
+			ThreadTS string            `json:"thread_ts"`
+			Replies  []json.RawMessage `json:"slackdump_thread_replies"`
+		}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		out = append(out, rec.TS+"/"+rec.ThreadTS+"/"+strings.Repeat("r", len(rec.Replies)))
+	}
+	return out
+}
+
+func threadMsg(ts, threadTS string, replies ...types.Message) types.Message {
+	m := msg(ts, replies...)
+	m.ThreadTimestamp = threadTS
+	return m
+}
+
+func TestNDJSONWriterChannel(t *testing.T) {
+	pages := func() [][]types.Message {
+		return [][]types.Message{
+			{msg("3.0"), threadMsg("2.0", "2.0", threadMsg("2.1", "2.0"), msg("2.2"))},
+			{msg("1.0")},
+		}
+	}
+	tests := []struct {
+		threads string
+		want    []string
+	}{
+		{threadsInline, []string{"3.0//", "2.0/2.0/rr", "1.0//"}},
+		{threadsSeparate, []string{"3.0//", "2.0/2.0/", "2.1/2.0/", "2.2/2.0/", "1.0//"}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		nw := newNDJSONWriter(&buf, tt.threads, encodeOptions{})
+		fn := nw.processFunc()
+		var kept []types.Message
+		for _, page := range pages() {
+			if _, err := fn(page, "C1"); err != nil {
+				t.Fatal(err)
+			}
+			kept = append(kept, page...)
+		}
+		if got := records(t, buf.String()); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: records = %v, want %v", tt.threads, got, tt.want)
+		}
+		if nw.records != len(tt.want) {
+			t.Errorf("%s: counted %d records, want %d", tt.threads, nw.records, len(tt.want))
+		}
+		for _, m := range kept {
+			if m.Timestamp == "" || m.ThreadReplies != nil || m.ThreadTimestamp != "" {
+				t.Errorf("%s: written message %+v was kept beyond its ts", tt.threads, m)
+			}
+		}
+	}
+}
+
+func TestNDJSONWriterThreadLink(t *testing.T) {
+	var buf bytes.Buffer
+	nw := newNDJSONWriter(&buf, threadsInline, encodeOptions{})
+	nw.prepare = func(msgs []types.Message) {
+		for i := range msgs {
+			msgs[i].User = "alice"
+		}
+	}
+	fn := nw.processFunc()
+	// slackdump passes the whole thread fetched so far with every page.
+	thread := []types.Message{threadMsg("1.0", "1.0"), threadMsg("1.1", "1.0")}
+	if _, err := fn(thread, "C1"); err != nil {
+		t.Fatal(err)
+	}
+	thread = append(thread, threadMsg("1.2", "1.0"))
+	if _, err := fn(thread, "C1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1.0/1.0/", "1.1/1.0/", "1.2/1.0/"}
+	if got := records(t, buf.String()); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("records = %v, want %v", got, want)
+	}
+	if strings.Count(buf.String(), `"user":"alice"`) != 3 {
+		t.Errorf("prepare was not applied to every record once:\n%s", buf.String())
+	}
+}
+
+// TestNDJSONResolvesLikeBatch checks that resolving user IDs per message
+// while streaming gives the records the batch path, ResolveConversation on
+// the whole dump, gives.
+func TestNDJSONResolvesLikeBatch(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "conversation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := func() *types.Conversation {
+		var conv types.Conversation
+		if err := json.Unmarshal(data, &conv); err != nil {
+			t.Fatal(err)
+		}
+		return &conv
+	}
+	handles := users.HandleMap{"U09036M8VEU": "alice", "U0903ABCDEF": "bob"}
+
+	for _, threads := range []string{threadsInline, threadsSeparate} {
+		batch := load()
+		users.ResolveConversation(batch, handles)
+		var want bytes.Buffer
+		bw := newNDJSONWriter(&want, threads, encodeOptions{})
+		if _, err := bw.write(batch.Messages); err != nil {
+			t.Fatal(err)
+		}
+		bw.w.Flush()
+
+		var got bytes.Buffer
+		nw := newNDJSONWriter(&got, threads, encodeOptions{})
+		nw.handles = handles
+		if _, err := nw.processFunc()(load().Messages, "C1"); err != nil {
+			t.Fatal(err)
+		}
+
+		if got.String() != want.String() {
+			t.Errorf("%s: streaming resolution =\n%s\nbatch resolution =\n%s", threads, got.String(), want.String())
+		}
+		if strings.Contains(got.String(), "U0903ABCDEF") {
+			t.Errorf("%s: a user ID was left unresolved:\n%s", threads, got.String())
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"slices"
+
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// normalizeMessages puts msgs in order of their ts, oldest first, and each
+// thread's replies too, and drops duplicates: messages with the same ts and
+// author, such as a thread's parent that the replies fetch returned again.
+// Of duplicates, the copy with the most fields set is kept, with the
+// replies of both. It returns the messages and how many were dropped.
+func normalizeMessages(msgs []types.Message) ([]types.Message, int) {
+	if len(msgs) == 0 {
+		return msgs, 0
+	}
+	sorted := slices.Clone(msgs)
+	slices.SortStableFunc(sorted, compareTS)
+	var (
+		out     []types.Message
+		dropped int
+	)
+	for _, m := range sorted {
+		if n := len(out); n > 0 && sameMessage(&out[n-1], &m) {
+			last := &out[n-1]
+			replies := slices.Concat(last.ThreadReplies, m.ThreadReplies)
+			if messageWeight(&m) > messageWeight(last) {
+				*last = m
+			}
+			last.ThreadReplies = replies
+			dropped++
+			continue
+		}
+		out = append(out, m)
+	}
+	for i := range out {
+		m := &out[i]
+		if len(m.ThreadReplies) == 0 {
+			continue
+		}
+		var n int
+		m.ThreadReplies, n = normalizeMessages(m.ThreadReplies)
+		dropped += n
+		// The parent itself, returned again as the first of its replies.
+		before := len(m.ThreadReplies)
+		m.ThreadReplies = slices.DeleteFunc(m.ThreadReplies, func(r types.Message) bool { return sameMessage(m, &r) })
+		dropped += before - len(m.ThreadReplies)
+	}
+	return out, dropped
+}
+
+// normalizeConversation normalizes conv's messages, unless --no-normalize
+// is set, logging the duplicates it dropped.
+func normalizeConversation(conv *types.Conversation) {
+	if noNormalize {
+		return
+	}
+	var dropped int
+	conv.Messages, dropped = normalizeMessages(conv.Messages)
+	if dropped > 0 {
+		slog.Info("dropped duplicate messages", "channel", conv.ID, "count", dropped)
+	}
+}
+
+// compareTS orders messages by ts, oldest first.
+func compareTS(a, b types.Message) int {
+	switch {
+	case tsBefore(a.Timestamp, b.Timestamp):
+		return -1
+	case tsBefore(b.Timestamp, a.Timestamp):
+		return 1
+	}
+	return 0
+}
+
+// sameMessage reports whether a and b are copies of one message: the same
+// ts from the same user or bot.
+func sameMessage(a, b *types.Message) bool {
+	return a.Timestamp == b.Timestamp && a.User == b.User && a.BotID == b.BotID
+}
+
+// messageWeight measures how much of a message is set, as the size of its
+// JSON without its thread replies.
+func messageWeight(m *types.Message) int {
+	plain := *m
+	plain.ThreadReplies = nil
+	data, _ := json.Marshal(plain)
+	return len(data)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestNormalizeMessages(t *testing.T) {
+	msg := func(ts, user, text string, replies ...types.Message) types.Message {
+		return types.Message{Message: slack.Message{Msg: slack.Msg{Timestamp: ts, User: user, Text: text}}, ThreadReplies: replies}
+	}
+	parent := msg("1700000000.000100", "U1", "question")
+	parent.ReplyCount = 2
+	msgs := []types.Message{
+		msg("1700000100.000000", "U3", "later"),
+		msg("1700000000.000100", "U1", "question",
+			msg("1700000060.000000", "U2", "second reply"),
+			msg("1700000000.000100", "U1", "question"),
+			msg("1700000030.000000", "U1", "first reply"),
+		),
+		parent,
+		// Same ts, another author: a different message.
+		msg("1700000100.000000", "U4", "same second"),
+		msg("999999999.999999", "U2", "older, with fewer digits"),
+	}
+	orig := slices.Clone(msgs)
+
+	got, dropped := normalizeMessages(msgs)
+	if dropped != 2 {
+		t.Errorf("dropped = %d, want the parent's two extra copies", dropped)
+	}
+	var order []string
+	for _, m := range got {
+		order = append(order, m.Text)
+	}
+	if want := []string{"older, with fewer digits", "question", "later", "same second"}; !slices.Equal(order, want) {
+		t.Errorf("order = %q, want %q", order, want)
+	}
+	q := got[1]
+	if q.ReplyCount != 2 {
+		t.Error("the richer copy of the parent, with reply_count, wasn't kept")
+	}
+	order = nil
+	for _, r := range q.ThreadReplies {
+		order = append(order, r.Text)
+	}
+	if want := []string{"first reply", "second reply"}; !slices.Equal(order, want) {
+		t.Errorf("replies = %q, want %q, without the parent", order, want)
+	}
+	if msgs[0].Text != orig[0].Text || len(msgs[1].ThreadReplies) != 3 {
+		t.Error("normalizeMessages changed its input")
+	}
+}
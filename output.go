@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// outputKind classifies the destination given with -o.
+type outputKind int
+
+const (
+	outputToStdout outputKind = iota
+	outputToFile
+)
+
+// destination is a validated -o value.
+type destination struct {
+	kind outputKind
+	path string
+}
+
+// resolveOutput classifies and validates the -o value before any API work is
+// done, so a bad destination fails fast instead of after a long dump.
+func resolveOutput(path string) (destination, error) {
+	if path == "" {
+		return destination{kind: outputToStdout}, nil
+	}
+	if strings.HasSuffix(path, "/") || strings.HasSuffix(path, string(filepath.Separator)) {
+		return destination{}, fmt.Errorf("-o %s names a directory; pass a file path", path)
+	}
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		return destination{}, fmt.Errorf("-o %s is a directory; pass a file path", path)
+	}
+	dir := filepath.Dir(path)
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return destination{}, fmt.Errorf("-o %s: directory %s does not exist", path, dir)
+	}
+	if !fi.IsDir() {
+		return destination{}, fmt.Errorf("-o %s: %s is not a directory", path, dir)
+	}
+	return destination{kind: outputToFile, path: path}, nil
+}
+
+// checkOverwrite refuses an -o path that already holds data: a non-empty
+// file, or for the formats that write a directory, a non-empty directory.
+// Symlinks are followed, so a dangling one counts as missing. With
+// overwrite, or a path that can't be examined, it lets the write go ahead.
+func checkOverwrite(path string, overwrite bool) error {
+	if path == "" || overwrite {
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	if fi.IsDir() {
+		if entries, err := os.ReadDir(path); err == nil && len(entries) > 0 {
+			return fmt.Errorf("-o %s is a directory that isn't empty; pass --overwrite to write into it anyway", path)
+		}
+		return nil
+	}
+	if fi.Size() > 0 {
+		return fmt.Errorf("-o %s already exists; pass --overwrite to replace it", path)
+	}
+	return nil
+}
+
+// writtenFile is a file a run put in place, or its output to stdout when
+// path is "", and the bytes it holds.
+type writtenFile struct {
+	path  string
+	bytes int64
+}
+
+// writtenFiles records every output as it is written, for the run summary.
+var writtenFiles struct {
+	sync.Mutex
+	files []writtenFile
+}
+
+// recordWrite records that bytes were written to path, "" for stdout.
+func recordWrite(path string, bytes int64) {
+	writtenFiles.Lock()
+	defer writtenFiles.Unlock()
+	writtenFiles.files = append(writtenFiles.files, writtenFile{path: path, bytes: bytes})
+}
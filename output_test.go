@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveOutput(t *testing.T) {
+	dir := t.TempDir()
+	existingFile := filepath.Join(dir, "existing.json")
+	if err := os.WriteFile(existingFile, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	subdir := filepath.Join(dir, "sub")
+	if err := os.Mkdir(subdir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantKind outputKind
+		wantErr  bool
+	}{
+		{name: "empty means stdout", path: "", wantKind: outputToStdout},
+		{name: "new file in existing dir", path: filepath.Join(dir, "out.json"), wantKind: outputToFile},
+		{name: "existing file", path: existingFile, wantKind: outputToFile},
+		{name: "file in subdir", path: filepath.Join(subdir, "out.json"), wantKind: outputToFile},
+		{name: "relative file", path: "out.json", wantKind: outputToFile},
+		{name: "trailing slash", path: subdir + "/", wantErr: true},
+		{name: "existing directory", path: subdir, wantErr: true},
+		{name: "missing parent", path: filepath.Join(dir, "missing", "out.json"), wantErr: true},
+		{name: "parent is a file", path: filepath.Join(existingFile, "out.json"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveOutput(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveOutput(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.kind != tt.wantKind || got.path != tt.path {
+				t.Errorf("resolveOutput(%q) = %+v, want kind %v path %q", tt.path, got, tt.wantKind, tt.path)
+			}
+		})
+	}
+}
+
+func TestCheckOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.json")
+	os.WriteFile(existing, []byte("{}"), 0o644)
+	empty := filepath.Join(dir, "empty.json")
+	os.WriteFile(empty, nil, 0o644)
+	dangling := filepath.Join(dir, "dangling.json")
+	if err := os.Symlink(filepath.Join(dir, "missing.json"), dangling); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	linked := filepath.Join(dir, "linked.json")
+	os.Symlink(existing, linked)
+	emptyDir := filepath.Join(dir, "emptydir")
+	os.Mkdir(emptyDir, 0o755)
+
+	tests := []struct {
+		name      string
+		path      string
+		overwrite bool
+		wantErr   bool
+	}{
+		{name: "stdout", path: ""},
+		{name: "new file", path: filepath.Join(dir, "new.json")},
+		{name: "existing file", path: existing, wantErr: true},
+		{name: "existing file with --overwrite", path: existing, overwrite: true},
+		{name: "existing empty file", path: empty},
+		{name: "dangling symlink", path: dangling},
+		{name: "symlink to existing file", path: linked, wantErr: true},
+		{name: "empty directory", path: emptyDir},
+		{name: "directory with files", path: dir, wantErr: true},
+		{name: "directory with files and --overwrite", path: dir, overwrite: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOverwrite(tt.path, tt.overwrite)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkOverwrite(%q, %v) error = %v, wantErr %v", tt.path, tt.overwrite, err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "--overwrite") {
+				t.Errorf("error %q doesn't suggest --overwrite", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3"
+	"github.com/spf13/cobra"
+
+	sdauth "github.com/wham/gh-slackdump/internal/auth"
+)
+
+// quickstartSample is how many recent messages the test dump fetches.
+const quickstartSample = 10
+
+var quickstartCmd = &cobra.Command{
+	Use:   "quickstart",
+	Short: "Walk through the first-run setup and a small test dump",
+	Long: `Walks a first-time user through the setup: picks the workspace and the
+auth source, checks that the Slack cookie can be read and exchanged for a
+token (the same checks as --test --workspace), and fetches the last 10
+messages of a channel as a test dump.
+
+Every prompt can be skipped by pressing Enter, which ends the walkthrough.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		setupLogging(logLevel(), false)
+		q := &quickstart{
+			in:   bufio.NewScanner(cmd.InOrStdin()),
+			out:  cmd.OutOrStdout(),
+			caps: sdauth.Capabilities(),
+			cookie: func(workspaceURL string) (string, error) {
+				return sdauth.ReadCookie(workspaceURL, authSources())
+			},
+			check: func(ctx context.Context, workspaceURL, cookie string) ([]sdauth.CheckStep, error) {
+				return sdauth.CheckWorkspace(ctx, workspaceURL, cookie, transportOptions())
+			},
+			sample: sampleMessages,
+		}
+		return q.run(cmd.Context())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(quickstartCmd)
+}
+
+// quickstart is the interactive first-run walkthrough. The steps that reach
+// the Slack desktop app or Slack are functions so tests can script them.
+type quickstart struct {
+	in   *bufio.Scanner
+	out  io.Writer
+	caps []string
+
+	cookie func(workspaceURL string) (string, error)
+	check  func(ctx context.Context, workspaceURL, cookie string) ([]sdauth.CheckStep, error)
+	sample func(ctx context.Context, workspaceURL string, link archiveLink, n int) ([]slack.Message, error)
+}
+
+func (q *quickstart) run(ctx context.Context) error {
+	fmt.Fprintln(q.out, "gh slackdump quickstart — press Enter at any prompt to stop.")
+
+	workspaceURL, ok := q.askWorkspace()
+	if !ok {
+		return q.skipped()
+	}
+
+	fmt.Fprintln(q.out, "\nAuth sources in this build:")
+	if !slices.Contains(q.caps, "keychain") {
+		fmt.Fprintln(q.out, "  none: this build can't read the Slack desktop app's cookies")
+		return authHint(fmt.Errorf("quickstart: %w", sdauth.ErrUnsupportedSource))
+	}
+	fmt.Fprintln(q.out, "  1) Slack desktop app (the d cookie of a signed-in workspace)")
+	fmt.Fprintln(q.out, "Using the Slack desktop app.")
+
+	fmt.Fprintln(q.out, "\nChecking authentication:")
+	cookie, err := q.cookie(workspaceURL)
+	if err != nil {
+		fmt.Fprintf(q.out, "FAIL read cookie: %v\n", err)
+		return authHint(err)
+	}
+	fmt.Fprintln(q.out, "ok   read cookie")
+	steps, err := q.check(ctx, workspaceURL, cookie)
+	if err != nil {
+		return err
+	}
+	for _, s := range steps {
+		fmt.Fprintln(q.out, formatCheckStep(s))
+	}
+	if last := steps[len(steps)-1]; last.Err != nil {
+		return authHint(fmt.Errorf("%s failed for %s: %w", last.Name, workspaceURL, last.Err))
+	}
+
+	link, ok := q.askChannel(workspaceURL)
+	if !ok {
+		return q.skipped()
+	}
+	msgs, err := q.sample(ctx, workspaceURL, link, quickstartSample)
+	if err != nil {
+		return fmt.Errorf("test dump of %s: %w", link.channel, err)
+	}
+	fmt.Fprintf(q.out, "\nLast %d messages of %s:\n", len(msgs), link.channel)
+	for _, m := range msgs {
+		fmt.Fprintf(q.out, "  %s %s: %s\n", m.Timestamp, m.User, summarize(m.Text, 60))
+	}
+	fmt.Fprintf(q.out, "\nAll set. Dump the whole conversation with:\n  gh slackdump -o %s.json %s/archives/%s\n", link.channel, workspaceURL, link.channel)
+	return nil
+}
+
+// ask prompts and returns the trimmed answer; false means the user skipped
+// (an empty answer or end of input).
+func (q *quickstart) ask(prompt string) (string, bool) {
+	fmt.Fprint(q.out, prompt)
+	if !q.in.Scan() {
+		fmt.Fprintln(q.out)
+		return "", false
+	}
+	answer := strings.TrimSpace(q.in.Text())
+	return answer, answer != ""
+}
+
+func (q *quickstart) askWorkspace() (string, bool) {
+	for {
+		answer, ok := q.ask("\nWorkspace URL or any link into it (e.g. https://myworkspace.slack.com): ")
+		if !ok {
+			return "", false
+		}
+		workspaceURL, err := extractWorkspaceURL(answer)
+		if err == nil {
+			return workspaceURL, true
+		}
+		fmt.Fprintf(q.out, "%s is not a Slack workspace URL.\n", answer)
+	}
+}
+
+func (q *quickstart) askChannel(workspaceURL string) (archiveLink, bool) {
+	for {
+		answer, ok := q.ask(fmt.Sprintf("\nChannel link for a test dump of its last %d messages: ", quickstartSample))
+		if !ok {
+			return archiveLink{}, false
+		}
+		linkWorkspace, err := extractWorkspaceURL(answer)
+		if err != nil {
+			fmt.Fprintf(q.out, "%s is not a Slack link.\n", answer)
+			continue
+		}
+		if linkWorkspace != workspaceURL {
+			fmt.Fprintf(q.out, "%s is not in %s.\n", answer, workspaceURL)
+			continue
+		}
+		link, err := parseArchiveLink(answer)
+		if err != nil {
+			fmt.Fprintln(q.out, err)
+			continue
+		}
+		return link, true
+	}
+}
+
+func (q *quickstart) skipped() error {
+	fmt.Fprintln(q.out, "Stopped. Run gh slackdump quickstart again any time.")
+	return nil
+}
+
+// sampleMessages fetches the newest n messages of the link's channel.
+func sampleMessages(ctx context.Context, workspaceURL string, link archiveLink, n int) ([]slack.Message, error) {
+	provider, err := sdauth.NewProvider(ctx, workspaceURL, authSources(), transportOptions())
+	if err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(workspaceURL)
+	sd, err := slackdump.New(ctx, provider, slackdump.WithForceEnterprise(sdauth.IsEnterpriseHost(u.Hostname())))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := sd.Client().GetConversationHistoryContext(ctx, &slack.GetConversationHistoryParameters{ChannelID: link.channel, Limit: n})
+	if err != nil {
+		return nil, err
+	}
+	msgs := resp.Messages
+	slices.Reverse(msgs)
+	return msgs, nil
+}
+
+// summarize shortens text to one line of at most n runes.
+func summarize(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if r := []rune(text); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+
+	sdauth "github.com/wham/gh-slackdump/internal/auth"
+)
+
+func TestQuickstart(t *testing.T) {
+	okSteps := []sdauth.CheckStep{
+		{Name: "token exchange", Detail: "token xoxc-...abcd"},
+		{Name: "auth.test", Detail: "user alice on team Acme"},
+	}
+	tests := []struct {
+		name       string
+		input      string
+		caps       []string
+		cookieErr  error
+		steps      []sdauth.CheckStep
+		wantErr    string
+		wantOut    []string
+		wantSample string
+	}{
+		{
+			name:       "full walkthrough",
+			input:      "not a url\nhttps://acme.slack.com\nhttps://other.slack.com/archives/C1\nhttps://acme.slack.com/archives/C1\n",
+			caps:       []string{"keychain"},
+			steps:      okSteps,
+			wantOut:    []string{"not a Slack workspace URL", "Slack desktop app", "ok   read cookie", "ok   auth.test", "not in https://acme.slack.com", "Last 2 messages of C1", "1700000000.000100 U1: hello", "All set"},
+			wantSample: "C1",
+		},
+		{
+			name:    "skip at the first prompt",
+			input:   "\n",
+			caps:    []string{"keychain"},
+			wantOut: []string{"Stopped"},
+		},
+		{
+			name:    "end of input skips",
+			input:   "",
+			caps:    []string{"keychain"},
+			wantOut: []string{"Stopped"},
+		},
+		{
+			name:    "skip the test dump",
+			input:   "https://acme.slack.com\n\n",
+			caps:    []string{"keychain"},
+			steps:   okSteps,
+			wantOut: []string{"ok   auth.test", "Stopped"},
+		},
+		{
+			name:    "no auth source in this build",
+			input:   "https://acme.slack.com\n",
+			caps:    []string{"nokeychain"},
+			wantErr: "nokeychain build",
+			wantOut: []string{"none"},
+		},
+		{
+			name:      "cookie can't be read",
+			input:     "https://acme.slack.com\n",
+			caps:      []string{"keychain"},
+			cookieErr: sdauth.ErrSignedOut,
+			wantErr:   "sign in to this workspace",
+			wantOut:   []string{"FAIL read cookie"},
+		},
+		{
+			name:    "check fails",
+			input:   "https://acme.slack.com\n",
+			caps:    []string{"keychain"},
+			steps:   []sdauth.CheckStep{{Name: "token exchange", Err: errors.New("boom")}},
+			wantErr: "token exchange failed for https://acme.slack.com: boom",
+			wantOut: []string{"FAIL token exchange"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			var sampled string
+			q := &quickstart{
+				in:   bufio.NewScanner(strings.NewReader(tt.input)),
+				out:  &out,
+				caps: tt.caps,
+				cookie: func(string) (string, error) {
+					return "xoxd-cookie", tt.cookieErr
+				},
+				check: func(_ context.Context, workspaceURL, cookie string) ([]sdauth.CheckStep, error) {
+					if workspaceURL != "https://acme.slack.com" || cookie != "xoxd-cookie" {
+						t.Errorf("check(%q, %q)", workspaceURL, cookie)
+					}
+					return tt.steps, nil
+				},
+				sample: func(_ context.Context, _ string, link archiveLink, n int) ([]slack.Message, error) {
+					sampled = link.channel
+					if n != quickstartSample {
+						t.Errorf("sample n = %d, want %d", n, quickstartSample)
+					}
+					return []slack.Message{
+						{Msg: slack.Msg{Timestamp: "1700000000.000100", User: "U1", Text: "hello"}},
+						{Msg: slack.Msg{Timestamp: "1700000001.000100", User: "U2", Text: "hi\nthere"}},
+					}, nil
+				},
+			}
+			err := q.run(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("run() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, out.String())
+				}
+			}
+			if sampled != tt.wantSample {
+				t.Errorf("sampled channel %q, want %q", sampled, tt.wantSample)
+			}
+		})
+	}
+}
+
+func TestBuildExamples(t *testing.T) {
+	full := buildExamples([]string{"keychain"})
+	minimal := buildExamples([]string{"nokeychain"})
+	if len(strings.Split(full, "\n")) != len(examples) {
+		t.Errorf("keychain build shows %d examples, want all %d", len(strings.Split(full, "\n")), len(examples))
+	}
+	if strings.Contains(minimal, "/archives/") {
+		t.Errorf("nokeychain examples include dumps:\n%s", minimal)
+	}
+	for _, want := range []string{"gh slackdump quickstart", "gh slackdump --test"} {
+		if !strings.Contains(minimal, want) {
+			t.Errorf("nokeychain examples missing %q:\n%s", want, minimal)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3"
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/emoji"
+)
+
+// firstReactor returns the user who most likely reacted to m first, or ""
+// when it has no reactions. Slack lists reactions in the order they were
+// first added and each reaction's users in the order they reacted, so the
+// first user of the first reaction is the earliest reactor. Slack caps the
+// users listed per reaction, but the earliest ones are always kept.
+func firstReactor(m *types.Message) string {
+	for _, r := range m.Reactions {
+		if len(r.Users) > 0 {
+			return r.Users[0]
+		}
+	}
+	return ""
+}
+
+// normalizeReactions renames the reactions of msgs and their replies to
+// canonical emoji names. Reactions that turn out to be the same emoji are
+// merged into the first one, keeping the order users reacted in.
+func normalizeReactions(msgs []types.Message, n *emoji.Normalizer) {
+	for i := range msgs {
+		m := &msgs[i]
+		var merged []slack.ItemReaction
+		for _, r := range m.Reactions {
+			r.Name = n.Name(r.Name)
+			j := slices.IndexFunc(merged, func(o slack.ItemReaction) bool { return o.Name == r.Name })
+			if j < 0 {
+				merged = append(merged, r)
+				continue
+			}
+			for _, u := range r.Users {
+				if slices.Contains(merged[j].Users, u) {
+					r.Count--
+					continue
+				}
+				merged[j].Users = append(merged[j].Users, u)
+			}
+			merged[j].Count += r.Count
+		}
+		m.Reactions = merged
+		normalizeReactions(m.ThreadReplies, n)
+	}
+}
+
+// normalizeConversationEmoji applies --normalize-emoji. The workspace's
+// custom aliases come from emoji.list; without them only standard aliases
+// are normalized.
+func normalizeConversationEmoji(ctx context.Context, sd *slackdump.Session, convs ...*types.Conversation) {
+	n := emojiNormalizer(ctx, sd)
+	for _, conv := range convs {
+		normalizeReactions(conv.Messages, n)
+	}
+}
+
+// emojiNormalizer returns the normalizer for --normalize-emoji, with the
+// workspace's custom aliases when they can be listed.
+func emojiNormalizer(ctx context.Context, sd *slackdump.Session) *emoji.Normalizer {
+	list, err := sd.DumpEmojis(ctx)
+	if err != nil {
+		slog.Warn("can't list custom emoji, normalizing standard aliases only", "error", err)
+	}
+	return emoji.NewNormalizer(list)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/emoji"
+	"github.com/wham/gh-slackdump/internal/users"
+)
+
+func TestFirstReactor(t *testing.T) {
+	tests := []struct {
+		name      string
+		reactions []slack.ItemReaction
+		want      string
+	}{
+		{name: "no reactions"},
+		{
+			name: "first user of first reaction",
+			reactions: []slack.ItemReaction{
+				{Name: "eyes", Users: []string{"U2", "U1"}},
+				{Name: "tada", Users: []string{"U1"}},
+			},
+			want: "U2",
+		},
+		{
+			name: "skips reactions without listed users",
+			reactions: []slack.ItemReaction{
+				{Name: "eyes", Count: 3},
+				{Name: "tada", Users: []string{"U3"}},
+			},
+			want: "U3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &types.Message{Message: slack.Message{Msg: slack.Msg{Reactions: tt.reactions}}}
+			if got := firstReactor(m); got != tt.want {
+				t.Errorf("firstReactor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirstReactorAfterResolution(t *testing.T) {
+	conv := &types.Conversation{Messages: []types.Message{{Message: slack.Message{Msg: slack.Msg{
+		Reactions: []slack.ItemReaction{{Name: "eyes", Users: []string{"U3", "U1", "U2"}}},
+	}}}}}
+	users.ResolveConversation(conv, users.HandleMap{"U1": "alice", "U2": "bob", "U3": "zed"})
+
+	out := buildOutput(conv, encodeOptions{firstReactor: true})
+	if got := out.Messages[0].FirstReactor; got != "zed" {
+		t.Errorf("FirstReactor = %q, want zed (resolution must keep reaction order)", got)
+	}
+	if got := out.Messages[0].Reactions[0].Users; got[0] != "zed" || got[1] != "alice" || got[2] != "bob" {
+		t.Errorf("Reactions.Users = %v, want [zed alice bob]", got)
+	}
+}
+
+func TestNormalizeReactions(t *testing.T) {
+	msgs := []types.Message{{
+		Message: slack.Message{Msg: slack.Msg{Reactions: []slack.ItemReaction{
+			{Name: "thumbsup", Count: 2, Users: []string{"U1", "U2"}},
+			{Name: "eyes", Count: 1, Users: []string{"U3"}},
+			{Name: "+1", Count: 2, Users: []string{"U2", "U4"}},
+			{Name: "shipit_squirrel", Count: 1, Users: []string{"U5"}},
+			{Name: "thumbsup::skin-tone-3", Count: 1, Users: []string{"U6"}},
+		}}},
+		ThreadReplies: []types.Message{{Message: slack.Message{Msg: slack.Msg{Reactions: []slack.ItemReaction{
+			{Name: "satisfied", Count: 1, Users: []string{"U1"}},
+		}}}}},
+	}}
+	normalizeReactions(msgs, emoji.NewNormalizer(map[string]string{"shipit_squirrel": "alias:shipit", "shipit": "https://emoji.example/shipit.png"}))
+
+	want := []slack.ItemReaction{
+		{Name: "+1", Count: 3, Users: []string{"U1", "U2", "U4"}},
+		{Name: "eyes", Count: 1, Users: []string{"U3"}},
+		{Name: "shipit", Count: 1, Users: []string{"U5"}},
+		{Name: "+1::skin-tone-3", Count: 1, Users: []string{"U6"}},
+	}
+	if !reflect.DeepEqual(msgs[0].Reactions, want) {
+		t.Errorf("reactions = %+v, want %+v", msgs[0].Reactions, want)
+	}
+	if got := msgs[0].ThreadReplies[0].Reactions[0].Name; got != "laughing" {
+		t.Errorf("reply reaction = %q, want laughing", got)
+	}
+	if got := firstReactor(&msgs[0]); got != "U1" {
+		t.Errorf("firstReactor() after merging = %q, want U1", got)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/pii"
+	"github.com/wham/gh-slackdump/internal/walk"
+)
+
+var (
+	redactText     bool
+	redactPatterns []string
+)
+
+// textRedactor masks the text of the messages written with --redact or
+// --redact-pattern, nil without; checkRedactFlags sets it.
+var textRedactor *pii.Redactor
+
+// checkRedactFlags sets textRedactor from --redact and --redact-pattern.
+func checkRedactFlags() error {
+	textRedactor = nil
+	if !redactText && len(redactPatterns) == 0 {
+		return nil
+	}
+	r, err := pii.New(redactText, redactPatterns)
+	if err != nil {
+		return fmt.Errorf("--redact-pattern: %w", err)
+	}
+	textRedactor = r
+	return nil
+}
+
+// redactVisitor masks the text walk visits, for --redact.
+func redactVisitor() walk.Visitor {
+	return walk.Visitor{Text: textRedactor.String}
+}
+
+// redactConversations masks the text of convs with --redact or
+// --redact-pattern, after their users are resolved.
+func redactConversations(convs ...*types.Conversation) {
+	if textRedactor == nil {
+		return
+	}
+	for _, conv := range convs {
+		walk.Conversation(conv, redactVisitor())
+	}
+}
+
+// formatCounts renders counts of the run summary by kind, such as the
+// redactions by type, as "3 email, 1 phone".
+func formatCounts(counts map[string]int) string {
+	var parts []string
+	for _, kind := range slices.Sorted(maps.Keys(counts)) {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[kind], kind))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestRedactConversations(t *testing.T) {
+	oldText, oldPatterns := redactText, redactPatterns
+	defer func() { redactText, redactPatterns, textRedactor = oldText, oldPatterns, nil }()
+	redactText, redactPatterns = true, []string{`ticket=SEC-\d+`}
+	if err := checkRedactFlags(); err != nil {
+		t.Fatal(err)
+	}
+
+	conv := &types.Conversation{Messages: []types.Message{{
+		Message: slack.Message{Msg: slack.Msg{
+			User:        "U09036M8VEU",
+			Text:        "mail carol@example.com about SEC-1234",
+			Attachments: []slack.Attachment{{Text: "call 555-123-4567"}},
+		}},
+		ThreadReplies: []types.Message{{Message: slack.Message{Msg: slack.Msg{Text: "or dave@example.com"}}}},
+	}}}
+	redactConversations(conv)
+
+	msg := conv.Messages[0]
+	if msg.Text != "mail [REDACTED:email] about [REDACTED:ticket]" || msg.Attachments[0].Text != "call [REDACTED:phone]" || msg.ThreadReplies[0].Text != "or [REDACTED:email]" {
+		t.Errorf("redacted = %q, %q, %q", msg.Text, msg.Attachments[0].Text, msg.ThreadReplies[0].Text)
+	}
+	if msg.User != "U09036M8VEU" {
+		t.Errorf("User = %q, want it untouched", msg.User)
+	}
+
+	var buf bytes.Buffer
+	if err := writeSummary(&buf, runSummary{Redactions: textRedactor.Counts()}, false); err != nil {
+		t.Fatal(err)
+	}
+	if want := "redacted 2 email, 1 phone, 1 ticket\n"; !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("summary = %q, want it to end with %q", buf.String(), want)
+	}
+}
+
+func TestCheckRedactFlagsBadPattern(t *testing.T) {
+	oldPatterns := redactPatterns
+	defer func() { redactPatterns, textRedactor = oldPatterns, nil }()
+	redactPatterns = []string{`[`}
+	if err := checkRedactFlags(); err == nil || !strings.Contains(err.Error(), "--redact-pattern") {
+		t.Errorf("checkRedactFlags() = %v, want a --redact-pattern error", err)
+	}
+}
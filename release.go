@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cli/go-gh/v2/pkg/api"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// releaseTarget is the release named by --release owner/repo@tag.
+type releaseTarget struct {
+	owner, repo, tag string
+}
+
+func (t releaseTarget) String() string {
+	return t.owner + "/" + t.repo + "@" + t.tag
+}
+
+// parseReleaseTarget parses owner/repo@tag.
+func parseReleaseTarget(s string) (releaseTarget, error) {
+	repo, tag, ok := strings.Cut(s, "@")
+	owner, name, ok2 := strings.Cut(repo, "/")
+	if !ok || !ok2 || owner == "" || name == "" || tag == "" || strings.Contains(name, "/") {
+		return releaseTarget{}, fmt.Errorf("invalid release %q: use owner/repo@tag", s)
+	}
+	return releaseTarget{owner: owner, repo: name, tag: tag}, nil
+}
+
+type release struct {
+	ID        int64          `json:"id"`
+	UploadURL string         `json:"upload_url"`
+	Assets    []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	ID                 int64  `json:"id"`
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// releaseUploader uploads files as GitHub release assets.
+type releaseUploader struct {
+	rest *api.RESTClient
+	// http sends the uploads, which need an explicit Content-Length that
+	// RESTClient can't set.
+	http *http.Client
+	// apiBase prefixes REST paths; empty means the gh host's API.
+	apiBase string
+	// create creates the release when the tag has none.
+	create bool
+}
+
+// assetFile is a file to upload and the name of its asset.
+type assetFile struct {
+	path, name string
+}
+
+// newReleaseUploader returns an uploader authenticated as the gh user.
+func newReleaseUploader(create bool) (*releaseUploader, error) {
+	rest, err := api.DefaultRESTClient()
+	if err != nil {
+		return nil, err
+	}
+	hc, err := api.DefaultHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	return &releaseUploader{rest: rest, http: hc, create: create}, nil
+}
+
+// uploadingSuffix names an asset while it is uploaded to replace the asset
+// of the name without it.
+const uploadingSuffix = ".uploading"
+
+// upload attaches each file to the target release, streaming it from disk,
+// and returns the download URLs of the new assets. An asset with the same
+// name is replaced: the file is uploaded under a temporary name first, and
+// the old asset deleted only once that succeeds, so a failed upload leaves
+// it in place.
+func (u *releaseUploader) upload(ctx context.Context, target releaseTarget, files []assetFile) ([]string, error) {
+	rel, err := u.findRelease(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	var urls []string
+	for _, f := range files {
+		name := f.name
+		var old []releaseAsset
+		for _, a := range rel.Assets {
+			switch a.Name {
+			case name:
+				old = append(old, a)
+			case name + uploadingSuffix:
+				// Left by an upload that failed after it started.
+				if err := u.deleteAsset(ctx, target, a); err != nil {
+					return urls, err
+				}
+			}
+		}
+		if len(old) > 0 {
+			f.name += uploadingSuffix
+		}
+		asset, err := u.uploadAsset(ctx, rel, f)
+		if err != nil {
+			return urls, fmt.Errorf("uploading %s: %w", name, err)
+		}
+		if len(old) > 0 {
+			slog.Info("replacing release asset", "release", target.String(), "name", name)
+			for _, a := range old {
+				if err := u.deleteAsset(ctx, target, a); err != nil {
+					return urls, err
+				}
+			}
+			if asset, err = u.renameAsset(ctx, target, asset, name); err != nil {
+				return urls, err
+			}
+		}
+		slog.Info("uploaded release asset", "release", target.String(), "name", asset.Name)
+		urls = append(urls, asset.BrowserDownloadURL)
+	}
+	return urls, nil
+}
+
+// deleteAsset deletes asset a of the target release.
+func (u *releaseUploader) deleteAsset(ctx context.Context, target releaseTarget, a releaseAsset) error {
+	path := fmt.Sprintf("repos/%s/%s/releases/assets/%d", target.owner, target.repo, a.ID)
+	if err := u.rest.DoWithContext(ctx, http.MethodDelete, u.apiBase+path, nil, nil); err != nil {
+		return fmt.Errorf("deleting asset %s: %w", a.Name, err)
+	}
+	return nil
+}
+
+// renameAsset renames asset a of the target release to name.
+func (u *releaseUploader) renameAsset(ctx context.Context, target releaseTarget, a *releaseAsset, name string) (*releaseAsset, error) {
+	body, err := json.Marshal(map[string]string{"name": name})
+	if err != nil {
+		return nil, err
+	}
+	var renamed releaseAsset
+	path := fmt.Sprintf("repos/%s/%s/releases/assets/%d", target.owner, target.repo, a.ID)
+	if err := u.rest.DoWithContext(ctx, http.MethodPatch, u.apiBase+path, bytes.NewReader(body), &renamed); err != nil {
+		return nil, fmt.Errorf("renaming asset %s to %s: %w", a.Name, name, err)
+	}
+	return &renamed, nil
+}
+
+// findRelease looks up the release for the target tag, creating it when
+// allowed.
+func (u *releaseUploader) findRelease(ctx context.Context, target releaseTarget) (*release, error) {
+	var rel release
+	path := fmt.Sprintf("repos/%s/%s/releases/tags/%s", target.owner, target.repo, url.PathEscape(target.tag))
+	err := u.rest.DoWithContext(ctx, http.MethodGet, u.apiBase+path, nil, &rel)
+	if err == nil {
+		return &rel, nil
+	}
+	var httpErr *api.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		return nil, fmt.Errorf("looking up release %s: %w", target, err)
+	}
+	if !u.create {
+		return nil, fmt.Errorf("release %s not found: pass --create-release to create it", target)
+	}
+
+	body, err := json.Marshal(map[string]string{"tag_name": target.tag})
+	if err != nil {
+		return nil, err
+	}
+	path = fmt.Sprintf("repos/%s/%s/releases", target.owner, target.repo)
+	if err := u.rest.DoWithContext(ctx, http.MethodPost, u.apiBase+path, bytes.NewReader(body), &rel); err != nil {
+		return nil, fmt.Errorf("creating release %s: %w", target, err)
+	}
+	slog.Info("created release", "release", target.String())
+	return &rel, nil
+}
+
+// uploadAsset streams file to the release's upload URL.
+func (u *releaseUploader) uploadAsset(ctx context.Context, rel *release, file assetFile) (*releaseAsset, error) {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// upload_url is a URI template: ".../assets{?name,label}".
+	base, _, _ := strings.Cut(rel.UploadURL, "{")
+	name := file.name
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"?name="+url.QueryEscape(name), f)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = info.Size()
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := u.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, api.HandleHTTPError(resp)
+	}
+	var asset releaseAsset
+	if err := json.NewDecoder(resp.Body).Decode(&asset); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// dumpChannel is the channel the run dumped, which names its release asset
+// and gist; "" for a --threads-file digest.
+var dumpChannel string
+
+// dumpChannelName returns the name of dumpChannel from conversations.info,
+// or its ID for a DM or when that fails; "" for a digest.
+func dumpChannelName(ctx context.Context) string {
+	if dumpChannel == "" {
+		return ""
+	}
+	ch := conversationInfo(ctx, &types.Conversation{ID: dumpChannel})
+	if ch.IsIM {
+		return dumpChannel
+	}
+	return cmp.Or(ch.Name, dumpChannel)
+}
+
+// releaseAssetName names the release asset of path after channel and the
+// UTC days from and to, keeping path's extensions, e.g.
+// general_2024-06-01_2024-07-01.json.gz.age; a zero day is left out. Without a
+// channel (a digest), it is path's base name.
+func releaseAssetName(path, channel string, from, to time.Time) string {
+	if channel == "" {
+		return filepath.Base(path)
+	}
+	base, aext := filepath.Base(path), ""
+	if strings.HasSuffix(base, ageExt) {
+		base, aext = strings.TrimSuffix(base, ageExt), ageExt
+	}
+	base, zext := trimCompressionExt(base)
+	name := channel
+	for _, t := range []time.Time{from, to} {
+		if !t.IsZero() {
+			name += "_" + t.UTC().Format(time.DateOnly)
+		}
+	}
+	return name + filepath.Ext(base) + zext + aext
+}
+
+// dumpDays returns the range the run dumped: --from and --to, or where
+// they aren't given, the oldest and newest message dumped.
+func dumpDays() (from, to time.Time) {
+	from, _ = parseTime(fromTime)
+	to, _ = parseTime(toTime)
+	if runStats != nil {
+		if from.IsZero() && runStats.From != nil {
+			from = *runStats.From
+		}
+		if to.IsZero() && runStats.To != nil {
+			to = *runStats.To
+		}
+	}
+	return from, to
+}
+
+// publishOutput writes the --anonymize-map and the --manifest, uploads the -o file and the
+// manifest to the --release target, printing the asset URLs, and creates
+// the --gist gist.
+func publishOutput(ctx context.Context) error {
+	if anonymizeMapPath() != "" {
+		if err := writeAnonymizeMap(); err != nil {
+			return err
+		}
+	}
+	if writeManifest {
+		if err := writeDumpManifest(ctx); err != nil {
+			return err
+		}
+	}
+	if releaseSpec != "" {
+		target, err := parseReleaseTarget(releaseSpec)
+		if err != nil {
+			return err
+		}
+		u, err := newReleaseUploader(createRelease)
+		if err != nil {
+			return err
+		}
+		from, to := dumpDays()
+		path := encryptedPath(outputFile)
+		files := []assetFile{{path: path, name: releaseAssetName(path, dumpChannelName(ctx), from, to)}}
+		if writeManifest {
+			files = append(files, assetFile{path: manifestPath(), name: files[0].name + manifestSuffix})
+		}
+		urls, err := u.upload(ctx, target, files)
+		for _, link := range urls {
+			fmt.Println(link)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if gist {
+		return publishGist(ctx)
+	}
+	return nil
+}
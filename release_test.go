@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cli/go-gh/v2/pkg/api"
+)
+
+func TestParseReleaseTarget(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    releaseTarget
+		wantErr bool
+	}{
+		{input: "myorg/archive@v1", want: releaseTarget{owner: "myorg", repo: "archive", tag: "v1"}},
+		{input: "myorg/archive@2024-06/slack", want: releaseTarget{owner: "myorg", repo: "archive", tag: "2024-06/slack"}},
+		{input: "myorg/archive", wantErr: true},
+		{input: "archive@v1", wantErr: true},
+		{input: "myorg/archive@", wantErr: true},
+		{input: "/archive@v1", wantErr: true},
+		{input: "myorg/a/b@v1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseReleaseTarget(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseReleaseTarget(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseReleaseTarget(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeReleases is a minimal GitHub releases API for one repository.
+type fakeReleases struct {
+	t        *testing.T
+	mu       sync.Mutex
+	srv      *httptest.Server
+	releases map[string]*release // by tag
+	uploads  map[string][]byte   // by asset name
+	deleted  []int64
+	nextID   int64
+	// failUploads makes every upload fail.
+	failUploads bool
+	// uploaded holds the names of the uploaded assets, by ID.
+	uploaded map[int64]string
+}
+
+func newFakeReleases(t *testing.T) *fakeReleases {
+	f := &fakeReleases{t: t, releases: map[string]*release{}, uploads: map[string][]byte{}, uploaded: map[int64]string{}, nextID: 100}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeReleases) addRelease(tag string, assets ...string) {
+	f.nextID++
+	rel := &release{ID: f.nextID, UploadURL: fmt.Sprintf("%s/uploads/repos/o/r/releases/%d/assets{?name,label}", f.srv.URL, f.nextID)}
+	for _, name := range assets {
+		f.nextID++
+		rel.Assets = append(rel.Assets, releaseAsset{ID: f.nextID, Name: name})
+	}
+	f.releases[tag] = rel
+}
+
+func (f *fakeReleases) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if got := r.Header.Get("Authorization"); got != "token secret" {
+		f.t.Errorf("%s %s: Authorization = %q", r.Method, r.URL.Path, got)
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/repos/o/r/releases/tags/"):
+		rel, ok := f.releases[strings.TrimPrefix(r.URL.Path, "/repos/o/r/releases/tags/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Not Found"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(rel)
+	case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/releases":
+		var body struct {
+			TagName string `json:"tag_name"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.addRelease(body.TagName)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(f.releases[body.TagName])
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/repos/o/r/releases/assets/"):
+		var id int64
+		fmt.Sscan(strings.TrimPrefix(r.URL.Path, "/repos/o/r/releases/assets/"), &id)
+		f.deleted = append(f.deleted, id)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/uploads/"):
+		if r.ContentLength < 0 {
+			f.t.Error("upload has no Content-Length")
+		}
+		data, _ := io.ReadAll(r.Body)
+		if int64(len(data)) != r.ContentLength {
+			f.t.Errorf("upload body is %d bytes, Content-Length %d", len(data), r.ContentLength)
+		}
+		if f.failUploads {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{"message":"Bad Gateway"}`))
+			return
+		}
+		name := r.URL.Query().Get("name")
+		f.uploads[name] = data
+		f.nextID++
+		f.uploaded[f.nextID] = name
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(releaseAsset{ID: f.nextID, Name: name, BrowserDownloadURL: "https://example.com/download/" + name})
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/repos/o/r/releases/assets/"):
+		var id int64
+		fmt.Sscan(strings.TrimPrefix(r.URL.Path, "/repos/o/r/releases/assets/"), &id)
+		var body struct {
+			Name string `json:"name"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		old, ok := f.uploaded[id]
+		if !ok {
+			f.t.Errorf("renaming asset %d, which wasn't uploaded", id)
+		}
+		f.uploads[body.Name] = f.uploads[old]
+		delete(f.uploads, old)
+		json.NewEncoder(w).Encode(releaseAsset{ID: id, Name: body.Name, BrowserDownloadURL: "https://example.com/download/" + body.Name})
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeReleases) uploader(create bool) *releaseUploader {
+	opts := api.ClientOptions{Host: "127.0.0.1", AuthToken: "secret", Transport: http.DefaultTransport, LogIgnoreEnv: true}
+	rest, err := api.NewRESTClient(opts)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	hc, err := api.NewHTTPClient(opts)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return &releaseUploader{rest: rest, http: hc, apiBase: f.srv.URL + "/", create: create}
+}
+
+func TestReleaseUploaderUpload(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    []string // assets on an existing release; nil means no release
+		create      bool
+		failUpload  bool
+		wantErr     string
+		wantDeleted int
+	}{
+		{name: "existing release", existing: []string{}},
+		{name: "missing release", wantErr: "pass --create-release"},
+		{name: "creates release", create: true},
+		{name: "replaces asset", existing: []string{"other.json", "dump.json"}, wantDeleted: 1},
+		{name: "clears a failed replacement", existing: []string{"dump.json", "dump.json.uploading"}, wantDeleted: 2},
+		// The old asset stays when its replacement can't be uploaded.
+		{name: "failed replacement", existing: []string{"dump.json"}, failUpload: true, wantErr: "uploading dump.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeReleases(t)
+			fake.failUploads = tt.failUpload
+			if tt.existing != nil {
+				fake.addRelease("v1", tt.existing...)
+			}
+			file := filepath.Join(t.TempDir(), "dump.json")
+			content := []byte(strings.Repeat(`{"messages":[]}`, 1000))
+			if err := os.WriteFile(file, content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			target := releaseTarget{owner: "o", repo: "r", tag: "v1"}
+			urls, err := fake.uploader(tt.create).upload(context.Background(), target, []assetFile{{path: file, name: "dump.json"}})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("upload() error = %v, want containing %q", err, tt.wantErr)
+				}
+				if len(fake.uploads) != 0 || len(fake.deleted) != 0 {
+					t.Errorf("uploaded %d and deleted %d assets after an error", len(fake.uploads), len(fake.deleted))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("upload() error: %v", err)
+			}
+			if len(urls) != 1 || urls[0] != "https://example.com/download/dump.json" {
+				t.Errorf("urls = %v, want the asset download URL", urls)
+			}
+			if got := fake.uploads["dump.json"]; string(got) != string(content) || len(fake.uploads) != 1 {
+				t.Errorf("uploaded %d bytes as %d assets, want the %d-byte file as dump.json", len(got), len(fake.uploads), len(content))
+			}
+			if len(fake.deleted) != tt.wantDeleted {
+				t.Errorf("deleted %d assets, want %d", len(fake.deleted), tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestReleaseAssetName(t *testing.T) {
+	from := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		path, channel string
+		from, to      time.Time
+		want          string
+	}{
+		{"archive.json.gz", "general", from, to, "general_2024-06-01_2024-07-01.json.gz"},
+		{"out/general.html", "general", from, time.Time{}, "general_2024-06-01.html"},
+		{"archive.json.zst.age", "general", from, to, "general_2024-06-01_2024-07-01.json.zst.age"},
+		{"digest.md", "", from, to, "digest.md"},
+	}
+	for _, tt := range tests {
+		if got := releaseAssetName(tt.path, tt.channel, tt.from, tt.to); got != tt.want {
+			t.Errorf("releaseAssetName(%q, %q) = %q, want %q", tt.path, tt.channel, got, tt.want)
+		}
+	}
+}
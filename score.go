@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// scoreWeights weighs the engagement signals that make up a message's
+// importance score.
+type scoreWeights struct {
+	Reactions  float64
+	Replies    float64
+	ReplyUsers float64
+	Pinned     float64
+}
+
+// defaultScoreWeights are used when --sort score or --top is given without
+// --score.
+var defaultScoreWeights = scoreWeights{Reactions: 1, Replies: 1, ReplyUsers: 1, Pinned: 5}
+
+// parseScoreWeights parses a --score value such as
+// "reactions=2,replies=1,pinned=10". Signals that aren't listed weigh 0.
+func parseScoreWeights(s string) (scoreWeights, error) {
+	var w scoreWeights
+	fields := map[string]*float64{
+		"reactions":   &w.Reactions,
+		"replies":     &w.Replies,
+		"reply_users": &w.ReplyUsers,
+		"pinned":      &w.Pinned,
+	}
+	for part := range strings.SplitSeq(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return w, fmt.Errorf("invalid weight %q: use name=value", part)
+		}
+		dst, known := fields[name]
+		if !known {
+			return w, fmt.Errorf("unknown signal %q: use reactions, replies, reply_users, or pinned", name)
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return w, fmt.Errorf("invalid weight for %s: %q", name, value)
+		}
+		*dst = f
+	}
+	return w, nil
+}
+
+// score computes the importance score of a message.
+func (w scoreWeights) score(m *types.Message) float64 {
+	reactions := 0
+	for _, r := range m.Reactions {
+		reactions += r.Count
+	}
+	pinned := 0.0
+	if len(m.PinnedTo) > 0 {
+		pinned = 1
+	}
+	return w.Reactions*float64(reactions) +
+		w.Replies*float64(m.ReplyCount) +
+		w.ReplyUsers*float64(len(m.ReplyUsers)) +
+		w.Pinned*pinned
+}
+
+// rankMessages returns msgs ordered by descending score, ties broken by the
+// older ts first.
+func rankMessages(msgs []outMessage) []outMessage {
+	ranked := append([]outMessage(nil), msgs...)
+	sort.SliceStable(ranked, func(i, j int) bool { return rankedBefore(ranked[i], ranked[j]) })
+	return ranked
+}
+
+// rankedBefore reports whether a ranks above b: a higher score, or the
+// same score and an older ts.
+func rankedBefore(a, b outMessage) bool {
+	if *a.Score != *b.Score {
+		return *a.Score > *b.Score
+	}
+	return tsAfter(b.Timestamp, a.Timestamp)
+}
+
+// topMessages keeps the n highest-scoring messages. The kept messages stay
+// in their original order. They are picked by position, not ts, as
+// messages of different authors can share a ts.
+func topMessages(msgs []outMessage, n int) []outMessage {
+	if n <= 0 || n >= len(msgs) {
+		return msgs
+	}
+	order := make([]int, len(msgs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return rankedBefore(msgs[order[i]], msgs[order[j]]) })
+	keep := make([]bool, len(msgs))
+	for _, i := range order[:n] {
+		keep[i] = true
+	}
+	out := make([]outMessage, 0, n)
+	for i, m := range msgs {
+		if keep[i] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
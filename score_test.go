@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestParseScoreWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    scoreWeights
+		wantErr bool
+	}{
+		{name: "all signals", input: "reactions=2,replies=1,reply_users=0.5,pinned=10", want: scoreWeights{Reactions: 2, Replies: 1, ReplyUsers: 0.5, Pinned: 10}},
+		{name: "unlisted weigh zero", input: "pinned=3", want: scoreWeights{Pinned: 3}},
+		{name: "spaces", input: "reactions=1, replies=2", want: scoreWeights{Reactions: 1, Replies: 2}},
+		{name: "unknown signal", input: "stars=1", wantErr: true},
+		{name: "missing value", input: "reactions", wantErr: true},
+		{name: "bad number", input: "reactions=lots", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseScoreWeights(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseScoreWeights(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseScoreWeights(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreWeightsScore(t *testing.T) {
+	m := &types.Message{Message: slack.Message{Msg: slack.Msg{
+		Reactions:  []slack.ItemReaction{{Name: "eyes", Count: 2}, {Name: "tada", Count: 1}},
+		ReplyCount: 4,
+		ReplyUsers: []string{"U1", "U2"},
+		PinnedTo:   []string{"C1"},
+	}}}
+	w := scoreWeights{Reactions: 2, Replies: 1, ReplyUsers: 0.5, Pinned: 10}
+	if got, want := w.score(m), 2*3+4+0.5*2+10.0; got != want {
+		t.Errorf("score() = %v, want %v", got, want)
+	}
+}
+
+func TestTopMessagesSharedTS(t *testing.T) {
+	score := func(s float64) *float64 { return &s }
+	msg := func(ts, user string, s float64) outMessage {
+		return outMessage{Message: types.Message{Message: slack.Message{Msg: slack.Msg{Timestamp: ts, User: user}}}, Score: score(s)}
+	}
+	msgs := []outMessage{
+		msg("1700000001.000000", "U1", 1),
+		msg("1700000001.000000", "U2", 9),
+		msg("1700000002.000000", "U1", 5),
+		msg("1700000003.000000", "U1", 0),
+	}
+	got := topMessages(msgs, 2)
+	if len(got) != 2 || got[0].User != "U2" || got[1].Timestamp != "1700000002.000000" {
+		t.Errorf("topMessages(2) = %v, want U2's message and 1700000002.000000", got)
+	}
+}
+
+func TestBuildOutputRanking(t *testing.T) {
+	conv := &types.Conversation{ID: "C1", Messages: []types.Message{
+		{Message: slack.Message{Msg: slack.Msg{Timestamp: "1700000001.000000", ReplyCount: 1}}},
+		{Message: slack.Message{Msg: slack.Msg{Timestamp: "1700000002.000000", ReplyCount: 5}}},
+		{Message: slack.Message{Msg: slack.Msg{Timestamp: "1700000003.000000", ReplyCount: 1}}},
+		{Message: slack.Message{Msg: slack.Msg{Timestamp: "1700000004.000000"}}},
+	}}
+	w := scoreWeights{Replies: 1}
+
+	tests := []struct {
+		name string
+		opts encodeOptions
+		want []string
+	}{
+		{name: "chronological", opts: encodeOptions{weights: &w}, want: []string{"1700000001.000000", "1700000002.000000", "1700000003.000000", "1700000004.000000"}},
+		{name: "by score with ts tie-break", opts: encodeOptions{weights: &w, sortBy: "score"}, want: []string{"1700000002.000000", "1700000001.000000", "1700000003.000000", "1700000004.000000"}},
+		{name: "top keeps chronological order", opts: encodeOptions{weights: &w, top: 2}, want: []string{"1700000001.000000", "1700000002.000000"}},
+		{name: "top by score", opts: encodeOptions{weights: &w, sortBy: "score", top: 3}, want: []string{"1700000002.000000", "1700000001.000000", "1700000003.000000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := buildOutput(conv, tt.opts)
+			var got []string
+			for _, m := range out.Messages {
+				got = append(got, m.Timestamp)
+				if m.Score == nil {
+					t.Errorf("message %s has no score", m.Timestamp)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("messages = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("messages = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
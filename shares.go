@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rusq/slackdump/v3"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// sharedMessage is the normalized form of an attachment that shares
+// (forwards) another Slack message.
+type sharedMessage struct {
+	// Attachment is the index of the share in the message's attachments.
+	Attachment int    `json:"attachment"`
+	ChannelID  string `json:"channel_id"`
+	TS         string `json:"ts"`
+	ThreadTS   string `json:"thread_ts,omitempty"`
+	// Author is the original author's user ID, or handle with -u.
+	Author     string `json:"author,omitempty"`
+	AuthorName string `json:"author_name,omitempty"`
+	Text       string `json:"text,omitempty"`
+	Permalink  string `json:"permalink"`
+	// Thread is the original message's thread, fetched with --expand-shares.
+	Thread []types.Message `json:"thread,omitempty"`
+}
+
+// conversationDumper is the part of slackdump.Session used to expand shares.
+type conversationDumper interface {
+	Dump(ctx context.Context, link string, oldest, latest time.Time, processFn ...slackdump.ProcessFunc) (*types.Conversation, error)
+}
+
+// parseShareLink extracts the shared message's location from an
+// attachment's from_url, e.g.
+// https://x.slack.com/archives/C123/p1700000000123456?thread_ts=1699999999.000100.
+func parseShareLink(link string) (channel, ts, threadTS string, ok bool) {
+	ts, ok = threadTSFromLink(link)
+	if !ok {
+		return "", "", "", false
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", "", "", false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 3 {
+		return "", "", "", false
+	}
+	return parts[1], ts, u.Query().Get("thread_ts"), true
+}
+
+// sharedMessages returns the message shares among m's attachments. threads
+// holds the threads fetched with --expand-shares, keyed by shareKey.
+func sharedMessages(m *types.Message, threads map[string][]types.Message) []sharedMessage {
+	var out []sharedMessage
+	for i, a := range m.Attachments {
+		channel, ts, threadTS, ok := parseShareLink(a.FromURL)
+		if !ok {
+			continue
+		}
+		out = append(out, sharedMessage{
+			Attachment: i,
+			ChannelID:  channel,
+			TS:         ts,
+			ThreadTS:   threadTS,
+			Author:     a.AuthorID,
+			AuthorName: a.AuthorName,
+			Text:       a.Text,
+			Permalink:  a.FromURL,
+			Thread:     threads[shareKey(channel, ts, threadTS)],
+		})
+	}
+	return out
+}
+
+// shareKey identifies the thread a shared message belongs to.
+func shareKey(channel, ts, threadTS string) string {
+	if threadTS == "" {
+		threadTS = ts
+	}
+	return channel + ":" + threadTS
+}
+
+// expandShares fetches the thread of every message shared in conv. Shares
+// the token can't read are logged and skipped.
+func expandShares(ctx context.Context, sd conversationDumper, conv *types.Conversation) map[string][]types.Message {
+	return expandNewShares(ctx, sd, conv, nil)
+}
+
+// expandNewShares is expandShares for shares not already in known, which
+// it leaves alone; it returns only the newly fetched threads.
+func expandNewShares(ctx context.Context, sd conversationDumper, conv *types.Conversation, known map[string][]types.Message) map[string][]types.Message {
+	threads := make(map[string][]types.Message)
+	var visit func(msgs []types.Message)
+	visit = func(msgs []types.Message) {
+		for i := range msgs {
+			for _, a := range msgs[i].Attachments {
+				channel, ts, threadTS, ok := parseShareLink(a.FromURL)
+				if !ok {
+					continue
+				}
+				key := shareKey(channel, ts, threadTS)
+				if _, done := threads[key]; done {
+					continue
+				}
+				if _, done := known[key]; done {
+					continue
+				}
+				shared, err := sd.Dump(ctx, key, time.Time{}, time.Time{})
+				if err != nil {
+					slog.Warn("can't expand shared message", "link", a.FromURL, "error", err)
+					threads[key] = nil
+					continue
+				}
+				threads[key] = shared.Messages
+			}
+			visit(msgs[i].ThreadReplies)
+		}
+	}
+	visit(conv.Messages)
+	return threads
+}
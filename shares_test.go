@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestParseShareLink(t *testing.T) {
+	tests := []struct {
+		name                         string
+		link                         string
+		wantChannel, wantTS, wantThr string
+		wantOK                       bool
+	}{
+		{
+			name:        "message",
+			link:        "https://x.slack.com/archives/C123/p1700000000123456",
+			wantChannel: "C123", wantTS: "1700000000.123456", wantOK: true,
+		},
+		{
+			name:        "thread reply",
+			link:        "https://x.slack.com/archives/C123/p1700000000123456?thread_ts=1699999999.000100&cid=C123",
+			wantChannel: "C123", wantTS: "1700000000.123456", wantThr: "1699999999.000100", wantOK: true,
+		},
+		{name: "channel link", link: "https://x.slack.com/archives/C123"},
+		{name: "external link", link: "https://example.com/article"},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel, ts, thr, ok := parseShareLink(tt.link)
+			if ok != tt.wantOK || channel != tt.wantChannel || ts != tt.wantTS || thr != tt.wantThr {
+				t.Errorf("parseShareLink(%q) = %q, %q, %q, %v, want %q, %q, %q, %v",
+					tt.link, channel, ts, thr, ok, tt.wantChannel, tt.wantTS, tt.wantThr, tt.wantOK)
+			}
+		})
+	}
+}
+
+func shareMsg(ts string, attachments ...slack.Attachment) types.Message {
+	m := msg(ts)
+	m.Attachments = attachments
+	return m
+}
+
+func TestBuildOutputSharedMessages(t *testing.T) {
+	share := slack.Attachment{
+		AuthorID:   "U1",
+		AuthorName: "Alice",
+		Text:       "original text",
+		FromURL:    "https://x.slack.com/archives/C9/p1700000000000100",
+	}
+	link := slack.Attachment{Title: "Docs", FromURL: "https://example.com/docs"}
+	conv := &types.Conversation{Messages: []types.Message{
+		shareMsg("1.0", link, share),
+		shareMsg("2.0", link),
+	}}
+	threads := map[string][]types.Message{"C9:1700000000.000100": {msg("1700000000.000100"), msg("1700000001.000100")}}
+
+	out := buildOutput(conv, encodeOptions{sharedThreads: threads})
+	got := out.Messages[0].SharedMessages
+	if len(got) != 1 {
+		t.Fatalf("got %d shared messages, want 1", len(got))
+	}
+	s := got[0]
+	if s.Attachment != 1 || s.ChannelID != "C9" || s.TS != "1700000000.000100" || s.Author != "U1" ||
+		s.AuthorName != "Alice" || s.Text != "original text" || s.Permalink != share.FromURL {
+		t.Errorf("shared message = %+v", s)
+	}
+	if len(s.Thread) != 2 {
+		t.Errorf("thread has %d messages, want 2", len(s.Thread))
+	}
+	if n := len(out.Messages[1].SharedMessages); n != 0 {
+		t.Errorf("message without shares got %d shared messages", n)
+	}
+}
+
+type fakeDumper struct {
+	convs map[string]*types.Conversation
+	calls []string
+}
+
+func (f *fakeDumper) Dump(_ context.Context, link string, _, _ time.Time, _ ...slackdump.ProcessFunc) (*types.Conversation, error) {
+	f.calls = append(f.calls, link)
+	if c, ok := f.convs[link]; ok {
+		return c, nil
+	}
+	return nil, errors.New("channel_not_found")
+}
+
+func TestExpandShares(t *testing.T) {
+	reply := slack.Attachment{FromURL: "https://x.slack.com/archives/C1/p1700000000000200?thread_ts=1700000000.000100"}
+	parent := slack.Attachment{FromURL: "https://x.slack.com/archives/C1/p1700000000000100"}
+	private := slack.Attachment{FromURL: "https://x.slack.com/archives/G7/p1700000000000300"}
+	conv := &types.Conversation{Messages: []types.Message{
+		shareMsg("1.0", reply),
+		msg("2.0", shareMsg("2.1", parent, private)),
+	}}
+	sd := &fakeDumper{convs: map[string]*types.Conversation{
+		"C1:1700000000.000100": {Messages: []types.Message{msg("1700000000.000100"), msg("1700000000.000200")}},
+	}}
+
+	threads := expandShares(context.Background(), sd, conv)
+	if len(sd.calls) != 2 {
+		t.Errorf("Dump called %d times (%v), want 2: shares of the same thread are fetched once", len(sd.calls), sd.calls)
+	}
+	if n := len(threads["C1:1700000000.000100"]); n != 2 {
+		t.Errorf("thread C1 has %d messages, want 2", n)
+	}
+	if msgs, ok := threads["G7:1700000000.000300"]; !ok || msgs != nil {
+		t.Errorf("unreadable share = %v, %v, want recorded as nil", msgs, ok)
+	}
+	sd.calls = nil
+	if more := expandNewShares(context.Background(), sd, conv, threads); len(more) != 0 || len(sd.calls) != 0 {
+		t.Errorf("expandNewShares() refetched known shares: %v, calls %v", more, sd.calls)
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// splitSpec is a parsed --split-by or --split value.
+type splitSpec struct {
+	// count, from --split-by, is the most top-level messages per file; a
+	// thread always goes with its parent.
+	count int
+	// period, day or month from --split, splits by the UTC date of
+	// top-level messages instead, into files named by it in the -o
+	// directory.
+	period string
+}
+
+// Split periods, with the layout of the date that labels their files.
+var splitPeriods = map[string]string{
+	"day":   "2006-01-02",
+	"month": "2006-01",
+}
+
+// splitExts maps the formats --split takes to the extension of their files.
+var splitExts = map[string]string{
+	"json":        ".json",
+	"ndjson":      ".ndjson",
+	"gh-markdown": ".md",
+}
+
+// periodIndexName is the name of the index in the -o directory of --split.
+const periodIndexName = "index.json"
+
+// parseSplitBy parses a --split-by value: count:<N>.
+func parseSplitBy(v string) (splitSpec, error) {
+	kind, arg, _ := strings.Cut(v, ":")
+	switch kind {
+	case "count":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			return splitSpec{}, fmt.Errorf("count:%s: want a positive number of messages per file", arg)
+		}
+		return splitSpec{count: n}, nil
+	case "day", "month":
+		return splitSpec{}, fmt.Errorf("to write a file per %s, use --split %s with -o <directory>", kind, kind)
+	default:
+		return splitSpec{}, fmt.Errorf("unknown split %q: use count:<N>", v)
+	}
+}
+
+// parseSplitPeriod parses a --split value: day or month.
+func parseSplitPeriod(v string) (splitSpec, error) {
+	if _, ok := splitPeriods[v]; !ok {
+		return splitSpec{}, fmt.Errorf("unknown period %q: use day or month", v)
+	}
+	return splitSpec{period: v}, nil
+}
+
+func (s splitSpec) String() string {
+	if s.period != "" {
+		return s.period
+	}
+	return "count:" + strconv.Itoa(s.count)
+}
+
+// splits reports whether s splits the dump at all.
+func (s splitSpec) splits() bool {
+	return s.count > 0 || s.period != ""
+}
+
+// flag returns the flag s was given with, for error messages.
+func (s splitSpec) flag() string {
+	if s.period != "" {
+		return "--split"
+	}
+	return "--split-by"
+}
+
+// indexPath returns the path of the index of the dump s splits path into:
+// index.json in the -o directory of --split, next to the -o file of
+// --split-by.
+func (s splitSpec) indexPath(path string) string {
+	if s.period != "" {
+		return filepath.Join(path, periodIndexName)
+	}
+	return indexPath(path)
+}
+
+// label returns the label of the file a top-level message with ts goes
+// to, for a split by period: its UTC date, or "undated" if ts doesn't
+// parse.
+func (s splitSpec) label(ts string) string {
+	t, err := parseSlackTS(ts)
+	if err != nil {
+		return "undated"
+	}
+	return t.UTC().Format(splitPeriods[s.period])
+}
+
+// splitIndex is the index written with the files of a split dump. merge
+// reads it to put the dump back together.
+type splitIndex struct {
+	SplitBy string `json:"split_by"`
+	// Format is the format of the files, when it isn't JSON.
+	Format string       `json:"format,omitempty"`
+	Files  []splitChunk `json:"files"`
+	// OldestTS and LatestTS bound the ts of all top-level messages.
+	OldestTS string `json:"oldest_ts,omitempty"`
+	LatestTS string `json:"latest_ts,omitempty"`
+}
+
+// splitChunk describes one file of a split dump.
+type splitChunk struct {
+	// File is the file name, relative to the index.
+	File string `json:"file"`
+	// Messages counts the file's top-level messages.
+	Messages int `json:"messages"`
+	// Parts lists the files of a gh-markdown period that takes more than
+	// one GitHub comment, File being the first.
+	Parts []string `json:"parts,omitempty"`
+	// OldestTS and LatestTS bound the ts of the file's top-level messages.
+	OldestTS string `json:"oldest_ts,omitempty"`
+	LatestTS string `json:"latest_ts,omitempty"`
+}
+
+// add counts a top-level message with ts in c.
+func (c *splitChunk) add(ts string) {
+	c.Messages++
+	if c.OldestTS == "" || tsBefore(ts, c.OldestTS) {
+		c.OldestTS = ts
+	}
+	if c.LatestTS == "" || tsBefore(c.LatestTS, ts) {
+		c.LatestTS = ts
+	}
+}
+
+// finish sets the overall ts range of the index from its files.
+func (x *splitIndex) finish() {
+	for _, c := range x.Files {
+		if c.OldestTS != "" && (x.OldestTS == "" || tsBefore(c.OldestTS, x.OldestTS)) {
+			x.OldestTS = c.OldestTS
+		}
+		if c.LatestTS != "" && (x.LatestTS == "" || tsBefore(x.LatestTS, c.LatestTS)) {
+			x.LatestTS = c.LatestTS
+		}
+	}
+}
+
+// chunkPath returns the path of the n-th file of a dump split from path,
+// e.g. general.json → general.0001.json, keeping a compression extension
+// last: general.json.gz → general.0001.json.gz.
+func chunkPath(path string, n int) string {
+	path, zext := trimCompressionExt(path)
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%04d%s%s", strings.TrimSuffix(path, ext), n, ext, zext)
+}
+
+// periodPath returns the path of the file labeled label of a dump in
+// format split by period into dir, e.g. dir/2024-01-15.json, with the
+// extension of the output compression: dir/2024-01-15.json.gz.
+func periodPath(dir, label, format string) string {
+	return filepath.Join(dir, label+splitExts[format]+compressionExt(outputCompression))
+}
+
+// indexPath returns the path of the index of a dump split from path, e.g.
+// general.json → general.index.json. The index isn't compressed, so
+// general.json.gz has it too.
+func indexPath(path string) string {
+	path, _ = trimCompressionExt(path)
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".index" + ext
+}
+
+// splitPart is the top-level messages of one file of a split dump.
+type splitPart struct {
+	path string
+	msgs []outMessage
+}
+
+// splitParts divides msgs, in output order, into the files of a dump in
+// format split from path. A count split always has a file, empty if need
+// be; a period split has one per period with messages, oldest first.
+func splitParts(path, format string, msgs []outMessage, spec splitSpec) []splitPart {
+	var parts []splitPart
+	if spec.period == "" {
+		for start, n := 0, 1; start < len(msgs) || n == 1; start, n = start+spec.count, n+1 {
+			part := splitPart{path: chunkPath(path, n)}
+			if msgs != nil {
+				part.msgs = msgs[start:min(start+spec.count, len(msgs))]
+			}
+			parts = append(parts, part)
+		}
+		return parts
+	}
+	byLabel := make(map[string][]outMessage)
+	for _, m := range msgs {
+		label := spec.label(m.Timestamp)
+		byLabel[label] = append(byLabel[label], m)
+	}
+	for _, label := range slices.Sorted(maps.Keys(byLabel)) {
+		parts = append(parts, splitPart{path: periodPath(path, label, format), msgs: byLabel[label]})
+	}
+	return parts
+}
+
+// writeSplit writes doc as the files of spec, each with its top-level
+// messages in output order, and then the index. Every file carries the
+// same envelope, so each one is a valid dump on its own.
+func writeSplit(path string, doc *outConversation, spec splitSpec) error {
+	if spec.period != "" {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			return err
+		}
+	}
+	index := splitIndex{SplitBy: spec.String(), Files: []splitChunk{}}
+	var size outputSize
+	for _, p := range splitParts(path, "json", doc.Messages, spec) {
+		part := *doc
+		part.Messages = p.msgs
+		chunkSize, err := writeOutputTo(p.path, func(w io.Writer) error {
+			return encodeDocument(w, &part)
+		})
+		if err != nil {
+			return err
+		}
+		size = size.add(chunkSize)
+		index.Files = append(index.Files, describeChunk(filepath.Base(p.path), part.Messages))
+	}
+	if len(index.Files) == 0 {
+		slog.Warn("no messages to split, writing only the index", "index", spec.indexPath(path))
+	}
+	if err := writeSplitIndex(spec.indexPath(path), &index); err != nil {
+		return err
+	}
+	slog.Info("output written", "files", len(index.Files), "index", spec.indexPath(path), "size", size)
+	return nil
+}
+
+// writeSplitIndex writes index, with its overall range, to path.
+func writeSplitIndex(path string, index *splitIndex) error {
+	index.finish()
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return encodeIndented(w, index)
+	})
+}
+
+func describeChunk(file string, msgs []outMessage) splitChunk {
+	c := splitChunk{File: file}
+	for _, m := range msgs {
+		c.add(m.Timestamp)
+	}
+	return c
+}
+
+// tsBefore reports whether Slack timestamp a is older than b. Timestamps
+// that don't parse compare as strings.
+func tsBefore(a, b string) bool {
+	ta, errA := parseSlackTS(a)
+	tb, errB := parseSlackTS(b)
+	if errA != nil || errB != nil {
+		return a < b
+	}
+	return ta.Before(tb)
+}
+
+// periodWriter writes a streamed dump split by day or month into the
+// directory dir: rotate, called before each top-level message, switches to
+// the file of its period, so the writes that follow go there. Streamed
+// messages come newest page first, so the messages of a period arrive
+// together; a file is renamed into place as soon as the stream moves on to
+// another period.
+type periodWriter struct {
+	dir   string
+	spec  splitSpec
+	file  *atomicFile
+	comp  *compressor
+	label string
+	chunk splitChunk
+	index splitIndex
+	size  outputSize
+}
+
+func newPeriodWriter(dir string, spec splitSpec, format string) *periodWriter {
+	return &periodWriter{dir: dir, spec: spec, index: splitIndex{SplitBy: spec.String(), Format: format, Files: []splitChunk{}}}
+}
+
+func (pw *periodWriter) Write(p []byte) (int, error) {
+	if pw.comp == nil {
+		return 0, fmt.Errorf("split: write before the first message")
+	}
+	return pw.comp.Write(p)
+}
+
+// rotate makes the file of the top-level message with ts the current one.
+func (pw *periodWriter) rotate(ts string) error {
+	label := pw.spec.label(ts)
+	if pw.file == nil || label != pw.label {
+		if err := pw.closeFile(); err != nil {
+			return err
+		}
+		path := periodPath(pw.dir, label, pw.index.Format)
+		for _, c := range pw.index.Files {
+			if c.File == filepath.Base(path) {
+				return fmt.Errorf("split: a message of %s came after those of another %s", label, pw.spec.period)
+			}
+		}
+		f, err := createAtomic(path)
+		if err != nil {
+			return err
+		}
+		if pw.comp, err = newCompressor(f, outputCompression); err != nil {
+			f.abort()
+			return err
+		}
+		pw.file, pw.label = f, label
+		pw.chunk = splitChunk{File: filepath.Base(f.path)}
+	}
+	pw.chunk.add(ts)
+	return nil
+}
+
+// closeFile finishes the current file, if any, and adds it to the index.
+func (pw *periodWriter) closeFile() error {
+	if pw.file == nil {
+		return nil
+	}
+	f := pw.file
+	pw.file = nil
+	if err := pw.comp.Close(); err != nil {
+		f.abort()
+		return err
+	}
+	if err := f.commit(); err != nil {
+		return err
+	}
+	pw.size = pw.size.add(pw.comp.size())
+	pw.index.Files = append(pw.index.Files, pw.chunk)
+	return nil
+}
+
+// finish closes the last file and writes the index, its files oldest first.
+func (pw *periodWriter) finish() error {
+	if err := pw.closeFile(); err != nil {
+		return err
+	}
+	slices.SortFunc(pw.index.Files, func(a, b splitChunk) int { return strings.Compare(a.File, b.File) })
+	return writeSplitIndex(pw.spec.indexPath(pw.dir), &pw.index)
+}
+
+// abort drops the current file; files already finished stay.
+func (pw *periodWriter) abort() {
+	if pw.file != nil {
+		pw.file.abort()
+		pw.file = nil
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestParseSplitBy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{in: "count:10000", want: 10000},
+		{in: "count:1", want: 1},
+		{in: "count:0", wantErr: true},
+		{in: "count:-5", wantErr: true},
+		{in: "count:", wantErr: true},
+		{in: "count", wantErr: true},
+		{in: "size:10MB", wantErr: true},
+		{in: "day", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSplitBy(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSplitBy(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got.count != tt.want {
+			t.Errorf("parseSplitBy(%q) = %d, want %d", tt.in, got.count, tt.want)
+		}
+		if !tt.wantErr && got.String() != tt.in {
+			t.Errorf("parseSplitBy(%q).String() = %q", tt.in, got.String())
+		}
+	}
+}
+
+func TestParseSplitPeriod(t *testing.T) {
+	for in, ok := range map[string]bool{"day": true, "month": true, "week": false, "day:2": false, "": false} {
+		got, err := parseSplitPeriod(in)
+		if (err == nil) != ok {
+			t.Errorf("parseSplitPeriod(%q) error = %v, want ok %v", in, err, ok)
+			continue
+		}
+		if ok && (got.period != in || got.String() != in) {
+			t.Errorf("parseSplitPeriod(%q) = %+v", in, got)
+		}
+	}
+}
+
+func TestSplitPaths(t *testing.T) {
+	if got := chunkPath("out/general.json", 12); got != "out/general.0012.json" {
+		t.Errorf("chunkPath() = %q", got)
+	}
+	if got := indexPath("out/general.json"); got != "out/general.index.json" {
+		t.Errorf("indexPath() = %q", got)
+	}
+	if got := chunkPath("dump", 1); got != "dump.0001" {
+		t.Errorf("chunkPath() without extension = %q", got)
+	}
+	if got := periodPath("out", "2024-01", "ndjson"); got != filepath.Join("out", "2024-01.ndjson") {
+		t.Errorf("periodPath() = %q", got)
+	}
+	if got := (splitSpec{period: "day"}).indexPath("out"); got != filepath.Join("out", "index.json") {
+		t.Errorf("indexPath() of --split = %q", got)
+	}
+	if got := chunkPath("out/general.json.gz", 2); got != "out/general.0002.json.gz" {
+		t.Errorf("chunkPath() of a compressed dump = %q", got)
+	}
+	if got := indexPath("out/general.json.zst"); got != "out/general.index.json" {
+		t.Errorf("indexPath() of a compressed dump = %q", got)
+	}
+}
+
+// channelWithThreads returns a channel of n top-level messages, every third
+// with a two-reply thread.
+func channelWithThreads(n int) *types.Conversation {
+	conv := &types.Conversation{ID: "C1", Name: "general"}
+	for i := range n {
+		ts := fmt.Sprintf("17000%05d.000100", i)
+		m := types.Message{Message: slack.Message{Msg: slack.Msg{Type: "message", User: "U1", Text: fmt.Sprintf("message <%d> & more", i), Timestamp: ts}}}
+		if i%3 == 0 {
+			m.ReplyCount = 2
+			m.ThreadTimestamp = ts
+			for r := range 2 {
+				m.ThreadReplies = append(m.ThreadReplies, types.Message{Message: slack.Message{Msg: slack.Msg{
+					Type: "message", User: "U2", Text: "reply", Timestamp: fmt.Sprintf("17000%05d.00020%d", i, r), ThreadTimestamp: ts,
+				}}})
+			}
+		}
+		conv.Messages = append(conv.Messages, m)
+	}
+	return conv
+}
+
+func TestSplitMergeRoundTrip(t *testing.T) {
+	golden, err := os.ReadFile(filepath.Join("testdata", "conversation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var goldenConv types.Conversation
+	if err := json.Unmarshal(golden, &goldenConv); err != nil {
+		t.Fatal(err)
+	}
+	w := defaultScoreWeights
+
+	tests := []struct {
+		name      string
+		conv      *types.Conversation
+		opts      encodeOptions
+		count     int
+		wantFiles int
+	}{
+		{name: "uneven chunks", conv: channelWithThreads(10), count: 3, wantFiles: 4},
+		{name: "one chunk", conv: channelWithThreads(10), count: 100, wantFiles: 1},
+		{name: "ranked with additions", conv: channelWithThreads(10), opts: encodeOptions{weights: &w, sortBy: "score", firstReactor: true}, count: 4, wantFiles: 3},
+		{name: "golden conversation", conv: &goldenConv, count: 1, wantFiles: max(len(goldenConv.Messages), 1)},
+		{name: "empty", conv: &types.Conversation{ID: "C1", Name: "general"}, count: 5, wantFiles: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := buildOutput(tt.conv, tt.opts)
+			var want bytes.Buffer
+			if err := encodeDocument(&want, doc); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(t.TempDir(), "general.json")
+			if err := writeSplit(path, doc, splitSpec{count: tt.count}); err != nil {
+				t.Fatalf("writeSplit() error: %v", err)
+			}
+			var index splitIndex
+			data, err := os.ReadFile(indexPath(path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &index); err != nil {
+				t.Fatal(err)
+			}
+			if len(index.Files) != tt.wantFiles {
+				t.Fatalf("index lists %d files, want %d", len(index.Files), tt.wantFiles)
+			}
+			total := 0
+			for _, c := range index.Files {
+				if c.Messages > tt.count {
+					t.Errorf("%s has %d messages, more than %d", c.File, c.Messages, tt.count)
+				}
+				total += c.Messages
+			}
+			if total != len(doc.Messages) {
+				t.Errorf("index counts %d messages, want %d", total, len(doc.Messages))
+			}
+
+			var got bytes.Buffer
+			if err := mergeSplit(&got, indexPath(path)); err != nil {
+				t.Fatalf("mergeSplit() error: %v", err)
+			}
+			if got.String() != want.String() {
+				t.Errorf("merged dump differs from the unsplit one:\n%s\nwant\n%s", got.String(), want.String())
+			}
+		})
+	}
+}
+
+func TestSplitIndexRanges(t *testing.T) {
+	doc := buildOutput(channelWithThreads(5), encodeOptions{})
+	path := filepath.Join(t.TempDir(), "general.json")
+	if err := writeSplit(path, doc, splitSpec{count: 2}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(indexPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index splitIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	want := []splitChunk{
+		{File: "general.0001.json", Messages: 2, OldestTS: "1700000000.000100", LatestTS: "1700000001.000100"},
+		{File: "general.0002.json", Messages: 2, OldestTS: "1700000002.000100", LatestTS: "1700000003.000100"},
+		{File: "general.0003.json", Messages: 1, OldestTS: "1700000004.000100", LatestTS: "1700000004.000100"},
+	}
+	if index.SplitBy != "count:2" || len(index.Files) != len(want) {
+		t.Fatalf("index = %+v", index)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(index.Files[i], want[i]) {
+			t.Errorf("file %d = %+v, want %+v", i, index.Files[i], want[i])
+		}
+	}
+	// Every chunk is a complete dump with the conversation's envelope.
+	var part types.Conversation
+	data, _ = os.ReadFile(filepath.Join(filepath.Dir(path), "general.0002.json"))
+	if err := json.Unmarshal(data, &part); err != nil || part.ID != "C1" || len(part.Messages) != 2 || len(part.Messages[1].ThreadReplies) != 2 {
+		t.Errorf("chunk 2 = %+v, %v; want C1 with two messages, the second with its thread", part, err)
+	}
+}
+
+func TestMergeSplitRejectsMismatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "general.json")
+	if err := writeSplit(path, buildOutput(channelWithThreads(4), encodeOptions{}), splitSpec{count: 2}); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "random.json")
+	conv := channelWithThreads(2)
+	conv.ID = "C2"
+	if err := writeSplit(other, buildOutput(conv, encodeOptions{}), splitSpec{count: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(chunkPath(other, 1), chunkPath(path, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mergeSplit(&bytes.Buffer{}, indexPath(path)); err == nil {
+		t.Error("mergeSplit() of chunks from two conversations succeeded")
+	}
+}
+
+func TestSplitByPeriod(t *testing.T) {
+	day := func(date string, n int) string {
+		d, _ := time.Parse(time.DateOnly, date)
+		return fmt.Sprintf("%d.%06d", d.Add(time.Duration(n)*time.Hour).Unix(), n)
+	}
+	// A thread replied to on a later day stays with its parent.
+	parent := parent(day("2024-01-15", 23), 1, day("2024-02-01", 1), msg(day("2024-02-01", 1)))
+	conv := &types.Conversation{ID: "C1", Name: "general", Messages: []types.Message{
+		msg(day("2024-01-15", 1)), parent, msg(day("2024-01-16", 0)), msg(day("2024-02-03", 5)),
+	}}
+	doc := buildOutput(conv, encodeOptions{})
+	var want bytes.Buffer
+	if err := encodeDocument(&want, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		period string
+		want   map[string]int
+	}{
+		{"day", map[string]int{"2024-01-15.json": 2, "2024-01-16.json": 1, "2024-02-03.json": 1}},
+		{"month", map[string]int{"2024-01.json": 3, "2024-02.json": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.period, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "general")
+			if err := writeSplit(dir, doc, splitSpec{period: tt.period}); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var index splitIndex
+			if err := json.Unmarshal(data, &index); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]int)
+			for _, c := range index.Files {
+				got[c.File] = c.Messages
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("index files = %v, want %v", got, tt.want)
+			}
+			if index.SplitBy != tt.period || index.OldestTS != day("2024-01-15", 1) || index.LatestTS != day("2024-02-03", 5) {
+				t.Errorf("index = %+v, want split_by %s over the whole range", index, tt.period)
+			}
+
+			var merged bytes.Buffer
+			if err := mergeSplit(&merged, dir); err != nil {
+				t.Fatal(err)
+			}
+			if merged.String() != want.String() {
+				t.Error("merged dump differs from the unsplit one")
+			}
+		})
+	}
+}
+
+func TestSplitNDJSONByPeriod(t *testing.T) {
+	dir := t.TempDir()
+	pw := newPeriodWriter(dir, splitSpec{period: "day"}, "ndjson")
+	nw := newNDJSONWriter(pw, threadsSeparate, encodeOptions{})
+	nw.rotate = pw.rotate
+	fn := nw.processFunc()
+	// Pages come newest first, as from conversations.history.
+	for _, page := range [][]types.Message{
+		{msg("1705363200.000200"), threadMsg("1705363200.000100", "1705363200.000100", threadMsg("1705449600.000100", "1705363200.000100"))},
+		{msg("1705276800.000100")},
+	} {
+		if _, err := fn(page, "C1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	for _, c := range pw.index.Files {
+		files = append(files, c.File)
+	}
+	if want := []string{"2024-01-15.ndjson", "2024-01-16.ndjson"}; !slices.Equal(files, want) {
+		t.Fatalf("files = %v, want %v", files, want)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, files[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := records(t, string(data)), []string{"1705363200.000200//", "1705363200.000100/1705363200.000100/", "1705449600.000100/1705363200.000100/"}; !slices.Equal(got, want) {
+		t.Errorf("records of 2024-01-16 = %v, want %v, the reply with its parent", got, want)
+	}
+	if err := mergeSplit(io.Discard, dir); err == nil {
+		t.Error("merge reassembled an NDJSON split")
+	}
+
+	// A period can't come back once the stream has moved on.
+	pw = newPeriodWriter(t.TempDir(), splitSpec{period: "day"}, "ndjson")
+	for _, ts := range []string{"1705363200.000100", "1705276800.000100"} {
+		if err := pw.rotate(ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.rotate("1705363200.000200"); err == nil {
+		t.Error("rotate() went back to a finished file")
+	}
+	pw.abort()
+}
+
+func TestSplitGitHubMarkdownByPeriod(t *testing.T) {
+	old := outputFormat
+	outputFormat = "gh-markdown"
+	t.Cleanup(func() { outputFormat = old })
+	conv := &types.Conversation{ID: "C1", Name: "general", Messages: []types.Message{
+		msg("1705276800.000100"), msg("1705363200.000100", msg("1705449600.000100")), msg("1705363300.000100"),
+	}}
+	dir := filepath.Join(t.TempDir(), "general")
+	if err := writeGitHubMarkdownSplit(dir, "", buildOutput(conv, encodeOptions{}), splitSpec{period: "day"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index splitIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int)
+	for _, c := range index.Files {
+		got[c.File] = c.Messages
+	}
+	if want := map[string]int{"2024-01-15.md": 1, "2024-01-16.md": 2}; !maps.Equal(got, want) || index.Format != "gh-markdown" {
+		t.Errorf("index = %+v, want files %v of gh-markdown", index, want)
+	}
+	page, err := os.ReadFile(filepath.Join(dir, "2024-01-16.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(page, []byte("#general")) {
+		t.Errorf("2024-01-16.md = %q, want a gh-markdown part", page)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3"
+	"github.com/rusq/slackdump/v3/auth"
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/emoji"
+	"github.com/wham/gh-slackdump/internal/errs"
+	"github.com/wham/gh-slackdump/internal/progress"
+	"github.com/wham/gh-slackdump/internal/users"
+)
+
+// messageSpool keeps the top-level messages of a channel dump, with their
+// threads, in a temporary file as slackdump fetches them. Only what orders
+// them is held in memory, so the JSON document is written oldest first
+// without the conversation in memory.
+type messageSpool struct {
+	f       *os.File
+	w       *bufio.Writer
+	size    int64
+	entries []spoolEntry
+}
+
+// spoolEntry is a spooled message: its ts and author, which order it and
+// tell its duplicates, and where its JSON is in the file.
+type spoolEntry struct {
+	ts, user, bot string
+	off           int64
+	n             int
+}
+
+// newMessageSpool creates the spool's file in the temporary directory. It
+// holds the channel in plain text, so an interrupted run removes it too
+// (pendingFiles).
+func newMessageSpool() (*messageSpool, error) {
+	f, err := os.CreateTemp("", "gh-slackdump-spool-*.jsonl")
+	if err != nil {
+		return nil, fmt.Errorf("spool: %w", err)
+	}
+	trackTemp(f.Name())
+	return &messageSpool{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// add spools msgs and clears each down to its ts, all slackdump needs of
+// the chunks it keeps for the conversation it returns.
+func (s *messageSpool) add(msgs []types.Message) error {
+	for i := range msgs {
+		m := &msgs[i]
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if _, err := s.w.Write(data); err != nil {
+			return fmt.Errorf("spool: %w", err)
+		}
+		s.entries = append(s.entries, spoolEntry{ts: m.Timestamp, user: m.User, bot: m.BotID, off: s.size, n: len(data)})
+		s.size += int64(len(data))
+		*m = types.Message{Message: slack.Message{Msg: slack.Msg{Timestamp: m.Timestamp}}}
+	}
+	return nil
+}
+
+// groups returns the spooled messages oldest first, each with its
+// duplicates (the same ts and author, as normalizeMessages drops) unless
+// --no-normalize is set.
+func (s *messageSpool) groups() [][]spoolEntry {
+	slices.SortStableFunc(s.entries, func(a, b spoolEntry) int {
+		switch {
+		case tsBefore(a.ts, b.ts):
+			return -1
+		case tsBefore(b.ts, a.ts):
+			return 1
+		}
+		return 0
+	})
+	var out [][]spoolEntry
+	start := 0
+	for i := range s.entries {
+		next := i + 1
+		if next < len(s.entries) && !noNormalize {
+			a, b := s.entries[i], s.entries[next]
+			if a.ts == b.ts && a.user == b.user && a.bot == b.bot {
+				continue
+			}
+		}
+		out = append(out, s.entries[start:next])
+		start = next
+	}
+	return out
+}
+
+// read returns the spooled messages of a group.
+func (s *messageSpool) read(group []spoolEntry) ([]types.Message, error) {
+	if err := s.w.Flush(); err != nil {
+		return nil, fmt.Errorf("spool: %w", err)
+	}
+	msgs := make([]types.Message, len(group))
+	for i, e := range group {
+		data := make([]byte, e.n)
+		if _, err := s.f.ReadAt(data, e.off); err != nil {
+			return nil, fmt.Errorf("spool: %w", err)
+		}
+		if err := json.Unmarshal(data, &msgs[i]); err != nil {
+			return nil, fmt.Errorf("spool: %w", err)
+		}
+	}
+	return msgs, nil
+}
+
+// close removes the spool's file.
+func (s *messageSpool) close() {
+	s.f.Close()
+	removeTemp(s.f.Name())
+}
+
+// writeSpooled writes conv, whose messages are in s, as the JSON document,
+// as encodeConversation would after normalizeConversation. Each message is
+// read back, normalized, passed to prepare and encoded in turn, so only one
+// is in memory at a time.
+func writeSpooled(w io.Writer, conv *types.Conversation, s *messageSpool, prepare func(msgs []types.Message)) error {
+	opts := outputOptions
+	envelope := *conv
+	envelope.Messages = []types.Message{}
+	groups := s.groups()
+	if len(groups) == 0 {
+		return encodeConversation(w, conv)
+	}
+	var dropped int
+	err := encodeMessages(w, buildOutput(&envelope, opts), len(groups), func(i int) (*outMessage, error) {
+		msgs, err := s.read(groups[i])
+		if err != nil {
+			return nil, err
+		}
+		if !noNormalize {
+			var n int
+			msgs, n = normalizeMessages(msgs)
+			dropped += n
+		}
+		prepare(msgs)
+		return &buildMessages(msgs, opts)[0], nil
+	})
+	if dropped > 0 {
+		slog.Info("dropped duplicate messages", "channel", conv.ID, "count", dropped)
+	}
+	return err
+}
+
+// spoolsDocument reports whether the run writes the JSON document of link
+// through a messageSpool: a channel, not a thread, with nothing that needs
+// all its messages at once (ranking, --split-by, --split, --stats-json in
+// the document's head, --estimate, --expand-shares, --require-complete)
+// and no --encrypt-to, which keeps plaintext off the disk.
+func spoolsDocument(link archiveLink) bool {
+	return outputFormat == "json" && templateFile == "" && link.ts == "" &&
+		splitBy == "" && splitPeriod == "" && topN == 0 && sortBy != "score" && !statsJSON &&
+		!estimate && !expandShared && !requireComplete && outputRecipients == nil &&
+		messageGrep == nil && lastN == 0
+}
+
+// dumpSpooled dumps link as the JSON document to the -o file, or to
+// stdout, through a messageSpool. User handles and the emoji normalizer are
+// loaded before dumping, as for --format ndjson; files are added to files,
+// when it isn't nil, as each chunk comes in.
+func dumpSpooled(ctx context.Context, sd *slackdump.Session, prov auth.Provider, link archiveLink, workspaceURL string, oldest, latest time.Time, files *fileQueue) error {
+	handles, err := userResolver(ctx, prov, workspaceURL)
+	if err != nil {
+		return err
+	}
+	var norm *emoji.Normalizer
+	if normalizeEmoji {
+		norm = emojiNormalizer(ctx, sd)
+	}
+	spool, err := newMessageSpool()
+	if err != nil {
+		return err
+	}
+	defer spool.close()
+
+	progressReporter.Stage(progress.StageDumping)
+	report := progressReporter.ProcessFunc()
+	process := func(chunk []types.Message, channelID string) (slackdump.ProcessResult, error) {
+		files.add(chunk)
+		res, err := report(chunk, channelID)
+		if err != nil {
+			return res, err
+		}
+		return res, spool.add(chunk)
+	}
+	conv, err := sd.Dump(ctx, link.target(), oldest, latest, process)
+	if err != nil {
+		return errs.Classify(err)
+	}
+	setMetadata(ctx, sd, conv, workspaceURL, oldest, latest)
+	if files != nil {
+		if outputOptions.localFiles, err = files.wait(); err != nil {
+			return err
+		}
+	}
+
+	progressReporter.Stage(progress.StageWriting)
+	prepare := func(msgs []types.Message) {
+		countMessages(msgs)
+		conv := &types.Conversation{Messages: msgs}
+		if handles != nil {
+			users.ResolveConversation(conv, handles)
+		}
+		redactConversations(conv)
+		if norm != nil {
+			normalizeReactions(msgs, norm)
+		}
+	}
+	size, err := writeOutputTo(outputFile, func(w io.Writer) error {
+		return writeSpooled(w, conv, spool, prepare)
+	})
+	if err != nil {
+		return err
+	}
+	if handles != nil {
+		if anonymize {
+			slog.Info("anonymized users", "users", len(pseudonyms.Mapping()))
+		} else {
+			slog.Info("resolved user IDs", "users", len(handles.(users.HandleMap)))
+		}
+	}
+	if outputFile != "" {
+		slog.Info("output written", "file", encryptedPath(outputFile), "size", size)
+	}
+	return nil
+}
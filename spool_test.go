@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/wham/gh-slackdump/internal/users"
+)
+
+// spoolChunks spools conv's messages in chunks of n, newest first as
+// slackdump fetches a channel, and returns the conversation slackdump
+// would: what the chunks were left as, oldest first.
+func spoolChunks(t testing.TB, s *messageSpool, conv *types.Conversation, n int) *types.Conversation {
+	msgs := slices.Clone(conv.Messages)
+	slices.Reverse(msgs)
+	var kept []types.Message
+	for chunk := range slices.Chunk(msgs, n) {
+		chunk = slices.Clone(chunk)
+		if err := s.add(chunk); err != nil {
+			t.Fatal(err)
+		}
+		kept = append(kept, chunk...)
+	}
+	slices.Reverse(kept)
+	return &types.Conversation{ID: conv.ID, Name: conv.Name, Messages: kept}
+}
+
+func TestWriteSpooledMatchesBatch(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "conversation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := func() *types.Conversation {
+		var conv types.Conversation
+		if err := json.Unmarshal(data, &conv); err != nil {
+			t.Fatal(err)
+		}
+		// The parent again, without its replies, as an overlapping page
+		// returns it.
+		dup := conv.Messages[0]
+		dup.ThreadReplies = nil
+		conv.Messages = append(conv.Messages, dup)
+		return &conv
+	}
+	t.Cleanup(func() { outputOptions = encodeOptions{} })
+
+	for _, compact := range []bool{false, true} {
+		outputOptions = encodeOptions{compact: compact, firstReactor: true}
+
+		batch := load()
+		normalizeConversation(batch)
+		users.ResolveConversation(batch, users.NewPseudonyms(nil))
+		var want bytes.Buffer
+		if err := encodeConversation(&want, batch); err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := newMessageSpool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.close()
+		conv := spoolChunks(t, s, load(), 1)
+		for _, m := range conv.Messages {
+			if m.Text != "" || m.User != "" || len(m.ThreadReplies) > 0 {
+				t.Fatalf("spooled message %s kept more than its ts: %+v", m.Timestamp, m.Msg)
+			}
+		}
+		p := users.NewPseudonyms(nil)
+		var got bytes.Buffer
+		err = writeSpooled(&got, conv, s, func(msgs []types.Message) {
+			users.ResolveConversation(&types.Conversation{Messages: msgs}, p)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("compact=%v: spooled document =\n%s\nbatch document =\n%s", compact, got.String(), want.String())
+		}
+	}
+}
+
+func TestWriteSpooledEmpty(t *testing.T) {
+	t.Cleanup(func() { outputOptions = encodeOptions{} })
+	outputOptions = encodeOptions{compact: true}
+	s, err := newMessageSpool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	conv := &types.Conversation{ID: "C1", Name: "general"}
+	var got, want bytes.Buffer
+	if err := writeSpooled(&got, conv, s, func([]types.Message) {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := encodeConversation(&want, conv); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("writeSpooled() = %s, want %s", got.String(), want.String())
+	}
+}
+
+func TestSpoolsDocument(t *testing.T) {
+	oldFormat, oldSplit, oldStats := outputFormat, splitBy, statsJSON
+	t.Cleanup(func() { outputFormat, splitBy, statsJSON = oldFormat, oldSplit, oldStats })
+	outputFormat, splitBy, statsJSON = "json", "", false
+
+	if !spoolsDocument(archiveLink{channel: "C1"}) {
+		t.Error("a channel dumped to JSON isn't spooled")
+	}
+	if spoolsDocument(archiveLink{channel: "C1", ts: "1771747003.176409"}) {
+		t.Error("a thread is spooled")
+	}
+	statsJSON = true
+	if spoolsDocument(archiveLink{channel: "C1"}) {
+		t.Error("--stats-json, which goes before the messages, is spooled")
+	}
+	statsJSON, outputFormat = false, "csv"
+	if spoolsDocument(archiveLink{channel: "C1"}) {
+		t.Error("--format csv is spooled")
+	}
+}
+
+// BenchmarkDumpSpooled compares holding the fetched conversation whole, as
+// sd.Dump returns it, then normalizing and encoding it, with spooling each
+// page of 100 as it comes in and writing the document from the spool. Both
+// decode the pages from JSON, newest first, as from the API, and keep what
+// slackdump keeps of them. peak-heap-B is the most memory in use while
+// dumping, sampled.
+func BenchmarkDumpSpooled(b *testing.B) {
+	msgs := slices.Clone(largeConversation(20000).Messages)
+	slices.Reverse(msgs)
+	var pages [][]byte
+	for chunk := range slices.Chunk(msgs, 100) {
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			b.Fatal(err)
+		}
+		pages = append(pages, data)
+	}
+	// fetch decodes each page, passes it to process and returns the
+	// conversation slackdump would.
+	fetch := func(process func(chunk []types.Message) error) (*types.Conversation, error) {
+		var kept []types.Message
+		for _, page := range pages {
+			var chunk []types.Message
+			if err := json.Unmarshal(page, &chunk); err != nil {
+				return nil, err
+			}
+			if err := process(chunk); err != nil {
+				return nil, err
+			}
+			kept = append(kept, chunk...)
+		}
+		slices.Reverse(kept)
+		return &types.Conversation{ID: "C1", Name: "general", Messages: kept}, nil
+	}
+	b.Cleanup(func() { outputOptions = encodeOptions{} })
+	outputOptions = encodeOptions{compact: true}
+	b.Run("whole", benchPeakHeap(func() error {
+		conv, err := fetch(func([]types.Message) error { return nil })
+		if err != nil {
+			return err
+		}
+		normalizeConversation(conv)
+		return encodeConversation(io.Discard, conv)
+	}))
+	b.Run("spooled", benchPeakHeap(func() error {
+		s, err := newMessageSpool()
+		if err != nil {
+			return err
+		}
+		defer s.close()
+		conv, err := fetch(s.add)
+		if err != nil {
+			return err
+		}
+		return writeSpooled(io.Discard, conv, s, func([]types.Message) {})
+	}))
+}
+
+func TestMessageSpoolInterrupted(t *testing.T) {
+	s, err := newMessageSpool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if err := s.add([]types.Message{msg("1.000100")}); err != nil {
+		t.Fatal(err)
+	}
+	removeTempFiles()
+	if _, err := os.Stat(s.f.Name()); !os.IsNotExist(err) {
+		t.Errorf("spool %s left behind after an interrupt: %v", s.f.Name(), err)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+// dumpStats describes what a run dumped, for the run summary or, with
+// --stats-json, the document's stats object.
+type dumpStats struct {
+	// Messages counts top-level messages, Threads those with replies, and
+	// Replies the thread replies. A reply also sent to the channel counts
+	// once; RawMessages counts every message record, BroadcastCopies of
+	// them the second copies of such replies.
+	Messages        int `json:"messages"`
+	Threads         int `json:"threads"`
+	Replies         int `json:"replies"`
+	RawMessages     int `json:"raw_messages"`
+	BroadcastCopies int `json:"broadcast_copies"`
+	// Users counts the distinct authors.
+	Users int `json:"users"`
+	// From and To are the oldest and newest message actually dumped.
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+	// Files and FileBytes count the files the messages reference.
+	Files     int   `json:"files"`
+	FileBytes int64 `json:"file_bytes"`
+	// Reactions counts reactions, each user's once.
+	Reactions int `json:"reactions"`
+	// ElapsedSeconds is the run's time so far, of which
+	// RateLimitWaitSeconds went on waiting out Slack's rate limits.
+	ElapsedSeconds       float64 `json:"elapsed_seconds"`
+	RateLimitWaitSeconds float64 `json:"rate_limit_wait_seconds"`
+	// Downloads counts the --files downloads by what became of them, in
+	// the --stats-json stats object; the run summary has its own.
+	Downloads *fileCounts `json:"downloads,omitempty"`
+
+	users      map[string]bool
+	broadcasts broadcastDedup
+}
+
+// broadcastDedup recognizes the second copy of a reply also sent to the
+// channel: Slack lists it with subtype thread_broadcast both among the
+// thread's replies and among the channel's messages, with the same ts. It
+// holds the ts of the replies and broadcasts seen so far.
+type broadcastDedup map[string]bool
+
+// isCopy reports whether m, a thread reply if reply, is the second copy of
+// a broadcast seen before.
+func (d broadcastDedup) isCopy(m *types.Message, reply bool) bool {
+	broadcast := m.SubType == slack.MsgSubTypeThreadBroadcast
+	if !broadcast && !reply {
+		return false
+	}
+	if prev, ok := d[m.Timestamp]; ok && (prev || broadcast) {
+		return true
+	}
+	d[m.Timestamp] = broadcast
+	return false
+}
+
+// runStats counts what the run dumped, nil until it has dumped something;
+// the dump paths add to it with countMessages.
+var runStats *dumpStats
+
+// rateLimitWaits reports the time the run spent waiting on rate limits;
+// run sets it once it has a session.
+var rateLimitWaits = func() time.Duration { return 0 }
+
+// countMessages adds msgs, with their thread replies, to runStats.
+func countMessages(msgs []types.Message) {
+	if runStats == nil {
+		runStats = &dumpStats{}
+	}
+	for i := range msgs {
+		runStats.add(&msgs[i], false)
+	}
+}
+
+// add counts m, a reply if inThread or if its thread_ts names another
+// message, as in the flat list of a thread dump.
+func (s *dumpStats) add(m *types.Message, inThread bool) {
+	s.RawMessages++
+	reply := inThread || (m.ThreadTimestamp != "" && m.ThreadTimestamp != m.Timestamp)
+	if s.broadcasts == nil {
+		s.broadcasts = make(broadcastDedup)
+	}
+	if s.broadcasts.isCopy(m, reply) {
+		s.BroadcastCopies++
+		return
+	}
+	if reply {
+		s.Replies++
+	} else {
+		s.Messages++
+	}
+	if m.ReplyCount > 0 || len(m.ThreadReplies) > 0 {
+		s.Threads++
+	}
+	if author := cmp.Or(m.User, m.BotID); author != "" {
+		if s.users == nil {
+			s.users = make(map[string]bool)
+		}
+		s.users[author] = true
+		s.Users = len(s.users)
+	}
+	if t, err := parseSlackTS(m.Timestamp); err == nil {
+		if s.From == nil || t.Before(*s.From) {
+			s.From = &t
+		}
+		if s.To == nil || t.After(*s.To) {
+			s.To = &t
+		}
+	}
+	for _, f := range m.Files {
+		s.Files++
+		s.FileBytes += int64(f.Size)
+	}
+	for _, r := range m.Reactions {
+		s.Reactions += r.Count
+	}
+	for i := range m.ThreadReplies {
+		s.add(&m.ThreadReplies[i], true)
+	}
+}
+
+// finished returns the stats with the time the run has taken since
+// started.
+func (s *dumpStats) finished(started time.Time) *dumpStats {
+	out := *s
+	out.ElapsedSeconds = time.Since(started).Round(time.Millisecond).Seconds()
+	out.RateLimitWaitSeconds = rateLimitWaits().Round(time.Millisecond).Seconds()
+	return &out
+}
+
+// write writes the stats for people, e.g.
+//
+//	12034 messages, 412 threads, 3180 replies from 57 users
+//	2024-01-02 09:12 to 2024-06-30 17:40 UTC
+//	214 files (1.2 GB), 5120 reactions
+//	took 4m10s, 1m30s of it waiting on rate limits
+func (s *dumpStats) write(w io.Writer) {
+	fmt.Fprintf(w, "%d messages, %d threads, %d replies from %d users", s.Messages, s.Threads, s.Replies, s.Users)
+	if s.BroadcastCopies > 0 {
+		fmt.Fprintf(w, " (broadcast copies left out: %d)", s.BroadcastCopies)
+	}
+	fmt.Fprintln(w)
+	if s.From != nil {
+		fmt.Fprintf(w, "%s to %s UTC\n", s.From.UTC().Format("2006-01-02 15:04"), s.To.UTC().Format("2006-01-02 15:04"))
+	}
+	fmt.Fprintf(w, "%d files (%s), %d reactions\n", s.Files, formatSize(s.FileBytes), s.Reactions)
+	elapsed := time.Duration(s.ElapsedSeconds * float64(time.Second)).Round(100 * time.Millisecond)
+	waited := time.Duration(s.RateLimitWaitSeconds * float64(time.Second)).Round(100 * time.Millisecond)
+	fmt.Fprintf(w, "took %s, %s of it waiting on rate limits\n", elapsed, waited)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestCountMessages(t *testing.T) {
+	msg := func(ts, threadTS, user string, replyCount int) types.Message {
+		return types.Message{Message: slack.Message{Msg: slack.Msg{Timestamp: ts, ThreadTimestamp: threadTS, User: user, ReplyCount: replyCount}}}
+	}
+	parent := msg("1700000000.000100", "1700000000.000100", "U1", 2)
+	parent.Files = []slack.File{{Size: 1000}, {Size: 24}}
+	parent.Reactions = []slack.ItemReaction{{Name: "+1", Count: 3}, {Name: "eyes", Count: 1}}
+	parent.ThreadReplies = []types.Message{
+		msg("1700000060.000000", "1700000000.000100", "U2", 0),
+		msg("1700000120.000000", "1700000000.000100", "U1", 0),
+	}
+	bot := msg("1700086400.000000", "", "", 0)
+	bot.BotID = "B1"
+	// U2's reply, also sent to the channel, is listed there too.
+	broadcast := parent.ThreadReplies[0]
+	broadcast.SubType = slack.MsgSubTypeThreadBroadcast
+	parent.ThreadReplies[0].SubType = slack.MsgSubTypeThreadBroadcast
+	// A thread dump lists the parent and its replies flat.
+	thread := []types.Message{
+		msg("1699000000.000000", "1699000000.000000", "U3", 1),
+		msg("1699000001.000000", "1699000000.000000", "U1", 0),
+	}
+
+	t.Cleanup(func() { runStats = nil })
+	runStats = nil
+	countMessages([]types.Message{broadcast, parent, bot})
+	countMessages(thread)
+	// The raw and deduplicated counts differ by the broadcast copy.
+	want := dumpStats{Messages: 3, Threads: 2, Replies: 3, RawMessages: 7, BroadcastCopies: 1, Users: 4, Files: 2, FileBytes: 1024, Reactions: 4}
+	got := *runStats
+	if got.From == nil || !got.From.Equal(time.Unix(1699000000, 0)) || got.To == nil || !got.To.Equal(time.Unix(1700086400, 0)) {
+		t.Errorf("range = %v to %v, want the oldest and newest message", got.From, got.To)
+	}
+	got.From, got.To, got.users, got.broadcasts = nil, nil, nil, nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+
+	rateLimitWaits = func() time.Duration { return 1500 * time.Millisecond }
+	t.Cleanup(func() { rateLimitWaits = func() time.Duration { return 0 } })
+	s := runStats.finished(time.Now().Add(-4 * time.Second))
+	var b strings.Builder
+	s.write(&b)
+	for _, line := range []string{
+		"3 messages, 2 threads, 3 replies from 4 users (broadcast copies left out: 1)\n",
+		"2023-11-03 08:26 to 2023-11-15 22:13 UTC\n",
+		"2 files (1.0 KB), 4 reactions\n",
+		"took 4s, 1.5s of it waiting on rate limits\n",
+	} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("stats lack %q:\n%s", line, b.String())
+		}
+	}
+}
+
+func TestStatsJSON(t *testing.T) {
+	t.Cleanup(func() { outputOptions = encodeOptions{} })
+	from := time.Unix(1700000000, 0).UTC()
+	outputOptions = encodeOptions{compact: true, stats: &dumpStats{Messages: 1, Users: 1, From: &from, To: &from, ElapsedSeconds: 2}}
+	var buf bytes.Buffer
+	if err := encodeConversation(&buf, &types.Conversation{ID: "C1", Messages: []types.Message{}}); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"channel_id":"C1","name":"","stats":{"messages":1,"threads":0,"replies":0,"raw_messages":0,"broadcast_copies":0,"users":1,"from":"2023-11-14T22:13:20Z","to":"2023-11-14T22:13:20Z","files":0,"file_bytes":0,"reactions":0,"elapsed_seconds":2,"rate_limit_wait_seconds":0},"messages":[]}` + "\n"
+	if buf.String() != want {
+		t.Errorf("document =\n%s\nwant\n%s", buf.String(), want)
+	}
+	var doc struct{ Stats *dumpStats }
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil || doc.Stats == nil {
+		t.Errorf("stats don't decode: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Kinds of artifact in the run summary.
+const (
+	artifactOutput       = "output"        // the dump, to -o or stdout
+	artifactPart         = "part"          // a file of a --split-by dump
+	artifactPage         = "page"          // a page after the first of an HTML dump
+	artifactIndex        = "index"         // the index of a --split-by dump
+	artifactDirectory    = "directory"     // the files of --format export, zulip or gh-markdown
+	artifactProgress     = "progress"      // the --progress-file stream
+	artifactManifest     = "manifest"      // the --manifest of the files written
+	artifactAnonymizeMap = "anonymize-map" // the --anonymize-map of the pseudonyms
+	artifactFiles        = "files"         // the files downloaded with --files
+)
+
+// artifact is an entry of the run summary. Path is "-" for stdout.
+type artifact struct {
+	Kind  string `json:"kind"`
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+	Files int    `json:"files,omitempty"`
+}
+
+// runSummary is what a run wrote, printed on stderr when it ends.
+type runSummary struct {
+	Artifacts      []artifact `json:"artifacts"`
+	Bytes          int64      `json:"bytes"`
+	ElapsedSeconds float64    `json:"elapsed_seconds"`
+	// Stats counts what was dumped, unless --stats-json wrote it into the
+	// document.
+	Stats *dumpStats `json:"stats,omitempty"`
+	// Redactions counts the --redact replacements by type.
+	Redactions map[string]int `json:"redactions,omitempty"`
+	// Downloads counts the files found with --files by what became of them.
+	Downloads *fileCounts `json:"downloads,omitempty"`
+}
+
+// summarizeRun builds the summary of the files recorded as written, named by
+// what they are in the run the flags describe. The files of an export or
+// Zulip directory, or of gh-markdown parts, are counted under the directory,
+// and those --files downloaded under theirs.
+func summarizeRun(files []writtenFile, elapsed time.Duration) runSummary {
+	s := runSummary{Artifacts: []artifact{}, ElapsedSeconds: elapsed.Round(time.Millisecond).Seconds()}
+	// groups are the indexes of the artifacts counting a directory's files.
+	groups := map[string]int{}
+	group := func(kind, dir string, f writtenFile) {
+		i, ok := groups[kind]
+		if !ok {
+			i = len(s.Artifacts)
+			groups[kind] = i
+			s.Artifacts = append(s.Artifacts, artifact{Kind: kind, Path: dir})
+		}
+		s.Artifacts[i].Bytes += f.bytes
+		s.Artifacts[i].Files++
+		s.Bytes += f.bytes
+	}
+	for _, f := range files {
+		a := artifact{Kind: artifactOutput, Path: f.path, Bytes: f.bytes}
+		switch {
+		case f.path == "":
+			a.Path = "-"
+		case writeManifest && f.path == manifestPath():
+			a.Kind = artifactManifest
+		case f.path == anonymizeMapPath():
+			a.Kind = artifactAnonymizeMap
+		case writesDirectory() && outputFile != "" && inDir(outputFile, f.path):
+			group(artifactDirectory, outputFile, f)
+			continue
+		case downloadsAttachments() && inDir(filesDir(), f.path):
+			group(artifactFiles, filesDir(), f)
+			continue
+		case splitBy != "" && f.path == encryptedPath(indexPath(outputFile)):
+			a.Kind = artifactIndex
+		case splitBy != "":
+			a.Kind = artifactPart
+		case outputFormat == "html" && f.path != encryptedPath(outputFile):
+			a.Kind = artifactPage
+		}
+		s.Artifacts = append(s.Artifacts, a)
+		s.Bytes += f.bytes
+	}
+	if progressFile != "" {
+		if fi, err := os.Stat(progressFile); err == nil {
+			s.Artifacts = append(s.Artifacts, artifact{Kind: artifactProgress, Path: progressFile, Bytes: fi.Size()})
+			s.Bytes += fi.Size()
+		}
+	}
+	return s
+}
+
+// inDir reports whether path is inside directory dir.
+func inDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// writeSummary writes s as a table, or as one line of JSON for
+// --json-summary.
+func writeSummary(w io.Writer, s runSummary, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(w).Encode(s)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "wrote %s in %s:\n", formatSize(s.Bytes), time.Duration(s.ElapsedSeconds*float64(time.Second)).Round(100*time.Millisecond))
+	for _, a := range s.Artifacts {
+		size := formatSize(a.Bytes)
+		if a.Files > 0 {
+			size += fmt.Sprintf(" in %d files", a.Files)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", a.Kind, a.Path, size)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if s.Stats != nil {
+		s.Stats.write(w)
+	}
+	if len(s.Redactions) > 0 {
+		fmt.Fprintf(w, "redacted %s\n", formatCounts(s.Redactions))
+	}
+	if d := s.Downloads; d != nil {
+		kept := ""
+		if d.Kept > 0 {
+			kept = fmt.Sprintf(" (%d kept from an earlier run)", d.Kept)
+		}
+		skipped := ""
+		if len(d.SkippedBy) > 0 {
+			skipped = " (" + formatCounts(d.SkippedBy) + ")"
+		}
+		fmt.Fprintf(w, "files: %d downloaded%s, %d skipped%s, %d failed\n", d.Downloaded, kept, d.Skipped, skipped, d.Failed)
+	}
+	return nil
+}
+
+// printSummary ends a successful run with the summary of what it wrote since
+// started, on stderr. A run that wrote nothing, such as --estimate alone,
+// prints no table, but --json-summary is always written.
+func printSummary(started time.Time) error {
+	writtenFiles.Lock()
+	s := summarizeRun(writtenFiles.files, time.Since(started))
+	writtenFiles.Unlock()
+	if runStats != nil && !statsJSON {
+		s.Stats = runStats.finished(started)
+	}
+	if textRedactor != nil {
+		s.Redactions = textRedactor.Counts()
+	}
+	s.Downloads = fileDownloads
+	if len(s.Artifacts) == 0 && s.Stats == nil && !jsonSummary {
+		return nil
+	}
+	return writeSummary(os.Stderr, s, jsonSummary)
+}
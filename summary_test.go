@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarizeRun(t *testing.T) {
+	dir := t.TempDir()
+	progress := filepath.Join(dir, "progress.ndjson")
+	if err := os.WriteFile(progress, []byte("{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { outputFile, outputFormat, splitBy, progressFile, downloadFiles = "", "json", "", "", false })
+
+	tests := []struct {
+		name                            string
+		output, format, split, progFile string
+		downloads                       bool
+		files                           []writtenFile
+		want                            []artifact
+	}{
+		{
+			name:   "stdout",
+			format: "json",
+			files:  []writtenFile{{"", 100}},
+			want:   []artifact{{Kind: artifactOutput, Path: "-", Bytes: 100}},
+		},
+		{
+			name:     "file and progress",
+			output:   "general.json",
+			format:   "json",
+			progFile: progress,
+			files:    []writtenFile{{"general.json", 100}},
+			want:     []artifact{{Kind: artifactOutput, Path: "general.json", Bytes: 100}, {Kind: artifactProgress, Path: progress, Bytes: 3}},
+		},
+		{
+			name:   "split",
+			output: "general.json.gz",
+			format: "json",
+			split:  "day",
+			files:  []writtenFile{{"general.2024-01-01.json.gz", 10}, {"general.2024-01-02.json.gz", 20}, {"general.index.json", 5}},
+			want: []artifact{
+				{Kind: artifactPart, Path: "general.2024-01-01.json.gz", Bytes: 10},
+				{Kind: artifactPart, Path: "general.2024-01-02.json.gz", Bytes: 20},
+				{Kind: artifactIndex, Path: "general.index.json", Bytes: 5},
+			},
+		},
+		{
+			name:   "html pages",
+			output: "general.html",
+			format: "html",
+			files:  []writtenFile{{"general.html", 10}, {"general.2.html", 20}},
+			want:   []artifact{{Kind: artifactOutput, Path: "general.html", Bytes: 10}, {Kind: artifactPage, Path: "general.2.html", Bytes: 20}},
+		},
+		{
+			name:   "export directory",
+			output: "out",
+			format: "export",
+			files:  []writtenFile{{"out/users.json", 10}, {filepath.Join("out", "general", "2024-01-01.json"), 20}, {"out/channels.json", 5}},
+			want:   []artifact{{Kind: artifactDirectory, Path: "out", Bytes: 35, Files: 3}},
+		},
+		{
+			name:      "downloaded files",
+			output:    "general.json",
+			format:    "json",
+			downloads: true,
+			files:     []writtenFile{{"general.json__files/F1-a.pdf", 10}, {"general.json__files/F2-b.png", 20}, {"general.json", 5}},
+			want:      []artifact{{Kind: artifactFiles, Path: "general.json__files", Bytes: 30, Files: 2}, {Kind: artifactOutput, Path: "general.json", Bytes: 5}},
+		},
+	}
+	seen := map[string]bool{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFile, outputFormat, splitBy, progressFile, downloadFiles = tt.output, tt.format, tt.split, tt.progFile, tt.downloads
+			s := summarizeRun(tt.files, 1500*time.Millisecond)
+			if !slices.Equal(s.Artifacts, tt.want) {
+				t.Errorf("artifacts = %+v, want %+v", s.Artifacts, tt.want)
+			}
+			var total int64
+			for _, a := range tt.want {
+				total += a.Bytes
+				seen[a.Kind] = true
+			}
+			if s.Bytes != total || s.ElapsedSeconds != 1.5 {
+				t.Errorf("total = %d bytes in %gs, want %d in 1.5s", s.Bytes, s.ElapsedSeconds, total)
+			}
+
+			var human, js bytes.Buffer
+			writeSummary(&human, s, false)
+			for _, a := range tt.want {
+				if !strings.Contains(human.String(), a.Kind) || !strings.Contains(human.String(), a.Path) {
+					t.Errorf("summary is missing %s %s:\n%s", a.Kind, a.Path, human.String())
+				}
+			}
+			writeSummary(&js, s, true)
+			var got runSummary
+			if err := json.Unmarshal(js.Bytes(), &got); err != nil || !slices.Equal(got.Artifacts, tt.want) {
+				t.Errorf("--json-summary = %s (%v)", js.String(), err)
+			}
+		})
+	}
+	for _, kind := range []string{artifactOutput, artifactPart, artifactPage, artifactIndex, artifactDirectory, artifactFiles, artifactProgress} {
+		if !seen[kind] {
+			t.Errorf("no case covers %s artifacts", kind)
+		}
+	}
+}
+
+func TestWriteFileAtomicRecordsWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	n := len(writtenFiles.files)
+	if err := writeFileAtomic(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, "{}\n")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	got := writtenFiles.files[n:]
+	if want := []writtenFile{{path, 3}}; !slices.Equal(got, want) {
+		t.Errorf("recorded %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/wham/gh-slackdump/internal/format"
+)
+
+// parseTemplateFlags parses --template (a file) or --template-string; it
+// returns nil when neither is set.
+func parseTemplateFlags(file, text string) (*format.Template, error) {
+	switch {
+	case file != "" && text != "":
+		return nil, errors.New("--template and --template-string can't be combined")
+	case file != "":
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("--template: %w", err)
+		}
+		t, err := format.ParseTemplate(file, string(b))
+		if err != nil {
+			return nil, fmt.Errorf("--template: %w", err)
+		}
+		return t, nil
+	case text != "":
+		t, err := format.ParseTemplate("inline", text)
+		if err != nil {
+			return nil, fmt.Errorf("--template-string: %w", err)
+		}
+		return t, nil
+	}
+	return nil, nil
+}
+
+// writeTemplate writes doc through tmpl, once per top-level message, to
+// path, or to stdout.
+func writeTemplate(path string, doc *outConversation, tmpl *format.Template) error {
+	conv := doc.Conversation
+	conv.Messages = plainMessages(doc.Messages)
+	size, err := writeOutputTo(path, func(w io.Writer) error {
+		return tmpl.Execute(w, conv)
+	})
+	if err != nil || path == "" {
+		return err
+	}
+	slog.Info("output written", "file", path, "size", size)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rusq/slackdump/v3/types"
+)
+
+func TestParseTemplateFlags(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "msg.tmpl")
+	if err := os.WriteFile(file, []byte("{{.User}}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, file, text string
+		wantNil, wantErr bool
+	}{
+		{name: "neither", wantNil: true},
+		{name: "file", file: file},
+		{name: "string", text: "{{.TS}} {{.User}}"},
+		{name: "both", file: file, text: "{{.User}}", wantErr: true},
+		{name: "missing file", file: filepath.Join(t.TempDir(), "nope.tmpl"), wantErr: true},
+		{name: "unknown field", text: "{{.Author}}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTemplateFlags(tt.file, tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTemplateFlags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got == nil) != tt.wantNil {
+				t.Errorf("parseTemplateFlags() = %v, want nil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestWriteTemplate(t *testing.T) {
+	tmpl, err := parseTemplateFlags("", "{{.TS}} {{len .Replies}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv := &types.Conversation{ID: "C1", Messages: []types.Message{
+		msg("1700000100.000100", msg("1700000150.000100")),
+		msg("1700000200.000100"),
+	}}
+	path := filepath.Join(t.TempDir(), "out.txt")
+	if err := writeTemplate(path, buildOutput(conv, encodeOptions{}), tmpl); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1700000100.000100 1\n1700000200.000100 0\n"; string(got) != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if strings.Contains(string(got), "1700000150") {
+		t.Error("replies were written as messages of their own")
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/wham/gh-slackdump/internal/format"
+)
+
+// writeText writes doc as --format text to path, or to stdout, with opts;
+// the target of the link is marked.
+func writeText(path string, doc *outConversation, opts format.TextOptions) error {
+	conv := doc.Conversation
+	conv.Messages = plainMessages(doc.Messages)
+	opts.Target = linkTargetTS(doc.Messages)
+	size, err := writeOutputTo(path, func(w io.Writer) error {
+		return format.WriteText(w, conv, opts)
+	})
+	if err != nil || path == "" {
+		return err
+	}
+	slog.Info("output written", "file", path, "size", size)
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/cli/go-gh/v2/pkg/term"
+	"github.com/rusq/slackdump/v3/types"
+	"github.com/spf13/cobra"
+	"github.com/wham/gh-slackdump/internal/format"
+	"github.com/wham/gh-slackdump/internal/users"
+)
+
+var (
+	viewCollapse bool
+	viewNoPager  bool
+	viewColor    string
+)
+
+var viewCmd = &cobra.Command{
+	Use:   "view <slack-link | dump.json>",
+	Short: "Read a channel or thread, or an earlier dump, in the terminal",
+	Long: `Shows a channel or thread as --format text does, with colors on a terminal:
+fetched from a Slack link like a dump (within --from and --to), or read
+from a JSON dump written earlier (optionally .gz or .zst), which needs no
+Slack at all. Each author gets a color of their own, reactions show under
+their message and thread replies are indented under their parent;
+--collapse-threads shows only how many replies each thread has.
+
+On a terminal the text is paged through $GH_PAGER, $PAGER or less (with
+LESS=FRX unless LESS is set), so / searches it; --no-pager, or a pager of
+cat, writes it straight out. --color always or never overrides the
+terminal detection, which also honors NO_COLOR and CLICOLOR_FORCE.
+
+User IDs are resolved with -u for a link, as for a dump, and with
+--users-file for a dump file, as for convert.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runView(context.Background(), args[0])
+	},
+}
+
+func init() {
+	addSessionFlags(viewCmd)
+	viewCmd.Flags().StringVar(&fromTime, "from", "", "Show messages after this time (RFC3339 or YYYY-MM-DD), for a link")
+	viewCmd.Flags().StringVar(&toTime, "to", "", "Show messages before this time (RFC3339 or YYYY-MM-DD), for a link")
+	viewCmd.Flags().StringVar(&convertUsers, "users-file", "", "Resolve the user IDs of a dump file with this users.json: a Slack export's, or gh-slackdump's user cache")
+	viewCmd.Flags().BoolVar(&viewCollapse, "collapse-threads", false, "Show each thread's reply count instead of its replies")
+	viewCmd.Flags().BoolVar(&viewNoPager, "no-pager", false, "Write to stdout instead of through a pager")
+	viewCmd.Flags().StringVar(&viewColor, "color", "auto", "Color the output: auto (on a terminal), always or never")
+	rootCmd.AddCommand(viewCmd)
+}
+
+// runView shows the conversation of a link or dump file.
+func runView(ctx context.Context, source string) error {
+	opts := format.TextOptions{CollapseThreads: viewCollapse}
+	switch viewColor {
+	case "auto":
+		opts.Color = term.FromEnv().IsColorEnabled()
+	case "always":
+		opts.Color = true
+	case "never":
+	default:
+		return fmt.Errorf("--color: unknown mode %q: use auto, always or never", viewColor)
+	}
+	if verbose || trace {
+		setupLogging(logLevel(), false)
+	} else {
+		setupLogging(slog.LevelError, false)
+	}
+
+	var conv *types.Conversation
+	if isSlackURL(source) {
+		if convertUsers != "" {
+			return errors.New("--users-file resolves the users of a dump file; use -u with a link")
+		}
+		var err error
+		if conv, opts.Target, err = fetchView(ctx, source); err != nil {
+			return err
+		}
+	} else {
+		if fromTime != "" || toTime != "" || resolveUsers || forceUsers {
+			return fmt.Errorf("%s is read as a dump file, so --from, --to, -u and -f don't apply; use --users-file to resolve its users", source)
+		}
+		dump, err := readDump(source)
+		if err != nil {
+			return err
+		}
+		conv = &dump.Conversation
+		if convertUsers != "" {
+			list, err := readUsersFile(convertUsers)
+			if err != nil {
+				return fmt.Errorf("--users-file: %w", err)
+			}
+			names := make(users.HandleMap, len(list))
+			for _, u := range list {
+				names[u.ID] = u.Name
+			}
+			users.ResolveConversation(conv, names)
+		}
+	}
+
+	write := func(w io.Writer) error { return format.WriteText(w, *conv, opts) }
+	if viewNoPager || !term.FromEnv().IsTerminalOutput() {
+		return write(os.Stdout)
+	}
+	return page(write)
+}
+
+// isSlackURL reports whether source is a link rather than a file path.
+func isSlackURL(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+// fetchView fetches the conversation of slackLink as a dump does, with the
+// ts of the linked reply, if any.
+func fetchView(ctx context.Context, slackLink string) (*types.Conversation, string, error) {
+	oldest, err := parseTime(fromTime)
+	if err != nil {
+		return nil, "", fmt.Errorf("--from: %w", err)
+	}
+	latest, err := parseTime(toTime)
+	if err != nil {
+		return nil, "", fmt.Errorf("--to: %w", err)
+	}
+	link, err := parseArchiveLink(slackLink)
+	if err != nil {
+		return nil, "", err
+	}
+	users.SetCacheDir(cacheDir)
+	sess, err := openSession(ctx, slackLink)
+	if err != nil {
+		return nil, "", err
+	}
+	defer sess.close()
+	conv, err := dumpConversation(ctx, sess.sd, link, oldest, latest, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := resolveConversationUsers(ctx, sess.provider, sess.workspaceURL, conv); err != nil {
+		return nil, "", err
+	}
+	return conv, link.reply(), nil
+}
+
+// pagerCommand returns the pager view writes through: $GH_PAGER, $PAGER or
+// less; "" for none, when it is cat.
+func pagerCommand() string {
+	pager := cmp.Or(os.Getenv("GH_PAGER"), os.Getenv("PAGER"), "less")
+	if pager == "cat" {
+		return ""
+	}
+	return pager
+}
+
+// page runs write into the pager, or straight to stdout when there is none
+// or it can't be started. A pager quit before the end isn't an error.
+func page(write func(w io.Writer) error) error {
+	args := strings.Fields(pagerCommand())
+	if len(args) == 0 {
+		return write(os.Stdout)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = os.Environ()
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		// Quit if it fits one screen, pass colors through, keep the screen.
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		slog.Debug("can't start the pager", "pager", args[0], "error", err)
+		return write(os.Stdout)
+	}
+	werr := write(in)
+	in.Close()
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("pager %s: %w", args[0], err)
+	}
+	if errors.Is(werr, syscall.EPIPE) {
+		return nil
+	}
+	return werr
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rusq/slack"
+	"github.com/rusq/slackdump/v3/auth"
+	"github.com/wham/gh-slackdump/internal/format"
+	"github.com/wham/gh-slackdump/internal/users"
+)
+
+// writeZulip writes doc as --format zulip to dir, the stream of the realm
+// named realm, and reports what was left out to stderr. info describes the
+// channel; loadNames, called once the channel is known to be importable,
+// maps user IDs to the names of their Zulip users.
+func writeZulip(dir string, info *slack.Channel, realm string, loadNames func() (map[string]string, error), doc *outConversation) error {
+	if info.IsIM || info.IsMpIM {
+		return fmt.Errorf("--format zulip: %s is a direct message; only channels can be imported", doc.ID)
+	}
+	names, err := loadNames()
+	if err != nil {
+		return err
+	}
+	stream := format.ZulipStream{
+		Realm:       realm,
+		Name:        cmp.Or(info.Name, doc.Name, strings.ToLower(doc.ID)),
+		Description: info.Purpose.Value,
+		Private:     info.IsPrivate,
+	}
+	conv := doc.Conversation
+	conv.Messages = plainMessages(doc.Messages)
+	export := format.Zulip(conv, stream, names)
+
+	for name, v := range export.Files() {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path, func(w io.Writer) error {
+			return encodeIndented(w, v)
+		}); err != nil {
+			return err
+		}
+	}
+	slog.Info("output written", "dir", dir, "message_files", len(export.Messages))
+	reportSkipped(os.Stderr, "Zulip", export.Skipped)
+	if export.SkippedReactions > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d reactions with no standard emoji equivalent\n", export.SkippedReactions)
+	}
+	return nil
+}
+
+// zulipNames returns the user names of the workspace's user cache, keyed by
+// user ID, for --format zulip.
+func zulipNames(ctx context.Context, prov auth.Provider, workspaceURL string) (map[string]string, error) {
+	uc, err := users.NewClient(prov)
+	if err != nil {
+		return nil, err
+	}
+	cached, err := users.LoadOrFetchUsers(ctx, uc, workspaceURL, refetchUsers())
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(cached))
+	for _, u := range cached {
+		names[u.ID] = u.Name
+	}
+	return names, nil
+}